@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"errors"
 	_ "expvar"
 	"fmt"
@@ -18,11 +19,16 @@ import (
 	utilmain "github.com/ipfs/go-ipfs/cmd/ipfs/util"
 	oldcmds "github.com/ipfs/go-ipfs/commands"
 	"github.com/ipfs/go-ipfs/core"
+	autotls "github.com/ipfs/go-ipfs/core/autotls"
 	commands "github.com/ipfs/go-ipfs/core/commands"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
 	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	libp2p "github.com/ipfs/go-ipfs/core/node/libp2p"
+	zerocopy "github.com/ipfs/go-ipfs/core/zerocopy"
 	nodeMount "github.com/ipfs/go-ipfs/fuse/node"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	repo "github.com/ipfs/go-ipfs/repo"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	migrate "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
 	sockets "github.com/libp2p/go-socket-activation"
@@ -48,12 +54,15 @@ const (
 	migrateKwd                = "migrate"
 	mountKwd                  = "mount"
 	offlineKwd                = "offline" // global option
+	readyFdKwd                = "ready-fd"
+	readyFileKwd              = "ready-file"
 	routingOptionKwd          = "routing"
 	routingOptionSupernodeKwd = "supernode"
 	routingOptionDHTClientKwd = "dhtclient"
 	routingOptionDHTKwd       = "dht"
 	routingOptionNoneKwd      = "none"
 	routingOptionDefaultKwd   = "default"
+	swarmKeyFromEnvKwd        = "swarm-key-from-env"
 	unencryptTransportKwd     = "disable-transport-encryption"
 	unrestrictedApiAccessKwd  = "unrestricted-api"
 	writableKwd               = "writable"
@@ -133,6 +142,33 @@ environment variable:
 
   export IPFS_PATH=/path/to/ipfsrepo
 
+Containers
+
+A container can initialize its repo, install the swarm key of its private
+network and start serving in a single invocation:
+
+  ipfs daemon --init --init-profile=pnet-cluster --swarm-key-from-env
+
+--init only initializes the repo if it doesn't exist yet. With
+--swarm-key-from-env, the swarm key is read from $IPFS_SWARM_KEY, in the
+format of the swarm.key file or as the 64 hex digits of the key, or from the
+file named by $IPFS_SWARM_KEY_FILE, such as a mounted secret. It replaces the
+stored key on every start, encrypted if $IPFS_SWARM_KEY_PASSPHRASE is set.
+
+Readiness
+
+The API serves the liveness of the daemon on /health, and its readiness on
+/ready: the repo is open and, unless --offline, the swarm is listening and
+the daemon attempted to connect to its bootstrap peers. Both answer 200 or
+503, without requiring an API token, for the probes of the orchestrators:
+
+  curl -f http://127.0.0.1:5001/ready
+
+A supervisor can also be notified once the daemon is ready: --ready-fd=N
+writes a newline to the file descriptor N, as the s6 supervisor expects, and
+--ready-file=PATH creates the file PATH, holding the pid of the daemon, which
+is removed when the daemon stops.
+
 Routing
 
 IPFS by default will use a DHT for content routing. There is a highly
@@ -160,6 +196,7 @@ Headers.
 		cmds.BoolOption(initOptionKwd, "Initialize ipfs with default settings if not already initialized"),
 		cmds.StringOption(initConfigOptionKwd, "Path to existing configuration file to be loaded during --init"),
 		cmds.StringOption(initProfileOptionKwd, "Configuration profiles to apply for --init. See ipfs init --help for more"),
+		cmds.BoolOption(swarmKeyFromEnvKwd, "Install the swarm key given by $IPFS_SWARM_KEY or $IPFS_SWARM_KEY_FILE before starting"),
 		cmds.StringOption(routingOptionKwd, "Overrides the routing option").WithDefault(routingOptionDefaultKwd),
 		cmds.BoolOption(mountKwd, "Mounts IPFS to the filesystem"),
 		cmds.BoolOption(writableKwd, "Enable writing objects (with POST, PUT and DELETE)"),
@@ -173,6 +210,8 @@ Headers.
 		cmds.BoolOption(enablePubSubKwd, "Instantiate the ipfs daemon with the experimental pubsub feature enabled."),
 		cmds.BoolOption(enableIPNSPubSubKwd, "Enable IPNS record distribution through pubsub; enables pubsub."),
 		cmds.BoolOption(enableMultiplexKwd, "Add the experimental 'go-multiplex' stream muxer to libp2p on construction.").WithDefault(true),
+		cmds.IntOption(readyFdKwd, "Write a newline to this file descriptor once the daemon is ready."),
+		cmds.StringOption(readyFileKwd, "Create this file once the daemon is ready, and remove it when it stops."),
 
 		// TODO: add way to override addresses. tricky part: updating the config if also --init.
 		// cmds.StringOption(apiAddrKwd, "Address for the daemon rpc API (overrides config)"),
@@ -291,6 +330,24 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	// fail before we get to that. It can't hurt to close it twice.
 	defer repo.Close()
 
+	// The swarm key may be stored encrypted in the keystore: prompt for its
+	// passphrase unless it is set in the environment.
+	fsrepo.SwarmKeyPassphrase = func() ([]byte, error) {
+		return keystore.ReadPassphrase("Enter the swarm key passphrase: ")
+	}
+
+	if fromEnv, _ := req.Options[swarmKeyFromEnvKwd].(bool); fromEnv {
+		if err := installSwarmKeyFromEnv(repo); err != nil {
+			return err
+		}
+	}
+
+	ready, err := newReadyNotifier(req)
+	if err != nil {
+		return err
+	}
+	defer ready.stopping()
+
 	offline, _ := req.Options[offlineKwd].(bool)
 	ipnsps, _ := req.Options[enableIPNSPubSubKwd].(bool)
 	pubsub, _ := req.Options[enablePubSubKwd].(bool)
@@ -373,8 +430,17 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	}
 	node.Process.AddChild(goprocess.WithTeardown(cctx.Plugins.Close))
 
+	// obtain the certificates of the TLS addresses - if any
+	tlsEps, err := loadTLSEndpoints(cctx, node)
+	if err != nil {
+		return err
+	}
+	if tlsEps != nil {
+		defer tlsEps.certs.Close()
+	}
+
 	// construct api endpoint - every time
-	apiErrc, err := serveHTTPApi(req, cctx)
+	apiErrc, err := serveHTTPApi(req, cctx, tlsEps)
 	if err != nil {
 		return err
 	}
@@ -390,14 +456,26 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 		}
 	}
 
-	// repo blockstore GC - if --enable-gc flag is present
+	// repo blockstore GC - if --enable-gc flag is present or the quota is enforced
 	gcErrc, err := maybeRunGC(req, node)
 	if err != nil {
 		return err
 	}
 
 	// construct http gateway
-	gwErrc, err := serveHTTPGateway(req, cctx)
+	gwErrc, err := serveHTTPGateway(req, cctx, tlsEps)
+	if err != nil {
+		return err
+	}
+
+	// construct zero-copy api endpoint - if enabled
+	zcErrc, err := serveZeroCopy(req, cctx)
+	if err != nil {
+		return err
+	}
+
+	// construct public api endpoint - if configured
+	pubErrc, err := servePublicAPI(cctx)
 	if err != nil {
 		return err
 	}
@@ -420,11 +498,13 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	// The daemon is *finally* ready.
 	fmt.Printf("Daemon is ready\n")
 	notifyReady()
+	go ready.notifyWhenReady(req.Context, node)
 
 	// Give the user some immediate feedback when they hit C-c
 	go func() {
 		<-req.Context.Done()
 		notifyStopping()
+		ready.stopping()
 		fmt.Println("Received interrupt signal, shutting down...")
 		fmt.Println("(Hit ctrl-c again to force-shutdown the daemon.)")
 	}()
@@ -432,7 +512,7 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	// collect long-running errors and block for shutdown
 	// TODO(cryptix): our fuse currently doesnt follow this pattern for graceful shutdown
 	var errs error
-	for err := range merge(apiErrc, gwErrc, gcErrc) {
+	for err := range merge(apiErrc, gwErrc, gcErrc, zcErrc, pubErrc) {
 		if err != nil {
 			errs = multierror.Append(errs, err)
 		}
@@ -442,7 +522,7 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 }
 
 // serveHTTPApi collects options, creates listener, prints status message and starts serving requests
-func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error) {
+func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context, tlsEps *tlsEndpoints) (<-chan error, error) {
 	cfg, err := cctx.GetConfig()
 	if err != nil {
 		return nil, fmt.Errorf("serveHTTPApi: GetConfig() failed: %s", err)
@@ -494,6 +574,15 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 		}
 	}
 
+	tlsListeners, err := tlsEps.listen(tlsEps.apiAddrs())
+	if err != nil {
+		return nil, fmt.Errorf("serveHTTPApi: %s", err)
+	}
+	for _, listener := range tlsListeners {
+		fmt.Printf("API server listening on %s with TLS\n", listener.Multiaddr())
+	}
+	listeners = append(listeners, tlsListeners...)
+
 	// by default, we don't let you load arbitrary ipfs objects through the api,
 	// because this would open up the api to scripting vulnerabilities.
 	// only the webui objects are allowed.
@@ -501,21 +590,24 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 	unrestricted, _ := req.Options[unrestrictedApiAccessKwd].(bool)
 	gatewayOpt := corehttp.GatewayOption(false, corehttp.WebUIPaths...)
 	if unrestricted {
-		gatewayOpt = corehttp.GatewayOption(true, "/ipfs", "/ipns")
+		gatewayOpt = corehttp.WritableGatewayOption("/ipfs", "/ipns")
 	}
 
 	var opts = []corehttp.ServeOption{
 		corehttp.MetricsCollectionOption("api"),
 		corehttp.CheckVersionOption(),
+		corehttp.CommandLimitsOption(),
 		corehttp.CommandsOption(*cctx),
 		corehttp.WebUIOption,
 		gatewayOpt,
 		corehttp.VersionOption(),
-		defaultMux("/debug/vars"),
-		defaultMux("/debug/pprof/"),
-		corehttp.MutexFractionOption("/debug/pprof-mutex/"),
-		corehttp.MetricsScrapingOption("/debug/metrics/prometheus"),
-		corehttp.LogOption(),
+		corehttp.AuthorizedOption("/debug/vars", defaultMux("/debug/vars")),
+		corehttp.AuthorizedOption("/debug/pprof/", defaultMux("/debug/pprof/")),
+		corehttp.AuthorizedOption("/debug/pprof-mutex/", corehttp.MutexFractionOption("/debug/pprof-mutex/")),
+		corehttp.AuthorizedOption("/debug/metrics/prometheus", corehttp.MetricsScrapingOption("/debug/metrics/prometheus")),
+		corehttp.EventsOption("/debug/events"),
+		corehttp.HealthOption(),
+		corehttp.AuthorizedOption("/logs", corehttp.LogOption()),
 	}
 
 	if len(cfg.Gateway.RootRedirect) > 0 {
@@ -581,7 +673,7 @@ func printSwarmAddrs(node *core.IpfsNode) {
 }
 
 // serveHTTPGateway collects options, creates listener, prints status message and starts serving requests
-func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error) {
+func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context, tlsEps *tlsEndpoints) (<-chan error, error) {
 	cfg, err := cctx.GetConfig()
 	if err != nil {
 		return nil, fmt.Errorf("serveHTTPGateway: GetConfig() failed: %s", err)
@@ -631,29 +723,117 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 		fmt.Printf("Gateway (%s) server listening on %s\n", gwType, listener.Multiaddr())
 	}
 
+	tlsListeners, err := tlsEps.listen(tlsEps.gatewayAddrs())
+	if err != nil {
+		return nil, fmt.Errorf("serveHTTPGateway: %s", err)
+	}
+	for _, listener := range tlsListeners {
+		fmt.Printf("Gateway (%s) server listening on %s with TLS\n", gwType, listener.Multiaddr())
+	}
+	listeners = append(listeners, tlsListeners...)
+
 	cmdctx := *cctx
 	cmdctx.Gateway = true
 
 	var opts = []corehttp.ServeOption{
 		corehttp.MetricsCollectionOption("gateway"),
-		corehttp.IPNSHostnameOption(),
+	}
+	if h := tlsEps.challengeHandler(); h != nil {
+		opts = append(opts, corehttp.ACMEChallengeOption(h))
+	}
+	opts = append(opts,
+		corehttp.HostnameOption(),
 		corehttp.GatewayOption(writable, "/ipfs", "/ipns"),
 		corehttp.VersionOption(),
 		corehttp.CheckVersionOption(),
-		corehttp.CommandsROOption(cmdctx),
+	)
+
+	node, err := cctx.ConstructNode()
+	if err != nil {
+		return nil, fmt.Errorf("serveHTTPGateway: ConstructNode() failed: %s", err)
 	}
 
-	if cfg.Experimental.P2pHttpProxy {
-		opts = append(opts, corehttp.ProxyOption())
+	// the read-only API and the p2p proxy would bypass Gateway.ACL
+	var acl corehttp.GatewayACL
+	if err := repo.LoadConfigKey(node.Repo, corehttp.GatewayACLConfigKey, &acl); err != nil {
+		return nil, fmt.Errorf("serveHTTPGateway: %s", err)
+	}
+	if !acl.Enabled() {
+		opts = append(opts, corehttp.CommandsROOption(cmdctx))
+
+		if cfg.Experimental.P2pHttpProxy {
+			opts = append(opts, corehttp.ProxyOption())
+		}
 	}
 
 	if len(cfg.Gateway.RootRedirect) > 0 {
 		opts = append(opts, corehttp.RedirectOption("", cfg.Gateway.RootRedirect))
 	}
 
+	errc := make(chan error)
+	var wg sync.WaitGroup
+	for _, lis := range listeners {
+		wg.Add(1)
+		go func(lis manet.Listener) {
+			defer wg.Done()
+			errc <- corehttp.Serve(node, manet.NetListener(lis), opts...)
+		}(lis)
+	}
+
+	go func() {
+		wg.Wait()
+		close(errc)
+	}()
+
+	return errc, nil
+}
+
+// servePublicAPI serves the read-only subset of the API to the untrusted
+// clients on Addresses.PublicAPI, if any
+func servePublicAPI(cctx *oldcmds.Context) (<-chan error, error) {
 	node, err := cctx.ConstructNode()
 	if err != nil {
-		return nil, fmt.Errorf("serveHTTPGateway: ConstructNode() failed: %s", err)
+		return nil, fmt.Errorf("servePublicAPI: ConstructNode() failed: %s", err)
+	}
+
+	var addrs []string
+	if err := repo.LoadConfigKey(node.Repo, corehttp.PublicAPIAddrsConfigKey, &addrs); err != nil {
+		return nil, fmt.Errorf("servePublicAPI: %s", err)
+	}
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+
+	// like the read-only API of the gateway, the public API would bypass
+	// Gateway.ACL
+	var acl corehttp.GatewayACL
+	if err := repo.LoadConfigKey(node.Repo, corehttp.GatewayACLConfigKey, &acl); err != nil {
+		return nil, fmt.Errorf("servePublicAPI: %s", err)
+	}
+	if acl.Enabled() {
+		return nil, fmt.Errorf("servePublicAPI: %s can't be served with %s enabled", corehttp.PublicAPIAddrsConfigKey, corehttp.GatewayACLConfigKey)
+	}
+
+	listeners := make([]manet.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		maddr, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("servePublicAPI: invalid public API address: %q (err: %s)", addr, err)
+		}
+		lis, err := manet.Listen(maddr)
+		if err != nil {
+			return nil, fmt.Errorf("servePublicAPI: manet.Listen(%s) failed: %s", maddr, err)
+		}
+		listeners = append(listeners, lis)
+		fmt.Printf("Public API server listening on %s\n", lis.Multiaddr())
+	}
+
+	opts := []corehttp.ServeOption{
+		corehttp.MetricsCollectionOption("publicapi"),
+		corehttp.CheckVersionOption(),
+		corehttp.CommandLimitsOption(),
+		corehttp.CommandsPublicOption(*cctx),
+		corehttp.VersionOption(),
 	}
 
 	errc := make(chan error)
@@ -705,15 +885,131 @@ func mountFuse(req *cmds.Request, cctx *oldcmds.Context) error {
 	return nil
 }
 
+// serveZeroCopy serves the zero-copy API on its Unix socket, if enabled
+func serveZeroCopy(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error) {
+	node, err := cctx.ConstructNode()
+	if err != nil {
+		return nil, fmt.Errorf("serveZeroCopy: ConstructNode() failed: %s", err)
+	}
+	cfg, err := zerocopy.LoadConfig(node.Repo)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	api, err := coreapi.NewCoreAPI(node)
+	if err != nil {
+		return nil, err
+	}
+
+	socket := cfg.SocketPath(cctx.ConfigRoot)
+	lis, err := zerocopy.Listen(socket)
+	if err != nil {
+		return nil, fmt.Errorf("serveZeroCopy: %s", err)
+	}
+	fmt.Printf("Zero-copy API server listening on %s\n", socket)
+
+	errc := make(chan error)
+	go func() {
+		errc <- zerocopy.Serve(req.Context, lis, api, cfg.Limit())
+		close(errc)
+	}()
+	return errc, nil
+}
+
+// tlsEndpoints are the TLS addresses of the API and of the gateway, and the
+// manager of their certificates.
+type tlsEndpoints struct {
+	certs   *autotls.Manager
+	api     []string
+	gateway []string
+}
+
+// loadTLSEndpoints reads the TLS addresses, and obtains their certificates,
+// or returns nil if there are none.
+func loadTLSEndpoints(cctx *oldcmds.Context, node *core.IpfsNode) (*tlsEndpoints, error) {
+	gateway, api, err := autotls.LoadAddrs(node.Repo)
+	if err != nil {
+		return nil, err
+	}
+	if len(gateway) == 0 && len(api) == 0 {
+		return nil, nil
+	}
+	cfg, err := autotls.LoadConfig(node.Repo)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := autotls.New(cfg, cfg.CertDir(cctx.ConfigRoot))
+	if err != nil {
+		return nil, err
+	}
+	return &tlsEndpoints{certs: certs, api: api, gateway: gateway}, nil
+}
+
+func (e *tlsEndpoints) apiAddrs() []string {
+	if e == nil {
+		return nil
+	}
+	return e.api
+}
+
+func (e *tlsEndpoints) gatewayAddrs() []string {
+	if e == nil {
+		return nil
+	}
+	return e.gateway
+}
+
+func (e *tlsEndpoints) challengeHandler() http.Handler {
+	if e == nil {
+		return nil
+	}
+	return e.certs.ChallengeHandler()
+}
+
+// listen listens with TLS on addrs.
+func (e *tlsEndpoints) listen(addrs []string) ([]manet.Listener, error) {
+	var listeners []manet.Listener
+	for _, addr := range addrs {
+		maddr, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS address: %q (err: %s)", addr, err)
+		}
+		lis, err := manet.Listen(maddr)
+		if err != nil {
+			return nil, fmt.Errorf("manet.Listen(%s) failed: %s", maddr, err)
+		}
+		tlsLis := tls.NewListener(manet.NetListener(lis), e.certs.TLSConfig())
+		wrapped, err := manet.WrapNetListener(tlsLis)
+		if err != nil {
+			lis.Close()
+			return nil, err
+		}
+		listeners = append(listeners, wrapped)
+	}
+	return listeners, nil
+}
+
 func maybeRunGC(req *cmds.Request, node *core.IpfsNode) (<-chan error, error) {
 	enableGC, _ := req.Options[enableGCKwd].(bool)
-	if !enableGC {
+	if !enableGC && node.Quota == nil {
 		return nil, nil
 	}
 
 	errc := make(chan error)
 	go func() {
-		errc <- corerepo.PeriodicGC(req.Context, node)
+		// an enforced quota collects the garbage past the watermark, with
+		// or without --enable-gc
+		quotaErrc := make(chan error, 1)
+		go func() {
+			quotaErrc <- corerepo.QuotaGC(req.Context, node)
+		}()
+		if enableGC {
+			errc <- corerepo.PeriodicGC(req.Context, node)
+		}
+		errc <- <-quotaErrc
 		close(errc)
 	}()
 	return errc, nil
@@ -13,6 +13,7 @@ import (
 	assets "github.com/ipfs/go-ipfs/assets"
 	oldcmds "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
+	commands "github.com/ipfs/go-ipfs/core/commands"
 	namesys "github.com/ipfs/go-ipfs/namesys"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
@@ -26,6 +27,8 @@ const (
 	bitsOptionName         = "bits"
 	emptyRepoOptionName    = "empty-repo"
 	profileOptionName      = "profile"
+	swarmKeyGenOptionName  = "swarm-key-gen"
+	swarmKeyFileOptionName = "swarm-key-file"
 )
 
 var errRepoExists = errors.New(`ipfs configuration file already exists!
@@ -43,6 +46,17 @@ initialize it using 'server' profile.
 
 For the list of available profiles see 'ipfs config profile --help'
 
+To set up a private network in a single step, generate its swarm key with
+--swarm-key-gen on the first node, then give that key to the other nodes with
+--swarm-key-file:
+
+    ipfs init --swarm-key-gen
+    ipfs init --swarm-key-file=swarm.key
+
+Both write the swarm.key file of the repo, print the fingerprint of the key
+and apply the 'private' profile, which removes the public bootstrap peers and
+makes the daemon refuse to start without the swarm key.
+
 ipfs uses a repository in the local file system. By default, the repo is
 located at ~/.ipfs. To change the repo location, set the $IPFS_PATH
 environment variable:
@@ -57,6 +71,8 @@ environment variable:
 		cmds.IntOption(bitsOptionName, "b", "Number of bits to use in the generated RSA private key.").WithDefault(nBitsForKeypairDefault),
 		cmds.BoolOption(emptyRepoOptionName, "e", "Don't add and pin help files to the local storage."),
 		cmds.StringOption(profileOptionName, "p", "Apply profile settings to config. Multiple profiles can be separated by ','"),
+		cmds.BoolOption(swarmKeyGenOptionName, "Generate the swarm key of a new private network."),
+		cmds.StringOption(swarmKeyFileOptionName, "Join the private network of the given swarm key file."),
 
 		// TODO need to decide whether to expose the override as a file or a
 		// directory. That is: should we allow the user to also specify the
@@ -107,7 +123,27 @@ environment variable:
 		}
 
 		profiles, _ := req.Options[profileOptionName].(string)
-		return doInit(os.Stdout, cctx.ConfigRoot, empty, nBitsForKeypair, profiles, conf)
+
+		genKey, _ := req.Options[swarmKeyGenOptionName].(bool)
+		keyFile, _ := req.Options[swarmKeyFileOptionName].(string)
+		swarmKey, source, err := initSwarmKey(genKey, keyFile)
+		if err != nil {
+			return err
+		}
+		if swarmKey != nil {
+			if profiles != "" {
+				profiles += ","
+			}
+			profiles += "private"
+		}
+
+		if err := doInit(os.Stdout, cctx.ConfigRoot, empty, nBitsForKeypair, profiles, conf); err != nil {
+			return err
+		}
+		if swarmKey != nil {
+			return installInitSwarmKey(os.Stdout, cctx.ConfigRoot, swarmKey, source)
+		}
+		return nil
 	},
 }
 
@@ -129,6 +165,27 @@ func applyProfiles(conf *config.Config, profiles string) error {
 	return nil
 }
 
+// applyProfileKeys sets the keys of the profiles which are not fields of the
+// config struct, once the repo is initialized.
+func applyProfileKeys(repoRoot string, profiles string) error {
+	if profiles == "" {
+		return nil
+	}
+
+	r, err := fsrepo.Open(repoRoot)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, profile := range strings.Split(profiles, ",") {
+		if err := commands.SetProfileKeys(r, profile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func doInit(out io.Writer, repoRoot string, empty bool, nBitsForKeypair int, confProfiles string, conf *config.Config) error {
 	if _, err := fmt.Fprintf(out, "initializing IPFS node at %s\n", repoRoot); err != nil {
 		return err
@@ -158,6 +215,10 @@ func doInit(out io.Writer, repoRoot string, empty bool, nBitsForKeypair int, con
 		return err
 	}
 
+	if err := applyProfileKeys(repoRoot, confProfiles); err != nil {
+		return err
+	}
+
 	if !empty {
 		if err := addDefaultAssets(out, repoRoot); err != nil {
 			return err
@@ -25,6 +25,7 @@ var localCommands = map[string]*cmds.Command{
 	"daemon":   daemonCmd,
 	"init":     initCmd,
 	"commands": commandsClientCmd,
+	"testnet":  testnetCmd,
 }
 
 func init() {
@@ -84,13 +85,15 @@ func (d *cmdDetails) usesRepo() bool          { return !d.doesNotUseRepo }
 // properties so that other code can make decisions about whether to invoke a
 // command or return an error to the user.
 var cmdDetailsMap = map[string]cmdDetails{
-	"init":        {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true, doesNotUseRepo: true},
-	"daemon":      {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true},
-	"commands":    {doesNotUseRepo: true},
-	"version":     {doesNotUseConfigAsInput: true, doesNotUseRepo: true}, // must be permitted to run before init
-	"log":         {cannotRunOnClient: true},
-	"diag/cmds":   {cannotRunOnClient: true},
-	"repo/fsck":   {cannotRunOnDaemon: true},
-	"config/edit": {cannotRunOnDaemon: true, doesNotUseRepo: true},
-	"cid":         {doesNotUseRepo: true},
+	"init":          {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true, doesNotUseRepo: true},
+	"daemon":        {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true},
+	"commands":      {doesNotUseRepo: true},
+	"version":       {doesNotUseConfigAsInput: true, doesNotUseRepo: true}, // must be permitted to run before init
+	"log":           {cannotRunOnClient: true},
+	"diag/cmds":     {cannotRunOnClient: true},
+	"repo/fsck":     {cannotRunOnDaemon: true},
+	"config/edit":   {cannotRunOnDaemon: true, doesNotUseRepo: true},
+	"config/reload": {cannotRunOnClient: true},
+	"cid":           {doesNotUseRepo: true},
+	"testnet":       {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true, doesNotUseRepo: true},
 }
@@ -18,6 +18,7 @@ import (
 	core "github.com/ipfs/go-ipfs/core"
 	corecmds "github.com/ipfs/go-ipfs/core/commands"
 	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	tracing "github.com/ipfs/go-ipfs/core/tracing"
 	loader "github.com/ipfs/go-ipfs/plugin/loader"
 	repo "github.com/ipfs/go-ipfs/repo"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
@@ -46,6 +47,14 @@ const (
 	heapProfile        = "ipfs.memprof"
 )
 
+// EnvAPIToken is the bearer token sent to the HTTP API, for
+// API.Authorizations.
+const EnvAPIToken = "IPFS_API_TOKEN"
+
+// EnvTrace, when set, asks the daemon to trace the request to the API,
+// whatever Tracing.SampleRate. The ID of the trace is printed on stderr.
+const EnvTrace = "IPFS_TRACE"
+
 func loadPlugins(repoPath string) (*loader.PluginLoader, error) {
 	plugins, err := loader.NewPluginLoader(repoPath)
 	if err != nil {
@@ -267,25 +276,68 @@ func makeExecutor(req *cmds.Request, env interface{}) (cmds.Executor, error) {
 		opts = append(opts, cmdhttp.ClientWithFallback(exe))
 	}
 
+	var transport http.RoundTripper
 	switch network {
 	case "tcp", "tcp4", "tcp6":
 	case "unix":
 		path := host
 		host = "unix"
-		opts = append(opts, cmdhttp.ClientWithHTTPClient(&http.Client{
-			Transport: &http.Transport{
-				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-					return net.Dial("unix", path)
-				},
+		transport = &http.Transport{
+			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", path)
 			},
-		}))
+		}
 	default:
 		return nil, fmt.Errorf("unsupported API address: %s", apiAddr)
 	}
+	headers := make(map[string]string)
+	if token := os.Getenv(EnvAPIToken); token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+	if os.Getenv(EnvTrace) != "" {
+		id, trace := tracing.NewTraceHeaders()
+		for k, v := range trace {
+			headers[k] = v
+		}
+		if id != "" {
+			fmt.Fprintf(os.Stderr, "trace: %s\n", id)
+		}
+	}
+	if len(headers) > 0 {
+		transport = &headerTransport{headers: headers, next: transport}
+	}
+	if transport != nil {
+		opts = append(opts, cmdhttp.ClientWithHTTPClient(&http.Client{Transport: transport}))
+	}
 
 	return cmdhttp.NewClient(host, opts...), nil
 }
 
+// headerTransport sets headers on the requests to the API, the bearer token
+// authenticating them and the trace context.
+type headerTransport struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	// a RoundTripper must not modify the request
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+len(t.headers))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	for k, v := range t.headers {
+		r.Header.Set(k, v)
+	}
+	return next.RoundTrip(r)
+}
+
 // commandDetails returns a command's details for the command given by |path|.
 func commandDetails(path []string) cmdDetails {
 	if len(path) == 0 {
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// readyPollInterval is the period of the checks of the readiness of the node,
+// until it is ready.
+const readyPollInterval = 100 * time.Millisecond
+
+// readyNotifier notifies the supervisor of the daemon that it is ready, by
+// writing a line to the file descriptor given with --ready-fd, as the s6
+// supervisor expects, and by creating the file given with --ready-file.
+type readyNotifier struct {
+	fd   int
+	file string
+}
+
+// newReadyNotifier returns the notifier of the readiness requested by the
+// options of req, or nil.
+func newReadyNotifier(req *cmds.Request) (*readyNotifier, error) {
+	fd, fdSet := req.Options[readyFdKwd].(int)
+	file, _ := req.Options[readyFileKwd].(string)
+	if !fdSet && file == "" {
+		return nil, nil
+	}
+	if fdSet && fd < 3 {
+		return nil, fmt.Errorf("--%s: %d is not a file descriptor the supervisor passed", readyFdKwd, fd)
+	}
+	if !fdSet {
+		fd = -1
+	}
+	if file != "" {
+		// a file left by a previous run must not pass for ready
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("--%s: %s", readyFileKwd, err)
+		}
+	}
+	return &readyNotifier{fd: fd, file: file}, nil
+}
+
+// notifyWhenReady waits for the checks of the readiness of node to pass, as
+// /ready reports them, and notifies the supervisor. It gives up when ctx is
+// done.
+func (r *readyNotifier) notifyWhenReady(ctx context.Context, node *core.IpfsNode) {
+	if r == nil {
+		return
+	}
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+	for !corehttp.CheckReadiness(node).Ready {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+	if err := r.notify(); err != nil {
+		log.Errorf("failed to notify the readiness: %s", err)
+	}
+}
+
+func (r *readyNotifier) notify() error {
+	if r.fd >= 0 {
+		f := os.NewFile(uintptr(r.fd), "ready-fd")
+		_, err := f.Write([]byte("\n"))
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("--%s: %s", readyFdKwd, err)
+		}
+	}
+	if r.file != "" {
+		// written aside and renamed, for the file to be complete once it
+		// exists
+		tmp, err := ioutil.TempFile(filepath.Dir(r.file), ".ipfs-ready-")
+		if err != nil {
+			return fmt.Errorf("--%s: %s", readyFileKwd, err)
+		}
+		_, err = fmt.Fprintf(tmp, "%d\n", os.Getpid())
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), r.file)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("--%s: %s", readyFileKwd, err)
+		}
+	}
+	return nil
+}
+
+// stopping removes the file given with --ready-file, as the daemon is not
+// ready anymore once it shuts down.
+func (r *readyNotifier) stopping() {
+	if r == nil || r.file == "" {
+		return
+	}
+	if err := os.Remove(r.file); err != nil && !os.IsNotExist(err) {
+		log.Errorf("failed to remove the ready file: %s", err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	repo "github.com/ipfs/go-ipfs/repo"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+
+	pnet "github.com/libp2p/go-libp2p-pnet"
+)
+
+// swarmKeyHeader starts the swarm keys given as hex digits, in the format of
+// the swarm.key file.
+const swarmKeyHeader = "/key/swarm/psk/1.0.0/\n/base16/\n"
+
+// Environment variables read by --swarm-key-from-env.
+const (
+	// envSwarmKey holds the swarm key, either in the format of the
+	// swarm.key file or as the 64 hex digits of the key alone.
+	envSwarmKey = "IPFS_SWARM_KEY"
+
+	// envSwarmKeyFile holds the path of a swarm key file.
+	envSwarmKeyFile = fsrepo.EnvSwarmKeyFile
+)
+
+// swarmKeyFromEnv returns the swarm key given in the environment, and where
+// it was found.
+func swarmKeyFromEnv() ([]byte, string, error) {
+	if v := strings.TrimSpace(os.Getenv(envSwarmKey)); v != "" {
+		if b, err := hex.DecodeString(v); err == nil && len(b) == 32 {
+			v = swarmKeyHeader + v
+		}
+		return []byte(v), envSwarmKey, nil
+	}
+	if path := os.Getenv(envSwarmKeyFile); path != "" {
+		key, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, "", err
+		}
+		return key, path, nil
+	}
+	return nil, "", fmt.Errorf("--%s: neither %s nor %s is set", swarmKeyFromEnvKwd, envSwarmKey, envSwarmKeyFile)
+}
+
+// installSwarmKeyFromEnv stores the swarm key given in the environment in the
+// keystore of r, replacing the stored one, so that rotating the secret of a
+// container only takes a restart. The key is encrypted if a passphrase is
+// set in the environment.
+func installSwarmKeyFromEnv(r repo.Repo) error {
+	key, source, err := swarmKeyFromEnv()
+	if err != nil {
+		return err
+	}
+	protec, err := pnet.NewProtector(bytes.NewReader(key))
+	if err != nil {
+		return fmt.Errorf("invalid swarm key in %s: %s", source, err)
+	}
+
+	ks, ok := r.Keystore().(keystore.SwarmKeyStore)
+	if !ok {
+		return fmt.Errorf("the keystore of this repo can't store a swarm key")
+	}
+	if err := ks.PutSwarmKey(key, []byte(os.Getenv(fsrepo.EnvSwarmKeyPassphrase))); err != nil {
+		return err
+	}
+
+	fmt.Printf("Installed swarm key %x from %s\n", protec.Fingerprint(), source)
+	return nil
+}
+
+// generateSwarmKey returns a new random swarm key, in the format of the
+// swarm.key file.
+func generateSwarmKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return []byte(swarmKeyHeader + hex.EncodeToString(key) + "\n"), nil
+}
+
+// initSwarmKey returns the swarm key to install at init, generated with
+// --swarm-key-gen or read from the file of --swarm-key-file, and where it
+// comes from. It returns a nil key if neither option is set.
+func initSwarmKey(gen bool, file string) ([]byte, string, error) {
+	switch {
+	case gen && file != "":
+		return nil, "", fmt.Errorf("--%s and --%s are exclusive", swarmKeyGenOptionName, swarmKeyFileOptionName)
+	case gen:
+		key, err := generateSwarmKey()
+		return key, "", err
+	case file != "":
+		key, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := pnet.NewProtector(bytes.NewReader(key)); err != nil {
+			return nil, "", fmt.Errorf("invalid swarm key in %s: %s", file, err)
+		}
+		return key, file, nil
+	}
+	return nil, "", nil
+}
+
+// installInitSwarmKey writes the swarm key of a new repo to its swarm.key
+// file, and prints its fingerprint.
+func installInitSwarmKey(out io.Writer, repoRoot string, key []byte, source string) error {
+	protec, err := pnet.NewProtector(bytes.NewReader(key))
+	if err != nil {
+		return err
+	}
+	if err := fsrepo.WriteSwarmKeyFile(repoRoot, key); err != nil {
+		return err
+	}
+	if source == "" {
+		_, err = fmt.Fprintf(out, "generated swarm key %x\ngive the swarm.key file of %s to the other nodes, with 'ipfs init --swarm-key-file'\n", protec.Fingerprint(), repoRoot)
+		return err
+	}
+	_, err = fmt.Fprintf(out, "installed swarm key %x from %s\n", protec.Fingerprint(), source)
+	return err
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	testnet "github.com/ipfs/go-ipfs/core/testnet"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const (
+	testnetNodesOptionName      = "nodes"
+	testnetPNetOptionName       = "pnet"
+	testnetSeedOptionName       = "seed"
+	testnetSubprocessOptionName = "subprocess"
+	testnetDirOptionName        = "dir"
+)
+
+// testnetNode describes a spawned test network node.
+type testnetNode struct {
+	Index int
+	ID    string
+	Addrs []string
+	Repo  string `json:",omitempty"`
+}
+
+var testnetCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Developer tools to run local test networks.",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"spawn": testnetSpawnCmd,
+	},
+}
+
+var testnetSpawnCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Spawn an ephemeral network of connected nodes.",
+		ShortDescription: `
+'ipfs testnet spawn' starts a network of fully connected nodes on the loopback
+interface, prints their peer IDs and addresses, and keeps them running until
+the command is interrupted. Nothing is left behind once it exits.
+`,
+		LongDescription: `
+'ipfs testnet spawn' starts a network of fully connected nodes on the loopback
+interface, prints their peer IDs and addresses, and keeps them running until
+the command is interrupted. Nothing is left behind once it exits.
+
+By default the nodes run inside this process. With --subprocess, each node is
+an 'ipfs daemon' with its own repo, whose path is printed so that commands can
+be run against it:
+
+    > IPFS_PATH=<repo> ipfs swarm peers
+
+With --pnet, all nodes share a generated private network key. Peer IDs and
+the key are derived from --seed, so the same seed always yields the same
+network.
+
+Example:
+
+    > ipfs testnet spawn -n 5 --pnet
+`,
+	},
+	Options: []cmds.Option{
+		cmds.IntOption(testnetNodesOptionName, "n", "Number of nodes to spawn.").WithDefault(3),
+		cmds.BoolOption(testnetPNetOptionName, "Put the nodes in a private network."),
+		cmds.Int64Option(testnetSeedOptionName, "Seed for identities and the network key.").WithDefault(int64(0)),
+		cmds.BoolOption(testnetSubprocessOptionName, "Run each node as an 'ipfs daemon' subprocess."),
+		cmds.StringOption(testnetDirOptionName, "Directory for subprocess repos. Defaults to a temporary directory."),
+	},
+	NoRemote: true,
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		opts := testnet.Options{}
+		opts.N, _ = req.Options[testnetNodesOptionName].(int)
+		opts.PNet, _ = req.Options[testnetPNetOptionName].(bool)
+		opts.Seed, _ = req.Options[testnetSeedOptionName].(int64)
+		opts.Subprocess, _ = req.Options[testnetSubprocessOptionName].(bool)
+		opts.Dir, _ = req.Options[testnetDirOptionName].(string)
+
+		if opts.Subprocess {
+			bin, err := os.Executable()
+			if err != nil {
+				return err
+			}
+			opts.Binary = bin
+		}
+
+		tn, err := testnet.Spawn(req.Context, opts)
+		if err != nil {
+			return err
+		}
+		defer tn.Close()
+
+		for _, n := range tn.Nodes {
+			out := &testnetNode{
+				Index: n.Index,
+				ID:    n.ID.Pretty(),
+				Repo:  n.Repo,
+			}
+			for _, a := range n.Addrs {
+				out.Addrs = append(out.Addrs, a.String())
+			}
+			if err := res.Emit(out); err != nil {
+				return err
+			}
+		}
+
+		<-req.Context.Done()
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *testnetNode) error {
+			fmt.Fprintf(w, "node %d: %s\n", out.Index, out.ID)
+			if out.Repo != "" {
+				fmt.Fprintf(w, "  repo: %s\n", out.Repo)
+			}
+			fmt.Fprintf(w, "  addrs: %s\n", strings.Join(out.Addrs, " "))
+			return nil
+		}),
+	},
+	Type: testnetNode{},
+}
@@ -0,0 +1,361 @@
+// Package addrbook records where the addresses of the peerstore were learned
+// from, and when they expire.
+//
+// The peerstore only keeps the addresses of the peers, with an expiry it
+// doesn't expose. The Recorder returned by Wrap is a peerstore recording the
+// TTL of the addresses added to it, from which their source is inferred: the
+// addresses added while connected to the peer are the ones it reported, those
+// added with a temporary TTL come from the routing, and the addresses given
+// explicitly are marked as such with Mark. An address keeps the source it was
+// first learned from until it expires.
+//
+// With RequireSigned, the Recorder only accepts the addresses vouched for by
+// the peer itself: the ones it reported while connected, over a connection
+// authenticated with its key, and the ones carried in records it signed,
+// marked with MarkSigned. The addresses given explicitly are accepted too;
+// other addresses, as the ones third parties report through the routing, are
+// dropped, so they can't be used to spoof the addresses of a peer. This
+// version of libp2p has no signed peer records; the signed records are the
+// ones exchanged by the peer exchange of private networks.
+package addrbook
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pstore "github.com/libp2p/go-libp2p-core/peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("addrbook")
+
+// ConfigKey is the config key of the escape hatch accepting the unsigned
+// addresses in private networks.
+const ConfigKey = "Swarm.AcceptUnsignedAddrs"
+
+// LoadAcceptUnsigned reads whether the unsigned addresses are accepted from
+// the config of r.
+func LoadAcceptUnsigned(r repo.Repo) (bool, error) {
+	var accept bool
+	if err := repo.LoadConfigKey(r, ConfigKey, &accept); err != nil {
+		return false, fmt.Errorf("%s: %s", ConfigKey, err)
+	}
+	return accept, nil
+}
+
+// Source is where an address was learned from.
+type Source string
+
+const (
+	// SourceObserved is for the addresses reported by the peer while
+	// connected to it.
+	SourceObserved Source = "observed"
+
+	// SourceManual is for the addresses given explicitly, e.g. to
+	// 'ipfs swarm connect', and the permanent ones.
+	SourceManual Source = "manual"
+
+	// SourceDHT is for the addresses found through the routing.
+	SourceDHT Source = "dht"
+
+	// SourceSigned is for the addresses carried in a record signed by the
+	// peer.
+	SourceSigned Source = "signed"
+
+	// SourceUnknown is for the addresses added with another TTL, or
+	// before the peerstore was wrapped.
+	SourceUnknown Source = "unknown"
+)
+
+// maxExpiring is the longest TTL which expires; longer ones, such as
+// pstore.PermanentAddrTTL and pstore.ConnectedAddrTTL, are kept until the
+// addresses are removed.
+const maxExpiring = 100 * 365 * 24 * time.Hour
+
+// pendingMarkTTL is how long the marks of addresses which are not in the
+// peerstore are kept.
+const pendingMarkTTL = time.Minute
+
+// Entry describes an address of a peer.
+type Entry struct {
+	Addr   ma.Multiaddr
+	Source Source
+
+	// TTL is the TTL the address was last added with, and Expires when it
+	// expires, or the zero time if it doesn't.
+	TTL     time.Duration
+	Expires time.Time
+
+	// Sig is the signature of the record carrying the address, for
+	// SourceSigned.
+	Sig []byte
+}
+
+func sourceOf(ttl time.Duration) Source {
+	switch {
+	case ttl == pstore.ConnectedAddrTTL || ttl == pstore.RecentlyConnectedAddrTTL:
+		return SourceObserved
+	case ttl == pstore.PermanentAddrTTL:
+		return SourceManual
+	case ttl == pstore.TempAddrTTL || ttl == pstore.ProviderAddrTTL || ttl == pstore.AddressTTL:
+		return SourceDHT
+	default:
+		return SourceUnknown
+	}
+}
+
+func expiry(now time.Time, ttl time.Duration) time.Time {
+	if ttl > maxExpiring {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+func (e *Entry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
+
+// Recorder is a peerstore recording the source and expiry of the addresses
+// added to it.
+type Recorder struct {
+	pstore.Peerstore
+
+	mu            sync.Mutex
+	addrs         map[peer.ID]map[string]*Entry
+	requireSigned bool
+}
+
+// Wrap returns a Recorder for ps.
+func Wrap(ps pstore.Peerstore) *Recorder {
+	return &Recorder{
+		Peerstore: ps,
+		addrs:     make(map[peer.ID]map[string]*Entry),
+	}
+}
+
+// RequireSigned makes the Recorder drop the addresses not vouched for by
+// their peer.
+func (r *Recorder) RequireSigned() {
+	r.mu.Lock()
+	r.requireSigned = true
+	r.mu.Unlock()
+}
+
+// vouched returns whether an address added with ttl was reported by its peer
+// or given explicitly.
+func vouched(ttl time.Duration) bool {
+	switch sourceOf(ttl) {
+	case SourceObserved, SourceManual:
+		return true
+	default:
+		return false
+	}
+}
+
+// filter returns the addrs of p to add with ttl: all of them, unless the
+// Recorder requires signed addresses, in which case only the ones vouched
+// for by the peer.
+func (r *Recorder) filter(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) []ma.Multiaddr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.requireSigned || ttl <= 0 || vouched(ttl) {
+		return addrs
+	}
+
+	entries := r.entriesLocked(p, time.Now())
+	defer r.cleanupLocked(p)
+	out := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if a == nil {
+			continue
+		}
+		if e, ok := entries[string(a.Bytes())]; ok && (e.Source == SourceSigned || e.Source == SourceManual) {
+			out = append(out, a)
+		}
+	}
+	if dropped := len(addrs) - len(out); dropped > 0 {
+		log.Debugf("dropped %d unsigned addresses of %s", dropped, p.Pretty())
+	}
+	return out
+}
+
+func (r *Recorder) AddAddr(p peer.ID, addr ma.Multiaddr, ttl time.Duration) {
+	r.AddAddrs(p, []ma.Multiaddr{addr}, ttl)
+}
+
+func (r *Recorder) AddAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	addrs = r.filter(p, addrs, ttl)
+	r.Peerstore.AddAddrs(p, addrs, ttl)
+	if ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	exp := expiry(now, ttl)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := r.entriesLocked(p, now)
+	for _, a := range addrs {
+		if a == nil {
+			continue
+		}
+		e, ok := entries[string(a.Bytes())]
+		switch {
+		case !ok:
+			entries[string(a.Bytes())] = &Entry{Addr: a, Source: sourceOf(ttl), TTL: ttl, Expires: exp}
+		case e.TTL == 0:
+			// marked, but not added yet
+			e.TTL, e.Expires = ttl, exp
+		case e.Expires.IsZero():
+			// addresses are only extended when added
+		case exp.IsZero() || exp.After(e.Expires):
+			e.TTL, e.Expires = ttl, exp
+		}
+	}
+	r.cleanupLocked(p)
+}
+
+func (r *Recorder) SetAddr(p peer.ID, addr ma.Multiaddr, ttl time.Duration) {
+	r.SetAddrs(p, []ma.Multiaddr{addr}, ttl)
+}
+
+func (r *Recorder) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	addrs = r.filter(p, addrs, ttl)
+	r.Peerstore.SetAddrs(p, addrs, ttl)
+
+	now := time.Now()
+	exp := expiry(now, ttl)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := r.entriesLocked(p, now)
+	for _, a := range addrs {
+		if a == nil {
+			continue
+		}
+		key := string(a.Bytes())
+		if ttl <= 0 {
+			delete(entries, key)
+			continue
+		}
+		if e, ok := entries[key]; ok {
+			e.TTL, e.Expires = ttl, exp
+		} else {
+			entries[key] = &Entry{Addr: a, Source: sourceOf(ttl), TTL: ttl, Expires: exp}
+		}
+	}
+	r.cleanupLocked(p)
+}
+
+func (r *Recorder) UpdateAddrs(p peer.ID, oldTTL time.Duration, newTTL time.Duration) {
+	r.Peerstore.UpdateAddrs(p, oldTTL, newTTL)
+
+	now := time.Now()
+	exp := expiry(now, newTTL)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := r.entriesLocked(p, now)
+	for key, e := range entries {
+		if e.TTL != oldTTL {
+			continue
+		}
+		if newTTL <= 0 {
+			delete(entries, key)
+		} else {
+			e.TTL, e.Expires = newTTL, exp
+		}
+	}
+	r.cleanupLocked(p)
+}
+
+func (r *Recorder) ClearAddrs(p peer.ID) {
+	r.Peerstore.ClearAddrs(p)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.addrs, p)
+}
+
+// Mark records addrs of p as learned from src, whichever source they were
+// learned from before. Addresses which are not in the peerstore yet are
+// recorded once added.
+func (r *Recorder) Mark(p peer.ID, addrs []ma.Multiaddr, src Source) {
+	r.mark(p, addrs, src, nil)
+}
+
+// MarkSigned records addrs of p as carried in a record signed by p, with the
+// signature sig. They are then accepted even if the Recorder requires signed
+// addresses.
+func (r *Recorder) MarkSigned(p peer.ID, addrs []ma.Multiaddr, sig []byte) {
+	r.mark(p, addrs, SourceSigned, sig)
+}
+
+func (r *Recorder) mark(p peer.ID, addrs []ma.Multiaddr, src Source, sig []byte) {
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := r.entriesLocked(p, now)
+	for _, a := range addrs {
+		if a == nil {
+			continue
+		}
+		if e, ok := entries[string(a.Bytes())]; ok {
+			e.Source, e.Sig = src, sig
+		} else {
+			// forgotten if it isn't added soon
+			entries[string(a.Bytes())] = &Entry{Addr: a, Source: src, Sig: sig, Expires: now.Add(pendingMarkTTL)}
+		}
+	}
+	r.cleanupLocked(p)
+}
+
+// Entries returns the addresses of p in the peerstore, with their source and
+// expiry. Addresses added before the peerstore was wrapped have an unknown
+// source.
+func (r *Recorder) Entries(p peer.ID) []Entry {
+	addrs := r.Peerstore.Addrs(p)
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := r.entriesLocked(p, now)
+	out := make([]Entry, 0, len(addrs))
+	for _, a := range addrs {
+		if e, ok := entries[string(a.Bytes())]; ok && e.TTL != 0 {
+			out = append(out, *e)
+		} else {
+			out = append(out, Entry{Addr: a, Source: SourceUnknown})
+		}
+	}
+	r.cleanupLocked(p)
+	return out
+}
+
+// entriesLocked returns the entries of p, dropping the expired ones.
+func (r *Recorder) entriesLocked(p peer.ID, now time.Time) map[string]*Entry {
+	entries, ok := r.addrs[p]
+	if !ok {
+		entries = make(map[string]*Entry)
+		r.addrs[p] = entries
+	}
+	for key, e := range entries {
+		if e.expired(now) {
+			delete(entries, key)
+		}
+	}
+	return entries
+}
+
+func (r *Recorder) cleanupLocked(p peer.ID) {
+	if len(r.addrs[p]) == 0 {
+		delete(r.addrs, p)
+	}
+}
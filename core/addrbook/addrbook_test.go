@@ -0,0 +1,92 @@
+package addrbook
+
+import (
+	"testing"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pstore "github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-peerstore/pstoremem"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func sources(r *Recorder, p peer.ID) map[string]Source {
+	out := make(map[string]Source)
+	for _, e := range r.Entries(p) {
+		out[e.Addr.String()] = e.Source
+	}
+	return out
+}
+
+func TestSources(t *testing.T) {
+	r := Wrap(pstoremem.NewPeerstore())
+	p := peer.ID("peer")
+	observed := ma.StringCast("/ip4/1.2.3.4/tcp/4001")
+	dht := ma.StringCast("/ip4/5.6.7.8/tcp/4001")
+	manual := ma.StringCast("/ip4/9.9.9.9/tcp/4001")
+
+	r.AddAddr(p, observed, pstore.ConnectedAddrTTL)
+	r.AddAddr(p, dht, pstore.TempAddrTTL)
+	r.Mark(p, []ma.Multiaddr{manual}, SourceManual)
+	r.AddAddr(p, manual, pstore.TempAddrTTL)
+	// learned from the routing again, but first observed
+	r.AddAddr(p, observed, pstore.TempAddrTTL)
+
+	got := sources(r, p)
+	want := map[string]Source{
+		observed.String(): SourceObserved,
+		dht.String():      SourceDHT,
+		manual.String():   SourceManual,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for a, src := range want {
+		if got[a] != src {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+
+	for _, e := range r.Entries(p) {
+		if e.Addr.Equal(observed) != e.Expires.IsZero() {
+			t.Fatalf("unexpected expiry for %s: %s", e.Addr, e.Expires)
+		}
+	}
+
+	r.UpdateAddrs(p, pstore.ConnectedAddrTTL, 0)
+	if _, ok := sources(r, p)[observed.String()]; ok {
+		t.Fatal("expected the observed address to be removed")
+	}
+
+	r.ClearAddrs(p)
+	if len(r.Entries(p)) != 0 || len(r.addrs) != 0 {
+		t.Fatal("expected no addresses")
+	}
+}
+
+func TestRequireSigned(t *testing.T) {
+	r := Wrap(pstoremem.NewPeerstore())
+	r.RequireSigned()
+	p := peer.ID("peer")
+	observed := ma.StringCast("/ip4/1.2.3.4/tcp/4001")
+	dht := ma.StringCast("/ip4/5.6.7.8/tcp/4001")
+	signed := ma.StringCast("/ip4/9.9.9.9/tcp/4001")
+
+	r.AddAddr(p, observed, pstore.ConnectedAddrTTL)
+	r.AddAddr(p, dht, pstore.TempAddrTTL)
+	r.MarkSigned(p, []ma.Multiaddr{signed}, []byte("sig"))
+	r.AddAddr(p, signed, time.Hour)
+
+	got := sources(r, p)
+	if len(got) != 2 || got[observed.String()] != SourceObserved || got[signed.String()] != SourceSigned {
+		t.Fatalf("expected the observed and signed addresses only, got %v", got)
+	}
+	if len(r.Peerstore.Addrs(p)) != 2 {
+		t.Fatal("expected the unsigned address not to reach the peerstore")
+	}
+	for _, e := range r.Entries(p) {
+		if e.Addr.Equal(signed) && string(e.Sig) != "sig" {
+			t.Fatalf("expected the signature of the record, got %q", e.Sig)
+		}
+	}
+}
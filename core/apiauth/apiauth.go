@@ -0,0 +1,231 @@
+// Package apiauth restricts the HTTP API to the clients presenting a bearer
+// token, each token allowing the commands of its scopes.
+//
+// Without any authorization configured, the API stays open to whoever can
+// reach it, as before. Once one is, every request must carry the token of an
+// authorization allowing its command, in an "Authorization: Bearer <token>"
+// header.
+package apiauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+)
+
+// ConfigKey is the config key of the authorizations.
+const ConfigKey = "API.Authorizations"
+
+// Scopes not naming a command.
+const (
+	// ScopeAdmin allows every command.
+	ScopeAdmin = "admin"
+	// ScopeReadOnly allows the commands of the read-only API, as served by
+	// the gateway.
+	ScopeReadOnly = "read-only"
+	// ScopeDebug allows the debugging endpoints of the API listener, as
+	// /debug/pprof/ and /logs.
+	ScopeDebug = "debug"
+)
+
+// hashPrefix starts the tokens stored hashed.
+const hashPrefix = "sha256:"
+
+var (
+	// ErrUnauthorized is the error of the requests without a valid token.
+	ErrUnauthorized = errors.New("unauthorized: a valid API token is required")
+	// ErrForbidden is the error of the requests whose token doesn't allow
+	// the command.
+	ErrForbidden = errors.New("forbidden: the API token doesn't allow this command")
+)
+
+// Authorization is an entry of API.Authorizations.
+type Authorization struct {
+	// Token is the bearer token, or its SHA-256 in hex prefixed with
+	// "sha256:", as 'ipfs config api token add' stores it.
+	Token string
+
+	// Scopes are ScopeAdmin, ScopeReadOnly, or command paths as "pin" or
+	// "pin/add", which allow the command and its subcommands.
+	Scopes []string
+}
+
+// LoadConfig reads API.Authorizations in the config of r, by name.
+func LoadConfig(r repo.Repo) (map[string]Authorization, error) {
+	var cfg map[string]Authorization
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// NewToken returns a random token, and the form to store in the config.
+func NewToken() (token, stored string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hashed form of token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// ValidateScope returns an error if s is not a scope.
+func ValidateScope(s string) error {
+	if s == "" || strings.ContainsAny(s, " ,") || strings.HasPrefix(s, "/") || strings.HasSuffix(s, "/") {
+		return fmt.Errorf("invalid scope %q", s)
+	}
+	return nil
+}
+
+type entry struct {
+	name   string
+	hash   []byte
+	admin  bool
+	ro     bool
+	prefix [][]string
+}
+
+// Authorizer checks the tokens of the requests.
+type Authorizer struct {
+	r repo.Repo
+
+	mu      sync.RWMutex
+	entries []entry
+}
+
+// New returns the authorizer of the authorizations of the config of r.
+func New(r repo.Repo) (*Authorizer, error) {
+	a := &Authorizer{r: r}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload reads the authorizations from the config again, as after a change
+// by 'ipfs config api token'.
+func (a *Authorizer) Reload() error {
+	cfg, err := LoadConfig(a.r)
+	if err != nil {
+		return err
+	}
+	entries, err := compile(cfg)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.entries = entries
+	a.mu.Unlock()
+	return nil
+}
+
+func compile(cfg map[string]Authorization) ([]entry, error) {
+	names := make([]string, 0, len(cfg))
+	for name := range cfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]entry, 0, len(cfg))
+	for _, name := range names {
+		auth := cfg[name]
+		e := entry{name: name}
+
+		switch {
+		case auth.Token == "":
+			return nil, fmt.Errorf("%s.%s: the token is not set", ConfigKey, name)
+		case strings.HasPrefix(auth.Token, hashPrefix):
+			h, err := hex.DecodeString(auth.Token[len(hashPrefix):])
+			if err != nil || len(h) != sha256.Size {
+				return nil, fmt.Errorf("%s.%s: invalid token hash", ConfigKey, name)
+			}
+			e.hash = h
+		default:
+			sum := sha256.Sum256([]byte(auth.Token))
+			e.hash = sum[:]
+		}
+
+		for _, s := range auth.Scopes {
+			if err := ValidateScope(s); err != nil {
+				return nil, fmt.Errorf("%s.%s: %s", ConfigKey, name, err)
+			}
+			switch s {
+			case ScopeAdmin:
+				e.admin = true
+			case ScopeReadOnly:
+				e.ro = true
+			default:
+				e.prefix = append(e.prefix, strings.Split(s, "/"))
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Enabled returns whether any authorization is configured. The API is open
+// otherwise.
+func (a *Authorizer) Enabled() bool {
+	if a == nil {
+		return false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.entries) > 0
+}
+
+// Authorize returns the name of the authorization of token if it allows the
+// command at path, readOnly telling whether the command is part of the
+// read-only API. It returns ErrUnauthorized for an unknown token, and
+// ErrForbidden for a command out of its scopes.
+func (a *Authorizer) Authorize(token string, path []string, readOnly bool) (string, error) {
+	sum := sha256.Sum256([]byte(token))
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var match *entry
+	for i := range a.entries {
+		// compare every entry, so that the time doesn't tell which matched
+		if subtle.ConstantTimeCompare(sum[:], a.entries[i].hash) == 1 && token != "" {
+			match = &a.entries[i]
+		}
+	}
+	if match == nil {
+		return "", ErrUnauthorized
+	}
+	if match.admin || (match.ro && readOnly) {
+		return match.name, nil
+	}
+	for _, p := range match.prefix {
+		if hasPrefix(path, p) {
+			return match.name, nil
+		}
+	}
+	return match.name, ErrForbidden
+}
+
+func hasPrefix(path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
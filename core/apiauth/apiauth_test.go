@@ -0,0 +1,72 @@
+package apiauth
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestAuthorizer(t *testing.T, cfg map[string]Authorization) *Authorizer {
+	t.Helper()
+	entries, err := compile(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Authorizer{entries: entries}
+}
+
+func TestAuthorize(t *testing.T) {
+	token, stored, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newTestAuthorizer(t, map[string]Authorization{
+		"admin":  {Token: "admin-secret", Scopes: []string{ScopeAdmin}},
+		"ci":     {Token: stored, Scopes: []string{"pin", "files/stat"}},
+		"reader": {Token: "reader-secret", Scopes: []string{ScopeReadOnly}},
+	})
+	if !a.Enabled() {
+		t.Fatal("expected the authorizer to be enabled")
+	}
+
+	for _, c := range []struct {
+		token    string
+		path     string
+		readOnly bool
+		err      error
+	}{
+		{"admin-secret", "config/show", false, nil},
+		{token, "pin/add", false, nil},
+		{token, "pin", false, nil},
+		{token, "files/stat", false, nil},
+		{token, "files/rm", false, ErrForbidden},
+		{token, "pins", false, ErrForbidden},
+		{token, "cat", true, ErrForbidden},
+		{"reader-secret", "cat", true, nil},
+		{"reader-secret", "add", false, ErrForbidden},
+		{stored, "pin/add", false, ErrUnauthorized},
+		{"", "cat", true, ErrUnauthorized},
+		{"wrong", "cat", true, ErrUnauthorized},
+	} {
+		if _, err := a.Authorize(c.token, strings.Split(c.path, "/"), c.readOnly); err != c.err {
+			t.Errorf("%s with %q: expected %v, got %v", c.path, c.token, c.err, err)
+		}
+	}
+
+	var none *Authorizer
+	if none.Enabled() || newTestAuthorizer(t, nil).Enabled() {
+		t.Error("expected no authorization to leave the API open")
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	for _, cfg := range []map[string]Authorization{
+		{"a": {Scopes: []string{ScopeAdmin}}},
+		{"a": {Token: "sha256:zz", Scopes: []string{ScopeAdmin}}},
+		{"a": {Token: "t", Scopes: []string{"/pin"}}},
+		{"a": {Token: "t", Scopes: []string{"pin,add"}}},
+	} {
+		if _, err := compile(cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Package archive offloads pins to external long-term storage systems.
+//
+// An archiver, such as a Filecoin client or a tape archiver, is registered
+// by a plugin. Offloading a pin hands the CAR file of its DAG to an archiver,
+// which returns the ID of its receipt, such as a deal ID or the label of a
+// tape. The receipts are kept in the datastore of the repo, and outlive the
+// pins, which are usually removed once offloaded.
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	car "github.com/ipfs/go-ipfs/core/car"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+var prefix = ds.NewKey("/local/archive")
+
+// Archiver stores CAR files in an external storage system.
+type Archiver interface {
+	// Offload stores the CAR file read from r, holding the DAG of root, and
+	// returns the ID of the receipt of the storage system. The CAR file
+	// must be read to the end.
+	Offload(ctx context.Context, root cid.Cid, r io.Reader) (string, error)
+}
+
+var (
+	archiversMu sync.Mutex
+	archivers   = make(map[string]Archiver)
+)
+
+// Register registers a under name. It is called by the plugins loading
+// archivers.
+func Register(name string, a Archiver) error {
+	archiversMu.Lock()
+	defer archiversMu.Unlock()
+	if _, ok := archivers[name]; ok {
+		return fmt.Errorf("already have an archiver named %q", name)
+	}
+	archivers[name] = a
+	return nil
+}
+
+// Get returns the archiver registered under name.
+func Get(name string) (Archiver, bool) {
+	archiversMu.Lock()
+	defer archiversMu.Unlock()
+	a, ok := archivers[name]
+	return a, ok
+}
+
+// Names returns the names of the archivers registered, sorted.
+func Names() []string {
+	archiversMu.Lock()
+	defer archiversMu.Unlock()
+	names := make([]string, 0, len(archivers))
+	for name := range archivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Receipt records the offload of the DAG of Root to an archiver.
+type Receipt struct {
+	Root     cid.Cid
+	Archiver string
+	ID       string
+
+	// Size is the size of the CAR file.
+	Size uint64
+	Time time.Time
+}
+
+// Store holds the receipts, at most one per root and archiver.
+type Store struct {
+	d ds.Datastore
+}
+
+// NewStore returns the store of the receipts in d.
+func NewStore(d ds.Datastore) *Store {
+	return &Store{d: d}
+}
+
+func receiptKey(root cid.Cid, archiver string) ds.Key {
+	return prefix.ChildString(root.String()).ChildString(archiver)
+}
+
+// Put records r, replacing the receipt of a previous offload of its root to
+// its archiver.
+func (s *Store) Put(r Receipt) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.d.Put(receiptKey(r.Root, r.Archiver), b)
+}
+
+// Receipts returns the receipts of root, or of every root if root is
+// undefined, sorted by root and archiver.
+func (s *Store) Receipts(root cid.Cid) ([]Receipt, error) {
+	q := query.Query{Prefix: prefix.String() + "/"}
+	if root.Defined() {
+		q.Prefix = prefix.ChildString(root.String()).String() + "/"
+	}
+	res, err := s.d.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Receipt, 0, len(entries))
+	for _, e := range entries {
+		var r Receipt
+		if err := json.Unmarshal(e.Value, &r); err != nil {
+			return nil, fmt.Errorf("invalid receipt %s: %s", e.Key, err)
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Root != out[j].Root {
+			return out[i].Root.String() < out[j].Root.String()
+		}
+		return out[i].Archiver < out[j].Archiver
+	})
+	return out, nil
+}
+
+var errIncomplete = errors.New("the archiver did not read the whole CAR file")
+
+// Offload hands the CAR file of the DAG of root, read from ng, to the
+// archiver registered under name, and records its receipt.
+func (s *Store) Offload(ctx context.Context, ng ipld.NodeGetter, name string, root cid.Cid) (Receipt, error) {
+	a, ok := Get(name)
+	if !ok {
+		return Receipt{}, fmt.Errorf("no archiver named %q", name)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	cw := &countWriter{w: pw}
+	written := make(chan error, 1)
+	go func() {
+		err := car.Write(ctx, ng, []cid.Cid{root}, cw)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+
+	id, err := a.Offload(ctx, root, pr)
+	// unblocks the writer if the archiver stopped reading
+	pr.CloseWithError(errIncomplete)
+	werr := <-written
+	if err != nil {
+		return Receipt{}, fmt.Errorf("archiver %s: %s", name, err)
+	}
+	if werr != nil {
+		return Receipt{}, werr
+	}
+
+	r := Receipt{
+		Root:     root,
+		Archiver: name,
+		ID:       id,
+		Size:     cw.n,
+		Time:     time.Now(),
+	}
+	return r, s.Put(r)
+}
+
+type countWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += uint64(n)
+	return n, err
+}
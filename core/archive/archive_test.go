@@ -0,0 +1,102 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	car "github.com/ipfs/go-ipfs/core/car"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+type bufferArchiver struct {
+	buf bytes.Buffer
+}
+
+func (a *bufferArchiver) Offload(ctx context.Context, root cid.Cid, r io.Reader) (string, error) {
+	a.buf.Reset()
+	if _, err := io.Copy(&a.buf, r); err != nil {
+		return "", err
+	}
+	return "receipt-" + root.String(), nil
+}
+
+type lazyArchiver struct{}
+
+func (lazyArchiver) Offload(ctx context.Context, root cid.Cid, r io.Reader) (string, error) {
+	// reads the header only
+	_, err := io.ReadFull(r, make([]byte, 8))
+	return "lazy", err
+}
+
+type failingArchiver struct{}
+
+func (failingArchiver) Offload(ctx context.Context, root cid.Cid, r io.Reader) (string, error) {
+	io.Copy(ioutil.Discard, r)
+	return "", errors.New("tape full")
+}
+
+func TestOffload(t *testing.T) {
+	ctx := context.Background()
+	ng := mdtest.Mock()
+	leaf := dag.NodeWithData(bytes.Repeat([]byte("leaf"), 4096))
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("a", leaf); err != nil {
+		t.Fatal(err)
+	}
+	if err := ng.AddMany(ctx, []ipld.Node{leaf, root}); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := &bufferArchiver{}
+	for name, a := range map[string]Archiver{"buffer": buffer, "lazy": lazyArchiver{}, "failing": failingArchiver{}} {
+		if err := Register(name, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Register("buffer", buffer); err == nil {
+		t.Fatal("expected the archiver names to be unique")
+	}
+
+	s := NewStore(dssync.MutexWrap(ds.NewMapDatastore()))
+	r, err := s.Offload(ctx, ng, "buffer", root.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != "receipt-"+root.Cid().String() || r.Size != uint64(buffer.buf.Len()) {
+		t.Fatalf("unexpected receipt %+v", r)
+	}
+	cr, err := car.NewReader(&buffer.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cr.Header.Roots) != 1 || !cr.Header.Roots[0].Equals(root.Cid()) {
+		t.Fatalf("unexpected roots %v", cr.Header.Roots)
+	}
+
+	for _, name := range []string{"lazy", "failing", "missing"} {
+		if _, err := s.Offload(ctx, ng, name, root.Cid()); err == nil {
+			t.Fatalf("expected the offload to %s to fail", name)
+		}
+	}
+
+	receipts, err := s.Receipts(root.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 1 || receipts[0].Archiver != "buffer" || !receipts[0].Root.Equals(root.Cid()) {
+		t.Fatalf("expected the receipt of the buffer only, got %+v", receipts)
+	}
+	if all, err := s.Receipts(cid.Undef); err != nil || len(all) != 1 {
+		t.Fatalf("expected one receipt, got %v %v", all, err)
+	}
+}
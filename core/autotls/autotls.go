@@ -0,0 +1,189 @@
+// Package autotls obtains and renews the certificates of the TLS addresses of
+// the gateway and the API from an ACME certificate authority, Let's Encrypt
+// by default, so that a private gateway needs no reverse proxy in front.
+//
+// With the http-01 challenge, the authority fetches a token from
+// http://<domain>/.well-known/acme-challenge/, which a plain gateway address
+// reachable on port 80 answers, or connects to the TLS address on port 443
+// (tls-alpn-01). With the dns-01 challenge, a hook command sets the TXT record
+// the authority looks up, which works for the hosts not reachable from the
+// internet.
+package autotls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	logging "github.com/ipfs/go-log"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var log = logging.Logger("autotls")
+
+// ConfigKey is the config key of the certificate section.
+const ConfigKey = "TLS"
+
+// Config keys of the TLS addresses, multiaddrs as the plain ones of
+// Addresses.Gateway and Addresses.API.
+const (
+	GatewayAddrsKey = "Addresses.GatewayTLS"
+	APIAddrsKey     = "Addresses.APITLS"
+)
+
+// DefaultDir is the directory of the certificates in the repo when none is
+// configured.
+const DefaultDir = "tls"
+
+// Challenges, the ways of proving the control of the domains.
+const (
+	ChallengeHTTP = "http-01"
+	ChallengeDNS  = "dns-01"
+)
+
+// Config holds the TLS config section.
+type Config struct {
+	// Domains are the names the certificates are obtained for.
+	Domains []string
+
+	// Email is the contact of the account at the authority, warned of
+	// the certificates about to expire.
+	Email string
+
+	// Challenge is ChallengeHTTP, the default, or ChallengeDNS.
+	Challenge string
+
+	// DNSHook is the command setting the TXT records of the dns-01
+	// challenge, run as "<hook> set <name> <value>", then as
+	// "<hook> clear <name> <value>" once validated.
+	DNSHook string
+
+	// Directory is the URL of the ACME directory of the authority,
+	// Let's Encrypt when unset.
+	Directory string
+
+	// Dir is the directory the certificates are kept in, relative to the
+	// repo if not absolute.
+	Dir string
+}
+
+// LoadConfig reads the TLS section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// LoadAddrs reads the TLS addresses of the gateway and the API in the config
+// of r.
+func LoadAddrs(r repo.Repo) (gateway, api []string, err error) {
+	if err := repo.LoadConfigKey(r, GatewayAddrsKey, &gateway); err != nil {
+		return nil, nil, err
+	}
+	if err := repo.LoadConfigKey(r, APIAddrsKey, &api); err != nil {
+		return nil, nil, err
+	}
+	return gateway, api, nil
+}
+
+// CertDir returns the directory of the certificates for the repo at
+// repoPath.
+func (c Config) CertDir(repoPath string) string {
+	if c.Dir == "" {
+		return filepath.Join(repoPath, DefaultDir)
+	}
+	if filepath.IsAbs(c.Dir) {
+		return c.Dir
+	}
+	return filepath.Join(repoPath, c.Dir)
+}
+
+func (c Config) validate() error {
+	if len(c.Domains) == 0 {
+		return fmt.Errorf("%s.Domains must be set to serve TLS addresses", ConfigKey)
+	}
+	for _, d := range c.Domains {
+		if d == "" || strings.ContainsAny(d, "/: ") {
+			return fmt.Errorf("invalid domain %q in %s.Domains", d, ConfigKey)
+		}
+	}
+	switch c.Challenge {
+	case "", ChallengeHTTP:
+	case ChallengeDNS:
+		if c.DNSHook == "" {
+			return fmt.Errorf("%s.DNSHook must be set for the %s challenge", ConfigKey, ChallengeDNS)
+		}
+	default:
+		return fmt.Errorf("unknown %s.Challenge %q, expected %s or %s", ConfigKey, c.Challenge, ChallengeHTTP, ChallengeDNS)
+	}
+	return nil
+}
+
+// Manager provides the certificates of the domains.
+type Manager struct {
+	tlsConfig *tls.Config
+	http      *autocert.Manager
+	dns       *dnsManager
+}
+
+// New returns the manager of the certificates of cfg, kept in dir. With the
+// dns-01 challenge, it obtains the certificate before returning, if there is
+// none valid in dir; otherwise the certificates are obtained on the first
+// connection for each domain.
+func New(cfg Config, dir string) (*Manager, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	client := &acme.Client{DirectoryURL: cfg.Directory}
+
+	if cfg.Challenge == ChallengeDNS {
+		dm, err := newDNSManager(cfg, dir, client)
+		if err != nil {
+			return nil, err
+		}
+		return &Manager{
+			tlsConfig: &tls.Config{
+				GetCertificate: dm.getCertificate,
+				NextProtos:     []string{"h2", "http/1.1"},
+			},
+			dns: dm,
+		}, nil
+	}
+
+	am := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(dir),
+		HostPolicy: autocert.HostWhitelist(cfg.Domains...),
+		Email:      cfg.Email,
+		Client:     client,
+	}
+	return &Manager{tlsConfig: am.TLSConfig(), http: am}, nil
+}
+
+// TLSConfig returns the config of the TLS listeners.
+func (m *Manager) TLSConfig() *tls.Config {
+	return m.tlsConfig
+}
+
+// ChallengeHandler returns the handler of the http-01 challenges, served
+// under /.well-known/acme-challenge/ on the plain addresses, or nil if the
+// challenge is not used.
+func (m *Manager) ChallengeHandler() http.Handler {
+	if m.http == nil {
+		return nil
+	}
+	return m.http.HTTPHandler(http.NotFoundHandler())
+}
+
+// Close stops the renewals.
+func (m *Manager) Close() error {
+	if m.dns != nil {
+		m.dns.close()
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package autotls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	for _, c := range []Config{
+		{},
+		{Domains: []string{"gw.example.com:443"}},
+		{Domains: []string{"gw.example.com"}, Challenge: "tls-sni-01"},
+		{Domains: []string{"gw.example.com"}, Challenge: ChallengeDNS},
+	} {
+		if err := c.validate(); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+	for _, c := range []Config{
+		{Domains: []string{"gw.example.com"}},
+		{Domains: []string{"gw.example.com", "*.ipfs.gw.example.com"}, Challenge: ChallengeDNS, DNSHook: "/bin/true"},
+	} {
+		if err := c.validate(); err != nil {
+			t.Errorf("unexpected error for %+v: %s", c, err)
+		}
+	}
+
+	if dir := (Config{}).CertDir("/repo"); dir != "/repo/tls" {
+		t.Errorf("expected /repo/tls, got %s", dir)
+	}
+	if dir := (Config{Dir: "/etc/ipfs/tls"}).CertDir("/repo"); dir != "/etc/ipfs/tls" {
+		t.Errorf("expected /etc/ipfs/tls, got %s", dir)
+	}
+}
+
+func TestCertFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autotls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Now().Add(60 * 24 * time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gw.example.com"},
+		DNSNames:     []string{"gw.example.com", "*.ipfs.gw.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     notAfter,
+	}, &x509.Certificate{SerialNumber: big.NewInt(1)}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, certFile)
+	if _, err := saveCert(path, key, [][]byte{der}); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := loadCert(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !coversDomains(cert, []string{"gw.example.com", "bafy.ipfs.gw.example.com"}) {
+		t.Error("expected the certificate to cover its domains")
+	}
+	if coversDomains(cert, []string{"other.example.com"}) {
+		t.Error("expected the certificate not to cover other.example.com")
+	}
+	if needsRenewal(cert, time.Now()) {
+		t.Error("expected no renewal 60 days before the expiry")
+	}
+	if !needsRenewal(cert, notAfter.Add(-renewBefore/2)) {
+		t.Error("expected a renewal 15 days before the expiry")
+	}
+
+	// the account key is created once
+	k1, err := loadOrCreateKey(filepath.Join(dir, accountKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := loadOrCreateKey(filepath.Join(dir, accountKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k1.(*ecdsa.PrivateKey).D.Cmp(k2.(*ecdsa.PrivateKey).D) != 0 {
+		t.Error("expected the same account key")
+	}
+}
@@ -0,0 +1,317 @@
+package autotls
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	accountKeyFile = "account.key"
+	certFile       = "certificate.pem"
+)
+
+// renewBefore is how long before its expiry the certificate is renewed.
+const renewBefore = 30 * 24 * time.Hour
+
+// checkInterval is the time between two checks of the expiry, and between
+// the attempts to renew after a failure.
+const checkInterval = time.Hour
+
+// obtainTimeout bounds an issuance, DNS propagation included.
+const obtainTimeout = 10 * time.Minute
+
+// hookTimeout bounds a run of the DNS hook.
+const hookTimeout = 5 * time.Minute
+
+// dnsManager obtains, with the dns-01 challenge, a certificate for all the
+// domains, and renews it.
+type dnsManager struct {
+	cfg    Config
+	dir    string
+	client *acme.Client
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newDNSManager(cfg Config, dir string, client *acme.Client) (*dnsManager, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &dnsManager{
+		cfg:    cfg,
+		dir:    dir,
+		client: client,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	cert, err := loadCert(filepath.Join(dir, certFile))
+	switch {
+	case err == nil && coversDomains(cert, cfg.Domains):
+		m.cert = cert
+	case err != nil && !os.IsNotExist(err):
+		log.Warningf("ignoring the certificate in %s: %s", dir, err)
+	}
+	if m.cert == nil || needsRenewal(m.cert, time.Now()) {
+		if err := m.obtain(); err != nil {
+			cancel()
+			return nil, fmt.Errorf("obtaining the certificate of %s: %s", cfg.Domains, err)
+		}
+	}
+
+	go m.renewLoop()
+	return m, nil
+}
+
+func (m *dnsManager) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return nil, errors.New("no certificate")
+	}
+	return m.cert, nil
+}
+
+func (m *dnsManager) renewLoop() {
+	defer close(m.done)
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-m.ctx.Done():
+			return
+		}
+		m.mu.RLock()
+		renew := needsRenewal(m.cert, time.Now())
+		m.mu.RUnlock()
+		if !renew {
+			continue
+		}
+		if err := m.obtain(); err != nil {
+			log.Errorf("renewing the certificate of %s: %s", m.cfg.Domains, err)
+		}
+	}
+}
+
+func (m *dnsManager) close() {
+	m.cancel()
+	<-m.done
+}
+
+// obtain gets a new certificate from the authority, and stores it.
+func (m *dnsManager) obtain() error {
+	ctx, cancel := context.WithTimeout(m.ctx, obtainTimeout)
+	defer cancel()
+
+	accountKey, err := loadOrCreateKey(filepath.Join(m.dir, accountKeyFile))
+	if err != nil {
+		return err
+	}
+	m.client.Key = accountKey
+	acct := &acme.Account{}
+	if m.cfg.Email != "" {
+		acct.Contact = []string{"mailto:" + m.cfg.Email}
+	}
+	if _, err := m.client.Register(ctx, acct, acme.AcceptTOS); err != nil {
+		// registered already
+		if ae, ok := err.(*acme.Error); !ok || ae.StatusCode != http.StatusConflict {
+			return fmt.Errorf("registering: %s", err)
+		}
+	}
+
+	for _, domain := range m.cfg.Domains {
+		if err := m.authorize(ctx, domain); err != nil {
+			return fmt.Errorf("authorizing %s: %s", domain, err)
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: m.cfg.Domains,
+	}, key)
+	if err != nil {
+		return err
+	}
+	der, _, err := m.client.CreateCert(ctx, csr, 0, true)
+	if err != nil {
+		return fmt.Errorf("issuing: %s", err)
+	}
+
+	cert, err := saveCert(filepath.Join(m.dir, certFile), key, der)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.cert = cert
+	m.mu.Unlock()
+	log.Infof("obtained a certificate for %s, valid until %s", m.cfg.Domains, cert.Leaf.NotAfter)
+	return nil
+}
+
+// authorize proves the control of domain with a TXT record.
+func (m *dnsManager) authorize(ctx context.Context, domain string) error {
+	z, err := m.client.Authorize(ctx, domain)
+	if err != nil {
+		return err
+	}
+	if z.Status == acme.StatusValid {
+		return nil
+	}
+	var chal *acme.Challenge
+	for _, c := range z.Challenges {
+		if c.Type == ChallengeDNS {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("the authority offers no %s challenge", ChallengeDNS)
+	}
+
+	value, err := m.client.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return err
+	}
+	name := "_acme-challenge." + domain
+	if err := m.runHook(ctx, "set", name, value); err != nil {
+		return err
+	}
+	defer func() {
+		if err := m.runHook(context.Background(), "clear", name, value); err != nil {
+			log.Warningf("clearing the record of %s: %s", name, err)
+		}
+	}()
+
+	if _, err := m.client.Accept(ctx, chal); err != nil {
+		return err
+	}
+	_, err = m.client.WaitAuthorization(ctx, z.URI)
+	return err
+}
+
+// runHook runs the DNS hook, which returns once the record is published.
+func (m *dnsManager) runHook(ctx context.Context, action, name, value string) error {
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, m.cfg.DNSHook, action, name, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %s: %s", m.cfg.DNSHook, action, err, out)
+	}
+	return nil
+}
+
+func needsRenewal(cert *tls.Certificate, now time.Time) bool {
+	return cert == nil || now.Add(renewBefore).After(cert.Leaf.NotAfter)
+}
+
+func coversDomains(cert *tls.Certificate, domains []string) bool {
+	for _, d := range domains {
+		if cert.Leaf.VerifyHostname(d) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// loadOrCreateKey reads the EC key at path, generating it if missing.
+func loadOrCreateKey(path string) (crypto.Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		b, _ := pem.Decode(data)
+		if b == nil {
+			return nil, fmt.Errorf("%s: no PEM block", path)
+		}
+		return x509.ParseECPrivateKey(b.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	data = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// saveCert writes the key and the chain to path, the key first, as PEM.
+func saveCert(path string, key *ecdsa.PrivateKey, chain [][]byte) (*tls.Certificate, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	for _, c := range chain {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c})...)
+	}
+
+	cert, err := parseCert(data)
+	if err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+func loadCert(path string) (*tls.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseCert(data)
+}
+
+// parseCert parses the key and the chain written by saveCert.
+func parseCert(data []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
@@ -0,0 +1,495 @@
+// Package backup implements the backup target mode, in which the node stores
+// the snapshots of backup tools, deduplicating their chunks.
+//
+// A backup tool splits its data into chunks addressed by CID, asks the node
+// which ones are missing, uploads only those, then commits a snapshot: the
+// root of a DAG linking the chunks, built by the tool. Uploaded blocks are
+// staged with direct pins until committed, so that a garbage collection in
+// between doesn't remove them. Committed snapshots are pinned recursively, and
+// fetched from the other nodes of the network if needed, so that chunks
+// uploaded to another node of a private network don't need to be uploaded
+// again. The store records the pins it makes, and never removes the pins of
+// the user.
+//
+// Snapshots are kept in a namespace per client, and carry a retention label.
+// The Backup.Retention config maps labels to the number of snapshots kept per
+// client with that label: older ones are removed when a snapshot is committed.
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsquery "github.com/ipfs/go-datastore/query"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// ConfigKey is the key of the backup section in the repo config.
+const ConfigKey = "Backup"
+
+// Config holds the Backup config section.
+type Config struct {
+	// Enabled turns on the backup target mode.
+	Enabled bool
+
+	// Retention maps retention labels to the number of snapshots kept per
+	// client with that label. Snapshots with other labels are kept until
+	// removed.
+	Retention map[string]int
+}
+
+// commitTimeout bounds the time spent fetching the missing blocks of a
+// snapshot.
+const commitTimeout = time.Hour
+
+var (
+	snapshotsPrefix = ds.NewKey("/backup/snapshots")
+	stagedPrefix    = ds.NewKey("/backup/staged")
+	pinsPrefix      = ds.NewKey("/backup/pins") // the pins made by the store, per mode
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// ErrNotFound is returned when removing a snapshot which doesn't exist.
+var ErrNotFound = errors.New("snapshot not found")
+
+// Snapshot is a committed backup.
+type Snapshot struct {
+	Client string
+	Seq    uint64
+	Label  string
+	Root   cid.Cid
+
+	Created time.Time
+}
+
+// Store stores the blocks and snapshots of the backup clients.
+type Store struct {
+	cfg Config
+
+	ds      ds.Batching
+	bs      bserv.BlockService
+	dag     ipld.DAGService
+	pinning pin.Pinner
+	gcl     bstore.GCLocker
+
+	// mu serializes the changes to the snapshots and pins.
+	mu sync.Mutex
+}
+
+// New creates a Store.
+func New(cfg Config, d ds.Batching, bs bserv.BlockService, dag ipld.DAGService, pinning pin.Pinner, gcl bstore.GCLocker) *Store {
+	return &Store{
+		cfg:     cfg,
+		ds:      d,
+		bs:      bs,
+		dag:     dag,
+		pinning: pinning,
+		gcl:     gcl,
+	}
+}
+
+// LoadConfig returns the backup config of r, and whether the backup target
+// mode is enabled.
+func LoadConfig(r repo.Repo) (Config, bool, error) {
+	var cfg Config
+	if err := repo.LoadConfigKey(r, ConfigKey, &cfg); err != nil {
+		return cfg, false, err
+	}
+	for label, keep := range cfg.Retention {
+		if keep < 1 {
+			return cfg, false, fmt.Errorf("%s.Retention: %q must keep at least one snapshot", ConfigKey, label)
+		}
+	}
+	return cfg, cfg.Enabled, nil
+}
+
+// CheckName returns an error if name isn't a valid client name or label.
+func CheckName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid name %q: only letters, digits, '.', '_' and '-' are allowed", name)
+	}
+	return nil
+}
+
+// Missing returns the blocks of cids which are not stored by the node.
+func (s *Store) Missing(cids []cid.Cid) ([]cid.Cid, error) {
+	var missing []cid.Cid
+	for _, c := range cids {
+		has, err := s.bs.Blockstore().Has(c)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			missing = append(missing, c)
+		}
+	}
+	return missing, nil
+}
+
+// Put stores blks, staged for client until its next commit.
+func (s *Store) Put(ctx context.Context, client string, blks []blocks.Block) error {
+	if err := CheckName(client); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer s.gcl.PinLock().Unlock()
+	if err := s.bs.AddBlocks(blks); err != nil {
+		return err
+	}
+
+	batch, err := s.ds.Batch()
+	if err != nil {
+		return err
+	}
+	for _, b := range blks {
+		if err := s.stage(ctx, batch, b.Cid()); err != nil {
+			return err
+		}
+		if err := batch.Put(stagedKey(client, b.Cid()), nil); err != nil {
+			return err
+		}
+	}
+	if err := s.pinning.Flush(ctx); err != nil {
+		return err
+	}
+	return batch.Commit()
+}
+
+// Commit records root as a new snapshot of client with label, pinning it
+// recursively and fetching the blocks missing locally, then removes the
+// snapshots exceeding the retention of label. It returns the new snapshot
+// and the removed ones.
+func (s *Store) Commit(ctx context.Context, client, label string, root cid.Cid) (*Snapshot, []*Snapshot, error) {
+	if err := CheckName(client); err != nil {
+		return nil, nil, err
+	}
+	if err := CheckName(label); err != nil {
+		return nil, nil, err
+	}
+
+	// fetch the blocks missing locally first, pinning them is then quick
+	fetchCtx, cancel := context.WithTimeout(ctx, commitTimeout)
+	defer cancel()
+	if err := dag.FetchGraph(fetchCtx, root, s.dag); err != nil {
+		return nil, nil, err
+	}
+	nd, err := s.dag.Get(ctx, root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snaps, err := s.snapshots(client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.pin(ctx, nd); err != nil {
+		return nil, nil, err
+	}
+
+	snap := &Snapshot{
+		Client:  client,
+		Seq:     1,
+		Label:   label,
+		Root:    root,
+		Created: time.Now(),
+	}
+	if len(snaps) > 0 {
+		snap.Seq = snaps[0].Seq + 1
+	}
+	if err := s.putSnapshot(snap); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.unstage(ctx, client); err != nil {
+		return nil, nil, err
+	}
+
+	keep, ok := s.cfg.Retention[label]
+	if !ok {
+		return snap, nil, nil
+	}
+	var expired []*Snapshot
+	for _, old := range snaps {
+		if old.Label != label {
+			continue
+		}
+		// the new snapshot counts
+		if keep--; keep <= 0 {
+			expired = append(expired, old)
+		}
+	}
+	for _, old := range expired {
+		if err := s.remove(ctx, old); err != nil {
+			return nil, nil, err
+		}
+	}
+	return snap, expired, nil
+}
+
+// Snapshots returns the snapshots of client, or of every client if client is
+// empty, latest first.
+func (s *Store) Snapshots(client string) ([]*Snapshot, error) {
+	if client != "" {
+		if err := CheckName(client); err != nil {
+			return nil, err
+		}
+	}
+	return s.snapshots(client)
+}
+
+// Remove removes the snapshot seq of client, and unpins its root unless
+// another snapshot has it.
+func (s *Store) Remove(ctx context.Context, client string, seq uint64) (*Snapshot, error) {
+	if err := CheckName(client); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.ds.Get(snapshotKey(client, seq))
+	if err == ds.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, s.remove(ctx, &snap)
+}
+
+// Abort unpins the blocks staged for client since its last commit.
+func (s *Store) Abort(ctx context.Context, client string) error {
+	if err := CheckName(client); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unstage(ctx, client)
+}
+
+func (s *Store) snapshots(client string) ([]*Snapshot, error) {
+	prefix := snapshotsPrefix.String() + "/"
+	if client != "" {
+		prefix = snapshotsPrefix.ChildString(client).String() + "/"
+	}
+	res, err := s.ds.Query(dsquery.Query{Prefix: prefix})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	snaps := make([]*Snapshot, 0, len(entries))
+	for _, e := range entries {
+		var snap Snapshot
+		if err := json.Unmarshal(e.Value, &snap); err != nil {
+			return nil, fmt.Errorf("invalid snapshot %s: %s", e.Key, err)
+		}
+		snaps = append(snaps, &snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		if snaps[i].Client != snaps[j].Client {
+			return snaps[i].Client < snaps[j].Client
+		}
+		return snaps[i].Seq > snaps[j].Seq
+	})
+	return snaps, nil
+}
+
+func (s *Store) putSnapshot(snap *Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return s.ds.Put(snapshotKey(snap.Client, snap.Seq), data)
+}
+
+// remove deletes snap, and unpins its root if no other snapshot of any
+// client has it and the store pinned it.
+func (s *Store) remove(ctx context.Context, snap *Snapshot) error {
+	if err := s.ds.Delete(snapshotKey(snap.Client, snap.Seq)); err != nil {
+		return err
+	}
+
+	all, err := s.snapshots("")
+	if err != nil {
+		return err
+	}
+	for _, other := range all {
+		if other.Root.Equals(snap.Root) {
+			return nil
+		}
+	}
+
+	replaced, err := s.ds.Get(pinKey(pin.Recursive, snap.Root))
+	if err == ds.ErrNotFound {
+		// pinned by the user
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	staged, err := s.ds.Has(pinKey(pin.Direct, snap.Root))
+	if err != nil {
+		return err
+	}
+
+	defer s.gcl.PinLock().Unlock()
+	if err := s.pinning.Unpin(ctx, snap.Root, true); err != nil && err != pin.ErrNotPinned {
+		return err
+	}
+	if len(replaced) > 0 || staged {
+		// the pinner dropped the direct pin when pinning recursively
+		s.pinning.PinWithMode(snap.Root, pin.Direct)
+	}
+	if err := s.pinning.Flush(ctx); err != nil {
+		return err
+	}
+	return s.ds.Delete(pinKey(pin.Recursive, snap.Root))
+}
+
+// pin pins nd recursively unless it is already, and records the pin. The
+// pinner drops the direct pin of nd if any: a direct pin of the user is
+// recorded with it, to be restored by remove.
+func (s *Store) pin(ctx context.Context, nd ipld.Node) error {
+	c := nd.Cid()
+	if _, pinned, err := s.pinning.IsPinnedWithType(ctx, c, pin.Recursive); err != nil || pinned {
+		return err
+	}
+	var replaced []byte
+	if _, direct, err := s.pinning.IsPinnedWithType(ctx, c, pin.Direct); err != nil {
+		return err
+	} else if direct {
+		staged, err := s.ds.Has(pinKey(pin.Direct, c))
+		if err != nil {
+			return err
+		}
+		if !staged {
+			mode, _ := pin.ModeToString(pin.Direct)
+			replaced = []byte(mode)
+		}
+	}
+
+	defer s.gcl.PinLock().Unlock()
+	if err := s.pinning.Pin(ctx, nd, true); err != nil {
+		return err
+	}
+	if err := s.pinning.Flush(ctx); err != nil {
+		return err
+	}
+	return s.ds.Put(pinKey(pin.Recursive, c), replaced)
+}
+
+// stage pins c directly unless it is pinned already, and records the pin in
+// batch.
+func (s *Store) stage(ctx context.Context, batch ds.Batch, c cid.Cid) error {
+	for _, mode := range []pin.Mode{pin.Direct, pin.Recursive} {
+		if _, pinned, err := s.pinning.IsPinnedWithType(ctx, c, mode); err != nil || pinned {
+			return err
+		}
+	}
+	s.pinning.PinWithMode(c, pin.Direct)
+	return batch.Put(pinKey(pin.Direct, c), nil)
+}
+
+// unstage removes the direct pins made for the blocks staged for client,
+// except the ones another client has staged too.
+func (s *Store) unstage(ctx context.Context, client string) error {
+	res, err := s.ds.Query(dsquery.Query{Prefix: stagedPrefix.String() + "/", KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+
+	var own []ds.Key
+	others := make(map[string]bool)
+	for _, e := range entries {
+		k := ds.RawKey(e.Key)
+		if k.Parent().BaseNamespace() == client {
+			own = append(own, k)
+		} else {
+			others[k.BaseNamespace()] = true
+		}
+	}
+	if len(own) == 0 {
+		return nil
+	}
+
+	batch, err := s.ds.Batch()
+	if err != nil {
+		return err
+	}
+
+	defer s.gcl.PinLock().Unlock()
+	for _, k := range own {
+		c, err := cid.Decode(k.BaseNamespace())
+		if err != nil {
+			return fmt.Errorf("invalid staged block %s: %s", k, err)
+		}
+		if !others[k.BaseNamespace()] {
+			staged, err := s.ds.Has(pinKey(pin.Direct, c))
+			if err != nil {
+				return err
+			}
+			if staged {
+				s.pinning.RemovePinWithMode(c, pin.Direct)
+				if err := batch.Delete(pinKey(pin.Direct, c)); err != nil {
+					return err
+				}
+			}
+		}
+		if err := batch.Delete(k); err != nil {
+			return err
+		}
+	}
+	if err := s.pinning.Flush(ctx); err != nil {
+		return err
+	}
+	return batch.Commit()
+}
+
+func snapshotKey(client string, seq uint64) ds.Key {
+	return snapshotsPrefix.ChildString(client).ChildString(fmt.Sprintf("%020d", seq))
+}
+
+func stagedKey(client string, c cid.Cid) ds.Key {
+	return stagedPrefix.ChildString(client).ChildString(c.String())
+}
+
+func pinKey(mode pin.Mode, c cid.Cid) ds.Key {
+	name, _ := pin.ModeToString(mode)
+	return pinsPrefix.ChildString(name).ChildString(c.String())
+}
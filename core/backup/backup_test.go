@@ -0,0 +1,194 @@
+package backup
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func newStore(t *testing.T, cfg Config) (*Store, pin.Pinner) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewBlockstore(d)
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pinning := pin.NewPinner(d, dserv, dserv)
+	return New(cfg, d, bserv.New(bs, offline.Exchange(bs)), dserv, pinning, bstore.NewGCLocker()), pinning
+}
+
+// snapshot uploads chunks for client, and returns the root linking them.
+func snapshot(t *testing.T, s *Store, client string, chunks ...string) cid.Cid {
+	ctx := context.Background()
+	root := new(dag.ProtoNode)
+	var blks []blocks.Block
+	for _, c := range chunks {
+		b := dag.NewRawNode([]byte(c))
+		blks = append(blks, b)
+		if err := root.AddNodeLink(c, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blks = append(blks, root)
+	if err := s.Put(ctx, client, blks); err != nil {
+		t.Fatal(err)
+	}
+	return root.Cid()
+}
+
+func isPinned(t *testing.T, pinning pin.Pinner, c cid.Cid, mode pin.Mode) bool {
+	_, pinned, err := pinning.IsPinnedWithType(context.Background(), c, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pinned
+}
+
+func TestRetention(t *testing.T) {
+	ctx := context.Background()
+	s, pinning := newStore(t, Config{Enabled: true, Retention: map[string]int{"daily": 1}})
+
+	chunk := dag.NewRawNode([]byte("a")).Cid()
+	missing, err := s.Missing([]cid.Cid{chunk})
+	if err != nil || len(missing) != 1 {
+		t.Fatalf("expected the chunk to be missing, got %v, %v", missing, err)
+	}
+
+	first := snapshot(t, s, "laptop", "a", "b")
+	if !isPinned(t, pinning, chunk, pin.Direct) {
+		t.Fatal("expected the uploaded chunk to be staged")
+	}
+	if missing, _ := s.Missing([]cid.Cid{chunk}); len(missing) != 0 {
+		t.Fatal("expected the chunk to be stored")
+	}
+
+	snap, removed, err := s.Commit(ctx, "laptop", "daily", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Seq != 1 || len(removed) != 0 {
+		t.Fatalf("unexpected commit: %+v, removed %v", snap, removed)
+	}
+	if isPinned(t, pinning, chunk, pin.Direct) || !isPinned(t, pinning, first, pin.Recursive) {
+		t.Fatal("expected the snapshot to be pinned, and the chunks unstaged")
+	}
+
+	// the same root for another client is kept when removed for the first
+	if _, _, err := s.Commit(ctx, "desktop", "daily", first); err != nil {
+		t.Fatal(err)
+	}
+
+	second := snapshot(t, s, "laptop", "a", "c")
+	snap, removed, err = s.Commit(ctx, "laptop", "daily", second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Seq != 2 || len(removed) != 1 || removed[0].Seq != 1 {
+		t.Fatalf("expected snapshot 1 to be removed, got %+v, removed %v", snap, removed)
+	}
+	if !isPinned(t, pinning, first, pin.Recursive) {
+		t.Fatal("expected the root of another client to stay pinned")
+	}
+
+	if _, err := s.Remove(ctx, "desktop", 1); err != nil {
+		t.Fatal(err)
+	}
+	if isPinned(t, pinning, first, pin.Recursive) {
+		t.Fatal("expected the root to be unpinned")
+	}
+	if _, err := s.Remove(ctx, "desktop", 1); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	snaps, err := s.Snapshots("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 1 || snaps[0].Client != "laptop" || !snaps[0].Root.Equals(second) {
+		t.Fatalf("unexpected snapshots: %v", snaps)
+	}
+}
+
+func TestAbort(t *testing.T) {
+	ctx := context.Background()
+	s, pinning := newStore(t, Config{Enabled: true})
+
+	root := snapshot(t, s, "laptop", "a")
+	snapshot(t, s, "desktop", "a")
+	chunk := dag.NewRawNode([]byte("a")).Cid()
+
+	if err := s.Abort(ctx, "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	if !isPinned(t, pinning, chunk, pin.Direct) {
+		t.Fatal("expected the chunk staged by another client to stay pinned")
+	}
+	if err := s.Abort(ctx, "desktop"); err != nil {
+		t.Fatal(err)
+	}
+	if isPinned(t, pinning, chunk, pin.Direct) || isPinned(t, pinning, root, pin.Direct) {
+		t.Fatal("expected the blocks to be unstaged")
+	}
+
+	if err := s.Abort(ctx, "../other"); err == nil {
+		t.Fatal("expected an invalid client name to be rejected")
+	}
+}
+
+func TestUserPins(t *testing.T) {
+	ctx := context.Background()
+	s, pinning := newStore(t, Config{Enabled: true, Retention: map[string]int{"daily": 1}})
+
+	// the user pins a chunk directly, and the root of the first snapshot
+	chunk := dag.NewRawNode([]byte("a"))
+	root := new(dag.ProtoNode)
+	if err := root.AddNodeLink("a", chunk); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.dag.AddMany(ctx, []ipld.Node{chunk, root}); err != nil {
+		t.Fatal(err)
+	}
+	pinning.PinWithMode(chunk.Cid(), pin.Direct)
+	pinning.PinWithMode(root.Cid(), pin.Direct)
+
+	first := snapshot(t, s, "laptop", "a")
+	if !first.Equals(root.Cid()) {
+		t.Fatal("expected the same root")
+	}
+	if _, _, err := s.Commit(ctx, "laptop", "daily", first); err != nil {
+		t.Fatal(err)
+	}
+	if !isPinned(t, pinning, chunk.Cid(), pin.Direct) {
+		t.Fatal("expected the pin of the user to be kept when unstaging")
+	}
+
+	second := snapshot(t, s, "laptop", "b")
+	if _, removed, err := s.Commit(ctx, "laptop", "daily", second); err != nil || len(removed) != 1 {
+		t.Fatalf("expected the first snapshot to be removed, got %v, %v", removed, err)
+	}
+	if isPinned(t, pinning, first, pin.Recursive) || !isPinned(t, pinning, first, pin.Direct) {
+		t.Fatal("expected the direct pin of the user to be restored")
+	}
+
+	// a root pinned recursively by the user stays pinned
+	if err := pinning.Pin(ctx, root, true); err != nil {
+		t.Fatal(err)
+	}
+	third := snapshot(t, s, "laptop", "a")
+	if _, _, err := s.Commit(ctx, "laptop", "daily", third); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Commit(ctx, "laptop", "daily", second); err != nil {
+		t.Fatal(err)
+	}
+	if !isPinned(t, pinning, first, pin.Recursive) {
+		t.Fatal("expected the recursive pin of the user to be kept")
+	}
+}
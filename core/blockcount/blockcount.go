@@ -0,0 +1,265 @@
+// Package blockcount keeps the number and size of the blocks of a blockstore
+// up to date as they are written and removed, so that 'ipfs repo stat' needn't
+// enumerate the blockstore.
+//
+// The count is saved in the datastore when the node stops, and removed from it
+// while the node runs: a node that didn't stop cleanly counts the blocks again,
+// once, the first time the count is asked for.
+package blockcount
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("blockcount")
+
+var countKey = ds.NewKey("/local/blockcount")
+
+// stripes is the number of locks the writes of the blocks are spread over.
+const stripes = 64
+
+// Count is the number and size of the blocks of a blockstore.
+type Count struct {
+	Blocks uint64
+	Bytes  uint64
+}
+
+// Counter counts the blocks of the blockstore returned by Wrap.
+type Counter struct {
+	d ds.Datastore
+
+	// the writes hold mu for reading while they change the blockstore and
+	// the count, Snapshot for writing: it sees no write half done
+	mu     sync.RWMutex
+	blocks int64
+	bytes  int64
+	known  bool
+
+	// stripes serializes the writes of a block, so that the concurrent
+	// writes of a new block count it once
+	stripes [stripes]sync.Mutex
+
+	bs bstore.Blockstore
+}
+
+// Open returns the counter saved in d, or a counter that counts the blocks
+// again if none was.
+func Open(d ds.Datastore) (*Counter, error) {
+	c := &Counter{d: d}
+
+	data, err := d.Get(countKey)
+	switch err {
+	case nil:
+		var count Count
+		if err := json.Unmarshal(data, &count); err != nil {
+			log.Errorf("ignoring the invalid saved block count: %s", err)
+			break
+		}
+		c.blocks, c.bytes = int64(count.Blocks), int64(count.Bytes)
+		c.known = true
+	case ds.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	// the count is only valid while the node runs
+	if err := d.Delete(countKey); err != nil && err != ds.ErrNotFound {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close saves the count in the datastore, if known.
+func (c *Counter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.known {
+		return nil
+	}
+	data, err := json.Marshal(c.count())
+	if err != nil {
+		return err
+	}
+	return c.d.Put(countKey, data)
+}
+
+// Snapshot returns the count, while no write is in progress. during, if not
+// nil, is run at the same point, to measure what else has to agree with the
+// count; the writes wait for it to return.
+func (c *Counter) Snapshot(ctx context.Context, during func() error) (Count, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.known {
+		if err := c.recount(ctx); err != nil {
+			return Count{}, err
+		}
+	}
+	if during != nil {
+		if err := during(); err != nil {
+			return Count{}, err
+		}
+	}
+	return c.count(), nil
+}
+
+func (c *Counter) count() Count {
+	return Count{
+		Blocks: uint64(atomic.LoadInt64(&c.blocks)),
+		Bytes:  uint64(atomic.LoadInt64(&c.bytes)),
+	}
+}
+
+// recount enumerates the blockstore. It is called with mu held.
+func (c *Counter) recount(ctx context.Context) error {
+	if c.bs == nil {
+		return nil
+	}
+	log.Info("counting the blocks of the repo")
+
+	keys, err := c.bs.AllKeysChan(ctx)
+	if err != nil {
+		return err
+	}
+	var blocks, bytes int64
+	for k := range keys {
+		size, err := c.bs.GetSize(k)
+		switch err {
+		case nil:
+		case bstore.ErrNotFound:
+			continue
+		default:
+			return err
+		}
+		blocks++
+		bytes += int64(size)
+	}
+	if err := ctx.Err(); err != nil {
+		// the enumeration was cut short
+		return err
+	}
+
+	c.blocks, c.bytes = blocks, bytes
+	c.known = true
+	return nil
+}
+
+// lock locks the stripes of ks, in order, and returns the function unlocking
+// them.
+func (c *Counter) lock(ks ...cid.Cid) func() {
+	var held [stripes]bool
+	for _, k := range ks {
+		h := k.Hash()
+		held[int(h[len(h)-1])%stripes] = true
+	}
+	for i := range held {
+		if held[i] {
+			c.stripes[i].Lock()
+		}
+	}
+	return func() {
+		for i := range held {
+			if held[i] {
+				c.stripes[i].Unlock()
+			}
+		}
+	}
+}
+
+func (c *Counter) add(blocks, bytes int64) {
+	atomic.AddInt64(&c.blocks, blocks)
+	atomic.AddInt64(&c.bytes, bytes)
+}
+
+// Wrap returns bs, counting the blocks written to and removed from it. A
+// Counter counts the blocks of a single blockstore.
+func (c *Counter) Wrap(bs bstore.GCBlockstore) bstore.GCBlockstore {
+	c.bs = bs
+	return &blockstore{GCBlockstore: bs, c: c}
+}
+
+type blockstore struct {
+	bstore.GCBlockstore
+	c *Counter
+}
+
+func (bs *blockstore) Put(b blocks.Block) error {
+	bs.c.mu.RLock()
+	defer bs.c.mu.RUnlock()
+	defer bs.c.lock(b.Cid())()
+
+	has, err := bs.GCBlockstore.Has(b.Cid())
+	if err != nil {
+		return err
+	}
+	if err := bs.GCBlockstore.Put(b); err != nil {
+		return err
+	}
+	if !has {
+		bs.c.add(1, int64(len(b.RawData())))
+	}
+	return nil
+}
+
+func (bs *blockstore) PutMany(blks []blocks.Block) error {
+	bs.c.mu.RLock()
+	defer bs.c.mu.RUnlock()
+
+	ks := make([]cid.Cid, len(blks))
+	for i, b := range blks {
+		ks[i] = b.Cid()
+	}
+	defer bs.c.lock(ks...)()
+
+	var n, size int64
+	seen := make(map[cid.Cid]struct{}, len(blks))
+	for _, b := range blks {
+		if _, ok := seen[b.Cid()]; ok {
+			continue
+		}
+		seen[b.Cid()] = struct{}{}
+
+		has, err := bs.GCBlockstore.Has(b.Cid())
+		if err != nil {
+			return err
+		}
+		if !has {
+			n++
+			size += int64(len(b.RawData()))
+		}
+	}
+	if err := bs.GCBlockstore.PutMany(blks); err != nil {
+		return err
+	}
+	bs.c.add(n, size)
+	return nil
+}
+
+func (bs *blockstore) DeleteBlock(k cid.Cid) error {
+	bs.c.mu.RLock()
+	defer bs.c.mu.RUnlock()
+	defer bs.c.lock(k)()
+
+	size, err := bs.GCBlockstore.GetSize(k)
+	switch err {
+	case nil:
+	case bstore.ErrNotFound:
+		return bs.GCBlockstore.DeleteBlock(k)
+	default:
+		return err
+	}
+	if err := bs.GCBlockstore.DeleteBlock(k); err != nil {
+		return err
+	}
+	bs.c.add(-1, -int64(size))
+	return nil
+}
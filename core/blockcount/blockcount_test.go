@@ -0,0 +1,87 @@
+package blockcount
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+func block(i int) blocks.Block {
+	return blocks.NewBlock([]byte(fmt.Sprintf("block %03d", i)))
+}
+
+func expectCount(t *testing.T, c *Counter, blocks, bytes uint64) {
+	t.Helper()
+	count, err := c.Snapshot(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count.Blocks != blocks || count.Bytes != bytes {
+		t.Fatalf("expected %d blocks of %d bytes, got %+v", blocks, bytes, count)
+	}
+}
+
+func open(t *testing.T, d ds.Datastore) (*Counter, bstore.GCBlockstore) {
+	c, err := Open(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := bstore.NewGCBlockstore(bstore.NewBlockstore(d), bstore.NewGCLocker())
+	return c, c.Wrap(bs)
+}
+
+func TestCount(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	c, bs := open(t, d)
+
+	// the concurrent writes of a block count it once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := bs.PutMany([]blocks.Block{block(0), block(1), block(1)}); err != nil {
+				t.Error(err)
+			}
+			if err := bs.Put(block(2)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	expectCount(t, c, 3, 27)
+
+	if err := bs.DeleteBlock(block(1).Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.DeleteBlock(block(3).Cid()); err != nil && err != bstore.ErrNotFound {
+		t.Fatal(err)
+	}
+	expectCount(t, c, 2, 18)
+
+	// the count saved on close is loaded again
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c, bs = open(t, d)
+	if !c.known {
+		t.Fatal("expected the saved count to be loaded")
+	}
+	expectCount(t, c, 2, 18)
+
+	// without a clean close, the blocks are counted again
+	if err := bs.Put(block(4)); err != nil {
+		t.Fatal(err)
+	}
+	c, _ = open(t, d)
+	if c.known {
+		t.Fatal("expected the count to be removed while in use")
+	}
+	expectCount(t, c, 3, 27)
+}
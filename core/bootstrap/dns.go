@@ -0,0 +1,201 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jbenet/goprocess"
+	"github.com/jbenet/goprocess/context"
+	"github.com/jbenet/goprocess/periodic"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+)
+
+// DNSConfigKey is the config key of the DNS bootstrap section.
+const DNSConfigKey = "Swarm.DNSBootstrap"
+
+// DefaultDNSInterval is how often DNS bootstrap domains are resolved again
+// when no interval is configured.
+const DefaultDNSInterval = 10 * time.Minute
+
+// maxDNSAddrDepth bounds how many nested /dnsaddr indirections are followed.
+const maxDNSAddrDepth = 4
+
+// DNSConfig holds the Swarm.DNSBootstrap config section.
+type DNSConfig struct {
+	// Domains are resolved as dnsaddr links: their _dnsaddr TXT records must
+	// hold "dnsaddr=<multiaddr>/p2p/<peer ID>" entries. Both "example.com"
+	// and "/dnsaddr/example.com" are accepted.
+	Domains []string
+
+	// Interval is how often the domains are resolved again, e.g. "10m".
+	Interval string
+}
+
+// DNSPeers keeps the set of bootstrap peers advertised over DNS.
+type DNSPeers struct {
+	resolver *madns.Resolver
+	domains  []ma.Multiaddr
+
+	mu    sync.Mutex
+	peers []peer.AddrInfo
+
+	proc goprocess.Process
+}
+
+// NewDNSPeers returns a DNSPeers resolving the domains of cfg. If resolver is
+// nil, the default resolver is used.
+func NewDNSPeers(cfg DNSConfig, resolver *madns.Resolver) (*DNSPeers, error) {
+	if resolver == nil {
+		resolver = madns.DefaultResolver
+	}
+
+	d := &DNSPeers{resolver: resolver}
+	for _, domain := range cfg.Domains {
+		if !strings.HasPrefix(domain, "/") {
+			domain = "/dnsaddr/" + domain
+		}
+		addr, err := ma.NewMultiaddr(domain)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DNS bootstrap domain %q: %s", domain, err)
+		}
+		if !madns.Matches(addr) {
+			return nil, fmt.Errorf("DNS bootstrap domain %q is not a DNS address", domain)
+		}
+		d.domains = append(d.domains, addr)
+	}
+	return d, nil
+}
+
+// Peers returns the peers found by the last successful resolution. It is
+// safe to call on a nil DNSPeers.
+func (d *DNSPeers) Peers() []peer.AddrInfo {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.peers
+}
+
+// Refresh resolves every domain and replaces the known peers. If no domain
+// resolves, the previous peers are kept.
+func (d *DNSPeers) Refresh(ctx context.Context) error {
+	var addrs []ma.Multiaddr
+	var lastErr error
+	resolved := 0
+	for _, domain := range d.domains {
+		res, err := d.resolve(ctx, domain, maxDNSAddrDepth)
+		if err != nil {
+			log.Debugf("failed to resolve bootstrap domain %s: %s", domain, err)
+			lastErr = err
+			continue
+		}
+		resolved++
+		addrs = append(addrs, res...)
+	}
+	if resolved == 0 && lastErr != nil {
+		return lastErr
+	}
+
+	peers, err := peer.AddrInfosFromP2pAddrs(addrs...)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.peers = peers
+	d.mu.Unlock()
+
+	log.Debugf("found %d bootstrap peers over DNS", len(peers))
+	return nil
+}
+
+// resolve resolves addr, following nested /dnsaddr links up to depth times.
+// Only addresses carrying a peer ID are kept.
+func (d *DNSPeers) resolve(ctx context.Context, addr ma.Multiaddr, depth int) ([]ma.Multiaddr, error) {
+	res, err := d.resolver.Resolve(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []ma.Multiaddr
+	for _, a := range res {
+		if _, err := a.ValueForProtocol(madns.DnsaddrProtocol.Code); err == nil {
+			if depth <= 0 {
+				continue
+			}
+			nested, err := d.resolve(ctx, a, depth-1)
+			if err != nil {
+				log.Debugf("failed to resolve %s: %s", a, err)
+				continue
+			}
+			out = append(out, nested...)
+			continue
+		}
+		if _, err := a.ValueForProtocol(ma.P_P2P); err != nil {
+			continue
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// Start resolves the domains once, then again every interval in the
+// background until Close is called.
+func (d *DNSPeers) Start(ctx context.Context, interval time.Duration) {
+	if err := d.Refresh(ctx); err != nil {
+		log.Warningf("DNS bootstrap: %s", err)
+	}
+
+	d.proc = periodicproc.Tick(interval, func(worker goprocess.Process) {
+		if err := d.Refresh(goprocessctx.OnClosingContext(worker)); err != nil {
+			log.Debugf("DNS bootstrap: %s", err)
+		}
+	})
+}
+
+// Close stops the background resolution.
+func (d *DNSPeers) Close() error {
+	if d == nil || d.proc == nil {
+		return nil
+	}
+	return d.proc.Close()
+}
+
+// MergePeers merges several sets of peers, combining the addresses of peers
+// that appear more than once.
+func MergePeers(sets ...[]peer.AddrInfo) []peer.AddrInfo {
+	var out []peer.AddrInfo
+	index := make(map[peer.ID]int)
+	for _, set := range sets {
+		for _, p := range set {
+			i, ok := index[p.ID]
+			if !ok {
+				index[p.ID] = len(out)
+				out = append(out, peer.AddrInfo{ID: p.ID, Addrs: append([]ma.Multiaddr(nil), p.Addrs...)})
+				continue
+			}
+			for _, a := range p.Addrs {
+				if !containsAddr(out[i].Addrs, a) {
+					out[i].Addrs = append(out[i].Addrs, a)
+				}
+			}
+		}
+	}
+	return out
+}
+
+func containsAddr(addrs []ma.Multiaddr, addr ma.Multiaddr) bool {
+	for _, a := range addrs {
+		if a.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package bootstrap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+	ma "github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+)
+
+func TestDNSPeers(t *testing.T) {
+	p1, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := &madns.Resolver{
+		Backend: &madns.MockBackend{
+			TXT: map[string][]string{
+				"_dnsaddr.example.com": {
+					"dnsaddr=/ip4/1.2.3.4/tcp/4001/p2p/" + p1.Pretty(),
+					"dnsaddr=/dnsaddr/nested.example.com",
+					"dnsaddr=/ip4/1.2.3.5/tcp/4001",
+				},
+				"_dnsaddr.nested.example.com": {
+					"dnsaddr=/ip4/1.2.3.6/tcp/4001/p2p/" + p2.Pretty(),
+				},
+			},
+		},
+	}
+
+	d, err := NewDNSPeers(DNSConfig{Domains: []string{"example.com"}}, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	found := make(map[peer.ID]bool)
+	for _, p := range d.Peers() {
+		found[p.ID] = true
+	}
+	if len(found) != 2 || !found[p1] || !found[p2] {
+		t.Fatalf("expected peers %s and %s, got %v", p1, p2, d.Peers())
+	}
+}
+
+func TestDNSPeersInvalidDomain(t *testing.T) {
+	if _, err := NewDNSPeers(DNSConfig{Domains: []string{"/ip4/1.2.3.4"}}, nil); err == nil {
+		t.Fatal("expected an error for a non-DNS address")
+	}
+}
+
+func TestMergePeers(t *testing.T) {
+	pid, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a1 := ma.StringCast("/ip4/1.2.3.4/tcp/4001")
+	a2 := ma.StringCast("/ip4/1.2.3.5/tcp/4001")
+
+	out := MergePeers(
+		[]peer.AddrInfo{{ID: pid, Addrs: []ma.Multiaddr{a1}}},
+		[]peer.AddrInfo{{ID: pid, Addrs: []ma.Multiaddr{a1, a2}}},
+	)
+	if len(out) != 1 || len(out[0].Addrs) != 2 {
+		t.Fatalf("expected one peer with two addresses, got %v", out)
+	}
+}
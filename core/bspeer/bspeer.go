@@ -0,0 +1,260 @@
+// Package bspeer holds the per-peer bitswap controls of the node.
+//
+// A limit caps the rate at which blocks are sent to a peer. The network
+// returned by Wrap waits before handing a message to a limited peer until its
+// rate allows it. Wrapped by the outgoing queues of bsqueue, the wait only
+// holds the queue of that peer, and bitswap keeps serving the others. Limits
+// are saved in the datastore.
+//
+// The ledgers of the bitswap engine can't be cleared, so resetting the ledger
+// of a peer records its current value as a baseline, subtracted from the
+// ledger shown afterwards.
+package bspeer
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	decision "github.com/ipfs/go-bitswap/decision"
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	ds "github.com/ipfs/go-datastore"
+	dsquery "github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+var log = logging.Logger("bspeer")
+
+var limitsPrefix = ds.NewKey("/bitswap/limits")
+
+// bucket is the token bucket of a limited peer, allowing rate bytes per
+// second with a burst of one second.
+type bucket struct {
+	rate   uint64
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes n bytes from the bucket, and returns how long to wait before
+// sending them.
+func (b *bucket) reserve(now time.Time, n int) time.Duration {
+	rate := float64(b.rate)
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > rate {
+		b.tokens = rate
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// Controls holds the send limits and ledger baselines of the peers.
+type Controls struct {
+	ds ds.Datastore
+
+	mu      sync.Mutex
+	limits  map[peer.ID]*bucket
+	ledgers map[peer.ID]decision.Receipt
+}
+
+// New creates Controls with the limits saved in d.
+func New(d ds.Datastore) (*Controls, error) {
+	c := &Controls{
+		ds:      d,
+		limits:  make(map[peer.ID]*bucket),
+		ledgers: make(map[peer.ID]decision.Receipt),
+	}
+
+	res, err := d.Query(dsquery.Query{Prefix: limitsPrefix.String() + "/"})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		p, err := peer.Decode(ds.RawKey(e.Key).BaseNamespace())
+		if err != nil {
+			log.Warningf("invalid bitswap limit %s: %s", e.Key, err)
+			continue
+		}
+		rate, err := strconv.ParseUint(string(e.Value), 10, 64)
+		if err != nil {
+			log.Warningf("invalid bitswap limit %s: %s", e.Key, err)
+			continue
+		}
+		c.limits[p] = &bucket{rate: rate, tokens: float64(rate), last: time.Now()}
+	}
+	return c, nil
+}
+
+// SetLimit limits the blocks sent to p to rate bytes per second, or removes
+// the limit of p if rate is 0.
+func (c *Controls) SetLimit(p peer.ID, rate uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if rate == 0 {
+		delete(c.limits, p)
+		return c.ds.Delete(limitKey(p))
+	}
+
+	if err := c.ds.Put(limitKey(p), []byte(strconv.FormatUint(rate, 10))); err != nil {
+		return err
+	}
+	if b, ok := c.limits[p]; ok {
+		b.rate = rate
+	} else {
+		c.limits[p] = &bucket{rate: rate, tokens: float64(rate), last: time.Now()}
+	}
+	return nil
+}
+
+// Limits returns the rates of the limited peers, in bytes per second.
+func (c *Controls) Limits() map[peer.ID]uint64 {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[peer.ID]uint64, len(c.limits))
+	for p, b := range c.limits {
+		out[p] = b.rate
+	}
+	return out
+}
+
+// wait blocks until n bytes can be sent to p.
+func (c *Controls) wait(ctx context.Context, p peer.ID, n int) error {
+	c.mu.Lock()
+	var d time.Duration
+	if b, ok := c.limits[p]; ok {
+		d = b.reserve(time.Now(), n)
+	}
+	c.mu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ResetLedger records r, the current ledger of its peer, as the baseline of
+// the ledgers returned by Ledger.
+func (c *Controls) ResetLedger(r *decision.Receipt) error {
+	p, err := peer.Decode(r.Peer)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ledgers[p] = *r
+	return nil
+}
+
+// Ledger returns r, the ledger of its peer in the bitswap engine, minus the
+// baseline recorded when it was last reset.
+func (c *Controls) Ledger(r *decision.Receipt) *decision.Receipt {
+	if c == nil {
+		return r
+	}
+	p, err := peer.Decode(r.Peer)
+	if err != nil {
+		return r
+	}
+
+	c.mu.Lock()
+	base, ok := c.ledgers[p]
+	c.mu.Unlock()
+	if !ok {
+		return r
+	}
+
+	out := *r
+	out.Sent = sub(r.Sent, base.Sent)
+	out.Recv = sub(r.Recv, base.Recv)
+	out.Exchanged = sub(r.Exchanged, base.Exchanged)
+	// the debt ratio of the engine ledgers
+	out.Value = float64(out.Sent) / float64(out.Recv+1)
+	return &out
+}
+
+func sub(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
+
+func limitKey(p peer.ID) ds.Key {
+	return limitsPrefix.ChildString(p.Pretty())
+}
+
+// Wrap returns a network waiting for the limit of the peers before sending
+// them messages. It is safe to call on nil Controls, in which case net is
+// returned as is.
+func (c *Controls) Wrap(net bsnet.BitSwapNetwork) bsnet.BitSwapNetwork {
+	if c == nil {
+		return net
+	}
+	return &network{BitSwapNetwork: net, c: c}
+}
+
+type network struct {
+	bsnet.BitSwapNetwork
+	c *Controls
+}
+
+func (n *network) SendMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) error {
+	if err := n.c.wait(ctx, p, blocksSize(msg)); err != nil {
+		return err
+	}
+	return n.BitSwapNetwork.SendMessage(ctx, p, msg)
+}
+
+func (n *network) NewMessageSender(ctx context.Context, p peer.ID) (bsnet.MessageSender, error) {
+	ms, err := n.BitSwapNetwork.NewMessageSender(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return &sender{MessageSender: ms, c: n.c, p: p}, nil
+}
+
+type sender struct {
+	bsnet.MessageSender
+	c *Controls
+	p peer.ID
+}
+
+func (s *sender) SendMsg(ctx context.Context, msg bsmsg.BitSwapMessage) error {
+	if err := s.c.wait(ctx, s.p, blocksSize(msg)); err != nil {
+		return err
+	}
+	return s.MessageSender.SendMsg(ctx, msg)
+}
+
+// blocksSize is the size of the blocks of msg, the bytes the limits apply to.
+func blocksSize(msg bsmsg.BitSwapMessage) int {
+	n := 0
+	for _, b := range msg.Blocks() {
+		n += len(b.RawData())
+	}
+	return n
+}
@@ -0,0 +1,99 @@
+package bspeer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	decision "github.com/ipfs/go-bitswap/decision"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+const testPeer = "QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+
+func TestLimits(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	c, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := peer.Decode(testPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SetLimit(p, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	// the limits are reloaded from the datastore
+	c, err = New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate := c.Limits()[p]; rate != 1000 {
+		t.Fatalf("expected a rate of 1000, got %d", rate)
+	}
+
+	// the burst of one second is sent right away, the rest is held
+	ctx := context.Background()
+	start := time.Now()
+	if err := c.wait(ctx, p, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 50*time.Millisecond {
+		t.Fatal("expected the burst not to wait")
+	}
+	start = time.Now()
+	if err := c.wait(ctx, p, 100); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 80*time.Millisecond {
+		t.Fatal("expected to wait for the rate")
+	}
+
+	// peers without a limit don't wait
+	var other peer.ID = "other"
+	start = time.Now()
+	if err := c.wait(ctx, other, 1<<20); err != nil || time.Since(start) > 50*time.Millisecond {
+		t.Fatal("expected peers without a limit not to wait")
+	}
+
+	if err := c.SetLimit(p, 0); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = New(d); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Limits()) != 0 {
+		t.Fatal("expected the limit to be removed")
+	}
+}
+
+func TestLedger(t *testing.T) {
+	c, err := New(dssync.MutexWrap(ds.NewMapDatastore()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &decision.Receipt{Peer: testPeer, Value: 5, Sent: 500, Recv: 99, Exchanged: 10}
+	if c.Ledger(r) != r {
+		t.Fatal("expected the ledger of a peer never reset to be unchanged")
+	}
+	if err := c.ResetLedger(r); err != nil {
+		t.Fatal(err)
+	}
+
+	later := &decision.Receipt{Peer: testPeer, Sent: 700, Recv: 99, Exchanged: 12}
+	got := c.Ledger(later)
+	if got.Sent != 200 || got.Recv != 0 || got.Exchanged != 2 || got.Value != 200 {
+		t.Fatalf("unexpected ledger after the reset: %+v", got)
+	}
+
+	var nc *Controls
+	if nc.Ledger(later) != later || nc.Limits() != nil {
+		t.Fatal("expected nil controls to do nothing")
+	}
+}
@@ -0,0 +1,364 @@
+// Package bsqueue bounds the memory used by outgoing bitswap messages.
+//
+// Bitswap hands its outgoing messages to the network synchronously, and keeps
+// accumulating new ones while a slow peer is being served. The network
+// returned by Wrap queues outgoing messages per peer instead, in queues
+// bounded both in number of messages and in bytes. When a queue is full,
+// either the oldest queued messages or the new message are dropped, depending
+// on the configured policy. The size of the queues and the number of dropped
+// messages are exported as metrics.
+package bsqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	logging "github.com/ipfs/go-log"
+	metrics "github.com/ipfs/go-metrics-interface"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+var log = logging.Logger("bsqueue")
+
+// ConfigKey is the config key of the outgoing queue section.
+const ConfigKey = "Bitswap.OutgoingQueue"
+
+// Drop policies, applied when a queue is full.
+const (
+	// DropOldest drops the oldest queued messages to make room for the new
+	// one.
+	DropOldest = "oldest"
+
+	// DropNewest rejects the new message.
+	DropNewest = "newest"
+)
+
+// By default, a peer's queue holds up to 64 messages and 16MiB, and drops its
+// oldest message when full.
+const (
+	DefaultMaxMessages = 64
+	DefaultMaxBytes    = 16 << 20
+	DefaultDropPolicy  = DropOldest
+)
+
+// wantlistEntrySize is the estimated size of a wantlist entry in a message.
+const wantlistEntrySize = 64
+
+// ErrQueueFull is returned when a message is dropped with the DropNewest
+// policy.
+var ErrQueueFull = errors.New("outgoing bitswap queue full, message dropped")
+
+var errQueueClosed = errors.New("outgoing bitswap queue closed")
+
+// Config holds the Bitswap.OutgoingQueue config section.
+type Config struct {
+	// MaxMessages is the maximum number of messages queued per peer.
+	MaxMessages int
+
+	// MaxBytes is the maximum size of the messages queued per peer.
+	MaxBytes int
+
+	// DropPolicy is either "oldest" or "newest".
+	DropPolicy string
+}
+
+// LoadConfig reads the Bitswap.OutgoingQueue section of the config of r, with
+// defaults for the missing settings.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	if err := repo.LoadConfigKey(r, ConfigKey, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxMessages <= 0 {
+		cfg.MaxMessages = DefaultMaxMessages
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultMaxBytes
+	}
+	switch cfg.DropPolicy {
+	case "":
+		cfg.DropPolicy = DefaultDropPolicy
+	case DropOldest, DropNewest:
+	default:
+		return cfg, fmt.Errorf("invalid %s.DropPolicy %q: must be %q or %q", ConfigKey, cfg.DropPolicy, DropOldest, DropNewest)
+	}
+	return cfg, nil
+}
+
+type queueMetrics struct {
+	messages     metrics.Gauge
+	bytes        metrics.Gauge
+	dropped      metrics.Counter
+	droppedBytes metrics.Counter
+}
+
+func newQueueMetrics(ctx context.Context) *queueMetrics {
+	return &queueMetrics{
+		messages:     metrics.NewCtx(ctx, "bitswap_outgoing_queue_messages", "Number of outgoing bitswap messages queued").Gauge(),
+		bytes:        metrics.NewCtx(ctx, "bitswap_outgoing_queue_bytes", "Size of the outgoing bitswap messages queued").Gauge(),
+		dropped:      metrics.NewCtx(ctx, "bitswap_outgoing_dropped_total", "Number of outgoing bitswap messages dropped").Counter(),
+		droppedBytes: metrics.NewCtx(ctx, "bitswap_outgoing_dropped_bytes_total", "Size of the outgoing bitswap messages dropped").Counter(),
+	}
+}
+
+// Wrap returns a network queuing the outgoing messages of net in bounded
+// queues. The queues are stopped when ctx is done.
+func Wrap(ctx context.Context, net bsnet.BitSwapNetwork, cfg Config) bsnet.BitSwapNetwork {
+	return &network{
+		BitSwapNetwork: net,
+		ctx:            ctx,
+		cfg:            cfg,
+		metrics:        newQueueMetrics(ctx),
+		queues:         make(map[peer.ID]*queue),
+	}
+}
+
+type network struct {
+	bsnet.BitSwapNetwork
+
+	ctx     context.Context
+	cfg     Config
+	metrics *queueMetrics
+
+	mu     sync.Mutex
+	queues map[peer.ID]*queue
+}
+
+// SendMessage queues msg and returns immediately. Its queue is removed once
+// empty.
+func (n *network) SendMessage(_ context.Context, p peer.ID, msg bsmsg.BitSwapMessage) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	q, ok := n.queues[p]
+	if !ok {
+		q = newQueue(n.cfg, n.metrics, func(msg bsmsg.BitSwapMessage) error {
+			return n.BitSwapNetwork.SendMessage(n.ctx, p, msg)
+		})
+		q.idle = func() bool {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			return q.closeIfEmpty(func() { delete(n.queues, p) })
+		}
+		n.queues[p] = q
+		go q.run(n.ctx)
+	}
+	return q.push(msg)
+}
+
+// NewMessageSender returns a sender queuing its messages. Errors are reported
+// by the next call to SendMsg, so that bitswap resets the sender.
+func (n *network) NewMessageSender(ctx context.Context, p peer.ID) (bsnet.MessageSender, error) {
+	ms, err := n.BitSwapNetwork.NewMessageSender(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sender{MessageSender: ms}
+	s.q = newQueue(n.cfg, n.metrics, func(msg bsmsg.BitSwapMessage) error {
+		return ms.SendMsg(n.ctx, msg)
+	})
+	go s.q.run(n.ctx)
+	return s, nil
+}
+
+type sender struct {
+	bsnet.MessageSender
+	q *queue
+}
+
+func (s *sender) SendMsg(_ context.Context, msg bsmsg.BitSwapMessage) error {
+	return s.q.push(msg)
+}
+
+func (s *sender) Close() error {
+	s.q.close()
+	return s.MessageSender.Close()
+}
+
+func (s *sender) Reset() error {
+	s.q.close()
+	return s.MessageSender.Reset()
+}
+
+type queued struct {
+	msg  bsmsg.BitSwapMessage
+	size int
+}
+
+// queue is a bounded queue of messages, sent in order by run.
+type queue struct {
+	cfg     Config
+	metrics *queueMetrics
+	send    func(bsmsg.BitSwapMessage) error
+
+	// idle, if set, is called when the queue is empty and returns true if
+	// run must return.
+	idle func() bool
+
+	wake chan struct{}
+	done chan struct{}
+
+	mu     sync.Mutex
+	msgs   []queued
+	bytes  int
+	err    error
+	closed bool
+}
+
+func newQueue(cfg Config, m *queueMetrics, send func(bsmsg.BitSwapMessage) error) *queue {
+	return &queue{
+		cfg:     cfg,
+		metrics: m,
+		send:    send,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// push queues msg, dropping messages if the queue is full. It returns the
+// error of the last failed send, if any.
+func (q *queue) push(msg bsmsg.BitSwapMessage) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return errQueueClosed
+	}
+	if err := q.err; err != nil {
+		q.err = nil
+		return err
+	}
+
+	m := queued{msg: msg, size: messageSize(msg)}
+	for len(q.msgs) > 0 && (len(q.msgs) >= q.cfg.MaxMessages || q.bytes+m.size > q.cfg.MaxBytes) {
+		if q.cfg.DropPolicy == DropNewest {
+			q.drop(m)
+			return ErrQueueFull
+		}
+		q.drop(q.msgs[0])
+		q.remove()
+	}
+
+	q.msgs = append(q.msgs, m)
+	q.bytes += m.size
+	q.metrics.messages.Inc()
+	q.metrics.bytes.Add(float64(m.size))
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pop returns the oldest queued message.
+func (q *queue) pop() (queued, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.msgs) == 0 {
+		return queued{}, false
+	}
+	m := q.msgs[0]
+	q.remove()
+	return m, true
+}
+
+// remove removes the oldest queued message. q.mu must be held.
+func (q *queue) remove() {
+	m := q.msgs[0]
+	q.msgs[0] = queued{}
+	q.msgs = q.msgs[1:]
+	q.bytes -= m.size
+	q.metrics.messages.Dec()
+	q.metrics.bytes.Sub(float64(m.size))
+}
+
+func (q *queue) drop(m queued) {
+	q.metrics.dropped.Inc()
+	q.metrics.droppedBytes.Add(float64(m.size))
+}
+
+// fail records err and drops the queued messages, which would most likely
+// fail too.
+func (q *queue) fail(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.err = err
+	for len(q.msgs) > 0 {
+		q.drop(q.msgs[0])
+		q.remove()
+	}
+}
+
+// closeIfEmpty closes the queue and calls f if no message is queued.
+func (q *queue) closeIfEmpty(f func()) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.msgs) > 0 {
+		return false
+	}
+	q.closed = true
+	f()
+	return true
+}
+
+func (q *queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.done)
+	for len(q.msgs) > 0 {
+		q.remove()
+	}
+}
+
+func (q *queue) run(ctx context.Context) {
+	for {
+		for {
+			m, ok := q.pop()
+			if !ok {
+				break
+			}
+			if err := q.send(m.msg); err != nil {
+				log.Debugf("failed to send bitswap message: %s", err)
+				q.fail(err)
+			}
+		}
+
+		if q.idle != nil && q.idle() {
+			return
+		}
+
+		select {
+		case <-q.wake:
+		case <-q.done:
+			return
+		case <-ctx.Done():
+			q.close()
+			return
+		}
+	}
+}
+
+// messageSize estimates the size of msg.
+func messageSize(msg bsmsg.BitSwapMessage) int {
+	size := len(msg.Wantlist()) * wantlistEntrySize
+	for _, b := range msg.Blocks() {
+		size += len(b.RawData())
+	}
+	return size
+}
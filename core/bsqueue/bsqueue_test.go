@@ -0,0 +1,94 @@
+package bsqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	blocks "github.com/ipfs/go-block-format"
+)
+
+func message(data string) bsmsg.BitSwapMessage {
+	msg := bsmsg.New(false)
+	msg.AddBlock(blocks.NewBlock([]byte(data)))
+	return msg
+}
+
+func TestDropPolicies(t *testing.T) {
+	m := newQueueMetrics(context.Background())
+	cfg := Config{MaxMessages: 2, MaxBytes: 1 << 20}
+
+	for _, policy := range []string{DropOldest, DropNewest} {
+		cfg.DropPolicy = policy
+		q := newQueue(cfg, m, nil)
+
+		for _, data := range []string{"a", "b"} {
+			if err := q.push(message(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := q.push(message("c"))
+		if policy == DropNewest && err != ErrQueueFull {
+			t.Fatalf("expected the new message to be dropped, got %v", err)
+		}
+		if policy == DropOldest && err != nil {
+			t.Fatal(err)
+		}
+
+		first, _ := q.pop()
+		expected := "a"
+		if policy == DropOldest {
+			expected = "b"
+		}
+		if data := string(first.msg.Blocks()[0].RawData()); data != expected {
+			t.Errorf("%s: expected %q first, got %q", policy, expected, data)
+		}
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	q := newQueue(Config{MaxMessages: 10, MaxBytes: 4, DropPolicy: DropOldest}, newQueueMetrics(context.Background()), nil)
+
+	// A message bigger than the queue is still accepted when it is empty.
+	if err := q.push(message("abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.push(message("ab")); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.msgs) != 1 || q.bytes != 2 {
+		t.Fatalf("expected the big message to be dropped, queue holds %d messages, %d bytes", len(q.msgs), q.bytes)
+	}
+}
+
+func TestSendErrorIsReported(t *testing.T) {
+	errSend := errors.New("send failed")
+	sent := make(chan struct{}, 1)
+	q := newQueue(Config{MaxMessages: 10, MaxBytes: 1 << 20, DropPolicy: DropOldest}, newQueueMetrics(context.Background()), func(bsmsg.BitSwapMessage) error {
+		select {
+		case sent <- struct{}{}:
+		default:
+		}
+		return errSend
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.run(ctx)
+
+	if err := q.push(message("a")); err != nil {
+		t.Fatal(err)
+	}
+	<-sent
+
+	// The error is recorded right after send returns.
+	for i := 0; i < 100; i++ {
+		if err := q.push(message("b")); err == errSend {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expected the send error to be reported")
+}
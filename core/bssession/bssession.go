@@ -0,0 +1,286 @@
+// Package bssession keeps the statistics of the bitswap sessions of the node.
+//
+// A session fetches the blocks of a single request, such as the DAG walked by
+// 'ipfs get', from the peers which had its first blocks. The sessions of the
+// bitswap engine don't expose their state, so the Tracker follows them from
+// the outside: the exchange returned by Exchange records the blocks each
+// session waits for, and the network returned by Wrap attributes the blocks
+// received to the sessions waiting for them, and to the peers which sent
+// them. A block received again after the session got it is counted as a
+// duplicate.
+package bssession
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// recentSize is the number of the blocks last received by a session kept to
+// count the duplicates.
+const recentSize = 1024
+
+// Stat is the statistics of a session.
+type Stat struct {
+	ID       uint64
+	Started  time.Time
+	Wantlist []cid.Cid
+
+	// Peers is the number of blocks received from each peer.
+	Peers map[string]int
+
+	BlocksReceived int
+	DupBlocks      int
+}
+
+// Tracker tracks the bitswap sessions.
+type Tracker struct {
+	mu       sync.Mutex
+	nextID   uint64
+	sessions map[uint64]*session
+}
+
+// New creates a Tracker.
+func New() *Tracker {
+	return &Tracker{sessions: make(map[uint64]*session)}
+}
+
+type session struct {
+	id      uint64
+	started time.Time
+
+	// wants counts the requests waiting for each block.
+	wants    map[cid.Cid]int
+	received int
+	dups     int
+	peers    map[peer.ID]int
+
+	// recent are the blocks last received, in a ring.
+	recent    map[cid.Cid]struct{}
+	recentLog []cid.Cid
+	next      int
+}
+
+func (s *session) markReceived(c cid.Cid) {
+	if len(s.recentLog) < recentSize {
+		s.recentLog = append(s.recentLog, c)
+	} else {
+		delete(s.recent, s.recentLog[s.next])
+		s.recentLog[s.next] = c
+		s.next = (s.next + 1) % recentSize
+	}
+	s.recent[c] = struct{}{}
+}
+
+// Sessions returns the statistics of the active sessions, oldest first.
+func (t *Tracker) Sessions() []Stat {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Stat, 0, len(t.sessions))
+	for _, s := range t.sessions {
+		st := Stat{
+			ID:             s.id,
+			Started:        s.started,
+			Wantlist:       make([]cid.Cid, 0, len(s.wants)),
+			Peers:          make(map[string]int, len(s.peers)),
+			BlocksReceived: s.received,
+			DupBlocks:      s.dups,
+		}
+		for c := range s.wants {
+			st.Wantlist = append(st.Wantlist, c)
+		}
+		sort.Slice(st.Wantlist, func(i, j int) bool {
+			return st.Wantlist[i].String() < st.Wantlist[j].String()
+		})
+		for p, n := range s.peers {
+			st.Peers[p.Pretty()] = n
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (t *Tracker) start(ctx context.Context) *session {
+	t.mu.Lock()
+	t.nextID++
+	s := &session{
+		id:      t.nextID,
+		started: time.Now(),
+		wants:   make(map[cid.Cid]int),
+		peers:   make(map[peer.ID]int),
+		recent:  make(map[cid.Cid]struct{}),
+	}
+	t.sessions[s.id] = s
+	t.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		t.mu.Lock()
+		delete(t.sessions, s.id)
+		t.mu.Unlock()
+	}()
+	return s
+}
+
+func (t *Tracker) want(s *session, keys []cid.Cid) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range keys {
+		s.wants[c]++
+	}
+}
+
+func (t *Tracker) unwant(s *session, keys []cid.Cid) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range keys {
+		if s.wants[c] <= 1 {
+			delete(s.wants, c)
+		} else {
+			s.wants[c]--
+		}
+	}
+}
+
+// received attributes the blocks received from p to the sessions.
+func (t *Tracker) received(p peer.ID, msg bsmsg.BitSwapMessage) {
+	blks := msg.Blocks()
+	if len(blks) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.sessions {
+		for _, b := range blks {
+			c := b.Cid()
+			if _, ok := s.recent[c]; ok {
+				s.dups++
+				continue
+			}
+			if s.wants[c] == 0 {
+				continue
+			}
+			s.received++
+			s.peers[p]++
+			s.markReceived(c)
+		}
+	}
+}
+
+// Exchange returns ex, recording the blocks its sessions wait for. It is safe
+// to call on a nil Tracker, or with an exchange without sessions, in which
+// case ex is returned as is.
+func (t *Tracker) Exchange(ex exchange.Interface) exchange.Interface {
+	sex, ok := ex.(exchange.SessionExchange)
+	if t == nil || !ok {
+		return ex
+	}
+	return &sessionExchange{SessionExchange: sex, t: t}
+}
+
+type sessionExchange struct {
+	exchange.SessionExchange
+	t *Tracker
+}
+
+func (e *sessionExchange) NewSession(ctx context.Context) exchange.Fetcher {
+	return &fetcher{
+		Fetcher: e.SessionExchange.NewSession(ctx),
+		t:       e.t,
+		s:       e.t.start(ctx),
+	}
+}
+
+type fetcher struct {
+	exchange.Fetcher
+	t *Tracker
+	s *session
+}
+
+func (f *fetcher) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	keys := []cid.Cid{c}
+	f.t.want(f.s, keys)
+	defer f.t.unwant(f.s, keys)
+	return f.Fetcher.GetBlock(ctx, c)
+}
+
+func (f *fetcher) GetBlocks(ctx context.Context, keys []cid.Cid) (<-chan blocks.Block, error) {
+	f.t.want(f.s, keys)
+	in, err := f.Fetcher.GetBlocks(ctx, keys)
+	if err != nil {
+		f.t.unwant(f.s, keys)
+		return nil, err
+	}
+
+	out := make(chan blocks.Block)
+	go func() {
+		defer close(out)
+		pending := make(map[cid.Cid]bool, len(keys))
+		for _, c := range keys {
+			pending[c] = true
+		}
+		defer func() {
+			left := make([]cid.Cid, 0, len(pending))
+			for c := range pending {
+				left = append(left, c)
+			}
+			f.t.unwant(f.s, left)
+		}()
+
+		for b := range in {
+			if pending[b.Cid()] {
+				delete(pending, b.Cid())
+				f.t.unwant(f.s, []cid.Cid{b.Cid()})
+			}
+			select {
+			case out <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Wrap returns a network attributing the blocks received by net to the
+// sessions. It is safe to call on a nil Tracker, in which case net is
+// returned as is.
+func (t *Tracker) Wrap(net bsnet.BitSwapNetwork) bsnet.BitSwapNetwork {
+	if t == nil {
+		return net
+	}
+	return &network{BitSwapNetwork: net, t: t}
+}
+
+type network struct {
+	bsnet.BitSwapNetwork
+	t *Tracker
+}
+
+func (n *network) SetDelegate(r bsnet.Receiver) {
+	n.BitSwapNetwork.SetDelegate(&receiver{Receiver: r, t: n.t})
+}
+
+type receiver struct {
+	bsnet.Receiver
+	t *Tracker
+}
+
+func (r *receiver) ReceiveMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) {
+	r.t.received(p, msg)
+	r.Receiver.ReceiveMessage(ctx, p, msg)
+}
@@ -0,0 +1,82 @@
+package bssession
+
+import (
+	"context"
+	"testing"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// testExchange hands the blocks received by the test.
+type testExchange struct {
+	exchange.Interface
+	blocks chan blocks.Block
+}
+
+func (e *testExchange) NewSession(context.Context) exchange.Fetcher {
+	return e
+}
+
+func (e *testExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	select {
+	case b := <-e.blocks:
+		return b, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestSessions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tr := New()
+	ex := &testExchange{blocks: make(chan blocks.Block)}
+	f := tr.Exchange(ex).(exchange.SessionExchange).NewSession(ctx)
+
+	b := blocks.NewBlock([]byte("hello"))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := f.GetBlock(ctx, b.Cid()); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// wait for the session to want the block
+	for {
+		st := tr.Sessions()
+		if len(st) == 1 && len(st[0].Wantlist) == 1 {
+			break
+		}
+	}
+
+	msg := bsmsg.New(false)
+	msg.AddBlock(b)
+	var p1, p2 peer.ID = "peer1", "peer2"
+	tr.received(p1, msg)
+	tr.received(p2, msg)
+	ex.blocks <- b
+	<-done
+
+	st := tr.Sessions()
+	if len(st) != 1 {
+		t.Fatalf("expected a session, got %d", len(st))
+	}
+	s := st[0]
+	if s.BlocksReceived != 1 || s.DupBlocks != 1 || len(s.Wantlist) != 0 {
+		t.Fatalf("unexpected session statistics: %+v", s)
+	}
+	if s.Peers[p1.Pretty()] != 1 || len(s.Peers) != 1 {
+		t.Fatalf("expected the block to be received from %s, got %v", p1.Pretty(), s.Peers)
+	}
+
+	var nt *Tracker
+	if nt.Exchange(ex) != ex || nt.Sessions() != nil {
+		t.Fatal("expected a nil tracker to do nothing")
+	}
+}
@@ -0,0 +1,172 @@
+// Package car reads and writes CARv1 files, the content archive format used
+// to move DAGs between nodes without a network connection.
+//
+// A CAR file is a header, listing the roots of the archive, followed by its
+// blocks. The header and every block are prefixed with their length as an
+// unsigned varint; the header is a dag-cbor map, and a block is its CID
+// followed by its data.
+package car
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Version is the version of the CAR files written.
+const Version = 1
+
+// maxSectionSize bounds the size of a header or block read.
+const maxSectionSize = 32 << 20
+
+// Header is the header of a CAR file.
+type Header struct {
+	Roots   []cid.Cid `refmt:"roots"`
+	Version uint64    `refmt:"version"`
+}
+
+func init() {
+	cbor.RegisterCborType(Header{})
+}
+
+func writeSection(w io.Writer, parts ...[]byte) error {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	if _, err := w.Write(buf[:binary.PutUvarint(buf, uint64(n))]); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes the DAGs of roots to w as a CAR file, fetching their nodes
+// from ng. Every block is written once, in depth-first order.
+func Write(ctx context.Context, ng ipld.NodeGetter, roots []cid.Cid, w io.Writer) error {
+	return WriteSkipping(ctx, ng, roots, cid.NewSet(), w)
+}
+
+// WriteSkipping writes the DAGs of roots to w like Write, leaving out the
+// DAGs of the CIDs in skip, which the reader of the CAR file already holds.
+func WriteSkipping(ctx context.Context, ng ipld.NodeGetter, roots []cid.Cid, skip *cid.Set, w io.Writer) error {
+	hdr, err := cbor.DumpObject(&Header{Roots: roots, Version: Version})
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	if err := writeSection(bw, hdr); err != nil {
+		return err
+	}
+
+	seen := cid.NewSet()
+	var walk func(c cid.Cid) error
+	walk = func(c cid.Cid) error {
+		if skip.Has(c) || !seen.Visit(c) {
+			return nil
+		}
+		nd, err := ng.Get(ctx, c)
+		if err != nil {
+			return err
+		}
+		if err := writeSection(bw, c.Bytes(), nd.RawData()); err != nil {
+			return err
+		}
+		for _, l := range nd.Links() {
+			if err := walk(l.Cid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, root := range roots {
+		if err := walk(root); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Reader reads the blocks of a CAR file.
+type Reader struct {
+	r      *bufio.Reader
+	Header Header
+}
+
+// NewReader reads the header of the CAR file in r.
+func NewReader(r io.Reader) (*Reader, error) {
+	cr := &Reader{r: bufio.NewReader(r)}
+	hdr, err := cr.section()
+	if err == io.EOF {
+		return nil, errors.New("empty CAR file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := cbor.DecodeInto(hdr, &cr.Header); err != nil {
+		return nil, fmt.Errorf("invalid CAR header: %s", err)
+	}
+	if cr.Header.Version != Version {
+		return nil, fmt.Errorf("unsupported CAR version %d", cr.Header.Version)
+	}
+	return cr, nil
+}
+
+// section reads a length-prefixed section, or returns io.EOF at the end of
+// the file.
+func (cr *Reader) section() ([]byte, error) {
+	n, err := binary.ReadUvarint(cr.r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	if n == 0 || n > maxSectionSize {
+		return nil, fmt.Errorf("invalid CAR section size %d", n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(cr.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Next returns the next block, or io.EOF after the last one. The data of the
+// blocks is checked against their CID.
+func (cr *Reader) Next() (blocks.Block, error) {
+	buf, err := cr.section()
+	if err != nil {
+		return nil, err
+	}
+	n, c, err := cid.CidFromBytes(buf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CID in CAR file: %s", err)
+	}
+	data := buf[n:]
+
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return nil, err
+	}
+	if !sum.Equals(c) {
+		return nil, fmt.Errorf("the data of block %s doesn't match its CID", c)
+	}
+	return blocks.NewBlockWithCid(data, c)
+}
@@ -0,0 +1,73 @@
+package car
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+
+	leaf := dag.NodeWithData([]byte("leaf"))
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("a", leaf); err != nil {
+		t.Fatal(err)
+	}
+	// the leaf is linked twice, and written once
+	if err := root.AddNodeLink("b", leaf); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.AddMany(ctx, []ipld.Node{leaf, root}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(ctx, ds, []cid.Cid{root.Cid()}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Header.Roots) != 1 || !r.Header.Roots[0].Equals(root.Cid()) {
+		t.Fatalf("unexpected roots %v", r.Header.Roots)
+	}
+	var got []cid.Cid
+	for {
+		b, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, b.Cid())
+	}
+	if len(got) != 2 || !got[0].Equals(root.Cid()) || !got[1].Equals(leaf.Cid()) {
+		t.Fatalf("unexpected blocks %v", got)
+	}
+
+	// corrupted data is rejected
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	r, err = NewReader(bytes.NewReader(corrupt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for err == nil {
+		_, err = r.Next()
+	}
+	if err == io.EOF {
+		t.Fatal("expected the corrupted block to be rejected")
+	}
+}
@@ -0,0 +1,138 @@
+// Package channel publishes the revisions of a dataset over pubsub.
+//
+// A channel is named after a key of the keystore, and identified by the peer
+// ID of that key. Publishing to a channel signs a revision, holding the root
+// CID of the dataset and a sequence number, and broadcasts it on the pubsub
+// topic of the channel. Subscribers check the signature, keep the history of
+// the revisions, and pin the latest ones, unpinning older revisions as new
+// ones arrive.
+//
+// As pubsub doesn't keep messages, publishers broadcast the latest revision
+// of their channels again every RepublishInterval, for the subscribers that
+// were offline when it was first published.
+package channel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// TopicPrefix is the prefix of the pubsub topics of channels.
+const TopicPrefix = "/ipfs/channel/1.0.0/"
+
+// maxRevisionSize bounds the size of the revisions read from pubsub.
+const maxRevisionSize = 4 << 10
+
+// ErrInvalidRevision is returned for revisions that aren't signed by the key
+// of their channel.
+var ErrInvalidRevision = errors.New("invalid channel revision signature")
+
+// Revision is a version of the dataset published to a channel.
+type Revision struct {
+	Channel   string
+	Seq       uint64
+	Root      cid.Cid
+	Published time.Time
+
+	// PubKey is the key of the channel, when it can't be extracted from the
+	// channel ID.
+	PubKey    []byte `json:",omitempty"`
+	Signature []byte
+
+	// Pinned is set by subscribers when the root is pinned for the channel.
+	// It is not part of the signed revision.
+	Pinned bool `json:",omitempty"`
+}
+
+// Topic returns the pubsub topic of the channel id.
+func Topic(id peer.ID) string {
+	return TopicPrefix + id.Pretty()
+}
+
+func (r *Revision) signedBytes() []byte {
+	return []byte(fmt.Sprintf("ipfs-channel:%s:%d:%s:%d", r.Channel, r.Seq, r.Root, r.Published.UnixNano()))
+}
+
+// sign fills the channel, public key and signature of r with sk.
+func (r *Revision) sign(sk ci.PrivKey) error {
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return err
+	}
+	r.Channel = id.Pretty()
+
+	if _, err := id.ExtractPublicKey(); err != nil {
+		r.PubKey, err = sk.GetPublic().Bytes()
+		if err != nil {
+			return err
+		}
+	}
+
+	r.Signature, err = sk.Sign(r.signedBytes())
+	return err
+}
+
+// Verify checks that r is signed by the key of its channel.
+func (r *Revision) Verify() error {
+	id, err := peer.Decode(r.Channel)
+	if err != nil {
+		return err
+	}
+
+	var pk ci.PubKey
+	if len(r.PubKey) > 0 {
+		pk, err = ci.UnmarshalPublicKey(r.PubKey)
+		if err != nil {
+			return err
+		}
+		if !id.MatchesPublicKey(pk) {
+			return ErrInvalidRevision
+		}
+	} else {
+		pk, err = id.ExtractPublicKey()
+		if err != nil {
+			return err
+		}
+	}
+
+	ok, err := pk.Verify(r.signedBytes(), r.Signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidRevision
+	}
+	return nil
+}
+
+// encode returns the revision as sent over pubsub.
+func (r *Revision) encode() ([]byte, error) {
+	wire := *r
+	wire.Pinned = false
+	return json.Marshal(&wire)
+}
+
+// decodeRevision parses and verifies a revision received over pubsub.
+func decodeRevision(data []byte) (*Revision, error) {
+	if len(data) > maxRevisionSize {
+		return nil, fmt.Errorf("revision of %d bytes is too large", len(data))
+	}
+	var r Revision
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	r.Pinned = false
+	if !r.Root.Defined() {
+		return nil, errors.New("revision without a root")
+	}
+	if err := r.Verify(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
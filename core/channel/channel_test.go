@@ -0,0 +1,127 @@
+package channel
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestRevisionSignature(t *testing.T) {
+	ed, _, err := ci.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsa, _, err := ci.GenerateKeyPairWithReader(ci.RSA, 1024, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := dag.NodeWithData([]byte("dataset")).Cid()
+	for _, sk := range []ci.PrivKey{ed, rsa} {
+		r := &Revision{Seq: 1, Root: root, Published: time.Now()}
+		if err := r.sign(sk); err != nil {
+			t.Fatal(err)
+		}
+		data, err := r.encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decodeRevision(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Seq != 1 || !got.Root.Equals(root) {
+			t.Fatalf("unexpected revision: %+v", got)
+		}
+
+		got.Seq = 2
+		if err := got.Verify(); err != ErrInvalidRevision {
+			t.Fatalf("expected a tampered revision to be rejected, got %v", err)
+		}
+	}
+}
+
+func TestSyncPins(t *testing.T) {
+	ctx := context.Background()
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	dserv := mdtest.Mock()
+	pinner := pin.NewPinner(d, dserv, dserv)
+	s := New(ctx, nil, nil, d, dserv, pinner, bstore.NewGCLocker())
+
+	_, pk, err := ci.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var revs []*Revision
+	for i := 1; i <= 3; i++ {
+		nd := dag.NodeWithData([]byte{byte(i)})
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		r := &Revision{Channel: id.Pretty(), Seq: uint64(i), Root: nd.Cid()}
+		if err := s.putRevision(id, r); err != nil {
+			t.Fatal(err)
+		}
+		revs = append(revs, r)
+	}
+
+	// The first revision is pinned by the user, and stays pinned.
+	first, err := dserv.Get(ctx, revs[0].Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Pin(ctx, first, true); err != nil {
+		t.Fatal(err)
+	}
+
+	checkPinned := func(want ...bool) {
+		t.Helper()
+		for i, r := range revs {
+			_, pinned, err := pinner.IsPinnedWithType(ctx, r.Root, pin.Recursive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pinned != want[i] {
+				t.Fatalf("revision %d: expected pinned to be %t", r.Seq, want[i])
+			}
+		}
+	}
+
+	if err := s.syncPins(ctx, id, 3); err != nil {
+		t.Fatal(err)
+	}
+	checkPinned(true, true, true)
+
+	if err := s.syncPins(ctx, id, 1); err != nil {
+		t.Fatal(err)
+	}
+	checkPinned(true, false, true)
+
+	hist, err := s.History(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != 3 || hist[0].Seq != 3 || !hist[0].Pinned || hist[2].Pinned {
+		t.Fatalf("unexpected history: %+v", hist)
+	}
+
+	if err := s.syncPins(ctx, id, 0); err != nil {
+		t.Fatal(err)
+	}
+	checkPinned(true, false, false)
+}
@@ -0,0 +1,519 @@
+package channel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	keystore "github.com/ipfs/go-ipfs/keystore"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsquery "github.com/ipfs/go-datastore/query"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+var log = logging.Logger("channel")
+
+// RepublishInterval is how often the latest revision of the channels of the
+// node is broadcast again.
+var RepublishInterval = time.Minute
+
+// DefaultKeep is the number of revisions pinned by a subscription when none
+// is given.
+const DefaultKeep = 3
+
+// pinTimeout bounds the time spent fetching the dataset of a revision.
+const pinTimeout = time.Hour
+
+var (
+	revisionsPrefix     = ds.NewKey("/channels/revisions")
+	subscriptionsPrefix = ds.NewKey("/channels/subscriptions")
+)
+
+// ErrNotSubscribed is returned when unsubscribing from a channel the node
+// isn't subscribed to.
+var ErrNotSubscribed = errors.New("not subscribed to the channel")
+
+// Subscription is a channel the node is subscribed to.
+type Subscription struct {
+	Channel string
+
+	// Keep is the number of revisions pinned.
+	Keep int
+}
+
+// Service publishes and follows channels.
+type Service struct {
+	ctx context.Context
+
+	ps      *pubsub.PubSub
+	ks      keystore.Keystore
+	ds      ds.Datastore
+	dag     ipld.DAGService
+	pinning pin.Pinner
+	gcl     bstore.GCLocker
+
+	mu   sync.Mutex
+	subs map[peer.ID]*subscription
+}
+
+type subscription struct {
+	Subscription
+
+	cancel func()
+	sync   chan struct{}
+}
+
+// New creates the channel service. Start restores the subscriptions and
+// starts republishing.
+func New(ctx context.Context, ps *pubsub.PubSub, ks keystore.Keystore, d ds.Datastore, dag ipld.DAGService, pinning pin.Pinner, gcl bstore.GCLocker) *Service {
+	return &Service{
+		ctx:     ctx,
+		ps:      ps,
+		ks:      ks,
+		ds:      d,
+		dag:     dag,
+		pinning: pinning,
+		gcl:     gcl,
+		subs:    make(map[peer.ID]*subscription),
+	}
+}
+
+// Start restores the subscriptions saved in the datastore and starts
+// republishing the channels of the node.
+func (s *Service) Start() error {
+	res, err := s.ds.Query(dsquery.Query{Prefix: subscriptionsPrefix.String()})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		var sub Subscription
+		if err := json.Unmarshal(e.Value, &sub); err != nil {
+			log.Warningf("invalid channel subscription %s: %s", e.Key, err)
+			continue
+		}
+		id, err := peer.Decode(sub.Channel)
+		if err != nil {
+			log.Warningf("invalid channel subscription %s: %s", e.Key, err)
+			continue
+		}
+		if err := s.subscribe(id, sub.Keep); err != nil {
+			return err
+		}
+	}
+
+	go s.republish()
+	return nil
+}
+
+// Publish signs a revision of the channel of the key name, with the root
+// CID, and broadcasts it.
+func (s *Service) Publish(ctx context.Context, name string, root cid.Cid) (*Revision, error) {
+	sk, err := s.ks.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("no key named %s: %s", name, err)
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var seq uint64 = 1
+	if latest, err := s.latest(id); err != nil {
+		return nil, err
+	} else if latest != nil {
+		seq = latest.Seq + 1
+	}
+
+	r := &Revision{Seq: seq, Root: root, Published: time.Now().UTC()}
+	if err := r.sign(sk); err != nil {
+		return nil, err
+	}
+	if err := s.putRevision(id, r); err != nil {
+		return nil, err
+	}
+
+	data, err := r.encode()
+	if err != nil {
+		return nil, err
+	}
+	return r, s.ps.Publish(Topic(id), data)
+}
+
+// Subscribe follows the channel id, pinning its latest keep revisions. If
+// the node is already subscribed, the number of revisions pinned is updated.
+func (s *Service) Subscribe(id peer.ID, keep int) error {
+	if keep < 1 {
+		return fmt.Errorf("at least one revision must be kept, got %d", keep)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(&Subscription{Channel: id.Pretty(), Keep: keep})
+	if err != nil {
+		return err
+	}
+	if err := s.ds.Put(subscriptionKey(id), data); err != nil {
+		return err
+	}
+
+	if sub, ok := s.subs[id]; ok {
+		sub.Keep = keep
+		sub.trigger()
+		return nil
+	}
+	return s.subscribeLocked(id, keep)
+}
+
+func (s *Service) subscribe(id peer.ID, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscribeLocked(id, keep)
+}
+
+func (s *Service) subscribeLocked(id peer.ID, keep int) error {
+	psub, err := s.ps.Subscribe(Topic(id))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	sub := &subscription{
+		Subscription: Subscription{Channel: id.Pretty(), Keep: keep},
+		cancel: func() {
+			cancel()
+			psub.Cancel()
+		},
+		sync: make(chan struct{}, 1),
+	}
+	s.subs[id] = sub
+
+	go s.receive(ctx, id, psub, sub)
+	go s.pinLoop(ctx, id, sub)
+	sub.trigger()
+	return nil
+}
+
+// Unsubscribe stops following the channel id, and unpins the revisions
+// pinned for it.
+func (s *Service) Unsubscribe(ctx context.Context, id peer.ID) error {
+	s.mu.Lock()
+	sub, ok := s.subs[id]
+	if ok {
+		sub.cancel()
+		delete(s.subs, id)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return ErrNotSubscribed
+	}
+
+	if err := s.ds.Delete(subscriptionKey(id)); err != nil {
+		return err
+	}
+	return s.syncPins(ctx, id, 0)
+}
+
+// Subscriptions returns the channels the node is subscribed to.
+func (s *Service) Subscriptions() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		out = append(out, sub.Subscription)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Channel < out[j].Channel
+	})
+	return out
+}
+
+// History returns the revisions of the channel id published or received by
+// the node, latest first.
+func (s *Service) History(id peer.ID) ([]*Revision, error) {
+	res, err := s.ds.Query(dsquery.Query{Prefix: revisionsKey(id).String() + "/"})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	revs := make([]*Revision, 0, len(entries))
+	for _, e := range entries {
+		var r Revision
+		if err := json.Unmarshal(e.Value, &r); err != nil {
+			return nil, fmt.Errorf("invalid revision %s: %s", e.Key, err)
+		}
+		revs = append(revs, &r)
+	}
+	sort.Slice(revs, func(i, j int) bool {
+		return revs[i].Seq > revs[j].Seq
+	})
+	return revs, nil
+}
+
+func (s *Service) latest(id peer.ID) (*Revision, error) {
+	revs, err := s.History(id)
+	if err != nil || len(revs) == 0 {
+		return nil, err
+	}
+	return revs[0], nil
+}
+
+func (s *Service) putRevision(id peer.ID, r *Revision) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.ds.Put(revisionKey(id, r.Seq), data)
+}
+
+// receive records the new revisions broadcast on the channel.
+func (s *Service) receive(ctx context.Context, id peer.ID, psub *pubsub.Subscription, sub *subscription) {
+	for {
+		msg, err := psub.Next(ctx)
+		if err != nil {
+			return
+		}
+
+		r, err := decodeRevision(msg.Data)
+		if err != nil {
+			log.Debugf("dropping revision of channel %s from %s: %s", id.Pretty(), msg.GetFrom(), err)
+			continue
+		}
+		if r.Channel != id.Pretty() {
+			log.Debugf("dropping revision of channel %s broadcast on channel %s", r.Channel, id.Pretty())
+			continue
+		}
+
+		s.mu.Lock()
+		latest, err := s.latest(id)
+		if err == nil && (latest == nil || r.Seq > latest.Seq) {
+			err = s.putRevision(id, r)
+			if err == nil {
+				log.Infof("channel %s: revision %d, %s", id.Pretty(), r.Seq, r.Root)
+				sub.trigger()
+			}
+		}
+		s.mu.Unlock()
+		if err != nil {
+			log.Errorf("channel %s: %s", id.Pretty(), err)
+		}
+	}
+}
+
+func (sub *subscription) trigger() {
+	select {
+	case sub.sync <- struct{}{}:
+	default:
+	}
+}
+
+// pinLoop pins the latest revisions of the channel whenever one is received.
+func (s *Service) pinLoop(ctx context.Context, id peer.ID, sub *subscription) {
+	for {
+		select {
+		case <-sub.sync:
+		case <-ctx.Done():
+			return
+		}
+
+		s.mu.Lock()
+		keep := sub.Keep
+		s.mu.Unlock()
+
+		if err := s.syncPins(ctx, id, keep); err != nil && ctx.Err() == nil {
+			log.Errorf("channel %s: %s", id.Pretty(), err)
+		}
+	}
+}
+
+// syncPins pins the latest keep revisions of the channel, and unpins the
+// older ones. Roots which were already pinned are left alone.
+func (s *Service) syncPins(ctx context.Context, id peer.ID, keep int) error {
+	revs, err := s.History(id)
+	if err != nil {
+		return err
+	}
+
+	kept := make(map[cid.Cid]bool, keep)
+	for i, r := range revs {
+		if i < keep {
+			kept[r.Root] = true
+		}
+	}
+
+	for i, r := range revs {
+		switch {
+		case i < keep && !r.Pinned:
+			pinned, err := s.pin(ctx, r.Root)
+			if err != nil {
+				return fmt.Errorf("pinning revision %d: %s", r.Seq, err)
+			}
+			if !pinned {
+				continue
+			}
+		case i >= keep && r.Pinned:
+			if !kept[r.Root] {
+				if err := s.unpin(ctx, r.Root); err != nil {
+					return fmt.Errorf("unpinning revision %d: %s", r.Seq, err)
+				}
+			}
+		default:
+			continue
+		}
+
+		r.Pinned = !r.Pinned
+		s.mu.Lock()
+		err := s.putRevision(id, r)
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pin pins root recursively, fetching it if needed. It returns false if root
+// was already pinned.
+func (s *Service) pin(ctx context.Context, root cid.Cid) (bool, error) {
+	if _, pinned, err := s.pinning.IsPinnedWithType(ctx, root, pin.Recursive); err != nil || pinned {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pinTimeout)
+	defer cancel()
+
+	nd, err := s.dag.Get(ctx, root)
+	if err != nil {
+		return false, err
+	}
+
+	defer s.gcl.PinLock().Unlock()
+	if err := s.pinning.Pin(ctx, nd, true); err != nil {
+		return false, err
+	}
+	return true, s.pinning.Flush(ctx)
+}
+
+func (s *Service) unpin(ctx context.Context, root cid.Cid) error {
+	defer s.gcl.PinLock().Unlock()
+	if err := s.pinning.Unpin(ctx, root, true); err != nil && err != pin.ErrNotPinned {
+		return err
+	}
+	return s.pinning.Flush(ctx)
+}
+
+// republish broadcasts the latest revision of the channels of the node every
+// RepublishInterval.
+func (s *Service) republish() {
+	ticker := time.NewTicker(RepublishInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+
+		names, err := s.ks.List()
+		if err != nil {
+			log.Errorf("listing keys: %s", err)
+			continue
+		}
+		for _, name := range names {
+			if err := s.republishKey(name); err != nil {
+				log.Errorf("republishing channel %s: %s", name, err)
+			}
+		}
+	}
+}
+
+func (s *Service) republishKey(name string) error {
+	sk, err := s.ks.Get(name)
+	if err != nil {
+		return err
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	latest, err := s.latest(id)
+	s.mu.Unlock()
+	if err != nil || latest == nil {
+		return err
+	}
+
+	data, err := latest.encode()
+	if err != nil {
+		return err
+	}
+	return s.ps.Publish(Topic(id), data)
+}
+
+// Close cancels the subscriptions.
+func (s *Service) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, sub := range s.subs {
+		sub.cancel()
+		delete(s.subs, id)
+	}
+	return nil
+}
+
+func revisionsKey(id peer.ID) ds.Key {
+	return revisionsPrefix.ChildString(id.Pretty())
+}
+
+// revisionKey pads seq so the revisions of a channel sort in order.
+func revisionKey(id peer.ID, seq uint64) ds.Key {
+	return revisionsKey(id).ChildString(fmt.Sprintf("%020d", seq))
+}
+
+func subscriptionKey(id peer.ID) ds.Key {
+	return subscriptionsPrefix.ChildString(id.Pretty())
+}
+
+// ParseChannel returns the ID of a channel given either the name of a key of
+// ks or a channel ID.
+func ParseChannel(ks keystore.Keystore, name string) (peer.ID, error) {
+	name = strings.TrimPrefix(name, "/ipns/")
+	if has, err := ks.Has(name); err == nil && has {
+		sk, err := ks.Get(name)
+		if err != nil {
+			return "", err
+		}
+		return peer.IDFromPrivateKey(sk)
+	}
+	id, err := peer.Decode(name)
+	if err != nil {
+		return "", fmt.Errorf("%q is neither a key name nor a channel ID", name)
+	}
+	return id, nil
+}
@@ -0,0 +1,215 @@
+// Package chaos implements fault injection for resilience testing.
+//
+// When enabled through the Chaos.Enabled config key, an Injector is attached
+// to the node. It can reset a fraction of newly opened streams, delay stream
+// opening globally or per peer, and corrupt a fraction of the blocks read from
+// the local blockstore. All faults are off until configured at runtime with
+// 'ipfs diag chaos'. This is meant for test networks only: never enable it on
+// a node that serves real users.
+package chaos
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	logging "github.com/ipfs/go-log"
+	network "github.com/libp2p/go-libp2p-core/network"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("chaos")
+
+// ConfigKey is the key of the chaos section in the repo config.
+const ConfigKey = "Chaos"
+
+// Config holds the Chaos config section.
+type Config struct {
+	// Enabled attaches a fault injector to the node.
+	Enabled bool
+}
+
+// Settings are the faults currently injected.
+type Settings struct {
+	// DropStreams is the probability, between 0 and 1, that a newly opened
+	// stream is reset.
+	DropStreams float64
+
+	// Latency is added before every new stream can be used.
+	Latency time.Duration
+
+	// PeerLatency overrides Latency for streams with the given peers, keyed
+	// by peer ID.
+	PeerLatency map[string]time.Duration
+
+	// CorruptBlocks is the probability, between 0 and 1, that a block read
+	// from the blockstore is corrupted.
+	CorruptBlocks float64
+}
+
+// Stats counts the faults injected so far.
+type Stats struct {
+	DroppedStreams  uint64
+	DelayedStreams  uint64
+	CorruptedBlocks uint64
+}
+
+// Injector injects faults according to its current settings.
+type Injector struct {
+	droppedStreams  uint64
+	delayedStreams  uint64
+	corruptedBlocks uint64
+
+	mu       sync.RWMutex
+	settings Settings
+}
+
+// New returns an Injector with every fault disabled.
+func New() *Injector {
+	return &Injector{}
+}
+
+// Load returns a new Injector if fault injection is enabled in the config of
+// r, or nil otherwise.
+func Load(r repo.Repo) (*Injector, error) {
+	var cfg Config
+	if err := repo.LoadConfigKey(r, ConfigKey, &cfg); err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	log.Warning("chaos fault injection is enabled")
+	return New(), nil
+}
+
+// Settings returns the current settings.
+func (i *Injector) Settings() Settings {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	s := i.settings
+	s.PeerLatency = make(map[string]time.Duration, len(i.settings.PeerLatency))
+	for p, d := range i.settings.PeerLatency {
+		s.PeerLatency[p] = d
+	}
+	return s
+}
+
+// SetSettings replaces the current settings.
+func (i *Injector) SetSettings(s Settings) error {
+	if s.DropStreams < 0 || s.DropStreams > 1 {
+		return fmt.Errorf("stream drop rate must be between 0 and 1, was %g", s.DropStreams)
+	}
+	if s.CorruptBlocks < 0 || s.CorruptBlocks > 1 {
+		return fmt.Errorf("block corruption rate must be between 0 and 1, was %g", s.CorruptBlocks)
+	}
+	if s.Latency < 0 {
+		return fmt.Errorf("latency must not be negative")
+	}
+	for p, d := range s.PeerLatency {
+		if d < 0 {
+			return fmt.Errorf("latency for %s must not be negative", p)
+		}
+	}
+
+	i.mu.Lock()
+	i.settings = s
+	i.mu.Unlock()
+	return nil
+}
+
+// Stats returns the number of faults injected so far.
+func (i *Injector) Stats() Stats {
+	return Stats{
+		DroppedStreams:  atomic.LoadUint64(&i.droppedStreams),
+		DelayedStreams:  atomic.LoadUint64(&i.delayedStreams),
+		CorruptedBlocks: atomic.LoadUint64(&i.corruptedBlocks),
+	}
+}
+
+func (i *Injector) latency(p string) time.Duration {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if d, ok := i.settings.PeerLatency[p]; ok {
+		return d
+	}
+	return i.settings.Latency
+}
+
+func (i *Injector) roll(rate func(s *Settings) float64) bool {
+	i.mu.RLock()
+	r := rate(&i.settings)
+	i.mu.RUnlock()
+	return r > 0 && rand.Float64() < r
+}
+
+// Notifiee returns a network notifiee that delays and resets streams as they
+// are opened. Stream notifications are delivered before the stream is handed
+// to its user, so a delay here holds up both sides.
+func (i *Injector) Notifiee() network.Notifiee {
+	return (*notifiee)(i)
+}
+
+type notifiee Injector
+
+func (n *notifiee) OpenedStream(_ network.Network, s network.Stream) {
+	i := (*Injector)(n)
+
+	if d := i.latency(s.Conn().RemotePeer().Pretty()); d > 0 {
+		atomic.AddUint64(&i.delayedStreams, 1)
+		time.Sleep(d)
+	}
+
+	if i.roll(func(s *Settings) float64 { return s.DropStreams }) {
+		atomic.AddUint64(&i.droppedStreams, 1)
+		log.Debugf("dropping stream %s with %s", s.Protocol(), s.Conn().RemotePeer())
+		s.Reset()
+	}
+}
+
+func (n *notifiee) Listen(network.Network, ma.Multiaddr)         {}
+func (n *notifiee) ListenClose(network.Network, ma.Multiaddr)    {}
+func (n *notifiee) Connected(network.Network, network.Conn)      {}
+func (n *notifiee) Disconnected(network.Network, network.Conn)   {}
+func (n *notifiee) ClosedStream(network.Network, network.Stream) {}
+
+// Blockstore wraps bs so that reads return corrupted blocks according to the
+// current settings. It returns bs itself if i is nil.
+func (i *Injector) Blockstore(bs blockstore.Blockstore) blockstore.Blockstore {
+	if i == nil {
+		return bs
+	}
+	return &corruptingBlockstore{Blockstore: bs, inj: i}
+}
+
+type corruptingBlockstore struct {
+	blockstore.Blockstore
+	inj *Injector
+}
+
+func (bs *corruptingBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	b, err := bs.Blockstore.Get(c)
+	if err != nil || len(b.RawData()) == 0 {
+		return b, err
+	}
+	if !bs.inj.roll(func(s *Settings) float64 { return s.CorruptBlocks }) {
+		return b, nil
+	}
+
+	data := make([]byte, len(b.RawData()))
+	copy(data, b.RawData())
+	data[rand.Intn(len(data))] ^= 0xff
+
+	atomic.AddUint64(&bs.inj.corruptedBlocks, 1)
+	log.Debugf("corrupting block %s", c)
+	return blocks.NewBlockWithCid(data, c)
+}
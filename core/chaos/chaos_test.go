@@ -0,0 +1,65 @@
+package chaos
+
+import (
+	"bytes"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+func TestSetSettingsValidates(t *testing.T) {
+	inj := New()
+	for _, s := range []Settings{
+		{DropStreams: -0.1},
+		{DropStreams: 1.5},
+		{CorruptBlocks: 2},
+		{Latency: -1},
+	} {
+		if err := inj.SetSettings(s); err == nil {
+			t.Errorf("expected %+v to be rejected", s)
+		}
+	}
+}
+
+func TestCorruptBlocks(t *testing.T) {
+	inj := New()
+	bs := inj.Blockstore(blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore())))
+
+	b := blocks.NewBlock([]byte("some block"))
+	if err := bs.Put(b); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := bs.Get(b.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.RawData(), b.RawData()) {
+		t.Fatal("block corrupted while faults are disabled")
+	}
+
+	if err := inj.SetSettings(Settings{CorruptBlocks: 1}); err != nil {
+		t.Fatal(err)
+	}
+	out, err = bs.Get(b.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(out.RawData(), b.RawData()) {
+		t.Fatal("expected a corrupted block")
+	}
+	if inj.Stats().CorruptedBlocks != 1 {
+		t.Fatalf("expected 1 corrupted block, got %d", inj.Stats().CorruptedBlocks)
+	}
+}
+
+func TestNilInjectorBlockstore(t *testing.T) {
+	var inj *Injector
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	if inj.Blockstore(bs) != bs {
+		t.Fatal("nil injector should not wrap the blockstore")
+	}
+}
@@ -0,0 +1,386 @@
+// Package clockskew estimates the offset of the local clock, from NTP servers
+// or from the connected peers, and widens the validation of the IPNS records
+// by the skew.
+//
+// A clock running ahead makes the records look expired before their end of
+// life, and they are rejected without a word. Every Interval, the estimator
+// asks the NTP servers of the config for the time or, without any server or
+// when none answers, a sample of the connected peers over the clock protocol.
+// The median of the offsets is the estimate; when it exceeds MaxSkew, a
+// warning is logged, as the certificates are checked against the local clock
+// too. With Adjust set, the IPNS records expired by less than the advance of
+// the clock, up to MaxSlack, are still accepted.
+package clockskew
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	logging "github.com/ipfs/go-log"
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+)
+
+var log = logging.Logger("clockskew")
+
+// ConfigKey is the config key of the clock section.
+const ConfigKey = "Clock"
+
+// ID is the protocol ID of the clock protocol, answering with the time of the
+// peer.
+const ID protocol.ID = "/ipfs/clock/1.0.0"
+
+// By default, the offset is estimated every 10 minutes, a warning is logged
+// past 30 seconds, and the validation of the IPNS records is widened by an
+// hour at most.
+const (
+	DefaultInterval = 10 * time.Minute
+	DefaultMaxSkew  = 30 * time.Second
+	DefaultMaxSlack = time.Hour
+)
+
+// samplePeers is the number of connected peers asked for the time.
+const samplePeers = 8
+
+// minPeers is the number of peers that must answer for their estimate to be
+// used.
+const minPeers = 3
+
+// queryTimeout bounds the query of a server or of a peer.
+const queryTimeout = 10 * time.Second
+
+// Config holds the Clock config section.
+type Config struct {
+	Enabled bool
+
+	// Interval is the time between two estimates, e.g. "10m".
+	Interval string
+
+	// NTPServers are the NTP servers asked for the time, as "host" or
+	// "host:port". The connected peers are asked when unset.
+	NTPServers []string
+
+	// MaxSkew is the offset above which a warning is logged, e.g. "30s".
+	MaxSkew string
+
+	// Adjust widens the validation of the IPNS records by the advance of
+	// the clock.
+	Adjust bool
+
+	// MaxSlack bounds the widening, e.g. "1h".
+	MaxSlack string
+}
+
+// LoadConfig reads the Clock section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// Sample is the offset measured from a server or a peer.
+type Sample struct {
+	Source string
+	Offset time.Duration `json:",omitempty"`
+	RTT    time.Duration `json:",omitempty"`
+	Error  string        `json:",omitempty"`
+}
+
+// Report is the last estimate of the offset.
+type Report struct {
+	// Checked is the time of the last estimate. Estimated tells whether
+	// enough sources answered for Offset to be known.
+	Checked   time.Time
+	Estimated bool
+
+	// Offset is the time of the sources minus the local time: negative
+	// when the local clock is ahead.
+	Offset time.Duration
+	Skewed bool
+
+	// Slack is how long after their end of life the IPNS records are
+	// accepted.
+	Slack time.Duration
+
+	// Method is "ntp" or "peers".
+	Method  string `json:",omitempty"`
+	Samples []Sample
+}
+
+// Estimator estimates the offset of the local clock.
+type Estimator struct {
+	interval time.Duration
+	maxSkew  time.Duration
+	maxSlack time.Duration
+	adjust   bool
+	servers  []string
+
+	// the sources queried, replaced by the tests
+	queryNTP  func(ctx context.Context, server string) (offset, rtt time.Duration, err error)
+	queryPeer func(ctx context.Context, p peer.ID) (offset, rtt time.Duration, err error)
+	peers     func() []peer.ID
+
+	mu      sync.Mutex
+	report  Report
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// New returns an estimator, or nil if disabled in cfg.
+func New(cfg Config) (*Estimator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	e := &Estimator{
+		adjust:   cfg.Adjust,
+		servers:  cfg.NTPServers,
+		queryNTP: queryNTP,
+	}
+	var err error
+	if e.interval, err = repo.ConfigDuration(ConfigKey, "Interval", cfg.Interval, DefaultInterval); err != nil {
+		return nil, err
+	}
+	if e.maxSkew, err = repo.ConfigDuration(ConfigKey, "MaxSkew", cfg.MaxSkew, DefaultMaxSkew); err != nil {
+		return nil, err
+	}
+	if e.maxSlack, err = repo.ConfigDuration(ConfigKey, "MaxSlack", cfg.MaxSlack, DefaultMaxSlack); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Start estimates the offset now and every interval, from the servers or
+// from the peers connected to h.
+func (e *Estimator) Start(h host.Host) {
+	e.peers = h.Network().Peers
+	e.queryPeer = func(ctx context.Context, p peer.ID) (time.Duration, time.Duration, error) {
+		return queryPeer(ctx, h, p)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.stopped = make(chan struct{})
+	go func() {
+		defer close(e.stopped)
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			e.Check(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the estimates.
+func (e *Estimator) Close() error {
+	if e.cancel != nil {
+		e.cancel()
+		<-e.stopped
+	}
+	return nil
+}
+
+// Check estimates the offset now, and returns the report.
+func (e *Estimator) Check(ctx context.Context) Report {
+	r := Report{Checked: time.Now()}
+
+	if len(e.servers) > 0 {
+		r.Method = "ntp"
+		offsets := e.sample(ctx, e.servers, func(ctx context.Context, s string) (time.Duration, time.Duration, error) {
+			return e.queryNTP(ctx, s)
+		}, &r)
+		if len(offsets) > 0 {
+			r.Offset, r.Estimated = median(offsets), true
+		}
+	}
+	if !r.Estimated && e.peers != nil {
+		r.Method = "peers"
+		peers := e.peers()
+		rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+		if len(peers) > samplePeers {
+			peers = peers[:samplePeers]
+		}
+		sources := make([]string, len(peers))
+		for i, p := range peers {
+			sources[i] = p.Pretty()
+		}
+		offsets := e.sample(ctx, sources, func(ctx context.Context, s string) (time.Duration, time.Duration, error) {
+			p, err := peer.Decode(s)
+			if err != nil {
+				return 0, 0, err
+			}
+			return e.queryPeer(ctx, p)
+		}, &r)
+		if len(offsets) >= minPeers {
+			r.Offset, r.Estimated = median(offsets), true
+		}
+	}
+
+	if r.Estimated {
+		r.Skewed = abs(r.Offset) > e.maxSkew
+		if e.adjust && r.Offset < 0 {
+			r.Slack = -r.Offset
+			if r.Slack > e.maxSlack {
+				r.Slack = e.maxSlack
+			}
+		}
+	}
+
+	e.mu.Lock()
+	was := e.report.Skewed
+	if !r.Estimated && e.report.Estimated {
+		// keep the last estimate while no source answers
+		r.Estimated, r.Offset, r.Skewed, r.Slack = true, e.report.Offset, e.report.Skewed, e.report.Slack
+	}
+	e.report = r
+	e.mu.Unlock()
+
+	switch {
+	case r.Skewed && !was:
+		log.Warningf("the local clock is %s according to %s, the IPNS records and the certificates may be rejected", Describe(r.Offset), r.Method)
+	case !r.Skewed && was && r.Estimated:
+		log.Infof("the local clock is back in sync, %s", Describe(r.Offset))
+	}
+	return r
+}
+
+// sample queries the sources concurrently, and returns the offsets of those
+// that answered.
+func (e *Estimator) sample(ctx context.Context, sources []string, query func(context.Context, string) (time.Duration, time.Duration, error), r *Report) []time.Duration {
+	samples := make([]Sample, len(sources))
+	var wg sync.WaitGroup
+	for i, s := range sources {
+		wg.Add(1)
+		go func(i int, s string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+			defer cancel()
+			samples[i].Source = s
+			offset, rtt, err := query(ctx, s)
+			if err != nil {
+				samples[i].Error = err.Error()
+				return
+			}
+			samples[i].Offset, samples[i].RTT = offset, rtt
+		}(i, s)
+	}
+	wg.Wait()
+
+	var offsets []time.Duration
+	for _, s := range samples {
+		if s.Error == "" {
+			offsets = append(offsets, s.Offset)
+		}
+	}
+	r.Samples = append(r.Samples, samples...)
+	return offsets
+}
+
+// Report returns the last estimate.
+func (e *Estimator) Report() Report {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r := e.report
+	r.Samples = append([]Sample(nil), r.Samples...)
+	return r
+}
+
+// Slack returns how long after their end of life the IPNS records are
+// accepted. It is safe to call on a nil Estimator, in which case it returns
+// zero.
+func (e *Estimator) Slack() time.Duration {
+	if e == nil {
+		return 0
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.report.Slack
+}
+
+// Serve answers the clock protocol on h, so that the peers can estimate
+// their offset.
+func Serve(h host.Host) {
+	h.SetStreamHandler(ID, func(s inet.Stream) {
+		defer s.Close()
+		s.SetDeadline(time.Now().Add(queryTimeout))
+		var req [1]byte
+		if _, err := s.Read(req[:]); err != nil {
+			s.Reset()
+			return
+		}
+		var resp [8]byte
+		binary.BigEndian.PutUint64(resp[:], uint64(time.Now().UnixNano()))
+		if _, err := s.Write(resp[:]); err != nil {
+			s.Reset()
+		}
+	})
+}
+
+// queryPeer asks p for its time, and returns its offset as seen at the
+// middle of the round trip.
+func queryPeer(ctx context.Context, h host.Host, p peer.ID) (time.Duration, time.Duration, error) {
+	s, err := h.NewStream(ctx, p, ID)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer s.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	sent := time.Now()
+	if _, err := s.Write([]byte{0}); err != nil {
+		s.Reset()
+		return 0, 0, err
+	}
+	var resp [8]byte
+	if _, err := io.ReadFull(s, resp[:]); err != nil {
+		s.Reset()
+		return 0, 0, err
+	}
+	received := time.Now()
+
+	remote := time.Unix(0, int64(binary.BigEndian.Uint64(resp[:])))
+	rtt := received.Sub(sent)
+	return remote.Sub(sent.Add(rtt / 2)), rtt, nil
+}
+
+func median(ds []time.Duration) time.Duration {
+	sorted := append([]time.Duration(nil), ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Describe tells how far ahead or behind the local clock is, from its
+// offset.
+func Describe(offset time.Duration) string {
+	d := abs(offset).Round(time.Millisecond)
+	if offset < 0 {
+		return d.String() + " ahead"
+	}
+	return d.String() + " behind"
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
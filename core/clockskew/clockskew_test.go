@@ -0,0 +1,176 @@
+package clockskew
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	ipns "github.com/ipfs/go-ipns"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pstoremem "github.com/libp2p/go-libp2p-peerstore/pstoremem"
+)
+
+func TestCheck(t *testing.T) {
+	e, err := New(Config{Enabled: true, NTPServers: []string{"a", "b", "c"}, Adjust: true, MaxSlack: "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ntp := map[string]time.Duration{"a": -2 * time.Minute, "b": -3 * time.Minute}
+	e.queryNTP = func(_ context.Context, s string) (time.Duration, time.Duration, error) {
+		if o, ok := ntp[s]; ok {
+			return o, time.Millisecond, nil
+		}
+		return 0, 0, errors.New("timeout")
+	}
+	peers := map[peer.ID]time.Duration{"p1": time.Second, "p2": 2 * time.Second}
+	e.peers = func() []peer.ID {
+		var ps []peer.ID
+		for p := range peers {
+			ps = append(ps, p)
+		}
+		return ps
+	}
+	e.queryPeer = func(_ context.Context, p peer.ID) (time.Duration, time.Duration, error) {
+		return peers[p], time.Millisecond, nil
+	}
+
+	// the servers answering, their median is the estimate
+	r := e.Check(context.Background())
+	if !r.Estimated || r.Method != "ntp" || r.Offset != -150*time.Second || !r.Skewed {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if len(r.Samples) != 3 {
+		t.Fatalf("expected 3 samples, got %d", len(r.Samples))
+	}
+	// the slack is bounded by MaxSlack
+	if e.Slack() != time.Minute {
+		t.Fatalf("expected a slack of 1m, got %s", e.Slack())
+	}
+
+	// without any server, too few peers keep the last estimate
+	ntp = nil
+	r = e.Check(context.Background())
+	if r.Method != "peers" || !r.Estimated || r.Offset != -150*time.Second {
+		t.Fatalf("unexpected report %+v", r)
+	}
+
+	// enough peers give a new estimate, the clock behind needing no slack
+	peers["p3"] = 3 * time.Second
+	r = e.Check(context.Background())
+	if !r.Estimated || r.Offset != 2*time.Second || r.Skewed {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if e.Slack() != 0 {
+		t.Fatalf("expected no slack, got %s", e.Slack())
+	}
+}
+
+func TestConfig(t *testing.T) {
+	if e, err := New(Config{}); e != nil || err != nil {
+		t.Fatal("expected no estimator when disabled")
+	}
+	if _, err := New(Config{Enabled: true, MaxSkew: "-1s"}); err == nil {
+		t.Fatal("expected an error for a negative MaxSkew")
+	}
+	if _, err := New(Config{Enabled: true, Interval: "soon"}); err == nil {
+		t.Fatal("expected an error for an invalid Interval")
+	}
+	var e *Estimator
+	if e.Slack() != 0 {
+		t.Fatal("expected no slack from a nil estimator")
+	}
+}
+
+func TestParseNTPResponse(t *testing.T) {
+	sent := time.Unix(1600000000, 250000000)
+	received := sent.Add(100 * time.Millisecond)
+
+	req := make([]byte, ntpPacketSize)
+	putNTPTime(req[40:], sent)
+
+	// the server is 5s ahead, and takes 20ms to answer
+	resp := make([]byte, ntpPacketSize)
+	resp[0] = 4<<3 | 4
+	resp[1] = 2
+	copy(resp[24:32], req[40:48])
+	putNTPTime(resp[32:], sent.Add(5*time.Second+40*time.Millisecond))
+	putNTPTime(resp[40:], sent.Add(5*time.Second+60*time.Millisecond))
+
+	offset, rtt, err := parseNTPResponse(req, resp, sent, received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := offset - 5*time.Second; d < -time.Microsecond || d > time.Microsecond {
+		t.Fatalf("expected an offset of 5s, got %s", offset)
+	}
+	if d := rtt - 80*time.Millisecond; d < -time.Microsecond || d > time.Microsecond {
+		t.Fatalf("expected a round trip of 80ms, got %s", rtt)
+	}
+
+	resp[1] = 0
+	if _, _, err := parseNTPResponse(req, resp, sent, received); err == nil {
+		t.Fatal("expected an error for a kiss-o'-death")
+	}
+	resp[1] = 2
+	resp[24]++
+	if _, _, err := parseNTPResponse(req, resp, sent, received); err == nil {
+		t.Fatal("expected an error for a response to another request")
+	}
+}
+
+func TestValidator(t *testing.T) {
+	sk, pk, err := ci.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := pstoremem.NewPeerstore()
+	if err := ps.AddPubKey(id, pk); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := ipns.Create(sk, []byte("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"), 1, time.Now().Add(-10*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := proto.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := ipns.RecordKey(id)
+
+	e, err := New(Config{Enabled: true, Adjust: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := Validator{Validator: ipns.Validator{KeyBook: ps}, Estimator: e}
+
+	if err := v.Validate(key, value); err != ipns.ErrExpiredRecord {
+		t.Fatalf("expected the record expired without slack, got %v", err)
+	}
+	e.report = Report{Estimated: true, Slack: 15 * time.Minute}
+	if err := v.Validate(key, value); err != nil {
+		t.Fatalf("expected the record accepted within the slack, got %s", err)
+	}
+	e.report.Slack = 5 * time.Minute
+	if err := v.Validate(key, value); err != ipns.ErrExpiredRecord {
+		t.Fatalf("expected the record expired beyond the slack, got %v", err)
+	}
+
+	// the slack doesn't spare the signature
+	entry.Signature[0] ^= 0xff
+	if value, err = proto.Marshal(entry); err != nil {
+		t.Fatal(err)
+	}
+	e.report.Slack = 15 * time.Minute
+	if err := v.Validate(key, value); err == nil || err == ipns.ErrExpiredRecord {
+		t.Fatalf("expected a signature error, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package clockskew
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	ntpPort       = "123"
+	ntpPacketSize = 48
+
+	// ntpEpochOffset is the number of seconds between the NTP epoch,
+	// 1900, and the Unix epoch.
+	ntpEpochOffset = 2208988800
+)
+
+// queryNTP asks server for the time over SNTP (RFC 4330), and returns the
+// offset of the local clock.
+func queryNTP(ctx context.Context, server string) (time.Duration, time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, ntpPort)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	req := make([]byte, ntpPacketSize)
+	// no leap indicator, version 4, client mode
+	req[0] = 0<<6 | 4<<3 | 3
+	sent := time.Now()
+	putNTPTime(req[40:], sent)
+	if _, err := conn.Write(req); err != nil {
+		return 0, 0, err
+	}
+
+	resp := make([]byte, ntpPacketSize)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return 0, 0, err
+	}
+	received := time.Now()
+	if n < ntpPacketSize {
+		return 0, 0, errors.New("short NTP response")
+	}
+	return parseNTPResponse(req, resp, sent, received)
+}
+
+// parseNTPResponse returns the offset and the round trip time from the
+// response to req, sent and received at the local times given.
+func parseNTPResponse(req, resp []byte, sent, received time.Time) (time.Duration, time.Duration, error) {
+	if mode := resp[0] & 0x7; mode != 4 {
+		return 0, 0, fmt.Errorf("unexpected NTP mode %d", mode)
+	}
+	if leap := resp[0] >> 6; leap == 3 {
+		return 0, 0, errors.New("the NTP server is not synchronized")
+	}
+	if stratum := resp[1]; stratum == 0 || stratum > 15 {
+		return 0, 0, fmt.Errorf("the NTP server refused the query, stratum %d", stratum)
+	}
+	// the origin timestamp echoes the transmit timestamp of the request
+	if !bytes.Equal(resp[24:32], req[40:48]) {
+		return 0, 0, errors.New("the NTP response doesn't match the request")
+	}
+
+	serverReceived := ntpTime(resp[32:])
+	serverSent := ntpTime(resp[40:])
+	offset := (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	rtt := received.Sub(sent) - serverSent.Sub(serverReceived)
+	if rtt < 0 {
+		rtt = 0
+	}
+	return offset, rtt, nil
+}
+
+func ntpTime(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b)) - ntpEpochOffset
+	frac := int64(binary.BigEndian.Uint32(b[4:]))
+	return time.Unix(secs, frac*int64(time.Second)>>32)
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b, uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:], uint32((int64(t.Nanosecond())<<32)/int64(time.Second)))
+}
@@ -0,0 +1,42 @@
+package clockskew
+
+import (
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	ipns "github.com/ipfs/go-ipns"
+	pb "github.com/ipfs/go-ipns/pb"
+)
+
+// Validator is the IPNS validator, accepting the records expired by less
+// than the slack of the estimator, as a clock running ahead expires them
+// early.
+type Validator struct {
+	ipns.Validator
+
+	Estimator *Estimator
+}
+
+// Validate validates the IPNS record value under key.
+func (v Validator) Validate(key string, value []byte) error {
+	err := v.Validator.Validate(key, value)
+	if err != ipns.ErrExpiredRecord {
+		return err
+	}
+	slack := v.Estimator.Slack()
+	if slack == 0 {
+		return err
+	}
+
+	// the signature was checked already
+	entry := new(pb.IpnsEntry)
+	if proto.Unmarshal(value, entry) != nil {
+		return err
+	}
+	eol, eolErr := ipns.GetEOL(entry)
+	if eolErr != nil || time.Now().Add(-slack).After(eol) {
+		return err
+	}
+	log.Debugf("accepting the record of %s, expired %s ago, within the clock slack of %s", key, time.Since(eol).Round(time.Second), slack)
+	return nil
+}
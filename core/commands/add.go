@@ -6,16 +6,19 @@ import (
 	"io"
 	"os"
 	"path"
-	"strings"
 
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/coreunix"
+	"github.com/ipfs/go-ipfs/core/quota"
 	logging "github.com/ipfs/go-log"
 
+	humanize "github.com/dustin/go-humanize"
+	cid "github.com/ipfs/go-cid"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	files "github.com/ipfs/go-ipfs-files"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	"github.com/ipfs/interface-go-ipfs-core/options"
-	mh "github.com/multiformats/go-multihash"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
 	pb "gopkg.in/cheggaaa/pb.v1"
 )
 
@@ -26,11 +29,28 @@ var addlog = logging.Logger("cmds/add")
 // ErrDepthLimitExceeded indicates that the max depth has been exceeded.
 var ErrDepthLimitExceeded = fmt.Errorf("depth limit exceeded")
 
+// quotaError returns err as a client error if the repo quota rejected a block,
+// the user having to make room before trying again.
+func quotaError(err error) error {
+	if quota.IsExceeded(err) {
+		return cmds.Errorf(cmds.ErrClient, err.Error())
+	}
+	return err
+}
+
 type AddEvent struct {
 	Name  string
 	Hash  string `json:",omitempty"`
 	Bytes int64  `json:",omitempty"`
 	Size  string `json:",omitempty"`
+
+	// With --patch-from, the size of the data found in the previous version
+	// and of the changed data.
+	ReusedBytes uint64 `json:",omitempty"`
+	NewBytes    uint64 `json:",omitempty"`
+
+	// With --manifest, the CID of the manifest of the tree Name.
+	Manifest string `json:",omitempty"`
 }
 
 const (
@@ -50,6 +70,8 @@ const (
 	hashOptionName        = "hash"
 	inlineOptionName      = "inline"
 	inlineLimitOptionName = "inline-limit"
+	patchFromOptionName   = "patch-from"
+	manifestOptionName    = "manifest"
 )
 
 const adderOutChanSize = 8
@@ -107,6 +129,38 @@ You can now check what blocks have been created by:
   QmY6yj1GsermExDXoosVE3aSPxdMNYr6aKuw3nA8LoWPRS 2059
   QmerURi9k4XzKCaaPbsK6BL5pMEjF7PGphjDvkkjDtsVf3 868
   QmQB28iwSriSUSMqG2nXDTLtdPHgWb4rebBrU7Q1j4vxPv 338
+
+The hash option, '--hash', selects the hash function used for the blocks,
+e.g. 'sha3-256' or 'blake2b-256'. Only hash functions that are accepted by the
+blockstore and by bitswap can be used: the error returned for an unknown
+function lists them.
+
+The patch option, '--patch-from', adds a new version of a single file,
+reusing the blocks of a previous version given by its path. The file is cut
+at the boundaries of the unchanged blocks of the previous version wherever
+they are found, so that only the changed regions produce new blocks; the
+changed regions are cut into chunks as large as the previous blocks, and the
+chunker option is ignored. The amount of reused and new data is reported.
+Use the same leaf and hash options as for the previous version, or no block
+will match:
+
+  > ipfs add big.tar
+  added QmPrevious... big.tar
+  > ipfs add --patch-from=QmPrevious... big.tar
+  added QmNew... big.tar
+  patched: 1.1 GB reused, 262 kB new
+
+The manifest option, '--manifest', adds a dag-cbor manifest next to each
+added tree, listing the CID, size and SHA-256 hash of the content of every
+file. The manifest links to the tree; a retrieved or re-added copy of the
+tree can be checked against it with 'ipfs verify-manifest':
+
+  > ipfs add -r --manifest dataset
+  ...
+  added QmTree... dataset
+  manifest bafyreib... dataset
+  > ipfs verify-manifest bafyreib...
+  verified 1200 files of QmTree...
 `,
 	},
 
@@ -134,6 +188,8 @@ You can now check what blocks have been created by:
 		cmds.StringOption(hashOptionName, "Hash function to use. Implies CIDv1 if not sha2-256. (experimental)").WithDefault("sha2-256"),
 		cmds.BoolOption(inlineOptionName, "Inline small blocks into CIDs. (experimental)"),
 		cmds.IntOption(inlineLimitOptionName, "Maximum block size to inline. (experimental)").WithDefault(32),
+		cmds.StringOption(patchFromOptionName, "Reuse the blocks of a previous version of the file, given by its path. (experimental)"),
+		cmds.BoolOption(manifestOptionName, "Add a manifest of the added tree, to check copies with 'ipfs verify-manifest'. (experimental)"),
 	},
 	PreRun: func(req *cmds.Request, env cmds.Environment) error {
 		quiet, _ := req.Options[quietOptionName].(bool)
@@ -174,10 +230,12 @@ You can now check what blocks have been created by:
 		hashFunStr, _ := req.Options[hashOptionName].(string)
 		inline, _ := req.Options[inlineOptionName].(bool)
 		inlineLimit, _ := req.Options[inlineLimitOptionName].(int)
+		patchFrom, _ := req.Options[patchFromOptionName].(string)
+		manifest, _ := req.Options[manifestOptionName].(bool)
 
-		hashFunCode, ok := mh.Names[strings.ToLower(hashFunStr)]
-		if !ok {
-			return fmt.Errorf("unrecognized hash function: %s", strings.ToLower(hashFunStr))
+		hashFunCode, err := hashFunction(hashFunStr)
+		if err != nil {
+			return err
 		}
 
 		enc, err := cmdenv.GetCidEncoder(req)
@@ -221,23 +279,51 @@ You can now check what blocks have been created by:
 			opts = append(opts, options.Unixfs.Layout(options.TrickleLayout))
 		}
 
+		ctx := req.Context
+		var patch *coreunix.Patch
+		if patchFrom != "" {
+			if wrap {
+				return fmt.Errorf("--%s can't be used with --%s", patchFromOptionName, wrapOptionName)
+			}
+			nd, err := api.ResolveNode(req.Context, ipath.New(patchFrom))
+			if err != nil {
+				return err
+			}
+			patch, err = coreunix.NewPatch(req.Context, api.Dag(), nd)
+			if err != nil {
+				return fmt.Errorf("cannot patch from %s: %s", patchFrom, err)
+			}
+			ctx = coreunix.WithPatch(ctx, patch)
+		}
+
+		if manifest && hash {
+			return fmt.Errorf("--%s can't be used with --%s", manifestOptionName, onlyHashOptionName)
+		}
+
 		opts = append(opts, nil) // events option placeholder
 		addlog.Debug(" IN ADD =================================================    PANDIYAAaaaaaaaaaa")
 		var added int
 		addit := toadd.Entries()
 		for addit.Next() {
 			_, dir := addit.Node().(files.Directory)
+			if patch != nil && (dir || added > 0) {
+				return fmt.Errorf("--%s takes a single file", patchFromOptionName)
+			}
+			var root cid.Cid
 			errCh := make(chan error, 1)
 			events := make(chan interface{}, adderOutChanSize)
 			opts[len(opts)-1] = options.Unixfs.Events(events)
 			go func() {
 				var err error
 				defer close(events)
-				datap, err := api.Unixfs().Add(req.Context, addit.Node(), opts...)
-				addlog.Info("Pontiya ROOT $$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$    ", datap.Root().String())
-				addlog.Info("Pontiya CID $$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$    ", datap.Cid().String())
-				addlog.Info("Pontiya REMAINDER $$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$    ", datap.Remainder())
-				//addlog.Info("Pontiya PATH $$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$    ", datap.Path)
+				datap, err := api.Unixfs().Add(ctx, addit.Node(), opts...)
+				if err == nil {
+					addlog.Info("Pontiya ROOT $$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$    ", datap.Root().String())
+					addlog.Info("Pontiya CID $$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$    ", datap.Cid().String())
+					addlog.Info("Pontiya REMAINDER $$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$    ", datap.Remainder())
+					//addlog.Info("Pontiya PATH $$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$    ", datap.Path)
+					root = datap.Cid()
+				}
 				errCh <- err
 			}()
 
@@ -260,18 +346,36 @@ You can now check what blocks have been created by:
 				addlog.Info("Addd log   ADD it name  ", addit.Name())
 				addlog.Info("Addd log   output name  ", output.Name)
 				addlog.Info("Addd log   Hash  ", h)
-				if err := res.Emit(&AddEvent{
+				event := &AddEvent{
 					Name:  output.Name,
 					Hash:  h,
 					Bytes: output.Bytes,
 					Size:  output.Size,
-				}); err != nil {
+				}
+				if patch != nil && output.Path != nil {
+					event.ReusedBytes = patch.ReusedBytes
+					event.NewBytes = patch.NewBytes
+				}
+				if err := res.Emit(event); err != nil {
 					return err
 				}
 			}
 
 			if err := <-errCh; err != nil {
-				return err
+				return quotaError(err)
+			}
+
+			if manifest {
+				mc, err := addManifest(req.Context, api, root, dopin)
+				if err != nil {
+					return fmt.Errorf("failed to add the manifest of %s: %s", addit.Name(), err)
+				}
+				if err := res.Emit(&AddEvent{
+					Name:     addit.Name(),
+					Manifest: enc.Encode(mc),
+				}); err != nil {
+					return err
+				}
 			}
 			added++
 		}
@@ -339,6 +443,19 @@ You can now check what blocks have been created by:
 							break LOOP
 						}
 						output := out.(*AddEvent)
+						if len(output.Manifest) > 0 {
+							if progress {
+								fmt.Fprintf(os.Stderr, "\033[2K\r")
+							}
+							switch {
+							case quieter:
+							case quiet:
+								fmt.Fprintf(os.Stdout, "%s\n", output.Manifest)
+							default:
+								fmt.Fprintf(os.Stdout, "manifest %s %s\n", output.Manifest, output.Name)
+							}
+							continue
+						}
 						if len(output.Hash) > 0 {
 							lastHash = output.Hash
 							if quieter {
@@ -353,6 +470,9 @@ You can now check what blocks have been created by:
 								fmt.Fprintf(os.Stdout, "%s\n", output.Hash)
 							} else {
 								fmt.Fprintf(os.Stdout, "added %s %s\n", output.Hash, output.Name)
+								if output.ReusedBytes+output.NewBytes > 0 {
+									fmt.Fprintf(os.Stderr, "patched: %s reused, %s new\n", humanize.Bytes(output.ReusedBytes), humanize.Bytes(output.NewBytes))
+								}
 							}
 
 						} else {
@@ -0,0 +1,227 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	archive "github.com/ipfs/go-ipfs/core/archive"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	humanize "github.com/dustin/go-humanize"
+	cid "github.com/ipfs/go-cid"
+	cidenc "github.com/ipfs/go-cidutil/cidenc"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	archiveToOptionName    = "to"
+	archiveUnpinOptionName = "unpin"
+)
+
+// ArchiveReceipt is a receipt of an archiver, output by 'ipfs archive'.
+type ArchiveReceipt struct {
+	Root     string
+	Archiver string
+	ID       string
+	Size     uint64
+	Time     time.Time
+
+	// Unpinned is set when the root was unpinned once offloaded.
+	Unpinned bool `json:",omitempty"`
+}
+
+func newArchiveReceipt(enc cidenc.Encoder, r archive.Receipt) *ArchiveReceipt {
+	return &ArchiveReceipt{
+		Root:     enc.Encode(r.Root),
+		Archiver: r.Archiver,
+		ID:       r.ID,
+		Size:     r.Size,
+		Time:     r.Time,
+	}
+}
+
+var errNoArchiver = errors.New("no archiver: install an archiver plugin")
+
+var ArchiveCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Offload pins to long-term storage systems.",
+		ShortDescription: `
+'ipfs archive' hands the pins to external long-term storage systems, such as
+a Filecoin client or a tape archiver, added by archiver plugins. An archiver
+is handed the CAR file of the DAG of a pin, and returns the ID of its receipt,
+such as a deal ID. The receipts are recorded against the pins, and kept once
+they are unpinned.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"offload": archiveOffloadCmd,
+		"ls":      archiveLsCmd,
+	},
+}
+
+var archiveOffloadCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Hand the CAR files of pins to an archiver.",
+		ShortDescription: `
+'ipfs archive offload' writes the CAR file of the DAG of each pin given, from
+the local blocks, to the archiver named with --to, and records its receipt.
+--to can be left out when a single archiver is installed. With --unpin, a pin
+is removed once its CAR file is offloaded, for the garbage collection to free
+its blocks.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", true, true, "Path to the pins to offload.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(archiveToOptionName, "The archiver to hand the CAR files to."),
+		cmds.BoolOption(archiveUnpinOptionName, "Unpin the pins offloaded."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+		if err := req.ParseBodyArgs(); err != nil {
+			return err
+		}
+
+		name, _ := req.Options[archiveToOptionName].(string)
+		if name == "" {
+			switch names := archive.Names(); len(names) {
+			case 0:
+				return errNoArchiver
+			case 1:
+				name = names[0]
+			default:
+				return fmt.Errorf("--%s is required with several archivers: %s", archiveToOptionName, strings.Join(names, ", "))
+			}
+		}
+		if _, ok := archive.Get(name); !ok {
+			return fmt.Errorf("no archiver named %q", name)
+		}
+		unpin, _ := req.Options[archiveUnpinOptionName].(bool)
+
+		// the pinned blocks are local, a missing one is not fetched
+		offline, err := api.WithOptions(options.Api.Offline(true))
+		if err != nil {
+			return err
+		}
+		store := archive.NewStore(n.Repo.Datastore())
+
+		roots := make([]cid.Cid, 0, len(req.Arguments))
+		for _, arg := range req.Arguments {
+			rp, err := api.ResolvePath(req.Context, path.New(arg))
+			if err != nil {
+				return err
+			}
+			_, pinned, err := n.Pinning.IsPinned(req.Context, rp.Cid())
+			if err != nil {
+				return err
+			}
+			if !pinned {
+				return fmt.Errorf("%s is not pinned", arg)
+			}
+			roots = append(roots, rp.Cid())
+		}
+
+		for _, root := range roots {
+			r, err := store.Offload(req.Context, offline.Dag(), name, root)
+			if err != nil {
+				return fmt.Errorf("offloading %s: %s", enc.Encode(root), err)
+			}
+			out := newArchiveReceipt(enc, r)
+			if unpin {
+				if err := api.Pin().Rm(req.Context, path.IpfsPath(root)); err != nil {
+					return err
+				}
+				out.Unpinned = true
+			}
+			if err := res.Emit(out); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ArchiveReceipt) error {
+			fmt.Fprintf(w, "offloaded %s to %s: %s (%s)\n", out.Root, out.Archiver, out.ID, humanize.Bytes(out.Size))
+			if out.Unpinned {
+				fmt.Fprintf(w, "unpinned %s\n", out.Root)
+			}
+			return nil
+		}),
+	},
+	Type: ArchiveReceipt{},
+}
+
+var archiveLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the receipts of the pins offloaded.",
+		ShortDescription: `
+'ipfs archive ls' lists the receipts of the pins offloaded, with the archiver
+each was handed to, the ID of its receipt, the size of its CAR file and when
+it was offloaded. With a path, it lists the receipts of that pin only.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", false, false, "Path to the pin to list the receipts of."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		root := cid.Undef
+		if len(req.Arguments) > 0 {
+			api, err := cmdenv.GetApi(env, req)
+			if err != nil {
+				return err
+			}
+			rp, err := api.ResolvePath(req.Context, path.New(req.Arguments[0]))
+			if err != nil {
+				return err
+			}
+			root = rp.Cid()
+		}
+
+		receipts, err := archive.NewStore(n.Repo.Datastore()).Receipts(root)
+		if err != nil {
+			return err
+		}
+		out := make([]*ArchiveReceipt, 0, len(receipts))
+		for _, r := range receipts {
+			out = append(out, newArchiveReceipt(enc, r))
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out []*ArchiveReceipt) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			for _, r := range out {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Root, r.Archiver, r.ID, humanize.Bytes(r.Size), r.Time.Format(time.RFC3339))
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: []*ArchiveReceipt{},
+}
@@ -0,0 +1,403 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	backup "github.com/ipfs/go-ipfs/core/backup"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
+	mh "github.com/multiformats/go-multihash"
+)
+
+const (
+	backupClientOptionName = "client"
+	backupLabelOptionName  = "label"
+	backupFormatOptionName = "format"
+)
+
+// backupMaxBlockSize is the size of the largest block which can be uploaded,
+// the largest bitswap transfers.
+const backupMaxBlockSize = 2 << 20
+
+// backupPutBatch is the number of blocks stored at once by 'ipfs backup put'.
+const backupPutBatch = 256
+
+var errBackupDisabled = errors.New("the backup target mode is disabled, set Backup.Enabled to true in the config and restart the daemon")
+
+// BackupCommit is the output of 'ipfs backup commit'.
+type BackupCommit struct {
+	Snapshot *backup.Snapshot
+
+	// Removed are the snapshots removed by the retention of the label.
+	Removed []*backup.Snapshot
+}
+
+// BackupSnapshots is the output of 'ipfs backup ls'.
+type BackupSnapshots struct {
+	Snapshots []*backup.Snapshot
+}
+
+var BackupCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Use the node as a deduplicating backup store.",
+		ShortDescription: `
+In backup target mode, backup tools push their data to the node as chunks
+addressed by CID, uploading only the chunks the node doesn't have yet:
+
+  > ipfs backup missing <cid>...          # chunks to upload
+  > ipfs backup put --client=laptop <chunk>...
+  > ipfs backup commit --client=laptop --label=daily <root>
+
+The snapshot root is a DAG built by the tool, linking its chunks. Committed
+snapshots are pinned, and blocks missing locally are fetched from the other
+nodes of the network, so chunks uploaded to another node of a private
+network are not uploaded again.
+
+Snapshots are kept per client. The Backup.Retention config maps labels to the
+number of snapshots kept per client with that label; older ones are removed
+when a new one is committed:
+
+  > ipfs config --json Backup.Retention '{"daily": 7, "weekly": 4}'
+
+The backup target mode is enabled with the Backup.Enabled config.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"missing": backupMissingCmd,
+		"put":     backupPutCmd,
+		"commit":  backupCommitCmd,
+		"abort":   backupAbortCmd,
+		"ls":      backupLsCmd,
+		"rm":      backupRmCmd,
+	},
+}
+
+// getBackup returns the backup store of the node.
+func getBackup(env cmds.Environment) (*backup.Store, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.Backup == nil {
+		return nil, errBackupDisabled
+	}
+	return n.Backup, nil
+}
+
+// backupClient returns the --client option, which is required.
+func backupClient(req *cmds.Request) (string, error) {
+	client, _ := req.Options[backupClientOptionName].(string)
+	if client == "" {
+		return "", fmt.Errorf("the --%s option is required", backupClientOptionName)
+	}
+	return client, backup.CheckName(client)
+}
+
+var backupClientOption = cmds.StringOption(backupClientOptionName, "c", "Name of the backup client.")
+
+var backupMissingCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the chunks the node doesn't have.",
+		ShortDescription: `
+'ipfs backup missing' prints the given CIDs of the blocks which are not stored
+by the node, and need to be uploaded. Blocks stored by other nodes of the
+network are listed too; they can be left out of the upload, and are fetched
+when the snapshot is committed.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("cid", true, true, "CIDs of the chunks.").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getBackup(env)
+		if err != nil {
+			return err
+		}
+
+		cids := make([]cid.Cid, 0, len(req.Arguments))
+		for _, s := range req.Arguments {
+			c, err := cid.Decode(s)
+			if err != nil {
+				return fmt.Errorf("invalid CID %q: %s", s, err)
+			}
+			cids = append(cids, c)
+		}
+
+		missing, err := store.Missing(cids)
+		if err != nil {
+			return err
+		}
+
+		out := make([]string, len(missing))
+		for i, c := range missing {
+			out[i] = c.String()
+		}
+		return cmds.EmitOnce(res, &stringList{out})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(stringListEncoder),
+	},
+	Type: stringList{},
+}
+
+var backupPutCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Upload chunks.",
+		ShortDescription: `
+'ipfs backup put' stores each input as a block, and prints its CID. The blocks
+are kept for the client until its next commit, even if not pinned otherwise.
+
+The CIDs are version 1, with the given codec and sha2-256.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.FileArg("data", true, true, "The chunks to upload.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		backupClientOption,
+		cmds.StringOption(backupFormatOptionName, "f", "Codec of the CIDs of the chunks.").WithDefault("raw"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getBackup(env)
+		if err != nil {
+			return err
+		}
+		client, err := backupClient(req)
+		if err != nil {
+			return err
+		}
+
+		format, _ := req.Options[backupFormatOptionName].(string)
+		codec, ok := cid.Codecs[format]
+		if !ok {
+			return fmt.Errorf("unrecognized codec: %s", format)
+		}
+		prefix := cid.Prefix{Version: 1, Codec: codec, MhType: mh.SHA2_256, MhLength: -1}
+
+		var batch []blocks.Block
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			if err := store.Put(req.Context, client, batch); err != nil {
+				return err
+			}
+			for _, b := range batch {
+				if err := res.Emit(&BlockStat{Key: b.Cid().String(), Size: len(b.RawData())}); err != nil {
+					return err
+				}
+			}
+			batch = batch[:0]
+			return nil
+		}
+
+		it := req.Files.Entries()
+		for it.Next() {
+			file := files.FileFromEntry(it)
+			if file == nil {
+				return errors.New("expected a file")
+			}
+
+			data, err := ioutil.ReadAll(io.LimitReader(file, backupMaxBlockSize+1))
+			if err != nil {
+				return err
+			}
+			if len(data) > backupMaxBlockSize {
+				return fmt.Errorf("%s: chunks are limited to %d bytes", it.Name(), backupMaxBlockSize)
+			}
+
+			c, err := prefix.Sum(data)
+			if err != nil {
+				return err
+			}
+			b, err := blocks.NewBlockWithCid(data, c)
+			if err != nil {
+				return err
+			}
+
+			if batch = append(batch, b); len(batch) == backupPutBatch {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+		return flush()
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, bs *BlockStat) error {
+			_, err := fmt.Fprintf(w, "%s\n", bs.Key)
+			return err
+		}),
+	},
+	Type: BlockStat{},
+}
+
+var backupCommitCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Commit a snapshot.",
+		ShortDescription: `
+'ipfs backup commit' records the given root as a new snapshot of the client,
+with the given retention label, and pins it. Blocks of the snapshot missing
+locally are fetched from the network. The snapshots of the client with the
+same label exceeding the retention of the label are then removed, and listed.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, false, "CID of the root of the snapshot."),
+	},
+	Options: []cmds.Option{
+		backupClientOption,
+		cmds.StringOption(backupLabelOptionName, "l", "Retention label of the snapshot.").WithDefault("default"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getBackup(env)
+		if err != nil {
+			return err
+		}
+		client, err := backupClient(req)
+		if err != nil {
+			return err
+		}
+
+		root, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		label, _ := req.Options[backupLabelOptionName].(string)
+
+		snap, removed, err := store.Commit(req.Context, client, label, root)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &BackupCommit{Snapshot: snap, Removed: removed})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *BackupCommit) error {
+			fmt.Fprintf(w, "committed snapshot %d of %s: %s\n", out.Snapshot.Seq, out.Snapshot.Client, out.Snapshot.Root)
+			for _, snap := range out.Removed {
+				fmt.Fprintf(w, "removed snapshot %d of %s: %s\n", snap.Seq, snap.Client, snap.Root)
+			}
+			return nil
+		}),
+	},
+	Type: BackupCommit{},
+}
+
+var backupAbortCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Release the chunks uploaded since the last commit.",
+		ShortDescription: `
+'ipfs backup abort' stops keeping the chunks uploaded by the client since its
+last commit. They are removed by the next garbage collection unless pinned
+otherwise.
+`,
+	},
+	Options: []cmds.Option{
+		backupClientOption,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getBackup(env)
+		if err != nil {
+			return err
+		}
+		client, err := backupClient(req)
+		if err != nil {
+			return err
+		}
+		return store.Abort(req.Context, client)
+	},
+}
+
+var backupLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the snapshots.",
+		ShortDescription: `
+'ipfs backup ls' lists the snapshots of the client, or of every client, latest
+first.
+`,
+	},
+	Options: []cmds.Option{
+		backupClientOption,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getBackup(env)
+		if err != nil {
+			return err
+		}
+
+		client, _ := req.Options[backupClientOptionName].(string)
+		snaps, err := store.Snapshots(client)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &BackupSnapshots{Snapshots: snaps})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *BackupSnapshots) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			for _, snap := range out.Snapshots {
+				fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", snap.Client, snap.Seq, snap.Label, snap.Created.Format(time.RFC3339), snap.Root)
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: BackupSnapshots{},
+}
+
+var backupRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove a snapshot.",
+		ShortDescription: `
+'ipfs backup rm' removes the snapshot of the client with the given number, and
+unpins it unless another snapshot has the same root. Its blocks are removed by
+the next garbage collection unless used otherwise.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("snapshot", true, false, "Number of the snapshot."),
+	},
+	Options: []cmds.Option{
+		backupClientOption,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getBackup(env)
+		if err != nil {
+			return err
+		}
+		client, err := backupClient(req)
+		if err != nil {
+			return err
+		}
+
+		seq, err := strconv.ParseUint(req.Arguments[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid snapshot number %q", req.Arguments[0])
+		}
+
+		snap, err := store.Remove(req.Context, client, seq)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, snap)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, snap *backup.Snapshot) error {
+			_, err := fmt.Fprintf(w, "removed snapshot %d of %s: %s\n", snap.Seq, snap.Client, snap.Root)
+			return err
+		}),
+	},
+	Type: backup.Snapshot{},
+}
@@ -0,0 +1,337 @@
+package commands
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	mrand "math/rand"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	version "github.com/ipfs/go-ipfs"
+	core "github.com/ipfs/go-ipfs/core"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
+	u "github.com/ipfs/go-ipfs-util"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	benchSuiteOptionName    = "suite"
+	benchSizeOptionName     = "size"
+	benchRunsOptionName     = "runs"
+	benchChunkersOptionName = "chunkers"
+
+	// benchLookupTimeout bounds a single DHT lookup.
+	benchLookupTimeout = time.Minute
+)
+
+// BenchResult holds the measurements of a single benchmark.
+type BenchResult struct {
+	Suite string
+	Name  string
+	Runs  int
+
+	// Bytes is the amount of data processed per run, if relevant.
+	Bytes uint64 `json:",omitempty"`
+
+	Mean time.Duration
+	Min  time.Duration
+	Max  time.Duration
+
+	// Throughput is in bytes per second, computed from Mean.
+	Throughput float64 `json:",omitempty"`
+
+	Error string `json:",omitempty"`
+}
+
+// BenchReport is the output of 'ipfs bench'.
+type BenchReport struct {
+	Version string
+	Commit  string
+	System  string
+	Golang  string
+	Results []BenchResult
+}
+
+var BenchCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Run built-in performance benchmarks.",
+		ShortDescription: `
+'ipfs bench' measures the performance of common operations on this node and
+prints comparable results, so that regressions between releases can be
+measured in the field.
+`,
+		LongDescription: `
+'ipfs bench' measures the performance of common operations on this node and
+prints comparable results, so that regressions between releases can be
+measured in the field. Use '--enc=json' to store and compare the results.
+
+The available suites are:
+
+  add   Add --size bytes of pseudo-random data with each of --chunkers.
+  cat   Read back the data added by the 'add' suite from the local node, and
+        read each path given as argument once, usually from remote peers.
+  dht   Look up the closest peers to random keys in the DHT.
+  gc    Run a garbage collection. This removes every unpinned block from
+        the repo, it is therefore only run when requested explicitly.
+
+The benchmark data is the same on every run and every node, and is not pinned.
+
+Example:
+
+    > ipfs bench --suite add,cat --size 64MiB --runs 5 --enc=json
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("remote-path", false, true, "Paths to read once in the 'cat' suite."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(benchSuiteOptionName, "s", "Comma-separated list of suites to run.").WithDefault("add,cat,dht"),
+		cmds.StringOption(benchSizeOptionName, "Size of the data added and read.").WithDefault("16MiB"),
+		cmds.IntOption(benchRunsOptionName, "n", "Number of runs of each benchmark.").WithDefault(3),
+		cmds.StringOption(benchChunkersOptionName, "Comma-separated list of chunkers used by the 'add' suite.").WithDefault("size-262144,rabin"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		sizeS, _ := req.Options[benchSizeOptionName].(string)
+		size, err := humanize.ParseBytes(sizeS)
+		if err != nil {
+			return err
+		}
+		runs, _ := req.Options[benchRunsOptionName].(int)
+		if runs <= 0 {
+			return fmt.Errorf("number of runs must be greater than 0, was %d", runs)
+		}
+		suitesS, _ := req.Options[benchSuiteOptionName].(string)
+		chunkersS, _ := req.Options[benchChunkersOptionName].(string)
+
+		b := &bencher{
+			ctx:      req.Context,
+			node:     n,
+			api:      api,
+			runs:     runs,
+			size:     size,
+			chunkers: strings.Split(chunkersS, ","),
+		}
+
+		for _, suite := range strings.Split(suitesS, ",") {
+			switch suite {
+			case "add":
+				b.benchAdd()
+			case "cat":
+				b.benchCat(req.Arguments)
+			case "dht":
+				b.benchDHT()
+			case "gc":
+				b.benchGC()
+			default:
+				return fmt.Errorf("unknown benchmark suite %q", suite)
+			}
+			if err := req.Context.Err(); err != nil {
+				return err
+			}
+		}
+
+		return cmds.EmitOnce(res, &BenchReport{
+			Version: version.CurrentVersionNumber,
+			Commit:  version.CurrentCommit,
+			System:  runtime.GOARCH + "/" + runtime.GOOS,
+			Golang:  runtime.Version(),
+			Results: b.results,
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *BenchReport) error {
+			fmt.Fprintf(w, "go-ipfs %s-%s %s %s\n\n", out.Version, out.Commit, out.System, out.Golang)
+
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "SUITE\tNAME\tRUNS\tMEAN\tMIN\tMAX\tTHROUGHPUT\t")
+			for _, r := range out.Results {
+				if r.Error != "" {
+					fmt.Fprintf(tw, "%s\t%s\t%d\terror: %s\n", r.Suite, r.Name, r.Runs, r.Error)
+					continue
+				}
+				throughput := "-"
+				if r.Throughput > 0 {
+					throughput = humanize.Bytes(uint64(r.Throughput)) + "/s"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t\n", r.Suite, r.Name, r.Runs, r.Mean, r.Min, r.Max, throughput)
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: BenchReport{},
+}
+
+type bencher struct {
+	ctx      context.Context
+	node     *core.IpfsNode
+	api      coreiface.CoreAPI
+	runs     int
+	size     uint64
+	chunkers []string
+
+	// added holds the path of the data added by the 'add' suite.
+	added path.Resolved
+
+	results []BenchResult
+}
+
+// measure runs f the given number of times and records the result.
+func (b *bencher) measure(suite, name string, runs int, bytes uint64, f func() error) {
+	r := BenchResult{Suite: suite, Name: name, Bytes: bytes}
+
+	var total time.Duration
+	for i := 0; i < runs; i++ {
+		start := time.Now()
+		if err := f(); err != nil {
+			r.Error = err.Error()
+			break
+		}
+		d := time.Since(start)
+
+		total += d
+		if r.Runs == 0 || d < r.Min {
+			r.Min = d
+		}
+		if d > r.Max {
+			r.Max = d
+		}
+		r.Runs++
+	}
+
+	if r.Runs > 0 {
+		r.Mean = total / time.Duration(r.Runs)
+		if bytes > 0 && r.Mean > 0 {
+			r.Throughput = float64(bytes) / r.Mean.Seconds()
+		}
+	}
+	b.results = append(b.results, r)
+}
+
+// benchData returns the data used by the add and cat suites. It only depends
+// on the requested size so that results are comparable between nodes.
+func (b *bencher) benchData() []byte {
+	data := make([]byte, b.size)
+	mrand.New(mrand.NewSource(1)).Read(data)
+	return data
+}
+
+func (b *bencher) benchAdd() {
+	data := b.benchData()
+	for _, chunker := range b.chunkers {
+		b.measure("add", chunker, b.runs, b.size, func() error {
+			p, err := b.api.Unixfs().Add(b.ctx, files.NewBytesFile(data),
+				options.Unixfs.Chunker(chunker),
+				options.Unixfs.Pin(false),
+			)
+			if err == nil && b.added == nil {
+				b.added = p
+			}
+			return err
+		})
+	}
+}
+
+func (b *bencher) benchCat(remote []string) {
+	if b.added == nil {
+		data := b.benchData()
+		p, err := b.api.Unixfs().Add(b.ctx, files.NewBytesFile(data), options.Unixfs.Pin(false))
+		if err != nil {
+			b.results = append(b.results, BenchResult{Suite: "cat", Name: "local", Error: err.Error()})
+			return
+		}
+		b.added = p
+	}
+
+	b.measure("cat", "local", b.runs, b.size, func() error {
+		_, err := b.cat(b.added)
+		return err
+	})
+
+	// Remote paths are only read once: after the first run, the blocks are
+	// stored locally.
+	for _, s := range remote {
+		var read uint64
+		b.measure("cat", s, 1, 0, func() error {
+			var err error
+			read, err = b.cat(path.New(s))
+			return err
+		})
+		last := &b.results[len(b.results)-1]
+		last.Bytes = read
+		if read > 0 && last.Mean > 0 {
+			last.Throughput = float64(read) / last.Mean.Seconds()
+		}
+	}
+}
+
+func (b *bencher) cat(p path.Path) (uint64, error) {
+	nd, err := b.api.Unixfs().Get(b.ctx, p)
+	if err != nil {
+		return 0, err
+	}
+	defer nd.Close()
+
+	f := files.ToFile(nd)
+	if f == nil {
+		return 0, fmt.Errorf("%s is not a file", p)
+	}
+	n, err := io.Copy(ioutil.Discard, f)
+	return uint64(n), err
+}
+
+func (b *bencher) benchDHT() {
+	if b.node.DHT == nil {
+		b.results = append(b.results, BenchResult{Suite: "dht", Name: "closest-peers", Error: "DHT not available"})
+		return
+	}
+
+	b.measure("dht", "closest-peers", b.runs, 0, func() error {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(b.ctx, benchLookupTimeout)
+		defer cancel()
+
+		peers, err := b.node.DHT.GetClosestPeers(ctx, string(u.Hash(key)))
+		if err != nil {
+			return err
+		}
+		found := 0
+		for range peers {
+			found++
+		}
+		if found == 0 {
+			return fmt.Errorf("no peers found")
+		}
+		return ctx.Err()
+	})
+}
+
+func (b *bencher) benchGC() {
+	b.measure("gc", "full", 1, 0, func() error {
+		return corerepo.GarbageCollect(b.node, b.ctx)
+	})
+}
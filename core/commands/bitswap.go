@@ -3,7 +3,10 @@ package commands
 import (
 	"fmt"
 	"io"
+	"sort"
+	"time"
 
+	bssession "github.com/ipfs/go-ipfs/core/bssession"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
 
@@ -22,10 +25,14 @@ var BitswapCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"stat":      bitswapStatCmd,
-		"wantlist":  showWantlistCmd,
-		"ledger":    ledgerCmd,
-		"reprovide": reprovideCmd,
+		"stat":         bitswapStatCmd,
+		"wantlist":     showWantlistCmd,
+		"ledger":       ledgerCmd,
+		"ledger-reset": ledgerResetCmd,
+		"limit":        bitswapLimitCmd,
+		"qos":          bitswapQoSCmd,
+		"reprovide":    reprovideCmd,
+		"sessions":     bitswapSessionsCmd,
 	},
 }
 
@@ -173,7 +180,8 @@ var ledgerCmd = &cmds.Command{
 		ShortDescription: `
 The Bitswap decision engine tracks the number of bytes exchanged between IPFS
 nodes, and stores this information as a collection of ledgers. This command
-prints the ledger associated with a given peer.
+prints the ledger associated with a given peer, counted from its last reset
+with 'ipfs bitswap ledger-reset'.
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -200,7 +208,7 @@ prints the ledger associated with a given peer.
 			return err
 		}
 
-		return cmds.EmitOnce(res, bs.LedgerForPeer(partner))
+		return cmds.EmitOnce(res, nd.BitswapPeers.Ledger(bs.LedgerForPeer(partner)))
 	},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *decision.Receipt) error {
@@ -216,6 +224,176 @@ prints the ledger associated with a given peer.
 	},
 }
 
+var ledgerResetCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Reset the ledger for a peer.",
+		ShortDescription: `
+'ipfs bitswap ledger-reset' starts counting the ledger of a peer anew, as
+shown by 'ipfs bitswap ledger'. The ledgers of the decision engine itself are
+kept, so the reset doesn't change the blocks the engine sends to the peer, and
+it lasts until the daemon restarts.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer", true, false, "The PeerID (B58) of the ledger to reset."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !nd.IsOnline || nd.BitswapPeers == nil {
+			return ErrNotOnline
+		}
+
+		bs, ok := nd.Exchange.(*bitswap.Bitswap)
+		if !ok {
+			return e.TypeErr(bs, nd.Exchange)
+		}
+
+		partner, err := peer.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		return nd.BitswapPeers.ResetLedger(bs.LedgerForPeer(partner))
+	},
+}
+
+// BitswapLimit is the send limit of a peer, in bytes per second.
+type BitswapLimit struct {
+	Peer string
+	Rate uint64
+}
+
+var bitswapLimitCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Limit the rate of the blocks sent to a peer.",
+		ShortDescription: `
+'ipfs bitswap limit <peer> <rate>' caps the rate at which bitswap sends blocks
+to a peer, so that a single peer can't take all the upload bandwidth of the
+node. The rate is in bytes per second, with an optional unit, as in "1MB" or
+"512KiB". A rate of 0 removes the limit of the peer.
+
+Without arguments, it lists the limited peers. The limits are kept across
+restarts.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer", false, false, "The PeerID (B58) of the peer to limit."),
+		cmds.StringArg("rate", false, false, "The rate in bytes per second, or 0 to remove the limit."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !nd.IsOnline || nd.BitswapPeers == nil {
+			return ErrNotOnline
+		}
+
+		switch len(req.Arguments) {
+		case 0:
+		case 2:
+			p, err := peer.Decode(req.Arguments[0])
+			if err != nil {
+				return err
+			}
+			rate, err := humanize.ParseBytes(req.Arguments[1])
+			if err != nil {
+				return fmt.Errorf("invalid rate %q: %s", req.Arguments[1], err)
+			}
+			return nd.BitswapPeers.SetLimit(p, rate)
+		default:
+			return fmt.Errorf("expected a peer and a rate")
+		}
+
+		limits := nd.BitswapPeers.Limits()
+		out := make([]BitswapLimit, 0, len(limits))
+		for p, rate := range limits {
+			out = append(out, BitswapLimit{Peer: p.Pretty(), Rate: rate})
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Peer < out[j].Peer })
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out []BitswapLimit) error {
+			for _, l := range out {
+				fmt.Fprintf(w, "%s\t%s/s\n", l.Peer, humanize.Bytes(l.Rate))
+			}
+			return nil
+		}),
+	},
+	Type: []BitswapLimit{},
+}
+
+var bitswapSessionsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the active bitswap sessions.",
+		ShortDescription: `
+'ipfs bitswap sessions' lists the active bitswap sessions. A session fetches
+the blocks of a single request, such as 'ipfs get', from the peers which had
+its first blocks. For each session, it shows how long it has been running,
+the blocks it waits for, the blocks received and from which peers, and the
+duplicate blocks received, which were sent by more than one peer.
+
+With --verbose, the wantlist of each session is listed.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(bitswapVerboseOptionName, "v", "Print the wantlists"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !nd.IsOnline || nd.BitswapSess == nil {
+			return ErrNotOnline
+		}
+
+		return cmds.EmitOnce(res, nd.BitswapSess.Sessions())
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out []bssession.Stat) error {
+			enc, err := cmdenv.GetLowLevelCidEncoder(req)
+			if err != nil {
+				return err
+			}
+			verbose, _ := req.Options[bitswapVerboseOptionName].(bool)
+
+			for _, s := range out {
+				fmt.Fprintf(w, "session %d (%s)\n", s.ID, time.Since(s.Started).Round(time.Second))
+				fmt.Fprintf(w, "\tblocks received: %d\n", s.BlocksReceived)
+				fmt.Fprintf(w, "\tdup blocks received: %d\n", s.DupBlocks)
+				fmt.Fprintf(w, "\twantlist [%d keys]\n", len(s.Wantlist))
+				if verbose {
+					for _, k := range s.Wantlist {
+						fmt.Fprintf(w, "\t\t%s\n", enc.Encode(k))
+					}
+				}
+
+				peers := make([]string, 0, len(s.Peers))
+				for p := range s.Peers {
+					peers = append(peers, p)
+				}
+				sort.Slice(peers, func(i, j int) bool {
+					return s.Peers[peers[i]] > s.Peers[peers[j]]
+				})
+				fmt.Fprintf(w, "\tpeers [%d]\n", len(peers))
+				for _, p := range peers {
+					fmt.Fprintf(w, "\t\t%s %d blocks\n", p, s.Peers[p])
+				}
+			}
+			return nil
+		}),
+	},
+	Type: []bssession.Stat{},
+}
+
 var reprovideCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Trigger reprovider.",
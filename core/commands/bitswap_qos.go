@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	qos "github.com/ipfs/go-ipfs/core/qos"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// BitswapQoSOutput is the output of 'ipfs bitswap qos'.
+type BitswapQoSOutput struct {
+	Classes []qos.ClassStats `json:",omitempty"`
+	Peers   []BitswapQoSPeer `json:",omitempty"`
+}
+
+// BitswapQoSPeer is the class of a peer.
+type BitswapQoSPeer struct {
+	Peer  string
+	Class string
+}
+
+var errQoSDisabled = errors.New("QoS is not configured, QoS.Bandwidth is not set")
+
+var bitswapQoSCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the QoS classes sharing the serving bandwidth.",
+		ShortDescription: `
+'ipfs bitswap qos' lists the QoS classes configured in the QoS section of the
+config, which share the bandwidth the node serves blocks at, over bitswap and
+the gateway. For each class, it shows its priority and its share, the fraction
+of the recent traffic it got, the bytes sent to its peers, and how many sends
+waited for the bandwidth and how long.
+
+With peers as arguments, it shows the class of each peer instead.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer", false, true, "The PeerIDs (B58) of the peers to classify."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !nd.IsOnline {
+			return ErrNotOnline
+		}
+		if nd.QoS == nil {
+			return errQoSDisabled
+		}
+
+		if len(req.Arguments) == 0 {
+			return cmds.EmitOnce(res, &BitswapQoSOutput{Classes: nd.QoS.Classes()})
+		}
+		out := &BitswapQoSOutput{}
+		for _, arg := range req.Arguments {
+			p, err := peer.Decode(arg)
+			if err != nil {
+				return err
+			}
+			out.Peers = append(out.Peers, BitswapQoSPeer{Peer: p.Pretty(), Class: nd.QoS.Class(p)})
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *BitswapQoSOutput) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			if len(out.Peers) > 0 {
+				for _, p := range out.Peers {
+					fmt.Fprintf(tw, "%s\t%s\n", p.Peer, p.Class)
+				}
+				return tw.Flush()
+			}
+			fmt.Fprintln(tw, "Class\tPriority\tShare\tUsage\tSent\tWaits\tWait Time")
+			for _, c := range out.Classes {
+				fmt.Fprintf(tw, "%s\t%d\t%.0f%%\t%.0f%%\t%s\t%d\t%s\n", c.Name, c.Priority, c.Share*100, c.Usage*100,
+					humanize.Bytes(c.BytesSent), c.Waits, c.WaitTime)
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: BitswapQoSOutput{},
+}
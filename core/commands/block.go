@@ -179,7 +179,7 @@ other than 'sha2-256' or format to anything other than 'v0' will result in CIDv1
 				options.Block.Format(format),
 				options.Block.Pin(pin))
 			if err != nil {
-				return err
+				return quotaError(err)
 			}
 
 			err = res.Emit(&BlockStat{
@@ -32,6 +32,7 @@ var CatCmd = &cmds.Command{
 	Options: []cmds.Option{
 		cmds.Int64Option(offsetOptionName, "o", "Byte offset to begin reading from."),
 		cmds.Int64Option(lengthOptionName, "l", "Maximum number of bytes to read."),
+		preferPeerOption,
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -57,6 +58,13 @@ var CatCmd = &cmds.Command{
 		if err != nil {
 			return err
 		}
+
+		release, err := preferPeers(req, env)
+		if err != nil {
+			return err
+		}
+		defer release()
+
 		log.Info("IPFS CAT PATH    ==================     ", req.Arguments)
 		readers, length, err := cat(req.Context, api, req.Arguments, int64(offset), int64(max))
 		if err != nil {
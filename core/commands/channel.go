@@ -0,0 +1,293 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	channel "github.com/ipfs/go-ipfs/core/channel"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+var errChannelsDisabled = errors.New("channels use the experimental pubsub feature. Run daemon with --enable-pubsub-experiment to use.")
+
+const channelKeepOptionName = "keep"
+
+// ChannelSubscriptions is the output of 'ipfs channel ls'.
+type ChannelSubscriptions struct {
+	Subscriptions []channel.Subscription
+}
+
+// ChannelHistory is the output of 'ipfs channel history'.
+type ChannelHistory struct {
+	Revisions []*channel.Revision
+}
+
+var ChannelCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Publish and follow versions of a dataset.",
+		ShortDescription: `
+A channel distributes the versions of a dataset over pubsub. The publisher
+broadcasts the root CID of every new version, signed with the key of the
+channel; subscribers pin the latest versions as they are published, and
+unpin the older ones.
+
+  > ipfs channel create releases
+  12D3KooW...
+  > ipfs channel publish releases /ipfs/QmDataset
+  published revision 1 of 12D3KooW...: QmDataset
+
+On the subscribers:
+
+  > ipfs channel subscribe --keep=2 12D3KooW...
+
+Channels require the daemon to run with --enable-pubsub-experiment.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"create":      channelCreateCmd,
+		"publish":     channelPublishCmd,
+		"subscribe":   channelSubscribeCmd,
+		"unsubscribe": channelUnsubscribeCmd,
+		"ls":          channelLsCmd,
+		"history":     channelHistoryCmd,
+	},
+}
+
+// getChannels returns the node and its channel service.
+func getChannels(env cmds.Environment) (*core.IpfsNode, *channel.Service, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !n.IsOnline {
+		return nil, nil, ErrNotOnline
+	}
+	if n.Channels == nil {
+		return nil, nil, errChannelsDisabled
+	}
+	return n, n.Channels, nil
+}
+
+var channelCreateCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Create a channel.",
+		ShortDescription: `
+'ipfs channel create' generates the key of a new channel, and prints the ID
+of the channel, which subscribers follow. The key is stored in the keystore
+under the given name, which is then used to publish to the channel.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of the channel key."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		key, err := api.Key().Generate(req.Context, req.Arguments[0], options.Key.Type(options.Ed25519Key))
+		if err != nil {
+			return err
+		}
+
+		return cmds.EmitOnce(res, &KeyOutput{
+			Name: key.Name(),
+			Id:   key.ID().Pretty(),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *KeyOutput) error {
+			_, err := fmt.Fprintln(w, out.Id)
+			return err
+		}),
+	},
+	Type: KeyOutput{},
+}
+
+var channelPublishCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Publish a version of a dataset to a channel.",
+		ShortDescription: `
+'ipfs channel publish' broadcasts the root CID of the given path as the next
+revision of the channel. The dataset must stay available on the network, e.g.
+pinned on the publisher, until subscribers have fetched it.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of the channel key."),
+		cmds.StringArg("ipfs-path", true, false, "Path of the dataset to publish."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		_, channels, err := getChannels(env)
+		if err != nil {
+			return err
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		rp, err := api.ResolvePath(req.Context, path.New(req.Arguments[1]))
+		if err != nil {
+			return err
+		}
+
+		r, err := channels.Publish(req.Context, req.Arguments[0], rp.Cid())
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, r)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *channel.Revision) error {
+			_, err := fmt.Fprintf(w, "published revision %d of %s: %s\n", out.Seq, out.Channel, out.Root)
+			return err
+		}),
+	},
+	Type: channel.Revision{},
+}
+
+var channelSubscribeCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Follow a channel.",
+		ShortDescription: `
+'ipfs channel subscribe' follows the channel with the given ID: the latest
+revisions published to the channel are pinned, and older ones unpinned. The
+subscription is saved, and restored when the daemon restarts.
+
+Subscribing again to a channel changes the number of revisions pinned.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("channel", true, false, "ID of the channel."),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption(channelKeepOptionName, "k", "Number of revisions to keep pinned.").WithDefault(channel.DefaultKeep),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, channels, err := getChannels(env)
+		if err != nil {
+			return err
+		}
+
+		id, err := channel.ParseChannel(n.Repo.Keystore(), req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		keep, _ := req.Options[channelKeepOptionName].(int)
+		if err := channels.Subscribe(id, keep); err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &channel.Subscription{Channel: id.Pretty(), Keep: keep})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *channel.Subscription) error {
+			_, err := fmt.Fprintf(w, "subscribed to %s, keeping %d revisions pinned\n", out.Channel, out.Keep)
+			return err
+		}),
+	},
+	Type: channel.Subscription{},
+}
+
+var channelUnsubscribeCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stop following a channel.",
+		ShortDescription: `
+'ipfs channel unsubscribe' stops following the channel, and unpins the
+revisions pinned for it. Revisions which were already pinned before being
+received stay pinned.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("channel", true, false, "ID of the channel."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, channels, err := getChannels(env)
+		if err != nil {
+			return err
+		}
+
+		id, err := channel.ParseChannel(n.Repo.Keystore(), req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		return channels.Unsubscribe(req.Context, id)
+	},
+}
+
+var channelLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the channels followed.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		_, channels, err := getChannels(env)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &ChannelSubscriptions{Subscriptions: channels.Subscriptions()})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ChannelSubscriptions) error {
+			for _, sub := range out.Subscriptions {
+				fmt.Fprintf(w, "%s\t%d\n", sub.Channel, sub.Keep)
+			}
+			return nil
+		}),
+	},
+	Type: ChannelSubscriptions{},
+}
+
+var channelHistoryCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the revisions of a channel.",
+		ShortDescription: `
+'ipfs channel history' lists the revisions of a channel published or received
+by this node, latest first, and whether they are pinned for the channel. The
+channel is given by ID, or by key name for the channels of this node.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("channel", true, false, "ID or key name of the channel."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, channels, err := getChannels(env)
+		if err != nil {
+			return err
+		}
+
+		id, err := channel.ParseChannel(n.Repo.Keystore(), req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		revs, err := channels.History(id)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &ChannelHistory{Revisions: revs})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ChannelHistory) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			for _, r := range out.Revisions {
+				pinned := ""
+				if r.Pinned {
+					pinned = "pinned"
+				}
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t\n", r.Seq, r.Published.Format(time.RFC3339), r.Root, pinned)
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: ChannelHistory{},
+}
@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	chaos "github.com/ipfs/go-ipfs/core/chaos"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	chaosDropStreamsOptionName   = "drop-streams"
+	chaosLatencyOptionName       = "latency"
+	chaosPeerOptionName          = "peer"
+	chaosCorruptBlocksOptionName = "corrupt-blocks"
+	chaosResetOptionName         = "reset"
+)
+
+// ChaosOutput is the output of 'ipfs diag chaos'.
+type ChaosOutput struct {
+	Settings chaos.Settings
+	Stats    chaos.Stats
+}
+
+var errChaosDisabled = errors.New("fault injection is disabled, set Chaos.Enabled to true in the config and restart the daemon")
+
+var chaosDiagCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Inject faults into the node for resilience testing.",
+		ShortDescription: `
+'ipfs diag chaos' shows and changes the faults injected into the node: reset
+streams, added stream latency and corrupted block reads. Without options, it
+prints the current settings and how many faults were injected so far.
+`,
+		LongDescription: `
+'ipfs diag chaos' shows and changes the faults injected into the node: reset
+streams, added stream latency and corrupted block reads. Without options, it
+prints the current settings and how many faults were injected so far.
+
+Fault injection must be enabled in the config before the daemon starts:
+
+    > ipfs config --json Chaos.Enabled true
+
+Only the given options are changed. --latency applies to all peers, or only
+to the peer given with --peer. Setting a peer latency of 0 removes the
+override. --reset disables every fault.
+
+DO NOT enable this on a node serving real users.
+
+Example:
+
+    > ipfs diag chaos --drop-streams 0.1 --corrupt-blocks 0.01
+    > ipfs diag chaos --latency 200ms --peer QmPeer...
+`,
+	},
+	Options: []cmds.Option{
+		cmds.FloatOption(chaosDropStreamsOptionName, "Probability (0-1) that a new stream is reset."),
+		cmds.StringOption(chaosLatencyOptionName, "Latency added to new streams, e.g. '100ms'."),
+		cmds.StringOption(chaosPeerOptionName, "Apply --latency to this peer only."),
+		cmds.FloatOption(chaosCorruptBlocksOptionName, "Probability (0-1) that a block read is corrupted."),
+		cmds.BoolOption(chaosResetOptionName, "Disable every fault."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		inj := n.Chaos
+		if inj == nil {
+			return errChaosDisabled
+		}
+
+		s := inj.Settings()
+		if reset, _ := req.Options[chaosResetOptionName].(bool); reset {
+			s = chaos.Settings{}
+		}
+		if rate, ok := req.Options[chaosDropStreamsOptionName].(float64); ok {
+			s.DropStreams = rate
+		}
+		if rate, ok := req.Options[chaosCorruptBlocksOptionName].(float64); ok {
+			s.CorruptBlocks = rate
+		}
+
+		pstr, hasPeer := req.Options[chaosPeerOptionName].(string)
+		if latS, ok := req.Options[chaosLatencyOptionName].(string); ok {
+			lat, err := time.ParseDuration(latS)
+			if err != nil {
+				return err
+			}
+
+			if hasPeer {
+				pid, err := peer.Decode(pstr)
+				if err != nil {
+					return err
+				}
+				if s.PeerLatency == nil {
+					s.PeerLatency = make(map[string]time.Duration)
+				}
+				if lat == 0 {
+					delete(s.PeerLatency, pid.Pretty())
+				} else {
+					s.PeerLatency[pid.Pretty()] = lat
+				}
+			} else {
+				s.Latency = lat
+			}
+		} else if hasPeer {
+			return fmt.Errorf("--%s requires --%s", chaosPeerOptionName, chaosLatencyOptionName)
+		}
+
+		if err := inj.SetSettings(s); err != nil {
+			return err
+		}
+
+		return cmds.EmitOnce(res, &ChaosOutput{
+			Settings: inj.Settings(),
+			Stats:    inj.Stats(),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ChaosOutput) error {
+			s := out.Settings
+			fmt.Fprintf(w, "drop streams: %g\n", s.DropStreams)
+			fmt.Fprintf(w, "corrupt blocks: %g\n", s.CorruptBlocks)
+			fmt.Fprintf(w, "latency: %s\n", s.Latency)
+
+			peers := make([]string, 0, len(s.PeerLatency))
+			for p := range s.PeerLatency {
+				peers = append(peers, p)
+			}
+			sort.Strings(peers)
+			for _, p := range peers {
+				fmt.Fprintf(w, "  %s: %s\n", p, s.PeerLatency[p])
+			}
+
+			st := out.Stats
+			fmt.Fprintf(w, "injected: %d dropped streams, %d delayed streams, %d corrupted blocks\n",
+				st.DroppedStreams, st.DelayedStreams, st.CorruptedBlocks)
+			return nil
+		}),
+	},
+	Type: ChaosOutput{},
+}
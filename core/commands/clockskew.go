@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	clockskew "github.com/ipfs/go-ipfs/core/clockskew"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var errClockSkewDisabled = errors.New("the clock checks are not enabled, set Clock.Enabled in the config and restart the daemon")
+
+const diagClockCheckOptionName = "check"
+
+var diagClockCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the offset of the local clock.",
+		ShortDescription: `
+'ipfs diag clock' shows the last estimate of the offset of the local clock,
+from the NTP servers of Clock.NTPServers or, without any, from a sample of
+the connected peers. A clock running ahead makes the IPNS records look
+expired early; with Clock.Adjust set, they are accepted up to the advance of
+the clock, shown as the slack. With --check, a new estimate is made first.
+
+The checks must be enabled in the config before the daemon starts:
+
+  > ipfs config --json Clock.Enabled true
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(diagClockCheckOptionName, "Estimate the offset now."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+		if n.ClockSkew == nil {
+			return errClockSkewDisabled
+		}
+		r := n.ClockSkew.Report()
+		if check, _ := req.Options[diagClockCheckOptionName].(bool); check {
+			r = n.ClockSkew.Check(req.Context)
+		}
+		return cmds.EmitOnce(res, &r)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, r *clockskew.Report) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			if r.Checked.IsZero() {
+				fmt.Fprintln(tw, "not checked yet")
+				return tw.Flush()
+			}
+			fmt.Fprintf(tw, "checked:\t%s\n", r.Checked.Format(time.RFC3339))
+			if r.Estimated {
+				status := "in sync"
+				if r.Skewed {
+					status = "skewed"
+				}
+				fmt.Fprintf(tw, "clock:\t%s, %s\n", clockskew.Describe(r.Offset), status)
+				fmt.Fprintf(tw, "slack:\t%s\n", r.Slack)
+			} else {
+				fmt.Fprintln(tw, "clock:\tunknown, too few sources answered")
+			}
+
+			fmt.Fprintln(tw)
+			fmt.Fprintf(tw, "%s\toffset\trtt\n", r.Method)
+			for _, s := range r.Samples {
+				if s.Error != "" {
+					fmt.Fprintf(tw, "%s\t%s\t\n", s.Source, s.Error)
+					continue
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Source, s.Offset.Round(time.Millisecond), s.RTT.Round(time.Millisecond))
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: clockskew.Report{},
+}
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"context"
 	"strings"
 	"testing"
 
@@ -66,12 +67,95 @@ func TestROCommands(t *testing.T) {
 		}
 	}
 }
+func TestPublicCommands(t *testing.T) {
+	list := []string{
+		"/cat",
+		"/dag",
+		"/dag/get",
+		"/ls",
+		"/resolve",
+		"/version",
+	}
+
+	cmdSet := make(map[string]struct{})
+	collectPaths("", RootPublic, cmdSet)
+
+	for _, path := range list {
+		if _, ok := cmdSet[path]; !ok {
+			t.Errorf("%q not in result", path)
+		} else {
+			delete(cmdSet, path)
+		}
+	}
+
+	for path := range cmdSet {
+		t.Errorf("%q in result but shouldn't be", path)
+	}
+}
+
+func TestPublicCommandsWithoutSideEffects(t *testing.T) {
+	for path, opt := range map[string]string{
+		"cat":     preferPeerOptionName,
+		"resolve": resolveDhtTimeoutOptionName,
+	} {
+		cmd, err := RootPublic.Get([]string{path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := &cmds.Request{
+			Context: context.Background(),
+			Options: cmds.OptMap{opt: "0"},
+		}
+		if err := cmd.Run(req, nil, nil); err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Errorf("expected --%s to be rejected by %s, got %v", opt, path, err)
+		}
+	}
+}
+
+func TestROCommandsWithoutPreferPeer(t *testing.T) {
+	for _, path := range [][]string{{"cat"}, {"get"}} {
+		cmd, err := RootRO.Get(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, opt := range cmd.Options {
+			if opt.Name() == preferPeerOptionName {
+				t.Errorf("%s declares --%s on the read-only API", path[0], preferPeerOptionName)
+			}
+		}
+
+		// the option is rejected even though the command doesn't declare it
+		req := &cmds.Request{
+			Context: context.Background(),
+			Options: cmds.OptMap{preferPeerOptionName: "/dns4/localhost/tcp/22/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"},
+		}
+		if err := cmd.Run(req, nil, nil); err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Errorf("expected --%s to be rejected by %s, got %v", preferPeerOptionName, path[0], err)
+		}
+	}
+}
+
 func TestCommands(t *testing.T) {
 	list := []string{
 		"/add",
+		"/archive",
+		"/archive/ls",
+		"/archive/offload",
+		"/backup",
+		"/backup/abort",
+		"/backup/commit",
+		"/backup/ls",
+		"/backup/missing",
+		"/backup/put",
+		"/backup/rm",
+		"/bench",
 		"/bitswap",
 		"/bitswap/ledger",
+		"/bitswap/ledger-reset",
+		"/bitswap/limit",
+		"/bitswap/qos",
 		"/bitswap/reprovide",
+		"/bitswap/sessions",
 		"/bitswap/stat",
 		"/bitswap/wantlist",
 		"/block",
@@ -86,17 +170,38 @@ func TestCommands(t *testing.T) {
 		"/bootstrap/rm",
 		"/bootstrap/rm/all",
 		"/cat",
+		"/channel",
+		"/channel/create",
+		"/channel/history",
+		"/channel/ls",
+		"/channel/publish",
+		"/channel/subscribe",
+		"/channel/unsubscribe",
 		"/commands",
 		"/config",
+		"/config/api",
+		"/config/api/token",
+		"/config/api/token/add",
+		"/config/api/token/ls",
+		"/config/api/token/rm",
 		"/config/edit",
 		"/config/replace",
 		"/config/show",
 		"/config/profile",
 		"/config/profile/apply",
+		"/config/reload",
+		"/content-type",
+		"/content-type/detect",
+		"/content-type/ls",
+		"/content-type/rm",
+		"/content-type/set",
 		"/dag",
+		"/dag/export",
 		"/dag/get",
+		"/dag/import",
 		"/dag/put",
 		"/dag/resolve",
+		"/dag/stat",
 		"/dht",
 		"/dht/findpeer",
 		"/dht/findprovs",
@@ -105,16 +210,26 @@ func TestCommands(t *testing.T) {
 		"/dht/put",
 		"/dht/query",
 		"/diag",
+		"/diag/chaos",
+		"/diag/clock",
 		"/diag/cmds",
 		"/diag/cmds/clear",
 		"/diag/cmds/set-time",
+		"/diag/events",
+		"/diag/hashperf",
+		"/diag/partition",
+		"/diag/partition/events",
 		"/diag/sys",
+		"/discovery",
+		"/discovery/lan",
+		"/discovery/lan/stats",
 		"/dns",
 		"/file",
 		"/file/ls",
 		"/files",
 		"/files/chcid",
 		"/files/cp",
+		"/files/export",
 		"/files/flush",
 		"/files/ls",
 		"/files/mkdir",
@@ -122,6 +237,7 @@ func TestCommands(t *testing.T) {
 		"/files/read",
 		"/files/rm",
 		"/files/stat",
+		"/files/status",
 		"/filestore",
 		"/filestore/dups",
 		"/filestore/ls",
@@ -134,6 +250,13 @@ func TestCommands(t *testing.T) {
 		"/key/list",
 		"/key/rename",
 		"/key/rm",
+		"/key/stats",
+		"/kv",
+		"/kv/get",
+		"/kv/ls",
+		"/kv/put",
+		"/kv/rm",
+		"/kv/subscribe",
 		"/log",
 		"/log/level",
 		"/log/ls",
@@ -141,11 +264,15 @@ func TestCommands(t *testing.T) {
 		"/ls",
 		"/mount",
 		"/name",
+		"/name/cache",
+		"/name/cache/clear",
+		"/name/cache/ls",
 		"/name/publish",
 		"/name/pubsub",
 		"/name/pubsub/state",
 		"/name/pubsub/subs",
 		"/name/pubsub/cancel",
+		"/name/republish",
 		"/name/resolve",
 		"/object",
 		"/object/data",
@@ -172,6 +299,7 @@ func TestCommands(t *testing.T) {
 		"/pin/add",
 		"/ping",
 		"/pin/ls",
+		"/pin/push",
 		"/pin/rm",
 		"/pin/update",
 		"/pin/verify",
@@ -182,7 +310,11 @@ func TestCommands(t *testing.T) {
 		"/pubsub/sub",
 		"/refs",
 		"/refs/local",
+		"/replica",
+		"/replica/status",
 		"/repo",
+		"/repo/badger-gc",
+		"/repo/compact",
 		"/repo/fsck",
 		"/repo/gc",
 		"/repo/stat",
@@ -190,26 +322,59 @@ func TestCommands(t *testing.T) {
 		"/repo/version",
 		"/resolve",
 		"/shutdown",
+		"/slo",
+		"/slo/report",
 		"/stats",
 		"/stats/bitswap",
 		"/stats/bw",
+		"/stats/dht",
+		"/stats/federation",
 		"/stats/repo",
 		"/swarm",
 		"/swarm/addrs",
+		"/swarm/addrs/external",
 		"/swarm/addrs/listen",
 		"/swarm/addrs/local",
 		"/swarm/connect",
 		"/swarm/disconnect",
+		"/swarm/events",
 		"/swarm/filters",
 		"/swarm/filters/add",
 		"/swarm/filters/rm",
+		"/swarm/key",
+		"/swarm/key/import",
+		"/swarm/key/invite",
+		"/swarm/key/join",
+		"/swarm/key/ls",
+		"/swarm/key/rm",
+		"/swarm/key/verify",
+		"/swarm/listen",
+		"/swarm/listen/add",
+		"/swarm/listen/rm",
+		"/swarm/listeners",
+		"/swarm/nat",
 		"/swarm/peers",
+		"/swarm/ping",
+		"/swarm/protect",
+		"/swarm/protect/add",
+		"/swarm/protect/ls",
+		"/swarm/protect/rm",
+		"/swarm/relay",
+		"/swarm/relay/add",
+		"/swarm/relay/ls",
+		"/swarm/relay/mode",
+		"/swarm/relay/rm",
+		"/swarm/scores",
+		"/swarm/stats",
 		"/tar",
 		"/tar/add",
 		"/tar/cat",
+		"/transfer",
+		"/transfer/receipts",
 		"/update",
 		"/urlstore",
 		"/urlstore/add",
+		"/verify-manifest",
 		"/version",
 		"/version/deps",
 		"/cid",
@@ -10,8 +10,10 @@ import (
 	"os/exec"
 	"strings"
 
+	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/common"
 	"github.com/ipfs/go-ipfs/repo/fsrepo"
 
 	"github.com/elgris/jsondiff"
@@ -23,6 +25,9 @@ import (
 type ConfigUpdateOutput struct {
 	OldCfg map[string]interface{}
 	NewCfg map[string]interface{}
+
+	// Reload is the reload of the running daemon, with --live.
+	Reload *ConfigReloadOutput `json:",omitempty"`
 }
 
 type ConfigField struct {
@@ -34,6 +39,7 @@ const (
 	configBoolOptionName   = "bool"
 	configJSONOptionName   = "json"
 	configDryRunOptionName = "dry-run"
+	configLiveOptionName   = "live"
 )
 
 var ConfigCmd = &cmds.Command{
@@ -64,6 +70,8 @@ Set the value of the 'Datastore.Path' key:
 		"edit":    configEditCmd,
 		"replace": configReplaceCmd,
 		"profile": configProfileCmd,
+		"api":     configAPICmd,
+		"reload":  configReloadCmd,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("key", true, false, "The key of the config entry (e.g. \"Addresses.API\")."),
@@ -306,26 +314,68 @@ Available profiles:
 var configProfileApplyCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Apply profile to config.",
+		ShortDescription: `
+'ipfs config profile apply' applies a profile to the config of the repo. The
+changes are used by the daemon once restarted, or at once with --live: the
+profile is applied to the config of the running daemon, which then reloads
+it like 'ipfs config reload' does, and lists the keys which still require a
+restart.
+`,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(configDryRunOptionName, "print difference between the current config and the config that would be generated"),
+		cmds.BoolOption(configLiveOptionName, "apply the profile to the running daemon"),
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("profile", true, false, "The profile to apply to the config."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
-		profile, ok := config.Profiles[req.Arguments[0]]
+		name := req.Arguments[0]
+		profile, ok := config.Profiles[name]
 		if !ok {
-			return fmt.Errorf("%s is not a profile", req.Arguments[0])
+			return fmt.Errorf("%s is not a profile", name)
 		}
 
 		dryRun, _ := req.Options[configDryRunOptionName].(bool)
-		cfgRoot, err := cmdenv.GetConfigRoot(env)
-		if err != nil {
-			return err
+		live, _ := req.Options[configLiveOptionName].(bool)
+		if live && dryRun {
+			return fmt.Errorf("--%s and --%s are exclusive", configLiveOptionName, configDryRunOptionName)
 		}
 
-		oldCfg, newCfg, err := transformConfig(cfgRoot, req.Arguments[0], profile.Transform, dryRun)
+		var r repo.Repo
+		var nd *core.IpfsNode
+		if live {
+			var err error
+			nd, err = cmdenv.GetNode(env)
+			if err != nil {
+				return err
+			}
+			if !nd.IsDaemon || nd.Reloader == nil {
+				return cmds.Errorf(cmds.ErrClient, "daemon not running")
+			}
+			r = nd.Repo
+		} else {
+			cfgRoot, err := cmdenv.GetConfigRoot(env)
+			if err != nil {
+				return err
+			}
+			fr, err := fsrepo.Open(cfgRoot)
+			if err != nil {
+				return err
+			}
+			defer fr.Close()
+			r = fr
+		}
+
+		// the keys set outside of the config struct, for the difference
+		oldKeys := make(map[string]interface{})
+		for k := range ProfileKeys[name] {
+			if v, err := r.GetConfigKey(k); err == nil {
+				oldKeys[k] = v
+			}
+		}
+
+		oldCfg, newCfg, err := transformConfig(r, name, profile.Transform, dryRun)
 		if err != nil {
 			return err
 		}
@@ -340,18 +390,42 @@ var configProfileApplyCmd = &cmds.Command{
 			return err
 		}
 
-		return cmds.EmitOnce(res, &ConfigUpdateOutput{
+		for k, v := range oldKeys {
+			if err := common.MapSetKV(oldCfgMap, k, v); err != nil {
+				return err
+			}
+		}
+		for k, v := range ProfileKeys[name] {
+			if err := common.MapSetKV(newCfgMap, k, v); err != nil {
+				return err
+			}
+		}
+
+		out := &ConfigUpdateOutput{
 			OldCfg: oldCfgMap,
 			NewCfg: newCfgMap,
-		})
+		}
+		if live {
+			result, err := nd.Reloader.Reload()
+			if err != nil {
+				return err
+			}
+			out.Reload = &ConfigReloadOutput{Result: *result, Reloadable: nd.Reloader.Keys()}
+		}
+		return cmds.EmitOnce(res, out)
 	},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ConfigUpdateOutput) error {
 			diff := jsondiff.Compare(out.OldCfg, out.NewCfg)
 			buf := jsondiff.Format(diff)
 
-			_, err := w.Write(buf)
-			return err
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			if out.Reload != nil {
+				writeConfigReload(w, out.Reload)
+			}
+			return nil
 		}),
 	},
 	Type: ConfigUpdateOutput{},
@@ -360,7 +434,16 @@ var configProfileApplyCmd = &cmds.Command{
 func buildProfileHelp() string {
 	var out string
 
+	// the help is built before Profiles are registered
+	all := make(map[string]config.Profile, len(config.Profiles)+len(Profiles))
 	for name, profile := range config.Profiles {
+		all[name] = profile
+	}
+	for name, profile := range Profiles {
+		all[name] = profile
+	}
+
+	for name, profile := range all {
 		dlines := strings.Split(profile.Description, "\n")
 		for i := range dlines {
 			dlines[i] = "    " + dlines[i]
@@ -392,13 +475,7 @@ func scrubPrivKey(cfg *config.Config) (map[string]interface{}, error) {
 // If dryRun is true, repo's config should not be updated and persisted
 // to storage. Otherwise, repo's config should be updated and persisted
 // to storage.
-func transformConfig(configRoot string, configName string, transformer config.Transformer, dryRun bool) (*config.Config, *config.Config, error) {
-	r, err := fsrepo.Open(configRoot)
-	if err != nil {
-		return nil, nil, err
-	}
-	defer r.Close()
-
+func transformConfig(r repo.Repo, configName string, transformer config.Transformer, dryRun bool) (*config.Config, *config.Config, error) {
 	oldCfg, err := r.Config()
 	if err != nil {
 		return nil, nil, err
@@ -425,6 +502,11 @@ func transformConfig(configRoot string, configName string, transformer config.Tr
 		if err != nil {
 			return nil, nil, err
 		}
+
+		err = SetProfileKeys(r, configName)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
 	return oldCfg, newCfg, nil
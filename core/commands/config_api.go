@@ -0,0 +1,194 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	apiauth "github.com/ipfs/go-ipfs/core/apiauth"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const configAPITokenScopesOptionName = "scopes"
+
+// APIToken is an authorization of API.Authorizations. The token is only
+// returned by 'ipfs config api token add'.
+type APIToken struct {
+	Name   string
+	Token  string `json:",omitempty"`
+	Scopes []string
+}
+
+var configAPICmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the access to the HTTP API.",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"token": configAPITokenCmd,
+	},
+}
+
+var configAPITokenCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the tokens of the HTTP API.",
+		ShortDescription: `
+Once API.Authorizations holds a token, every request to the HTTP API must
+present one allowing its command, in an 'Authorization: Bearer <token>'
+header. The ipfs command line sends the token of the IPFS_API_TOKEN
+environment variable.
+
+A token allows the commands of its scopes:
+
+  admin      every command
+  read-only  the commands of the read-only API served by the gateway
+  debug      the /debug/ endpoints and /logs of the API address
+  <command>  a command and its subcommands, as 'pin' or 'files/stat'
+
+  > ipfs config api token add ci --scopes=pin,add
+  > export IPFS_API_TOKEN=<token of an admin authorization>
+
+The tokens are stored hashed, and only shown when added. The changes made
+through a running daemon apply right away.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add": configAPITokenAddCmd,
+		"rm":  configAPITokenRmCmd,
+		"ls":  configAPITokenLsCmd,
+	},
+}
+
+var configAPITokenAddCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add an API token.",
+		ShortDescription: `
+'ipfs config api token add' generates a token allowing the commands of the
+comma-separated --scopes, and prints it. It can't be shown again.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of the token."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(configAPITokenScopesOptionName, "Comma-separated scopes of the token.").WithDefault(apiauth.ScopeReadOnly),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		name := req.Arguments[0]
+		if name == "" || strings.ContainsAny(name, ". ") {
+			return fmt.Errorf("invalid token name %q", name)
+		}
+		s, _ := req.Options[configAPITokenScopesOptionName].(string)
+		var scopes []string
+		for _, sc := range strings.Split(s, ",") {
+			sc = strings.TrimSpace(sc)
+			if err := apiauth.ValidateScope(sc); err != nil {
+				return err
+			}
+			scopes = append(scopes, sc)
+		}
+
+		token, stored, err := apiauth.NewToken()
+		if err != nil {
+			return err
+		}
+		err = updateAPIAuthorizations(env, func(auths map[string]apiauth.Authorization) error {
+			if _, ok := auths[name]; ok {
+				return fmt.Errorf("the token %s exists already", name)
+			}
+			auths[name] = apiauth.Authorization{Token: stored, Scopes: scopes}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &APIToken{Name: name, Token: token, Scopes: scopes})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *APIToken) error {
+			_, err := fmt.Fprintln(w, out.Token)
+			return err
+		}),
+	},
+	Type: APIToken{},
+}
+
+var configAPITokenRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove an API token.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of the token."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		name := req.Arguments[0]
+		return updateAPIAuthorizations(env, func(auths map[string]apiauth.Authorization) error {
+			if _, ok := auths[name]; !ok {
+				return fmt.Errorf("no token %s", name)
+			}
+			delete(auths, name)
+			return nil
+		})
+	},
+}
+
+var configAPITokenLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the API tokens, without their value.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		auths, err := apiauth.LoadConfig(n.Repo)
+		if err != nil {
+			return err
+		}
+		out := make([]APIToken, 0, len(auths))
+		for name, a := range auths {
+			out = append(out, APIToken{Name: name, Scopes: a.Scopes})
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out []APIToken) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			for _, t := range out {
+				fmt.Fprintf(tw, "%s\t%s\n", t.Name, strings.Join(t.Scopes, ","))
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: []APIToken{},
+}
+
+// updateAPIAuthorizations applies update to API.Authorizations, and reloads
+// them in a running daemon.
+func updateAPIAuthorizations(env cmds.Environment, update func(map[string]apiauth.Authorization) error) error {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return err
+	}
+	auths, err := apiauth.LoadConfig(n.Repo)
+	if err != nil {
+		return err
+	}
+	if auths == nil {
+		auths = make(map[string]apiauth.Authorization)
+	}
+	if err := update(auths); err != nil {
+		return err
+	}
+	if err := n.Repo.SetConfigKey(apiauth.ConfigKey, auths); err != nil {
+		return err
+	}
+	if n.IsDaemon && n.APIAuth != nil {
+		return n.APIAuth.Reload()
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	reload "github.com/ipfs/go-ipfs/core/reload"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// ConfigReloadOutput is the output of 'ipfs config reload'.
+type ConfigReloadOutput struct {
+	reload.Result
+
+	// Reloadable lists the keys applied without a restart.
+	Reloadable []string
+}
+
+var configReloadCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Apply the changes of the config to the running daemon.",
+		ShortDescription: `
+'ipfs config reload' reads the config file, which may have been edited while
+the daemon runs, and applies the changes of the reloadable keys without a
+restart. It lists the keys applied, the keys changed which still require a
+restart, and the keys which failed to apply. The keys changed with 'ipfs
+config' are applied as well.
+
+The reloadable keys are:
+
+  Swarm.AddrFilters    the address filters of the swarm
+  Swarm.ConnMgr        the limits of the connection manager, but not its Type
+  Bootstrap            the peers of the next bootstrap rounds
+  Discovery.MDNS       the local discovery, restarted
+  Gateway.HTTPHeaders  the headers of the responses of the gateway
+  Logging              the log levels of Logging.Levels
+
+A change requiring a restart keeps the daemon running with the previous value,
+and is listed again by the next reloads until the daemon restarts.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !nd.IsDaemon || nd.Reloader == nil {
+			return cmds.Errorf(cmds.ErrClient, "daemon not running")
+		}
+
+		result, err := nd.Reloader.Reload()
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &ConfigReloadOutput{Result: *result, Reloadable: nd.Reloader.Keys()})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ConfigReloadOutput) error {
+			writeConfigReload(w, out)
+			return nil
+		}),
+	},
+	Type: ConfigReloadOutput{},
+}
+
+func writeConfigReload(w io.Writer, out *ConfigReloadOutput) {
+	if len(out.Applied)+len(out.Restart)+len(out.Failed) == 0 {
+		fmt.Fprintln(w, "no change to apply")
+		return
+	}
+	for _, k := range out.Applied {
+		fmt.Fprintf(w, "applied %s\n", k)
+	}
+	for _, k := range out.Restart {
+		fmt.Fprintf(w, "restart required for %s\n", k)
+	}
+	for _, f := range out.Failed {
+		fmt.Fprintf(w, "failed to apply %s: %s\n", f.Key, f.Error)
+	}
+	if len(out.Restart) > 0 {
+		fmt.Fprintf(w, "reloadable keys: %s\n", strings.Join(out.Reloadable, ", "))
+	}
+}
@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	gopath "path"
+	"text/tabwriter"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	contenttype "github.com/ipfs/go-ipfs/core/contenttype"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// ContentTypeList is the output of 'ipfs content-type ls'.
+type ContentTypeList struct {
+	Overrides []contenttype.Override
+}
+
+// ContentTypeOutput is the output of 'ipfs content-type detect'.
+type ContentTypeOutput struct {
+	Type string
+}
+
+var ContentTypeCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the content types the gateway serves files with.",
+		ShortDescription: `
+Files added to IPFS carry no content type. The gateway guesses it from the
+extension of their name, or else sniffs it from their first bytes. The guess
+can be overridden for the files with an extension, or for a CID:
+
+  > ipfs content-type set .gmi text/gemini
+  > ipfs content-type set QmHash application/x-custom
+
+An override by CID takes precedence over an override by extension. The
+overrides are kept in the repo, and apply to the running gateway immediately.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"set":    contentTypeSetCmd,
+		"rm":     contentTypeRmCmd,
+		"ls":     contentTypeLsCmd,
+		"detect": contentTypeDetectCmd,
+	},
+}
+
+// getContentTypes returns the content type overrides of the repo.
+func getContentTypes(env cmds.Environment) (*contenttype.Store, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	return contenttype.NewStore(n.Repo.Datastore()), nil
+}
+
+var contentTypeSetCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Override the content type of an extension or a CID.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("target", true, false, "An extension starting with a dot, such as .md, or a CID."),
+		cmds.StringArg("type", true, false, "The content type, such as 'text/markdown; charset=utf-8'."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getContentTypes(env)
+		if err != nil {
+			return err
+		}
+		return store.Set(req.Arguments[0], req.Arguments[1])
+	},
+}
+
+var contentTypeRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove the override of an extension or a CID.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("target", true, false, "An extension starting with a dot, or a CID."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getContentTypes(env)
+		if err != nil {
+			return err
+		}
+		found, err := store.Remove(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("no content type override for %s", req.Arguments[0])
+		}
+		return nil
+	},
+}
+
+var contentTypeLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the content type overrides.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getContentTypes(env)
+		if err != nil {
+			return err
+		}
+		overrides, err := store.List()
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &ContentTypeList{Overrides: overrides})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ContentTypeList) error {
+			tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+			for _, o := range out.Overrides {
+				target := o.Extension
+				if target == "" {
+					target = o.Cid
+				}
+				fmt.Fprintf(tw, "%s\t%s\n", target, o.Type)
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: ContentTypeList{},
+}
+
+var contentTypeDetectCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the content type the gateway serves a file with.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", true, false, "The path of the file."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		store, err := getContentTypes(env)
+		if err != nil {
+			return err
+		}
+
+		p := path.New(req.Arguments[0])
+		rp, err := api.ResolvePath(req.Context, p)
+		if err != nil {
+			return err
+		}
+		nd, err := api.Unixfs().Get(req.Context, rp)
+		if err != nil {
+			return err
+		}
+		defer nd.Close()
+		f, ok := nd.(files.File)
+		if !ok {
+			return fmt.Errorf("%s is not a file", p)
+		}
+
+		ctype, err := store.TypeOf(rp.Cid(), gopath.Base(p.String()), f)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &ContentTypeOutput{Type: ctype})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ContentTypeOutput) error {
+			_, err := fmt.Fprintln(w, out.Type)
+			return err
+		}),
+	},
+	Type: ContentTypeOutput{},
+}
@@ -0,0 +1,163 @@
+package dagcmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-ipfs/core/car"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const pinRootsOptionName = "pin-roots"
+
+// importBatchSize is the number of blocks added at once on import.
+const importBatchSize = 256
+
+// ImportOutput is the output type of 'dag import' command
+type ImportOutput struct {
+	Root     cid.Cid
+	Pinned   bool
+	PinError string `json:",omitempty"`
+}
+
+var DagExportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stream the DAG of a root as a CAR file.",
+		ShortDescription: `
+'ipfs dag export' writes the DAG under a root to stdout as a CARv1 file,
+fetching the missing blocks from the network. CAR files can be imported on
+another node with 'ipfs dag import', without a connection between the nodes.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, false, "The root of the DAG to export").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		rp, err := api.ResolvePath(req.Context, path.New(req.Arguments[0]))
+		if err != nil {
+			return err
+		}
+		if rp.Remainder() != "" {
+			return fmt.Errorf("%s is not the path of a node", req.Arguments[0])
+		}
+
+		r, w := io.Pipe()
+		go func() {
+			w.CloseWithError(car.Write(req.Context, api.Dag(), []cid.Cid{rp.Cid()}, w))
+		}()
+		return res.Emit(r)
+	},
+}
+
+var DagImportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Import the contents of CAR files.",
+		ShortDescription: `
+'ipfs dag import' adds the blocks of CARv1 files, as written by
+'ipfs dag export', and pins the roots listed in their headers, unless
+--pin-roots=false is given. The blocks are checked against their CID. A root
+whose DAG isn't complete after the import is fetched from the network when
+pinned.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.FileArg("path", true, true, "The CAR files to import").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(pinRootsOptionName, "Pin the roots listed in the CAR headers.").WithDefault(true),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		node, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		pinRoots, _ := req.Options[pinRootsOptionName].(bool)
+
+		var roots []cid.Cid
+		it := req.Files.Entries()
+		for it.Next() {
+			file := files.FileFromEntry(it)
+			if file == nil {
+				return fmt.Errorf("expected a regular file")
+			}
+			cr, err := car.NewReader(file)
+			if err != nil {
+				return err
+			}
+			roots = append(roots, cr.Header.Roots...)
+
+			batch := make([]blocks.Block, 0, importBatchSize)
+			for {
+				b, err := cr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return err
+				}
+				batch = append(batch, b)
+				if len(batch) == importBatchSize {
+					if err := node.Blocks.AddBlocks(batch); err != nil {
+						return err
+					}
+					batch = batch[:0]
+				}
+			}
+			if err := node.Blocks.AddBlocks(batch); err != nil {
+				return err
+			}
+		}
+		if it.Err() != nil {
+			return it.Err()
+		}
+
+		for _, root := range roots {
+			out := &ImportOutput{Root: root}
+			if pinRoots {
+				if err := api.Pin().Add(req.Context, path.IpfsPath(root)); err != nil {
+					out.PinError = err.Error()
+				} else {
+					out.Pinned = true
+				}
+			}
+			if err := res.Emit(out); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: ImportOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ImportOutput) error {
+			enc, err := cmdenv.GetLowLevelCidEncoder(req)
+			if err != nil {
+				return err
+			}
+			switch {
+			case out.PinError != "":
+				fmt.Fprintf(w, "root %s not pinned: %s\n", enc.Encode(out.Root), out.PinError)
+			case out.Pinned:
+				fmt.Fprintf(w, "pinned root %s\n", enc.Encode(out.Root))
+			default:
+				fmt.Fprintf(w, "root %s\n", enc.Encode(out.Root))
+			}
+			return nil
+		}),
+	},
+}
@@ -0,0 +1,137 @@
+package dagcmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	ipld "github.com/ipfs/go-ipld-format"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const rawOptionName = "raw"
+
+// StatOutput is the output type of 'dag stat' command
+type StatOutput struct {
+	Cid       cid.Cid
+	Size      uint64
+	NumBlocks uint64
+	MaxDepth  uint64
+
+	// RawSize and RawNumBlocks count the blocks once per link to them.
+	RawSize      uint64 `json:",omitempty"`
+	RawNumBlocks uint64 `json:",omitempty"`
+}
+
+var DagStatCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the size and number of blocks of a DAG.",
+		ShortDescription: `
+'ipfs dag stat' walks the DAG under a root, fetching the missing blocks from
+the network, and reports the total size of its blocks, their number and the
+length of its longest path of links. A block linked to from several places
+is counted once; with --raw, the sizes counting it once per link are
+reported as well, which is what transferring the DAG without deduplication
+would cost.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, false, "The root of the DAG to stat").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(rawOptionName, "Also report the sizes without deduplication."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		rp, err := api.ResolvePath(req.Context, path.New(req.Arguments[0]))
+		if err != nil {
+			return err
+		}
+		if rp.Remainder() != "" {
+			return fmt.Errorf("%s is not the path of a node", req.Arguments[0])
+		}
+
+		out, err := dagStat(req.Context, api.Dag(), rp.Cid())
+		if err != nil {
+			return err
+		}
+		if raw, _ := req.Options[rawOptionName].(bool); !raw {
+			out.RawSize, out.RawNumBlocks = 0, 0
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Type: StatOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *StatOutput) error {
+			fmt.Fprintf(w, "Size: %d\n", out.Size)
+			fmt.Fprintf(w, "NumBlocks: %d\n", out.NumBlocks)
+			fmt.Fprintf(w, "MaxDepth: %d\n", out.MaxDepth)
+			if raw, _ := req.Options[rawOptionName].(bool); raw {
+				fmt.Fprintf(w, "RawSize: %d\n", out.RawSize)
+				fmt.Fprintf(w, "RawNumBlocks: %d\n", out.RawNumBlocks)
+			}
+			return nil
+		}),
+	},
+}
+
+// subdag is the statistics of the DAG under a block, counting shared blocks
+// once per link.
+type subdag struct {
+	size   uint64
+	blocks uint64
+	depth  uint64
+}
+
+// dagStat walks the DAG of root. Every block is fetched once: the statistics
+// of the DAG under a block are kept for the other links to it.
+func dagStat(ctx context.Context, ng ipld.NodeGetter, root cid.Cid) (*StatOutput, error) {
+	out := &StatOutput{Cid: root}
+	seen := make(map[cid.Cid]subdag)
+
+	var walk func(c cid.Cid) (subdag, error)
+	walk = func(c cid.Cid) (subdag, error) {
+		if s, ok := seen[c]; ok {
+			return s, nil
+		}
+		nd, err := ng.Get(ctx, c)
+		if err != nil {
+			return subdag{}, err
+		}
+		size := uint64(len(nd.RawData()))
+		out.Size += size
+		out.NumBlocks++
+
+		s := subdag{size: size, blocks: 1}
+		for _, l := range nd.Links() {
+			child, err := walk(l.Cid)
+			if err != nil {
+				return subdag{}, err
+			}
+			s.size += child.size
+			s.blocks += child.blocks
+			if child.depth+1 > s.depth {
+				s.depth = child.depth + 1
+			}
+		}
+		seen[c] = s
+		return s, nil
+	}
+
+	s, err := walk(root)
+	if err != nil {
+		return nil, err
+	}
+	out.MaxDepth = s.depth
+	out.RawSize = s.size
+	out.RawNumBlocks = s.blocks
+	return out, nil
+}
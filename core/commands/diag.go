@@ -10,7 +10,12 @@ var DiagCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"sys":  sysDiagCmd,
-		"cmds": ActiveReqsCmd,
+		"sys":       sysDiagCmd,
+		"cmds":      ActiveReqsCmd,
+		"chaos":     chaosDiagCmd,
+		"clock":     diagClockCmd,
+		"events":    diagEventsCmd,
+		"hashperf":  diagHashPerfCmd,
+		"partition": diagPartitionCmd,
 	},
 }
@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	landisc "github.com/ipfs/go-ipfs/core/landisc"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var DiscoveryCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect the discovery of peers and content.",
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"lan": discoveryLanCmd,
+	},
+}
+
+var discoveryLanCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect the discovery of content on the local network.",
+		ShortDescription: `
+With Discovery.LAN.Enabled, the node sends a bloom filter of its pinned roots
+to the peers connected over a local network address, and asks the neighbors
+whose filter has a CID for its blocks before asking the routing.
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"stats": discoveryLanStatsCmd,
+	},
+}
+
+var discoveryLanStatsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the roots exchanged with the local network.",
+		ShortDescription: `
+'ipfs discovery lan stats' prints the number of roots the node announces,
+the filters received from its neighbors with the number of roots they hold
+and their estimated false positive rate, and the provider lookups answered by
+the neighbors (hits) or left to the routing (misses).
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+		if n.LANDiscovery == nil {
+			return landisc.ErrDisabled
+		}
+
+		st := n.LANDiscovery.Stats()
+		return cmds.EmitOnce(res, &st)
+	},
+	Type: landisc.Stats{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *landisc.Stats) error {
+			fmt.Fprintf(w, "Roots announced: %d (every %s, %d sent)\n", out.Roots, out.Interval, out.Sent)
+			fmt.Fprintf(w, "Lookups: %d hits, %d misses\n", out.Hits, out.Misses)
+			if len(out.Neighbors) == 0 {
+				return nil
+			}
+
+			fmt.Fprintln(w)
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "NEIGHBOR\tROOTS\tFALSE POSITIVES\tRECEIVED")
+			for _, nb := range out.Neighbors {
+				fmt.Fprintf(tw, "%s\t%d\t%.2f%%\t%s ago\n", nb.Peer, nb.Roots, 100*nb.FalsePositiveRate, time.Since(nb.Received).Round(time.Second))
+			}
+			return tw.Flush()
+		}),
+	},
+}
@@ -9,9 +9,13 @@ import (
 	gopath "path"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	e "github.com/ipfs/go-ipfs/core/commands/e"
+	"github.com/ipfs/go-ipfs/core/filescp"
+	"github.com/ipfs/go-ipfs/core/pathnorm"
 
 	"github.com/dustin/go-humanize"
 	bservice "github.com/ipfs/go-blockservice"
@@ -27,7 +31,6 @@ import (
 	ft "github.com/ipfs/go-unixfs"
 	iface "github.com/ipfs/interface-go-ipfs-core"
 	path "github.com/ipfs/interface-go-ipfs-core/path"
-	mh "github.com/multiformats/go-multihash"
 )
 
 var flog = logging.Logger("cmds/files")
@@ -54,16 +57,18 @@ operations.
 		cmds.BoolOption(filesFlushOptionName, "f", "Flush target and ancestors after write.").WithDefault(true),
 	},
 	Subcommands: map[string]*cmds.Command{
-		"read":  filesReadCmd,
-		"write": filesWriteCmd,
-		"mv":    filesMvCmd,
-		"cp":    filesCpCmd,
-		"ls":    filesLsCmd,
-		"mkdir": filesMkdirCmd,
-		"stat":  filesStatCmd,
-		"rm":    filesRmCmd,
-		"flush": filesFlushCmd,
-		"chcid": filesChcidCmd,
+		"read":   filesReadCmd,
+		"write":  filesWriteCmd,
+		"mv":     filesMvCmd,
+		"cp":     filesCpCmd,
+		"ls":     filesLsCmd,
+		"mkdir":  filesMkdirCmd,
+		"stat":   filesStatCmd,
+		"rm":     filesRmCmd,
+		"flush":  filesFlushCmd,
+		"chcid":  filesChcidCmd,
+		"status": filesStatusCmd,
+		"export": filesExportCmd,
 	},
 }
 
@@ -136,6 +141,13 @@ var filesStatCmd = &cmds.Command{
 			return err
 		}
 
+		if !strings.HasPrefix(path, "/ipfs/") {
+			path, err = normalizeMFSPath(req.Context, node, path)
+			if err != nil {
+				return err
+			}
+		}
+
 		withLocal, _ := req.Options[filesWithLocalOptionName].(bool)
 
 		enc, err := cmdenv.GetCidEncoder(req)
@@ -304,14 +316,41 @@ func walkBlock(ctx context.Context, dagserv ipld.DAGService, nd ipld.Node) (bool
 	return local, sizeLocal, nil
 }
 
+const (
+	filesProgressOptionName   = "progress"
+	filesBackgroundOptionName = "background"
+)
+
+// filesCpOutput is the output of 'files cp' with --progress or --background.
+type filesCpOutput struct {
+	Job    int    `json:",omitempty"`
+	Blocks uint64 `json:",omitempty"`
+	Bytes  uint64 `json:",omitempty"`
+	Done   bool   `json:",omitempty"`
+}
+
 var filesCpCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Copy files into mfs.",
+		ShortDescription: `
+'ipfs files cp' links the source into mfs, the rest of the source DAG being
+fetched when read.
+
+With --progress, the whole source DAG is fetched before it is linked, and the
+number of blocks and bytes fetched is reported as the copy goes. With
+--background, the copy runs the same way on the daemon and the command
+returns right away with the ID of the copy, whose progress is shown by
+'ipfs files status'.
+`,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("source", true, false, "Source object to copy."),
 		cmds.StringArg("dest", true, false, "Destination to copy object to."),
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption(filesProgressOptionName, "Fetch the whole source first and report the progress."),
+		cmds.BoolOption(filesBackgroundOptionName, "Fetch the whole source and copy it in the background."),
+	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		nd, err := cmdenv.GetNode(env)
 		if err != nil {
@@ -324,6 +363,8 @@ var filesCpCmd = &cmds.Command{
 		}
 
 		flush, _ := req.Options[filesFlushOptionName].(bool)
+		progress, _ := req.Options[filesProgressOptionName].(bool)
+		background, _ := req.Options[filesBackgroundOptionName].(bool)
 
 		src, err := checkPath(req.Arguments[0])
 		if err != nil {
@@ -340,24 +381,119 @@ var filesCpCmd = &cmds.Command{
 			dst += gopath.Base(src)
 		}
 
-		node, err := getNodeFromPath(req.Context, nd, api, src)
-		if err != nil {
-			return fmt.Errorf("cp: cannot get node from path %s: %s", src, err)
+		if !strings.HasPrefix(src, "/ipfs/") {
+			src, err = normalizeMFSPath(req.Context, nd, src)
+			if err != nil {
+				return err
+			}
 		}
-
-		err = mfs.PutNode(nd.FilesRoot, dst, node)
+		dst, err = normalizeMFSPath(req.Context, nd, dst)
 		if err != nil {
-			return fmt.Errorf("cp: cannot put node in path %s: %s", dst, err)
+			return err
 		}
 
-		if flush {
-			_, err := mfs.FlushPath(req.Context, nd.FilesRoot, dst)
+		cp := func(ctx context.Context, job *filescp.Job) error {
+			node, err := getNodeFromPath(ctx, nd, api, src)
+			if err != nil {
+				return fmt.Errorf("cp: cannot get node from path %s: %s", src, err)
+			}
+
+			if job != nil {
+				if err := job.Fetch(ctx, dag.NewSession(ctx, nd.DAG), node); err != nil {
+					return fmt.Errorf("cp: cannot fetch %s: %s", src, err)
+				}
+			}
+
+			err = mfs.PutNode(nd.FilesRoot, dst, node)
 			if err != nil {
-				return fmt.Errorf("cp: cannot flush the created file %s: %s", dst, err)
+				return fmt.Errorf("cp: cannot put node in path %s: %s", dst, err)
 			}
+
+			if flush {
+				_, err := mfs.FlushPath(ctx, nd.FilesRoot, dst)
+				if err != nil {
+					return fmt.Errorf("cp: cannot flush the created file %s: %s", dst, err)
+				}
+			}
+			return nil
 		}
 
-		return nil
+		switch {
+		case background:
+			if !nd.IsDaemon {
+				return errors.New("cp: --background requires a running daemon")
+			}
+			job := nd.FilesCopies.Start(src, dst)
+			go func() {
+				job.Finish(cp(nd.Context(), job))
+			}()
+			return cmds.EmitOnce(res, &filesCpOutput{Job: job.Status().ID})
+		case progress:
+			job := nd.FilesCopies.Start(src, dst)
+			errCh := make(chan error, 1)
+			go func() {
+				err := cp(req.Context, job)
+				job.Finish(err)
+				errCh <- err
+			}()
+
+			ticker := time.NewTicker(500 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case err := <-errCh:
+					if err != nil {
+						return err
+					}
+					blocks, bytes := job.Progress()
+					return res.Emit(&filesCpOutput{Blocks: blocks, Bytes: bytes, Done: true})
+				case <-ticker.C:
+					blocks, bytes := job.Progress()
+					if err := res.Emit(&filesCpOutput{Blocks: blocks, Bytes: bytes}); err != nil {
+						return err
+					}
+				}
+			}
+		default:
+			return cp(req.Context, nil)
+		}
+	},
+	Type: filesCpOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *filesCpOutput) error {
+			switch {
+			case out.Job != 0:
+				fmt.Fprintf(w, "started copy %d\n", out.Job)
+			case out.Done:
+				fmt.Fprintf(w, "copied %d blocks (%s)\n", out.Blocks, humanize.Bytes(out.Bytes))
+			}
+			return nil
+		}),
+	},
+	PostRun: cmds.PostRunMap{
+		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+			for {
+				v, err := res.Next()
+				if err != nil {
+					if err == io.EOF {
+						return nil
+					}
+					return err
+				}
+
+				out, ok := v.(*filesCpOutput)
+				if !ok {
+					return e.TypeErr(out, v)
+				}
+				if out.Job == 0 && !out.Done {
+					fmt.Fprintf(os.Stderr, "Fetched %d blocks (%s)\r", out.Blocks, humanize.Bytes(out.Bytes))
+					continue
+				}
+				if err := re.Emit(out); err != nil {
+					return err
+				}
+			}
+		},
 	},
 }
 
@@ -432,6 +568,11 @@ Examples:
 			return err
 		}
 
+		path, err = normalizeMFSPath(req.Context, nd, path)
+		if err != nil {
+			return err
+		}
+
 		fsn, err := mfs.Lookup(nd.FilesRoot, path)
 		if err != nil {
 			return err
@@ -559,6 +700,10 @@ Examples:
 		if err != nil {
 			return err
 		}
+		path, err = normalizeMFSPath(req.Context, nd, path)
+		if err != nil {
+			return err
+		}
 		flog.Info("Path File read  =========================    ", path)
 
 		dir := nd.FilesRoot.GetDirectory()
@@ -674,6 +819,12 @@ Example:
 		if err != nil {
 			return err
 		}
+		if src, err = normalizeMFSPath(req.Context, nd, src); err != nil {
+			return err
+		}
+		if dst, err = normalizeMFSPath(req.Context, nd, dst); err != nil {
+			return err
+		}
 
 		err = mfs.Mv(nd.FilesRoot, src, dst)
 		if err == nil && flush {
@@ -764,6 +915,11 @@ stat' on the file or any of its ancestors.
 			return err
 		}
 
+		path, err = normalizeMFSPath(req.Context, nd, path)
+		if err != nil {
+			return err
+		}
+
 		flog.Info("node identity ======>>  ", nd.Identity)
 		flog.Info("node file root ======>>  ", nd.FilesRoot, nd.FilesRoot.GetDirectory())
 		flog.Info("node file root PATH ======>>  ", nd.FilesRoot, nd.FilesRoot.GetDirectory().Path())
@@ -872,6 +1028,10 @@ Examples:
 		if err != nil {
 			return err
 		}
+		dirtomake, err = normalizeMFSPath(req.Context, n, dirtomake)
+		if err != nil {
+			return err
+		}
 
 		flush, _ := req.Options[filesFlushOptionName].(bool)
 
@@ -1029,6 +1189,11 @@ Remove files or directories.
 			return fmt.Errorf("cannot delete root")
 		}
 
+		path, err = normalizeMFSPath(req.Context, nd, path)
+		if err != nil {
+			return err
+		}
+
 		// 'rm a/b/c/' will fail unless we trim the slash at the end
 		if path[len(path)-1] == '/' {
 			path = path[:len(path)-1]
@@ -1102,9 +1267,9 @@ func getPrefixNew(req *cmds.Request) (cid.Builder, error) {
 	}
 
 	if hashFunSet {
-		hashFunCode, ok := mh.Names[strings.ToLower(hashFunStr)]
-		if !ok {
-			return nil, fmt.Errorf("unrecognized hash function: %s", strings.ToLower(hashFunStr))
+		hashFunCode, err := hashFunction(hashFunStr)
+		if err != nil {
+			return nil, err
 		}
 		prefix.MhType = hashFunCode
 		prefix.MhLength = -1
@@ -1131,9 +1296,9 @@ func getPrefix(req *cmds.Request) (cid.Builder, error) {
 	}
 
 	if hashFunSet {
-		hashFunCode, ok := mh.Names[strings.ToLower(hashFunStr)]
-		if !ok {
-			return nil, fmt.Errorf("unrecognized hash function: %s", strings.ToLower(hashFunStr))
+		hashFunCode, err := hashFunction(hashFunStr)
+		if err != nil {
+			return nil, err
 		}
 		prefix.MhType = hashFunCode
 		prefix.MhLength = -1
@@ -1220,6 +1385,16 @@ func checkPath(p string) (string, error) {
 	return cleaned, nil
 }
 
+// normalizeMFSPath matches the components of the checked MFS path p against
+// existing entries, according to the PathNormalization config section.
+func normalizeMFSPath(ctx context.Context, nd *core.IpfsNode, p string) (string, error) {
+	n, err := pathnorm.ForMFS(nd.Repo)
+	if err != nil {
+		return "", err
+	}
+	return n.MFSPath(ctx, nd.FilesRoot, p)
+}
+
 func getParentDir(root *mfs.Root, dir string) (*mfs.Directory, error) {
 	parent, err := mfs.Lookup(root, dir)
 	if err != nil {
@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	core "github.com/ipfs/go-ipfs/core"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	filesexport "github.com/ipfs/go-ipfs/core/filesexport"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	ipld "github.com/ipfs/go-ipld-format"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	filesExportSinceOptionName  = "since"
+	filesExportFormatOptionName = "format"
+	filesExportPinOptionName    = "pin"
+)
+
+var filesExportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Export the changes of an mfs directory since a snapshot.",
+		ShortDescription: `
+'ipfs files export' writes the files of an mfs directory changed since a
+snapshot to stdout, as a tar or CAR archive, for the periodic off-site syncs
+of a writable node. A snapshot is the CID of the directory at a previous
+export. Without --since, the whole directory is exported.
+
+The archive starts with a manifest, listing the snapshot exported, to give as
+--since to the next export, the paths changed and the paths deleted, which
+are to be deleted first. In a tar archive, the manifest is the
+'.ipfs-export.json' file, and the files changed follow with their content. In
+a CAR archive, the manifest is the first root, as a raw block of JSON, and the
+snapshot is the second root, with the blocks which are not in the snapshot
+given as --since: the receiver must hold it to rebuild the directory.
+
+The snapshot given as --since must be stored locally, or it is fetched from
+the network. --pin pins the snapshot exported, replacing the pin of the
+--since snapshot, so that it stays available for the next export:
+
+  > ipfs files export --pin / > full.tar
+  > ipfs files export --pin --since <root of the manifest> / > changes.tar
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", false, false, "Path to the mfs directory to export. Default: '/'."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(filesExportSinceOptionName, "The snapshot to export the changes since."),
+		cmds.StringOption(filesExportFormatOptionName, "The format of the archive: tar or car.").WithDefault(filesexport.FormatTar),
+		cmds.BoolOption(filesExportPinOptionName, "Pin the snapshot exported, replacing the pin of --since."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		format, _ := req.Options[filesExportFormatOptionName].(string)
+		if format != filesexport.FormatTar && format != filesexport.FormatCar {
+			return fmt.Errorf("unknown export format %q: use %s or %s", format, filesexport.FormatTar, filesexport.FormatCar)
+		}
+
+		p := "/"
+		if len(req.Arguments) > 0 {
+			p = req.Arguments[0]
+		}
+		p, err = checkPath(p)
+		if err != nil {
+			return err
+		}
+		p, err = normalizeMFSPath(req.Context, nd, p)
+		if err != nil {
+			return err
+		}
+		root, err := getNodeFromPath(req.Context, nd, api, p)
+		if err != nil {
+			return err
+		}
+
+		var since ipld.Node
+		sinceArg, _ := req.Options[filesExportSinceOptionName].(string)
+		if sinceArg != "" {
+			since, err = api.ResolveNode(req.Context, path.New(sinceArg))
+			if err != nil {
+				return fmt.Errorf("snapshot %s: %s", sinceArg, err)
+			}
+		}
+
+		diff, err := filesexport.Compare(req.Context, nd.DAG, root, since)
+		if err != nil {
+			return err
+		}
+
+		pinSnapshot, _ := req.Options[filesExportPinOptionName].(bool)
+		r, w := io.Pipe()
+		go func() {
+			err := diff.Write(req.Context, nd.DAG, format, w)
+			if err == nil && pinSnapshot {
+				err = pinExport(req.Context, nd, api, diff)
+			}
+			w.CloseWithError(err)
+		}()
+		return res.Emit(r)
+	},
+}
+
+// pinExport pins the snapshot of an export, replacing the pin of the
+// snapshot it was compared with, if pinned.
+func pinExport(ctx context.Context, nd *core.IpfsNode, api coreiface.CoreAPI, diff *filesexport.Diff) error {
+	to := path.IpfsPath(diff.Root)
+	if diff.Since.Defined() && !diff.Since.Equals(diff.Root) {
+		_, pinned, err := nd.Pinning.IsPinned(ctx, diff.Since)
+		if err != nil {
+			return err
+		}
+		if pinned {
+			return api.Pin().Update(ctx, path.IpfsPath(diff.Since), to, options.Pin.Unpin(true))
+		}
+	}
+	return api.Pin().Add(ctx, to)
+}
@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	filescp "github.com/ipfs/go-ipfs/core/filescp"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var filesStatusCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the progress of the copies into mfs.",
+		ShortDescription: `
+'ipfs files status' lists the copies started by 'ipfs files cp --background'
+or '--progress' that are running, and the last finished ones, with the number
+of blocks and bytes fetched.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, nd.FilesCopies.Jobs())
+	},
+	Type: []filescp.Status{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, jobs []filescp.Status) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tSOURCE\tDEST\tBLOCKS\tBYTES\tSTATUS")
+			for _, j := range jobs {
+				status := "running"
+				switch {
+				case j.Error != "":
+					status = "failed: " + j.Error
+				case j.Done:
+					status = "done"
+				}
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n", j.ID, j.Source, j.Dest, j.Blocks, humanize.Bytes(j.Bytes), status)
+			}
+			return tw.Flush()
+		}),
+	},
+}
@@ -56,7 +56,7 @@ The output is:
 		}
 		args := req.Arguments
 		if len(args) > 0 {
-			return listByArgs(res, fs, args)
+			return listByArgs(res, fs, args, filestore.List)
 		}
 
 		fileOrder, _ := req.Options[fileOrderOptionName].(bool)
@@ -133,7 +133,7 @@ For ERROR entries the error will also be printed to stderr.
 		}
 		args := req.Arguments
 		if len(args) > 0 {
-			return listByArgs(res, fs, args)
+			return listByArgs(res, fs, args, filestore.Verify)
 		}
 
 		fileOrder, _ := req.Options[fileOrderOptionName].(bool)
@@ -235,7 +235,9 @@ func getFilestore(env cmds.Environment) (*core.IpfsNode, *filestore.Filestore, e
 	return n, fs, err
 }
 
-func listByArgs(res cmds.ResponseEmitter, fs *filestore.Filestore, args []string) error {
+// listByArgs emits the result of list, filestore.List or filestore.Verify, for
+// each CID of args.
+func listByArgs(res cmds.ResponseEmitter, fs *filestore.Filestore, args []string, list func(*filestore.Filestore, cid.Cid) *filestore.ListRes) error {
 	for _, arg := range args {
 		c, err := cid.Decode(arg)
 		if err != nil {
@@ -248,7 +250,7 @@ func listByArgs(res cmds.ResponseEmitter, fs *filestore.Filestore, args []string
 			}
 			continue
 		}
-		r := filestore.Verify(fs, c)
+		r := list(fs, c)
 		if err := res.Emit(r); err != nil {
 			return err
 		}
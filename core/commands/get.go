@@ -43,6 +43,9 @@ To output a TAR archive instead of unpacked files, use '--archive' or '-a'.
 
 To compress the output with GZIP compression, use '--compress' or '-C'. You
 may also specify the level of compression by specifying '-l=<1-9>'.
+
+To fetch the blocks from given peers first, such as a nearby node known to
+have the data, use '--prefer-peer=<peer>,...'. Other providers are still used.
 `,
 	},
 
@@ -54,6 +57,7 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		cmds.BoolOption(archiveOptionName, "a", "Output a TAR archive."),
 		cmds.BoolOption(compressOptionName, "C", "Compress the output with GZIP compression."),
 		cmds.IntOption(compressionLevelOptionName, "l", "The level of compression (1-9)."),
+		preferPeerOption,
 	},
 	PreRun: func(req *cmds.Request, env cmds.Environment) error {
 		_, err := getCompressOptions(req)
@@ -70,6 +74,12 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 			return err
 		}
 
+		release, err := preferPeers(req, env)
+		if err != nil {
+			return err
+		}
+		defer release()
+
 		p := path.New(req.Arguments[0])
 
 		file, err := api.Unixfs().Get(req.Context, p)
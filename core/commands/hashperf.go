@@ -0,0 +1,197 @@
+package commands
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	hashstats "github.com/ipfs/go-ipfs/core/hashstats"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	mh "github.com/multiformats/go-multihash"
+)
+
+const (
+	hashPerfSizeOptionName = "size"
+	hashPerfRunsOptionName = "runs"
+)
+
+// HashPerfResult holds the throughput of a hash function on this machine.
+type HashPerfResult struct {
+	Name string
+	Code uint64
+
+	// Throughput is in bytes per second.
+	Throughput float64
+}
+
+// HashVerifyStats holds the runtime verification counters of a hash function.
+type HashVerifyStats struct {
+	Name string
+	hashstats.Counters
+	Throughput float64
+}
+
+// HashPerfReport is the output of 'ipfs diag hashperf'.
+type HashPerfReport struct {
+	System string
+	Size   uint64
+
+	// Results are sorted from the fastest to the slowest hash function.
+	Results []HashPerfResult
+
+	// Recommended is the fastest hash function suitable to add data.
+	Recommended string
+
+	// HashOnRead tells whether blocks are verified on read, and Verified
+	// holds the verification counters if so.
+	HashOnRead bool
+	Verified   []HashVerifyStats `json:",omitempty"`
+}
+
+var diagHashPerfCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Benchmark the hash functions on this machine.",
+		ShortDescription: `
+'ipfs diag hashperf' measures the throughput of every hash function that can
+be used to add data, and recommends the fastest one suitable for content
+addressing. The default, sha2-256, is the only one supported by CIDv0 and
+remains the most interoperable choice.
+
+When Datastore.HashOnRead is set, the counters of the blocks verified on read
+since the daemon started are printed as well. They are also exported as
+metrics.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(hashPerfSizeOptionName, "Size of the data hashed per run.").WithDefault("1MiB"),
+		cmds.IntOption(hashPerfRunsOptionName, "n", "Number of runs for each hash function.").WithDefault(5),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		sizeS, _ := req.Options[hashPerfSizeOptionName].(string)
+		size, err := humanize.ParseBytes(sizeS)
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return fmt.Errorf("size must be greater than 0")
+		}
+		runs, _ := req.Options[hashPerfRunsOptionName].(int)
+		if runs <= 0 {
+			return fmt.Errorf("number of runs must be greater than 0, was %d", runs)
+		}
+
+		data := make([]byte, size)
+		if _, err := rand.Read(data); err != nil {
+			return err
+		}
+
+		out := &HashPerfReport{
+			System: runtime.GOARCH + "/" + runtime.GOOS,
+			Size:   size,
+		}
+		for _, name := range usableHashFunctions() {
+			if err := req.Context.Err(); err != nil {
+				return err
+			}
+
+			code := mh.Names[name]
+			start := time.Now()
+			for i := 0; i < runs; i++ {
+				if _, err := mh.Sum(data, code, -1); err != nil {
+					return err
+				}
+			}
+			took := time.Since(start)
+			if took <= 0 {
+				took = time.Nanosecond
+			}
+
+			out.Results = append(out.Results, HashPerfResult{
+				Name:       name,
+				Code:       code,
+				Throughput: float64(size) * float64(runs) / took.Seconds(),
+			})
+		}
+		sort.SliceStable(out.Results, func(i, j int) bool {
+			return out.Results[i].Throughput > out.Results[j].Throughput
+		})
+		for _, r := range out.Results {
+			if recommendedHashFunction(r.Name, r.Code) {
+				out.Recommended = r.Name
+				break
+			}
+		}
+
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return err
+		}
+		out.HashOnRead = cfg.Datastore.HashOnRead
+		for name, c := range n.HashStats.Snapshot() {
+			out.Verified = append(out.Verified, HashVerifyStats{Name: name, Counters: c, Throughput: c.Throughput()})
+		}
+		sort.Slice(out.Verified, func(i, j int) bool {
+			return out.Verified[i].Name < out.Verified[j].Name
+		})
+
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *HashPerfReport) error {
+			fmt.Fprintf(w, "Hashing %s per run on %s:\n\n", humanize.Bytes(out.Size), out.System)
+
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "FUNCTION\tTHROUGHPUT\t")
+			for _, r := range out.Results {
+				fmt.Fprintf(tw, "%s\t%s/s\t\n", r.Name, humanize.Bytes(uint64(r.Throughput)))
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+
+			if out.Recommended != "" {
+				fmt.Fprintf(w, "\nRecommended: %s ('ipfs add --hash=%s'). ", out.Recommended, out.Recommended)
+				fmt.Fprintln(w, "Hash functions other than sha2-256 require CIDv1.")
+			}
+
+			fmt.Fprintln(w)
+			if !out.HashOnRead {
+				fmt.Fprintln(w, "Datastore.HashOnRead is not set, blocks are not verified on read.")
+				return nil
+			}
+			if len(out.Verified) == 0 {
+				fmt.Fprintln(w, "No blocks verified on read yet.")
+				return nil
+			}
+			fmt.Fprintln(tw, "VERIFIED\tBLOCKS\tBYTES\tFAILURES\tTHROUGHPUT\t")
+			for _, v := range out.Verified {
+				fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%s/s\t\n", v.Name, v.Blocks, humanize.Bytes(v.Bytes), v.Failures, humanize.Bytes(uint64(v.Throughput)))
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: HashPerfReport{},
+}
+
+// recommendedHashFunction returns whether the hash function is suitable for
+// content addressing: it must be cryptographic, with a digest of at least 256
+// bits.
+func recommendedHashFunction(name string, code uint64) bool {
+	if strings.HasPrefix(name, "murmur3") {
+		return false
+	}
+	return mh.DefaultLengths[code] >= 32
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"io"
 	"text/tabwriter"
+	"time"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	keystats "github.com/ipfs/go-ipfs/core/keystats"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	options "github.com/ipfs/interface-go-ipfs-core/options"
@@ -33,6 +35,7 @@ publish'.
 		"list":   keyListCmd,
 		"rename": keyRenameCmd,
 		"rm":     keyRmCmd,
+		"stats":  keyStatsCmd,
 	},
 }
 
@@ -230,6 +233,52 @@ var keyRmCmd = &cmds.Command{
 	Type: KeyOutputList{},
 }
 
+var keyStatsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show statistics about the keys.",
+		ShortDescription: `
+'ipfs key stats' lists the keys with their type and size in bits, when they
+were written to the keystore, when they were last used to publish an IPNS
+record, and when the record last published with them expires.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		stats, err := keystats.Stats(req.Context, n.PrivateKey, n.Repo.Keystore(), n.Repo.Datastore())
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, stats)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, stats []keystats.Stat) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tTYPE\tSIZE\tCREATED\tLAST USED\tRECORD EXPIRES")
+			for _, s := range stats {
+				expires := "-"
+				if s.Record != nil {
+					expires = formatKeyTime(s.Record.Expires)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", s.Name, s.Type, s.Size,
+					formatKeyTime(s.Created), formatKeyTime(s.LastUsed), expires)
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: []keystats.Stat{},
+}
+
+func formatKeyTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
 func keyOutputListEncoders() cmds.EncoderFunc {
 	return cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, list *KeyOutputList) error {
 		withID, _ := req.Options["l"].(bool)
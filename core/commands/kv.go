@@ -0,0 +1,232 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"text/tabwriter"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	kv "github.com/ipfs/go-ipfs/core/kv"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var errKVDisabled = errors.New("the key-value store is disabled. Set Experimental.KV.Enabled and run daemon with --enable-pubsub-experiment to use.")
+
+// KVEntries is the output of 'ipfs kv ls'.
+type KVEntries struct {
+	Entries []*kv.Entry
+}
+
+var KVCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Read and write the key-value store shared over pubsub (experimental).",
+		ShortDescription: `
+The key-value store is replicated between the nodes sharing its name, over
+pubsub. Every node can write; concurrent writes of a key resolve to the same
+value on every node once they have received each other's writes.
+
+  > ipfs kv put service/api 10.0.0.3:8080
+  > ipfs kv get service/api
+  10.0.0.3:8080
+
+Writes aren't signed: share a store within a private network only. The store
+is enabled with:
+
+  > ipfs config --json Experimental.KV.Enabled true
+
+and requires the daemon to run with --enable-pubsub-experiment.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"get":       kvGetCmd,
+		"put":       kvPutCmd,
+		"rm":        kvRmCmd,
+		"ls":        kvLsCmd,
+		"subscribe": kvSubscribeCmd,
+	},
+}
+
+// getKV returns the key-value store of the node.
+func getKV(env cmds.Environment) (*kv.Service, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	if !n.IsOnline {
+		return nil, ErrNotOnline
+	}
+	if n.KV == nil {
+		return nil, errKVDisabled
+	}
+	return n.KV, nil
+}
+
+var kvGetCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the value of a key.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", true, false, "The key to read."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getKV(env)
+		if err != nil {
+			return err
+		}
+		e, err := store.Get(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, e)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *kv.Entry) error {
+			_, err := fmt.Fprintln(w, out.Value)
+			return err
+		}),
+	},
+	Type: kv.Entry{},
+}
+
+var kvPutCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Set the value of a key.",
+		ShortDescription: `
+'ipfs kv put' writes the value of a key, and broadcasts the write to the other
+nodes of the store. It prints the CID of the write.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", true, false, "The key to write."),
+		cmds.StringArg("value", true, false, "The value of the key."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getKV(env)
+		if err != nil {
+			return err
+		}
+		e, err := store.Put(req.Context, req.Arguments[0], req.Arguments[1])
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, e)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *kv.Entry) error {
+			_, err := fmt.Fprintln(w, out.Cid)
+			return err
+		}),
+	},
+	Type: kv.Entry{},
+}
+
+var kvRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove a key.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", true, false, "The key to remove."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getKV(env)
+		if err != nil {
+			return err
+		}
+		e, err := store.Delete(req.Context, req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, e)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *kv.Entry) error {
+			_, err := fmt.Fprintln(w, out.Cid)
+			return err
+		}),
+	},
+	Type: kv.Entry{},
+}
+
+var kvLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the keys and their values.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("prefix", false, false, "Only list the keys starting with prefix."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getKV(env)
+		if err != nil {
+			return err
+		}
+		var prefix string
+		if len(req.Arguments) > 0 {
+			prefix = req.Arguments[0]
+		}
+		entries, err := store.List(prefix)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &KVEntries{Entries: entries})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *KVEntries) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			for _, e := range out.Entries {
+				fmt.Fprintf(tw, "%s\t%s\t\n", e.Key, e.Value)
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: KVEntries{},
+}
+
+var kvSubscribeCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the changes of the keys as they happen.",
+		ShortDescription: `
+'ipfs kv subscribe' prints the changes of the keys starting with the given
+prefix, local or received from the other nodes, until interrupted. Removed
+keys are printed with a '-' in place of their value.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("prefix", false, false, "Only print the changes of the keys starting with prefix."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		store, err := getKV(env)
+		if err != nil {
+			return err
+		}
+		var prefix string
+		if len(req.Arguments) > 0 {
+			prefix = req.Arguments[0]
+		}
+
+		events := store.Subscribe(req.Context, prefix)
+		if f, ok := res.(http.Flusher); ok {
+			f.Flush()
+		}
+		for ev := range events {
+			ev := ev
+			if err := res.Emit(&ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ev *kv.Event) error {
+			if ev.Deleted {
+				_, err := fmt.Fprintf(w, "%s -\n", ev.Key)
+				return err
+			}
+			_, err := fmt.Fprintf(w, "%s %s\n", ev.Key, ev.Value)
+			return err
+		}),
+	},
+	Type: kv.Event{},
+}
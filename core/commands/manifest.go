@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	coreunix "github.com/ipfs/go-ipfs/core/coreunix"
+
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	ipld "github.com/ipfs/go-ipld-format"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// maxReportedMismatches bounds the mismatches listed in the error of
+// 'ipfs verify-manifest'.
+const maxReportedMismatches = 20
+
+// VerifyManifestOutput is the output of 'ipfs verify-manifest'.
+type VerifyManifestOutput struct {
+	Root  string
+	Files int
+}
+
+var VerifyManifestCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Verify a tree against its manifest.",
+		ShortDescription: `
+'ipfs verify-manifest' checks that every file listed in a manifest created
+with 'ipfs add --manifest' is in the tree with the same size and content, and
+that the tree has no other files.
+
+By default the tree the manifest was created for is verified. Another tree,
+e.g. a copy of the dataset added again on another node, can be verified by
+giving its path: as other add options give other CIDs for the same content,
+only the sizes and the SHA-256 hashes of the contents are compared then.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("manifest", true, false, "Path of the manifest."),
+		cmds.StringArg("root", false, false, "Path of the tree to verify, instead of the tree of the manifest."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		mnd, err := api.ResolveNode(req.Context, path.New(req.Arguments[0]))
+		if err != nil {
+			return err
+		}
+		m, err := coreunix.DecodeManifest(mnd)
+		if err != nil {
+			return err
+		}
+
+		var root ipld.Node
+		if len(req.Arguments) > 1 {
+			root, err = api.ResolveNode(req.Context, path.New(req.Arguments[1]))
+		} else {
+			root, err = api.Dag().Get(req.Context, m.Root)
+		}
+		if err != nil {
+			return err
+		}
+
+		mismatches, err := coreunix.VerifyManifest(req.Context, api.Dag(), m, root)
+		if err != nil {
+			return err
+		}
+		if len(mismatches) > 0 {
+			lines := make([]string, 0, maxReportedMismatches+1)
+			for i, mm := range mismatches {
+				if i == maxReportedMismatches {
+					lines = append(lines, fmt.Sprintf("and %d more", len(mismatches)-i))
+					break
+				}
+				lines = append(lines, fmt.Sprintf("/%s: %s", mm.Path, mm.Reason))
+			}
+			return fmt.Errorf("%s does not match the manifest:\n%s", enc.Encode(root.Cid()), strings.Join(lines, "\n"))
+		}
+
+		return cmds.EmitOnce(res, &VerifyManifestOutput{
+			Root:  enc.Encode(root.Cid()),
+			Files: len(m.Entries),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *VerifyManifestOutput) error {
+			_, err := fmt.Fprintf(w, "verified %d files of %s\n", out.Files, out.Root)
+			return err
+		}),
+	},
+	Type: VerifyManifestOutput{},
+}
+
+// addManifest adds the manifest of the tree root, and pins it if pin is set.
+func addManifest(ctx context.Context, api coreiface.CoreAPI, root cid.Cid, pin bool) (cid.Cid, error) {
+	nd, err := api.Dag().Get(ctx, root)
+	if err != nil {
+		return cid.Undef, err
+	}
+	m, err := coreunix.BuildManifest(ctx, api.Dag(), nd)
+	if err != nil {
+		return cid.Undef, err
+	}
+	mnd, err := m.Node()
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	if err := api.Dag().Add(ctx, mnd); err != nil {
+		return cid.Undef, err
+	}
+	if pin {
+		if err := api.Pin().Add(ctx, path.IpfsPath(mnd.Cid())); err != nil {
+			return cid.Undef, err
+		}
+	}
+	return mnd.Cid(), nil
+}
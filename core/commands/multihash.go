@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+	verifcid "github.com/ipfs/go-verifcid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// hashFunction returns the multihash code of the hash function called name,
+// if it can be used to add data: the node must be able to compute it, and
+// blocks hashed with it must be accepted by the blockstore and by bitswap.
+func hashFunction(name string) (uint64, error) {
+	name = strings.ToLower(name)
+	code, ok := mh.Names[name]
+	if !ok {
+		return 0, fmt.Errorf("unrecognized hash function: %s (supported: %s)", name, strings.Join(usableHashFunctions(), ", "))
+	}
+	if err := usableHashFunction(code); err != nil {
+		return 0, fmt.Errorf("hash function %s can't be used to add data: %s", name, err)
+	}
+	return code, nil
+}
+
+func usableHashFunction(code uint64) error {
+	if code == mh.ID {
+		return fmt.Errorf("identity hashes are only used for inlining")
+	}
+	h, err := mh.Sum(nil, code, -1)
+	if err != nil {
+		return err
+	}
+	return verifcid.ValidateCid(cid.NewCidV1(cid.Raw, h))
+}
+
+// usableHashFunctions returns the names of the hash functions that can be
+// used to add data.
+func usableHashFunctions() []string {
+	var names []string
+	for name, code := range mh.Names {
+		if usableHashFunction(code) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
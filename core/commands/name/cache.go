@@ -0,0 +1,151 @@
+package name
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/namesys"
+
+	"github.com/ipfs/go-ipfs-cmds"
+)
+
+// CacheEntryOutput describes a cached name resolution.
+type CacheEntryOutput struct {
+	Name  string
+	Value string
+	EOL   time.Time
+	TTL   time.Duration
+}
+
+// CacheLsOutput is the output of 'ipfs name cache ls'.
+type CacheLsOutput struct {
+	Entries []CacheEntryOutput
+	Stats   namesys.CacheStats
+}
+
+// IpnsCacheCmd is the subcommand that allows us to inspect and manage the
+// name resolution cache.
+var IpnsCacheCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect and manage the name resolution cache.",
+		ShortDescription: `
+Resolved IPNS names and DNSLinks are kept in an in-memory cache until their
+TTL expires. These commands list and evict cached resolutions, which is
+useful to debug stale results.
+
+The maximum number of cached entries is set by the Ipns.ResolveCacheSize
+config key.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":    ipnsCacheLsCmd,
+		"clear": ipnsCacheClearCmd,
+	},
+}
+
+var ipnsCacheLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List cached name resolutions.",
+		ShortDescription: `
+'ipfs name cache ls' lists the unexpired entries of the daemon's name
+resolution cache with their value and remaining TTL, followed by the cache
+counters.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cache, err := getNameCache(env)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		out := &CacheLsOutput{Stats: cache.CacheStats()}
+		for _, e := range cache.CacheEntries() {
+			out.Entries = append(out.Entries, CacheEntryOutput{
+				Name:  e.Name,
+				Value: e.Value.String(),
+				EOL:   e.EOL,
+				TTL:   e.EOL.Sub(now).Truncate(time.Second),
+			})
+		}
+		sort.Slice(out.Entries, func(i, j int) bool {
+			return out.Entries[i].Name < out.Entries[j].Name
+		})
+
+		return cmds.EmitOnce(res, out)
+	},
+	Type: CacheLsOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *CacheLsOutput) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			for _, e := range out.Entries {
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Name, e.Value, e.TTL)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+
+			s := out.Stats
+			_, err := fmt.Fprintf(w, "entries: %d/%d, hits: %d, misses: %d\n", s.Entries, s.Capacity, s.Hits, s.Misses)
+			return err
+		}),
+	},
+}
+
+var ipnsCacheClearCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Evict cached name resolutions.",
+		ShortDescription: `
+'ipfs name cache clear' evicts the given names from the daemon's name
+resolution cache, or every entry if no name is given. Names can be given
+with or without the /ipns/ prefix.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", false, true, "Names to evict."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cache, err := getNameCache(env)
+		if err != nil {
+			return err
+		}
+
+		if len(req.Arguments) == 0 {
+			n := cache.CachePurge()
+			return cmds.EmitOnce(res, &stringList{[]string{fmt.Sprintf("removed %d entries", n)}})
+		}
+
+		var out []string
+		for _, name := range req.Arguments {
+			name = strings.TrimPrefix(name, "/ipns/")
+			if cache.CacheRemove(name) {
+				out = append(out, "removed "+name)
+			} else {
+				out = append(out, name+" not cached")
+			}
+		}
+		return cmds.EmitOnce(res, &stringList{out})
+	},
+	Type: stringList{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: stringListEncoder(),
+	},
+}
+
+func getNameCache(env cmds.Environment) (namesys.Cache, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, ok := n.Namesys.(namesys.Cache)
+	if !ok {
+		return nil, fmt.Errorf("name system has no resolution cache")
+	}
+	return cache, nil
+}
@@ -1,10 +1,12 @@
 package name
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
@@ -21,6 +23,15 @@ var log = logging.Logger("core/commands/ipns")
 
 type ResolvedPath struct {
 	Path path.Path
+
+	// Chain is the validation chain of the resolution, with --verify-chain.
+	Chain []namesys.ChainStep `json:",omitempty"`
+
+	// Candidates are the records of the name found in each source, with
+	// --all-candidates. Split is set when valid records hold different
+	// values under the sequence number of the selected one.
+	Candidates []namesys.RecordReport `json:",omitempty"`
+	Split      bool                   `json:",omitempty"`
 }
 
 const (
@@ -29,8 +40,14 @@ const (
 	dhtRecordCountOptionName = "dht-record-count"
 	dhtTimeoutOptionName     = "dht-timeout"
 	streamOptionName         = "stream"
+	verifyChainOptionName    = "verify-chain"
+	allCandidatesOptionName  = "all-candidates"
 )
 
+// defaultVerifyRecordCount is the number of records asked to the DHT with
+// --verify-chain and --all-candidates, as for a resolution.
+const defaultVerifyRecordCount = 16
+
 var IpnsCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Resolve IPNS names.",
@@ -66,6 +83,29 @@ Resolve the value of a dnslink:
   > ipfs name resolve ipfs.io
   /ipfs/QmaBvfZooxWkrv7D3r8LS9moNjzD2o525XMZze69hhoxf5
 
+Show how a name resolves, to debug stale or conflicting records:
+
+  > ipfs name resolve --verify-chain QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
+
+With --verify-chain, each name of the chain is resolved in turn. For an IPNS
+name, the records are fetched from each source, the DHT and the pubsub store
+when enabled, and reported with their value, sequence number, validity, TTL,
+where the public key was found, whether the signature is valid and why a
+record is rejected. The record the name resolves to is marked as selected.
+The value in the resolution cache is shown too, which the resolution uses
+first.
+
+Show the records competing for a name, to debug a name published from several
+nodes:
+
+  > ipfs name resolve --all-candidates QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
+
+With --all-candidates, the name is resolved as usual, and the records of the
+name found in each source are listed with the peer that sent them, their
+sequence number, validity and value, the selected one first. Valid records
+holding different values under the sequence number of the selected one are
+reported as split: the key publishes from several nodes, and which value
+resolves depends on the records each resolver finds first.
 `,
 	},
 
@@ -78,6 +118,8 @@ Resolve the value of a dnslink:
 		cmds.UintOption(dhtRecordCountOptionName, "dhtrc", "Number of records to request for DHT resolution."),
 		cmds.StringOption(dhtTimeoutOptionName, "dhtt", "Max time to collect values during DHT resolution eg \"30s\". Pass 0 for no timeout."),
 		cmds.BoolOption(streamOptionName, "s", "Stream entries as they are found."),
+		cmds.BoolOption(verifyChainOptionName, "Output the records and the validation of each name of the chain."),
+		cmds.BoolOption(allCandidatesOptionName, "Output the records of the name found in each source, with their sequence number."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -128,6 +170,19 @@ Resolve the value of a dnslink:
 			name = "/ipns/" + name
 		}
 
+		if verify, _ := req.Options[verifyChainOptionName].(bool); verify {
+			if stream {
+				return errors.New("--verify-chain can't be used with --stream")
+			}
+			return verifyChain(req, res, env, name)
+		}
+		if all, _ := req.Options[allCandidatesOptionName].(bool); all {
+			if stream {
+				return errors.New("--all-candidates can't be used with --stream")
+			}
+			return resolveCandidates(req, res, env, name, opts, recursive)
+		}
+
 		if !stream {
 			output, err := api.Name().Resolve(req.Context, name, opts...)
 			if err != nil && (recursive || err != namesys.ErrResolveRecursion) {
@@ -156,9 +211,201 @@ Resolve the value of a dnslink:
 	},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, rp *ResolvedPath) error {
+			if rp.Chain != nil {
+				return writeChain(w, rp.Chain)
+			}
+			if rp.Candidates != nil {
+				return writeCandidates(w, rp)
+			}
 			_, err := fmt.Fprintln(w, rp.Path)
 			return err
 		}),
 	},
 	Type: ResolvedPath{},
 }
+
+// verifyChain resolves name one step at a time, and emits the records found
+// at each step with their validation.
+func verifyChain(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment, name string) error {
+	v, ctx, cancel, err := chainVerifier(req, env)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	out := &ResolvedPath{Chain: v.Verify(ctx, name)}
+	if last := out.Chain[len(out.Chain)-1]; last.Error == "" {
+		out.Path = path.FromString(last.Value)
+	}
+	return cmds.EmitOnce(res, out)
+}
+
+// resolveCandidates resolves name, and emits the path with the records of
+// name found in each source.
+func resolveCandidates(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment, name string, opts []options.NameResolveOption, recursive bool) error {
+	api, err := cmdenv.GetApi(env, req)
+	if err != nil {
+		return err
+	}
+	v, ctx, cancel, err := chainVerifier(req, env)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	step := v.Candidates(ctx, name)
+	if step.Kind != "ipns" {
+		return fmt.Errorf("%s is not an IPNS key, see its resolution with --%s", step.Name, verifyChainOptionName)
+	}
+	out := &ResolvedPath{Candidates: step.Records, Split: step.Split}
+
+	p, err := api.Name().Resolve(req.Context, name, opts...)
+	switch {
+	case err == nil || (!recursive && err == namesys.ErrResolveRecursion):
+		out.Path = path.FromString(p.String())
+	case len(step.Records) == 0:
+		return err
+	default:
+		// the candidates tell why the name doesn't resolve
+		log.Debugf("resolving %s: %s", name, err)
+	}
+	return cmds.EmitOnce(res, out)
+}
+
+// chainVerifier returns the verifier of the records of the names, querying
+// the DHT and the pubsub store, and the context of its queries bounded by
+// --dht-timeout.
+func chainVerifier(req *cmds.Request, env cmds.Environment) (*namesys.ChainVerifier, context.Context, context.CancelFunc, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(req.Context)
+	if dhtt, ok := req.Options[dhtTimeoutOptionName].(string); ok {
+		d, err := time.ParseDuration(dhtt)
+		if err != nil {
+			cancel()
+			return nil, nil, nil, err
+		}
+		if d > 0 {
+			cancel()
+			ctx, cancel = context.WithTimeout(req.Context, d)
+		}
+	}
+
+	count := defaultVerifyRecordCount
+	if rc, ok := req.Options[dhtRecordCountOptionName].(uint); ok && rc > 0 {
+		count = int(rc)
+	}
+
+	var sources []namesys.RecordSource
+	if n.DHT != nil {
+		sources = append(sources, namesys.RecordSource{Name: "dht", Store: n.DHT})
+	}
+	if n.PSRouter != nil {
+		sources = append(sources, namesys.RecordSource{Name: "pubsub", Store: n.PSRouter})
+	}
+	if len(sources) == 0 {
+		sources = append(sources, namesys.RecordSource{Name: "routing", Store: n.Routing})
+	}
+
+	return &namesys.ChainVerifier{
+		NameSystem: n.Namesys,
+		Validator:  n.RecordValidator,
+		KeyBook:    n.Peerstore,
+		Sources:    sources,
+		Count:      count,
+	}, ctx, cancel, nil
+}
+
+func writeChain(w io.Writer, chain []namesys.ChainStep) error {
+	tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+	for _, step := range chain {
+		// a line without a cell ends the alignment of the previous step
+		if step.Kind != "" {
+			fmt.Fprintf(tw, "%s (%s)\n", step.Name, step.Kind)
+		} else {
+			fmt.Fprintln(tw, step.Name)
+		}
+		if step.Cached != "" {
+			fmt.Fprintf(tw, "  cached:\t%s\n", step.Cached)
+		}
+		for _, r := range step.Records {
+			source := r.Source
+			if r.From != "" {
+				source += " from " + r.From
+			}
+			status := "rejected: " + r.Error
+			if r.Error == "" {
+				status = "valid"
+				if r.Selected {
+					status = "valid, selected"
+				}
+			}
+			signature := "invalid"
+			if r.Signature {
+				signature = "valid"
+			}
+			fmt.Fprintf(tw, "  record:\t%s, %s\n", source, status)
+			fmt.Fprintf(tw, "    value:\t%s\n", r.Value)
+			fmt.Fprintf(tw, "    sequence:\t%d\n", r.Sequence)
+			fmt.Fprintf(tw, "    validity:\t%s\n", r.Validity.Format(time.RFC3339))
+			fmt.Fprintf(tw, "    ttl:\t%s\n", r.TTL)
+			fmt.Fprintf(tw, "    public key:\t%s\n", r.PublicKey)
+			fmt.Fprintf(tw, "    signature:\t%s\n", signature)
+		}
+		if step.Split {
+			fmt.Fprintf(tw, "  split:\tvalid records hold other values under the selected sequence number\n")
+		}
+		if step.Error != "" {
+			fmt.Fprintf(tw, "  error:\t%s\n", step.Error)
+			continue
+		}
+		fmt.Fprintf(tw, "  value:\t%s\n", step.Value)
+	}
+	return tw.Flush()
+}
+
+func writeCandidates(w io.Writer, rp *ResolvedPath) error {
+	if rp.Path != "" {
+		fmt.Fprintln(w, rp.Path)
+	}
+	// the selected record first
+	sorted := make([]namesys.RecordReport, 0, len(rp.Candidates))
+	for _, r := range rp.Candidates {
+		if r.Selected {
+			sorted = append(sorted, r)
+		}
+	}
+	for _, r := range rp.Candidates {
+		if !r.Selected {
+			sorted = append(sorted, r)
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tFROM\tSEQUENCE\tVALIDITY\tVALUE\tSTATUS")
+	for _, r := range sorted {
+		from := r.From
+		if from == "" {
+			from = "-"
+		}
+		status := "rejected: " + r.Error
+		if r.Error == "" {
+			status = "valid"
+			if r.Selected {
+				status = "selected"
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", r.Source, from, r.Sequence, r.Validity.Format(time.RFC3339), r.Value, status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if rp.Split {
+		_, err := fmt.Fprintln(w, "split: valid records hold different values under the selected sequence number, the key publishes from several nodes")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package name
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/namesys/republisher"
+
+	"github.com/ipfs/go-ipfs-cmds"
+)
+
+const nowOptionName = "now"
+
+// RepublishOutput is the output of 'ipfs name republish'.
+type RepublishOutput struct {
+	// Next is when the next cycle starts, if it wasn't forced.
+	Next     time.Time `json:",omitempty"`
+	Statuses []republisher.Status
+}
+
+var IpnsRepublishCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show or force the republishing of IPNS records.",
+		ShortDescription: `
+The daemon republishes the IPNS records of its keys every
+Ipns.RepublishPeriod. Within a cycle, the republishes are spread by a random
+delay of up to Ipns.Republish.Jitter and at most Ipns.Republish.Concurrency
+records are republished at once.
+
+'ipfs name republish' shows when the next cycle starts and the outcome of the
+last republish of every key. With --now, it republishes the records of the
+given keys, or of every key, immediately and shows the outcome.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", false, true, "Names of the keys to republish with --now."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(nowOptionName, "Republish immediately."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline || n.IpnsRepub == nil {
+			return errors.New("the republisher only runs on an online node")
+		}
+
+		now, _ := req.Options[nowOptionName].(bool)
+		if !now {
+			if len(req.Arguments) > 0 {
+				return errors.New("keys can only be given with --now")
+			}
+			return cmds.EmitOnce(res, &RepublishOutput{
+				Next:     n.IpnsRepub.Next(),
+				Statuses: n.IpnsRepub.Statuses(),
+			})
+		}
+
+		statuses, err := n.IpnsRepub.RepublishNow(req.Context, req.Arguments...)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &RepublishOutput{Statuses: statuses})
+	},
+	Type: RepublishOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *RepublishOutput) error {
+			if !out.Next.IsZero() {
+				fmt.Fprintf(w, "next cycle: %s\n", out.Next.Format(time.RFC3339))
+			}
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			for _, s := range out.Statuses {
+				var status string
+				switch {
+				case s.Error != "":
+					status = "failed: " + s.Error
+				case s.Republished:
+					status = "republished"
+				default:
+					status = "no record"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, s.Id, s.Time.Format(time.RFC3339), status)
+			}
+			return tw.Flush()
+		}),
+	},
+}
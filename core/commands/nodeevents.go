@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	nodeevents "github.com/ipfs/go-ipfs/core/nodeevents"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const (
+	diagEventsRecentOptionName = "recent"
+	diagEventsTypeOptionName   = "type"
+)
+
+var diagEventsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stream the events of the node.",
+		ShortDescription: `
+'ipfs diag events' prints the events of the node as they happen, until it is
+interrupted:
+
+  peer-connected       a connection to a peer was opened
+  peer-disconnected    a connection to a peer was closed
+  reachability         AutoNAT found the node public, private or unknown
+  identify-completed   a peer was identified
+  identify-failed      a peer couldn't be identified
+  pin-added            a content was pinned
+  pin-removed          a content was unpinned
+  gc                   a garbage collection ended
+
+With --recent, the last events of the node are printed first. --type only
+prints the events of the given types, separated by commas. Use --enc=json for
+the events to be read by a script.
+
+The daemon also serves the events as server-sent events on /debug/events of
+its API, for the monitoring tools to subscribe to them over HTTP:
+
+  curl -N http://127.0.0.1:5001/debug/events?type=peer-connected,gc
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(diagEventsRecentOptionName, "r", "Print the last events first."),
+		cmds.StringOption(diagEventsTypeOptionName, "t", "Only print the events of these types, separated by commas."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline || n.Events == nil {
+			return ErrNotOnline
+		}
+
+		types, _ := req.Options[diagEventsTypeOptionName].(string)
+		match, err := nodeevents.Filter(types)
+		if err != nil {
+			return cmds.Errorf(cmds.ErrClient, "%s", err)
+		}
+
+		events, cancel := n.Events.Subscribe()
+		defer cancel()
+
+		if recent, _ := req.Options[diagEventsRecentOptionName].(bool); recent {
+			for _, ev := range n.Events.Events() {
+				if !match(ev) {
+					continue
+				}
+				if err := res.Emit(&ev); err != nil {
+					return err
+				}
+			}
+		}
+
+		if f, ok := res.(http.Flusher); ok {
+			f.Flush()
+		}
+		for {
+			select {
+			case ev := <-events:
+				if !match(ev) {
+					continue
+				}
+				if err := res.Emit(&ev); err != nil {
+					return err
+				}
+			case <-req.Context.Done():
+				return nil
+			}
+		}
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ev *nodeevents.Event) error {
+			var detail []string
+			switch ev.Type {
+			case nodeevents.PeerConnected, nodeevents.PeerDisconnected:
+				detail = []string{ev.Peer, ev.Addr, ev.Direction}
+			case nodeevents.Reachability:
+				detail = []string{ev.Reachability}
+			case nodeevents.Identified, nodeevents.IdentifyFailed:
+				detail = []string{ev.Peer}
+			case nodeevents.PinAdded, nodeevents.PinRemoved:
+				detail = []string{ev.Cid, ev.Mode}
+			case nodeevents.GC:
+				detail = []string{fmt.Sprintf("removed=%d", ev.Removed), ev.Duration.String()}
+			}
+			if ev.Error != "" {
+				detail = append(detail, "error: "+ev.Error)
+			}
+			_, err := fmt.Fprintf(w, "%s %s %s\n", ev.Time.Format(time.RFC3339), ev.Type, strings.Join(detail, " "))
+			return err
+		}),
+	},
+	Type: nodeevents.Event{},
+}
@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	partition "github.com/ipfs/go-ipfs/core/partition"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var errPartitionDisabled = errors.New("partition detection is not enabled, set Partition.Enabled in the config and restart the daemon")
+
+const partitionEventsFollowOptionName = "follow"
+
+var diagPartitionCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show whether the node is cut off from its reference peers.",
+		ShortDescription: `
+'ipfs diag partition' shows the connectivity of the node to its reference
+peers: the bootstrap peers, the peers of Swarm.ProtectedPeers and those of
+Partition.Peers. The node is healthy while a quorum of them answers. Otherwise
+the state tells a failure of the local network, when no interface is up or
+the probe addresses can't be dialed either, from a remote outage, when the
+probes succeed but the peers are out of reach.
+
+The detection must be enabled in the config before the daemon starts:
+
+  > ipfs config --json Partition.Enabled true
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"events": diagPartitionEventsCmd,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+		if n.Partition == nil {
+			return errPartitionDisabled
+		}
+		r := n.Partition.Report()
+		return cmds.EmitOnce(res, &r)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, r *partition.Report) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintf(tw, "state:\t%s\n", r.State)
+			fmt.Fprintf(tw, "since:\t%s\n", r.Since.Format(time.RFC3339))
+			if r.Reason != "" {
+				fmt.Fprintf(tw, "reason:\t%s\n", r.Reason)
+			}
+			if r.Checked.IsZero() {
+				return tw.Flush()
+			}
+			fmt.Fprintf(tw, "checked:\t%s\n", r.Checked.Format(time.RFC3339))
+			fmt.Fprintf(tw, "reachable:\t%d of %d, quorum %d\n", r.Reachable, len(r.Peers), r.Quorum)
+			fmt.Fprintf(tw, "local addresses:\t%d\n", r.LocalAddrs)
+
+			fmt.Fprintln(tw)
+			fmt.Fprintln(tw, "peer\tstatus")
+			for _, p := range r.Peers {
+				status := p.Error
+				if p.Reachable {
+					status = p.RTT.Round(time.Millisecond / 10).String()
+				}
+				fmt.Fprintf(tw, "%s\t%s\n", p.Peer, status)
+			}
+			if len(r.Probes) > 0 {
+				fmt.Fprintln(tw)
+				fmt.Fprintln(tw, "probe\tstatus")
+				for _, p := range r.Probes {
+					status := p.Error
+					if p.Reachable {
+						status = "ok"
+					}
+					fmt.Fprintf(tw, "%s\t%s\n", p.Addr, status)
+				}
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: partition.Report{},
+}
+
+var diagPartitionEventsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the recent changes of the partition state.",
+		ShortDescription: `
+'ipfs diag partition events' lists the recent changes of the connectivity
+state of the node, and why they happened. With --follow, it keeps printing
+the new changes.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(partitionEventsFollowOptionName, "f", "Keep printing the new events."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+		if n.Partition == nil {
+			return errPartitionDisabled
+		}
+
+		follow, _ := req.Options[partitionEventsFollowOptionName].(bool)
+		var events <-chan partition.Event
+		if follow {
+			var cancel func()
+			events, cancel = n.Partition.Subscribe()
+			defer cancel()
+		}
+
+		for _, ev := range n.Partition.Report().Events {
+			if err := res.Emit(&ev); err != nil {
+				return err
+			}
+		}
+		if !follow {
+			return nil
+		}
+
+		if f, ok := res.(http.Flusher); ok {
+			f.Flush()
+		}
+		for {
+			select {
+			case ev := <-events:
+				if err := res.Emit(&ev); err != nil {
+					return err
+				}
+			case <-req.Context.Done():
+				return nil
+			}
+		}
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ev *partition.Event) error {
+			_, err := fmt.Fprintf(w, "%s %s -> %s: %s\n", ev.Time.Format(time.RFC3339), ev.From, ev.To, ev.Reason)
+			return err
+		}),
+	},
+	Type: partition.Event{},
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	gopath "path"
+	"strings"
 	"time"
 
 	bserv "github.com/ipfs/go-blockservice"
@@ -25,6 +27,8 @@ import (
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
 	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	pinmeta "github.com/ipfs/go-ipfs/core/pinmeta"
+	gc "github.com/ipfs/go-ipfs/gc"
 )
 
 var PinCmd = &cmds.Command{
@@ -38,6 +42,7 @@ var PinCmd = &cmds.Command{
 		"ls":     listPinCmd,
 		"verify": verifyPinCmd,
 		"update": updatePinCmd,
+		"push":   pinPushCmd,
 	},
 }
 
@@ -53,12 +58,32 @@ type AddPinOutput struct {
 const (
 	pinRecursiveOptionName = "recursive"
 	pinProgressOptionName  = "progress"
+	pinNameOptionName      = "name"
+	pinMetaOptionName      = "meta"
+	pinDepthOptionName     = "depth"
 )
 
 var addPinCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline:          "Pin objects to local storage.",
 		ShortDescription: "Stores an IPFS object(s) from a given path locally to disk.",
+		LongDescription: `
+Stores an IPFS object(s) from a given path locally to disk.
+
+A pin can be given a name with --name, and metadata with --meta, as a comma
+separated list of key=value pairs. They are listed by 'ipfs pin ls', which can
+select pins by name, and are removed with the pin.
+
+With --depth=N, only the object and its descendants down to N levels below
+it are fetched and kept from garbage collection, the deeper ones staying
+evictable: for example, --depth=1 keeps a directory and its entries, but not
+the content of the files. The object is pinned directly, and listed by
+'ipfs pin ls' with its depth.
+
+Example:
+	$ ipfs pin add --name=photos --meta=owner=alice,year=2019 <path>
+	$ ipfs pin ls --name='photo*'
+`,
 	},
 
 	Arguments: []cmds.Argument{
@@ -67,6 +92,9 @@ var addPinCmd = &cmds.Command{
 	Options: []cmds.Option{
 		cmds.BoolOption(pinRecursiveOptionName, "r", "Recursively pin the object linked to by the specified object(s).").WithDefault(true),
 		cmds.BoolOption(pinProgressOptionName, "Show progress"),
+		cmds.StringOption(pinNameOptionName, "A name for the pin."),
+		cmds.StringOption(pinMetaOptionName, "Metadata for the pin, as comma separated key=value pairs."),
+		cmds.IntOption(pinDepthOptionName, "Keep only the descendants down to this many levels below the object(s), -1 for all.").WithDefault(-1),
 	},
 	Type: AddPinOutput{},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
@@ -88,8 +116,21 @@ var addPinCmd = &cmds.Command{
 			return err
 		}
 
+		if depth, _ := req.Options[pinDepthOptionName].(int); depth >= 0 {
+			added, err := pinAddDepth(req, env, enc, depth)
+			if err != nil {
+				return err
+			}
+			return cmds.EmitOnce(res, &AddPinOutput{Pins: added})
+		}
+
+		onPinned, err := pinSetMeta(req, env)
+		if err != nil {
+			return err
+		}
+
 		if !showProgress {
-			added, err := pinAddMany(req.Context, api, enc, req.Arguments, recursive)
+			added, err := pinAddMany(req.Context, api, enc, req.Arguments, recursive, onPinned)
 			if err != nil {
 				return err
 			}
@@ -107,7 +148,7 @@ var addPinCmd = &cmds.Command{
 
 		ch := make(chan pinResult, 1)
 		go func() {
-			added, err := pinAddMany(ctx, api, enc, req.Arguments, recursive)
+			added, err := pinAddMany(ctx, api, enc, req.Arguments, recursive, onPinned)
 			ch <- pinResult{pins: added, err: err}
 		}()
 
@@ -141,7 +182,9 @@ var addPinCmd = &cmds.Command{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *AddPinOutput) error {
 			rec, found := req.Options["recursive"].(bool)
 			var pintype string
-			if rec || !found {
+			if depth, ok := req.Options[pinDepthOptionName].(int); ok && depth >= 0 {
+				pintype = fmt.Sprintf("to depth %d", depth)
+			} else if rec || !found {
 				pintype = "recursively"
 			} else {
 				pintype = "directly"
@@ -183,7 +226,43 @@ var addPinCmd = &cmds.Command{
 	},
 }
 
-func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder, paths []string, recursive bool) ([]string, error) {
+// pinMetaOptions returns the name and metadata given to 'pin add'.
+func pinMetaOptions(req *cmds.Request) (pinmeta.Meta, error) {
+	name, _ := req.Options[pinNameOptionName].(string)
+	metaStr, _ := req.Options[pinMetaOptionName].(string)
+
+	m := pinmeta.Meta{Name: name}
+	if metaStr != "" {
+		m.Meta = make(map[string]string)
+		for _, kv := range strings.Split(metaStr, ",") {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return m, fmt.Errorf("invalid metadata %q, expected key=value", kv)
+			}
+			m.Meta[parts[0]] = parts[1]
+		}
+	}
+	return m, nil
+}
+
+// pinSetMeta returns a function setting the name and metadata given to
+// 'pin add' on the pins added, or nil if none were given.
+func pinSetMeta(req *cmds.Request, env cmds.Environment) (func(c cid.Cid) error, error) {
+	m, err := pinMetaOptions(req)
+	if err != nil || m.IsEmpty() {
+		return nil, err
+	}
+
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	return func(c cid.Cid) error {
+		return n.PinMeta.Set(c, m)
+	}, nil
+}
+
+func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder, paths []string, recursive bool, onPinned func(c cid.Cid) error) ([]string, error) {
 	added := make([]string, len(paths))
 	for i, b := range paths {
 		rp, err := api.ResolvePath(ctx, path.New(b))
@@ -194,12 +273,81 @@ func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder,
 		if err := api.Pin().Add(ctx, rp, options.Pin.Recursive(recursive)); err != nil {
 			return nil, err
 		}
+		if onPinned != nil {
+			if err := onPinned(rp.Cid()); err != nil {
+				return nil, err
+			}
+		}
 		added[i] = enc.Encode(rp.Cid())
 	}
 
 	return added, nil
 }
 
+// pinAddDepth pins the objects given to 'pin add' directly, keeping their
+// descendants down to depth levels below them, which are fetched.
+func pinAddDepth(req *cmds.Request, env cmds.Environment, enc cidenc.Encoder, depth int) ([]string, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	api, err := cmdenv.GetApi(env, req)
+	if err != nil {
+		return nil, err
+	}
+	m, err := pinMetaOptions(req)
+	if err != nil {
+		return nil, err
+	}
+	m.Depth = depth
+
+	added := make([]string, len(req.Arguments))
+	for i, b := range req.Arguments {
+		rp, err := api.ResolvePath(req.Context, path.New(b))
+		if err != nil {
+			return nil, err
+		}
+		if err := pinDepth(req.Context, n, rp.Cid(), m); err != nil {
+			return nil, err
+		}
+		added[i] = enc.Encode(rp.Cid())
+	}
+	return added, nil
+}
+
+// pinDepth fetches c and its descendants down to m.Depth levels, and pins c
+// directly with the metadata m.
+func pinDepth(ctx context.Context, n *core.IpfsNode, c cid.Cid, m pinmeta.Meta) error {
+	defer n.Blockstore.PinLock().Unlock()
+
+	depths := map[cid.Cid]int{c: m.Depth}
+	if err := gc.WalkDepth(ctx, dag.GetLinksWithDAG(n.DAG), depths, func(cid.Cid) bool { return true }); err != nil {
+		return err
+	}
+	nd, err := n.DAG.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	old, _, err := n.PinMeta.Get(c)
+	if err != nil {
+		return err
+	}
+	if err := n.PinMeta.Set(c, m); err != nil {
+		return err
+	}
+	if err := n.Pinning.Pin(ctx, nd, false); err != nil {
+		if rerr := n.PinMeta.Set(c, old); rerr != nil {
+			log.Errorf("failed to restore the metadata of the pin of %s: %s", c, rerr)
+		}
+		return err
+	}
+	if err := n.Provider.Provide(c); err != nil {
+		return err
+	}
+	return n.Pinning.Flush(ctx)
+}
+
 var rmPinCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Remove pinned objects from local storage.",
@@ -265,6 +413,7 @@ const (
 	pinTypeOptionName   = "type"
 	pinQuietOptionName  = "quiet"
 	pinStreamOptionName = "stream"
+	pinLsNameOptionName = "name"
 )
 
 var listPinCmd = &cmds.Command{
@@ -294,6 +443,14 @@ With arguments, the command fails if any of the arguments is not a pinned
 object. And if --type=<type> is additionally used, the command will also fail
 if any of the arguments is not of the specified type.
 
+Use --name=<glob> to list only the pins with a name matching the glob, as
+given to 'ipfs pin add --name'. The names of the pins are listed after their
+type.
+
+The depth-limited pins made by 'ipfs pin add --depth' are direct pins, listed
+with their depth, as in "direct depth=2". The descendants they keep are not
+listed as indirect pins.
+
 Example:
 	$ echo "hello" | ipfs add -q
 	QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN
@@ -318,6 +475,7 @@ Example:
 		cmds.StringOption(pinTypeOptionName, "t", "The type of pinned keys to list. Can be \"direct\", \"indirect\", \"recursive\", or \"all\".").WithDefault("all"),
 		cmds.BoolOption(pinQuietOptionName, "q", "Write just hashes of objects."),
 		cmds.BoolOption(pinStreamOptionName, "s", "Enable streaming of pins as they are discovered."),
+		cmds.StringOption(pinLsNameOptionName, "List only the pins with a name matching this glob."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -332,6 +490,11 @@ Example:
 
 		typeStr, _ := req.Options[pinTypeOptionName].(string)
 		stream, _ := req.Options[pinStreamOptionName].(bool)
+		nameGlob, _ := req.Options[pinLsNameOptionName].(string)
+
+		if _, err := gopath.Match(nameGlob, ""); err != nil {
+			return fmt.Errorf("invalid name pattern '%s': %s", nameGlob, err)
+		}
 
 		switch typeStr {
 		case "all", "direct", "indirect", "recursive":
@@ -346,11 +509,21 @@ Example:
 		if !stream {
 			emit = func(v interface{}) error {
 				obj := v.(*PinLsOutputWrapper)
-				lgcList[obj.PinLsObject.Cid] = PinLsType{Type: obj.PinLsObject.Type}
+				lgcList[obj.PinLsObject.Cid] = PinLsType{
+					Type:  obj.PinLsObject.Type,
+					Name:  obj.PinLsObject.Name,
+					Meta:  obj.PinLsObject.Meta,
+					Depth: obj.PinLsObject.Depth,
+				}
 				return nil
 			}
 		}
 
+		emit, err = pinLsWithMeta(req, n.PinMeta, nameGlob, emit)
+		if err != nil {
+			return err
+		}
+
 		if len(req.Arguments) > 0 {
 			err = pinLsKeys(req, typeStr, n, api, emit)
 		} else {
@@ -389,7 +562,7 @@ Example:
 				if quiet {
 					fmt.Fprintf(w, "%s\n", out.PinLsObject.Cid)
 				} else {
-					fmt.Fprintf(w, "%s %s\n", out.PinLsObject.Cid, out.PinLsObject.Type)
+					fmt.Fprintf(w, "%s %s%s\n", out.PinLsObject.Cid, pinTypeText(out.PinLsObject.Type, out.PinLsObject.Depth), pinNameSuffix(out.PinLsObject.Name))
 				}
 				return nil
 			}
@@ -398,7 +571,7 @@ Example:
 				if quiet {
 					fmt.Fprintf(w, "%s\n", k)
 				} else {
-					fmt.Fprintf(w, "%s %s\n", k, v.Type)
+					fmt.Fprintf(w, "%s %s%s\n", k, pinTypeText(v.Type, v.Depth), pinNameSuffix(v.Name))
 				}
 			}
 
@@ -420,15 +593,71 @@ type PinLsList struct {
 	Keys map[string]PinLsType
 }
 
-// PinLsType contains the type of a pin
+// PinLsType contains the type of a pin, and its name, metadata and depth if
+// any
 type PinLsType struct {
-	Type string
+	Type  string
+	Name  string            `json:",omitempty"`
+	Meta  map[string]string `json:",omitempty"`
+	Depth int               `json:",omitempty"`
 }
 
 // PinLsObject contains the description of a pin
 type PinLsObject struct {
-	Cid  string `json:",omitempty"`
-	Type string `json:",omitempty"`
+	Cid   string            `json:",omitempty"`
+	Type  string            `json:",omitempty"`
+	Name  string            `json:",omitempty"`
+	Meta  map[string]string `json:",omitempty"`
+	Depth int               `json:",omitempty"`
+}
+
+// pinTypeText returns the type of a pin as listed, with the depth of the
+// depth-limited pins.
+func pinTypeText(typ string, depth int) string {
+	if depth > 0 && typ == "direct" {
+		return fmt.Sprintf("direct depth=%d", depth)
+	}
+	return typ
+}
+
+func pinNameSuffix(name string) string {
+	if name == "" {
+		return ""
+	}
+	return " " + name
+}
+
+// pinLsWithMeta returns an emit function adding the names and metadata of the
+// pins to the pins listed, and skipping the pins whose name doesn't match
+// nameGlob, if set.
+func pinLsWithMeta(req *cmds.Request, store *pinmeta.Store, nameGlob string, emit func(value interface{}) error) (func(value interface{}) error, error) {
+	all, err := store.All()
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := cmdenv.GetCidEncoder(req)
+	if err != nil {
+		return nil, err
+	}
+	metas := make(map[string]pinmeta.Meta, len(all))
+	for c, m := range all {
+		metas[enc.Encode(c)] = m
+	}
+
+	return func(v interface{}) error {
+		obj := v.(*PinLsOutputWrapper)
+		m := metas[obj.PinLsObject.Cid]
+		if nameGlob != "" {
+			if ok, _ := gopath.Match(nameGlob, m.Name); !ok || m.Name == "" {
+				return nil
+			}
+		}
+		obj.PinLsObject.Name = m.Name
+		obj.PinLsObject.Meta = m.Meta
+		obj.PinLsObject.Depth = m.Depth
+		return emit(v)
+	}, nil
 }
 
 func pinLsKeys(req *cmds.Request, typeStr string, n *core.IpfsNode, api coreiface.CoreAPI, emit func(value interface{}) error) error {
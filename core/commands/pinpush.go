@@ -0,0 +1,203 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	e "github.com/ipfs/go-ipfs/core/commands/e"
+	pinpush "github.com/ipfs/go-ipfs/core/pinpush"
+	receipt "github.com/ipfs/go-ipfs/core/receipt"
+
+	humanize "github.com/dustin/go-humanize"
+	bserv "github.com/ipfs/go-blockservice"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// PinPushOutput is the output of 'ipfs pin push': the progress of the
+// transfer, then the result reported by the peer, with Cid set.
+type PinPushOutput struct {
+	Cid    string `json:",omitempty"`
+	Peer   string `json:",omitempty"`
+	Blocks int64
+	Bytes  int64
+	Pinned bool
+
+	// Receipt is set when the peer returned a valid receipt.
+	Receipt bool `json:",omitempty"`
+}
+
+const pinPushReceiptOptionName = "receipt"
+
+var pinPushCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Pin an object on another node, sending it the blocks.",
+		ShortDescription: `
+'ipfs pin push' asks a peer to pin the DAG of an object recursively, and
+streams it the blocks of the DAG directly, rather than leaving it to fetch
+them over bitswap. The DAG must be stored locally. The peer reports how many
+blocks it received, and whether it pinned the object.
+
+A node only accepts the pushes of the peers listed in its Pin.Push.AllowFrom,
+and only on a private network:
+
+  > ipfs config --json Pin.Push.AllowFrom '["<pusher-peer-id>"]'
+
+The peer is given by its peer ID, or by its address:
+
+  > ipfs pin push QmHash /ip4/10.0.0.2/tcp/4001/p2p/<peer-id>
+
+With --receipt, the peer signs a receipt once it pinned the object, as the
+proof of its delivery. The push fails if the receipt is missing or invalid.
+The receipts are listed by 'ipfs transfer receipts'.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", true, false, "Path to the object to push."),
+		cmds.StringArg("peer", true, false, "Peer ID or /p2p address of the node to push to."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(pinProgressOptionName, "Show the progress of the transfer."),
+		cmds.BoolOption(pinPushReceiptOptionName, "Ask the peer for a signed receipt of the delivery."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		pi, err := parsePushPeer(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+		rp, err := api.ResolvePath(req.Context, path.New(req.Arguments[0]))
+		if err != nil {
+			return err
+		}
+
+		// only the blocks stored locally are pushed
+		ng := dag.NewDAGService(bserv.New(n.Blockstore, offline.Exchange(n.Blockstore)))
+		progress := new(pinpush.Progress)
+		wantReceipt, _ := req.Options[pinPushReceiptOptionName].(bool)
+
+		type pushResult struct {
+			res *pinpush.Result
+			err error
+		}
+		ch := make(chan pushResult, 1)
+		go func() {
+			r, err := pinpush.Push(req.Context, n.PeerHost, ng, pi, rp.Cid(), progress, wantReceipt)
+			ch <- pushResult{r, err}
+		}()
+
+		showProgress, _ := req.Options[pinProgressOptionName].(bool)
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case r := <-ch:
+				if r.err != nil {
+					return r.err
+				}
+				if r.res.Receipt != nil {
+					if err := receipt.NewStore(n.Repo.Datastore()).Put(r.res.Receipt); err != nil {
+						return err
+					}
+				}
+				return res.Emit(&PinPushOutput{
+					Cid:     enc.Encode(rp.Cid()),
+					Peer:    pi.ID.Pretty(),
+					Blocks:  int64(r.res.Blocks),
+					Bytes:   r.res.Bytes,
+					Pinned:  r.res.Pinned,
+					Receipt: r.res.Receipt != nil,
+				})
+			case <-ticker.C:
+				if !showProgress {
+					continue
+				}
+				err := res.Emit(&PinPushOutput{Blocks: progress.Blocks(), Bytes: progress.Bytes()})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinPushOutput) error {
+			if out.Cid == "" {
+				return nil
+			}
+			status := "not pinned"
+			if out.Pinned {
+				status = "pinned"
+			}
+			if out.Receipt {
+				status += ", receipt received"
+			}
+			fmt.Fprintf(w, "pushed %s to %s: %d blocks (%s), %s\n", out.Cid, out.Peer, out.Blocks, humanize.Bytes(uint64(out.Bytes)), status)
+			return nil
+		}),
+	},
+	PostRun: cmds.PostRunMap{
+		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+			for {
+				v, err := res.Next()
+				if err != nil {
+					if err == io.EOF {
+						return nil
+					}
+					return err
+				}
+
+				out, ok := v.(*PinPushOutput)
+				if !ok {
+					return e.TypeErr(out, v)
+				}
+				if out.Cid == "" {
+					fmt.Fprintf(os.Stderr, "Sent %d blocks (%s)\r", out.Blocks, humanize.Bytes(uint64(out.Bytes)))
+					continue
+				}
+				if err := re.Emit(out); err != nil {
+					return err
+				}
+			}
+		},
+	},
+	Type: PinPushOutput{},
+}
+
+// parsePushPeer parses a peer ID, or a /p2p address.
+func parsePushPeer(s string) (peer.AddrInfo, error) {
+	if id, err := peer.Decode(s); err == nil {
+		return peer.AddrInfo{ID: id}, nil
+	}
+	a, err := ma.NewMultiaddr(s)
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("%q is neither a peer ID nor an address", s)
+	}
+	pi, err := peer.AddrInfoFromP2pAddr(a)
+	if err != nil {
+		return peer.AddrInfo{}, err
+	}
+	return *pi, nil
+}
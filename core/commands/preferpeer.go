@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"strings"
+	"sync"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+const preferPeerOptionName = "prefer-peer"
+
+var preferPeerOption = cmds.StringOption(preferPeerOptionName, "Comma-separated peers to fetch from first, by peer ID or multiaddr ending in /p2p/<peer ID>.")
+
+// preferPeers connects to the peers given with --prefer-peer, and hands them
+// to bitswap before the other providers of the blocks until release is
+// called. Peers which can't be reached are skipped.
+func preferPeers(req *cmds.Request, env cmds.Environment) (release func(), err error) {
+	opt, _ := req.Options[preferPeerOptionName].(string)
+	if opt == "" {
+		return func() {}, nil
+	}
+
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	if !n.IsOnline {
+		return nil, ErrNotOnline
+	}
+	api, err := cmdenv.GetApi(env, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids, addrs []string
+	for _, s := range strings.Split(opt, ",") {
+		if s = strings.TrimSpace(s); strings.HasPrefix(s, "/") {
+			addrs = append(addrs, s)
+		} else if s != "" {
+			ids = append(ids, s)
+		}
+	}
+
+	pis, err := parseAddresses(req.Context, addrs)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ids {
+		id, err := peer.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		pis = append(pis, peer.AddrInfo{ID: id})
+	}
+
+	var wg sync.WaitGroup
+	preferred := make([]peer.ID, len(pis))
+	for i, pi := range pis {
+		preferred[i] = pi.ID
+		wg.Add(1)
+		go func(pi peer.AddrInfo) {
+			defer wg.Done()
+			if err := api.Swarm().Connect(req.Context, pi); err != nil {
+				log.Warningf("connecting to preferred peer %s: %s", pi.ID, err)
+			}
+		}(pi)
+	}
+	wg.Wait()
+
+	return n.ProviderSel.Prefer(preferred), nil
+}
@@ -0,0 +1,97 @@
+package commands
+
+import (
+	libp2p "github.com/ipfs/go-ipfs/core/node/libp2p"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	config "github.com/ipfs/go-ipfs-config"
+)
+
+// Profiles are the configuration profiles of go-ipfs, on top of the ones of
+// go-ipfs-config. They are registered in config.Profiles, so that they can be
+// used by 'ipfs init --profile' and 'ipfs config profile apply' alike.
+var Profiles = map[string]config.Profile{
+	"private": {
+		Description: `Configures a member of a private network, keeping the discovery in local
+networks. Removes the public bootstrap peers: add the bootstrap peers of the
+private network afterwards. Refuses to start the node without a swarm key,
+so that it never joins the public network. Applied by
+'ipfs init --swarm-key-gen' and 'ipfs init --swarm-key-file'.`,
+
+		Transform: privateTransform,
+	},
+	"pnet": {
+		Description: `Configures a member of a private network as the 'private' profile does, and
+disables the local discovery.`,
+
+		Transform: pnetTransform,
+	},
+	"pnet-cluster": {
+		Description: `Configures a member of a private network cluster running in a container, as
+the 'pnet' profile does. Makes the node a DHT server, disables the NAT
+traversal features and listens for gateway requests on all the interfaces
+of the container, to be published by the container runtime. The API, which
+isn't authenticated until API.Authorizations are added, stays on the
+loopback interface: add a token with 'ipfs config api token add' before
+listening on the other interfaces.`,
+
+		Transform: func(c *config.Config) error {
+			if err := pnetTransform(c); err != nil {
+				return err
+			}
+			c.Routing.Type = "dht"
+			c.Swarm.DisableNatPortMap = true
+			c.Swarm.EnableAutoRelay = false
+			c.Swarm.EnableAutoNATService = false
+			c.Addresses.API = config.Strings{"/ip4/127.0.0.1/tcp/5001"}
+			c.Addresses.Gateway = config.Strings{"/ip4/0.0.0.0/tcp/8080"}
+			return nil
+		},
+	},
+}
+
+// privateTransform is the transform of the private profile, which the other
+// private network profiles build on.
+func privateTransform(c *config.Config) error {
+	c.Bootstrap = []string{}
+	return nil
+}
+
+// pnetTransform is the transform of the pnet profile.
+func pnetTransform(c *config.Config) error {
+	if err := privateTransform(c); err != nil {
+		return err
+	}
+	c.Discovery.MDNS.Enabled = false
+	return nil
+}
+
+// pnetKeys are the ProfileKeys of the private network profiles.
+var pnetKeys = map[string]interface{}{
+	libp2p.ForcePNetConfigKey: true,
+}
+
+// ProfileKeys are the keys set by the profiles which are not fields of
+// config.Config, and so can't be set by their Transform. They are set in the
+// repo once the profile is applied.
+var ProfileKeys = map[string]map[string]interface{}{
+	"private":      pnetKeys,
+	"pnet":         pnetKeys,
+	"pnet-cluster": pnetKeys,
+}
+
+// SetProfileKeys sets the ProfileKeys of profile in r.
+func SetProfileKeys(r repo.Repo, profile string) error {
+	for k, v := range ProfileKeys[profile] {
+		if err := r.SetConfigKey(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	for name, p := range Profiles {
+		config.Profiles[name] = p
+	}
+}
@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	replica "github.com/ipfs/go-ipfs/core/replica"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var errReplicaDisabled = errors.New("replication is not configured, set Replica.Primary or Replica.Replicas in the config and restart the daemon")
+
+// ReplicaStatus is the output of 'ipfs replica status'.
+type ReplicaStatus struct {
+	// Follower is the status of the replication of the primary of the
+	// node, if it has one.
+	Follower *replica.Status `json:",omitempty"`
+
+	// Replicas are the replicas of the node, if it is a primary.
+	Replicas []replica.ReplicaInfo `json:",omitempty"`
+}
+
+var ReplicaCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Replicate the content of a primary node.",
+		ShortDescription: `
+A read replica pins the content pinned by its primary, and the root of its
+files API (MFS), syncing every Replica.Interval. Its gateway only serves the
+replicated content, and answers the requests for content not replicated yet
+with 503 Service Unavailable.
+
+On the replica:
+
+  > ipfs config Replica.Primary /ip4/10.0.0.1/tcp/4001/p2p/<primary-id>
+
+On the primary:
+
+  > ipfs config --json Replica.Replicas '["<replica-id>"]'
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"status": replicaStatusCmd,
+	},
+}
+
+var replicaStatusCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the replication status.",
+		ShortDescription: `
+'ipfs replica status' shows, on a replica, when its primary was last
+contacted and how old the replicated content is, and on a primary, how far
+behind each of its replicas is.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+		if n.Replica == nil {
+			return errReplicaDisabled
+		}
+
+		var out ReplicaStatus
+		if n.Replica.Follower != nil {
+			st := n.Replica.Follower.Status()
+			out.Follower = &st
+		}
+		if n.Replica.Server != nil {
+			out.Replicas = n.Replica.Server.Replicas()
+		}
+		return cmds.EmitOnce(res, &out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ReplicaStatus) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			if st := out.Follower; st != nil {
+				fmt.Fprintf(tw, "primary:\t%s\n", st.Primary)
+				fmt.Fprintf(tw, "last contact:\t%s\n", formatReplicaTime(st.LastContact))
+				fmt.Fprintf(tw, "synced:\t%s\n", formatReplicaTime(st.Synced))
+				if !st.Synced.IsZero() {
+					fmt.Fprintf(tw, "lag:\t%s\n", st.Lag.Round(time.Second))
+				}
+				fmt.Fprintf(tw, "replicated:\t%d\n", st.Replicated)
+				fmt.Fprintf(tw, "pending:\t%d\n", st.Pending)
+				if st.LastError != "" {
+					fmt.Fprintf(tw, "error:\t%s\n", st.LastError)
+				}
+			}
+			if len(out.Replicas) > 0 {
+				if out.Follower != nil {
+					fmt.Fprintln(tw)
+				}
+				fmt.Fprintln(tw, "replica\tlast seen\tlag\tpending")
+				for _, r := range out.Replicas {
+					lag := "-"
+					if !r.Synced.IsZero() {
+						lag = time.Since(r.Synced).Round(time.Second).String()
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", r.Peer, formatReplicaTime(r.LastSeen), lag, r.Pending)
+				}
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: ReplicaStatus{},
+}
+
+func formatReplicaTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -15,6 +15,7 @@ import (
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+	packstore "github.com/ipfs/go-ipfs/repo/packstore"
 
 	cid "github.com/ipfs/go-cid"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
@@ -34,11 +35,13 @@ var RepoCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"stat":    repoStatCmd,
-		"gc":      repoGcCmd,
-		"fsck":    repoFsckCmd,
-		"version": repoVersionCmd,
-		"verify":  repoVerifyCmd,
+		"stat":      repoStatCmd,
+		"gc":        repoGcCmd,
+		"badger-gc": repoBadgerGcCmd,
+		"compact":   repoCompactCmd,
+		"fsck":      repoFsckCmd,
+		"version":   repoVersionCmd,
+		"verify":    repoVerifyCmd,
 	},
 }
 
@@ -46,11 +49,16 @@ var RepoCmd = &cmds.Command{
 type GcResult struct {
 	Key   cid.Cid
 	Error string `json:",omitempty"`
+
+	// Stats is emitted last, with --stats.
+	Stats *corerepo.GCStats `json:",omitempty"`
 }
 
 const (
 	repoStreamErrorsOptionName = "stream-errors"
 	repoQuietOptionName        = "quiet"
+	repoDryRunOptionName       = "dry-run"
+	repoStatsOptionName        = "stats"
 )
 
 var repoGcCmd = &cmds.Command{
@@ -60,11 +68,21 @@ var repoGcCmd = &cmds.Command{
 'ipfs repo gc' is a plumbing command that will sweep the local
 set of stored objects and remove ones that are not pinned in
 order to reclaim hard disk space.
+
+With --dry-run, nothing is removed: the command lists the objects a
+collection would remove. With --stats, it reports how many objects and
+bytes are removed instead of listing them, grouped by the time since the
+objects were written. The ages are known for the repos storing their blocks
+in flatfs only.
+
+  > ipfs repo gc --dry-run --stats
 `,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(repoStreamErrorsOptionName, "Stream errors."),
 		cmds.BoolOption(repoQuietOptionName, "q", "Write minimal output."),
+		cmds.BoolOption(repoDryRunOptionName, "Only report the objects that would be removed."),
+		cmds.BoolOption(repoStatsOptionName, "Report the number and size of the objects removed, by age."),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -73,8 +91,17 @@ order to reclaim hard disk space.
 		}
 
 		streamErrors, _ := req.Options[repoStreamErrorsOptionName].(bool)
+		dryRun, _ := req.Options[repoDryRunOptionName].(bool)
+		withStats, _ := req.Options[repoStatsOptionName].(bool)
 
-		gcOutChan := corerepo.GarbageCollectAsync(n, req.Context)
+		var stats *corerepo.GCStats
+		if withStats {
+			stats = corerepo.NewGCStats()
+		}
+		gcOutChan := corerepo.GarbageCollectWith(n, req.Context, corerepo.GCOptions{
+			DryRun: dryRun,
+			Stats:  stats,
+		})
 
 		if streamErrors {
 			errs := false
@@ -84,7 +111,7 @@ order to reclaim hard disk space.
 						return err
 					}
 					errs = true
-				} else {
+				} else if !withStats {
 					if err := re.Emit(&GcResult{Key: res.KeyRemoved}); err != nil {
 						return err
 					}
@@ -95,6 +122,9 @@ order to reclaim hard disk space.
 			}
 		} else {
 			err := corerepo.CollectResult(req.Context, gcOutChan, func(k cid.Cid) {
+				if withStats {
+					return
+				}
 				// Nothing to do with this error, really. This
 				// most likely means that the client is gone but
 				// we still need to let the GC finish.
@@ -105,6 +135,9 @@ order to reclaim hard disk space.
 			}
 		}
 
+		if withStats {
+			return re.Emit(&GcResult{Stats: stats})
+		}
 		return nil
 	},
 	Type: GcResult{},
@@ -117,7 +150,25 @@ order to reclaim hard disk space.
 				return err
 			}
 
+			dryRun, _ := req.Options[repoDryRunOptionName].(bool)
+			if gcr.Stats != nil {
+				verb := "Removed"
+				if dryRun {
+					verb = "Would remove"
+				}
+				fmt.Fprintf(w, "%s %d objects, %s\n", verb, gcr.Stats.Blocks, humanize.Bytes(gcr.Stats.Bytes))
+				tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "AGE\tOBJECTS\tSIZE\t")
+				for _, b := range gcr.Stats.Ages {
+					fmt.Fprintf(tw, "%s\t%d\t%s\t\n", b.Age, b.Blocks, humanize.Bytes(b.Bytes))
+				}
+				return tw.Flush()
+			}
+
 			prefix := "removed "
+			if dryRun {
+				prefix = "would remove "
+			}
 			if quiet {
 				prefix = ""
 			}
@@ -131,6 +182,7 @@ order to reclaim hard disk space.
 const (
 	repoSizeOnlyOptionName = "size-only"
 	repoHumanOptionName    = "human"
+	repoDetailedOptionName = "detailed"
 )
 
 var repoStatCmd = &cmds.Command{
@@ -145,11 +197,22 @@ StorageMax      string Maximum datastore size (from configuration)
 NumObjects      int Number of objects in the local repo.
 RepoPath        string The path to the repo being currently used.
 Version         string The repo version.
+
+When the datastore is made of mounts, as the default one, the size of each
+mount is reported too, with the type of its datastore.
+
+The number of objects is kept up to date as they are written and removed,
+and measured with the size of the repo while the writes wait. After the node
+was stopped abruptly, the first 'ipfs repo stat' counts the objects again.
+
+With --detailed, the objects are enumerated to report their number and
+sizes by CID prefix, and the objects packed by 'ipfs repo compact'.
 `,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(repoSizeOnlyOptionName, "s", "Only report RepoSize and StorageMax."),
 		cmds.BoolOption(repoHumanOptionName, "H", "Print sizes in human readable format (e.g., 1K 234M 2G)"),
+		cmds.BoolOption(repoDetailedOptionName, "Also report the objects by CID prefix and size. Enumerates the objects."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -173,6 +236,13 @@ Version         string The repo version.
 			return err
 		}
 
+		if detailed, _ := req.Options[repoDetailedOptionName].(bool); detailed {
+			stat.Detailed, err = corerepo.RepoStatDetailed(req.Context, n)
+			if err != nil {
+				return err
+			}
+		}
+
 		return cmds.EmitOnce(res, &stat)
 	},
 	Type: &corerepo.Stat{},
@@ -203,8 +273,114 @@ Version         string The repo version.
 			if !sizeOnly {
 				fmt.Fprintf(wtr, "RepoPath:\t%s\n", stat.RepoPath)
 				fmt.Fprintf(wtr, "Version:\t%s\n", stat.Version)
+				for _, m := range stat.Mounts {
+					printSize(fmt.Sprintf("Mount %s (%s)", m.Mountpoint, m.Type), m.Size)
+				}
+			}
+
+			if d := stat.Detailed; d != nil {
+				if p := d.Packs; p != nil {
+					fmt.Fprintf(wtr, "NumPacks:\t%d\n", p.Packs)
+					fmt.Fprintf(wtr, "PackedObjects:\t%d\n", p.Blocks)
+					printSize("PackedSize", p.Bytes)
+					printSize("PacksSize", p.Size)
+				}
+				wtr.Flush()
+
+				tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+				for _, p := range d.Prefixes {
+					fmt.Fprintf(tw, "\n%s\t%d objects\t%s\t\n", p.Prefix, p.Blocks, humanize.Bytes(p.Bytes))
+					for _, b := range p.Sizes {
+						if b.Blocks == 0 {
+							continue
+						}
+						fmt.Fprintf(tw, "  %s\t%d\t%s\t\n", b.Size, b.Blocks, humanize.Bytes(b.Bytes))
+					}
+				}
+				return tw.Flush()
+			}
+
+			return nil
+		}),
+	},
+}
+
+const repoMaxBlockSizeOptionName = "max-block-size"
+
+var repoCompactCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Pack the small objects of the repo into larger files.",
+		ShortDescription: `
+'ipfs repo compact' moves the objects no larger than --max-block-size out
+of the blockstore, where flatfs keeps a file per object, into pack files
+in the 'packs' directory of the repo. It also rewrites the pack files
+mostly holding removed objects, to reclaim their room.
+
+The node keeps running meanwhile: the objects stay readable while they are
+moved.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.IntOption(repoMaxBlockSizeOptionName, "Size in bytes of the largest object packed.").WithDefault(packstore.DefaultMaxBlockSize),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		maxBlockSize, _ := req.Options[repoMaxBlockSizeOptionName].(int)
+		out, err := corerepo.Compact(req.Context, n, packstore.CompactOptions{
+			MaxBlockSize: maxBlockSize,
+		})
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &out)
+	},
+	Type: packstore.CompactResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *packstore.CompactResult) error {
+			fmt.Fprintf(w, "Packed %d objects, %s\n", out.Packed, humanize.Bytes(out.PackedBytes))
+			if out.Rewritten > 0 {
+				fmt.Fprintf(w, "Rewrote %d packs, reclaiming %s\n", out.Rewritten, humanize.Bytes(out.Reclaimed))
 			}
+			return nil
+		}),
+	},
+}
+
+var repoBadgerGcCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Collect the value log of a badger datastore.",
+		ShortDescription: `
+'ipfs repo badger-gc' rewrites the value log files of the badger datastore
+of the repo which mostly hold removed objects, and reports the disk space
+reclaimed. Run it after 'ipfs repo gc' to give the room of the removed
+objects back to the filesystem.
+
+The node keeps running meanwhile. The share of garbage a value log file must
+hold to be rewritten is the 'gcDiscardRatio' of the badger datastore in
+Datastore.Spec.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
 
+		out, err := corerepo.BadgerGC(req.Context, n)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &out)
+	},
+	Type: corerepo.BadgerGCResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *corerepo.BadgerGCResult) error {
+			fmt.Fprintf(w, "Reclaimed %s (%s -> %s)\n", humanize.Bytes(out.Reclaimed),
+				humanize.Bytes(out.SizeBefore), humanize.Bytes(out.SizeAfter))
 			return nil
 		}),
 	},
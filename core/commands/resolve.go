@@ -1,19 +1,21 @@
 package commands
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
-	ncmd "github.com/ipfs/go-ipfs/core/commands/name"
 	ns "github.com/ipfs/go-ipfs/namesys"
 
 	cidenc "github.com/ipfs/go-cidutil/cidenc"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	ipfspath "github.com/ipfs/go-path"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	options "github.com/ipfs/interface-go-ipfs-core/options"
 	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	path "github.com/ipfs/interface-go-ipfs-core/path"
@@ -23,6 +25,16 @@ const (
 	resolveRecursiveOptionName      = "recursive"
 	resolveDhtRecordCountOptionName = "dht-record-count"
 	resolveDhtTimeoutOptionName     = "dht-timeout"
+	resolveConcurrencyOptionName    = "concurrency"
+	resolveStatsOptionName          = "stats"
+)
+
+const (
+	// defaultResolveConcurrency is the number of names resolved in
+	// parallel by default, and on the APIs without --concurrency.
+	defaultResolveConcurrency = 16
+	// maxResolveConcurrency bounds the names resolved in parallel.
+	maxResolveConcurrency = 64
 )
 
 var ResolveCmd = &cmds.Command{
@@ -62,16 +74,26 @@ Resolve the value of an IPFS DAG path:
   $ ipfs resolve /ipfs/QmeZy1fGbwgVSrqbfh9fKQrAWgeyRnj7h8fsHS1oy3k99x/beep/boop
   /ipfs/QmYRMjyvAiHKN9UTi8Bzt1HUspmSRD8T8DwxfSMzLgBon1
 
+Resolve many names read from stdin, in parallel, and report how often the
+name cache was hit:
+
+  $ cat names.txt | ipfs resolve --stats
+  /ipns/ipfs.io: /ipfs/QmYNQJoKGNHTpPxCBPh9KkDpaExgd2duMa3aF6ytMpHdao
+  /ipns/docs.ipfs.io: /ipfs/QmS2HL9v5YeKgQkkWMvs1EMnFtUowTEdFfSSeMT4pos1e6
+  resolved: 2, failed: 0, cache hits: 0, cache misses: 2
+
 `,
 	},
 
 	Arguments: []cmds.Argument{
-		cmds.StringArg("name", true, false, "The name to resolve.").EnableStdin(),
+		cmds.StringArg("name", true, true, "The names to resolve.").EnableStdin(),
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(resolveRecursiveOptionName, "r", "Resolve until the result is an IPFS name.").WithDefault(true),
 		cmds.IntOption(resolveDhtRecordCountOptionName, "dhtrc", "Number of records to request for DHT resolution."),
 		cmds.StringOption(resolveDhtTimeoutOptionName, "dhtt", "Max time to collect values during DHT resolution eg \"30s\". Pass 0 for no timeout."),
+		cmds.IntOption(resolveConcurrencyOptionName, "Number of names to resolve in parallel when resolving several names, at most 64.").WithDefault(defaultResolveConcurrency),
+		cmds.BoolOption(resolveStatsOptionName, "Report resolution and name cache statistics when done."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -79,73 +101,211 @@ Resolve the value of an IPFS DAG path:
 			return err
 		}
 
-		name := req.Arguments[0]
-		recursive, _ := req.Options[resolveRecursiveOptionName].(bool)
-
-		var enc cidenc.Encoder
-		switch {
-		case !cmdenv.CidBaseDefined(req):
-			// Not specified, check the path.
-			enc, err = cmdenv.CidEncoderFromPath(name)
-			if err == nil {
-				break
-			}
-			// Nope, fallback on the default.
-			fallthrough
-		default:
-			enc, err = cmdenv.GetCidEncoder(req)
+		stats, _ := req.Options[resolveStatsOptionName].(bool)
+		if len(req.Arguments) == 1 && !stats {
+			p, err := resolveName(req.Context, api, req, req.Arguments[0])
 			if err != nil {
 				return err
 			}
+			return cmds.EmitOnce(res, &ResolveOutput{Path: p})
 		}
 
-		// the case when ipns is resolved step by step
-		if strings.HasPrefix(name, "/ipns/") && !recursive {
-			rc, rcok := req.Options[resolveDhtRecordCountOptionName].(uint)
-			dhtt, dhttok := req.Options[resolveDhtTimeoutOptionName].(string)
-			ropts := []options.NameResolveOption{
-				options.Name.ResolveOption(nsopts.Depth(1)),
-			}
+		concurrency, ok := req.Options[resolveConcurrencyOptionName].(int)
+		if !ok {
+			concurrency = defaultResolveConcurrency
+		}
+		if concurrency <= 0 {
+			return fmt.Errorf("concurrency must be greater than 0, was %d", concurrency)
+		}
+		if concurrency > maxResolveConcurrency {
+			concurrency = maxResolveConcurrency
+		}
+		if concurrency > len(req.Arguments) {
+			concurrency = len(req.Arguments)
+		}
 
-			if rcok {
-				ropts = append(ropts, options.Name.ResolveOption(nsopts.DhtRecordCount(rc)))
+		// Cache counters are node-wide, so only the difference is reported.
+		// They are unavailable when the command runs with its own offline
+		// name system.
+		var nscache ns.Cache
+		if offline, _ := req.Options[OfflineOption].(bool); !offline {
+			if nd, err := cmdenv.GetNode(env); err == nil {
+				nscache, _ = nd.Namesys.(ns.Cache)
 			}
-			if dhttok {
-				d, err := time.ParseDuration(dhtt)
-				if err != nil {
-					return err
+		}
+		var before ns.CacheStats
+		if nscache != nil {
+			before = nscache.CacheStats()
+		}
+
+		ctx, cancel := context.WithCancel(req.Context)
+		defer cancel()
+
+		names := make(chan string)
+		results := make(chan *ResolveOutput)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for name := range names {
+					out := &ResolveOutput{Name: name}
+					p, err := resolveName(ctx, api, req, name)
+					if err != nil {
+						out.Error = err.Error()
+					} else {
+						out.Path = p
+					}
+
+					select {
+					case results <- out:
+					case <-ctx.Done():
+						return
+					}
 				}
-				if d < 0 {
-					return errors.New("DHT timeout value must be >= 0")
+			}()
+		}
+
+		go func() {
+			defer close(names)
+			for _, name := range req.Arguments {
+				select {
+				case names <- name:
+				case <-ctx.Done():
+					return
 				}
-				ropts = append(ropts, options.Name.ResolveOption(nsopts.DhtTimeout(d)))
 			}
-			p, err := api.Name().Resolve(req.Context, name, ropts...)
-			// ErrResolveRecursion is fine
-			if err != nil && err != ns.ErrResolveRecursion {
+		}()
+
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+
+		summary := &ResolveStats{}
+		for out := range results {
+			if out.Error != "" {
+				summary.Failed++
+			} else {
+				summary.Resolved++
+			}
+			if err := res.Emit(out); err != nil {
 				return err
 			}
-			return cmds.EmitOnce(res, &ncmd.ResolvedPath{Path: ipfspath.Path(p.String())})
 		}
-
-		// else, ipfs path or ipns with recursive flag
-		rp, err := api.ResolvePath(req.Context, path.New(name))
-		if err != nil {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
 
-		encoded := "/" + rp.Namespace() + "/" + enc.Encode(rp.Cid())
-		if remainder := rp.Remainder(); remainder != "" {
-			encoded += "/" + remainder
+		if !stats {
+			return nil
 		}
-
-		return cmds.EmitOnce(res, &ncmd.ResolvedPath{Path: ipfspath.Path(encoded)})
+		if nscache != nil {
+			after := nscache.CacheStats()
+			summary.CacheHits = after.Hits - before.Hits
+			summary.CacheMisses = after.Misses - before.Misses
+		}
+		return res.Emit(&ResolveOutput{Stats: summary})
 	},
 	Encoders: cmds.EncoderMap{
-		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, rp *ncmd.ResolvedPath) error {
-			fmt.Fprintln(w, rp.Path.String())
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ResolveOutput) error {
+			switch {
+			case out.Stats != nil:
+				fmt.Fprintf(w, "resolved: %d, failed: %d, cache hits: %d, cache misses: %d\n",
+					out.Stats.Resolved, out.Stats.Failed, out.Stats.CacheHits, out.Stats.CacheMisses)
+			case out.Name == "":
+				fmt.Fprintln(w, out.Path.String())
+			case out.Error != "":
+				fmt.Fprintf(w, "%s: error: %s\n", out.Name, out.Error)
+			default:
+				fmt.Fprintf(w, "%s: %s\n", out.Name, out.Path)
+			}
 			return nil
 		}),
 	},
-	Type: ncmd.ResolvedPath{},
+	Type: ResolveOutput{},
+}
+
+// ResolveOutput is the output of 'ipfs resolve'. When resolving a single name
+// only Path is set. When resolving several names, one output carrying Name
+// and either Path or Error is emitted per name, optionally followed by an
+// output carrying only Stats.
+type ResolveOutput struct {
+	Path  ipfspath.Path
+	Name  string        `json:",omitempty"`
+	Error string        `json:",omitempty"`
+	Stats *ResolveStats `json:",omitempty"`
+}
+
+// ResolveStats summarizes a batch resolution.
+type ResolveStats struct {
+	Resolved    int
+	Failed      int
+	CacheHits   uint64
+	CacheMisses uint64
+}
+
+// resolveName resolves a single name according to the options of req.
+func resolveName(ctx context.Context, api coreiface.CoreAPI, req *cmds.Request, name string) (ipfspath.Path, error) {
+	recursive, _ := req.Options[resolveRecursiveOptionName].(bool)
+
+	var enc cidenc.Encoder
+	var err error
+	switch {
+	case !cmdenv.CidBaseDefined(req):
+		// Not specified, check the path.
+		enc, err = cmdenv.CidEncoderFromPath(name)
+		if err == nil {
+			break
+		}
+		// Nope, fallback on the default.
+		fallthrough
+	default:
+		enc, err = cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// the case when ipns is resolved step by step
+	if strings.HasPrefix(name, "/ipns/") && !recursive {
+		rc, rcok := req.Options[resolveDhtRecordCountOptionName].(uint)
+		dhtt, dhttok := req.Options[resolveDhtTimeoutOptionName].(string)
+		ropts := []options.NameResolveOption{
+			options.Name.ResolveOption(nsopts.Depth(1)),
+		}
+
+		if rcok {
+			ropts = append(ropts, options.Name.ResolveOption(nsopts.DhtRecordCount(rc)))
+		}
+		if dhttok {
+			d, err := time.ParseDuration(dhtt)
+			if err != nil {
+				return "", err
+			}
+			if d < 0 {
+				return "", errors.New("DHT timeout value must be >= 0")
+			}
+			ropts = append(ropts, options.Name.ResolveOption(nsopts.DhtTimeout(d)))
+		}
+		p, err := api.Name().Resolve(ctx, name, ropts...)
+		// ErrResolveRecursion is fine
+		if err != nil && err != ns.ErrResolveRecursion {
+			return "", err
+		}
+		return ipfspath.Path(p.String()), nil
+	}
+
+	// else, ipfs path or ipns with recursive flag
+	rp, err := api.ResolvePath(ctx, path.New(name))
+	if err != nil {
+		return "", err
+	}
+
+	encoded := "/" + rp.Namespace() + "/" + enc.Encode(rp.Cid())
+	if remainder := rp.Remainder(); remainder != "" {
+		encoded += "/" + remainder
+	}
+
+	return ipfspath.Path(encoded), nil
 }
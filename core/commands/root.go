@@ -37,6 +37,8 @@ BASIC COMMANDS
   get <ref>     Download IPFS objects
   ls <ref>      List links from an object
   refs <ref>    List hashes of links from an object
+  verify-manifest <manifest>
+                Verify a tree against its manifest
 
 DATA STRUCTURE COMMANDS
   block         Interact with raw blocks in the datastore
@@ -49,13 +51,18 @@ ADVANCED COMMANDS
   mount         Mount an IPFS read-only mountpoint
   resolve       Resolve any type of name
   name          Publish and resolve IPNS names
+  channel       Publish and follow versions of a dataset
   key           Create and list IPNS name keypairs
   dns           Resolve DNS links
   pin           Pin objects to local storage
+  archive       Offload pins to long-term storage
+  backup        Use the node as a deduplicating backup store
   repo          Manipulate the IPFS repository
+  replica       Replicate the content of a primary node
   stats         Various operational stats
   p2p           Libp2p stream mounting
   filestore     Manage the filestore (experimental)
+  kv            Shared key-value store (experimental)
 
 NETWORK COMMANDS
   id            Show info about IPFS peers
@@ -63,15 +70,20 @@ NETWORK COMMANDS
   swarm         Manage connections to the p2p network
   dht           Query the DHT for values or peers
   ping          Measure the latency of a connection
+  slo           Monitor the latency and the availability of chosen peers
   diag          Print diagnostics
+  discovery     Inspect the discovery of peers and content
+  transfer      Inspect the content transfers to other peers
 
 TOOL COMMANDS
   config        Manage configuration
+  content-type  Manage the content types the gateway serves files with
   version       Show ipfs version information
   update        Download and apply go-ipfs updates
   commands      List all available commands
   cid           Convert and discover properties of CIDs
   log           Manage and show logs of running daemon
+  bench         Run built-in performance benchmarks
 
 Use 'ipfs <command> --help' to learn more about each command.
 
@@ -113,13 +125,18 @@ var CommandsDaemonCmd = CommandsCmd(Root)
 
 var rootSubcommands = map[string]*cmds.Command{
 	"add":       AddCmd,
+	"archive":   ArchiveCmd,
+	"backup":    BackupCmd,
+	"bench":     BenchCmd,
 	"bitswap":   BitswapCmd,
 	"block":     BlockCmd,
 	"cat":       CatCmd,
+	"channel":   ChannelCmd,
 	"commands":  CommandsDaemonCmd,
 	"files":     FilesCmd,
 	"filestore": FileStoreCmd,
 	"get":       GetCmd,
+	"kv":        KVCmd,
 	"pubsub":    PubsubCmd,
 	"repo":      RepoCmd,
 	"stats":     StatsCmd,
@@ -128,6 +145,7 @@ var rootSubcommands = map[string]*cmds.Command{
 	"dag":       dag.DagCmd,
 	"dht":       DhtCmd,
 	"diag":      DiagCmd,
+	"discovery": DiscoveryCmd,
 	"dns":       DNSCmd,
 	"id":        IDCmd,
 	"key":       KeyCmd,
@@ -140,15 +158,21 @@ var rootSubcommands = map[string]*cmds.Command{
 	"ping":      PingCmd,
 	"p2p":       P2PCmd,
 	"refs":      RefsCmd,
+	"replica":   ReplicaCmd,
 	"resolve":   ResolveCmd,
 	"swarm":     SwarmCmd,
 	"tar":       TarCmd,
+	"transfer":  TransferCmd,
 	"file":      unixfs.UnixFSCmd,
 	"update":    ExternalBinary("Please see https://git.io/fjylH for installation instructions."),
 	"urlstore":  urlStoreCmd,
 	"version":   VersionCmd,
 	"shutdown":  daemonShutdownCmd,
 	"cid":       CidCmd,
+
+	"verify-manifest": VerifyManifestCmd,
+	"content-type":    ContentTypeCmd,
+	"slo":             SLOCmd,
 }
 
 // RootRO is the readonly version of Root
@@ -162,16 +186,69 @@ var RefsROCmd = &cmds.Command{}
 // VersionROCmd is `ipfs version` command (without deps).
 var VersionROCmd = &cmds.Command{}
 
+// CatROCmd is `ipfs cat` command (without --prefer-peer).
+var CatROCmd = &cmds.Command{}
+
+// GetROCmd is `ipfs get` command (without --prefer-peer).
+var GetROCmd = &cmds.Command{}
+
+// withoutOptions sanitizes cmd, a copy of a command, for the APIs served to
+// anonymous clients, removing the options with side effects, as
+// --prefer-peer, which dials the peers given. The cmds parser keeps the
+// options a command doesn't declare, so they are rejected too.
+func withoutOptions(cmd *cmds.Command, names ...string) {
+	denied := make(map[string]bool, len(names))
+	for _, name := range names {
+		denied[name] = true
+	}
+	opts := make([]cmds.Option, 0, len(cmd.Options))
+	for _, opt := range cmd.Options {
+		if !denied[opt.Name()] {
+			opts = append(opts, opt)
+		}
+	}
+	cmd.Options = opts
+
+	run := cmd.Run
+	cmd.Run = func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		for _, name := range names {
+			if _, ok := req.Options[name]; ok {
+				return cmds.Errorf(cmds.ErrClient, "option --%s is not allowed on this API", name)
+			}
+		}
+		return run(req, res, env)
+	}
+}
+
+// RootPublic is the command tree of the public API, the vetted read-only
+// subset served to the untrusted clients on Addresses.PublicAPI. A command
+// missing from it can't be routed to from the public listeners.
+var RootPublic = &cmds.Command{}
+
+// ResolvePublicCmd is `ipfs resolve` command (without the DHT query
+// settings and --concurrency).
+var ResolvePublicCmd = &cmds.Command{}
+
+// ResolveROCmd is `ipfs resolve` command (without --concurrency).
+var ResolveROCmd = &cmds.Command{}
+
+var rootPublicSubcommands = map[string]*cmds.Command{
+	"ls": LsCmd,
+	"dag": {
+		Subcommands: map[string]*cmds.Command{
+			"get": dag.DagGetCmd,
+		},
+	},
+}
+
 var rootROSubcommands = map[string]*cmds.Command{
 	"commands": CommandsDaemonROCmd,
-	"cat":      CatCmd,
 	"block": &cmds.Command{
 		Subcommands: map[string]*cmds.Command{
 			"stat": blockStatCmd,
 			"get":  blockGetCmd,
 		},
 	},
-	"get": GetCmd,
 	"dns": DNSCmd,
 	"ls":  LsCmd,
 	"name": {
@@ -193,7 +270,6 @@ var rootROSubcommands = map[string]*cmds.Command{
 			"resolve": dag.DagResolveCmd,
 		},
 	},
-	"resolve": ResolveCmd,
 }
 
 func init() {
@@ -209,13 +285,37 @@ func init() {
 	RefsROCmd.Subcommands = map[string]*cmds.Command{}
 	rootROSubcommands["refs"] = RefsROCmd
 
+	// sanitize readonly cat and get commands (no dials of the peers given)
+	*CatROCmd = *CatCmd
+	withoutOptions(CatROCmd, preferPeerOptionName)
+	rootROSubcommands["cat"] = CatROCmd
+	*GetROCmd = *GetCmd
+	withoutOptions(GetROCmd, preferPeerOptionName)
+	rootROSubcommands["get"] = GetROCmd
+
+	// sanitize readonly resolve command (resolving at the default
+	// concurrency only)
+	*ResolveROCmd = *ResolveCmd
+	withoutOptions(ResolveROCmd, resolveConcurrencyOptionName)
+	rootROSubcommands["resolve"] = ResolveROCmd
+
 	// sanitize readonly version command (no need to expose precise deps)
 	*VersionROCmd = *VersionCmd
 	VersionROCmd.Subcommands = map[string]*cmds.Command{}
 	rootROSubcommands["version"] = VersionROCmd
 
+	// the public API serves the sanitized commands too, and a resolve
+	// command whose DHT queries can't be unbounded
+	*RootPublic = *Root
+	rootPublicSubcommands["cat"] = CatROCmd
+	*ResolvePublicCmd = *ResolveCmd
+	withoutOptions(ResolvePublicCmd, resolveDhtRecordCountOptionName, resolveDhtTimeoutOptionName, resolveConcurrencyOptionName)
+	rootPublicSubcommands["resolve"] = ResolvePublicCmd
+	rootPublicSubcommands["version"] = VersionROCmd
+
 	Root.Subcommands = rootSubcommands
 	RootRO.Subcommands = rootROSubcommands
+	RootPublic.Subcommands = rootPublicSubcommands
 }
 
 type MessageOutput struct {
@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	slo "github.com/ipfs/go-ipfs/core/slo"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var errSLODisabled = errors.New("no objective is configured, set SLO.Objectives in the config and restart the daemon")
+
+const sloSinceOptionName = "since"
+
+// SLOReport is the output of 'ipfs slo report'.
+type SLOReport struct {
+	Status    []slo.Status
+	Incidents []slo.Incident
+}
+
+var SLOCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Monitor the latency and the availability of chosen peers.",
+		ShortDescription: `
+The daemon pings the peers of each objective of SLO.Objectives every
+SLO.Interval. A ping is good when it succeeds within the MaxLatency of the
+objective. When the share of good pings of a peer stays below the Target of
+the objective over its whole Window, an incident opens: it is logged, posted
+to SLO.Webhook if set, and recorded until the peer meets the objective again.
+
+  > ipfs config --json SLO.Objectives '[{"Name": "replicas",
+      "Peers": ["<peer-id>"], "MaxLatency": "200ms", "Target": 99,
+      "Window": "5m"}]'
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"report": sloReportCmd,
+	},
+}
+
+var sloReportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the status of the objectives and the recent incidents.",
+		ShortDescription: `
+'ipfs slo report' shows, for each objective and peer, the share of good pings
+and the mean latency over the window of the objective, then the incidents
+still open or started within the --since duration, the most recent first.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(sloSinceOptionName, "Show the incidents started within this duration.").WithDefault("24h"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+		if n.SLO == nil {
+			return errSLODisabled
+		}
+
+		s, _ := req.Options[sloSinceOptionName].(string)
+		since, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid --%s: %s", sloSinceOptionName, err)
+		}
+		incidents, err := n.SLO.Incidents(time.Now().Add(-since))
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &SLOReport{
+			Status:    n.SLO.Status(),
+			Incidents: incidents,
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SLOReport) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "objective\tpeer\tpings\tgood\tlatency\tstatus")
+			for _, st := range out.Status {
+				status := "ok"
+				switch {
+				case st.Breached:
+					status = "breached"
+				case !st.Measured:
+					status = "measuring"
+				}
+				latency := "-"
+				if st.Latency > 0 {
+					latency = st.Latency.Round(time.Millisecond / 10).String()
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%d\t%.1f%%\t%s\t%s\n", st.Objective, st.Peer, st.Pings, st.Good, latency, status)
+			}
+			if len(out.Incidents) > 0 {
+				fmt.Fprintln(tw)
+				fmt.Fprintln(tw, "objective\tpeer\tstart\tduration\tworst")
+				for _, inc := range out.Incidents {
+					duration := "open"
+					if inc.End != nil {
+						duration = inc.End.Sub(inc.Start).Round(time.Second).String()
+						if inc.Interrupted {
+							duration += " (interrupted)"
+						}
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.1f%%\n", inc.Objective, inc.Peer, inc.Start.Format(time.RFC3339), duration, inc.Worst)
+				}
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: SLOReport{},
+}
@@ -26,9 +26,11 @@ for your IPFS node.`,
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"bw":      statBwCmd,
-		"repo":    repoStatCmd,
-		"bitswap": bitswapStatCmd,
+		"bw":         statBwCmd,
+		"repo":       repoStatCmd,
+		"bitswap":    bitswapStatCmd,
+		"dht":        statDhtCmd,
+		"federation": statFederationCmd,
 	},
 }
 
@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	dhtquota "github.com/ipfs/go-ipfs/core/dhtquota"
+	dhtstats "github.com/ipfs/go-ipfs/core/dhtstats"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// StatDhtOutput is the output of 'ipfs stats dht'.
+type StatDhtOutput struct {
+	dhtstats.Stats
+
+	// RecordStore is the usage of the quota of the records stored for the
+	// DHT.
+	RecordStore *dhtquota.Stats `json:",omitempty"`
+}
+
+var statDhtCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the health of the DHT.",
+		ShortDescription: `
+'ipfs stats dht' prints the size of the DHT routing table and the
+utilization of its buckets, the rate at which peers join and leave the
+routing table, latency histograms of the DHT queries made since the daemon
+started, and the records stored for other peers.
+`,
+		LongDescription: `
+'ipfs stats dht' prints the size of the DHT routing table and the
+utilization of its buckets, the rate at which peers join and leave the
+routing table, and latency histograms of the DHT queries made since the
+daemon started.
+
+A bucket holds the peers sharing a prefix of the given length (CPL) with the
+node. The churn rate is the number of peers added to or removed from the
+routing table per minute, over the last 10 minutes.
+
+The records other peers store on the node are bounded by the
+Routing.RecordStore config section; the least recently used ones are evicted
+past its limits.
+
+On a private network, a routing table shrinking to a few peers, a churn spike
+or queries failing or timing out are signs of a partition. Use '--enc=json'
+to feed the numbers to a monitoring system.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+
+		stats, err := n.DHTStats.Stats()
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &StatDhtOutput{
+			Stats:       stats,
+			RecordStore: n.DHTRecords.Stats(),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *StatDhtOutput) error {
+			fmt.Fprintf(w, "Routing table: %d peers\n", out.RoutingTableSize)
+			fmt.Fprintf(w, "Peer churn: %.1f/min (%d added, %d removed)\n", out.ChurnPerMinute, out.PeersAdded, out.PeersRemoved)
+			if rs := out.RecordStore; rs != nil {
+				var records int
+				var size int64
+				for _, k := range rs.Kinds {
+					records += k.Records
+					size += k.Bytes
+				}
+				fmt.Fprintf(w, "Record store: %d/%d records, %s/%s", records, rs.MaxRecords,
+					humanize.Bytes(uint64(size)), humanize.Bytes(uint64(rs.MaxBytes)))
+				for _, kind := range []string{dhtquota.Providers, dhtquota.Values} {
+					k := rs.Kinds[kind]
+					fmt.Fprintf(w, ", %d %s (%d evicted)", k.Records, kind, k.Evicted)
+				}
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintln(w)
+
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "CPL\tPEERS\tFILL\t")
+			for _, b := range out.Buckets {
+				fmt.Fprintf(tw, "%d\t%d/%d\t%d%%\t\n", b.CPL, b.Peers, b.Capacity, b.Peers*100/b.Capacity)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+
+			if len(out.Queries) == 0 {
+				fmt.Fprintln(w, "\nNo queries yet.")
+				return nil
+			}
+
+			fmt.Fprintln(w)
+			fmt.Fprint(tw, "QUERY\tCOUNT\tERRORS\tMEAN\t")
+			for _, bound := range dhtstats.LatencyBuckets {
+				fmt.Fprintf(tw, "<%s\t", bound)
+			}
+			fmt.Fprintf(tw, ">=%s\t\n", dhtstats.LatencyBuckets[len(dhtstats.LatencyBuckets)-1])
+
+			kinds := make([]string, 0, len(out.Queries))
+			for kind := range out.Queries {
+				kinds = append(kinds, kind)
+			}
+			sort.Strings(kinds)
+			for _, kind := range kinds {
+				h := out.Queries[kind]
+				fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t", kind, h.Count, h.Errors, h.Mean())
+				for _, c := range h.Buckets {
+					fmt.Fprintf(tw, "%d\t", c)
+				}
+				fmt.Fprintln(tw)
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: StatDhtOutput{},
+}
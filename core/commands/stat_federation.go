@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	gwfed "github.com/ipfs/go-ipfs/core/gwfed"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var statFederationCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the blocks fetched from the upstream gateways.",
+		ShortDescription: `
+'ipfs stats federation' prints the upstream gateways configured in
+Gateway.Federation, the number and size of the blocks fetched from them
+because the network didn't have them, and the number of blocks none of
+them could serve.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+
+		stats := n.Federation.Stats()
+		if stats == nil {
+			return errors.New("no upstream gateways configured in Gateway.Federation.Upstreams")
+		}
+		return cmds.EmitOnce(res, stats)
+	},
+	Type: gwfed.Stats{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *gwfed.Stats) error {
+			for _, u := range out.Upstreams {
+				fmt.Fprintf(w, "Upstream: %s\n", u)
+			}
+			fmt.Fprintf(w, "Fetched: %d blocks (%s)\n", out.Fetched, humanize.Bytes(out.Bytes))
+			fmt.Fprintf(w, "Failed: %d blocks\n", out.Failed)
+			return nil
+		}),
+	},
+}
@@ -1,29 +1,30 @@
 package commands
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"path"
 	"sort"
+	"strings"
 	"sync"
+	"text/tabwriter"
 	"time"
 
-	commands "github.com/ipfs/go-ipfs/commands"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
-	repo "github.com/ipfs/go-ipfs/repo"
-	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	geoip "github.com/ipfs/go-ipfs/core/geoip"
 
+	humanize "github.com/dustin/go-humanize"
 	cmds "github.com/ipfs/go-ipfs-cmds"
-	config "github.com/ipfs/go-ipfs-config"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	inet "github.com/libp2p/go-libp2p-core/network"
 	peer "github.com/libp2p/go-libp2p-core/peer"
-	swarm "github.com/libp2p/go-libp2p-swarm"
-	mafilter "github.com/libp2p/go-maddr-filter"
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
-	mamask "github.com/whyrusleeping/multiaddr-filter"
 )
 
 const (
@@ -36,6 +37,21 @@ type stringList struct {
 
 type addrMap struct {
 	Addrs map[string][]string
+
+	// Sources has the source and expiry of the addresses, with --verbose.
+	Sources map[string][]addrSource `json:",omitempty"`
+}
+
+type addrSource struct {
+	Addr   string
+	Source string
+
+	// Expires is the unix time the address expires at, or 0 if it doesn't.
+	Expires int64 `json:",omitempty"`
+
+	// Signature is the signature of the record carrying the address, in
+	// hex, for the signed addresses.
+	Signature string `json:",omitempty"`
 }
 
 var SwarmCmd = &cmds.Command{
@@ -51,8 +67,18 @@ ipfs peers in the internet.
 		"addrs":      swarmAddrsCmd,
 		"connect":    swarmConnectCmd,
 		"disconnect": swarmDisconnectCmd,
+		"events":     swarmEventsCmd,
 		"filters":    swarmFiltersCmd,
+		"key":        swarmKeyCmd,
+		"listen":     swarmListenCmd,
+		"listeners":  swarmListenersCmd,
+		"nat":        swarmNatCmd,
 		"peers":      swarmPeersCmd,
+		"ping":       swarmPingCmd,
+		"protect":    swarmProtectCmd,
+		"relay":      swarmRelayCmd,
+		"scores":     swarmScoresCmd,
+		"stats":      swarmStatsCmd,
 	},
 }
 
@@ -61,6 +87,7 @@ const (
 	swarmStreamsOptionName   = "streams"
 	swarmLatencyOptionName   = "latency"
 	swarmDirectionOptionName = "direction"
+	swarmLocationOptionName  = "location"
 )
 
 var swarmPeersCmd = &cmds.Command{
@@ -68,6 +95,17 @@ var swarmPeersCmd = &cmds.Command{
 		Tagline: "List peers with open connections.",
 		ShortDescription: `
 'ipfs swarm peers' lists the set of peers this node is connected to.
+
+With --verbose, each open stream is listed with its direction, how long it
+has been open and the bytes read and written on it, to spot the protocol
+using a connection the most. Streams opened by libp2p itself, such as
+identify, are listed without these.
+
+With --verbose or --location, each peer is annotated with the country and the
+autonomous system of its address, as found in the databases of
+Swarm.GeoIP.Databases:
+
+  > ipfs config --json Swarm.GeoIP.Databases '["country_asn.csv"]'
 `,
 	},
 	Options: []cmds.Option{
@@ -75,6 +113,7 @@ var swarmPeersCmd = &cmds.Command{
 		cmds.BoolOption(swarmStreamsOptionName, "Also list information about open streams for each peer"),
 		cmds.BoolOption(swarmLatencyOptionName, "Also list information about latency to each peer"),
 		cmds.BoolOption(swarmDirectionOptionName, "Also list information about the direction of connection"),
+		cmds.BoolOption(swarmLocationOptionName, "Also list the country and autonomous system of each peer"),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -86,6 +125,16 @@ var swarmPeersCmd = &cmds.Command{
 		latency, _ := req.Options[swarmLatencyOptionName].(bool)
 		streams, _ := req.Options[swarmStreamsOptionName].(bool)
 		direction, _ := req.Options[swarmDirectionOptionName].(bool)
+		location, _ := req.Options[swarmLocationOptionName].(bool)
+
+		var geo *geoip.DB
+		if verbose || location {
+			n, err := cmdenv.GetNode(env)
+			if err != nil {
+				return err
+			}
+			geo = n.GeoIP
+		}
 
 		conns, err := api.Swarm().Peers(req.Context)
 		if err != nil {
@@ -104,6 +153,10 @@ var swarmPeersCmd = &cmds.Command{
 				ci.Direction = c.Direction()
 			}
 
+			if loc := geo.LookupAddr(c.Address()); !loc.IsZero() {
+				ci.Location = &loc
+			}
+
 			if verbose || latency {
 				lat, err := c.Latency()
 				if err != nil {
@@ -117,13 +170,29 @@ var swarmPeersCmd = &cmds.Command{
 				}
 			}
 			if verbose || streams {
-				strs, err := c.Streams()
-				if err != nil {
-					return err
-				}
+				if cs, ok := c.(coreapi.ConnectionStreams); ok {
+					for _, s := range cs.StreamInfos() {
+						si := streamInfo{
+							Protocol:     string(s.Protocol),
+							Direction:    s.Direction,
+							BytesRead:    s.BytesRead,
+							BytesWritten: s.BytesWritten,
+						}
+						if !s.Opened.IsZero() {
+							si.Opened = s.Opened.Unix()
+							si.Duration = time.Since(s.Opened).Round(time.Second).String()
+						}
+						ci.Streams = append(ci.Streams, si)
+					}
+				} else {
+					strs, err := c.Streams()
+					if err != nil {
+						return err
+					}
 
-				for _, s := range strs {
-					ci.Streams = append(ci.Streams, streamInfo{Protocol: string(s)})
+					for _, s := range strs {
+						ci.Streams = append(ci.Streams, streamInfo{Protocol: string(s)})
+					}
 				}
 			}
 			sort.Sort(&ci)
@@ -136,6 +205,7 @@ var swarmPeersCmd = &cmds.Command{
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ci *connInfos) error {
 			pipfs := ma.ProtocolWithCode(ma.P_IPFS).Name
+			verbose, _ := req.Options[swarmVerboseOptionName].(bool)
 			for _, info := range ci.Peers {
 				fmt.Fprintf(w, "%s/%s/%s", info.Addr, pipfs, info.Peer)
 				if info.Latency != "" {
@@ -145,6 +215,9 @@ var swarmPeersCmd = &cmds.Command{
 				if info.Direction != inet.DirUnknown {
 					fmt.Fprintf(w, " %s", directionString(info.Direction))
 				}
+				if info.Location != nil {
+					fmt.Fprintf(w, " %s", info.Location)
+				}
 				fmt.Fprintln(w)
 
 				for _, s := range info.Streams {
@@ -152,7 +225,18 @@ var swarmPeersCmd = &cmds.Command{
 						s.Protocol = "<no protocol name>"
 					}
 
-					fmt.Fprintf(w, "  %s\n", s.Protocol)
+					if !verbose {
+						fmt.Fprintf(w, "  %s\n", s.Protocol)
+						continue
+					}
+					fmt.Fprintf(w, "  %s", s.Protocol)
+					if s.Direction != inet.DirUnknown {
+						fmt.Fprintf(w, " %s", directionString(s.Direction))
+					}
+					if s.Duration != "" {
+						fmt.Fprintf(w, " open %s, %s read, %s written", s.Duration, humanize.Bytes(uint64(s.BytesRead)), humanize.Bytes(uint64(s.BytesWritten)))
+					}
+					fmt.Fprintln(w)
 				}
 			}
 
@@ -162,8 +246,15 @@ var swarmPeersCmd = &cmds.Command{
 	Type: connInfos{},
 }
 
+// streamInfo describes a stream. Only the protocol is set for the streams
+// which aren't metered.
 type streamInfo struct {
-	Protocol string
+	Protocol     string
+	Direction    inet.Direction `json:",omitempty"`
+	Opened       int64          `json:",omitempty"` // unix time
+	Duration     string         `json:",omitempty"`
+	BytesRead    int64          `json:",omitempty"`
+	BytesWritten int64          `json:",omitempty"`
 }
 
 type connInfo struct {
@@ -173,6 +264,10 @@ type connInfo struct {
 	Muxer     string
 	Direction inet.Direction
 	Streams   []streamInfo
+
+	// Location is where the address is, with --verbose or --location, if
+	// known.
+	Location *geoip.Location `json:",omitempty"`
 }
 
 func (ci *connInfo) Less(i, j int) bool {
@@ -215,16 +310,45 @@ func directionString(d inet.Direction) string {
 	}
 }
 
+const (
+	swarmAddrsPeerOptionName = "peer"
+	swarmAddrsAddrOptionName = "addr"
+)
+
 var swarmAddrsCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "List known addresses. Useful for debugging.",
 		ShortDescription: `
 'ipfs swarm addrs' lists all addresses this node is aware of.
+
+With --peer, only the addresses of the given peer are listed. With --addr,
+the peers known at the given address are listed, with their addresses
+matching it: '--addr=/ip4/1.2.3.4' lists the peers on any port of that host,
+and DNS addresses are resolved first.
+
+With --verbose, each address is listed with where it was learned from, and
+how long it is kept for:
+
+  observed   reported by the peer while connected to it
+  manual     given to 'ipfs swarm connect', or permanent
+  dht        found through the routing
+  signed     carried in a record signed by the peer, with its signature
+  unknown    added otherwise
+
+In private networks, only the addresses reported by the peers themselves, the
+ones given explicitly, and the signed ones are accepted, unless
+Swarm.AcceptUnsignedAddrs is set.
 `,
 	},
 	Subcommands: map[string]*cmds.Command{
-		"local":  swarmAddrsLocalCmd,
-		"listen": swarmAddrsListenCmd,
+		"local":    swarmAddrsLocalCmd,
+		"listen":   swarmAddrsListenCmd,
+		"external": swarmAddrsExternalCmd,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(swarmAddrsPeerOptionName, "Only list the addresses of this peer."),
+		cmds.StringOption(swarmAddrsAddrOptionName, "Only list the peers known at this address."),
+		cmds.BoolOption(swarmVerboseOptionName, "v", "Show the source and expiry of the addresses."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -232,20 +356,67 @@ var swarmAddrsCmd = &cmds.Command{
 			return err
 		}
 
-		addrs, err := api.Swarm().KnownAddrs(req.Context)
-		if err != nil {
-			return err
+		verbose, _ := req.Options[swarmVerboseOptionName].(bool)
+		peerOpt, _ := req.Options[swarmAddrsPeerOptionName].(string)
+		addrOpt, _ := req.Options[swarmAddrsAddrOptionName].(string)
+
+		var addrs map[peer.ID][]ma.Multiaddr
+		if peerOpt != "" {
+			p, err := peer.Decode(peerOpt)
+			if err != nil {
+				return err
+			}
+			addrs, err = peerAddrs(req.Context, api, p)
+			if err != nil {
+				return err
+			}
+		} else {
+			addrs, err = api.Swarm().KnownAddrs(req.Context)
+			if err != nil {
+				return err
+			}
 		}
 
-		out := make(map[string][]string)
+		if addrOpt != "" {
+			addrs, err = peersAt(req.Context, addrs, addrOpt)
+			if err != nil {
+				return err
+			}
+		}
+
+		out := &addrMap{Addrs: make(map[string][]string)}
+		if verbose {
+			out.Sources = make(map[string][]addrSource)
+		}
 		for p, paddrs := range addrs {
 			s := p.Pretty()
 			for _, a := range paddrs {
-				out[s] = append(out[s], a.String())
+				out.Addrs[s] = append(out.Addrs[s], a.String())
+			}
+			if !verbose {
+				continue
+			}
+
+			entries, err := api.Swarm().(*coreapi.SwarmAPI).PeerAddrs(req.Context, p)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				if !containsAddr(paddrs, e.Addr) {
+					continue
+				}
+				src := addrSource{Addr: e.Addr.String(), Source: string(e.Source)}
+				if !e.Expires.IsZero() {
+					src.Expires = e.Expires.Unix()
+				}
+				if len(e.Sig) > 0 {
+					src.Signature = hex.EncodeToString(e.Sig)
+				}
+				out.Sources[s] = append(out.Sources[s], src)
 			}
 		}
 
-		return cmds.EmitOnce(res, &addrMap{Addrs: out})
+		return cmds.EmitOnce(res, out)
 	},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, am *addrMap) error {
@@ -259,9 +430,26 @@ var swarmAddrsCmd = &cmds.Command{
 			for _, p := range ids {
 				paddrs := am.Addrs[p]
 				fmt.Fprintf(w, "%s (%d)\n", p, len(paddrs))
-				for _, addr := range paddrs {
-					fmt.Fprintf(w, "\t"+addr+"\n")
+				if am.Sources == nil {
+					for _, addr := range paddrs {
+						fmt.Fprintf(w, "\t"+addr+"\n")
+					}
+					continue
 				}
+
+				tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+				for _, src := range am.Sources[p] {
+					ttl := "permanent"
+					if src.Expires != 0 {
+						ttl = time.Until(time.Unix(src.Expires, 0)).Round(time.Second).String()
+					}
+					sig := ""
+					if src.Signature != "" {
+						sig = "sig:" + shortSig(src.Signature)
+					}
+					fmt.Fprintf(tw, "\t%s\t%s\t%s\t%s\n", src.Addr, src.Source, ttl, sig)
+				}
+				tw.Flush()
 			}
 
 			return nil
@@ -270,6 +458,83 @@ var swarmAddrsCmd = &cmds.Command{
 	Type: addrMap{},
 }
 
+// shortSig abbreviates a signature in hex for display.
+func shortSig(sig string) string {
+	if len(sig) > 16 {
+		return sig[:16] + "..."
+	}
+	return sig
+}
+
+// peerAddrs returns the known addresses of p.
+func peerAddrs(ctx context.Context, api coreiface.CoreAPI, p peer.ID) (map[peer.ID][]ma.Multiaddr, error) {
+	entries, err := api.Swarm().(*coreapi.SwarmAPI).PeerAddrs(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no known addresses for %s, try 'ipfs dht findpeer'", p.Pretty())
+	}
+
+	addrs := make([]ma.Multiaddr, len(entries))
+	for i, e := range entries {
+		addrs[i] = e.Addr
+	}
+	return map[peer.ID][]ma.Multiaddr{p: addrs}, nil
+}
+
+// peersAt returns the peers in addrs with addresses matching s, and these
+// addresses. An address matches if it starts with the components of s, or of
+// one of the addresses s resolves to; a trailing /ipfs/<peer> part of s also
+// has to match the peer.
+func peersAt(ctx context.Context, addrs map[peer.ID][]ma.Multiaddr, s string) (map[peer.ID][]ma.Multiaddr, error) {
+	maddr, err := ma.NewMultiaddr(s)
+	if err != nil {
+		return nil, err
+	}
+	maddr, id := peer.SplitAddr(maddr)
+
+	ctx, cancel := context.WithTimeout(ctx, dnsResolveTimeout)
+	defer cancel()
+	prefixes := []ma.Multiaddr{maddr}
+	if maddr != nil && madns.Matches(maddr) {
+		if prefixes, err = madns.Resolve(ctx, maddr); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make(map[peer.ID][]ma.Multiaddr)
+	for p, paddrs := range addrs {
+		if id != "" && p != id {
+			continue
+		}
+		for _, a := range paddrs {
+			for _, prefix := range prefixes {
+				if hasAddrPrefix(a, prefix) {
+					out[p] = append(out[p], a)
+					break
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// hasAddrPrefix returns whether the components of a start with the ones of
+// prefix. Components are self-delimiting, so comparing bytes is enough.
+func hasAddrPrefix(a, prefix ma.Multiaddr) bool {
+	return prefix == nil || bytes.HasPrefix(a.Bytes(), prefix.Bytes())
+}
+
+func containsAddr(addrs []ma.Multiaddr, a ma.Multiaddr) bool {
+	for _, b := range addrs {
+		if b.Equal(a) {
+			return true
+		}
+	}
+	return false
+}
+
 var swarmAddrsLocalCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "List local addresses.",
@@ -346,6 +611,8 @@ var swarmAddrsListenCmd = &cmds.Command{
 	},
 }
 
+const swarmConnectTimeoutOptionName = "timeout"
+
 var swarmConnectCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Open connection to a given address.",
@@ -355,35 +622,97 @@ var swarmConnectCmd = &cmds.Command{
 The address format is an IPFS multiaddr:
 
 ipfs swarm connect /ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
+
+When several addresses are given, the peers are dialed in parallel and the
+result of each attempt is reported. The command only fails if no connection
+could be opened: an address that can't be parsed or resolved is reported as
+a failure like the others. Use --timeout to bound each attempt, including the
+resolution of its address.
 `,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("address", true, true, "Address of peer to connect to.").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.StringOption(swarmConnectTimeoutOptionName, "t", "Maximum time to spend on each connection attempt, e.g. '30s'."),
+	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
 		}
 
+		var timeout time.Duration
+		if s, ok := req.Options[swarmConnectTimeoutOptionName].(string); ok {
+			timeout, err = time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			if timeout <= 0 {
+				return fmt.Errorf("timeout must be positive")
+			}
+		}
+
 		addrs := req.Arguments
 
-		pis, err := parseAddresses(req.Context, addrs)
-		if err != nil {
-			return err
-		}
+		// each address is resolved and its peers dialed in its own
+		// attempt, so that an address failing doesn't fail the others
+		results := make([][]string, len(addrs))
+		connected := make([]int, len(addrs))
+
+		var wg sync.WaitGroup
+		for i, addr := range addrs {
+			wg.Add(1)
+			go func(i int, addr string) {
+				defer wg.Done()
+
+				ctx := req.Context
+				if timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, timeout)
+					defer cancel()
+				}
+				pis, err := resolvePeers(ctx, addr)
+				if err != nil {
+					results[i] = []string{"connect " + addr + " failure: " + err.Error()}
+					return
+				}
 
-		output := make([]string, len(pis))
-		for i, pi := range pis {
-			output[i] = "connect " + pi.ID.Pretty()
+				errs := make([]error, len(pis))
+				var pwg sync.WaitGroup
+				for j, pi := range pis {
+					pwg.Add(1)
+					go func(j int, pi peer.AddrInfo) {
+						defer pwg.Done()
+						errs[j] = api.Swarm().Connect(ctx, pi)
+					}(j, pi)
+				}
+				pwg.Wait()
+
+				for j, pi := range pis {
+					msg := "connect " + pi.ID.Pretty()
+					if errs[j] != nil {
+						msg += " failure: " + errs[j].Error()
+					} else {
+						msg += " success"
+						connected[i]++
+					}
+					results[i] = append(results[i], msg)
+				}
+			}(i, addr)
+		}
+		wg.Wait()
 
-			err := api.Swarm().Connect(req.Context, pi)
-			if err != nil {
-				return fmt.Errorf("%s failure: %s", output[i], err)
-			}
-			output[i] += " success"
+		var output []string
+		total := 0
+		for i := range addrs {
+			output = append(output, results[i]...)
+			total += connected[i]
 		}
 
+		if total == 0 {
+			return errors.New(strings.Join(output, "\n"))
+		}
 		return cmds.EmitOnce(res, &stringList{output})
 	},
 	Encoders: cmds.EncoderMap{
@@ -464,6 +793,36 @@ func parseAddresses(ctx context.Context, addrs []string) ([]peer.AddrInfo, error
 	return peer.AddrInfosFromP2pAddrs(maddrs...)
 }
 
+// resolvePeers returns the peers at addr, resolving it first if it doesn't
+// end with a peer ID.
+func resolvePeers(ctx context.Context, addr string) ([]peer.AddrInfo, error) {
+	maddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, last := ma.SplitLast(maddr); last.Protocol().Code == ma.P_IPFS {
+		return peer.AddrInfosFromP2pAddrs(maddr)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dnsResolveTimeout)
+	defer cancel()
+	raddrs, err := madns.Resolve(ctx, maddr)
+	if err != nil {
+		return nil, err
+	}
+	// filter out addresses that still don't end in `ipfs/Qm...`
+	var maddrs []ma.Multiaddr
+	for _, raddr := range raddrs {
+		if _, last := ma.SplitLast(raddr); last != nil && last.Protocol().Code == ma.P_IPFS {
+			maddrs = append(maddrs, raddr)
+		}
+	}
+	if len(maddrs) == 0 {
+		return nil, fmt.Errorf("found no ipfs peers at %s", maddr)
+	}
+	return peer.AddrInfosFromP2pAddrs(maddrs...)
+}
+
 // resolveAddresses resolves addresses parallelly
 func resolveAddresses(ctx context.Context, addrs []string) ([]ma.Multiaddr, error) {
 	ctx, cancel := context.WithTimeout(ctx, dnsResolveTimeout)
@@ -525,6 +884,25 @@ func resolveAddresses(ctx context.Context, addrs []string) ([]ma.Multiaddr, erro
 	return maddrs, nil
 }
 
+const (
+	swarmFiltersPermanentOptionName   = "permanent"
+	swarmFiltersSessionOnlyOptionName = "session-only"
+	swarmFiltersVerboseOptionName     = "verbose"
+)
+
+// swarmFilter is an address filter, and whether it is saved in the config.
+type swarmFilter struct {
+	Filter    string
+	Persisted bool
+}
+
+// swarmFiltersOutput is the output of 'ipfs swarm filters'. Strings is kept
+// for compatibility with older clients.
+type swarmFiltersOutput struct {
+	Strings []string
+	Filters []swarmFilter
+}
+
 var swarmFiltersCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Manipulate address filters.",
@@ -542,42 +920,79 @@ Where the above is equivalent to the standard CIDR:
     192.168.0.0/16
 
 Filters default to those specified under the "Swarm.AddrFilters" config key.
+With --verbose, each filter is marked as either 'persisted' (saved in the
+config, and applied again on restart) or 'session' (only applied to the
+running daemon).
 `,
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmFiltersVerboseOptionName, "v", "Mark which filters are saved in the config."),
+	},
 	Subcommands: map[string]*cmds.Command{
 		"add": swarmFiltersAddCmd,
 		"rm":  swarmFiltersRmCmd,
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
-		n, err := cmdenv.GetNode(env)
+		filters, err := swarmFilters(env, req)
 		if err != nil {
 			return err
 		}
 
-		if n.PeerHost == nil {
-			return ErrNotOnline
+		fs, err := filters.List(req.Context)
+		if err != nil {
+			return err
 		}
 
-		// FIXME(steb)
-		swrm, ok := n.PeerHost.Network().(*swarm.Swarm)
-		if !ok {
-			return errors.New("failed to cast network to swarm network")
+		out := &swarmFiltersOutput{}
+		for _, f := range fs {
+			out.Strings = append(out.Strings, f.Filter)
+			out.Filters = append(out.Filters, swarmFilter{Filter: f.Filter, Persisted: f.Persisted})
 		}
-
-		var output []string
-		for _, f := range swrm.Filters.FiltersForAction(mafilter.ActionDeny) {
-			s, err := mamask.ConvertIPNet(&f)
-			if err != nil {
-				return err
-			}
-			output = append(output, s)
-		}
-		return cmds.EmitOnce(res, &stringList{output})
+		return cmds.EmitOnce(res, out)
 	},
 	Encoders: cmds.EncoderMap{
-		cmds.Text: cmds.MakeTypedEncoder(stringListEncoder),
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *swarmFiltersOutput) error {
+			verbose, _ := req.Options[swarmFiltersVerboseOptionName].(bool)
+			for _, f := range out.Filters {
+				if !verbose {
+					fmt.Fprintln(w, f.Filter)
+					continue
+				}
+				state := "session"
+				if f.Persisted {
+					state = "persisted"
+				}
+				fmt.Fprintf(w, "%s\t%s\n", f.Filter, state)
+			}
+			return nil
+		}),
 	},
-	Type: stringList{},
+	Type: swarmFiltersOutput{},
+}
+
+// filtersPersist tells whether a filters add/rm request should be written to
+// the config. Changes are persisted unless --session-only or
+// --permanent=false is passed.
+func filtersPersist(req *cmds.Request) (bool, error) {
+	sessionOnly, _ := req.Options[swarmFiltersSessionOnlyOptionName].(bool)
+	permanent, permanentSet := req.Options[swarmFiltersPermanentOptionName].(bool)
+	if sessionOnly && permanentSet && permanent {
+		return false, cmds.Errorf(cmds.ErrClient, "--permanent and --session-only are mutually exclusive")
+	}
+	return !sessionOnly && (!permanentSet || permanent), nil
+}
+
+// swarmFilters returns the API managing the address filters of the node.
+func swarmFilters(env cmds.Environment, req *cmds.Request) (coreapi.SwarmFilters, error) {
+	api, err := cmdenv.GetApi(env, req)
+	if err != nil {
+		return nil, err
+	}
+	swarmAPI, ok := api.Swarm().(coreapi.SwarmWithFilters)
+	if !ok {
+		return nil, errors.New("the node does not support address filters")
+	}
+	return swarmAPI.Filters(), nil
 }
 
 var swarmFiltersAddCmd = &cmds.Command{
@@ -585,51 +1000,31 @@ var swarmFiltersAddCmd = &cmds.Command{
 		Tagline: "Add an address filter.",
 		ShortDescription: `
 'ipfs swarm filters add' will add an address filter to the daemons swarm.
+
+By default the filter is also saved under "Swarm.AddrFilters" so it survives
+a restart. Pass --session-only (or --permanent=false) to only apply it to the
+running daemon, leaving the config untouched.
 `,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("address", true, true, "Multiaddr to filter.").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmFiltersPermanentOptionName, "Save the filter in the config (default)."),
+		cmds.BoolOption(swarmFiltersSessionOnlyOptionName, "Only apply the filter to the running daemon."),
+	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
-		n, err := cmdenv.GetNode(env)
+		filters, err := swarmFilters(env, req)
 		if err != nil {
 			return err
 		}
 
-		if n.PeerHost == nil {
-			return ErrNotOnline
-		}
-
-		// FIXME(steb)
-		swrm, ok := n.PeerHost.Network().(*swarm.Swarm)
-		if !ok {
-			return errors.New("failed to cast network to swarm network")
-		}
-
-		if len(req.Arguments) == 0 {
-			return errors.New("no filters to add")
-		}
-
-		r, err := fsrepo.Open(env.(*commands.Context).ConfigRoot)
-		if err != nil {
-			return err
-		}
-		defer r.Close()
-		cfg, err := r.Config()
+		persist, err := filtersPersist(req)
 		if err != nil {
 			return err
 		}
 
-		for _, arg := range req.Arguments {
-			mask, err := mamask.NewMask(arg)
-			if err != nil {
-				return err
-			}
-
-			swrm.Filters.AddFilter(*mask, mafilter.ActionDeny)
-		}
-
-		added, err := filtersAdd(r, cfg, req.Arguments)
+		added, err := filters.Add(req.Context, req.Arguments, coreapi.SwarmFiltersPersist(persist))
 		if err != nil {
 			return err
 		}
@@ -647,60 +1042,36 @@ var swarmFiltersRmCmd = &cmds.Command{
 		Tagline: "Remove an address filter.",
 		ShortDescription: `
 'ipfs swarm filters rm' will remove an address filter from the daemons swarm.
+
+By default the filter is also removed from "Swarm.AddrFilters". Pass
+--session-only (or --permanent=false) to only lift it on the running daemon;
+it will be applied again on restart.
 `,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("address", true, true, "Multiaddr filter to remove.").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmFiltersPermanentOptionName, "Also remove the filter from the config (default)."),
+		cmds.BoolOption(swarmFiltersSessionOnlyOptionName, "Only remove the filter from the running daemon."),
+	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
-		n, err := cmdenv.GetNode(env)
+		filters, err := swarmFilters(env, req)
 		if err != nil {
 			return err
 		}
 
-		if n.PeerHost == nil {
-			return ErrNotOnline
-		}
-
-		swrm, ok := n.PeerHost.Network().(*swarm.Swarm)
-		if !ok {
-			return errors.New("failed to cast network to swarm network")
-		}
-
-		r, err := fsrepo.Open(env.(*commands.Context).ConfigRoot)
-		if err != nil {
-			return err
-		}
-		defer r.Close()
-		cfg, err := r.Config()
+		persist, err := filtersPersist(req)
 		if err != nil {
 			return err
 		}
 
+		var removed []string
 		if req.Arguments[0] == "all" || req.Arguments[0] == "*" {
-			fs := swrm.Filters.FiltersForAction(mafilter.ActionDeny)
-			for _, f := range fs {
-				swrm.Filters.RemoveLiteral(f)
-			}
-
-			removed, err := filtersRemoveAll(r, cfg)
-			if err != nil {
-				return err
-			}
-
-			return cmds.EmitOnce(res, &stringList{removed})
-		}
-
-		for _, arg := range req.Arguments {
-			mask, err := mamask.NewMask(arg)
-			if err != nil {
-				return err
-			}
-
-			swrm.Filters.RemoveLiteral(*mask)
+			removed, err = filters.RemoveAll(req.Context, coreapi.SwarmFiltersPersist(persist))
+		} else {
+			removed, err = filters.Remove(req.Context, req.Arguments, coreapi.SwarmFiltersPersist(persist))
 		}
-
-		removed, err := filtersRemove(r, cfg, req.Arguments)
 		if err != nil {
 			return err
 		}
@@ -712,79 +1083,3 @@ var swarmFiltersRmCmd = &cmds.Command{
 	},
 	Type: stringList{},
 }
-
-func filtersAdd(r repo.Repo, cfg *config.Config, filters []string) ([]string, error) {
-	addedMap := map[string]struct{}{}
-	addedList := make([]string, 0, len(filters))
-
-	// re-add cfg swarm filters to rm dupes
-	oldFilters := cfg.Swarm.AddrFilters
-	cfg.Swarm.AddrFilters = nil
-
-	// add new filters
-	for _, filter := range filters {
-		if _, found := addedMap[filter]; found {
-			continue
-		}
-
-		cfg.Swarm.AddrFilters = append(cfg.Swarm.AddrFilters, filter)
-		addedList = append(addedList, filter)
-		addedMap[filter] = struct{}{}
-	}
-
-	// add back original filters. in this order so that we output them.
-	for _, filter := range oldFilters {
-		if _, found := addedMap[filter]; found {
-			continue
-		}
-
-		cfg.Swarm.AddrFilters = append(cfg.Swarm.AddrFilters, filter)
-		addedMap[filter] = struct{}{}
-	}
-
-	if err := r.SetConfig(cfg); err != nil {
-		return nil, err
-	}
-
-	return addedList, nil
-}
-
-func filtersRemoveAll(r repo.Repo, cfg *config.Config) ([]string, error) {
-	removed := cfg.Swarm.AddrFilters
-	cfg.Swarm.AddrFilters = nil
-
-	if err := r.SetConfig(cfg); err != nil {
-		return nil, err
-	}
-
-	return removed, nil
-}
-
-func filtersRemove(r repo.Repo, cfg *config.Config, toRemoveFilters []string) ([]string, error) {
-	removed := make([]string, 0, len(toRemoveFilters))
-	keep := make([]string, 0, len(cfg.Swarm.AddrFilters))
-
-	oldFilters := cfg.Swarm.AddrFilters
-
-	for _, oldFilter := range oldFilters {
-		found := false
-		for _, toRemoveFilter := range toRemoveFilters {
-			if oldFilter == toRemoveFilter {
-				found = true
-				removed = append(removed, toRemoveFilter)
-				break
-			}
-		}
-
-		if !found {
-			keep = append(keep, oldFilter)
-		}
-	}
-	cfg.Swarm.AddrFilters = keep
-
-	if err := r.SetConfig(cfg); err != nil {
-		return nil, err
-	}
-
-	return removed, nil
-}
@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	roaming "github.com/ipfs/go-ipfs/core/roaming"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const swarmEventsFollowOptionName = "follow"
+
+var swarmEventsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the recent connection events.",
+		ShortDescription: `
+'ipfs swarm events' lists the recent connections and disconnections, the
+changes of the addresses of the network interfaces, and the peers which
+reconnected over other addresses, marked as migrated. With --follow, it keeps
+printing the new events.
+
+Connections can't migrate to new addresses without being closed: when the
+addresses of the node change, as when a laptop moves to another network, the
+connections from the addresses which are gone are closed right away and their
+peers are dialed again.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmEventsFollowOptionName, "f", "Keep printing the new events."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline || n.SwarmEvents == nil {
+			return ErrNotOnline
+		}
+
+		follow, _ := req.Options[swarmEventsFollowOptionName].(bool)
+		var events <-chan roaming.Event
+		if follow {
+			var cancel func()
+			events, cancel = n.SwarmEvents.Subscribe()
+			defer cancel()
+		}
+
+		for _, ev := range n.SwarmEvents.Events() {
+			if err := res.Emit(&ev); err != nil {
+				return err
+			}
+		}
+		if !follow {
+			return nil
+		}
+
+		if f, ok := res.(http.Flusher); ok {
+			f.Flush()
+		}
+		for {
+			select {
+			case ev := <-events:
+				if err := res.Emit(&ev); err != nil {
+					return err
+				}
+			case <-req.Context.Done():
+				return nil
+			}
+		}
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ev *roaming.Event) error {
+			var detail string
+			switch ev.Type {
+			case roaming.AddrsChanged:
+				detail = strings.Join(ev.Local, " ")
+			case roaming.Migrated:
+				detail = fmt.Sprintf("%s %s -> %s", ev.Peer, ev.OldAddr, ev.Addr)
+			default:
+				detail = fmt.Sprintf("%s %s", ev.Peer, ev.Addr)
+			}
+			_, err := fmt.Fprintf(w, "%s %s %s\n", ev.Time.Format(time.RFC3339), ev.Type, detail)
+			return err
+		}),
+	},
+	Type: roaming.Event{},
+}
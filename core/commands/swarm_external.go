@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	observed "github.com/ipfs/go-ipfs/core/observed"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+var swarmAddrsExternalCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the addresses other peers observe for this node.",
+		ShortDescription: `
+'ipfs swarm addrs external' lists the addresses the peers connected to this
+node in the last 30 minutes observed it at, as reported by identify, the most
+observed first. For each address, it shows the number of peers which observed
+it, how many of them dialed the node, the confidence in it, and the local
+addresses of the connections it was observed on:
+
+  low      observed by a single peer
+  medium   observed by a few peers
+  high     observed by enough peers to be announced to the network
+
+An address marked as announced is among the addresses the node announces.
+
+Behind a NAT, an address observed on a connection from a listen address, with
+the same port, shows the port is mapped as configured; inbound observations
+show the peers could dial the node.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline || n.ObservedAddr == nil {
+			return ErrNotOnline
+		}
+		return cmds.EmitOnce(res, n.ObservedAddr.Addrs())
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out []observed.Address) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintf(tw, "ADDRESS\tPEERS\tINBOUND\tCONFIDENCE\tLOCAL\n")
+			for _, a := range out {
+				addr := a.Addr
+				if a.Advertised {
+					addr += " (announced)"
+				}
+				fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n", addr, a.Observers, a.Inbound, a.Confidence, strings.Join(a.Local, " "))
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: []observed.Address{},
+}
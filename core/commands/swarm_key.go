@@ -0,0 +1,569 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	pnetinvite "github.com/ipfs/go-ipfs/core/pnetinvite"
+	pnetrouter "github.com/ipfs/go-ipfs/core/pnetrouter"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pnet "github.com/libp2p/go-libp2p-pnet"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	swarmKeyEncryptOptionName    = "encrypt"
+	swarmKeyPassphraseOptionName = "passphrase"
+	swarmKeyTTLOptionName        = "ttl"
+	swarmKeyStdinOptionName      = "swarm-key-stdin"
+)
+
+// SwarmKeyNetwork describes a private network of the node, in the output of
+// 'ipfs swarm key ls'.
+type SwarmKeyNetwork struct {
+	Name string
+
+	// Fingerprint identifies the swarm key of the network, and is empty for
+	// the public network.
+	Fingerprint string
+
+	ListenAddrs []string
+	Peers       []string
+}
+
+// SwarmKeyNetworks is the output of 'ipfs swarm key ls'.
+type SwarmKeyNetworks struct {
+	Networks []SwarmKeyNetwork
+}
+
+// SwarmKeyVerifyOutput is the output of 'ipfs swarm key verify'.
+type SwarmKeyVerifyOutput struct {
+	// Fingerprint identifies the swarm key without revealing it.
+	Fingerprint string
+
+	// ConnectedPeers is the number of connected peers. All of them share
+	// the swarm key: the connection handshake fails otherwise.
+	ConnectedPeers int
+}
+
+var swarmKeyCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the private network swarm key.",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"import": swarmKeyImportCmd,
+		"invite": swarmKeyInviteCmd,
+		"join":   swarmKeyJoinCmd,
+		"ls":     swarmKeyLsCmd,
+		"rm":     swarmKeyRmCmd,
+		"verify": swarmKeyVerifyCmd,
+	},
+}
+
+// SwarmKeyInvite is the output of 'ipfs swarm key invite'.
+type SwarmKeyInvite struct {
+	Token   string
+	Addrs   []string
+	Expires time.Time
+}
+
+var swarmKeyInviteCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Invite a peer into the private network.",
+		ShortDescription: `
+'ipfs swarm key invite' creates a one-time token allowing the given peer to
+get the swarm key with 'ipfs swarm key join', until the token expires.
+
+The invited peer connects to the invite host of this node, which doesn't use
+the swarm key and only hands it to invited peers. It must be enabled with
+Swarm.PNetInvite.Enabled and Swarm.PNetInvite.ListenAddrs.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer ID", true, false, "Peer ID of the invited peer."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(swarmKeyTTLOptionName, "How long the invite is valid.").WithDefault("10m"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+		if n.PNetInvite == nil {
+			return fmt.Errorf("invites are disabled, see %s in the config", pnetinvite.ConfigKey)
+		}
+
+		pid, err := peer.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		ttlS, _ := req.Options[swarmKeyTTLOptionName].(string)
+		ttl, err := time.ParseDuration(ttlS)
+		if err != nil {
+			return fmt.Errorf("invalid TTL: %s", err)
+		}
+
+		token, err := n.PNetInvite.Invite(pid, ttl)
+		if err != nil {
+			return err
+		}
+
+		out := &SwarmKeyInvite{Token: token, Expires: time.Now().Add(ttl)}
+		for _, a := range n.PNetInvite.Addrs() {
+			out.Addrs = append(out.Addrs, a.String())
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SwarmKeyInvite) error {
+			fmt.Fprintf(w, "Invite valid until %s. On the invited peer, run one of:\n", out.Expires.Format(time.RFC3339))
+			for _, a := range out.Addrs {
+				fmt.Fprintf(w, "  ipfs swarm key join %s %s\n", a, out.Token)
+			}
+			return nil
+		}),
+	},
+	Type: SwarmKeyInvite{},
+}
+
+var swarmKeyJoinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Join a private network using an invite.",
+		ShortDescription: `
+'ipfs swarm key join' connects to the invite host of a node of a private
+network, and exchanges a token created with 'ipfs swarm key invite' for the
+swarm key. The swarm key is stored in the keystore, encrypted with a
+passphrase if --encrypt is set, and the bootstrap list is replaced with the
+addresses of the inviting node.
+
+The daemon must be restarted to join the private network.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("address", true, false, "Address of the invite host, ending with /p2p/<peer ID>."),
+		cmds.StringArg("token", true, false, "Invite token."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmKeyEncryptOptionName, "Encrypt the swarm key with a passphrase."),
+		cmds.StringOption(swarmKeyPassphraseOptionName, "Passphrase used with --encrypt. (Deprecated, use the prompt or IPFS_SWARM_KEY_PASSPHRASE)"),
+	},
+	PreRun: swarmKeyPassphrasePreRun,
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		ks, ok := n.Repo.Keystore().(keystore.SwarmKeyStore)
+		if !ok {
+			return errors.New("the keystore of this repo can't store a swarm key")
+		}
+		if n.PrivateKey == nil {
+			return errors.New("the node has no private key")
+		}
+
+		encrypt, _ := req.Options[swarmKeyEncryptOptionName].(bool)
+		pass, _ := req.Options[swarmKeyPassphraseOptionName].(string)
+		if encrypt && pass == "" {
+			return errors.New("a passphrase is required to encrypt the swarm key")
+		}
+		if !encrypt {
+			pass = ""
+		}
+
+		addr, err := ma.NewMultiaddr(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		key, peers, err := pnetinvite.Join(req.Context, n.PrivateKey, addr, req.Arguments[1])
+		if err != nil {
+			return fmt.Errorf("failed to join the private network: %s", err)
+		}
+		protec, err := pnet.NewProtector(bytes.NewReader(key))
+		if err != nil {
+			return fmt.Errorf("received an invalid swarm key: %s", err)
+		}
+
+		if err := ks.PutSwarmKey(key, []byte(pass)); err != nil {
+			return err
+		}
+
+		var bootstrap []string
+		for _, pi := range peers {
+			addrs, err := peer.AddrInfoToP2pAddrs(&pi)
+			if err != nil {
+				return err
+			}
+			for _, a := range addrs {
+				bootstrap = append(bootstrap, a.String())
+			}
+		}
+		if err := n.Repo.SetConfigKey("Bootstrap", bootstrap); err != nil {
+			return err
+		}
+
+		output := []string{
+			fmt.Sprintf("joined private network %x", protec.Fingerprint()),
+			fmt.Sprintf("bootstrapping from %d addresses", len(bootstrap)),
+		}
+		if n.IsOnline {
+			output = append(output, "restart the daemon to join the network")
+		}
+		return cmds.EmitOnce(res, &stringList{output})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(stringListEncoder),
+	},
+	Type: stringList{},
+}
+
+var swarmKeyImportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Store the swarm key in the keystore.",
+		ShortDescription: `
+'ipfs swarm key import' stores a swarm key, in the format of the swarm.key
+file, in the keystore of the repo. Once imported, the key in the keystore is
+used instead of the swarm.key file, which can be deleted.
+
+With --encrypt, the key is encrypted with a passphrase, read from the
+IPFS_SWARM_KEY_PASSPHRASE environment variable or prompted for. The daemon
+then asks for the passphrase when it starts, unless IPFS_SWARM_KEY_PASSPHRASE
+is set.
+
+The key is read from the file given as argument, from the standard input
+with --swarm-key-stdin, or else from the file named by IPFS_SWARM_KEY_FILE,
+such as a mounted secret. The key never has to appear on the command line.
+
+The daemon must be restarted to use the imported key.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.FileArg("key", false, false, "The swarm key file.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmKeyStdinOptionName, "Read the swarm key from the standard input."),
+		cmds.BoolOption(swarmKeyEncryptOptionName, "Encrypt the swarm key with a passphrase."),
+		cmds.StringOption(swarmKeyPassphraseOptionName, "Passphrase used with --encrypt. (Deprecated, use the prompt or IPFS_SWARM_KEY_PASSPHRASE)"),
+	},
+	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		if err := swarmKeyInputPreRun(req); err != nil {
+			return err
+		}
+		return swarmKeyPassphrasePreRun(req, env)
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		ks, ok := n.Repo.Keystore().(keystore.SwarmKeyStore)
+		if !ok {
+			return errors.New("the keystore of this repo can't store a swarm key")
+		}
+
+		encrypt, _ := req.Options[swarmKeyEncryptOptionName].(bool)
+		pass, _ := req.Options[swarmKeyPassphraseOptionName].(string)
+		if encrypt && pass == "" {
+			return errors.New("a passphrase is required to encrypt the swarm key")
+		}
+		if !encrypt {
+			pass = ""
+		}
+
+		if req.Files == nil {
+			return errors.New("no swarm key given")
+		}
+		file, err := cmdenv.GetFileArg(req.Files.Entries())
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		key, err := ioutil.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		protec, err := pnet.NewProtector(bytes.NewReader(key))
+		if err != nil {
+			return fmt.Errorf("invalid swarm key: %s", err)
+		}
+
+		if err := ks.PutSwarmKey(key, []byte(pass)); err != nil {
+			return err
+		}
+
+		output := []string{fmt.Sprintf("imported swarm key %x", protec.Fingerprint())}
+		if n.IsOnline {
+			output = append(output, "restart the daemon to use it")
+		}
+		return cmds.EmitOnce(res, &stringList{output})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(stringListEncoder),
+	},
+	Type: stringList{},
+}
+
+var swarmKeyRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove the swarm key from the keystore.",
+		ShortDescription: `
+'ipfs swarm key rm' removes the swarm key stored in the keystore. The swarm.key
+file of the repo, if any, is used again once the daemon is restarted.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		ks, ok := n.Repo.Keystore().(keystore.SwarmKeyStore)
+		if !ok {
+			return errors.New("the keystore of this repo can't store a swarm key")
+		}
+		return ks.DeleteSwarmKey()
+	},
+}
+
+var swarmKeyVerifyCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Verify that the node runs in private network mode.",
+		ShortDescription: `
+'ipfs swarm key verify' checks that the daemon protects its connections with
+the swarm key of the repo, and prints the fingerprint of that key. Compare the
+fingerprints of several nodes to check that they share the same key without
+exchanging the key itself.
+
+The command fails if the repo has no swarm key, if the daemon runs without the
+private network protector, or if the swarm key changed since the daemon
+started.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+
+		swarmkey, err := n.Repo.SwarmKey()
+		if err != nil {
+			return err
+		}
+		if swarmkey == nil {
+			return errors.New("no swarm key found: the node is not in a private network")
+		}
+
+		protec, err := pnet.NewProtector(bytes.NewReader(swarmkey))
+		if err != nil {
+			return fmt.Errorf("invalid swarm key: %s", err)
+		}
+		fp := protec.Fingerprint()
+
+		if n.PNetFingerprint == nil {
+			return errors.New("the private network protector is not active: restart the daemon to use the swarm key")
+		}
+		if !bytes.Equal(fp, n.PNetFingerprint) {
+			return fmt.Errorf("the swarm key changed since the daemon started (running with %x): restart the daemon to use it", []byte(n.PNetFingerprint))
+		}
+
+		return cmds.EmitOnce(res, &SwarmKeyVerifyOutput{
+			Fingerprint:    hex.EncodeToString(fp),
+			ConnectedPeers: len(networkPeers(n)[pnetrouter.DefaultNetwork]),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SwarmKeyVerifyOutput) error {
+			fmt.Fprintln(w, "Private network protector active")
+			fmt.Fprintf(w, "Swarm key fingerprint: %s\n", out.Fingerprint)
+			fmt.Fprintf(w, "Connected peers sharing the key: %d\n", out.ConnectedPeers)
+			return nil
+		}),
+	},
+	Type: SwarmKeyVerifyOutput{},
+}
+
+// swarmKeyInputPreRun reads the swarm key to import from the standard input
+// with --swarm-key-stdin, or from the file named by IPFS_SWARM_KEY_FILE when
+// no file is given.
+func swarmKeyInputPreRun(req *cmds.Request) error {
+	// the key file, or the standard input when it isn't a terminal
+	if req.Files != nil {
+		return nil
+	}
+
+	fromStdin, _ := req.Options[swarmKeyStdinOptionName].(bool)
+
+	var key []byte
+	var err error
+	switch path := os.Getenv(fsrepo.EnvSwarmKeyFile); {
+	case fromStdin:
+		key, err = ioutil.ReadAll(os.Stdin)
+	case path != "":
+		key, err = ioutil.ReadFile(path)
+	default:
+		return fmt.Errorf("no swarm key given: pass a key file, --%s, or set %s", swarmKeyStdinOptionName, fsrepo.EnvSwarmKeyFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	req.Files = files.NewMapDirectory(map[string]files.Node{
+		"key": files.NewBytesFile(key),
+	})
+	return nil
+}
+
+// swarmKeyPassphrasePreRun reads the passphrase used to encrypt the swarm key
+// with --encrypt, from the environment or from the terminal.
+func swarmKeyPassphrasePreRun(req *cmds.Request, env cmds.Environment) error {
+	if _, ok := req.Options[swarmKeyPassphraseOptionName]; ok {
+		log.Errorf("Command '%s', --%s is deprecated and will be removed in the next release, use the prompt or %s instead",
+			strings.Join(req.Path, " "), swarmKeyPassphraseOptionName, fsrepo.EnvSwarmKeyPassphrase)
+	}
+
+	encrypt, _ := req.Options[swarmKeyEncryptOptionName].(bool)
+	if _, ok := req.Options[swarmKeyPassphraseOptionName]; !encrypt || ok {
+		return nil
+	}
+
+	if pass := os.Getenv(fsrepo.EnvSwarmKeyPassphrase); pass != "" {
+		req.Options[swarmKeyPassphraseOptionName] = pass
+		return nil
+	}
+
+	pass, err := keystore.ReadPassphrase("Enter a passphrase for the swarm key: ")
+	if err != nil {
+		return err
+	}
+	confirm, err := keystore.ReadPassphrase("Enter the passphrase again: ")
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(pass, confirm) {
+		return errors.New("the passphrases don't match")
+	}
+	req.Options[swarmKeyPassphraseOptionName] = string(pass)
+	return nil
+}
+
+var swarmKeyLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the private networks of the node.",
+		ShortDescription: `
+'ipfs swarm key ls' lists the private networks the node participates in, with
+the fingerprint of their swarm key, their listen addresses and the connected
+peers belonging to them.
+
+Besides the swarm key of the repo, a node can join several private networks
+configured under Swarm.PrivateNetworks, each with its own swarm key file and
+listen addresses. The connections which belong to none of them are listed
+under the "default" network: it uses the swarm key of the repo, and is the
+public network if there is none.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+
+		peers := networkPeers(n)
+		def := SwarmKeyNetwork{
+			Name:        pnetrouter.DefaultNetwork,
+			Fingerprint: hex.EncodeToString(n.PNetFingerprint),
+			Peers:       peers[pnetrouter.DefaultNetwork],
+		}
+		if cfg, err := n.Repo.Config(); err == nil {
+			def.ListenAddrs = cfg.Addresses.Swarm
+		}
+		out := &SwarmKeyNetworks{Networks: []SwarmKeyNetwork{def}}
+
+		for _, net := range n.PNetRouter.Networks() {
+			sn := SwarmKeyNetwork{
+				Name:        net.Name,
+				Fingerprint: hex.EncodeToString(net.Fingerprint),
+				Peers:       peers[net.Name],
+			}
+			for _, a := range net.ListenAddrs {
+				sn.ListenAddrs = append(sn.ListenAddrs, a.String())
+			}
+			out.Networks = append(out.Networks, sn)
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SwarmKeyNetworks) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			for _, net := range out.Networks {
+				fp := net.Fingerprint
+				if fp == "" {
+					fp = "public"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%d peers\n", net.Name, fp, len(net.Peers))
+				for _, a := range net.ListenAddrs {
+					fmt.Fprintf(tw, "  listen\t%s\n", a)
+				}
+				for _, p := range net.Peers {
+					fmt.Fprintf(tw, "  peer\t%s\n", p)
+				}
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: SwarmKeyNetworks{},
+}
+
+// networkPeers returns the connected peers of n by private network name.
+func networkPeers(n *core.IpfsNode) map[string][]string {
+	seen := make(map[string]map[peer.ID]bool)
+	out := make(map[string][]string)
+	for _, c := range n.PeerHost.Network().Conns() {
+		name := pnetrouter.DefaultNetwork
+		if net := n.PNetRouter.Network(c.LocalMultiaddr(), c.RemoteMultiaddr()); net != nil {
+			name = net.Name
+		}
+		if seen[name] == nil {
+			seen[name] = make(map[peer.ID]bool)
+		}
+		if p := c.RemotePeer(); !seen[name][p] {
+			seen[name][p] = true
+			out[name] = append(out[name], p.Pretty())
+		}
+	}
+	for _, peers := range out {
+		sort.Strings(peers)
+	}
+	return out
+}
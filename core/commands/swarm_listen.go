@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// SwarmListenOutput is the output of 'ipfs swarm listen add' and
+// 'ipfs swarm listen rm'.
+type SwarmListenOutput struct {
+	Addrs []string
+
+	// Restart is set when the node keeps listening on the addresses
+	// removed until the daemon restarts.
+	Restart bool `json:",omitempty"`
+}
+
+var swarmListenCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Open and close the listeners of the swarm at runtime.",
+		ShortDescription: `
+'ipfs swarm listen add' and 'ipfs swarm listen rm' open and close the
+listeners of the running daemon, so that a new interface or port can be used
+without a restart. The addresses listened on are listed by
+'ipfs swarm addrs listen'.
+
+By default the changes are also saved under "Addresses.Swarm" so they survive
+a restart. Pass --session-only (or --permanent=false) to only apply them to
+the running daemon. The connected peers learn the new addresses of the node
+with identify push.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add": swarmListenAddCmd,
+		"rm":  swarmListenRmCmd,
+	},
+}
+
+var swarmListenAddCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Listen on the given addresses.",
+		ShortDescription: `
+'ipfs swarm listen add' opens listeners on the given addresses, e.g.
+/ip4/0.0.0.0/tcp/4002, and adds them to "Addresses.Swarm".
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("address", true, true, "Multiaddr to listen on.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmFiltersPermanentOptionName, "Save the addresses in the config (default)."),
+		cmds.BoolOption(swarmFiltersSessionOnlyOptionName, "Only listen on the addresses until the daemon restarts."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		return updateListenAddrs(req, res, env, true)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(swarmListenEncoder),
+	},
+	Type: SwarmListenOutput{},
+}
+
+var swarmListenRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stop listening on the given addresses.",
+		ShortDescription: `
+'ipfs swarm listen rm' closes the listeners on the given addresses, as listed
+by 'ipfs swarm addrs listen', and removes them from "Addresses.Swarm". The
+connections accepted on them stay open.
+
+When the swarm of the daemon can't close its listeners, the addresses are
+removed from the config, and the daemon listens on them until it restarts.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("address", true, true, "Multiaddr to stop listening on.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmFiltersPermanentOptionName, "Also remove the addresses from the config (default)."),
+		cmds.BoolOption(swarmFiltersSessionOnlyOptionName, "Only close the listeners of the running daemon."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		return updateListenAddrs(req, res, env, false)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(swarmListenEncoder),
+	},
+	Type: SwarmListenOutput{},
+}
+
+// updateListenAddrs opens or closes the listeners on the addresses given as
+// arguments, and saves the change in the config unless asked not to.
+func updateListenAddrs(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment, add bool) error {
+	api, err := cmdenv.GetApi(env, req)
+	if err != nil {
+		return err
+	}
+	swarmAPI, ok := api.Swarm().(*coreapi.SwarmAPI)
+	if !ok {
+		return errors.New("the node does not support changing its listen addresses")
+	}
+
+	persist, err := filtersPersist(req)
+	if err != nil {
+		return err
+	}
+
+	addrs := make([]ma.Multiaddr, 0, len(req.Arguments))
+	for _, arg := range req.Arguments {
+		a, err := ma.NewMultiaddr(arg)
+		if err != nil {
+			return cmds.Errorf(cmds.ErrClient, "invalid address %q: %s", arg, err)
+		}
+		addrs = append(addrs, a)
+	}
+
+	out := &SwarmListenOutput{}
+	var changed []ma.Multiaddr
+	if add {
+		changed, err = swarmAPI.Listen().Add(req.Context, addrs, coreapi.SwarmFiltersPersist(persist))
+	} else {
+		changed, err = swarmAPI.Listen().Remove(req.Context, addrs, coreapi.SwarmFiltersPersist(persist))
+		if err == coreapi.ErrListenCloseUnsupported && changed != nil {
+			out.Restart = true
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, a := range changed {
+		out.Addrs = append(out.Addrs, a.String())
+	}
+	return cmds.EmitOnce(res, out)
+}
+
+func swarmListenEncoder(req *cmds.Request, w io.Writer, out *SwarmListenOutput) error {
+	for _, a := range out.Addrs {
+		fmt.Fprintln(w, a)
+	}
+	if out.Restart {
+		fmt.Fprintln(w, "removed from the config, restart the daemon to stop listening on these addresses")
+	}
+	return nil
+}
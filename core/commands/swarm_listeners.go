@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	listenstats "github.com/ipfs/go-ipfs/core/listenstats"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// SwarmListenersOutput is the output of 'ipfs swarm listeners'.
+type SwarmListenersOutput struct {
+	Listeners []listenstats.Listener
+}
+
+var swarmListenersCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the statistics of each listen address.",
+		ShortDescription: `
+'ipfs swarm listeners' lists the listen addresses of the swarm with the
+connections accepted on them since the daemon started, the connections still
+open, the connections whose security handshake failed, and the bytes received
+and sent on the connections accepted. It helps finding which of the addresses
+advertised carry the traffic.
+
+A listener on an unspecified address, as /ip4/0.0.0.0/tcp/4001, sums up the
+connections accepted on every local address. The addresses the swarm doesn't
+listen on anymore are listed as closed. The handshakes and the bytes of QUIC
+are not counted.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline || n.ListenStats == nil {
+			return ErrNotOnline
+		}
+		return cmds.EmitOnce(res, &SwarmListenersOutput{Listeners: n.ListenStats.Listeners(n.PeerHost)})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SwarmListenersOutput) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "Address\tAccepted\tOpen\tHandshake Failures\tTotal In\tTotal Out")
+			for _, l := range out.Listeners {
+				addr := l.Addr
+				if l.Closed {
+					addr += " (closed)"
+				}
+				fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\n", addr, l.Accepted, l.Open, l.HandshakeFailures,
+					humanize.Bytes(uint64(l.BytesIn)),
+					humanize.Bytes(uint64(l.BytesOut)),
+				)
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: SwarmListenersOutput{},
+}
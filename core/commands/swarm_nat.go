@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	libp2p "github.com/ipfs/go-ipfs/core/node/libp2p"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+// SwarmNatOutput describes how reachable the node is from the internet.
+type SwarmNatOutput struct {
+	// Reachability is "public", "private" or "unknown", as detected by
+	// AutoNAT.
+	Reachability      string
+	ReachabilitySince time.Time
+
+	// NATPortMap and AutoRelay tell whether UPnP/NAT-PMP port mapping and
+	// auto relay are enabled.
+	NATPortMap bool
+	AutoRelay  bool
+
+	// ListenAddrs are the addresses the node listens on.
+	ListenAddrs []string
+
+	// ExternalAddrs are the public addresses advertised on top of the listen
+	// addresses, i.e. addresses mapped by the NAT or observed by peers.
+	ExternalAddrs []string
+
+	// RelayAddrs are the advertised relay addresses.
+	RelayAddrs []string
+
+	// RelayedConns are the connections going through a relay.
+	RelayedConns []string
+}
+
+var swarmNatCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Report NAT traversal status.",
+		ShortDescription: `
+'ipfs swarm nat' reports whether the node is reachable from the internet, and
+how: the reachability detected by AutoNAT, whether NAT port mapping and auto
+relay are enabled, the external addresses mapped by the NAT or observed by
+peers, and the relays in use.
+
+AutoNAT only runs when Swarm.EnableAutoRelay is set; otherwise reachability is
+reported as unknown.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return err
+		}
+
+		out := &SwarmNatOutput{
+			Reachability: libp2p.ReachabilityUnknown,
+			NATPortMap:   !cfg.Swarm.DisableNatPortMap,
+			AutoRelay:    cfg.Swarm.EnableAutoRelay,
+		}
+		if n.Reachability != nil {
+			out.Reachability, out.ReachabilitySince = n.Reachability.Status()
+		}
+
+		listen, err := n.PeerHost.Network().InterfaceListenAddresses()
+		if err != nil {
+			return err
+		}
+		isListen := make(map[string]bool, len(listen))
+		for _, a := range listen {
+			out.ListenAddrs = append(out.ListenAddrs, a.String())
+			isListen[a.String()] = true
+		}
+
+		for _, a := range n.PeerHost.Addrs() {
+			switch {
+			case isRelayAddr(a):
+				out.RelayAddrs = append(out.RelayAddrs, a.String())
+			case !isListen[a.String()] && manet.IsPublicAddr(a):
+				out.ExternalAddrs = append(out.ExternalAddrs, a.String())
+			}
+		}
+
+		for _, c := range n.PeerHost.Network().Conns() {
+			if isRelayAddr(c.RemoteMultiaddr()) {
+				out.RelayedConns = append(out.RelayedConns, fmt.Sprintf("%s/p2p/%s", c.RemoteMultiaddr(), c.RemotePeer().Pretty()))
+			}
+		}
+
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SwarmNatOutput) error {
+			fmt.Fprintf(w, "Reachability: %s", out.Reachability)
+			if out.Reachability != libp2p.ReachabilityUnknown {
+				fmt.Fprintf(w, " (since %s)", out.ReachabilitySince.Format(time.RFC3339))
+			} else if !out.AutoRelay {
+				fmt.Fprint(w, " (AutoNAT requires Swarm.EnableAutoRelay)")
+			}
+			fmt.Fprintln(w)
+			fmt.Fprintf(w, "NAT port mapping: %s\n", enabledString(out.NATPortMap))
+			fmt.Fprintf(w, "Auto relay: %s\n", enabledString(out.AutoRelay))
+
+			writeAddrSection(w, "Listen addresses", out.ListenAddrs)
+			writeAddrSection(w, "External addresses", out.ExternalAddrs)
+			writeAddrSection(w, "Relay addresses", out.RelayAddrs)
+			writeAddrSection(w, "Relayed connections", out.RelayedConns)
+			return nil
+		}),
+	},
+	Type: SwarmNatOutput{},
+}
+
+func isRelayAddr(a ma.Multiaddr) bool {
+	_, err := a.ValueForProtocol(ma.P_CIRCUIT)
+	return err == nil
+}
+
+func enabledString(b bool) string {
+	if b {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+func writeAddrSection(w io.Writer, title string, addrs []string) {
+	fmt.Fprintf(w, "%s:\n", title)
+	if len(addrs) == 0 {
+		fmt.Fprintln(w, "\t(none)")
+		return
+	}
+	fmt.Fprintf(w, "\t%s\n", strings.Join(addrs, "\n\t"))
+}
@@ -0,0 +1,285 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ping "github.com/libp2p/go-libp2p/p2p/protocol/ping"
+)
+
+const (
+	swarmPingCountOptionName      = "count"
+	swarmPingContinuousOptionName = "continuous"
+	swarmPingIntervalOptionName   = "interval"
+	swarmPingThresholdOptionName  = "disconnect-above"
+
+	// swarmPingParallelism bounds the number of peers pinged at once.
+	swarmPingParallelism = 64
+)
+
+// SwarmPingPeer holds the ping results for a single peer.
+type SwarmPingPeer struct {
+	Peer         string
+	Sent         int
+	Received     int
+	Min          time.Duration
+	Median       time.Duration
+	Max          time.Duration
+	Error        string `json:",omitempty"`
+	Disconnected bool   `json:",omitempty"`
+}
+
+// SwarmPingRound holds the results of pinging all peers once.
+type SwarmPingRound struct {
+	Round int
+	Peers []SwarmPingPeer
+
+	// P50 and P95 are computed over the median latency of every peer that
+	// answered at least one ping.
+	P50 time.Duration
+	P95 time.Duration
+}
+
+var swarmPingCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Ping connected peers in parallel and report latency percentiles.",
+		ShortDescription: `
+'ipfs swarm ping' pings every peer this node is connected to (or only the
+given peers) in parallel, and reports per-peer min/median/max round-trip
+times along with the p50 and p95 latencies across peers.
+`,
+		LongDescription: `
+'ipfs swarm ping' pings every peer this node is connected to (or only the
+given peers) in parallel, and reports per-peer min/median/max round-trip
+times along with the p50 and p95 latencies across peers.
+
+With --continuous, rounds are repeated every --interval until the command is
+interrupted, emitting one report per round.
+
+With --disconnect-above, peers whose median latency exceeds the given
+duration, or that don't answer at all, are disconnected. This is useful for
+curating low-latency private clusters; note that disconnected peers may
+reconnect later unless they are filtered.
+
+Example:
+
+    > ipfs swarm ping -n 5 --disconnect-above 200ms
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer ID", false, true, "Peers to ping. Defaults to all connected peers."),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption(swarmPingCountOptionName, "n", "Number of ping messages to send to each peer per round.").WithDefault(3),
+		cmds.BoolOption(swarmPingContinuousOptionName, "Keep pinging in rounds until interrupted."),
+		cmds.StringOption(swarmPingIntervalOptionName, "i", "Time to wait between rounds in continuous mode.").WithDefault("10s"),
+		cmds.StringOption(swarmPingThresholdOptionName, "Disconnect peers whose median latency exceeds this duration."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+
+		count, _ := req.Options[swarmPingCountOptionName].(int)
+		if count <= 0 {
+			return fmt.Errorf("ping count must be greater than 0, was %d", count)
+		}
+
+		intervalS, _ := req.Options[swarmPingIntervalOptionName].(string)
+		interval, err := time.ParseDuration(intervalS)
+		if err != nil {
+			return err
+		}
+
+		var threshold time.Duration
+		if s, ok := req.Options[swarmPingThresholdOptionName].(string); ok {
+			threshold, err = time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			if threshold <= 0 {
+				return fmt.Errorf("latency threshold must be positive")
+			}
+		}
+
+		var peers []peer.ID
+		for _, arg := range req.Arguments {
+			pid, err := peer.Decode(arg)
+			if err != nil {
+				return err
+			}
+			if pid == n.Identity {
+				return ErrPingSelf
+			}
+			peers = append(peers, pid)
+		}
+
+		continuous, _ := req.Options[swarmPingContinuousOptionName].(bool)
+		for round := 1; ; round++ {
+			targets := peers
+			if len(targets) == 0 {
+				targets = n.PeerHost.Network().Peers()
+			}
+
+			out := pingPeers(req.Context, n.PeerHost, targets, count)
+			out.Round = round
+
+			if threshold > 0 {
+				for i := range out.Peers {
+					p := &out.Peers[i]
+					if p.Received > 0 && p.Median <= threshold {
+						continue
+					}
+					pid, err := peer.Decode(p.Peer)
+					if err != nil {
+						return err
+					}
+					if err := n.PeerHost.Network().ClosePeer(pid); err != nil {
+						log.Debugf("swarm ping: failed to disconnect %s: %s", p.Peer, err)
+						continue
+					}
+					p.Disconnected = true
+				}
+			}
+
+			if err := res.Emit(out); err != nil {
+				return err
+			}
+			if !continuous {
+				return nil
+			}
+
+			select {
+			case <-time.After(interval):
+			case <-req.Context.Done():
+				return req.Context.Err()
+			}
+		}
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SwarmPingRound) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "PEER\tRECEIVED\tMIN\tMEDIAN\tMAX\t")
+			for _, p := range out.Peers {
+				fmt.Fprintf(tw, "%s\t%d/%d\t%s\t%s\t%s\t", p.Peer, p.Received, p.Sent, p.Min, p.Median, p.Max)
+				if p.Error != "" {
+					fmt.Fprintf(tw, "error: %s ", p.Error)
+				}
+				if p.Disconnected {
+					fmt.Fprint(tw, "(disconnected)")
+				}
+				fmt.Fprintln(tw)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "round %d: %d peers, p50: %s, p95: %s\n", out.Round, len(out.Peers), out.P50, out.P95)
+			return nil
+		}),
+	},
+	Type: SwarmPingRound{},
+}
+
+// pingPeers pings every peer in peers count times, in parallel.
+func pingPeers(ctx context.Context, h host.Host, peers []peer.ID, count int) *SwarmPingRound {
+	out := &SwarmPingRound{Peers: make([]SwarmPingPeer, len(peers))}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, swarmPingParallelism)
+	for i, pid := range peers {
+		wg.Add(1)
+		go func(i int, pid peer.ID) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			out.Peers[i] = pingPeer(ctx, h, pid, count)
+		}(i, pid)
+	}
+	wg.Wait()
+
+	sort.Slice(out.Peers, func(i, j int) bool {
+		return out.Peers[i].Peer < out.Peers[j].Peer
+	})
+
+	var medians []time.Duration
+	for _, p := range out.Peers {
+		if p.Received > 0 {
+			medians = append(medians, p.Median)
+		}
+	}
+	sortDurations(medians)
+	out.P50 = percentile(medians, 0.50)
+	out.P95 = percentile(medians, 0.95)
+	return out
+}
+
+func pingPeer(ctx context.Context, h host.Host, pid peer.ID, count int) SwarmPingPeer {
+	res := SwarmPingPeer{Peer: pid.Pretty()}
+
+	ctx, cancel := context.WithTimeout(ctx, kPingTimeout*time.Duration(count))
+	defer cancel()
+
+	var rtts []time.Duration
+	pings := ping.Ping(ctx, h, pid)
+	for res.Sent < count {
+		r, ok := <-pings
+		if !ok {
+			break
+		}
+		res.Sent++
+		if r.Error != nil {
+			res.Error = r.Error.Error()
+			continue
+		}
+		rtts = append(rtts, r.RTT)
+	}
+	if res.Sent == 0 && ctx.Err() != nil {
+		res.Error = ctx.Err().Error()
+	}
+
+	res.Received = len(rtts)
+	if len(rtts) > 0 {
+		sortDurations(rtts)
+		res.Min = rtts[0]
+		res.Median = percentile(rtts, 0.5)
+		res.Max = rtts[len(rtts)-1]
+	}
+	return res
+}
+
+func sortDurations(ds []time.Duration) {
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+}
+
+// percentile returns the p-th percentile (0 < p <= 1) of the sorted
+// durations, using the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
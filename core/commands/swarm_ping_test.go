@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	if percentile(nil, 0.5) != 0 {
+		t.Fatal("expected zero percentile for no samples")
+	}
+
+	var samples []time.Duration
+	for i := 1; i <= 20; i++ {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+
+	for _, c := range []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0.5, 10 * time.Millisecond},
+		{0.95, 19 * time.Millisecond},
+		{1, 20 * time.Millisecond},
+	} {
+		if got := percentile(samples, c.p); got != c.want {
+			t.Errorf("p%v: expected %s, got %s", c.p*100, c.want, got)
+		}
+	}
+}
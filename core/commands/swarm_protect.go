@@ -0,0 +1,176 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	libp2p "github.com/ipfs/go-ipfs/core/node/libp2p"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// ProtectedPeer is a peer whose connections are never closed by the
+// connection manager.
+type ProtectedPeer struct {
+	ID        string
+	Connected bool
+}
+
+// ProtectedPeers is the output of 'ipfs swarm protect ls'.
+type ProtectedPeers struct {
+	Peers []ProtectedPeer
+}
+
+var swarmProtectCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Keep connections to given peers open.",
+		ShortDescription: `
+Protected peers are never disconnected by the connection manager, regardless
+of its watermarks. This is useful for peers the node must stay connected to,
+like the other members of a cluster.
+
+Protected peers are saved under "Swarm.ProtectedPeers" in the config and
+protected again when the daemon starts.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add": swarmProtectAddCmd,
+		"rm":  swarmProtectRmCmd,
+		"ls":  swarmProtectLsCmd,
+	},
+}
+
+var swarmProtectAddCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Protect connections to the given peers.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer ID", true, true, "Peers to protect.").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		return updateProtectedPeers(req, res, env, true)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(stringListEncoder),
+	},
+	Type: stringList{},
+}
+
+var swarmProtectRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stop protecting connections to the given peers.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer ID", true, true, "Peers to unprotect.").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		return updateProtectedPeers(req, res, env, false)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(stringListEncoder),
+	},
+	Type: stringList{},
+}
+
+var swarmProtectLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List protected peers.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		peers, err := libp2p.LoadProtectedPeers(n.Repo)
+		if err != nil {
+			return err
+		}
+
+		out := &ProtectedPeers{Peers: make([]ProtectedPeer, 0, len(peers))}
+		for _, p := range peers {
+			connected := false
+			if n.PeerHost != nil {
+				connected = n.PeerHost.Network().Connectedness(p) == inet.Connected
+			}
+			out.Peers = append(out.Peers, ProtectedPeer{ID: p.Pretty(), Connected: connected})
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ProtectedPeers) error {
+			for _, p := range out.Peers {
+				state := "disconnected"
+				if p.Connected {
+					state = "connected"
+				}
+				fmt.Fprintf(w, "%s\t%s\n", p.ID, state)
+			}
+			return nil
+		}),
+	},
+	Type: ProtectedPeers{},
+}
+
+// updateProtectedPeers protects or unprotects the peers given as arguments,
+// on the running node if any, and in the config.
+func updateProtectedPeers(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment, protect bool) error {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return err
+	}
+
+	args := make([]peer.ID, 0, len(req.Arguments))
+	for _, arg := range req.Arguments {
+		pid, err := peer.Decode(arg)
+		if err != nil {
+			return err
+		}
+		args = append(args, pid)
+	}
+
+	peers, err := libp2p.LoadProtectedPeers(n.Repo)
+	if err != nil {
+		return err
+	}
+	set := make(map[peer.ID]bool, len(peers))
+	for _, p := range peers {
+		set[p] = true
+	}
+
+	var output []string
+	for _, pid := range args {
+		if n.PeerHost != nil {
+			if protect {
+				n.PeerHost.ConnManager().Protect(pid, libp2p.ProtectTag)
+			} else {
+				n.PeerHost.ConnManager().Unprotect(pid, libp2p.ProtectTag)
+			}
+		}
+
+		if set[pid] == protect {
+			continue
+		}
+		if protect {
+			peers = append(peers, pid)
+			output = append(output, "protect "+pid.Pretty())
+		} else {
+			for i, p := range peers {
+				if p == pid {
+					peers = append(peers[:i], peers[i+1:]...)
+					break
+				}
+			}
+			output = append(output, "unprotect "+pid.Pretty())
+		}
+		set[pid] = protect
+	}
+
+	if err := libp2p.StoreProtectedPeers(n.Repo, peers); err != nil {
+		return err
+	}
+	return cmds.EmitOnce(res, &stringList{output})
+}
@@ -0,0 +1,388 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	libp2p "github.com/ipfs/go-ipfs/core/node/libp2p"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	swarmRelayHopOptionName  = "hop"
+	swarmRelayStopOptionName = "stop"
+
+	// swarmRelayConnectTimeout bounds the connection to a newly added relay.
+	swarmRelayConnectTimeout = 30 * time.Second
+)
+
+// SwarmRelay describes a circuit relay known to the node.
+type SwarmRelay struct {
+	ID    string
+	Addrs []string `json:",omitempty"`
+
+	// Static is true for the relays listed under Swarm.StaticRelays.
+	Static    bool
+	Connected bool
+
+	// InUse is true when connections go through the relay, or when the
+	// node advertises an address through it.
+	InUse bool
+}
+
+// SwarmRelays is the output of 'ipfs swarm relay ls'.
+type SwarmRelays struct {
+	Hop    bool
+	Stop   bool
+	Relays []SwarmRelay
+}
+
+// SwarmRelayMode is the output of 'ipfs swarm relay mode'.
+type SwarmRelayMode struct {
+	Hop  bool
+	Stop bool
+
+	// Changed is true when the mode was updated and the daemon must be
+	// restarted to apply it.
+	Changed bool
+}
+
+var swarmRelayCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage circuit relays.",
+		ShortDescription: `
+Circuit relays let peers that can't dial each other directly connect through a
+third peer.
+
+Static relays are saved under "Swarm.StaticRelays" in the config; the node
+connects to them when the daemon starts and keeps these connections open. The
+relay mode is saved under "Swarm.EnableRelayHop" and "Swarm.DisableRelay".
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":   swarmRelayLsCmd,
+		"add":  swarmRelayAddCmd,
+		"rm":   swarmRelayRmCmd,
+		"mode": swarmRelayModeCmd,
+	},
+}
+
+var swarmRelayLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List static relays and relays in use.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return err
+		}
+
+		static, err := libp2p.LoadStaticRelays(n.Repo)
+		if err != nil {
+			return err
+		}
+
+		relays := make(map[peer.ID]*SwarmRelay)
+		get := func(p peer.ID) *SwarmRelay {
+			r, ok := relays[p]
+			if !ok {
+				r = &SwarmRelay{ID: p.Pretty()}
+				relays[p] = r
+			}
+			return r
+		}
+
+		for _, pi := range static {
+			r := get(pi.ID)
+			r.Static = true
+			for _, a := range pi.Addrs {
+				r.Addrs = append(r.Addrs, a.String())
+			}
+		}
+
+		if n.PeerHost != nil {
+			for _, c := range n.PeerHost.Network().Conns() {
+				if p, ok := relayOf(c.RemoteMultiaddr()); ok {
+					get(p).InUse = true
+				}
+			}
+			for _, a := range n.PeerHost.Addrs() {
+				if p, ok := relayOf(a); ok {
+					get(p).InUse = true
+				}
+			}
+			for p, r := range relays {
+				r.Connected = n.PeerHost.Network().Connectedness(p) == inet.Connected
+			}
+		}
+
+		out := &SwarmRelays{
+			Hop:    !cfg.Swarm.DisableRelay && cfg.Swarm.EnableRelayHop,
+			Stop:   !cfg.Swarm.DisableRelay,
+			Relays: make([]SwarmRelay, 0, len(relays)),
+		}
+		for _, r := range relays {
+			out.Relays = append(out.Relays, *r)
+		}
+		sort.Slice(out.Relays, func(i, j int) bool {
+			return out.Relays[i].ID < out.Relays[j].ID
+		})
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SwarmRelays) error {
+			fmt.Fprintf(w, "Hop: %s\n", enabledString(out.Hop))
+			fmt.Fprintf(w, "Stop: %s\n", enabledString(out.Stop))
+			for _, r := range out.Relays {
+				var flags []string
+				if r.Static {
+					flags = append(flags, "static")
+				}
+				if r.InUse {
+					flags = append(flags, "in use")
+				}
+				if r.Connected {
+					flags = append(flags, "connected")
+				} else {
+					flags = append(flags, "disconnected")
+				}
+				fmt.Fprintf(w, "%s\t%s\n", r.ID, strings.Join(flags, ", "))
+			}
+			return nil
+		}),
+	},
+	Type: SwarmRelays{},
+}
+
+var swarmRelayAddCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add static relays.",
+		ShortDescription: `
+'ipfs swarm relay add' saves the given relays under "Swarm.StaticRelays" and,
+if the daemon is running, connects to them.
+
+Example:
+
+    > ipfs swarm relay add /ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("address", true, true, "Address of the relay, ending with /p2p/<peer ID>.").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		added := make([]peer.AddrInfo, 0, len(req.Arguments))
+		for _, arg := range req.Arguments {
+			pi, err := libp2p.ParseRelay(arg)
+			if err != nil {
+				return fmt.Errorf("invalid relay address %q: %s", arg, err)
+			}
+			added = append(added, *pi)
+		}
+
+		relays, err := libp2p.LoadStaticRelays(n.Repo)
+		if err != nil {
+			return err
+		}
+
+		var output []string
+		for _, pi := range added {
+			relays = mergeRelay(relays, pi)
+			output = append(output, "add "+pi.ID.Pretty())
+		}
+		if err := libp2p.StoreStaticRelays(n.Repo, relays); err != nil {
+			return err
+		}
+
+		if n.IsOnline {
+			ctx, cancel := context.WithTimeout(req.Context, swarmRelayConnectTimeout)
+			defer cancel()
+			for i, pi := range added {
+				if err := libp2p.ConnectRelay(ctx, n.PeerHost, pi); err != nil {
+					output[i] += " failure: " + err.Error()
+				}
+			}
+		}
+		return cmds.EmitOnce(res, &stringList{output})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(stringListEncoder),
+	},
+	Type: stringList{},
+}
+
+var swarmRelayRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove static relays.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("relay", true, true, "Peer ID or address of the relay.").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]peer.ID, 0, len(req.Arguments))
+		for _, arg := range req.Arguments {
+			if strings.HasPrefix(arg, "/") {
+				pi, err := libp2p.ParseRelay(arg)
+				if err != nil {
+					return fmt.Errorf("invalid relay address %q: %s", arg, err)
+				}
+				ids = append(ids, pi.ID)
+				continue
+			}
+			pid, err := peer.Decode(arg)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, pid)
+		}
+
+		relays, err := libp2p.LoadStaticRelays(n.Repo)
+		if err != nil {
+			return err
+		}
+
+		var output []string
+		for _, pid := range ids {
+			for i, pi := range relays {
+				if pi.ID != pid {
+					continue
+				}
+				relays = append(relays[:i], relays[i+1:]...)
+				output = append(output, "rm "+pid.Pretty())
+				if n.PeerHost != nil {
+					n.PeerHost.ConnManager().Unprotect(pid, libp2p.RelayTag)
+				}
+				break
+			}
+		}
+		if err := libp2p.StoreStaticRelays(n.Repo, relays); err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &stringList{output})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(stringListEncoder),
+	},
+	Type: stringList{},
+}
+
+var swarmRelayModeCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show or change the relay mode.",
+		ShortDescription: `
+'ipfs swarm relay mode' shows whether the node relays connections for other
+peers (hop) and accepts connections relayed by other peers (stop).
+
+With --hop or --stop, the mode is saved to "Swarm.EnableRelayHop" and
+"Swarm.DisableRelay" respectively. The daemon must be restarted for changes
+to take effect. Disabling stop disables the relay transport entirely, and
+therefore hop too.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmRelayHopOptionName, "Relay connections for other peers."),
+		cmds.BoolOption(swarmRelayStopOptionName, "Accept connections relayed by other peers."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return err
+		}
+		hop := cfg.Swarm.EnableRelayHop
+		stop := !cfg.Swarm.DisableRelay
+
+		out := &SwarmRelayMode{}
+		if v, ok := req.Options[swarmRelayHopOptionName].(bool); ok && v != hop {
+			if err := n.Repo.SetConfigKey("Swarm.EnableRelayHop", v); err != nil {
+				return err
+			}
+			hop = v
+			out.Changed = true
+		}
+		if v, ok := req.Options[swarmRelayStopOptionName].(bool); ok && v != stop {
+			if err := n.Repo.SetConfigKey("Swarm.DisableRelay", !v); err != nil {
+				return err
+			}
+			stop = v
+			out.Changed = true
+		}
+
+		out.Hop = stop && hop
+		out.Stop = stop
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SwarmRelayMode) error {
+			fmt.Fprintf(w, "Hop: %s\n", enabledString(out.Hop))
+			fmt.Fprintf(w, "Stop: %s\n", enabledString(out.Stop))
+			if out.Changed {
+				fmt.Fprintln(w, "Restart the daemon to apply the changes.")
+			}
+			return nil
+		}),
+	},
+	Type: SwarmRelayMode{},
+}
+
+// relayOf returns the relay of a relayed address, i.e. the peer ID preceding
+// the /p2p-circuit component.
+func relayOf(a ma.Multiaddr) (peer.ID, bool) {
+	if !isRelayAddr(a) {
+		return "", false
+	}
+	s, err := a.ValueForProtocol(ma.P_IPFS)
+	if err != nil {
+		return "", false
+	}
+	p, err := peer.Decode(s)
+	return p, err == nil
+}
+
+// mergeRelay adds pi to relays, merging its addresses with an existing entry
+// for the same peer.
+func mergeRelay(relays []peer.AddrInfo, pi peer.AddrInfo) []peer.AddrInfo {
+	for i := range relays {
+		if relays[i].ID != pi.ID {
+			continue
+		}
+	addrs:
+		for _, a := range pi.Addrs {
+			for _, b := range relays[i].Addrs {
+				if a.Equal(b) {
+					continue addrs
+				}
+			}
+			relays[i].Addrs = append(relays[i].Addrs, a)
+		}
+		return relays
+	}
+	return append(relays, pi)
+}
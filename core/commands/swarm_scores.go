@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	peerscore "github.com/ipfs/go-ipfs/core/peerscore"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	inet "github.com/libp2p/go-libp2p-core/network"
+)
+
+// PeerScore is the score of a peer listed by 'ipfs swarm scores'.
+type PeerScore struct {
+	Peer      string
+	Score     float64
+	Connected bool
+
+	DialFailures float64
+	Misbehavior  float64
+	BlocksServed float64
+	Latency      time.Duration
+}
+
+const swarmScoresConnectedOptionName = "connected"
+
+var swarmScoresCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the scores of the peers.",
+		ShortDescription: `
+'ipfs swarm scores' lists the score of the peers, highest first, with the
+counters it is computed from: the useful blocks the peer served, its failed
+dials, its misbehavior, like sending blocks it wasn't asked for, and its
+latency. The counters decay, halved every Swarm.PeerScore.HalfLife, and are
+kept across restarts.
+
+The score of a connected peer is its tag on the connection manager, bounded
+by Swarm.PeerScore.MaxTag, so that the connections of the best peers are kept
+when the connection manager trims. The scores are enabled with
+Swarm.PeerScore.Enabled.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmScoresConnectedOptionName, "Only list the connected peers."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !nd.IsOnline {
+			return ErrNotOnline
+		}
+		if nd.PeerScores == nil {
+			return fmt.Errorf("peer scores disabled: set %s.Enabled in the config", peerscore.ConfigKey)
+		}
+
+		connected, _ := req.Options[swarmScoresConnectedOptionName].(bool)
+		net := nd.PeerHost.Network()
+		scores := nd.PeerScores.Scores()
+		out := make([]PeerScore, 0, len(scores))
+		for _, s := range scores {
+			ps := PeerScore{
+				Peer:         s.Peer.Pretty(),
+				Score:        s.Score,
+				Connected:    net.Connectedness(s.Peer) == inet.Connected,
+				DialFailures: s.DialFailures,
+				Misbehavior:  s.Misbehavior,
+				BlocksServed: s.BlocksServed,
+				Latency:      s.Latency,
+			}
+			if connected && !ps.Connected {
+				continue
+			}
+			out = append(out, ps)
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out []PeerScore) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "PEER\tSCORE\tBLOCKS\tDIAL FAILURES\tMISBEHAVIOR\tLATENCY\tCONNECTED")
+			for _, s := range out {
+				fmt.Fprintf(tw, "%s\t%.1f\t%.1f\t%.1f\t%.1f\t%s\t%t\n", s.Peer, s.Score, s.BlocksServed, s.DialFailures, s.Misbehavior, s.Latency, s.Connected)
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: []PeerScore{},
+}
@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	metrics "github.com/libp2p/go-libp2p-core/metrics"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// SwarmStats is a snapshot of the bandwidth reporter, broken down per peer
+// and per protocol.
+type SwarmStats struct {
+	Totals    metrics.Stats
+	Peers     map[string]metrics.Stats
+	Protocols map[string]metrics.Stats
+}
+
+var swarmStatsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Report bandwidth usage per peer and per protocol.",
+		ShortDescription: `
+'ipfs swarm stats' prints the total bytes sent and received and the current
+rates, broken down by peer and by protocol. With --poll, a new report is
+emitted every interval until the command is interrupted.
+`,
+		LongDescription: `
+'ipfs swarm stats' prints the total bytes sent and received and the current
+rates, broken down by peer and by protocol. With --poll, a new report is
+emitted every interval until the command is interrupted.
+
+Use --peer to restrict the per-peer section to a single peer. Combine with
+'--enc=json' to get machine-readable output suitable for scraping; in poll
+mode one JSON object is emitted per interval.
+
+Example:
+
+    > ipfs swarm stats --poll -i 5s --enc=json
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(statPeerOptionName, "p", "Only report the given peer in the per-peer section."),
+		cmds.BoolOption(statPollOptionName, "Print bandwidth at an interval."),
+		cmds.StringOption(statIntervalOptionName, "i", `Time interval to wait between updating output, if 'poll' is true.
+
+    This accepts durations such as "300s", "1.5h" or "2h45m". Valid time units are:
+    "ns", "us" (or "µs"), "ms", "s", "m", "h".`).WithDefault("1s"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !nd.IsOnline {
+			return ErrNotOnline
+		}
+
+		if nd.Reporter == nil {
+			return fmt.Errorf("bandwidth reporter disabled in config")
+		}
+
+		var pid peer.ID
+		if pstr, ok := req.Options[statPeerOptionName].(string); ok {
+			pid, err = peer.Decode(pstr)
+			if err != nil {
+				return err
+			}
+		}
+
+		timeS, _ := req.Options[statIntervalOptionName].(string)
+		interval, err := time.ParseDuration(timeS)
+		if err != nil {
+			return err
+		}
+
+		doPoll, _ := req.Options[statPollOptionName].(bool)
+		for {
+			out := &SwarmStats{
+				Totals:    nd.Reporter.GetBandwidthTotals(),
+				Peers:     make(map[string]metrics.Stats),
+				Protocols: make(map[string]metrics.Stats),
+			}
+
+			if pid != "" {
+				out.Peers[pid.Pretty()] = nd.Reporter.GetBandwidthForPeer(pid)
+			} else {
+				for p, s := range nd.Reporter.GetBandwidthByPeer() {
+					out.Peers[p.Pretty()] = s
+				}
+			}
+			for proto, s := range nd.Reporter.GetBandwidthByProtocol() {
+				out.Protocols[string(proto)] = s
+			}
+
+			if err := res.Emit(out); err != nil {
+				return err
+			}
+			if !doPoll {
+				return nil
+			}
+			select {
+			case <-time.After(interval):
+			case <-req.Context.Done():
+				return req.Context.Err()
+			}
+		}
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SwarmStats) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+
+			fmt.Fprintln(tw, "\tTotal In\tTotal Out\tRate In\tRate Out")
+			writeStatsRow(tw, "Total", out.Totals)
+
+			fmt.Fprintln(tw, "\nPeers")
+			for _, name := range sortedStatKeys(out.Peers) {
+				writeStatsRow(tw, name, out.Peers[name])
+			}
+
+			fmt.Fprintln(tw, "\nProtocols")
+			for _, name := range sortedStatKeys(out.Protocols) {
+				proto := name
+				if proto == "" {
+					proto = "<no protocol name>"
+				}
+				writeStatsRow(tw, proto, out.Protocols[name])
+			}
+			fmt.Fprintln(tw)
+
+			return tw.Flush()
+		}),
+	},
+	Type: SwarmStats{},
+}
+
+func writeStatsRow(w io.Writer, name string, s metrics.Stats) {
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s/s\t%s/s\n", name,
+		humanize.Bytes(uint64(s.TotalIn)),
+		humanize.Bytes(uint64(s.TotalOut)),
+		humanize.Bytes(uint64(s.RateIn)),
+		humanize.Bytes(uint64(s.RateOut)),
+	)
+}
+
+// sortedStatKeys returns the keys of stats, busiest first.
+func sortedStatKeys(stats map[string]metrics.Stats) []string {
+	keys := make([]string, 0, len(stats))
+	for k := range stats {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := stats[keys[i]], stats[keys[j]]
+		if ta, tb := a.TotalIn+a.TotalOut, b.TotalIn+b.TotalOut; ta != tb {
+			return ta > tb
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	receipt "github.com/ipfs/go-ipfs/core/receipt"
+
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// TransferReceipt is a receipt listed by 'ipfs transfer receipts'.
+type TransferReceipt struct {
+	Root string
+	From string
+	Peer string
+	Time time.Time
+
+	// Error is set when the receipt is not valid anymore.
+	Error string `json:",omitempty"`
+}
+
+var TransferCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect the content transfers to other peers.",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"receipts": transferReceiptsCmd,
+	},
+}
+
+var transferReceiptsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the receipts of the content delivered to other peers.",
+		ShortDescription: `
+'ipfs transfer receipts' lists the receipts signed by the peers the content
+was pushed to with 'ipfs pin push --receipt', as the proofs of its delivery.
+A peer signs a receipt once it fetched the whole DAG of a root and pinned it.
+The signatures are checked again: an invalid receipt is listed with its
+error. With a path, only the receipts of that root are listed.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", false, false, "Path to the root to list the receipts of."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		root := cid.Undef
+		if len(req.Arguments) > 0 {
+			api, err := cmdenv.GetApi(env, req)
+			if err != nil {
+				return err
+			}
+			rp, err := api.ResolvePath(req.Context, path.New(req.Arguments[0]))
+			if err != nil {
+				return err
+			}
+			root = rp.Cid()
+		}
+
+		receipts, err := receipt.NewStore(n.Repo.Datastore()).Receipts(root)
+		if err != nil {
+			return err
+		}
+		out := make([]*TransferReceipt, 0, len(receipts))
+		for _, r := range receipts {
+			tr := &TransferReceipt{
+				Root: enc.Encode(r.Root),
+				From: r.From.Pretty(),
+				Peer: r.Peer.Pretty(),
+				Time: r.Time,
+			}
+			if err := r.Verify(); err != nil {
+				tr.Error = err.Error()
+			}
+			out = append(out, tr)
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out []*TransferReceipt) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			for _, r := range out {
+				status := "valid"
+				if r.Error != "" {
+					status = "invalid: " + r.Error
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Root, r.Peer, r.Time.Format(time.RFC3339), status)
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: []*TransferReceipt{},
+}
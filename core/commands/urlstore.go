@@ -1,8 +1,10 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 
 	filestore "github.com/ipfs/go-filestore"
@@ -34,7 +36,9 @@ The URL provided must be stable and ideally on a web server under your
 control.
 
 The file is added using raw-leaves but otherwise using the default
-settings for 'ipfs add'.
+settings for 'ipfs add'. Its blocks are fetched from the URL on demand, as
+byte ranges, so the server must support range requests: this is checked
+before adding.
 `,
 	},
 	Options: []cmds.Option{
@@ -64,6 +68,10 @@ settings for 'ipfs add'.
 			return err
 		}
 
+		if err := checkRangeSupport(req.Context, url); err != nil {
+			return err
+		}
+
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
@@ -102,3 +110,29 @@ settings for 'ipfs add'.
 		}),
 	},
 }
+
+// checkRangeSupport checks that the server of u answers range requests, which
+// the urlstore sends to fetch the blocks of the file.
+func checkRangeSupport(ctx context.Context, u *url.URL) error {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return nil
+	case http.StatusOK:
+		return fmt.Errorf("%s can't be added to the urlstore: its server doesn't support range requests", u)
+	default:
+		return fmt.Errorf("%s can't be added to the urlstore: %s", u, resp.Status)
+	}
+}
@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCheckRangeSupport(t *testing.T) {
+	content := bytes.Repeat([]byte("urlstore"), 100)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ranges", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	})
+	mux.HandleFunc("/no-ranges", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, test := range []struct {
+		path string
+		ok   bool
+	}{
+		{"/ranges", true},
+		{"/no-ranges", false},
+		{"/missing", false},
+	} {
+		u, err := url.Parse(srv.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = checkRangeSupport(context.Background(), u)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: unexpected result %v", test.path, err)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Package contenttype decides the content type files are served with by the
+// gateway.
+//
+// Files added to IPFS carry no content type, so it is guessed from the
+// extension of their name, or else sniffed from their first bytes. The guess
+// can be overridden by the operator, by extension or by CID, with overrides
+// kept in the datastore of the repo.
+package contenttype
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	lru "github.com/hashicorp/golang-lru"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+)
+
+// SniffLen is the number of bytes sniffed to detect a content type.
+const SniffLen = 512
+
+// sniffCacheSize is the number of sniffed content types a store keeps, so
+// that the range requests of a file don't fetch its first bytes again.
+const sniffCacheSize = 1024
+
+var (
+	prefix    = ds.NewKey("/local/contenttype")
+	extPrefix = prefix.ChildString("ext")
+	cidPrefix = prefix.ChildString("cid")
+)
+
+// Override is a content type set by the operator for the files with an
+// extension, or for a CID.
+type Override struct {
+	Extension string `json:",omitempty"`
+	Cid       string `json:",omitempty"`
+	Type      string
+}
+
+// Store holds the overrides, and the content types last sniffed.
+type Store struct {
+	d       ds.Datastore
+	sniffed *lru.Cache
+}
+
+// NewStore returns the store of the overrides in d.
+func NewStore(d ds.Datastore) *Store {
+	sniffed, _ := lru.New(sniffCacheSize)
+	return &Store{d: d, sniffed: sniffed}
+}
+
+// overrideKey returns the key of the override of target, an extension
+// starting with a dot or a CID.
+func overrideKey(target string) (ds.Key, error) {
+	if strings.HasPrefix(target, ".") {
+		ext := strings.ToLower(target)
+		if len(ext) < 2 || strings.ContainsAny(ext[1:], "/.") {
+			return ds.Key{}, fmt.Errorf("invalid extension %q", target)
+		}
+		return extPrefix.ChildString(ext[1:]), nil
+	}
+	c, err := cid.Decode(target)
+	if err != nil {
+		return ds.Key{}, fmt.Errorf("%q is neither an extension nor a CID: %s", target, err)
+	}
+	return cidKey(c), nil
+}
+
+// cidKey returns the key of the override of c. The CIDs are stored in
+// version 1, so that an override matches both versions.
+func cidKey(c cid.Cid) ds.Key {
+	return cidPrefix.ChildString(cid.NewCidV1(c.Type(), c.Hash()).String())
+}
+
+// Set overrides the content type of target, an extension such as ".md" or a
+// CID.
+func (s *Store) Set(target string, ctype string) error {
+	k, err := overrideKey(target)
+	if err != nil {
+		return err
+	}
+	if _, _, err := mime.ParseMediaType(ctype); err != nil {
+		return fmt.Errorf("invalid content type %q: %s", ctype, err)
+	}
+	return s.d.Put(k, []byte(ctype))
+}
+
+// Remove removes the override of target, and returns false if there was
+// none.
+func (s *Store) Remove(target string) (bool, error) {
+	k, err := overrideKey(target)
+	if err != nil {
+		return false, err
+	}
+	has, err := s.d.Has(k)
+	if err != nil || !has {
+		return false, err
+	}
+	return true, s.d.Delete(k)
+}
+
+// List returns the overrides, the extensions first.
+func (s *Store) List() ([]Override, error) {
+	res, err := s.d.Query(query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Override, 0, len(entries))
+	for _, e := range entries {
+		k := ds.RawKey(e.Key)
+		o := Override{Type: string(e.Value)}
+		switch {
+		case extPrefix.IsAncestorOf(k):
+			o.Extension = "." + k.BaseNamespace()
+		case cidPrefix.IsAncestorOf(k):
+			o.Cid = k.BaseNamespace()
+		default:
+			continue
+		}
+		out = append(out, o)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if (out[i].Extension == "") != (out[j].Extension == "") {
+			return out[i].Extension != ""
+		}
+		return out[i].Extension+out[i].Cid < out[j].Extension+out[j].Cid
+	})
+	return out, nil
+}
+
+// Lookup returns the override of the file c named name, by CID first, or ""
+// if there is none.
+func (s *Store) Lookup(c cid.Cid, name string) (string, error) {
+	keys := []ds.Key{cidKey(c)}
+	if ext := strings.ToLower(path.Ext(name)); len(ext) > 1 {
+		keys = append(keys, extPrefix.ChildString(ext[1:]))
+	}
+	for _, k := range keys {
+		v, err := s.d.Get(k)
+		switch err {
+		case nil:
+			return string(v), nil
+		case ds.ErrNotFound:
+		default:
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// TypeOf returns the content type of the file c named name: its override if
+// any, else the type of its extension, else the type sniffed from content,
+// which is rewound. s may be nil to skip the overrides. The types sniffed
+// are remembered by CID, and content is left untouched for the CIDs sniffed
+// recently.
+func (s *Store) TypeOf(c cid.Cid, name string, content io.ReadSeeker) (string, error) {
+	if s != nil {
+		ctype, err := s.Lookup(c, name)
+		if err != nil || ctype != "" {
+			return ctype, err
+		}
+	}
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		return ctype, nil
+	}
+	if s != nil {
+		if ctype, ok := s.sniffed.Get(c); ok {
+			return ctype.(string), nil
+		}
+	}
+
+	buf := make([]byte, SniffLen)
+	n, err := io.ReadFull(content, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	ctype := Detect(buf[:n])
+	if s != nil {
+		s.sniffed.Add(c, ctype)
+	}
+	return ctype, nil
+}
+
+// Detect sniffs the content type of data, the first bytes of a file. It
+// recognizes the types of http.DetectContentType and a few more found in
+// IPFS, such as SVG images, WebAssembly modules and JSON documents.
+func Detect(data []byte) string {
+	ctype := http.DetectContentType(data)
+	switch {
+	case bytes.HasPrefix(data, []byte("\x00asm")):
+		return "application/wasm"
+	case strings.HasPrefix(ctype, "text/"):
+		// SVG documents are sniffed as XML, as text or, when they start
+		// with a comment, as HTML
+		if isSVG(data) {
+			return "image/svg+xml"
+		}
+		if strings.HasPrefix(ctype, "text/plain") && isJSON(data) {
+			return "application/json"
+		}
+	}
+	return ctype
+}
+
+// isSVG returns whether data starts an SVG document, possibly after an XML
+// declaration, comments or a doctype.
+func isSVG(data []byte) bool {
+	data = bytes.TrimLeft(data, "\t\n\r ")
+	for bytes.HasPrefix(data, []byte("<?")) || bytes.HasPrefix(data, []byte("<!")) {
+		end := bytes.IndexByte(data, '>')
+		if end < 0 {
+			return false
+		}
+		data = bytes.TrimLeft(data[end+1:], "\t\n\r ")
+	}
+	return bytes.HasPrefix(data, []byte("<svg"))
+}
+
+// isJSON returns whether data looks like the start of a JSON object or array.
+func isJSON(data []byte) bool {
+	data = bytes.TrimLeft(data, "\t\n\r ")
+	if len(data) < 2 {
+		return false
+	}
+	rest := bytes.TrimLeft(data[1:], "\t\n\r ")
+	switch data[0] {
+	case '{':
+		return len(rest) > 0 && (rest[0] == '"' || rest[0] == '}')
+	case '[':
+		return len(rest) > 0 && bytes.IndexByte([]byte("{[\"-0123456789]"), rest[0]) >= 0
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package contenttype
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	u "github.com/ipfs/go-ipfs-util"
+)
+
+func TestDetect(t *testing.T) {
+	for _, test := range []struct {
+		data  string
+		ctype string
+	}{
+		{"<?xml version=\"1.0\"?>\n<svg xmlns=\"http://www.w3.org/2000/svg\"/>", "image/svg+xml"},
+		{"<!-- drawn by hand --><svg/>", "image/svg+xml"},
+		{"<?xml version=\"1.0\"?>\n<feed/>", "text/xml; charset=utf-8"},
+		{"{\"name\": \"ipfs\"}", "application/json"},
+		{"[1, 2, 3]", "application/json"},
+		{"[section]\nkey=value", "text/plain; charset=utf-8"},
+		{"\x00asm\x01\x00\x00\x00", "application/wasm"},
+		{"\x89PNG\r\n\x1a\n", "image/png"},
+		{"hello", "text/plain; charset=utf-8"},
+	} {
+		if ctype := Detect([]byte(test.data)); ctype != test.ctype {
+			t.Errorf("detected %s for %q, expected %s", ctype, test.data, test.ctype)
+		}
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	s := NewStore(ds.NewMapDatastore())
+	c0 := cid.NewCidV0(u.Hash([]byte("file")))
+	c1 := cid.NewCidV1(cid.DagProtobuf, c0.Hash())
+
+	if err := s.Set(".GMI", "text/gemini"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(c0.String(), "application/x-custom"); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range [][2]string{{".", "text/plain"}, {".tar.gz", "application/gzip"}, {"nothing", "text/plain"}, {".md", "text/"}} {
+		if err := s.Set(bad[0], bad[1]); err == nil {
+			t.Errorf("expected an error setting %s to %s", bad[0], bad[1])
+		}
+	}
+
+	// the overrides by CID match both versions, and come first
+	if ctype, _ := s.Lookup(c1, "page.gmi"); ctype != "application/x-custom" {
+		t.Fatalf("expected the override of the CID, got %q", ctype)
+	}
+	other := cid.NewCidV1(cid.Raw, u.Hash([]byte("other")))
+	if ctype, _ := s.Lookup(other, "page.gmi"); ctype != "text/gemini" {
+		t.Fatalf("expected the override of the extension, got %q", ctype)
+	}
+
+	// without an override, the extension then the content decide
+	content := bytes.NewReader([]byte("{\"a\": 1}"))
+	if ctype, err := s.TypeOf(other, "data", content); err != nil || ctype != "application/json" {
+		t.Fatalf("expected application/json, got %q (%v)", ctype, err)
+	}
+	if content.Len() != content.Size() {
+		t.Fatal("expected the content to be rewound")
+	}
+
+	// the type sniffed is remembered, without reading the content again
+	ranged := bytes.NewReader([]byte("plain text"))
+	if _, err := ranged.Seek(6, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if ctype, err := s.TypeOf(other, "data", ranged); err != nil || ctype != "application/json" {
+		t.Fatalf("expected the type sniffed before, got %q (%v)", ctype, err)
+	}
+	if ranged.Len() != 4 {
+		t.Fatal("expected the content to be left untouched")
+	}
+	if ctype, _ := s.TypeOf(other, "index.html", content); ctype != "text/html; charset=utf-8" {
+		t.Fatalf("expected the type of the extension, got %q", ctype)
+	}
+
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Extension != ".gmi" || list[1].Cid != c1.String() {
+		t.Fatalf("unexpected overrides: %+v", list)
+	}
+
+	if found, err := s.Remove(".gmi"); err != nil || !found {
+		t.Fatalf("expected the override to be removed (%v)", err)
+	}
+	if found, _ := s.Remove(".gmi"); found {
+		t.Fatal("expected no override left")
+	}
+}
@@ -11,7 +11,10 @@ package core
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"sync/atomic"
+	"time"
 
 	"github.com/ipfs/go-filestore"
 	"github.com/ipfs/go-ipfs-pinner"
@@ -40,14 +43,52 @@ import (
 	"github.com/libp2p/go-libp2p/p2p/discovery"
 	p2pbhost "github.com/libp2p/go-libp2p/p2p/host/basic"
 
+	"github.com/ipfs/go-ipfs/core/apiauth"
+	"github.com/ipfs/go-ipfs/core/backup"
+	"github.com/ipfs/go-ipfs/core/blockcount"
 	"github.com/ipfs/go-ipfs/core/bootstrap"
+	"github.com/ipfs/go-ipfs/core/bspeer"
+	"github.com/ipfs/go-ipfs/core/bssession"
+	"github.com/ipfs/go-ipfs/core/channel"
+	"github.com/ipfs/go-ipfs/core/chaos"
+	"github.com/ipfs/go-ipfs/core/clockskew"
+	"github.com/ipfs/go-ipfs/core/dhtquota"
+	"github.com/ipfs/go-ipfs/core/dhtstats"
+	"github.com/ipfs/go-ipfs/core/filescp"
+	"github.com/ipfs/go-ipfs/core/geoip"
+	"github.com/ipfs/go-ipfs/core/gwfed"
+	"github.com/ipfs/go-ipfs/core/hashstats"
+	"github.com/ipfs/go-ipfs/core/kv"
+	"github.com/ipfs/go-ipfs/core/landisc"
+	"github.com/ipfs/go-ipfs/core/listenstats"
 	"github.com/ipfs/go-ipfs/core/node"
 	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/core/nodeevents"
+	"github.com/ipfs/go-ipfs/core/nodemetrics"
+	"github.com/ipfs/go-ipfs/core/observed"
+	"github.com/ipfs/go-ipfs/core/partition"
+	"github.com/ipfs/go-ipfs/core/peerscore"
+	"github.com/ipfs/go-ipfs/core/pex"
+	"github.com/ipfs/go-ipfs/core/pinmeta"
+	"github.com/ipfs/go-ipfs/core/pinpush"
+	"github.com/ipfs/go-ipfs/core/pnetinvite"
+	"github.com/ipfs/go-ipfs/core/pnetrouter"
+	"github.com/ipfs/go-ipfs/core/provdiff"
+	"github.com/ipfs/go-ipfs/core/provsel"
+	"github.com/ipfs/go-ipfs/core/qos"
+	"github.com/ipfs/go-ipfs/core/quota"
+	"github.com/ipfs/go-ipfs/core/reload"
+	"github.com/ipfs/go-ipfs/core/replica"
+	"github.com/ipfs/go-ipfs/core/roaming"
+	"github.com/ipfs/go-ipfs/core/slo"
+	"github.com/ipfs/go-ipfs/core/streammeter"
+	"github.com/ipfs/go-ipfs/core/tracing"
 	"github.com/ipfs/go-ipfs/fuse/mount"
 	"github.com/ipfs/go-ipfs/namesys"
 	ipnsrp "github.com/ipfs/go-ipfs/namesys/republisher"
 	"github.com/ipfs/go-ipfs/p2p"
 	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/packstore"
 )
 
 var log = logging.Logger("core")
@@ -62,23 +103,35 @@ type IpfsNode struct {
 
 	// Local node
 	Pinning         pin.Pinner             // the pinning manager
+	PinMeta         *pinmeta.Store         // the names and metadata of the pins
 	Mounts          Mounts                 `optional:"true"` // current mount state, if any.
 	PrivateKey      ic.PrivKey             `optional:"true"` // the local node's private Key
 	PNetFingerprint libp2p.PNetFingerprint `optional:"true"` // fingerprint of private network
+	PNetRouter      *pnetrouter.Router     `optional:"true"` // selects the private network of connections, nil unless several are configured
 
 	// Services
 	Peerstore       pstore.Peerstore          `optional:"true"` // storage for other Peer instances
 	Blockstore      bstore.GCBlockstore       // the block store (lower level)
 	Filestore       *filestore.Filestore      `optional:"true"` // the filestore blockstore
 	BaseBlocks      node.BaseBlocks           // the raw blockstore, no filestore wrapping
+	Packs           *packstore.Packs          `optional:"true"` // the packs of small blocks, nil without an on-disk repo
 	GCLocker        bstore.GCLocker           // the locker used to protect the blockstore during gc
+	BlockCount      *blockcount.Counter       // the number and size of the blocks of the blockstore
+	Metrics         *nodemetrics.Metrics      // the metrics of the swarm dials, of the blockstore and of the GC
+	Events          *nodeevents.Bus           // the events of the swarm, of the pins and of the GC
 	Blocks          bserv.BlockService        // the block service, get/add blocks.
 	DAG             ipld.DAGService           // the merkle dag service, get/add objects.
 	Resolver        *resolver.Resolver        // the path resolution system
 	Reporter        *metrics.BandwidthCounter `optional:"true"`
 	Discovery       discovery.Service         `optional:"true"`
 	FilesRoot       *mfs.Root
+	FilesCopies     *filescp.Tracker // the copies into the files root
 	RecordValidator record.Validator
+	Chaos           *chaos.Injector   `optional:"true"` // fault injector, nil unless enabled in the config
+	Backup          *backup.Store     `optional:"true"` // backup target store, nil unless enabled in the config
+	Quota           *quota.Enforcer   `optional:"true"` // enforces Datastore.StorageMax, nil unless enabled in the config
+	ProvideDiff     *provdiff.Tracker `optional:"true"` // the blocks written since the last reprovide, nil unless enabled in the config
+	Tracer          *tracing.Tracer   `optional:"true"` // exports the spans of the API requests, nil unless enabled in the config
 
 	// Online
 	PeerHost     p2phost.Host        `optional:"true"` // the network host (server+client)
@@ -95,9 +148,40 @@ type IpfsNode struct {
 	DHT      *dht.IpfsDHT               `optional:"true"`
 	P2P      *p2p.P2P                   `optional:"true"`
 
+	Reachability *libp2p.Reachability `optional:"true"` // reachability reported by AutoNAT
+	PNetInvite   *pnetinvite.Server   `optional:"true"` // hands the swarm key to invited peers
+	PeerExchange *pex.Service         `optional:"true"` // exchanges the addresses of the private network members
+	HashStats    *hashstats.Stats     `optional:"true"` // verification counters, with Datastore.HashOnRead
+	DHTStats     *dhtstats.Tracker    `optional:"true"` // routing table health and query latencies
+	DHTRecords   *dhtquota.Store      `optional:"true"` // quota of the records stored for the DHT
+	Channels     *channel.Service     `optional:"true"` // publishes and follows channels, with pubsub
+	StreamMeter  *streammeter.Meter   `optional:"true"` // bytes transferred on each stream
+	ProviderSel  *provsel.Selector    `optional:"true"` // ranks the providers bitswap fetches from
+	BitswapPeers *bspeer.Controls     `optional:"true"` // per-peer bitswap limits and ledger resets
+	BitswapSess  *bssession.Tracker   `optional:"true"` // statistics of the bitswap sessions
+	QoS          *qos.Scheduler       `optional:"true"` // shares the serving bandwidth between the classes of peers, nil unless configured
+	Replica      *replica.Service     `optional:"true"` // replicates a primary, or serves replicas
+	SwarmEvents  *roaming.Tracker     `optional:"true"` // connection events, redials when the local addresses change
+	ObservedAddr *observed.Observer   `optional:"true"` // addresses the peers observe for the node
+	ListenStats  *listenstats.Stats   `optional:"true"` // connections, handshake failures and bytes of each listen address
+	Federation   *gwfed.Federation    `optional:"true"` // fetches from upstream gateways, nil unless configured
+	LANDiscovery *landisc.Service     `optional:"true"` // exchanges the pinned roots with the local network, nil unless enabled
+	KV           *kv.Service          `optional:"true"` // replicated key-value store, nil unless enabled
+	PinPush      *pinpush.Server      `optional:"true"` // accepts the pins pushed by allowed peers, nil unless configured
+	GeoIP        *geoip.DB            `optional:"true"` // locates the addresses of the peers, nil unless configured
+	SLO          *slo.Monitor         `optional:"true"` // objectives of latency and availability of chosen peers, nil unless configured
+	Partition    *partition.Detector  `optional:"true"` // detects the loss of the reference peers, nil unless enabled
+	PeerScores   *peerscore.Tracker   `optional:"true"` // scores of the peers, tagged on the connection manager, nil unless enabled
+	ClockSkew    *clockskew.Estimator `optional:"true"` // offset of the local clock, nil unless enabled
+	APIAuth      *apiauth.Authorizer  `optional:"true"` // tokens of the HTTP API, open while none is configured
+	Reloader     *reload.Reloader     `optional:"true"` // applies the changes of the config to the running node
+
 	Process goprocess.Process
 	ctx     context.Context
 
+	dnsBootstrap *bootstrap.DNSPeers // bootstrap peers advertised over DNS, if configured
+	bootstrapped int32               // set once a bootstrap round was attempted, atomically
+
 	stop func() error
 
 	// Flags
@@ -136,25 +220,73 @@ func (n *IpfsNode) Bootstrap(cfg bootstrap.BootstrapConfig) error {
 	if n.Bootstrapper != nil {
 		n.Bootstrapper.Close() // stop previous bootstrap process.
 	}
+	n.dnsBootstrap.Close()
+	n.dnsBootstrap = nil
 
 	// if the caller did not specify a bootstrap peer function, get the
 	// freshest bootstrap peers from config. this responds to live changes.
 	if cfg.BootstrapPeers == nil {
+		if err := n.startDNSBootstrap(); err != nil {
+			return err
+		}
+
 		cfg.BootstrapPeers = func() []peer.AddrInfo {
 			ps, err := n.loadBootstrapPeers()
 			if err != nil {
 				log.Warning("failed to parse bootstrap peers from config")
-				return nil
 			}
-			return ps
+			return bootstrap.MergePeers(ps, n.dnsBootstrap.Peers())
 		}
 	}
 
 	var err error
 	n.Bootstrapper, err = bootstrap.Bootstrap(n.Identity, n.PeerHost, n.Routing, cfg)
+	if err == nil {
+		// bootstrap.Bootstrap returns once the first round is done
+		atomic.StoreInt32(&n.bootstrapped, 1)
+	}
 	return err
 }
 
+// Bootstrapped returns whether the node attempted to connect to its bootstrap
+// peers, whether it connected to any or not.
+func (n *IpfsNode) Bootstrapped() bool {
+	return atomic.LoadInt32(&n.bootstrapped) == 1
+}
+
+// startDNSBootstrap starts resolving the bootstrap domains configured under
+// Swarm.DNSBootstrap, if any.
+func (n *IpfsNode) startDNSBootstrap() error {
+	var cfg bootstrap.DNSConfig
+	if err := repo.LoadConfigKey(n.Repo, bootstrap.DNSConfigKey, &cfg); err != nil {
+		return err
+	}
+	if len(cfg.Domains) == 0 {
+		return nil
+	}
+
+	interval := bootstrap.DefaultDNSInterval
+	if cfg.Interval != "" {
+		var err error
+		interval, err = time.ParseDuration(cfg.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid %s.Interval: %s", bootstrap.DNSConfigKey, err)
+		}
+	}
+
+	dnsPeers, err := bootstrap.NewDNSPeers(cfg, nil)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(n.Context(), bootstrap.DefaultBootstrapConfig.ConnectionTimeout)
+	defer cancel()
+	dnsPeers.Start(ctx, interval)
+
+	n.dnsBootstrap = dnsPeers
+	return nil
+}
+
 func (n *IpfsNode) loadBootstrapPeers() ([]peer.AddrInfo, error) {
 	cfg, err := n.Repo.Config()
 	if err != nil {
@@ -24,7 +24,11 @@ type BlockStat struct {
 	size int
 }
 
-func (api *BlockAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.BlockPutOption) (coreiface.BlockStat, error) {
+func (api *BlockAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.BlockPutOption) (_ coreiface.BlockStat, err error) {
+	defer classify(&err)
+	ctx, done := traceCall(ctx, "Block.Put")
+	defer done(&err)
+
 	settings, pref, err := caopts.BlockPutOptions(opts...)
 	if err != nil {
 		return nil, err
@@ -64,7 +68,11 @@ func (api *BlockAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.Bloc
 	return &BlockStat{path: path.IpldPath(b.Cid()), size: len(data)}, nil
 }
 
-func (api *BlockAPI) Get(ctx context.Context, p path.Path) (io.Reader, error) {
+func (api *BlockAPI) Get(ctx context.Context, p path.Path) (_ io.Reader, err error) {
+	defer classify(&err)
+	ctx, done := traceCall(ctx, "Block.Get")
+	defer done(&err)
+
 	rp, err := api.core().ResolvePath(ctx, p)
 	if err != nil {
 		return nil, err
@@ -78,7 +86,9 @@ func (api *BlockAPI) Get(ctx context.Context, p path.Path) (io.Reader, error) {
 	return bytes.NewReader(b.RawData()), nil
 }
 
-func (api *BlockAPI) Rm(ctx context.Context, p path.Path, opts ...caopts.BlockRmOption) error {
+func (api *BlockAPI) Rm(ctx context.Context, p path.Path, opts ...caopts.BlockRmOption) (err error) {
+	defer classify(&err)
+
 	rp, err := api.core().ResolvePath(ctx, p)
 	if err != nil {
 		return err
@@ -116,7 +126,11 @@ func (api *BlockAPI) Rm(ctx context.Context, p path.Path, opts ...caopts.BlockRm
 	}
 }
 
-func (api *BlockAPI) Stat(ctx context.Context, p path.Path) (coreiface.BlockStat, error) {
+func (api *BlockAPI) Stat(ctx context.Context, p path.Path) (_ coreiface.BlockStat, err error) {
+	defer classify(&err)
+	ctx, done := traceCall(ctx, "Block.Stat")
+	defer done(&err)
+
 	rp, err := api.core().ResolvePath(ctx, p)
 	if err != nil {
 		return nil, err
@@ -39,7 +39,9 @@ import (
 	record "github.com/libp2p/go-libp2p-record"
 
 	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/dhtstats"
 	"github.com/ipfs/go-ipfs/core/node"
+	"github.com/ipfs/go-ipfs/core/streammeter"
 	"github.com/ipfs/go-ipfs/namesys"
 	"github.com/ipfs/go-ipfs/repo"
 )
@@ -72,6 +74,11 @@ type CoreAPI struct {
 
 	pubSub *pubsub.PubSub
 
+	dhtStats    *dhtstats.Tracker
+	streamMeter *streammeter.Meter
+
+	privateNetwork bool
+
 	checkPublishAllowed func() error
 	checkOnline         func(allowOffline bool) error
 
@@ -144,9 +151,11 @@ func (api *CoreAPI) PubSub() coreiface.PubSubAPI {
 }
 
 // WithOptions returns api with global options applied
-func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, error) {
+func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (_ coreiface.CoreAPI, err error) {
+	defer classify(&err)
+
 	settings := api.parentOpts // make sure to copy
-	_, err := options.ApiOptionsTo(&settings, opts...)
+	_, err = options.ApiOptionsTo(&settings, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -182,6 +191,11 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 
 		pubSub: n.PubSub,
 
+		dhtStats:    n.DHTStats,
+		streamMeter: n.StreamMeter,
+
+		privateNetwork: n.PNetFingerprint != nil,
+
 		nd:         n,
 		parentOpts: settings,
 	}
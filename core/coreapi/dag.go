@@ -47,6 +47,15 @@ func (adder *pinningAdder) AddMany(ctx context.Context, nds []ipld.Node) error {
 	return adder.pinning.Flush(ctx)
 }
 
+// Get returns the node c, with the errors of the CoreAPI.
+func (api *dagAPI) Get(ctx context.Context, c cid.Cid) (_ ipld.Node, err error) {
+	defer classify(&err)
+	ctx, done := traceCall(ctx, "Dag.Get")
+	defer done(&err)
+
+	return api.DAGService.Get(ctx, c)
+}
+
 func (api *dagAPI) Pinning() ipld.NodeAdder {
 	return (*pinningAdder)(api.core)
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 
+	dhtstats "github.com/ipfs/go-ipfs/core/dhtstats"
+
 	blockservice "github.com/ipfs/go-blockservice"
 	cid "github.com/ipfs/go-cid"
 	cidutil "github.com/ipfs/go-cidutil"
@@ -19,8 +21,26 @@ import (
 
 type DhtAPI CoreAPI
 
-func (api *DhtAPI) FindPeer(ctx context.Context, p peer.ID) (peer.AddrInfo, error) {
-	err := api.checkOnline(false)
+// Stats returns the health of the DHT of the node: the size and bucket
+// utilization of the routing table, the peer churn and the query latencies.
+// It is not part of coreiface.DhtAPI:
+//
+//	stats, err := api.Dht().(*coreapi.DhtAPI).Stats()
+func (api *DhtAPI) Stats() (_ dhtstats.Stats, err error) {
+	defer classify(&err)
+
+	if err := api.checkOnline(false); err != nil {
+		return dhtstats.Stats{}, err
+	}
+	return api.dhtStats.Stats()
+}
+
+func (api *DhtAPI) FindPeer(ctx context.Context, p peer.ID) (_ peer.AddrInfo, err error) {
+	defer classify(&err)
+	ctx, done := traceCall(ctx, "Dht.FindPeer")
+	defer done(&err)
+
+	err = api.checkOnline(false)
 	if err != nil {
 		return peer.AddrInfo{}, err
 	}
@@ -58,7 +78,11 @@ func (api *DhtAPI) FindProviders(ctx context.Context, p path.Path, opts ...caopt
 	return pchan, nil
 }
 
-func (api *DhtAPI) Provide(ctx context.Context, path path.Path, opts ...caopts.DhtProvideOption) error {
+func (api *DhtAPI) Provide(ctx context.Context, path path.Path, opts ...caopts.DhtProvideOption) (err error) {
+	defer classify(&err)
+	ctx, done := traceCall(ctx, "Dht.Provide")
+	defer done(&err)
+
 	settings, err := caopts.DhtProvideOptions(opts...)
 	if err != nil {
 		return err
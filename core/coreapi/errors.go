@@ -0,0 +1,144 @@
+package coreapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	bserv "github.com/ipfs/go-blockservice"
+	ds "github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+
+	"github.com/ipfs/go-ipfs/keystore"
+)
+
+// The kinds of the errors returned by the CoreAPI. The errors of the methods
+// of the CoreAPI are either one of them or an *Error of that kind, which
+// keeps the message of the underlying error, so that embedders can branch on
+// the kinds with errors.Is:
+//
+//	if errors.Is(err, coreapi.ErrNotFound) {
+//	  ...
+//	}
+var (
+	// ErrOffline is returned by the methods needing a network the node
+	// doesn't have.
+	ErrOffline = coreiface.ErrOffline
+
+	// ErrNotFound is returned for the blocks, nodes, paths and keys that
+	// don't exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrNotPinned is returned when removing or updating a pin that doesn't
+	// exist.
+	ErrNotPinned = errors.New("not pinned")
+
+	// ErrPNetKeyMismatch is returned for the connections to the peers that
+	// aren't in the private network of the node.
+	ErrPNetKeyMismatch = errors.New("private network key mismatch")
+
+	// ErrTimeout is returned when the context of the call expired.
+	ErrTimeout = errors.New("timed out")
+)
+
+// Error is an error of a known kind.
+type Error struct {
+	// Kind is the kind of the error, one of the errors of the package.
+	Kind error
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error is of the kind target.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// kinds maps the errors of the dependencies to their kind.
+var kinds = []struct {
+	err  error
+	kind error
+}{
+	{ipld.ErrNotFound, ErrNotFound},
+	{blockstore.ErrNotFound, ErrNotFound},
+	{bserv.ErrNotFound, ErrNotFound},
+	{ds.ErrNotFound, ErrNotFound},
+	{keystore.ErrNoSuchKey, ErrNotFound},
+	{pin.ErrNotPinned, ErrNotPinned},
+	{context.DeadlineExceeded, ErrTimeout},
+}
+
+// messages maps the messages of the errors the dependencies don't export to
+// their kind.
+var messages = []struct {
+	msg  string
+	kind error
+}{
+	// merkledag and the resolver format the not found errors
+	{ipld.ErrNotFound.Error(), ErrNotFound},
+	{"no link named", ErrNotFound},
+	// Pinner.Update
+	{"was not recursively pinned", ErrNotPinned},
+}
+
+// kindOf returns the kind of err, or nil if it isn't known.
+func kindOf(err error) error {
+	for _, k := range kinds {
+		if errors.Is(err, k.err) {
+			return k.kind
+		}
+	}
+	msg := err.Error()
+	for _, m := range messages {
+		if strings.Contains(msg, m.msg) {
+			return m.kind
+		}
+	}
+	return nil
+}
+
+// classify turns the error *err into an *Error, if its kind is known. It is
+// deferred by the methods of the CoreAPI.
+func classify(err *error) {
+	if *err == nil || *err == ErrOffline {
+		return
+	}
+	if _, ok := (*err).(*Error); ok {
+		return
+	}
+	if kind := kindOf(*err); kind != nil {
+		*err = &Error{Kind: kind, Err: *err}
+	}
+}
+
+// notFound returns an error of kind ErrNotFound.
+func notFound(format string, a ...interface{}) error {
+	return &Error{Kind: ErrNotFound, Err: fmt.Errorf(format, a...)}
+}
+
+// pnetError returns the error of a connection to a peer, failed while
+// negotiating its security, which in a private network happens to the peers
+// using another key.
+func pnetError(err error) error {
+	if !strings.Contains(err.Error(), "failed to negotiate security protocol") {
+		return err
+	}
+	return &Error{
+		Kind: ErrPNetKeyMismatch,
+		Err:  fmt.Errorf("%s (the peer may not be in the private network of this node)", err),
+	}
+}
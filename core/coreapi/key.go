@@ -39,7 +39,9 @@ func (k *key) ID() peer.ID {
 
 // Generate generates new key, stores it in the keystore under the specified
 // name and returns a base58 encoded multihash of its public key.
-func (api *KeyAPI) Generate(ctx context.Context, name string, opts ...caopts.KeyGenerateOption) (coreiface.Key, error) {
+func (api *KeyAPI) Generate(ctx context.Context, name string, opts ...caopts.KeyGenerateOption) (_ coreiface.Key, err error) {
+	defer classify(&err)
+
 	options, err := caopts.KeyGenerateOptions(opts...)
 	if err != nil {
 		return nil, err
@@ -96,7 +98,9 @@ func (api *KeyAPI) Generate(ctx context.Context, name string, opts ...caopts.Key
 }
 
 // List returns a list keys stored in keystore.
-func (api *KeyAPI) List(ctx context.Context) ([]coreiface.Key, error) {
+func (api *KeyAPI) List(ctx context.Context) (_ []coreiface.Key, err error) {
+	defer classify(&err)
+
 	keys, err := api.repo.Keystore().List()
 	if err != nil {
 		return nil, err
@@ -127,7 +131,9 @@ func (api *KeyAPI) List(ctx context.Context) ([]coreiface.Key, error) {
 
 // Rename renames `oldName` to `newName`. Returns the key and whether another
 // key was overwritten, or an error.
-func (api *KeyAPI) Rename(ctx context.Context, oldName string, newName string, opts ...caopts.KeyRenameOption) (coreiface.Key, bool, error) {
+func (api *KeyAPI) Rename(ctx context.Context, oldName string, newName string, opts ...caopts.KeyRenameOption) (_ coreiface.Key, _ bool, err error) {
+	defer classify(&err)
+
 	options, err := caopts.KeyRenameOptions(opts...)
 	if err != nil {
 		return nil, false, err
@@ -145,7 +151,7 @@ func (api *KeyAPI) Rename(ctx context.Context, oldName string, newName string, o
 
 	oldKey, err := ks.Get(oldName)
 	if err != nil {
-		return nil, false, fmt.Errorf("no key named %s was found", oldName)
+		return nil, false, notFound("no key named %s was found", oldName)
 	}
 
 	pubKey := oldKey.GetPublic()
@@ -186,7 +192,9 @@ func (api *KeyAPI) Rename(ctx context.Context, oldName string, newName string, o
 }
 
 // Remove removes keys from keystore. Returns ipns path of the removed key.
-func (api *KeyAPI) Remove(ctx context.Context, name string) (coreiface.Key, error) {
+func (api *KeyAPI) Remove(ctx context.Context, name string) (_ coreiface.Key, err error) {
+	defer classify(&err)
+
 	ks := api.repo.Keystore()
 
 	if name == "self" {
@@ -195,7 +203,7 @@ func (api *KeyAPI) Remove(ctx context.Context, name string) (coreiface.Key, erro
 
 	removed, err := ks.Get(name)
 	if err != nil {
-		return nil, fmt.Errorf("no key named %s was found", name)
+		return nil, notFound("no key named %s was found", name)
 	}
 
 	pubKey := removed.GetPublic()
@@ -213,7 +221,9 @@ func (api *KeyAPI) Remove(ctx context.Context, name string) (coreiface.Key, erro
 	return &key{"", pid}, nil
 }
 
-func (api *KeyAPI) Self(ctx context.Context) (coreiface.Key, error) {
+func (api *KeyAPI) Self(ctx context.Context) (_ coreiface.Key, err error) {
+	defer classify(&err)
+
 	if api.identity == "" {
 		return nil, errors.New("identity not loaded")
 	}
@@ -2,10 +2,10 @@ package coreapi
 
 import (
 	"context"
-	"fmt"
 	"strings"
 	"time"
 
+	"github.com/ipfs/go-ipfs/core/keystats"
 	"github.com/ipfs/go-ipfs/keystore"
 	"github.com/ipfs/go-ipfs/namesys"
 
@@ -35,7 +35,11 @@ func (e *ipnsEntry) Value() path.Path {
 }
 
 // Publish announces new IPNS name and returns the new IPNS entry.
-func (api *NameAPI) Publish(ctx context.Context, p path.Path, opts ...caopts.NamePublishOption) (coreiface.IpnsEntry, error) {
+func (api *NameAPI) Publish(ctx context.Context, p path.Path, opts ...caopts.NamePublishOption) (_ coreiface.IpnsEntry, err error) {
+	defer classify(&err)
+	ctx, done := traceCall(ctx, "Name.Publish")
+	defer done(&err)
+
 	if err := api.checkPublishAllowed(); err != nil {
 		return nil, err
 	}
@@ -75,6 +79,10 @@ func (api *NameAPI) Publish(ctx context.Context, p path.Path, opts ...caopts.Nam
 		return nil, err
 	}
 
+	if err := keystats.RecordUse(api.repo.Datastore(), pid); err != nil {
+		log.Warningf("recording the use of the key %s: %s", options.Key, err)
+	}
+
 	return &ipnsEntry{
 		name:  pid.Pretty(),
 		value: p,
@@ -119,7 +127,11 @@ func (api *NameAPI) Search(ctx context.Context, name string, opts ...caopts.Name
 
 // Resolve attempts to resolve the newest version of the specified name and
 // returns its path.
-func (api *NameAPI) Resolve(ctx context.Context, name string, opts ...caopts.NameResolveOption) (path.Path, error) {
+func (api *NameAPI) Resolve(ctx context.Context, name string, opts ...caopts.NameResolveOption) (_ path.Path, err error) {
+	defer classify(&err)
+	ctx, done := traceCall(ctx, "Name.Resolve")
+	defer done(&err)
+
 	results, err := api.Search(ctx, name, opts...)
 	if err != nil {
 		return nil, err
@@ -175,5 +187,5 @@ func keylookup(self ci.PrivKey, kstore keystore.Keystore, k string) (ci.PrivKey,
 		}
 	}
 
-	return nil, fmt.Errorf("no key by the given name or PeerID was found")
+	return nil, notFound("no key by the given name or PeerID was found")
 }
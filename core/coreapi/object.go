@@ -36,7 +36,9 @@ type Node struct {
 	Data  string
 }
 
-func (api *ObjectAPI) New(ctx context.Context, opts ...caopts.ObjectNewOption) (ipld.Node, error) {
+func (api *ObjectAPI) New(ctx context.Context, opts ...caopts.ObjectNewOption) (_ ipld.Node, err error) {
+	defer classify(&err)
+
 	options, err := caopts.ObjectNewOptions(opts...)
 	if err != nil {
 		return nil, err
@@ -57,7 +59,9 @@ func (api *ObjectAPI) New(ctx context.Context, opts ...caopts.ObjectNewOption) (
 	return n, nil
 }
 
-func (api *ObjectAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.ObjectPutOption) (ipath.Resolved, error) {
+func (api *ObjectAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.ObjectPutOption) (_ ipath.Resolved, err error) {
+	defer classify(&err)
+
 	options, err := caopts.ObjectPutOptions(opts...)
 	if err != nil {
 		return nil, err
@@ -127,11 +131,15 @@ func (api *ObjectAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.Obj
 	return ipath.IpfsPath(dagnode.Cid()), nil
 }
 
-func (api *ObjectAPI) Get(ctx context.Context, path ipath.Path) (ipld.Node, error) {
+func (api *ObjectAPI) Get(ctx context.Context, path ipath.Path) (_ ipld.Node, err error) {
+	defer classify(&err)
+
 	return api.core().ResolveNode(ctx, path)
 }
 
-func (api *ObjectAPI) Data(ctx context.Context, path ipath.Path) (io.Reader, error) {
+func (api *ObjectAPI) Data(ctx context.Context, path ipath.Path) (_ io.Reader, err error) {
+	defer classify(&err)
+
 	nd, err := api.core().ResolveNode(ctx, path)
 	if err != nil {
 		return nil, err
@@ -145,7 +153,9 @@ func (api *ObjectAPI) Data(ctx context.Context, path ipath.Path) (io.Reader, err
 	return bytes.NewReader(pbnd.Data()), nil
 }
 
-func (api *ObjectAPI) Links(ctx context.Context, path ipath.Path) ([]*ipld.Link, error) {
+func (api *ObjectAPI) Links(ctx context.Context, path ipath.Path) (_ []*ipld.Link, err error) {
+	defer classify(&err)
+
 	nd, err := api.core().ResolveNode(ctx, path)
 	if err != nil {
 		return nil, err
@@ -160,7 +170,9 @@ func (api *ObjectAPI) Links(ctx context.Context, path ipath.Path) ([]*ipld.Link,
 	return out, nil
 }
 
-func (api *ObjectAPI) Stat(ctx context.Context, path ipath.Path) (*coreiface.ObjectStat, error) {
+func (api *ObjectAPI) Stat(ctx context.Context, path ipath.Path) (_ *coreiface.ObjectStat, err error) {
+	defer classify(&err)
+
 	nd, err := api.core().ResolveNode(ctx, path)
 	if err != nil {
 		return nil, err
@@ -183,7 +195,9 @@ func (api *ObjectAPI) Stat(ctx context.Context, path ipath.Path) (*coreiface.Obj
 	return out, nil
 }
 
-func (api *ObjectAPI) AddLink(ctx context.Context, base ipath.Path, name string, child ipath.Path, opts ...caopts.ObjectAddLinkOption) (ipath.Resolved, error) {
+func (api *ObjectAPI) AddLink(ctx context.Context, base ipath.Path, name string, child ipath.Path, opts ...caopts.ObjectAddLinkOption) (_ ipath.Resolved, err error) {
+	defer classify(&err)
+
 	options, err := caopts.ObjectAddLinkOptions(opts...)
 	if err != nil {
 		return nil, err
@@ -224,7 +238,9 @@ func (api *ObjectAPI) AddLink(ctx context.Context, base ipath.Path, name string,
 	return ipath.IpfsPath(nnode.Cid()), nil
 }
 
-func (api *ObjectAPI) RmLink(ctx context.Context, base ipath.Path, link string) (ipath.Resolved, error) {
+func (api *ObjectAPI) RmLink(ctx context.Context, base ipath.Path, link string) (_ ipath.Resolved, err error) {
+	defer classify(&err)
+
 	baseNd, err := api.core().ResolveNode(ctx, base)
 	if err != nil {
 		return nil, err
@@ -250,11 +266,15 @@ func (api *ObjectAPI) RmLink(ctx context.Context, base ipath.Path, link string)
 	return ipath.IpfsPath(nnode.Cid()), nil
 }
 
-func (api *ObjectAPI) AppendData(ctx context.Context, path ipath.Path, r io.Reader) (ipath.Resolved, error) {
+func (api *ObjectAPI) AppendData(ctx context.Context, path ipath.Path, r io.Reader) (_ ipath.Resolved, err error) {
+	defer classify(&err)
+
 	return api.patchData(ctx, path, r, true)
 }
 
-func (api *ObjectAPI) SetData(ctx context.Context, path ipath.Path, r io.Reader) (ipath.Resolved, error) {
+func (api *ObjectAPI) SetData(ctx context.Context, path ipath.Path, r io.Reader) (_ ipath.Resolved, err error) {
+	defer classify(&err)
+
 	return api.patchData(ctx, path, r, false)
 }
 
@@ -287,7 +307,9 @@ func (api *ObjectAPI) patchData(ctx context.Context, path ipath.Path, r io.Reade
 	return ipath.IpfsPath(pbnd.Cid()), nil
 }
 
-func (api *ObjectAPI) Diff(ctx context.Context, before ipath.Path, after ipath.Path) ([]coreiface.ObjectChange, error) {
+func (api *ObjectAPI) Diff(ctx context.Context, before ipath.Path, after ipath.Path) (_ []coreiface.ObjectChange, err error) {
+	defer classify(&err)
+
 	beforeNd, err := api.core().ResolveNode(ctx, before)
 	if err != nil {
 		return nil, err
@@ -18,7 +18,11 @@ import (
 
 // ResolveNode resolves the path `p` using Unixfs resolver, gets and returns the
 // resolved Node.
-func (api *CoreAPI) ResolveNode(ctx context.Context, p path.Path) (ipld.Node, error) {
+func (api *CoreAPI) ResolveNode(ctx context.Context, p path.Path) (_ ipld.Node, err error) {
+	defer classify(&err)
+	ctx, done := traceCall(ctx, "ResolveNode")
+	defer done(&err)
+
 	rp, err := api.ResolvePath(ctx, p)
 	if err != nil {
 		return nil, err
@@ -33,7 +37,11 @@ func (api *CoreAPI) ResolveNode(ctx context.Context, p path.Path) (ipld.Node, er
 
 // ResolvePath resolves the path `p` using Unixfs resolver, returns the
 // resolved path.
-func (api *CoreAPI) ResolvePath(ctx context.Context, p path.Path) (path.Resolved, error) {
+func (api *CoreAPI) ResolvePath(ctx context.Context, p path.Path) (_ path.Resolved, err error) {
+	defer classify(&err)
+	ctx, done := traceCall(ctx, "ResolvePath")
+	defer done(&err)
+
 	if _, ok := p.(path.Resolved); ok {
 		return p.(path.Resolved), nil
 	}
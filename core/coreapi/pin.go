@@ -16,10 +16,14 @@ import (
 
 type PinAPI CoreAPI
 
-func (api *PinAPI) Add(ctx context.Context, p path.Path, opts ...caopts.PinAddOption) error {
+func (api *PinAPI) Add(ctx context.Context, p path.Path, opts ...caopts.PinAddOption) (err error) {
+	defer classify(&err)
+	ctx, done := traceCall(ctx, "Pin.Add")
+	defer done(&err)
+
 	dagNode, err := api.core().ResolveNode(ctx, p)
 	if err != nil {
-		return fmt.Errorf("pin: %s", err)
+		return fmt.Errorf("pin: %w", err)
 	}
 
 	settings, err := caopts.PinAddOptions(opts...)
@@ -31,7 +35,7 @@ func (api *PinAPI) Add(ctx context.Context, p path.Path, opts ...caopts.PinAddOp
 
 	err = api.pinning.Pin(ctx, dagNode, settings.Recursive)
 	if err != nil {
-		return fmt.Errorf("pin: %s", err)
+		return fmt.Errorf("pin: %w", err)
 	}
 
 	if err := api.provider.Provide(dagNode.Cid()); err != nil {
@@ -41,7 +45,9 @@ func (api *PinAPI) Add(ctx context.Context, p path.Path, opts ...caopts.PinAddOp
 	return api.pinning.Flush(ctx)
 }
 
-func (api *PinAPI) Ls(ctx context.Context, opts ...caopts.PinLsOption) ([]coreiface.Pin, error) {
+func (api *PinAPI) Ls(ctx context.Context, opts ...caopts.PinLsOption) (_ []coreiface.Pin, err error) {
+	defer classify(&err)
+
 	settings, err := caopts.PinLsOptions(opts...)
 	if err != nil {
 		return nil, err
@@ -57,7 +63,9 @@ func (api *PinAPI) Ls(ctx context.Context, opts ...caopts.PinLsOption) ([]coreif
 }
 
 // Rm pin rm api
-func (api *PinAPI) Rm(ctx context.Context, p path.Path, opts ...caopts.PinRmOption) error {
+func (api *PinAPI) Rm(ctx context.Context, p path.Path, opts ...caopts.PinRmOption) (err error) {
+	defer classify(&err)
+
 	rp, err := api.core().ResolvePath(ctx, p)
 	if err != nil {
 		return err
@@ -79,7 +87,9 @@ func (api *PinAPI) Rm(ctx context.Context, p path.Path, opts ...caopts.PinRmOpti
 	return api.pinning.Flush(ctx)
 }
 
-func (api *PinAPI) Update(ctx context.Context, from path.Path, to path.Path, opts ...caopts.PinUpdateOption) error {
+func (api *PinAPI) Update(ctx context.Context, from path.Path, to path.Path, opts ...caopts.PinUpdateOption) (err error) {
+	defer classify(&err)
+
 	settings, err := caopts.PinUpdateOptions(opts...)
 	if err != nil {
 		return err
@@ -8,6 +8,8 @@ import (
 type ProviderAPI CoreAPI
 
 // Provide the given cid using the current provider
-func (api *ProviderAPI) Provide(cid cid.Cid) error {
+func (api *ProviderAPI) Provide(cid cid.Cid) (err error) {
+	defer classify(&err)
+
 	return api.provider.Provide(cid)
 }
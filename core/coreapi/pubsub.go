@@ -27,8 +27,10 @@ type pubSubMessage struct {
 	msg *pubsub.Message
 }
 
-func (api *PubSubAPI) Ls(ctx context.Context) ([]string, error) {
-	_, err := api.checkNode()
+func (api *PubSubAPI) Ls(ctx context.Context) (_ []string, err error) {
+	defer classify(&err)
+
+	_, err = api.checkNode()
 	if err != nil {
 		return nil, err
 	}
@@ -36,8 +38,10 @@ func (api *PubSubAPI) Ls(ctx context.Context) ([]string, error) {
 	return api.pubSub.GetTopics(), nil
 }
 
-func (api *PubSubAPI) Peers(ctx context.Context, opts ...caopts.PubSubPeersOption) ([]peer.ID, error) {
-	_, err := api.checkNode()
+func (api *PubSubAPI) Peers(ctx context.Context, opts ...caopts.PubSubPeersOption) (_ []peer.ID, err error) {
+	defer classify(&err)
+
+	_, err = api.checkNode()
 	if err != nil {
 		return nil, err
 	}
@@ -50,8 +54,10 @@ func (api *PubSubAPI) Peers(ctx context.Context, opts ...caopts.PubSubPeersOptio
 	return api.pubSub.ListPeers(settings.Topic), nil
 }
 
-func (api *PubSubAPI) Publish(ctx context.Context, topic string, data []byte) error {
-	_, err := api.checkNode()
+func (api *PubSubAPI) Publish(ctx context.Context, topic string, data []byte) (err error) {
+	defer classify(&err)
+
+	_, err = api.checkNode()
 	if err != nil {
 		return err
 	}
@@ -60,7 +66,9 @@ func (api *PubSubAPI) Publish(ctx context.Context, topic string, data []byte) er
 	return api.pubSub.Publish(topic, data)
 }
 
-func (api *PubSubAPI) Subscribe(ctx context.Context, topic string, opts ...caopts.PubSubSubscribeOption) (coreiface.PubSubSubscription, error) {
+func (api *PubSubAPI) Subscribe(ctx context.Context, topic string, opts ...caopts.PubSubSubscribeOption) (_ coreiface.PubSubSubscription, err error) {
+	defer classify(&err)
+
 	options, err := caopts.PubSubSubscribeOptions(opts...)
 	if err != nil {
 		return nil, err
@@ -5,6 +5,9 @@ import (
 	"sort"
 	"time"
 
+	"github.com/ipfs/go-ipfs/core/addrbook"
+	"github.com/ipfs/go-ipfs/core/streammeter"
+
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	inet "github.com/libp2p/go-libp2p-core/network"
 	peer "github.com/libp2p/go-libp2p-core/peer"
@@ -18,6 +21,7 @@ type SwarmAPI CoreAPI
 
 type connInfo struct {
 	peerstore pstore.Peerstore
+	meter     *streammeter.Meter
 	conn      inet.Conn
 	dir       inet.Direction
 
@@ -29,7 +33,9 @@ type connInfo struct {
 const connectionManagerTag = "user-connect"
 const connectionManagerWeight = 100
 
-func (api *SwarmAPI) Connect(ctx context.Context, pi peer.AddrInfo) error {
+func (api *SwarmAPI) Connect(ctx context.Context, pi peer.AddrInfo) (err error) {
+	defer classify(&err)
+
 	if api.peerHost == nil {
 		return coreiface.ErrOffline
 	}
@@ -38,7 +44,14 @@ func (api *SwarmAPI) Connect(ctx context.Context, pi peer.AddrInfo) error {
 		swrm.Backoff().Clear(pi.ID)
 	}
 
+	if r, ok := api.peerHost.Peerstore().(*addrbook.Recorder); ok {
+		r.Mark(pi.ID, pi.Addrs, addrbook.SourceManual)
+	}
+
 	if err := api.peerHost.Connect(ctx, pi); err != nil {
+		if api.privateNetwork {
+			return pnetError(err)
+		}
 		return err
 	}
 
@@ -46,7 +59,9 @@ func (api *SwarmAPI) Connect(ctx context.Context, pi peer.AddrInfo) error {
 	return nil
 }
 
-func (api *SwarmAPI) Disconnect(ctx context.Context, addr ma.Multiaddr) error {
+func (api *SwarmAPI) Disconnect(ctx context.Context, addr ma.Multiaddr) (err error) {
+	defer classify(&err)
+
 	if api.peerHost == nil {
 		return coreiface.ErrOffline
 	}
@@ -76,7 +91,9 @@ func (api *SwarmAPI) Disconnect(ctx context.Context, addr ma.Multiaddr) error {
 	return coreiface.ErrConnNotFound
 }
 
-func (api *SwarmAPI) KnownAddrs(context.Context) (map[peer.ID][]ma.Multiaddr, error) {
+func (api *SwarmAPI) KnownAddrs(context.Context) (_ map[peer.ID][]ma.Multiaddr, err error) {
+	defer classify(&err)
+
 	if api.peerHost == nil {
 		return nil, coreiface.ErrOffline
 	}
@@ -93,7 +110,36 @@ func (api *SwarmAPI) KnownAddrs(context.Context) (map[peer.ID][]ma.Multiaddr, er
 	return addrs, nil
 }
 
-func (api *SwarmAPI) LocalAddrs(context.Context) ([]ma.Multiaddr, error) {
+// PeerAddrs returns the known addresses of p, with where they were learned
+// from and when they expire:
+//
+//	addrs, err := api.Swarm().(*coreapi.SwarmAPI).PeerAddrs(ctx, p)
+func (api *SwarmAPI) PeerAddrs(ctx context.Context, p peer.ID) (_ []addrbook.Entry, err error) {
+	defer classify(&err)
+
+	if api.peerHost == nil {
+		return nil, coreiface.ErrOffline
+	}
+
+	var entries []addrbook.Entry
+	ps := api.peerHost.Peerstore()
+	if r, ok := ps.(*addrbook.Recorder); ok {
+		entries = r.Entries(p)
+	} else {
+		for _, a := range ps.Addrs(p) {
+			entries = append(entries, addrbook.Entry{Addr: a, Source: addrbook.SourceUnknown})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Addr.String() < entries[j].Addr.String()
+	})
+	return entries, nil
+}
+
+func (api *SwarmAPI) LocalAddrs(context.Context) (_ []ma.Multiaddr, err error) {
+	defer classify(&err)
+
 	if api.peerHost == nil {
 		return nil, coreiface.ErrOffline
 	}
@@ -101,7 +147,9 @@ func (api *SwarmAPI) LocalAddrs(context.Context) ([]ma.Multiaddr, error) {
 	return api.peerHost.Addrs(), nil
 }
 
-func (api *SwarmAPI) ListenAddrs(context.Context) ([]ma.Multiaddr, error) {
+func (api *SwarmAPI) ListenAddrs(context.Context) (_ []ma.Multiaddr, err error) {
+	defer classify(&err)
+
 	if api.peerHost == nil {
 		return nil, coreiface.ErrOffline
 	}
@@ -109,12 +157,15 @@ func (api *SwarmAPI) ListenAddrs(context.Context) ([]ma.Multiaddr, error) {
 	return api.peerHost.Network().InterfaceListenAddresses()
 }
 
-func (api *SwarmAPI) Peers(context.Context) ([]coreiface.ConnectionInfo, error) {
+func (api *SwarmAPI) Peers(context.Context) (_ []coreiface.ConnectionInfo, err error) {
+	defer classify(&err)
+
 	if api.peerHost == nil {
 		return nil, coreiface.ErrOffline
 	}
 
 	conns := api.peerHost.Network().Conns()
+	api.streamMeter.Prune(conns)
 
 	var out []coreiface.ConnectionInfo
 	for _, c := range conns {
@@ -123,6 +174,7 @@ func (api *SwarmAPI) Peers(context.Context) ([]coreiface.ConnectionInfo, error)
 
 		ci := &connInfo{
 			peerstore: api.peerstore,
+			meter:     api.streamMeter,
 			conn:      c,
 			dir:       c.Stat().Direction,
 
@@ -170,3 +222,37 @@ func (ci *connInfo) Streams() ([]protocol.ID, error) {
 
 	return out, nil
 }
+
+// ConnectionStreams is implemented by the connections returned by
+// SwarmAPI.Peers. It is not part of coreiface.ConnectionInfo:
+//
+//	infos := c.(coreapi.ConnectionStreams).StreamInfos()
+type ConnectionStreams interface {
+	StreamInfos() []streammeter.Info
+}
+
+// StreamInfos returns the open streams of the connection, with their
+// direction, open time and bytes transferred. The streams which aren't
+// metered only have their protocol and direction set.
+func (ci *connInfo) StreamInfos() []streammeter.Info {
+	out := ci.meter.Streams(ci.conn)
+
+	type key struct {
+		proto protocol.ID
+		dir   inet.Direction
+	}
+	metered := make(map[key]int, len(out))
+	for _, s := range out {
+		metered[key{s.Protocol, s.Direction}]++
+	}
+
+	for _, s := range ci.conn.GetStreams() {
+		k := key{s.Protocol(), s.Stat().Direction}
+		if metered[k] > 0 {
+			metered[k]--
+			continue
+		}
+		out = append(out, streammeter.Info{Protocol: k.proto, Direction: k.dir})
+	}
+	return out
+}
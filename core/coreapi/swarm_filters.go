@@ -0,0 +1,283 @@
+package coreapi
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	swarm "github.com/libp2p/go-libp2p-swarm"
+	mafilter "github.com/libp2p/go-maddr-filter"
+	mamask "github.com/whyrusleeping/multiaddr-filter"
+)
+
+// SwarmFilters manages the address filters of the swarm. Filters are given
+// in the multiaddr-filter format, e.g. /ip4/192.168.0.0/ipcidr/16.
+type SwarmFilters interface {
+	// List returns the filters applied to the swarm.
+	List(ctx context.Context) ([]SwarmFilter, error)
+
+	// Add applies the filters to the swarm, and returns the filters added.
+	Add(ctx context.Context, filters []string, opts ...SwarmFiltersOption) ([]string, error)
+
+	// Remove lifts the filters from the swarm, and returns the filters
+	// removed.
+	Remove(ctx context.Context, filters []string, opts ...SwarmFiltersOption) ([]string, error)
+
+	// RemoveAll lifts every filter from the swarm, and returns the filters
+	// removed.
+	RemoveAll(ctx context.Context, opts ...SwarmFiltersOption) ([]string, error)
+}
+
+// SwarmWithFilters is implemented by the SwarmAPI of coreapi. It is not part
+// of coreiface.SwarmAPI:
+//
+//	filters, err := api.Swarm().(coreapi.SwarmWithFilters).Filters().List(ctx)
+type SwarmWithFilters interface {
+	Filters() SwarmFilters
+}
+
+// SwarmFiltersAPI implements SwarmFilters.
+type SwarmFiltersAPI CoreAPI
+
+var (
+	_ SwarmFilters     = (*SwarmFiltersAPI)(nil)
+	_ SwarmWithFilters = (*SwarmAPI)(nil)
+)
+
+// SwarmFilter is an address filter, and whether it is saved under
+// Swarm.AddrFilters in the config.
+type SwarmFilter struct {
+	Filter    string
+	Persisted bool
+}
+
+// SwarmFiltersOption configures a change of the swarm filters.
+type SwarmFiltersOption func(*swarmFiltersSettings)
+
+type swarmFiltersSettings struct {
+	persist bool
+}
+
+// SwarmFiltersPersist sets whether a change is also written to the config, so
+// it survives a restart. Default: true.
+func SwarmFiltersPersist(persist bool) SwarmFiltersOption {
+	return func(s *swarmFiltersSettings) {
+		s.persist = persist
+	}
+}
+
+func swarmFiltersOptions(opts ...SwarmFiltersOption) *swarmFiltersSettings {
+	s := &swarmFiltersSettings{persist: true}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Filters returns the API managing the address filters of the swarm.
+func (api *SwarmAPI) Filters() SwarmFilters {
+	return (*SwarmFiltersAPI)(api)
+}
+
+func (api *SwarmFiltersAPI) swarm() (*swarm.Swarm, error) {
+	if api.peerHost == nil {
+		return nil, coreiface.ErrOffline
+	}
+	swrm, ok := api.peerHost.Network().(*swarm.Swarm)
+	if !ok {
+		return nil, errors.New("failed to cast network to swarm network")
+	}
+	return swrm, nil
+}
+
+// List returns the filters applied to the swarm.
+func (api *SwarmFiltersAPI) List(ctx context.Context) (_ []SwarmFilter, err error) {
+	defer classify(&err)
+
+	swrm, err := api.swarm()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := api.repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	persisted := make(map[string]bool, len(cfg.Swarm.AddrFilters))
+	for _, f := range cfg.Swarm.AddrFilters {
+		persisted[f] = true
+	}
+
+	fs := swrm.Filters.FiltersForAction(mafilter.ActionDeny)
+	out := make([]SwarmFilter, 0, len(fs))
+	for _, f := range fs {
+		s, err := mamask.ConvertIPNet(&f)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, SwarmFilter{Filter: s, Persisted: persisted[s]})
+	}
+	return out, nil
+}
+
+// Add applies the filters to the swarm, and saves them in the config unless
+// SwarmFiltersPersist(false) is given. It returns the filters added.
+func (api *SwarmFiltersAPI) Add(ctx context.Context, filters []string, opts ...SwarmFiltersOption) (_ []string, err error) {
+	defer classify(&err)
+
+	settings := swarmFiltersOptions(opts...)
+
+	swrm, err := api.swarm()
+	if err != nil {
+		return nil, err
+	}
+	if len(filters) == 0 {
+		return nil, errors.New("no filters to add")
+	}
+
+	masks, err := parseFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+	for _, mask := range masks {
+		swrm.Filters.AddFilter(*mask, mafilter.ActionDeny)
+	}
+
+	if !settings.persist {
+		return filters, nil
+	}
+
+	cfg, err := api.repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	// re-add cfg swarm filters to rm dupes
+	added := make([]string, 0, len(filters))
+	seen := make(map[string]bool, len(filters)+len(cfg.Swarm.AddrFilters))
+	newFilters := make([]string, 0, len(filters)+len(cfg.Swarm.AddrFilters))
+	for _, f := range filters {
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		newFilters = append(newFilters, f)
+		added = append(added, f)
+	}
+	for _, f := range cfg.Swarm.AddrFilters {
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		newFilters = append(newFilters, f)
+	}
+	cfg.Swarm.AddrFilters = newFilters
+
+	if err := api.repo.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// Remove lifts the filters from the swarm, and removes them from the config
+// unless SwarmFiltersPersist(false) is given. It returns the filters removed.
+func (api *SwarmFiltersAPI) Remove(ctx context.Context, filters []string, opts ...SwarmFiltersOption) (_ []string, err error) {
+	defer classify(&err)
+
+	settings := swarmFiltersOptions(opts...)
+
+	swrm, err := api.swarm()
+	if err != nil {
+		return nil, err
+	}
+
+	masks, err := parseFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+	for _, mask := range masks {
+		swrm.Filters.RemoveLiteral(*mask)
+	}
+
+	if !settings.persist {
+		return filters, nil
+	}
+
+	cfg, err := api.repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	toRemove := make(map[string]bool, len(filters))
+	for _, f := range filters {
+		toRemove[f] = true
+	}
+	removed := make([]string, 0, len(filters))
+	keep := make([]string, 0, len(cfg.Swarm.AddrFilters))
+	for _, f := range cfg.Swarm.AddrFilters {
+		if toRemove[f] {
+			removed = append(removed, f)
+		} else {
+			keep = append(keep, f)
+		}
+	}
+	cfg.Swarm.AddrFilters = keep
+
+	if err := api.repo.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// RemoveAll lifts every filter from the swarm, and clears the filters of the
+// config unless SwarmFiltersPersist(false) is given. It returns the filters
+// removed: those of the config when they are cleared, those of the swarm
+// otherwise.
+func (api *SwarmFiltersAPI) RemoveAll(ctx context.Context, opts ...SwarmFiltersOption) (_ []string, err error) {
+	defer classify(&err)
+
+	settings := swarmFiltersOptions(opts...)
+
+	swrm, err := api.swarm()
+	if err != nil {
+		return nil, err
+	}
+
+	fs := swrm.Filters.FiltersForAction(mafilter.ActionDeny)
+	removed := make([]string, 0, len(fs))
+	for _, f := range fs {
+		swrm.Filters.RemoveLiteral(f)
+		if s, err := mamask.ConvertIPNet(&f); err == nil {
+			removed = append(removed, s)
+		}
+	}
+
+	if !settings.persist {
+		return removed, nil
+	}
+
+	cfg, err := api.repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	removed = cfg.Swarm.AddrFilters
+	cfg.Swarm.AddrFilters = nil
+
+	if err := api.repo.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+func parseFilters(filters []string) ([]*net.IPNet, error) {
+	masks := make([]*net.IPNet, 0, len(filters))
+	for _, f := range filters {
+		mask, err := mamask.NewMask(f)
+		if err != nil {
+			return nil, err
+		}
+		masks = append(masks, mask)
+	}
+	return masks, nil
+}
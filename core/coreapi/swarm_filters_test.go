@@ -0,0 +1,102 @@
+package coreapi
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	config "github.com/ipfs/go-ipfs-config"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	swarmt "github.com/libp2p/go-libp2p-swarm/testing"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
+)
+
+func newTestSwarmFilters(t *testing.T, filters ...string) (SwarmFilters, *repo.Mock) {
+	r := &repo.Mock{C: config.Config{}}
+	r.C.Swarm.AddrFilters = filters
+	api := &CoreAPI{
+		repo:     r,
+		peerHost: bhost.New(swarmt.GenSwarm(t, context.Background())),
+	}
+	return (*SwarmAPI)(api).Filters(), r
+}
+
+func TestSwarmFilters(t *testing.T) {
+	ctx := context.Background()
+	const (
+		lan   = "/ip4/192.168.0.0/ipcidr/16"
+		local = "/ip4/10.0.0.0/ipcidr/8"
+	)
+	filters, r := newTestSwarmFilters(t, local)
+
+	added, err := filters.Add(ctx, []string{lan})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(added, []string{lan}) {
+		t.Fatalf("expected %s to be added, got %v", lan, added)
+	}
+	if !reflect.DeepEqual(r.C.Swarm.AddrFilters, []string{lan, local}) {
+		t.Fatalf("expected the filter to be saved, got %v", r.C.Swarm.AddrFilters)
+	}
+
+	// a filter of the session only is applied, but not saved
+	if _, err := filters.Add(ctx, []string{"/ip4/172.16.0.0/ipcidr/12"}, SwarmFiltersPersist(false)); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.C.Swarm.AddrFilters) != 2 {
+		t.Fatalf("expected the config to be unchanged, got %v", r.C.Swarm.AddrFilters)
+	}
+	list, err := filters.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]bool{lan: true, "/ip4/172.16.0.0/ipcidr/12": false}
+	if len(list) != len(expected) {
+		t.Fatalf("unexpected filters %v", list)
+	}
+	for _, f := range list {
+		if persisted, ok := expected[f.Filter]; !ok || persisted != f.Persisted {
+			t.Fatalf("unexpected filter %+v", f)
+		}
+	}
+
+	removed, err := filters.Remove(ctx, []string{lan})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, []string{lan}) || !reflect.DeepEqual(r.C.Swarm.AddrFilters, []string{local}) {
+		t.Fatalf("expected %s to be removed, got %v and %v", lan, removed, r.C.Swarm.AddrFilters)
+	}
+
+	removed, err = filters.RemoveAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, []string{local}) || len(r.C.Swarm.AddrFilters) != 0 {
+		t.Fatalf("expected the config to be cleared, got %v and %v", removed, r.C.Swarm.AddrFilters)
+	}
+	if list, err := filters.List(ctx); err != nil || len(list) != 0 {
+		t.Fatalf("expected no filters left, got %v (%v)", list, err)
+	}
+}
+
+func TestSwarmFiltersInvalid(t *testing.T) {
+	filters, r := newTestSwarmFilters(t)
+	if _, err := filters.Add(context.Background(), []string{"/ip4/1.2.3.4/tcp/1"}); err == nil {
+		t.Fatal("expected an invalid filter to be refused")
+	}
+	if _, err := filters.Add(context.Background(), nil); err == nil {
+		t.Fatal("expected no filters to be refused")
+	}
+	if len(r.C.Swarm.AddrFilters) != 0 {
+		t.Fatalf("expected the config to be unchanged, got %v", r.C.Swarm.AddrFilters)
+	}
+
+	offline := (*SwarmAPI)(&CoreAPI{repo: r}).Filters()
+	if _, err := offline.List(context.Background()); err != coreiface.ErrOffline {
+		t.Fatalf("expected ErrOffline, got %v", err)
+	}
+}
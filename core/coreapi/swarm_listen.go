@@ -0,0 +1,174 @@
+package coreapi
+
+import (
+	"context"
+	"errors"
+
+	event "github.com/libp2p/go-libp2p-core/event"
+	host "github.com/libp2p/go-libp2p-core/host"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ErrListenCloseUnsupported is returned by SwarmListenAPI.Remove when the
+// swarm can't close its listeners: the node keeps listening on the addresses
+// until it restarts. They are removed from the config all the same.
+var ErrListenCloseUnsupported = errors.New("the swarm can't close its listeners, restart the daemon to stop listening")
+
+// SwarmListenAPI opens and closes the listeners of the swarm at runtime.
+type SwarmListenAPI CoreAPI
+
+// listenCloser is the swarm closing its listeners.
+type listenCloser interface {
+	ListenClose(addrs ...ma.Multiaddr)
+}
+
+// Listen returns the API managing the listen addresses of the swarm. It is
+// not part of coreiface.SwarmAPI:
+//
+//	added, err := api.Swarm().(*coreapi.SwarmAPI).Listen().Add(ctx, addrs)
+//
+// The changes are saved under Addresses.Swarm in the config unless
+// SwarmFiltersPersist(false) is given. The new addresses are pushed to the
+// connected peers with identify push.
+func (api *SwarmAPI) Listen() *SwarmListenAPI {
+	return (*SwarmListenAPI)(api)
+}
+
+// Add opens listeners on the addresses, and saves them in the config. It
+// returns the addresses added, failing on the first address the swarm can't
+// listen on: the addresses before it are listened on but not saved.
+func (api *SwarmListenAPI) Add(ctx context.Context, addrs []ma.Multiaddr, opts ...SwarmFiltersOption) (_ []ma.Multiaddr, err error) {
+	defer classify(&err)
+
+	settings := swarmFiltersOptions(opts...)
+
+	swrm, err := (*SwarmFiltersAPI)(api).swarm()
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no addresses to listen on")
+	}
+
+	listening := swrm.ListenAddresses()
+	for _, a := range addrs {
+		if containsAddr(listening, a) {
+			continue
+		}
+		if err := swrm.AddListenAddr(a); err != nil {
+			return nil, err
+		}
+	}
+
+	pushAddrs(api.peerHost)
+
+	if !settings.persist {
+		return addrs, nil
+	}
+
+	cfg, err := api.repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	saved, err := parseAddrs(cfg.Addresses.Swarm)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		if !containsAddr(saved, a) {
+			saved = append(saved, a)
+			cfg.Addresses.Swarm = append(cfg.Addresses.Swarm, a.String())
+		}
+	}
+	if err := api.repo.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	return addrs, nil
+}
+
+// Remove closes the listeners on the addresses, and removes them from the
+// config. It returns the addresses removed, with ErrListenCloseUnsupported
+// if the swarm can't close its listeners.
+func (api *SwarmListenAPI) Remove(ctx context.Context, addrs []ma.Multiaddr, opts ...SwarmFiltersOption) (_ []ma.Multiaddr, err error) {
+	defer classify(&err)
+
+	settings := swarmFiltersOptions(opts...)
+
+	swrm, err := (*SwarmFiltersAPI)(api).swarm()
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no addresses to stop listening on")
+	}
+
+	var closeErr error
+	if lc, ok := interface{}(swrm).(listenCloser); ok {
+		lc.ListenClose(addrs...)
+		pushAddrs(api.peerHost)
+	} else {
+		closeErr = ErrListenCloseUnsupported
+	}
+
+	if !settings.persist {
+		if closeErr != nil {
+			return nil, closeErr
+		}
+		return addrs, nil
+	}
+
+	cfg, err := api.repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	keep := make([]string, 0, len(cfg.Addresses.Swarm))
+	for _, s := range cfg.Addresses.Swarm {
+		a, err := ma.NewMultiaddr(s)
+		if err == nil && containsAddr(addrs, a) {
+			continue
+		}
+		keep = append(keep, s)
+	}
+	cfg.Addresses.Swarm = keep
+	if err := api.repo.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	return addrs, closeErr
+}
+
+// pushAddrs has the identify service push the addresses of h to the
+// connected peers now, rather than when the host notices the change. The
+// service pushes its record, which carries the listen addresses, on the
+// updates of the local protocols.
+func pushAddrs(h host.Host) {
+	em, err := h.EventBus().Emitter(new(event.EvtLocalProtocolsUpdated))
+	if err != nil {
+		log.Warningf("failed to push the listen addresses: %s", err)
+		return
+	}
+	defer em.Close()
+	if err := em.Emit(event.EvtLocalProtocolsUpdated{}); err != nil {
+		log.Warningf("failed to push the listen addresses: %s", err)
+	}
+}
+
+func containsAddr(addrs []ma.Multiaddr, a ma.Multiaddr) bool {
+	for _, b := range addrs {
+		if b.Equal(a) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAddrs(addrs []string) ([]ma.Multiaddr, error) {
+	out := make([]ma.Multiaddr, 0, len(addrs))
+	for _, s := range addrs {
+		a, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/core/coreapi"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestErrorKinds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	apis, err := NodeProvider{}.MakeAPISwarm(ctx, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := apis[0].WithOptions(options.Api.Offline(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := mh.Sum([]byte("not stored"), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := path.IpfsPath(cid.NewCidV1(cid.Raw, h))
+
+	if _, err := api.Block().Get(ctx, missing); !errors.Is(err, coreapi.ErrNotFound) {
+		t.Errorf("expected a missing block to be not found, got %v", err)
+	}
+	if _, err := api.Key().Remove(ctx, "missing"); !errors.Is(err, coreapi.ErrNotFound) {
+		t.Errorf("expected a missing key to be not found, got %v", err)
+	}
+
+	stat, err := api.Block().Put(ctx, strings.NewReader("stored"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Pin().Rm(ctx, stat.Path()); !errors.Is(err, coreapi.ErrNotPinned) {
+		t.Errorf("expected the block not to be pinned, got %v", err)
+	}
+
+	if _, err := api.Dht().FindPeer(ctx, testPeerID); !errors.Is(err, coreapi.ErrOffline) {
+		t.Errorf("expected the offline API to be offline, got %v", err)
+	}
+
+	expired, cancelExpired := context.WithTimeout(ctx, 0)
+	defer cancelExpired()
+	online := apis[0]
+	if _, err := online.Block().Get(expired, missing); !errors.Is(err, coreapi.ErrTimeout) {
+		t.Errorf("expected the fetch to time out, got %v", err)
+	}
+}
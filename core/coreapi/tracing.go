@@ -0,0 +1,17 @@
+package coreapi
+
+import (
+	"context"
+
+	"github.com/ipfs/go-ipfs/core/tracing"
+)
+
+// traceCall starts the span of a call of the API made for a traced request,
+// and returns the context of the call with the function finishing the span
+// with the error of the call.
+func traceCall(ctx context.Context, name string) (context.Context, func(*error)) {
+	sp, ctx := tracing.StartSpan(ctx, "coreapi."+name)
+	return ctx, func(err *error) {
+		tracing.FinishSpan(sp, *err)
+	}
+}
@@ -54,7 +54,15 @@ func getOrCreateNilNode() (*core.IpfsNode, error) {
 
 // Add builds a merkledag node from a reader, adds it to the blockstore,
 // and returns the key representing that node.
-func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options.UnixfsAddOption) (path.Resolved, error) {
+//
+// The progress of the add is sent on the channel set in ctx with
+// coreunix.WithProgress. Canceling ctx aborts the add promptly, and removes
+// the blocks it wrote.
+func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options.UnixfsAddOption) (_ path.Resolved, err error) {
+	defer classify(&err)
+	ctx, done := traceCall(ctx, "Unixfs.Add")
+	defer done(&err)
+
 	settings, prefix, err := options.UnixfsAddOptions(opts...)
 	if err != nil {
 		return nil, err
@@ -125,6 +133,10 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 	}
 
 	fileAdder.Chunker = settings.Chunker
+	// There are no add options for patching and reporting the progress, they
+	// are passed in the context.
+	fileAdder.Patch = coreunix.PatchFromContext(ctx)
+	fileAdder.ProgressCh = coreunix.ProgressFromContext(ctx)
 	if settings.Events != nil {
 		fileAdder.Out = settings.Events
 		fileAdder.Progress = settings.Progress
@@ -166,6 +178,9 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 
 	nd, err := fileAdder.AddAllAndPin(files)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
 
@@ -178,7 +193,11 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 	return path.IpfsPath(nd.Cid()), nil
 }
 
-func (api *UnixfsAPI) Get(ctx context.Context, p path.Path) (files.Node, error) {
+func (api *UnixfsAPI) Get(ctx context.Context, p path.Path) (_ files.Node, err error) {
+	defer classify(&err)
+	ctx, done := traceCall(ctx, "Unixfs.Get")
+	defer done(&err)
+
 	ses := api.core().getSession(ctx)
 
 	nd, err := ses.ResolveNode(ctx, p)
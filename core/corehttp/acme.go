@@ -0,0 +1,21 @@
+package corehttp
+
+import (
+	"net"
+	"net/http"
+
+	core "github.com/ipfs/go-ipfs/core"
+)
+
+// ACMEChallengePath is the path the ACME authorities fetch the tokens of the
+// http-01 challenges from.
+const ACMEChallengePath = "/.well-known/acme-challenge/"
+
+// ACMEChallengeOption answers the http-01 challenges with h, ahead of the
+// gateway and of the DNSLink hostnames.
+func ACMEChallengeOption(h http.Handler) ServeOption {
+	return func(_ *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		mux.Handle(ACMEChallengePath, h)
+		return mux, nil
+	}
+}
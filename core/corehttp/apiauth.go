@@ -0,0 +1,134 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+
+	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/apiauth"
+	corecommands "github.com/ipfs/go-ipfs/core/commands"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// authorizeAPI rejects the API requests without a token of API.Authorizations
+// allowing their command, once any is configured.
+func authorizeAPI(auth *apiauth.Authorizer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, APIPath), "/"), "/")
+		authorizeCommand(auth, commandPath(path), next).ServeHTTP(w, r)
+	})
+}
+
+// AuthorizedOption serves the handlers opt registers under path only to the
+// requests with a token of API.Authorizations of the admin or debug scope,
+// once any is configured. It protects the debugging endpoints of the API
+// listener, as /debug/pprof/ and /logs.
+func AuthorizedOption(path string, opt ServeOption) ServeOption {
+	return func(n *core.IpfsNode, l net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		child, err := opt(n, l, http.NewServeMux())
+		if err != nil {
+			return nil, err
+		}
+		mux.Handle(path, authorizeCommand(n.APIAuth, []string{apiauth.ScopeDebug}, child))
+		return mux, nil
+	}
+}
+
+// WritableGatewayOption serves the writable gateway under paths, as
+// GatewayOption(true, paths...) does, to the requests with a token of
+// API.Authorizations of the admin scope, once any is configured. The tokens of
+// the read-only scope are enough for the GET and HEAD requests. It protects
+// the gateway served by the API listener with --unrestricted-api.
+func WritableGatewayOption(paths ...string) ServeOption {
+	return func(n *core.IpfsNode, l net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		child, err := GatewayOption(true, paths...)(n, l, http.NewServeMux())
+		if err != nil {
+			return nil, err
+		}
+		h := authorize(n.APIAuth, []string{apiauth.ScopeAdmin}, func(r *http.Request) bool {
+			return r.Method == http.MethodGet || r.Method == http.MethodHead
+		}, child)
+		for _, p := range paths {
+			mux.Handle(p+"/", h)
+		}
+		return mux, nil
+	}
+}
+
+// commandPath returns the longest prefix of path naming a command, the rest
+// being an argument given in the path, as in /api/v0/cat/<cid>.
+func commandPath(path []string) []string {
+	cmd := corecommands.Root
+	for i, name := range path {
+		sub, ok := cmd.Subcommands[name]
+		if !ok {
+			return path[:i]
+		}
+		cmd = sub
+	}
+	return path
+}
+
+// authorizeCommand rejects the requests without a token of API.Authorizations
+// allowing the command at path, once any is configured. It protects the
+// handlers serving a command outside of the API, as /debug/events.
+func authorizeCommand(auth *apiauth.Authorizer, path []string, next http.Handler) http.Handler {
+	readOnly := isReadOnlyCommand(path)
+	return authorize(auth, path, func(*http.Request) bool { return readOnly }, next)
+}
+
+// authorize rejects the requests without a token of API.Authorizations
+// allowing path, once any is configured. readOnly tells whether a request
+// is allowed by the read-only scope.
+func authorize(auth *apiauth.Authorizer, path []string, readOnly func(*http.Request) bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the CORS preflights carry no credentials
+		if !auth.Enabled() || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var token string
+		if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+			token = strings.TrimSpace(h[len("Bearer "):])
+		}
+		name, err := auth.Authorize(token, path, readOnly(r))
+		switch err {
+		case nil:
+			next.ServeHTTP(w, r)
+			return
+		case apiauth.ErrUnauthorized:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ipfs-api"`)
+			writeAPIError(w, http.StatusUnauthorized, err)
+		default:
+			log.Infof("API token %s denied %s", name, strings.Join(path, "/"))
+			writeAPIError(w, http.StatusForbidden, err)
+		}
+	})
+}
+
+// isReadOnlyCommand returns whether path is a command of the read-only API.
+func isReadOnlyCommand(path []string) bool {
+	cmd := corecommands.RootRO
+	for _, name := range path {
+		sub, ok := cmd.Subcommands[name]
+		if !ok {
+			return false
+		}
+		cmd = sub
+	}
+	return true
+}
+
+// writeAPIError answers with code, and the error the command clients expect.
+func writeAPIError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(&cmds.Error{
+		Message: err.Error(),
+		Code:    cmds.ErrClient,
+	})
+}
@@ -0,0 +1,27 @@
+package corehttp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommandPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"cat":         "cat",
+		"cat/QmHash":  "cat",
+		"pin/add":     "pin/add",
+		"pin/add/Qm":  "pin/add",
+		"nosuchcmd/x": "",
+	} {
+		if got := strings.Join(commandPath(strings.Split(path, "/")), "/"); got != want {
+			t.Errorf("%s: expected the command %q, got %q", path, want, got)
+		}
+	}
+
+	if !isReadOnlyCommand(commandPath([]string{"cat", "QmHash"})) {
+		t.Error("expected cat/<cid> to be read-only")
+	}
+	if isReadOnlyCommand(commandPath([]string{"pin", "add", "QmHash"})) {
+		t.Error("expected pin/add/<cid> not to be read-only")
+	}
+}
@@ -117,7 +117,7 @@ func patchCORSVars(c *cmdsHttp.ServerConfig, addr net.Addr) {
 	c.SetAllowedOrigins(newOrigins...)
 }
 
-func commandsOption(cctx oldcmds.Context, command *cmds.Command) ServeOption {
+func commandsOption(cctx oldcmds.Context, command *cmds.Command, authorize bool) ServeOption {
 	return func(n *core.IpfsNode, l net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
 
 		cfg := cmdsHttp.NewServerConfig()
@@ -133,22 +133,37 @@ func commandsOption(cctx oldcmds.Context, command *cmds.Command) ServeOption {
 		addCORSDefaults(cfg)
 		patchCORSVars(cfg, l.Addr())
 
-		cmdHandler := cmdsHttp.NewHandler(&cctx, command, cfg)
+		var cmdHandler http.Handler = cmdsHttp.NewHandler(&cctx, command, cfg)
+		if authorize && n.APIAuth != nil {
+			cmdHandler = authorizeAPI(n.APIAuth, cmdHandler)
+		}
+		cmdHandler = n.Tracer.Handler(cmdHandler)
 		mux.Handle(APIPath+"/", cmdHandler)
 		return mux, nil
 	}
 }
 
 // CommandsOption constructs a ServerOption for hooking the commands into the
-// HTTP server.
+// HTTP server, restricted by API.Authorizations.
 func CommandsOption(cctx oldcmds.Context) ServeOption {
-	return commandsOption(cctx, corecommands.Root)
+	return commandsOption(cctx, corecommands.Root, true)
 }
 
 // CommandsROOption constructs a ServerOption for hooking the read-only commands
 // into the HTTP server.
 func CommandsROOption(cctx oldcmds.Context) ServeOption {
-	return commandsOption(cctx, corecommands.RootRO)
+	return commandsOption(cctx, corecommands.RootRO, false)
+}
+
+// PublicAPIAddrsConfigKey is the config key of the addresses of the public
+// API, serving the commands of corecommands.RootPublic only.
+const PublicAPIAddrsConfigKey = "Addresses.PublicAPI"
+
+// CommandsPublicOption constructs a ServerOption for hooking the commands of
+// the public API into the HTTP server. The other commands can't be routed to,
+// so API.Authorizations doesn't apply.
+func CommandsPublicOption(cctx oldcmds.Context) ServeOption {
+	return commandsOption(cctx, corecommands.RootPublic, false)
 }
 
 // CheckVersionOption returns a ServeOption that checks whether the client ipfs version matches. Does nothing when the user agent string does not contain `/go-ipfs/`
@@ -0,0 +1,94 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	nodeevents "github.com/ipfs/go-ipfs/core/nodeevents"
+)
+
+// eventsKeepAlive is the period of the comments sent to the subscribers of
+// the events, for the proxies not to close the idle streams.
+const eventsKeepAlive = 30 * time.Second
+
+// EventsOption serves the events of the node on path as server-sent events,
+// the ones of 'ipfs diag events': each event is sent as
+//
+//	event: <type>
+//	data: <event as JSON>
+//
+// The "type" query parameter only sends the events of the given types,
+// separated by commas, and "recent" sends the last events first. The stream
+// requires a token allowing 'diag/events' once API.Authorizations is
+// configured.
+func EventsOption(path string) ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		mux.Handle(path, authorizeCommand(n.APIAuth, []string{"diag", "events"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveEvents(n.Events, w, r)
+		})))
+		return mux, nil
+	}
+}
+
+func serveEvents(bus *nodeevents.Bus, w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if bus == nil || !ok {
+		http.Error(w, "the node does not stream its events", http.StatusNotImplemented)
+		return
+	}
+	match, err := nodeevents.Filter(r.URL.Query().Get("type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, cancel := bus.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(ev nodeevents.Event) error {
+		if !match(ev) {
+			return nil
+		}
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		return err
+	}
+
+	if r.URL.Query().Get("recent") == "true" {
+		for _, ev := range bus.Events() {
+			if err := send(ev); err != nil {
+				return
+			}
+		}
+	}
+	f.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case ev := <-events:
+			if err := send(ev); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		f.Flush()
+	}
+}
@@ -0,0 +1,53 @@
+package corehttp
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	nodeevents "github.com/ipfs/go-ipfs/core/nodeevents"
+)
+
+func TestServeEvents(t *testing.T) {
+	bus := nodeevents.New()
+	bus.Publish(nodeevents.Event{Type: nodeevents.PinAdded, Cid: "recent"})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveEvents(bus, w, r)
+	}))
+	defer srv.Close()
+
+	if res, err := http.Get(srv.URL + "?type=reboot"); err != nil || res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an unknown type refused, got %v", err)
+	}
+
+	res, err := http.Get(srv.URL + "?type=pin-added,gc&recent=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	// the headers are flushed once subscribed
+	bus.Publish(nodeevents.Event{Type: nodeevents.PeerConnected})
+	bus.Publish(nodeevents.Event{Type: nodeevents.GC, Removed: 3})
+
+	r := bufio.NewReader(res.Body)
+	for _, want := range []nodeevents.Type{nodeevents.PinAdded, nodeevents.GC} {
+		name, _ := r.ReadString('\n')
+		data, _ := r.ReadString('\n')
+		blank, _ := r.ReadString('\n')
+		if name != "event: "+string(want)+"\n" || blank != "\n" {
+			t.Fatalf("expected a %s event, got %q %q", want, name, data)
+		}
+		var ev nodeevents.Event
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &ev); err != nil || ev.Type != want {
+			t.Fatalf("unexpected data %q: %v", data, err)
+		}
+	}
+}
@@ -2,14 +2,20 @@ package corehttp
 
 import (
 	"fmt"
+	"html/template"
 	"net"
 	"net/http"
 	"sort"
 
 	version "github.com/ipfs/go-ipfs"
 	core "github.com/ipfs/go-ipfs/core"
+	contenttype "github.com/ipfs/go-ipfs/core/contenttype"
 	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	pathnorm "github.com/ipfs/go-ipfs/core/pathnorm"
+	replica "github.com/ipfs/go-ipfs/core/replica"
+	repo "github.com/ipfs/go-ipfs/repo"
 
+	config "github.com/ipfs/go-ipfs-config"
 	options "github.com/ipfs/interface-go-ipfs-core/options"
 	id "github.com/libp2p/go-libp2p/p2p/protocol/identify"
 )
@@ -18,6 +24,25 @@ type GatewayConfig struct {
 	Headers      map[string][]string
 	Writable     bool
 	PathPrefixes []string
+	Normalizer   *pathnorm.Normalizer
+
+	// Replica is set on read replicas: content which isn't replicated yet
+	// is answered with 503 instead of being fetched.
+	Replica *replica.Follower
+
+	// ListingTemplate and ErrorTemplate replace the directory listings and
+	// the plain text error pages when set. CSS is passed to both.
+	ListingTemplate *template.Template
+	ErrorTemplate   *template.Template
+	CSS             template.CSS
+
+	// ContentTypes overrides the content types of the files served. When
+	// nil, they are only detected from the names and the contents.
+	ContentTypes *contenttype.Store
+
+	// ACL allows or denies the paths served, nil when the gateway serves
+	// every path.
+	ACL *gatewayACL
 }
 
 // A helper function to clean up a set of headers:
@@ -40,6 +65,46 @@ func cleanHeaderSet(headers []string) []string {
 	return result
 }
 
+// gatewayHeaders returns the headers of the responses of the gateway: those
+// of Gateway.HTTPHeaders, and the CORS headers.
+func gatewayHeaders(cfg *config.Config) map[string][]string {
+	headers := make(map[string][]string, len(cfg.Gateway.HTTPHeaders))
+	for h, v := range cfg.Gateway.HTTPHeaders {
+		headers[http.CanonicalHeaderKey(h)] = v
+	}
+
+	// Hard-coded headers.
+	const ACAHeadersName = "Access-Control-Allow-Headers"
+	const ACEHeadersName = "Access-Control-Expose-Headers"
+	const ACAOriginName = "Access-Control-Allow-Origin"
+	const ACAMethodsName = "Access-Control-Allow-Methods"
+
+	if _, ok := headers[ACAOriginName]; !ok {
+		// Default to *all*
+		headers[ACAOriginName] = []string{"*"}
+	}
+	if _, ok := headers[ACAMethodsName]; !ok {
+		// Default to GET
+		headers[ACAMethodsName] = []string{"GET"}
+	}
+
+	headers[ACAHeadersName] = cleanHeaderSet(
+		append([]string{
+			"Content-Type",
+			"User-Agent",
+			"Range",
+			"X-Requested-With",
+		}, headers[ACAHeadersName]...))
+
+	headers[ACEHeadersName] = cleanHeaderSet(
+		append([]string{
+			"Content-Range",
+			"X-Chunked-Output",
+			"X-Stream-Output",
+		}, headers[ACEHeadersName]...))
+	return headers
+}
+
 func GatewayOption(writable bool, paths ...string) ServeOption {
 	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
 		cfg, err := n.Repo.Config()
@@ -47,54 +112,60 @@ func GatewayOption(writable bool, paths ...string) ServeOption {
 			return nil, err
 		}
 
-		api, err := coreapi.NewCoreAPI(n, options.Api.FetchBlocks(!cfg.Gateway.NoFetch))
+		// read replicas only serve the content replicated from their primary
+		var follower *replica.Follower
+		if n.Replica != nil {
+			follower = n.Replica.Follower
+		}
+		if follower != nil {
+			writable = false
+		}
+
+		api, err := coreapi.NewCoreAPI(n, options.Api.FetchBlocks(!cfg.Gateway.NoFetch && follower == nil))
 		if err != nil {
 			return nil, err
 		}
 
-		headers := make(map[string][]string, len(cfg.Gateway.HTTPHeaders))
-		for h, v := range cfg.Gateway.HTTPHeaders {
-			headers[http.CanonicalHeaderKey(h)] = v
+		normalizer, err := pathnorm.ForGateway(n.Repo)
+		if err != nil {
+			return nil, err
 		}
 
-		// Hard-coded headers.
-		const ACAHeadersName = "Access-Control-Allow-Headers"
-		const ACEHeadersName = "Access-Control-Expose-Headers"
-		const ACAOriginName = "Access-Control-Allow-Origin"
-		const ACAMethodsName = "Access-Control-Allow-Methods"
+		gwCfg := GatewayConfig{
+			Headers:      gatewayHeaders(cfg),
+			Writable:     writable,
+			PathPrefixes: cfg.Gateway.PathPrefixes,
+			Normalizer:   normalizer,
+			Replica:      follower,
+			ContentTypes: contenttype.NewStore(n.Repo.Datastore()),
+		}
 
-		if _, ok := headers[ACAOriginName]; !ok {
-			// Default to *all*
-			headers[ACAOriginName] = []string{"*"}
+		var aclCfg GatewayACL
+		if err := repo.LoadConfigKey(n.Repo, GatewayACLConfigKey, &aclCfg); err != nil {
+			return nil, err
 		}
-		if _, ok := headers[ACAMethodsName]; !ok {
-			// Default to GET
-			headers[ACAMethodsName] = []string{"GET"}
+		if aclCfg.Enabled() {
+			if gwCfg.ACL, err = newGatewayACL(aclCfg, normalizer); err != nil {
+				return nil, err
+			}
 		}
 
-		headers[ACAHeadersName] = cleanHeaderSet(
-			append([]string{
-				"Content-Type",
-				"User-Agent",
-				"Range",
-				"X-Requested-With",
-			}, headers[ACAHeadersName]...))
-
-		headers[ACEHeadersName] = cleanHeaderSet(
-			append([]string{
-				"Content-Range",
-				"X-Chunked-Output",
-				"X-Stream-Output",
-			}, headers[ACEHeadersName]...))
-
-		gateway := newGatewayHandler(GatewayConfig{
-			Headers:      headers,
-			Writable:     writable,
-			PathPrefixes: cfg.Gateway.PathPrefixes,
-		}, api)
+		var templates GatewayTemplates
+		if err := repo.LoadConfigKey(n.Repo, GatewayTemplatesConfigKey, &templates); err != nil {
+			return nil, err
+		}
+		if err := loadGatewayTemplates(n.Context(), api, templates, &gwCfg); err != nil {
+			return nil, err
+		}
+
+		gateway := newGatewayHandler(gwCfg, api)
+		n.Reloader.Register("Gateway.HTTPHeaders", func(_, cfg *config.Config) error {
+			gateway.setHeaders(gatewayHeaders(cfg))
+			return nil
+		})
 
 		for _, p := range paths {
-			mux.Handle(p+"/", gateway)
+			mux.Handle(p+"/", n.QoS.Handler(gateway))
 		}
 		return mux, nil
 	}
@@ -0,0 +1,330 @@
+package corehttp
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	gopath "path"
+	"strings"
+
+	pathnorm "github.com/ipfs/go-ipfs/core/pathnorm"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// GatewayACLConfigKey is the config key of the access control of the
+// gateway paths.
+const GatewayACLConfigKey = "Gateway.ACL"
+
+// errAccessDenied is the error of the requests the ACL rejects.
+var errAccessDenied = errors.New("access denied")
+
+// GatewayACL holds the Gateway.ACL config section. The rules are tried in
+// order, and the first one matching the path of a request decides; Default
+// decides for the paths no rule matches. The rules are checked against the
+// requested path, and once it is resolved, against the paths of every node it
+// goes through, so that a denied CID can't be reached through one of its
+// parents or through an IPNS name. A CAR file is only served if every node of
+// its DAG is allowed.
+type GatewayACL struct {
+	// Default is "allow", the default, or "deny".
+	Default string
+
+	Rules []GatewayACLRule
+}
+
+// GatewayACLRule allows or denies the paths of a CID, of an IPNS name, or
+// under a path prefix. Exactly one of Cid, Name and Path is set.
+type GatewayACLRule struct {
+	// Action is "allow" or "deny".
+	Action string
+
+	// Cid matches /ipfs/<cid> and the paths under it, in any CID version.
+	Cid string
+	// Name matches /ipns/<name> and the paths under it.
+	Name string
+	// Path matches a path and the paths under it, such as
+	// /ipfs/<cid>/public.
+	Path string
+
+	// Tokens, on an allow rule, are the bearer tokens of which one must be
+	// given in the Authorization header.
+	Tokens []string
+}
+
+// Enabled returns whether cfg restricts the gateway.
+func (cfg GatewayACL) Enabled() bool {
+	return cfg.Default != "" || len(cfg.Rules) > 0
+}
+
+// gatewayACL is the compiled Gateway.ACL section.
+type gatewayACL struct {
+	deny  bool
+	rules []aclRule
+
+	// norm is the normalizer of the gateway lookups, the names of the
+	// paths are compared by their normalized keys.
+	norm *pathnorm.Normalizer
+}
+
+type aclRule struct {
+	allow  bool
+	prefix string
+	tokens []string
+}
+
+// newGatewayACL compiles cfg. The path rules match the names n normalizes
+// to the same key.
+func newGatewayACL(cfg GatewayACL, n *pathnorm.Normalizer) (*gatewayACL, error) {
+	acl := &gatewayACL{norm: n}
+	switch cfg.Default {
+	case "", "allow":
+	case "deny":
+		acl.deny = true
+	default:
+		return nil, fmt.Errorf("%s.Default: expected allow or deny, got %q", GatewayACLConfigKey, cfg.Default)
+	}
+
+	for n, r := range cfg.Rules {
+		var rule aclRule
+		switch r.Action {
+		case "allow":
+			rule.allow = true
+		case "deny":
+			if len(r.Tokens) > 0 {
+				return nil, fmt.Errorf("%s.Rules[%d]: tokens are only allowed on allow rules", GatewayACLConfigKey, n)
+			}
+		default:
+			return nil, fmt.Errorf("%s.Rules[%d]: expected the action allow or deny, got %q", GatewayACLConfigKey, n, r.Action)
+		}
+
+		var set int
+		for _, s := range []string{r.Cid, r.Name, r.Path} {
+			if s != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("%s.Rules[%d]: expected exactly one of Cid, Name and Path", GatewayACLConfigKey, n)
+		}
+		switch {
+		case r.Cid != "":
+			c, err := cid.Decode(r.Cid)
+			if err != nil {
+				return nil, fmt.Errorf("%s.Rules[%d]: invalid CID %q: %s", GatewayACLConfigKey, n, r.Cid, err)
+			}
+			rule.prefix = ipfsPathPrefix + cid.NewCidV1(c.Type(), c.Hash()).String()
+		case r.Name != "":
+			if strings.Contains(r.Name, "/") {
+				return nil, fmt.Errorf("%s.Rules[%d]: invalid name %q", GatewayACLConfigKey, n, r.Name)
+			}
+			rule.prefix = ipnsPathPrefix + r.Name
+		default:
+			if !strings.HasPrefix(r.Path, "/") {
+				return nil, fmt.Errorf("%s.Rules[%d]: invalid path %q", GatewayACLConfigKey, n, r.Path)
+			}
+			rule.prefix = aclPath(r.Path)
+		}
+
+		for _, t := range r.Tokens {
+			if t == "" {
+				return nil, fmt.Errorf("%s.Rules[%d]: empty token", GatewayACLConfigKey, n)
+			}
+		}
+		rule.prefix = acl.key(rule.prefix)
+		rule.tokens = r.Tokens
+		acl.rules = append(acl.rules, rule)
+	}
+	return acl, nil
+}
+
+// aclPath cleans p, and turns the CID of an /ipfs/ path into its version 1.
+func aclPath(p string) string {
+	p = gopath.Clean("/" + p)
+	segs := strings.SplitN(p, "/", 4)
+	if len(segs) >= 3 && segs[1] == "ipfs" {
+		if c, err := cid.Decode(segs[2]); err == nil {
+			segs[2] = cid.NewCidV1(c.Type(), c.Hash()).String()
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// key returns the key the cleaned path p is matched by: the names after the
+// root of p are normalized.
+func (acl *gatewayACL) key(p string) string {
+	if !acl.norm.Enabled() {
+		return p
+	}
+	segs := strings.SplitN(p, "/", 4)
+	if len(segs) == 4 {
+		segs[3] = acl.norm.Key(segs[3])
+	}
+	return strings.Join(segs, "/")
+}
+
+// decide returns whether a rule matches the cleaned path p, and the status
+// code the first one that does rejects r with, or 0.
+func (acl *gatewayACL) decide(r *http.Request, p string) (bool, int) {
+	p = acl.key(p)
+	for _, rule := range acl.rules {
+		if p != rule.prefix && !strings.HasPrefix(p, rule.prefix+"/") {
+			continue
+		}
+		if !rule.allow {
+			return true, http.StatusForbidden
+		}
+		if len(rule.tokens) > 0 && !validToken(r, rule.tokens) {
+			return true, http.StatusUnauthorized
+		}
+		return true, 0
+	}
+	return false, 0
+}
+
+// defaultCode returns the status code of the paths no rule matches.
+func (acl *gatewayACL) defaultCode() int {
+	if acl.deny {
+		return http.StatusForbidden
+	}
+	return 0
+}
+
+// check returns 0 if r is allowed, or the status code it is rejected with:
+// 401 when a token is missing or invalid, and 403 when the path is denied.
+func (acl *gatewayACL) check(r *http.Request) int {
+	if matched, code := acl.decide(r, aclPath(r.URL.Path)); matched {
+		return code
+	}
+	return acl.defaultCode()
+}
+
+// checkResolved is check for the resolved path p, of which steps are the
+// nodes, rootSteps of them being the nodes of the root of p. Every node is
+// matched with the rest of the path under it, and an /ipns/ path by its name
+// as well. The most restrictive of the matching rules decides.
+func (acl *gatewayACL) checkResolved(r *http.Request, p ipath.Path, steps []pathnorm.Step, rootSteps int) int {
+	names := make([]string, len(steps))
+	for n, s := range steps {
+		names[n] = s.Name
+	}
+
+	var paths []string
+	for n, s := range steps {
+		elems := append([]string{ipfsPathPrefix, s.Node.Cid().String()}, names[n+1:]...)
+		paths = append(paths, aclPath(gopath.Join(elems...)))
+	}
+	if p.Namespace() == "ipns" {
+		segs := strings.SplitN(strings.Trim(p.String(), "/"), "/", 3)
+		elems := append([]string{ipnsPathPrefix, segs[1]}, names[rootSteps:]...)
+		paths = append(paths, aclPath(gopath.Join(elems...)))
+	}
+
+	matched, code := false, 0
+	for _, cp := range paths {
+		m, c := acl.decide(r, cp)
+		// 403 is more restrictive than 401, which is more than 0
+		if m && c > code {
+			code = c
+		}
+		matched = matched || m
+	}
+	if !matched {
+		return acl.defaultCode()
+	}
+	return code
+}
+
+// validToken returns whether r carries one of tokens as a bearer token.
+func validToken(r *http.Request, tokens []string) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	given := []byte(strings.TrimSpace(auth[len("Bearer "):]))
+	valid := false
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare(given, []byte(t)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// checkACL rejects the requests the ACL of the gateway denies, and returns
+// whether r may be served.
+func (i *gatewayHandler) checkACL(w http.ResponseWriter, r *http.Request) bool {
+	if i.config.ACL == nil {
+		return true
+	}
+	return i.denyACL(w, r, i.config.ACL.check(r))
+}
+
+// checkDAG is checkResolved for every node of the DAG under the last of
+// steps, each with the path it is reached by, for the responses serving the
+// DAG whole as CAR files do. It returns the code of the first node rejected.
+func (acl *gatewayACL) checkDAG(ctx context.Context, r *http.Request, p ipath.Path, steps []pathnorm.Step, rootSteps int, ng ipld.NodeGetter) (int, error) {
+	seen := cid.NewSet()
+	var walk func(steps []pathnorm.Step) (int, error)
+	walk = func(steps []pathnorm.Step) (int, error) {
+		c := steps[len(steps)-1].Node.Cid()
+		if !seen.Visit(c) {
+			return 0, nil
+		}
+		if code := acl.checkResolved(r, p, steps, rootSteps); code != 0 {
+			return code, nil
+		}
+		nd, err := ng.Get(ctx, c)
+		if err != nil {
+			return 0, err
+		}
+		for _, l := range nd.Links() {
+			child := append(steps[:len(steps):len(steps)], pathnorm.Step{Name: l.Name, Node: ipath.IpfsPath(l.Cid)})
+			if code, err := walk(child); code != 0 || err != nil {
+				return code, err
+			}
+		}
+		return 0, nil
+	}
+	return walk(steps)
+}
+
+// checkResolvedACL resolves p again, node by node, and rejects the requests
+// the ACL of the gateway denies one of the nodes of, or with dag, one of the
+// nodes of the DAG under p. It returns whether r may be served.
+func (i *gatewayHandler) checkResolvedACL(w http.ResponseWriter, r *http.Request, p ipath.Path, escapedURLPath string, dag bool) bool {
+	if i.config.ACL == nil {
+		return true
+	}
+	steps, rootSteps, err := i.config.Normalizer.Walk(r.Context(), i.api, p)
+	if err != nil {
+		i.webError(w, "ipfs resolve -r "+escapedURLPath, err, http.StatusNotFound)
+		return false
+	}
+	if !dag {
+		return i.denyACL(w, r, i.config.ACL.checkResolved(r, p, steps, rootSteps))
+	}
+	code, err := i.config.ACL.checkDAG(r.Context(), r, p, steps, rootSteps, i.api.Dag())
+	if err != nil {
+		i.webError(w, "ipfs dag export "+escapedURLPath, err, http.StatusNotFound)
+		return false
+	}
+	return i.denyACL(w, r, code)
+}
+
+// denyACL rejects r with code, unless code is 0, and returns whether r may be
+// served.
+func (i *gatewayHandler) denyACL(w http.ResponseWriter, r *http.Request, code int) bool {
+	if code == 0 {
+		return true
+	}
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ipfs-gateway"`)
+	}
+	i.webErrorWithCode(w, r.URL.Path, errAccessDenied, code)
+	return false
+}
@@ -1,19 +1,25 @@
 package corehttp
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"mime"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	gopath "path"
 	"regexp"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/ipfs/go-ipfs/core/car"
+	"github.com/ipfs/go-ipfs/core/gwfed"
+
 	"github.com/dustin/go-humanize"
 	"github.com/ipfs/go-cid"
 	files "github.com/ipfs/go-ipfs-files"
@@ -37,6 +43,10 @@ const (
 type gatewayHandler struct {
 	config GatewayConfig
 	api    coreiface.CoreAPI
+
+	// headers holds the user headers, config.Headers until the config is
+	// reloaded
+	headers atomic.Value
 }
 
 func newGatewayHandler(c GatewayConfig, api coreiface.CoreAPI) *gatewayHandler {
@@ -44,9 +54,15 @@ func newGatewayHandler(c GatewayConfig, api coreiface.CoreAPI) *gatewayHandler {
 		config: c,
 		api:    api,
 	}
+	i.headers.Store(c.Headers)
 	return i
 }
 
+// setHeaders replaces the user headers of the responses.
+func (i *gatewayHandler) setHeaders(headers map[string][]string) {
+	i.headers.Store(headers)
+}
+
 func parseIpfsPath(p string) (cid.Cid, string, error) {
 	rootPath, err := path.ParsePath(p)
 	if err != nil {
@@ -81,6 +97,10 @@ func (i *gatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	if r.Method != "OPTIONS" && !i.checkACL(w, r) {
+		return
+	}
+
 	if i.config.Writable {
 		switch r.Method {
 		case "POST":
@@ -128,6 +148,13 @@ func (i *gatewayHandler) optionsHandler(w http.ResponseWriter, r *http.Request)
 
 func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request) {
 	begin := time.Now()
+
+	// a federated gateway asking for a block must not have it looked up on
+	// our own upstreams, which could be asking us
+	if r.Header.Get(gwfed.Header) != "" {
+		r = r.WithContext(gwfed.Local(r.Context()))
+	}
+
 	urlPath := r.URL.Path
 	escapedURLPath := r.URL.EscapedPath()
 
@@ -163,32 +190,65 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		matched, _ := regexp.MatchString(`^/ip[fn]s/[^/]+$`, r.URL.Path)
 		if matched {
 			err := fmt.Errorf("registration is not allowed for this scope")
-			webError(w, "navigator.serviceWorker", err, http.StatusBadRequest)
+			i.webError(w, "navigator.serviceWorker", err, http.StatusBadRequest)
 			return
 		}
 	}
 
 	parsedPath := ipath.New(urlPath)
 	if err := parsedPath.IsValid(); err != nil {
-		webError(w, "invalid ipfs path", err, http.StatusBadRequest)
+		i.webError(w, "invalid ipfs path", err, http.StatusBadRequest)
 		return
 	}
 
 	// Resolve path to the final DAG node for the ETag
-	resolvedPath, err := i.api.ResolvePath(r.Context(), parsedPath)
+	resolvedPath, err := i.config.Normalizer.ResolvePath(r.Context(), i.api, parsedPath)
 	switch err {
 	case nil:
 	case coreiface.ErrOffline:
-		webError(w, "ipfs resolve -r "+escapedURLPath, err, http.StatusServiceUnavailable)
+		i.webError(w, "ipfs resolve -r "+escapedURLPath, err, http.StatusServiceUnavailable)
 		return
 	default:
-		webError(w, "ipfs resolve -r "+escapedURLPath, err, http.StatusNotFound)
+		if _, ok := err.(resolver.ErrNoLink); !ok && i.config.Replica != nil {
+			i.notReplicated(w, escapedURLPath)
+			return
+		}
+		i.webError(w, "ipfs resolve -r "+escapedURLPath, err, http.StatusNotFound)
+		return
+	}
+
+	if !i.checkResolvedACL(w, r, parsedPath, escapedURLPath, requestedFormat(r) == "car") {
+		return
+	}
+
+	if i.config.Replica != nil {
+		available, err := i.config.Replica.Available(resolvedPath.Root())
+		if err != nil {
+			i.internalWebError(w, err)
+			return
+		}
+		if !available {
+			i.notReplicated(w, escapedURLPath)
+			return
+		}
+	}
+
+	switch requestedFormat(r) {
+	case "raw":
+		i.serveRawBlock(w, r, resolvedPath, urlPath)
+		return
+	case "car":
+		i.serveCar(w, r, resolvedPath, urlPath)
 		return
 	}
 
 	dr, err := i.api.Unixfs().Get(r.Context(), resolvedPath)
 	if err != nil {
-		webError(w, "ipfs cat "+escapedURLPath, err, http.StatusNotFound)
+		if i.config.Replica != nil {
+			i.notReplicated(w, escapedURLPath)
+			return
+		}
+		i.webError(w, "ipfs cat "+escapedURLPath, err, http.StatusNotFound)
 		return
 	}
 
@@ -232,7 +292,7 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 
 		base32Encoded, err := multibase.Encode(multibase.Base32, suboriginRaw)
 		if err != nil {
-			internalWebError(w, err)
+			i.internalWebError(w, err)
 			return
 		}
 
@@ -262,12 +322,11 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		} else {
 			name = getFilename(urlPath)
 		}
-		i.serveFile(w, r, name, modtime, f)
+		i.serveFile(w, r, resolvedPath.Cid(), name, modtime, f)
 		return
 	}
-	dir, ok := dr.(files.Directory)
-	if !ok {
-		internalWebError(w, fmt.Errorf("unsupported file type"))
+	if _, ok := dr.(files.Directory); !ok {
+		i.internalWebError(w, fmt.Errorf("unsupported file type"))
 		return
 	}
 
@@ -284,43 +343,73 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 
 		f, ok := idx.(files.File)
 		if !ok {
-			internalWebError(w, files.ErrNotReader)
+			i.internalWebError(w, files.ErrNotReader)
+			return
+		}
+		if !i.checkResolvedACL(w, r, ipath.Join(parsedPath, "index.html"), escapedURLPath, false) {
 			return
 		}
 
 		// write to request
-		http.ServeContent(w, r, "index.html", modtime, f)
+		http.ServeContent(w, r, "index.html", modtime, sizedSeeker(f))
 		return
 	case resolver.ErrNoLink:
 		// no index.html; noop
 	default:
-		internalWebError(w, err)
+		i.internalWebError(w, err)
 		return
 	}
 
+	w.Header().Add("Vary", "Accept")
+	jsonMode := wantsJSONListing(r)
+	if jsonMode {
+		w.Header().Set("Content-Type", jsonContentType)
+	}
 	if r.Method == "HEAD" {
 		return
 	}
 
-	// storage for directory listing
-	var dirListing []directoryItem
-	dirit := dir.Entries()
-	for dirit.Next() {
-		// See comment above where originalUrlPath is declared.
-		s, err := dirit.Node().Size()
-		if err != nil {
-			internalWebError(w, err)
-			return
-		}
-
-		di := directoryItem{humanize.Bytes(uint64(s)), dirit.Name(), gopath.Join(originalUrlPath, dirit.Name())}
-		dirListing = append(dirListing, di)
+	opts, err := parseListingOptions(r.URL.Query())
+	if err != nil {
+		i.webError(w, "invalid directory listing", err, http.StatusBadRequest)
+		return
 	}
-	if dirit.Err() != nil {
-		internalWebError(w, dirit.Err())
+	entries, err := i.listDirectory(r.Context(), resolvedPath)
+	if err != nil {
+		i.internalWebError(w, err)
+		return
+	}
+	sortListing(entries, opts)
+	page, pages, err := listingPage(entries, opts)
+	if err != nil {
+		i.webError(w, "invalid directory listing", err, http.StatusBadRequest)
 		return
 	}
 
+	// See comment above where originalUrlPath is declared.
+	if jsonMode {
+		serveJSONListing(w, &jsonListing{
+			Path:    originalUrlPath,
+			Cid:     resolvedPath.Cid().String(),
+			Entries: page,
+			Total:   len(entries),
+			Page:    opts.page,
+			Pages:   pages,
+		})
+		return
+	}
+
+	// storage for directory listing
+	dirListing := make([]directoryItem, 0, len(page))
+	for _, e := range page {
+		dirListing = append(dirListing, directoryItem{
+			Size: humanize.Bytes(e.Size),
+			Name: e.Name,
+			Path: gopath.Join(originalUrlPath, e.Name),
+			Cid:  e.Cid,
+		})
+	}
+
 	// construct the correct back link
 	// https://github.com/ipfs/go-ipfs/issues/1365
 	var backLink string = prefix + urlPath
@@ -364,10 +453,19 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		Path:     originalUrlPath,
 		BackLink: backLink,
 		Hash:     hash,
+		CSS:      i.config.CSS,
+		Page:     opts.page,
+		Pages:    pages,
+		PrevLink: pageLink(r, opts.page-1, pages),
+		NextLink: pageLink(r, opts.page+1, pages),
+	}
+	tpl := listingTemplate
+	if i.config.ListingTemplate != nil {
+		tpl = i.config.ListingTemplate
 	}
-	err = listingTemplate.Execute(w, tplData)
+	err = tpl.Execute(w, tplData)
 	if err != nil {
-		internalWebError(w, err)
+		i.internalWebError(w, err)
 		return
 	}
 }
@@ -390,23 +488,25 @@ func (s *sizeSeeker) Seek(offset int64, whence int) (int64, error) {
 	return s.sizeReadSeeker.Seek(offset, whence)
 }
 
-func (i *gatewayHandler) serveFile(w http.ResponseWriter, req *http.Request, name string, modtime time.Time, content io.ReadSeeker) {
+// sizedSeeker returns content, answering the seeks to its end, which
+// http.ServeContent does to learn its size, with its size when known,
+// instead of walking the DAG down to its last block.
+func sizedSeeker(content io.ReadSeeker) io.ReadSeeker {
 	if sp, ok := content.(sizeReadSeeker); ok {
-		content = &sizeSeeker{
+		return &sizeSeeker{
 			sizeReadSeeker: sp,
 		}
 	}
+	return content
+}
 
-	ctype := mime.TypeByExtension(gopath.Ext(name))
-	if ctype == "" {
-		buf := make([]byte, 512)
-		n, _ := io.ReadFull(content, buf[:])
-		ctype = http.DetectContentType(buf[:n])
-		_, err := content.Seek(0, io.SeekStart)
-		if err != nil {
-			http.Error(w, "seeker can't seek", http.StatusInternalServerError)
-			return
-		}
+func (i *gatewayHandler) serveFile(w http.ResponseWriter, req *http.Request, c cid.Cid, name string, modtime time.Time, content io.ReadSeeker) {
+	content = sizedSeeker(content)
+
+	ctype, err := i.config.ContentTypes.TypeOf(c, name, content)
+	if err != nil {
+		i.internalWebError(w, err)
+		return
 	}
 	// Strip the encoding from the HTML Content-Type header and let the
 	// browser figure it out.
@@ -420,10 +520,115 @@ func (i *gatewayHandler) serveFile(w http.ResponseWriter, req *http.Request, nam
 	http.ServeContent(w, req, name, modtime, content)
 }
 
+// carContentType is the content type of a CAR file.
+const carContentType = "application/vnd.ipld.car"
+
+// requestedFormat returns the format r asks for the path in, with the format
+// query parameter or the Accept header: "raw" for its block, "car" for its DAG
+// as a CAR file, or "" for the file or directory it holds.
+func requestedFormat(r *http.Request) string {
+	switch f := r.URL.Query().Get("format"); f {
+	case "raw", "car":
+		return f
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case accept == gwfed.RawContentType:
+		return "raw"
+	case accept == carContentType, strings.HasPrefix(accept, carContentType+";"):
+		return "car"
+	}
+	return ""
+}
+
+// serveRawBlock serves the block of p, resolved from urlPath, as is, so that
+// the client can verify it against its CID. Federated gateways fetch blocks
+// this way.
+func (i *gatewayHandler) serveRawBlock(w http.ResponseWriter, r *http.Request, p ipath.Resolved, urlPath string) {
+	etag := "\"" + p.Cid().String() + ".raw\""
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	blk, err := i.api.Block().Get(r.Context(), p)
+	if err != nil {
+		i.webError(w, "ipfs block get "+p.Cid().String(), err, http.StatusNotFound)
+		return
+	}
+
+	data, err := ioutil.ReadAll(blk)
+	if err != nil {
+		i.internalWebError(w, err)
+		return
+	}
+
+	i.addUserHeaders(w)
+	w.Header().Set("Content-Type", gwfed.RawContentType)
+	w.Header().Set("X-IPFS-Path", r.URL.Path)
+	w.Header().Set("Etag", etag)
+	if strings.HasPrefix(urlPath, ipfsPathPrefix) {
+		w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
+	}
+	// the ranges of a block are served too, though it can only be
+	// verified whole
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// serveCar serves the DAG of p, resolved from urlPath, as a CAR file, so that
+// the client can verify every block against its CID.
+func (i *gatewayHandler) serveCar(w http.ResponseWriter, r *http.Request, p ipath.Resolved, urlPath string) {
+	etag := "\"" + p.Cid().String() + ".car\""
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	i.addUserHeaders(w)
+	w.Header().Set("Content-Type", carContentType+"; version=1")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.car\"", p.Cid()))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-IPFS-Path", r.URL.Path)
+	w.Header().Set("Etag", etag)
+	if strings.HasPrefix(urlPath, ipfsPathPrefix) {
+		w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
+	}
+	if r.Method == "HEAD" {
+		return
+	}
+
+	// the errors can only be reported until the first bytes are sent
+	cw := &countingWriter{w: w}
+	err := car.Write(r.Context(), i.api.Dag(), []cid.Cid{p.Cid()}, cw)
+	if err == nil {
+		return
+	}
+	if cw.n == 0 {
+		w.Header().Del("Content-Disposition")
+		w.Header().Del("Etag")
+		w.Header().Del("Cache-Control")
+		i.webError(w, "ipfs dag export "+p.Cid().String(), err, http.StatusNotFound)
+		return
+	}
+	log.Debugf("failed to send the CAR file of %s: %s", p.Cid(), err)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
 func (i *gatewayHandler) postHandler(w http.ResponseWriter, r *http.Request) {
 	p, err := i.api.Unixfs().Add(r.Context(), files.NewReaderFile(r.Body))
 	if err != nil {
-		internalWebError(w, err)
+		i.internalWebError(w, err)
 		return
 	}
 
@@ -439,7 +644,7 @@ func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse the path
 	rootCid, newPath, err := parseIpfsPath(r.URL.Path)
 	if err != nil {
-		webError(w, "WritableGateway: failed to parse the path", err, http.StatusBadRequest)
+		i.webError(w, "WritableGateway: failed to parse the path", err, http.StatusBadRequest)
 		return
 	}
 	if newPath == "" || newPath == "/" {
@@ -452,26 +657,26 @@ func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
 
 	rnode, err := ds.Get(ctx, rootCid)
 	if err != nil {
-		webError(w, "WritableGateway: Could not create DAG from request", err, http.StatusInternalServerError)
+		i.webError(w, "WritableGateway: Could not create DAG from request", err, http.StatusInternalServerError)
 		return
 	}
 
 	pbnd, ok := rnode.(*dag.ProtoNode)
 	if !ok {
-		webError(w, "Cannot read non protobuf nodes through gateway", dag.ErrNotProtobuf, http.StatusBadRequest)
+		i.webError(w, "Cannot read non protobuf nodes through gateway", dag.ErrNotProtobuf, http.StatusBadRequest)
 		return
 	}
 
 	// Create the new file.
 	newFilePath, err := i.api.Unixfs().Add(ctx, files.NewReaderFile(r.Body))
 	if err != nil {
-		webError(w, "WritableGateway: could not create DAG from request", err, http.StatusInternalServerError)
+		i.webError(w, "WritableGateway: could not create DAG from request", err, http.StatusInternalServerError)
 		return
 	}
 
 	newFile, err := ds.Get(ctx, newFilePath.Cid())
 	if err != nil {
-		webError(w, "WritableGateway: failed to resolve new file", err, http.StatusInternalServerError)
+		i.webError(w, "WritableGateway: failed to resolve new file", err, http.StatusInternalServerError)
 		return
 	}
 
@@ -479,20 +684,20 @@ func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
 
 	root, err := mfs.NewRoot(ctx, ds, pbnd, nil)
 	if err != nil {
-		webError(w, "WritableGateway: failed to create MFS root", err, http.StatusBadRequest)
+		i.webError(w, "WritableGateway: failed to create MFS root", err, http.StatusBadRequest)
 		return
 	}
 
 	if newDirectory != "" {
 		err := mfs.Mkdir(root, newDirectory, mfs.MkdirOpts{Mkparents: true, Flush: false})
 		if err != nil {
-			webError(w, "WritableGateway: failed to create MFS directory", err, http.StatusInternalServerError)
+			i.webError(w, "WritableGateway: failed to create MFS directory", err, http.StatusInternalServerError)
 			return
 		}
 	}
 	dirNode, err := mfs.Lookup(root, newDirectory)
 	if err != nil {
-		webError(w, "WritableGateway: failed to lookup directory", err, http.StatusInternalServerError)
+		i.webError(w, "WritableGateway: failed to lookup directory", err, http.StatusInternalServerError)
 		return
 	}
 	dir, ok := dirNode.(*mfs.Directory)
@@ -504,17 +709,17 @@ func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
 	switch err {
 	case os.ErrNotExist, nil:
 	default:
-		webError(w, "WritableGateway: failed to replace existing file", err, http.StatusBadRequest)
+		i.webError(w, "WritableGateway: failed to replace existing file", err, http.StatusBadRequest)
 		return
 	}
 	err = dir.AddChild(newFileName, newFile)
 	if err != nil {
-		webError(w, "WritableGateway: failed to link file into directory", err, http.StatusInternalServerError)
+		i.webError(w, "WritableGateway: failed to link file into directory", err, http.StatusInternalServerError)
 		return
 	}
 	nnode, err := root.GetDirectory().GetNode()
 	if err != nil {
-		webError(w, "WritableGateway: failed to finalize", err, http.StatusInternalServerError)
+		i.webError(w, "WritableGateway: failed to finalize", err, http.StatusInternalServerError)
 		return
 	}
 	newcid := nnode.Cid()
@@ -531,7 +736,7 @@ func (i *gatewayHandler) deleteHandler(w http.ResponseWriter, r *http.Request) {
 
 	rootCid, newPath, err := parseIpfsPath(r.URL.Path)
 	if err != nil {
-		webError(w, "WritableGateway: failed to parse the path", err, http.StatusBadRequest)
+		i.webError(w, "WritableGateway: failed to parse the path", err, http.StatusBadRequest)
 		return
 	}
 	if newPath == "" || newPath == "/" {
@@ -544,7 +749,7 @@ func (i *gatewayHandler) deleteHandler(w http.ResponseWriter, r *http.Request) {
 
 	rootNodeIPLD, err := i.api.Dag().Get(ctx, rootCid)
 	if err != nil {
-		webError(w, "WritableGateway: failed to resolve root CID", err, http.StatusInternalServerError)
+		i.webError(w, "WritableGateway: failed to resolve root CID", err, http.StatusInternalServerError)
 		return
 	}
 	rootNode, ok := rootNodeIPLD.(*dag.ProtoNode)
@@ -557,7 +762,7 @@ func (i *gatewayHandler) deleteHandler(w http.ResponseWriter, r *http.Request) {
 
 	root, err := mfs.NewRoot(ctx, i.api.Dag(), rootNode, nil)
 	if err != nil {
-		webError(w, "WritableGateway: failed to construct the MFS root", err, http.StatusBadRequest)
+		i.webError(w, "WritableGateway: failed to construct the MFS root", err, http.StatusBadRequest)
 		return
 	}
 
@@ -565,7 +770,7 @@ func (i *gatewayHandler) deleteHandler(w http.ResponseWriter, r *http.Request) {
 
 	parentNode, err := mfs.Lookup(root, directory)
 	if err != nil {
-		webError(w, "WritableGateway: failed to look up parent", err, http.StatusInternalServerError)
+		i.webError(w, "WritableGateway: failed to look up parent", err, http.StatusInternalServerError)
 		return
 	}
 
@@ -580,13 +785,13 @@ func (i *gatewayHandler) deleteHandler(w http.ResponseWriter, r *http.Request) {
 	switch parent.Unlink(filename) {
 	case nil, os.ErrNotExist:
 	default:
-		webError(w, "WritableGateway: failed to remove file", err, http.StatusInternalServerError)
+		i.webError(w, "WritableGateway: failed to remove file", err, http.StatusInternalServerError)
 		return
 	}
 
 	nnode, err := root.GetDirectory().GetNode()
 	if err != nil {
-		webError(w, "WritableGateway: failed to finalize", err, http.StatusInternalServerError)
+		i.webError(w, "WritableGateway: failed to finalize", err, http.StatusInternalServerError)
 	}
 	ncid := nnode.Cid()
 
@@ -597,33 +802,43 @@ func (i *gatewayHandler) deleteHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (i *gatewayHandler) addUserHeaders(w http.ResponseWriter) {
-	for k, v := range i.config.Headers {
+	for k, v := range i.headers.Load().(map[string][]string) {
 		w.Header()[k] = v
 	}
 }
 
-func webError(w http.ResponseWriter, message string, err error, defaultCode int) {
+// notReplicated answers a request for content a read replica doesn't have
+// yet, asking the client to retry after the next sync with the primary.
+func (i *gatewayHandler) notReplicated(w http.ResponseWriter, escapedURLPath string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(i.config.Replica.Interval().Seconds())))
+	http.Error(w, fmt.Sprintf("%s: not replicated yet", escapedURLPath), http.StatusServiceUnavailable)
+}
+
+func (i *gatewayHandler) webError(w http.ResponseWriter, message string, err error, defaultCode int) {
 	if _, ok := err.(resolver.ErrNoLink); ok {
-		webErrorWithCode(w, message, err, http.StatusNotFound)
+		i.webErrorWithCode(w, message, err, http.StatusNotFound)
 	} else if err == routing.ErrNotFound {
-		webErrorWithCode(w, message, err, http.StatusNotFound)
+		i.webErrorWithCode(w, message, err, http.StatusNotFound)
 	} else if err == context.DeadlineExceeded {
-		webErrorWithCode(w, message, err, http.StatusRequestTimeout)
+		i.webErrorWithCode(w, message, err, http.StatusRequestTimeout)
 	} else {
-		webErrorWithCode(w, message, err, defaultCode)
+		i.webErrorWithCode(w, message, err, defaultCode)
 	}
 }
 
-func webErrorWithCode(w http.ResponseWriter, message string, err error, code int) {
-	http.Error(w, fmt.Sprintf("%s: %s", message, err), code)
+func (i *gatewayHandler) webErrorWithCode(w http.ResponseWriter, message string, err error, code int) {
+	message = fmt.Sprintf("%s: %s", message, err)
+	if i.config.ErrorTemplate == nil || !i.writeErrorPage(w, message, code) {
+		http.Error(w, message, code)
+	}
 	if code >= 500 {
-		log.Warningf("server error: %s: %s", err)
+		log.Warningf("server error: %s", message)
 	}
 }
 
 // return a 500 error and log
-func internalWebError(w http.ResponseWriter, err error) {
-	webErrorWithCode(w, "internalWebError", err, http.StatusInternalServerError)
+func (i *gatewayHandler) internalWebError(w http.ResponseWriter, err error) {
+	i.webErrorWithCode(w, "internalWebError", err, http.StatusInternalServerError)
 }
 
 func getFilename(s string) string {
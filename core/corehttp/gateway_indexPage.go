@@ -15,15 +15,38 @@ type listingTemplateData struct {
 	Path     string
 	BackLink string
 	Hash     string
+
+	// CSS is the stylesheet of Gateway.Templates.CSS.
+	CSS template.CSS
+
+	// Page is the page listed, from 1, out of Pages. PrevLink and NextLink
+	// link to the pages around it, if any.
+	Page     int
+	Pages    int
+	PrevLink string
+	NextLink string
 }
 
 type directoryItem struct {
 	Size string
 	Name string
 	Path string
+	Cid  string
 }
 
-var listingTemplate *template.Template
+// listingPagination is added to the default listing template, after the table
+// of the entries.
+const listingPagination = `{{if gt .Pages 1}}<div class="panel-footer">` +
+	`{{with .PrevLink}}<a href="{{.}}">&laquo; previous</a> {{end}}` +
+	`page {{.Page}} of {{.Pages}}` +
+	`{{with .NextLink}} <a href="{{.}}">next &raquo;</a>{{end}}</div>{{end}}`
+
+var (
+	listingTemplate *template.Template
+
+	// listingFuncs are the functions available to the listing templates.
+	listingFuncs template.FuncMap
+)
 
 func init() {
 	knownIconsBytes, err := assets.Asset("dir-index-html/knownIcons.txt")
@@ -58,8 +81,15 @@ func init() {
 		panic(err)
 	}
 
-	listingTemplate = template.Must(template.New("dir").Funcs(template.FuncMap{
+	listingFuncs = template.FuncMap{
 		"iconFromExt": iconFromExt,
 		"urlEscape":   urlEscape,
-	}).Parse(string(dirIndexBytes)))
+	}
+
+	// the default template includes the configured stylesheet, if any, and
+	// links to the other pages of the listing
+	dirIndex := strings.Replace(string(dirIndexBytes), "</head>",
+		"{{with .CSS}}<style>{{.}}</style>{{end}}</head>", 1)
+	dirIndex = strings.Replace(dirIndex, "</table>", "</table>"+listingPagination, 1)
+	listingTemplate = template.Must(template.New("dir").Funcs(listingFuncs).Parse(dirIndex))
 }
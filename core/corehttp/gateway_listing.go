@@ -0,0 +1,193 @@
+package corehttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	files "github.com/ipfs/go-ipfs-files"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// defaultListingLimit is the number of entries on a page of a directory
+// listing, unless the request sets another with the limit query parameter.
+const defaultListingLimit = 1000
+
+// jsonContentType is the content type of the JSON directory listings.
+const jsonContentType = "application/json"
+
+// listingEntry is an entry of a directory listing.
+type listingEntry struct {
+	Name string
+	Cid  string
+	Size uint64
+	Type string
+}
+
+// jsonListing is the JSON form of a directory listing.
+type jsonListing struct {
+	Path    string
+	Cid     string
+	Entries []listingEntry
+
+	// Total is the number of entries of the directory, over all the pages.
+	Total int
+	Page  int
+	Pages int
+}
+
+// listingOptions are the query parameters of a directory listing:
+//
+//	sort=name|size  the order of the entries, by name by default
+//	order=asc|desc  ascending by default
+//	page=N          the page to list, from 1
+//	limit=N         the number of entries per page
+type listingOptions struct {
+	sort  string
+	desc  bool
+	page  int
+	limit int
+}
+
+// parseListingOptions parses the query parameters of a directory listing.
+func parseListingOptions(q url.Values) (listingOptions, error) {
+	opts := listingOptions{sort: "name", page: 1, limit: defaultListingLimit}
+	switch s := q.Get("sort"); s {
+	case "", "name":
+	case "size":
+		opts.sort = s
+	default:
+		return opts, fmt.Errorf("invalid sort %q, expected name or size", s)
+	}
+	switch o := q.Get("order"); o {
+	case "", "asc":
+	case "desc":
+		opts.desc = true
+	default:
+		return opts, fmt.Errorf("invalid order %q, expected asc or desc", o)
+	}
+	for name, v := range map[string]*int{"page": &opts.page, "limit": &opts.limit} {
+		s := q.Get(name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return opts, fmt.Errorf("invalid %s %q, expected a positive integer", name, s)
+		}
+		*v = n
+	}
+	return opts, nil
+}
+
+// wantsJSONListing returns whether r asks for the JSON form of a directory
+// listing, with ?format=json or the Accept header.
+func wantsJSONListing(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return accept == jsonContentType || strings.HasPrefix(accept, jsonContentType+";")
+}
+
+// listDirectory returns the entries of the directory p, with their sizes.
+func (i *gatewayHandler) listDirectory(ctx context.Context, p ipath.Resolved) ([]listingEntry, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	links, err := i.api.Unixfs().Ls(ctx, p, options.Unixfs.ResolveChildren(false))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []listingEntry
+	for l := range links {
+		if l.Err != nil {
+			return nil, l.Err
+		}
+		e := listingEntry{Name: l.Name, Cid: l.Cid.String()}
+		nd, err := i.api.Unixfs().Get(ctx, ipath.IpfsPath(l.Cid))
+		if err != nil {
+			return nil, err
+		}
+		s, err := nd.Size()
+		nd.Close()
+		if err != nil {
+			return nil, err
+		}
+		e.Size = uint64(s)
+		switch nd.(type) {
+		case files.Directory:
+			e.Type = "directory"
+		case *files.Symlink:
+			e.Type = "symlink"
+		default:
+			e.Type = "file"
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// sortListing sorts the entries as opts asks.
+func sortListing(entries []listingEntry, opts listingOptions) {
+	less := func(a, b listingEntry) bool {
+		if opts.sort == "size" && a.Size != b.Size {
+			return a.Size < b.Size
+		}
+		return a.Name < b.Name
+	}
+	sort.SliceStable(entries, func(x, y int) bool {
+		if opts.desc {
+			return less(entries[y], entries[x])
+		}
+		return less(entries[x], entries[y])
+	})
+}
+
+// listingPage returns the entries of the page opts asks for, and the number
+// of pages.
+func listingPage(entries []listingEntry, opts listingOptions) ([]listingEntry, int, error) {
+	pages := (len(entries) + opts.limit - 1) / opts.limit
+	if pages == 0 {
+		pages = 1
+	}
+	if opts.page > pages {
+		return nil, pages, fmt.Errorf("page %d out of range, the listing has %d", opts.page, pages)
+	}
+	start := (opts.page - 1) * opts.limit
+	end := start + opts.limit
+	if end > len(entries) {
+		end = len(entries)
+	}
+	return entries[start:end], pages, nil
+}
+
+// pageLink returns the link to the page n of the listing requested by r, or ""
+// if there is no such page.
+func pageLink(r *http.Request, n int, pages int) string {
+	if n < 1 || n > pages {
+		return ""
+	}
+	q := r.URL.Query()
+	q.Set("page", strconv.Itoa(n))
+	return "?" + q.Encode()
+}
+
+// serveJSONListing writes the JSON form of a directory listing.
+func serveJSONListing(w http.ResponseWriter, l *jsonListing) {
+	if l.Entries == nil {
+		l.Entries = []listingEntry{}
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if err := json.NewEncoder(w).Encode(l); err != nil {
+		log.Warningf("writing the listing of %s: %s", l.Path, err)
+	}
+}
@@ -0,0 +1,148 @@
+package corehttp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// GatewayTemplatesConfigKey is the config key of the templates replacing the
+// pages of the gateway.
+const GatewayTemplatesConfigKey = "Gateway.Templates"
+
+// maxTemplateSize caps the size of a template or stylesheet.
+const maxTemplateSize = 1 << 20
+
+// templateFetchTimeout is how long the templates stored in IPFS are searched
+// for when the gateway starts.
+const templateFetchTimeout = time.Minute
+
+// GatewayTemplates holds the Gateway.Templates config section. Each field is
+// either the path of a local file, or an IPFS path (a CID, /ipfs/<cid>/... or
+// /ipns/<name>/...), read when the gateway starts.
+type GatewayTemplates struct {
+	// DirectoryListing is an html/template replacing the directory
+	// listings. It is executed with the same data and functions as the
+	// default one.
+	DirectoryListing string
+
+	// Error is an html/template replacing the plain text error pages. It is
+	// executed with an errorTemplateData.
+	Error string
+
+	// CSS is a stylesheet included in the default directory listing, and
+	// passed to the templates as .CSS.
+	CSS string
+}
+
+// errorTemplateData is the data of the error templates.
+type errorTemplateData struct {
+	Status     int
+	StatusText string
+	Message    string
+	CSS        template.CSS
+}
+
+// loadGatewayTemplates reads the templates of cfg into c.
+func loadGatewayTemplates(ctx context.Context, api coreiface.CoreAPI, cfg GatewayTemplates, c *GatewayConfig) error {
+	ctx, cancel := context.WithTimeout(ctx, templateFetchTimeout)
+	defer cancel()
+
+	if cfg.DirectoryListing != "" {
+		src, err := readTemplateSource(ctx, api, cfg.DirectoryListing)
+		if err != nil {
+			return fmt.Errorf("%s.DirectoryListing: %s", GatewayTemplatesConfigKey, err)
+		}
+		c.ListingTemplate, err = template.New("dir").Funcs(listingFuncs).Parse(string(src))
+		if err != nil {
+			return fmt.Errorf("%s.DirectoryListing: %s", GatewayTemplatesConfigKey, err)
+		}
+	}
+	if cfg.Error != "" {
+		src, err := readTemplateSource(ctx, api, cfg.Error)
+		if err != nil {
+			return fmt.Errorf("%s.Error: %s", GatewayTemplatesConfigKey, err)
+		}
+		c.ErrorTemplate, err = template.New("error").Parse(string(src))
+		if err != nil {
+			return fmt.Errorf("%s.Error: %s", GatewayTemplatesConfigKey, err)
+		}
+	}
+	if cfg.CSS != "" {
+		src, err := readTemplateSource(ctx, api, cfg.CSS)
+		if err != nil {
+			return fmt.Errorf("%s.CSS: %s", GatewayTemplatesConfigKey, err)
+		}
+		c.CSS = template.CSS(src)
+	}
+	return nil
+}
+
+// readTemplateSource reads the file at src, an IPFS path or a local path.
+func readTemplateSource(ctx context.Context, api coreiface.CoreAPI, src string) ([]byte, error) {
+	var r io.Reader
+	if _, err := cid.Decode(src); err == nil {
+		src = ipfsPathPrefix + src
+	}
+	if strings.HasPrefix(src, ipfsPathPrefix) || strings.HasPrefix(src, ipnsPathPrefix) {
+		nd, err := api.Unixfs().Get(ctx, ipath.New(src))
+		if err != nil {
+			return nil, err
+		}
+		defer nd.Close()
+		f, ok := nd.(files.File)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a file", src)
+		}
+		r = f
+	} else {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxTemplateSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxTemplateSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", src, maxTemplateSize)
+	}
+	return b, nil
+}
+
+// writeErrorPage renders the error template, and returns false if it failed.
+func (i *gatewayHandler) writeErrorPage(w http.ResponseWriter, message string, code int) bool {
+	var buf bytes.Buffer
+	err := i.config.ErrorTemplate.Execute(&buf, errorTemplateData{
+		Status:     code,
+		StatusText: http.StatusText(code),
+		Message:    message,
+		CSS:        i.config.CSS,
+	})
+	if err != nil {
+		log.Errorf("executing the error template: %s", err)
+		return false
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	w.Write(buf.Bytes())
+	return true
+}
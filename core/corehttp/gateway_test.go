@@ -1,30 +1,44 @@
 package corehttp
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	version "github.com/ipfs/go-ipfs"
 	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/car"
 	"github.com/ipfs/go-ipfs/core/coreapi"
+	pathnorm "github.com/ipfs/go-ipfs/core/pathnorm"
 	namesys "github.com/ipfs/go-ipfs/namesys"
 	repo "github.com/ipfs/go-ipfs/repo"
 
+	cid "github.com/ipfs/go-cid"
 	datastore "github.com/ipfs/go-datastore"
 	syncds "github.com/ipfs/go-datastore/sync"
 	config "github.com/ipfs/go-ipfs-config"
 	files "github.com/ipfs/go-ipfs-files"
+	dag "github.com/ipfs/go-merkledag"
 	path "github.com/ipfs/go-path"
 	iface "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
 	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	ipath "github.com/ipfs/interface-go-ipfs-core/path"
 	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
 	id "github.com/libp2p/go-libp2p/p2p/protocol/identify"
 )
 
@@ -581,6 +595,595 @@ func TestGoGetSupport(t *testing.T) {
 	}
 }
 
+func TestGatewayTemplates(t *testing.T) {
+	n, err := newNodeWithMockNamesys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := n.Context()
+
+	dir, err := ioutil.TempDir("", "gateway-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	listing := filepath.Join(dir, "listing.html")
+	err = ioutil.WriteFile(listing, []byte(`<style>{{.CSS}}</style>{{range .Listing}}[{{.Name}}]{{end}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorPage := filepath.Join(dir, "error.html")
+	err = ioutil.WriteFile(errorPage, []byte(`<h1>{{.Status}} {{.StatusText}}</h1><p>{{.Message}}</p>`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	css, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("body{color:red}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg GatewayConfig
+	err = loadGatewayTemplates(ctx, api, GatewayTemplates{
+		DirectoryListing: listing,
+		Error:            errorPage,
+		CSS:              css.Cid().String(),
+	}, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := newGatewayHandler(cfg, api)
+
+	k, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"a.txt": files.NewBytesFile([]byte("a")),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	gw.ServeHTTP(w, httptest.NewRequest("GET", k.String()+"/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if body := w.Body.String(); body != "<style>body{color:red}</style>[a.txt]" {
+		t.Fatalf("unexpected directory listing: %q", body)
+	}
+
+	w = httptest.NewRecorder()
+	gw.ServeHTTP(w, httptest.NewRequest("GET", k.String()+"/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Fatalf("expected an html error page, got %s", ct)
+	}
+	if body := w.Body.String(); !strings.HasPrefix(body, "<h1>404 Not Found</h1><p>ipfs resolve -r ") {
+		t.Fatalf("unexpected error page: %q", body)
+	}
+
+	err = loadGatewayTemplates(ctx, api, GatewayTemplates{
+		Error: filepath.Join(dir, "nonexistent.html"),
+	}, &cfg)
+	if err == nil {
+		t.Fatal("expected an error for a missing template")
+	}
+}
+
+func TestGatewayFormats(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+	defer ts.Close()
+
+	k, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"a.txt": files.NewBytesFile([]byte("a")),
+		"b.txt": files.NewBytesFile([]byte("b")),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := api.ResolvePath(ctx, ipath.Join(k, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string, accept string) *http.Response {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	for _, res := range []*http.Response{
+		get(k.String()+"?format=car", ""),
+		get(k.String(), "application/vnd.ipld.car; version=1"),
+	} {
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", res.StatusCode)
+		}
+		if ct := res.Header.Get("Content-Type"); ct != "application/vnd.ipld.car; version=1" {
+			t.Fatalf("unexpected content type %s", ct)
+		}
+		if etag := res.Header.Get("Etag"); etag != "\""+k.Cid().String()+".car\"" {
+			t.Fatalf("unexpected etag %s", etag)
+		}
+		cr, err := car.NewReader(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cr.Header.Roots) != 1 || !cr.Header.Roots[0].Equals(k.Cid()) {
+			t.Fatalf("unexpected roots %v", cr.Header.Roots)
+		}
+		n := 0
+		for ; ; n++ {
+			_, err := cr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		res.Body.Close()
+		if n != 3 {
+			t.Fatalf("expected the directory and its two files, got %d blocks", n)
+		}
+	}
+
+	res := get(k.String()+"/a.txt?format=raw", "")
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/vnd.ipld.raw" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+	if sum, err := file.Cid().Prefix().Sum(body); err != nil || !sum.Equals(file.Cid()) {
+		t.Fatalf("expected the block of %s (%v)", file.Cid(), err)
+	}
+
+	// the content of an IPNS name may change
+	ns["/ipns/example.net"] = path.FromString(k.String())
+	for p, immutable := range map[string]bool{
+		k.String() + "?format=car":           true,
+		k.String() + "/a.txt?format=raw":     true,
+		"/ipns/example.net?format=car":       false,
+		"/ipns/example.net/a.txt?format=raw": false,
+	} {
+		res := get(p, "")
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", p, res.StatusCode)
+		}
+		if cc := res.Header.Get("Cache-Control"); strings.Contains(cc, "immutable") != immutable {
+			t.Errorf("%s: unexpected Cache-Control %q", p, cc)
+		}
+	}
+
+	req, err := http.NewRequest("GET", ts.URL+k.String()+"?format=car", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-None-Match", "\""+k.Cid().String()+".car\"")
+	if res, err := doWithoutRedirect(req); err != nil || res.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304 (%v)", err)
+	}
+}
+
+func TestGatewayListing(t *testing.T) {
+	ts, api, ctx := newTestServerAndNode(t, nil)
+	defer ts.Close()
+
+	k, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"a.txt": files.NewBytesFile([]byte("aaa")),
+		"b.txt": files.NewBytesFile([]byte("b")),
+		"c.txt": files.NewBytesFile([]byte("cc")),
+		"index": files.NewMapDirectory(map[string]files.Node{}),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := api.ResolvePath(ctx, ipath.Join(k, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(query string, accept string) (*http.Response, *jsonListing) {
+		req, err := http.NewRequest("GET", ts.URL+k.String()+"/"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/json" {
+			return res, nil
+		}
+		var l jsonListing
+		if err := json.NewDecoder(res.Body).Decode(&l); err != nil {
+			t.Fatal(err)
+		}
+		return res, &l
+	}
+	names := func(l *jsonListing) string {
+		var out []string
+		for _, e := range l.Entries {
+			out = append(out, e.Name)
+		}
+		return strings.Join(out, " ")
+	}
+
+	_, l := list("", "application/json")
+	if l == nil {
+		t.Fatal("expected a JSON listing")
+	}
+	if l.Cid != k.Cid().String() || l.Total != 4 || l.Page != 1 || l.Pages != 1 {
+		t.Fatalf("unexpected listing: %+v", l)
+	}
+	if e := l.Entries[0]; e.Name != "a.txt" || e.Cid != a.Cid().String() || e.Size != 3 || e.Type != "file" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+	if e := l.Entries[3]; e.Name != "index" || e.Type != "directory" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+
+	for query, expected := range map[string]string{
+		"?format=json&order=desc":                          "index c.txt b.txt a.txt",
+		"?format=json&sort=size":                           "b.txt c.txt a.txt index",
+		"?format=json&sort=size&order=desc&limit=2":        "index a.txt",
+		"?format=json&sort=size&order=desc&limit=3&page=2": "b.txt",
+	} {
+		_, l := list(query, "")
+		if l == nil {
+			t.Fatalf("expected a JSON listing for %s", query)
+		}
+		if got := names(l); got != expected {
+			t.Errorf("listed %q for %s, expected %q", got, query, expected)
+		}
+	}
+
+	for _, query := range []string{"?sort=date", "?order=up", "?page=0", "?limit=x", "?limit=2&page=3"} {
+		if res, _ := list(query, ""); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", query, res.StatusCode)
+		}
+	}
+
+	req, err := http.NewRequest("GET", ts.URL+k.String()+"/?limit=2&page=2&sort=size", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := doWithoutRedirect(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(body)
+	if !strings.Contains(s, "page 2 of 2") || !strings.Contains(s, `href="?limit=2&amp;page=1&amp;sort=size"`) {
+		t.Fatalf("expected a link to the previous page:\n%s", s)
+	}
+	if !strings.Contains(s, "a.txt") || strings.Contains(s, "b.txt") {
+		t.Fatalf("expected the second page only:\n%s", s)
+	}
+}
+
+func TestGatewayACL(t *testing.T) {
+	ns := mockNamesys{}
+	n, err := newNodeWithMockNamesys(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := n.Context()
+
+	add := func(data string) ipath.Resolved {
+		k, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+			"public":  files.NewBytesFile([]byte(data)),
+			"private": files.NewBytesFile([]byte(data)),
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	open, secret, other := add("open"), add("secret"), add("other")
+	openV1 := cid.NewCidV1(open.Cid().Type(), open.Cid().Hash())
+
+	nested, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"readme": files.NewBytesFile([]byte("readme")),
+		"inner": files.NewMapDirectory(map[string]files.Node{
+			"file": files.NewBytesFile([]byte("inner")),
+		}),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := api.ResolvePath(ctx, ipath.Join(nested, "inner"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/inner.example.net"] = path.FromString(inner.String())
+
+	aclCfg := GatewayACL{
+		Default: "deny",
+		Rules: []GatewayACLRule{
+			{Action: "deny", Path: open.String() + "/private"},
+			{Action: "allow", Cid: open.Cid().String()},
+			{Action: "allow", Cid: secret.Cid().String(), Tokens: []string{"t0ken"}},
+			{Action: "allow", Name: "example.net"},
+			{Action: "deny", Cid: inner.Cid().String()},
+			{Action: "allow", Cid: nested.Cid().String()},
+			{Action: "allow", Name: "inner.example.net"},
+		},
+	}
+	acl, err := newGatewayACL(aclCfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := newGatewayHandler(GatewayConfig{ACL: acl}, api)
+
+	for _, test := range []struct {
+		path  string
+		token string
+		code  int
+	}{
+		{open.String() + "/public", "", http.StatusOK},
+		{"/ipfs/" + openV1.String() + "/public", "", http.StatusOK},
+		{open.String() + "/private", "", http.StatusForbidden},
+		{open.String() + "/./private", "", http.StatusForbidden},
+		{secret.String() + "/public", "", http.StatusUnauthorized},
+		{secret.String() + "/public", "wrong", http.StatusUnauthorized},
+		{secret.String() + "/private", "t0ken", http.StatusOK},
+		{other.String() + "/public", "t0ken", http.StatusForbidden},
+		{"/ipns/example.org/public", "", http.StatusForbidden},
+		{nested.String() + "/readme", "", http.StatusOK},
+		// the denied CID, reached through its parent or an IPNS name
+		{nested.String() + "/inner/file", "", http.StatusForbidden},
+		{"/ipns/inner.example.net/file", "", http.StatusForbidden},
+		// the CAR files of a parent hold the denied nodes
+		{nested.String() + "/readme?format=car", "", http.StatusOK},
+		{nested.String() + "?format=car", "", http.StatusForbidden},
+		{open.String() + "?format=car", "", http.StatusForbidden},
+		{secret.String() + "?format=car", "t0ken", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", test.path, nil)
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s: expected %d, got %d: %s", test.path, test.code, w.Code, w.Body)
+		}
+		if test.code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate header", test.path)
+		}
+	}
+
+	// the denied path, reached through a name that only matches once
+	// normalized
+	norm, err := pathnorm.New("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl, err = newGatewayACL(aclCfg, norm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw = newGatewayHandler(GatewayConfig{ACL: acl, Normalizer: norm}, api)
+	for p, code := range map[string]int{
+		open.String() + "/PUBLIC":  http.StatusOK,
+		open.String() + "/PRIVATE": http.StatusForbidden,
+	} {
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, httptest.NewRequest("GET", p, nil))
+		if w.Code != code {
+			t.Errorf("%s: expected %d, got %d: %s", p, code, w.Code, w.Body)
+		}
+	}
+
+	for _, bad := range []GatewayACL{
+		{Default: "maybe"},
+		{Rules: []GatewayACLRule{{Action: "allow"}}},
+		{Rules: []GatewayACLRule{{Action: "allow", Cid: "notacid"}}},
+		{Rules: []GatewayACLRule{{Action: "deny", Name: "example.net", Tokens: []string{"t"}}}},
+		{Rules: []GatewayACLRule{{Action: "allow", Cid: open.Cid().String(), Name: "example.net"}}},
+	} {
+		if _, err := newGatewayACL(bad, nil); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+}
+
+func TestPublicGateways(t *testing.T) {
+	ns := mockNamesys{}
+	n, err := newNodeWithMockNamesys(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := api.Unixfs().Add(n.Context(), files.NewMapDirectory(map[string]files.Node{
+		"file.txt": files.NewBytesFile([]byte("fnord")),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kV1 := cid.NewCidV1(k.Cid().Type(), k.Cid().Hash())
+
+	pid := "QmTFauExutTsy4XP6JbMFcw2Wa9645HJt2bTqL6qYDCKfe"
+	p, err := peer.Decode(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pidV1 := cid.NewCidV1(libp2pKeyCodec, []byte(p))
+	ns["/ipns/"+pid] = path.FromString(k.String())
+	ns["/ipns/dnslink.example.net"] = path.FromString(k.String())
+
+	gw := newGatewayHandler(GatewayConfig{}, api)
+	mux := http.NewServeMux()
+	mux.Handle("/ipfs/", gw)
+	mux.Handle("/ipns/", gw)
+	h := newHostnameHandler(n, publicGateways{
+		"gw.example.com":    {Paths: []string{"/ipfs", "/ipns"}, UseSubdomains: true},
+		"paths.example.com": {Paths: []string{"/ipfs"}, NoDNSLink: true},
+	}, mux)
+
+	for _, test := range []struct {
+		url      string
+		code     int
+		location string
+	}{
+		// path-style requests are redirected to the subdomains
+		{"http://gw.example.com" + k.String() + "/file.txt?a=b", http.StatusMovedPermanently, "http://" + kV1.String() + ".ipfs.gw.example.com/file.txt?a=b"},
+		{"http://gw.example.com/ipns/" + pid + "/file.txt", http.StatusMovedPermanently, "http://" + pidV1.String() + ".ipns.gw.example.com/file.txt"},
+		{"http://gw.example.com/ipns/dnslink.example.net/file.txt", http.StatusOK, ""},
+		{"http://gw.example.com/api/v0/id", http.StatusNotFound, ""},
+		{"http://" + kV1.String() + ".ipfs.gw.example.com/file.txt", http.StatusOK, ""},
+		{"http://" + pidV1.String() + ".ipns.gw.example.com/file.txt", http.StatusOK, ""},
+		{"http://notacid.ipfs.gw.example.com/file.txt", http.StatusBadRequest, ""},
+
+		// the gateways without subdomains only serve their paths
+		{"http://paths.example.com" + k.String() + "/file.txt", http.StatusOK, ""},
+		{"http://paths.example.com/ipns/" + pid + "/file.txt", http.StatusNotFound, ""},
+		{"http://" + kV1.String() + ".ipfs.paths.example.com/file.txt", http.StatusNotFound, ""},
+
+		// the other hostnames serve their DNSLink
+		{"http://dnslink.example.net/file.txt", http.StatusOK, ""},
+	} {
+		req := httptest.NewRequest("GET", test.url, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s: expected %d, got %d: %s", test.url, test.code, w.Code, w.Body)
+			continue
+		}
+		if loc := w.Header().Get("Location"); loc != test.location {
+			t.Errorf("%s: expected the location %q, got %q", test.url, test.location, loc)
+		}
+		if test.code == http.StatusOK && w.Body.String() != "fnord" {
+			t.Errorf("%s: unexpected body %q", test.url, w.Body)
+		}
+	}
+}
+
+func TestGatewayRange(t *testing.T) {
+	n, err := newNodeWithMockNamesys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 10240)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	// spread over 10 blocks
+	k, err := api.Unixfs().Add(n.Context(), files.NewBytesFile(data), options.Unixfs.Chunker("size-1024"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := newGatewayHandler(GatewayConfig{}, api)
+
+	get := func(p, ranges string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", p, nil)
+		req.Header.Set("Range", ranges)
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, test := range []struct {
+		ranges       string
+		start, end   int
+		contentRange string
+	}{
+		{"bytes=2048-3071", 2048, 3072, "bytes 2048-3071/10240"},
+		{"bytes=9000-", 9000, 10240, "bytes 9000-10239/10240"},
+		{"bytes=-10", 10230, 10240, "bytes 10230-10239/10240"},
+	} {
+		w := get(k.String(), test.ranges)
+		if w.Code != http.StatusPartialContent {
+			t.Fatalf("%s: expected 206, got %d: %s", test.ranges, w.Code, w.Body)
+		}
+		if cr := w.Header().Get("Content-Range"); cr != test.contentRange {
+			t.Errorf("%s: expected the range %q, got %q", test.ranges, test.contentRange, cr)
+		}
+		if !bytes.Equal(w.Body.Bytes(), data[test.start:test.end]) {
+			t.Errorf("%s: unexpected body", test.ranges)
+		}
+	}
+
+	// several ranges are served as multipart/byteranges
+	w := get(k.String(), "bytes=0-9,5000-5009")
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("expected 206, got %d: %s", w.Code, w.Body)
+	}
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("expected a multipart/byteranges response, got %q (%v)", w.Header().Get("Content-Type"), err)
+	}
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	for _, start := range []int{0, 5000} {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf("bytes %d-%d/10240", start, start+9)
+		if cr := part.Header.Get("Content-Range"); cr != expected {
+			t.Errorf("expected the part %q, got %q", expected, cr)
+		}
+		body, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(body, data[start:start+10]) {
+			t.Errorf("unexpected body for the part %q", expected)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Fatalf("expected two parts, got %v", err)
+	}
+
+	// as are the ranges of a raw block
+	leaf := dag.NodeWithData([]byte("raw block"))
+	if err := api.Dag().Add(n.Context(), leaf); err != nil {
+		t.Fatal(err)
+	}
+	w = get("/ipfs/"+leaf.Cid().String()+"?format=raw", "bytes=0-3")
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), leaf.RawData()[:4]) {
+		t.Fatalf("expected the first 4 bytes of the block, got %d: %q", w.Code, w.Body)
+	}
+}
+
 func TestVersion(t *testing.T) {
 	version.CurrentCommit = "theshortcommithash"
 
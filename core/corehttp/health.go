@@ -0,0 +1,112 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	core "github.com/ipfs/go-ipfs/core"
+)
+
+// Readiness is the answer of the readiness endpoint: whether the node is
+// ready, and the result of each of its checks.
+type Readiness struct {
+	Ready  bool
+	Checks []ReadinessCheck
+}
+
+// ReadinessCheck is the result of a check of the readiness of the node.
+type ReadinessCheck struct {
+	Name  string
+	OK    bool
+	Error string `json:",omitempty"`
+}
+
+var (
+	errShuttingDown    = errors.New("the node is shutting down")
+	errNotListening    = errors.New("the swarm is not listening on any address")
+	errNotBootstrapped = errors.New("the node did not attempt to bootstrap yet")
+)
+
+// CheckReadiness checks that the repo of n is open and, when n is online,
+// that its swarm is listening and that it attempted to bootstrap.
+func CheckReadiness(n *core.IpfsNode) Readiness {
+	r := Readiness{Ready: true}
+	check := func(name string, err error) {
+		c := ReadinessCheck{Name: name, OK: err == nil}
+		if err != nil {
+			c.Error = err.Error()
+			r.Ready = false
+		}
+		r.Checks = append(r.Checks, c)
+	}
+
+	check("repo", repoOpen(n))
+	if !n.IsOnline {
+		return r
+	}
+
+	var err error
+	if len(n.PeerHost.Network().ListenAddresses()) == 0 {
+		err = errNotListening
+	}
+	check("swarm", err)
+
+	err = nil
+	if !n.Bootstrapped() {
+		err = errNotBootstrapped
+	}
+	check("bootstrap", err)
+	return r
+}
+
+func repoOpen(n *core.IpfsNode) error {
+	select {
+	case <-n.Context().Done():
+		return errShuttingDown
+	default:
+	}
+	_, err := n.Repo.Config()
+	return err
+}
+
+// HealthOption serves the liveness of the node on /health, and its readiness
+// on /ready, for the orchestrators to probe the daemon. Both answer 200 when
+// the node is alive or ready, and 503 otherwise; /ready lists its checks. The
+// endpoints are open, as the probes carry no API token.
+func HealthOption() ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+			status := struct {
+				Status string
+				Error  string `json:",omitempty"`
+			}{Status: "ok"}
+			code := http.StatusOK
+			select {
+			case <-n.Context().Done():
+				status.Status = "stopping"
+				status.Error = errShuttingDown.Error()
+				code = http.StatusServiceUnavailable
+			default:
+			}
+			writeHealth(w, code, status)
+		})
+		mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+			ready := CheckReadiness(n)
+			code := http.StatusOK
+			if !ready.Ready {
+				code = http.StatusServiceUnavailable
+			}
+			writeHealth(w, code, ready)
+		})
+		return mux, nil
+	}
+}
+
+func writeHealth(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,60 @@
+package corehttp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	core "github.com/ipfs/go-ipfs/core"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	datastore "github.com/ipfs/go-datastore"
+	syncds "github.com/ipfs/go-datastore/sync"
+	config "github.com/ipfs/go-ipfs-config"
+)
+
+func TestHealthOption(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n, err := core.NewNode(ctx, &core.BuildCfg{Repo: &repo.Mock{
+		C: config.Config{Identity: config.Identity{PeerID: "QmTFauExutTsy4XP6JbMFcw2Wa9645HJt2bTqL6qYDCKfe"}},
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux, err := HealthOption()(n, nil, http.NewServeMux())
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(path string, v interface{}) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("invalid answer of %s %q: %s", path, rec.Body.String(), err)
+		}
+		return rec.Code
+	}
+
+	var ready Readiness
+	if code := get("/ready", &ready); code != http.StatusOK || !ready.Ready {
+		t.Fatalf("expected the offline node ready, got %d %+v", code, ready)
+	}
+	if len(ready.Checks) != 1 || ready.Checks[0].Name != "repo" {
+		t.Fatalf("expected only the repo checked offline, got %+v", ready.Checks)
+	}
+	var health map[string]string
+	if code := get("/health", &health); code != http.StatusOK || health["Status"] != "ok" {
+		t.Fatalf("expected the node alive, got %d %v", code, health)
+	}
+
+	cancel()
+	if code := get("/health", &health); code != http.StatusServiceUnavailable || health["Status"] != "stopping" {
+		t.Fatalf("expected the node stopping, got %d %v", code, health)
+	}
+	if code := get("/ready", &ready); code != http.StatusServiceUnavailable || ready.Ready || ready.Checks[0].OK {
+		t.Fatalf("expected the node not ready, got %d %+v", code, ready)
+	}
+}
@@ -0,0 +1,232 @@
+package corehttp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	core "github.com/ipfs/go-ipfs/core"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	cid "github.com/ipfs/go-cid"
+	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+	isd "github.com/jbenet/go-is-domain"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// PublicGatewaysConfigKey is the config key of the hostnames the gateway is
+// served under.
+const PublicGatewaysConfigKey = "Gateway.PublicGateways"
+
+// libp2pKeyCodec is the multicodec of the peer IDs written as CIDs, which
+// the IPNS names of the subdomains are.
+const libp2pKeyCodec = 0x72
+
+// GatewaySpec describes how the gateway is served under a hostname of
+// Gateway.PublicGateways.
+type GatewaySpec struct {
+	// Paths are the path prefixes served under the hostname. When unset,
+	// they are /ipfs and /ipns; the other paths are not found.
+	Paths []string
+
+	// UseSubdomains serves <cid>.ipfs.<hostname> and <name>.ipns.<hostname>,
+	// each content being its own origin in the browsers, and redirects the
+	// /ipfs/<cid> and /ipns/<name> paths to them.
+	UseSubdomains bool
+
+	// NoDNSLink disables the DNSLink lookup of the hostname itself.
+	NoDNSLink bool
+}
+
+// publicGateways maps the lowercase hostnames to their spec.
+type publicGateways map[string]*GatewaySpec
+
+func loadPublicGateways(r repo.Repo) (publicGateways, error) {
+	var cfg map[string]*GatewaySpec
+	if err := repo.LoadConfigKey(r, PublicGatewaysConfigKey, &cfg); err != nil {
+		return nil, err
+	}
+	gws := make(publicGateways, len(cfg))
+	for host, spec := range cfg {
+		if spec == nil {
+			continue
+		}
+		if spec.Paths == nil {
+			spec.Paths = []string{"/ipfs", "/ipns"}
+		}
+		if strings.Contains(host, "/") || strings.Contains(host, ":") {
+			return nil, fmt.Errorf("%s: invalid hostname %q", PublicGatewaysConfigKey, host)
+		}
+		gws[strings.ToLower(host)] = spec
+	}
+	return gws, nil
+}
+
+// hasPath returns whether p is under one of the paths of spec.
+func (spec *GatewaySpec) hasPath(p string) bool {
+	for _, prefix := range spec.Paths {
+		if p == prefix || strings.HasPrefix(p, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// HostnameOption routes the requests by their Host header: the hostnames of
+// Gateway.PublicGateways serve their paths, and their subdomains the content
+// of the CID or IPNS name they start with; the other hostnames serve the
+// content of their DNSLink, if any.
+func HostnameOption() ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		gws, err := loadPublicGateways(n.Repo)
+		if err != nil {
+			return nil, err
+		}
+		childMux := http.NewServeMux()
+		mux.Handle("/", newHostnameHandler(n, gws, childMux))
+		return childMux, nil
+	}
+}
+
+type hostnameHandler struct {
+	node *core.IpfsNode
+	gws  publicGateways
+	next http.Handler
+}
+
+func newHostnameHandler(n *core.IpfsNode, gws publicGateways, next http.Handler) *hostnameHandler {
+	return &hostnameHandler{node: n, gws: gws, next: next}
+}
+
+func (h *hostnameHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := strings.ToLower(strings.SplitN(r.Host, ":", 2)[0])
+
+	if spec, ok := h.gws[host]; ok {
+		if spec.hasPath(r.URL.Path) {
+			if spec.UseSubdomains {
+				if u, ok := subdomainURL(r); ok {
+					http.Redirect(w, r, u, http.StatusMovedPermanently)
+					return
+				}
+			}
+			h.next.ServeHTTP(w, r)
+			return
+		}
+		if !spec.NoDNSLink && h.serveDNSLink(w, r, host) {
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	// <id>.<ns>.<hostname>
+	if labels := strings.SplitN(host, ".", 3); len(labels) == 3 {
+		if spec, ok := h.gws[labels[2]]; ok && spec.UseSubdomains {
+			p, err := subdomainPath(labels[1], labels[0])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Header.Set("X-Ipns-Original-Path", r.URL.Path)
+			r.URL.Path = p + r.URL.Path
+			h.next.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	if !h.serveDNSLink(w, r, host) {
+		h.next.ServeHTTP(w, r)
+	}
+}
+
+// serveDNSLink serves the content of the DNSLink of host, if any, and
+// returns whether it did.
+func (h *hostnameHandler) serveDNSLink(w http.ResponseWriter, r *http.Request, host string) bool {
+	if len(host) == 0 || !isd.IsDomain(host) {
+		return false
+	}
+	ctx, cancel := context.WithCancel(h.node.Context())
+	defer cancel()
+
+	name := ipnsPathPrefix + host
+	_, err := h.node.Namesys.Resolve(ctx, name, nsopts.Depth(1))
+	if err != nil && err != namesys.ErrResolveRecursion {
+		return false
+	}
+	r.Header.Set("X-Ipns-Original-Path", r.URL.Path)
+	r.URL.Path = name + r.URL.Path
+	h.next.ServeHTTP(w, r)
+	return true
+}
+
+// subdomainPath returns the content path of the subdomain label id of the
+// namespace ns.
+func subdomainPath(ns, id string) (string, error) {
+	switch ns {
+	case "ipfs":
+		c, err := cid.Decode(id)
+		if err != nil {
+			return "", fmt.Errorf("invalid CID %q: %s", id, err)
+		}
+		return ipfsPathPrefix + c.String(), nil
+	case "ipns":
+		// the peer IDs are written as CIDs, the hostnames being case
+		// insensitive
+		if c, err := cid.Decode(id); err == nil && c.Type() == libp2pKeyCodec {
+			p, err := peer.IDFromBytes(c.Hash())
+			if err != nil {
+				return "", fmt.Errorf("invalid peer ID %q: %s", id, err)
+			}
+			return ipnsPathPrefix + p.Pretty(), nil
+		}
+		return ipnsPathPrefix + id, nil
+	default:
+		return "", fmt.Errorf("unknown namespace %q", ns)
+	}
+}
+
+// subdomainURL returns the subdomain URL of the path-style request r, if
+// its content can be served from a subdomain.
+func subdomainURL(r *http.Request) (string, bool) {
+	segs := strings.SplitN(r.URL.EscapedPath(), "/", 4)
+	if len(segs) < 3 || segs[2] == "" {
+		return "", false
+	}
+	ns, id := segs[1], segs[2]
+	rest := "/"
+	if len(segs) == 4 {
+		rest += segs[3]
+	}
+
+	switch ns {
+	case "ipfs":
+		c, err := cid.Decode(id)
+		if err != nil {
+			return "", false
+		}
+		// the CIDv1 in base32 is a valid, case insensitive, label
+		id = cid.NewCidV1(c.Type(), c.Hash()).String()
+	case "ipns":
+		// the DNSLink names, made of several labels, stay path-style
+		p, err := peer.Decode(id)
+		if err != nil {
+			return "", false
+		}
+		id = cid.NewCidV1(libp2pKeyCodec, []byte(p)).String()
+	default:
+		return "", false
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	u := fmt.Sprintf("%s://%s.%s.%s%s", scheme, id, ns, r.Host, rest)
+	if r.URL.RawQuery != "" {
+		u += "?" + r.URL.RawQuery
+	}
+	return u, true
+}
@@ -0,0 +1,210 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	prometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// CommandLimitsConfigKey is the config key of the limits of the API
+// commands.
+const CommandLimitsConfigKey = "API.CommandLimits"
+
+// DefaultQueueTimeout is how long a request waits in the queue of a command
+// when no timeout is configured.
+const DefaultQueueTimeout = 30 * time.Second
+
+// CommandLimit caps the concurrent executions of an API command.
+type CommandLimit struct {
+	// Concurrency is the number of requests of the command executed at
+	// once.
+	Concurrency int
+
+	// Queue is the number of requests waiting for an execution slot. The
+	// requests beyond are rejected.
+	Queue int
+
+	// QueueTimeout is how long a request waits in the queue before being
+	// rejected, as a duration string.
+	QueueTimeout string
+}
+
+// commandLimiter admits the requests of a command.
+type commandLimiter struct {
+	name    string
+	slots   chan struct{}
+	queue   int
+	timeout time.Duration
+
+	mu     sync.Mutex
+	queued int
+}
+
+func newCommandLimiter(name string, l CommandLimit) (*commandLimiter, error) {
+	if l.Concurrency <= 0 {
+		return nil, fmt.Errorf("%s.%s.Concurrency must be positive", CommandLimitsConfigKey, name)
+	}
+	cl := &commandLimiter{
+		name:    name,
+		slots:   make(chan struct{}, l.Concurrency),
+		queue:   l.Queue,
+		timeout: DefaultQueueTimeout,
+	}
+	if l.QueueTimeout != "" {
+		d, err := time.ParseDuration(l.QueueTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s.QueueTimeout: %s", CommandLimitsConfigKey, name, err)
+		}
+		cl.timeout = d
+	}
+	return cl, nil
+}
+
+// acquire waits for an execution slot, and returns false if the request is
+// rejected.
+func (cl *commandLimiter) acquire(r *http.Request) bool {
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	cl.mu.Lock()
+	if cl.queued >= cl.queue {
+		cl.mu.Unlock()
+		return false
+	}
+	cl.queued++
+	cl.mu.Unlock()
+	defer func() {
+		cl.mu.Lock()
+		cl.queued--
+		cl.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(cl.timeout)
+	defer timer.Stop()
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func (cl *commandLimiter) release() {
+	<-cl.slots
+}
+
+// writeBusy answers a rejected request with 429 Too Many Requests, and the
+// error the command clients expect.
+func writeBusy(w http.ResponseWriter, command string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(&cmds.Error{
+		Message: fmt.Sprintf("busy: too many concurrent '%s' requests, retry later", strings.Replace(command, "/", " ", -1)),
+		Code:    cmds.ErrNormal,
+	})
+}
+
+// commandLimiters are the limiters of the commands, by command path.
+type commandLimiters map[string]*commandLimiter
+
+// lookup returns the limiter of the command the API request r runs, if any.
+// The command is resolved through the command tree, so that a command given
+// an argument in the path, as /api/v0/pin/add/<cid>, is limited too.
+func (ls commandLimiters) lookup(r *http.Request) (*commandLimiter, bool) {
+	if !strings.HasPrefix(r.URL.Path, APIPath+"/") {
+		return nil, false
+	}
+	path := strings.Split(strings.Trim(r.URL.Path[len(APIPath):], "/"), "/")
+	cl, ok := ls[strings.Join(commandPath(path), "/")]
+	return cl, ok
+}
+
+// loadCommandLimiters returns the limiters of the API.CommandLimits config
+// section of r.
+func loadCommandLimiters(r repo.Repo) (commandLimiters, error) {
+	var cfg map[string]CommandLimit
+	if err := repo.LoadConfigKey(r, CommandLimitsConfigKey, &cfg); err != nil {
+		return nil, err
+	}
+	limiters := make(commandLimiters, len(cfg))
+	for name, l := range cfg {
+		cl, err := newCommandLimiter(strings.Trim(name, "/"), l)
+		if err != nil {
+			return nil, err
+		}
+		limiters[cl.name] = cl
+	}
+	return limiters, nil
+}
+
+// CommandLimitsOption caps the concurrent executions of the API commands
+// listed in the API.CommandLimits config section, such as "add" or
+// "pin/add". The requests beyond a limit are queued, and rejected with 429
+// Too Many Requests when the queue is full or they waited too long. The
+// limits are shared by the listeners the option serves.
+func CommandLimitsOption() ServeOption {
+	var (
+		once     sync.Once
+		limiters commandLimiters
+		loadErr  error
+	)
+	return func(n *core.IpfsNode, _ net.Listener, parent *http.ServeMux) (*http.ServeMux, error) {
+		once.Do(func() {
+			limiters, loadErr = loadCommandLimiters(n.Repo)
+		})
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		if len(limiters) == 0 {
+			return parent, nil
+		}
+
+		busy := prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "ipfs",
+			Subsystem: "http",
+			Name:      "api_busy_total",
+			Help:      "Number of API requests rejected by the command limits.",
+		}, []string{"command"})
+		if err := prometheus.Register(busy); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				busy = are.ExistingCollector.(*prometheus.CounterVec)
+			} else {
+				return nil, err
+			}
+		}
+
+		mux := http.NewServeMux()
+		parent.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			cl, ok := limiters.lookup(r)
+			if !ok {
+				mux.ServeHTTP(w, r)
+				return
+			}
+
+			if !cl.acquire(r) {
+				busy.WithLabelValues(cl.name).Inc()
+				writeBusy(w, cl.name)
+				return
+			}
+			defer cl.release()
+			mux.ServeHTTP(w, r)
+		})
+		return mux, nil
+	}
+}
@@ -0,0 +1,145 @@
+package corehttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	repo "github.com/ipfs/go-ipfs/repo"
+)
+
+func TestCommandLimiter(t *testing.T) {
+	cl, err := newCommandLimiter("add", CommandLimit{Concurrency: 1, Queue: 1, QueueTimeout: "50ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", APIPath+"/add", nil)
+
+	if !cl.acquire(r) {
+		t.Fatal("expected the first request to run")
+	}
+
+	// the second request waits in the queue, the third is rejected
+	queued := make(chan bool)
+	go func() { queued <- cl.acquire(r) }()
+	for {
+		cl.mu.Lock()
+		n := cl.queued
+		cl.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if cl.acquire(r) {
+		t.Fatal("expected a request beyond the queue to be rejected")
+	}
+
+	cl.release()
+	if !<-queued {
+		t.Fatal("expected the queued request to run once a slot is free")
+	}
+
+	// a request waiting past the timeout, or cancelled, is rejected
+	go func() { queued <- cl.acquire(r) }()
+	if <-queued {
+		t.Fatal("expected the queued request to time out")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if cl.acquire(r.WithContext(ctx)) {
+		t.Fatal("expected a cancelled request to be rejected")
+	}
+}
+
+func TestCommandLimiterConfig(t *testing.T) {
+	if _, err := newCommandLimiter("add", CommandLimit{}); err == nil {
+		t.Fatal("expected a zero concurrency to be refused")
+	}
+	if _, err := newCommandLimiter("add", CommandLimit{Concurrency: 1, QueueTimeout: "soon"}); err == nil {
+		t.Fatal("expected an invalid timeout to be refused")
+	}
+}
+
+// limitsRepo serves limits as the API.CommandLimits config section.
+type limitsRepo struct {
+	*repo.Mock
+	limits map[string]CommandLimit
+}
+
+func (r limitsRepo) GetConfigKey(key string) (interface{}, error) {
+	if key == CommandLimitsConfigKey {
+		return r.limits, nil
+	}
+	return r.Mock.GetConfigKey(key)
+}
+
+func TestCommandLimitsListeners(t *testing.T) {
+	n := &core.IpfsNode{Repo: limitsRepo{
+		Mock:   &repo.Mock{},
+		limits: map[string]CommandLimit{"add": {Concurrency: 1}},
+	}}
+	opt := CommandLimitsOption()
+
+	running := make(chan struct{})
+	done := make(chan struct{})
+	var listeners []http.Handler
+	for i := 0; i < 2; i++ {
+		parent := http.NewServeMux()
+		mux, err := opt(n, nil, parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mux.HandleFunc(APIPath+"/add", func(w http.ResponseWriter, r *http.Request) {
+			running <- struct{}{}
+			<-done
+		})
+		listeners = append(listeners, parent)
+	}
+
+	// a request running on the first listener takes the only slot
+	go listeners[0].ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", APIPath+"/add", nil))
+	<-running
+	w := httptest.NewRecorder()
+	listeners[1].ServeHTTP(w, httptest.NewRequest("POST", APIPath+"/add", nil))
+	close(done)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the listeners to share the limit, got %d", w.Code)
+	}
+}
+
+func TestCommandLimitersLookup(t *testing.T) {
+	ls := commandLimiters{
+		"add":     &commandLimiter{name: "add"},
+		"pin/add": &commandLimiter{name: "pin/add"},
+	}
+	for path, want := range map[string]string{
+		APIPath + "/add":             "add",
+		APIPath + "/pin/add":         "pin/add",
+		APIPath + "/pin/add/QmHash":  "pin/add",
+		APIPath + "/pin/add/QmHash/": "pin/add",
+		APIPath + "/pin/ls":          "",
+		APIPath + "/pin/rm/QmHash":   "",
+		"/ipfs/QmHash/pin/add":       "",
+	} {
+		cl, ok := ls.lookup(httptest.NewRequest("POST", path, nil))
+		if ok != (want != "") || (ok && cl.name != want) {
+			t.Errorf("%s: expected the limiter %q, got %v", path, want, cl)
+		}
+	}
+}
+
+func TestWriteBusy(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeBusy(w, "pin/add")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+	if !strings.Contains(w.Body.String(), "busy: too many concurrent 'pin add' requests") {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+}
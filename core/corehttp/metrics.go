@@ -1,11 +1,15 @@
 package corehttp
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 
 	core "github.com/ipfs/go-ipfs/core"
+	geoip "github.com/ipfs/go-ipfs/core/geoip"
 
+	cid "github.com/ipfs/go-cid"
+	inet "github.com/libp2p/go-libp2p-core/network"
 	prometheus "github.com/prometheus/client_golang/prometheus"
 	promhttp "github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -99,6 +103,18 @@ var (
 		prometheus.BuildFQName("ipfs", "p2p", "peers_total"),
 		"Number of connected peers", []string{"transport"}, nil)
 
+	connectionsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "p2p", "connections"),
+		"Number of connections by direction and transport", []string{"direction", "transport"}, nil)
+
+	wantlistMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "bitswap", "wantlist_blocks"),
+		"Number of blocks in the bitswap wantlist", nil, nil)
+
+	peersLocationMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "p2p", "peers_by_location"),
+		"Number of connected peers by country and autonomous system, with Swarm.GeoIP", []string{"country", "asn"}, nil)
+
 	unixfsGetMetric = prometheus.NewSummaryVec(prometheus.SummaryOpts{
 		Namespace: "ipfs",
 		Subsystem: "http",
@@ -113,6 +129,9 @@ type IpfsNodeCollector struct {
 
 func (_ IpfsNodeCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- peersTotalMetric
+	ch <- connectionsMetric
+	ch <- wantlistMetric
+	ch <- peersLocationMetric
 }
 
 func (c IpfsNodeCollector) Collect(ch chan<- prometheus.Metric) {
@@ -124,6 +143,35 @@ func (c IpfsNodeCollector) Collect(ch chan<- prometheus.Metric) {
 			tr,
 		)
 	}
+	for key, val := range c.ConnectionsValues() {
+		ch <- prometheus.MustNewConstMetric(
+			connectionsMetric,
+			prometheus.GaugeValue,
+			val,
+			key.Direction,
+			key.Transport,
+		)
+	}
+	if wl, ok := c.Node.Exchange.(wantlister); ok {
+		ch <- prometheus.MustNewConstMetric(
+			wantlistMetric,
+			prometheus.GaugeValue,
+			float64(len(wl.GetWantlist())),
+		)
+	}
+	for loc, val := range c.PeersLocationValues() {
+		asn := ""
+		if loc.ASN != 0 {
+			asn = fmt.Sprintf("AS%d", loc.ASN)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			peersLocationMetric,
+			prometheus.GaugeValue,
+			val,
+			loc.Country,
+			asn,
+		)
+	}
 }
 
 func (c IpfsNodeCollector) PeersTotalValues() map[string]float64 {
@@ -140,3 +188,53 @@ func (c IpfsNodeCollector) PeersTotalValues() map[string]float64 {
 	}
 	return vals
 }
+
+// ConnectionKey is the direction and the transport of a connection.
+type ConnectionKey struct {
+	Direction string
+	Transport string
+}
+
+// ConnectionsValues counts the connections by direction and transport.
+func (c IpfsNodeCollector) ConnectionsValues() map[ConnectionKey]float64 {
+	vals := make(map[ConnectionKey]float64)
+	if c.Node.PeerHost == nil {
+		return vals
+	}
+	for _, conn := range c.Node.PeerHost.Network().Conns() {
+		key := ConnectionKey{Direction: "unknown"}
+		switch conn.Stat().Direction {
+		case inet.DirInbound:
+			key.Direction = "inbound"
+		case inet.DirOutbound:
+			key.Direction = "outbound"
+		}
+		for _, proto := range conn.RemoteMultiaddr().Protocols() {
+			key.Transport = key.Transport + "/" + proto.Name
+		}
+		vals[key] = vals[key] + 1
+	}
+	return vals
+}
+
+// wantlister is the exchange exposing its wantlist, as bitswap.
+type wantlister interface {
+	GetWantlist() []cid.Cid
+}
+
+// PeersLocationValues counts the connections by the country and the AS of
+// their address, when Swarm.GeoIP is set. The unknown locations are counted
+// under the zero location.
+func (c IpfsNodeCollector) PeersLocationValues() map[geoip.Location]float64 {
+	vals := make(map[geoip.Location]float64)
+	if c.Node.PeerHost == nil || c.Node.GeoIP == nil {
+		return vals
+	}
+	for _, conn := range c.Node.PeerHost.Network().Conns() {
+		loc := c.Node.GeoIP.LookupAddr(conn.RemoteMultiaddr())
+		// the names of the ASes would multiply the series
+		loc.Org = ""
+		vals[loc] = vals[loc] + 1
+	}
+	return vals
+}
@@ -47,4 +47,13 @@ func TestPeersTotal(t *testing.T) {
 	if actual["/ip4/tcp"] != float64(3) {
 		t.Fatalf("expected 3 peers, got %f", actual["/ip4/tcp"])
 	}
+
+	conns := collector.ConnectionsValues()
+	if out := conns[ConnectionKey{Direction: "outbound", Transport: "/ip4/tcp"}]; out != float64(3) || len(conns) != 1 {
+		t.Fatalf("expected 3 outbound connections, got %v", conns)
+	}
+	leaf := IpfsNodeCollector{Node: &core.IpfsNode{PeerHost: hosts[1]}}
+	if in := leaf.ConnectionsValues()[ConnectionKey{Direction: "inbound", Transport: "/ip4/tcp"}]; in != float64(1) {
+		t.Fatalf("expected 1 inbound connection, got %v", leaf.ConnectionsValues())
+	}
 }
@@ -0,0 +1,55 @@
+package corerepo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ipfs/go-ipfs/core"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// ErrNoValueLog is returned by BadgerGC for the repos whose datastore has no
+// value log to collect, that is not stored in badger.
+var ErrNoValueLog = errors.New("the datastore of the repo has no value log to collect: it isn't stored in badger")
+
+// BadgerGCResult is the result of a collection of the value log.
+type BadgerGCResult struct {
+	// SizeBefore and SizeAfter are the disk usages of the datastore around
+	// the collection.
+	SizeBefore uint64
+	SizeAfter  uint64
+
+	// Reclaimed is the disk space freed by the collection.
+	Reclaimed uint64
+}
+
+// BadgerGC rewrites the value log files of the badger datastore of the repo
+// of n which are mostly garbage, while the node keeps running.
+func BadgerGC(ctx context.Context, n *core.IpfsNode) (BadgerGCResult, error) {
+	dstore := n.Repo.Datastore()
+	gds, ok := dstore.(ds.GCDatastore)
+	if !ok {
+		return BadgerGCResult{}, ErrNoValueLog
+	}
+
+	defer log.EventBegin(ctx, "repoBadgerGC").Done()
+
+	var out BadgerGCResult
+	var err error
+	out.SizeBefore, err = ds.DiskUsage(dstore)
+	if err != nil {
+		return out, err
+	}
+	if err := gds.CollectGarbage(); err != nil {
+		return out, err
+	}
+	out.SizeAfter, err = ds.DiskUsage(dstore)
+	if err != nil {
+		return out, err
+	}
+	if out.SizeAfter < out.SizeBefore {
+		out.Reclaimed = out.SizeBefore - out.SizeAfter
+	}
+	return out, nil
+}
@@ -0,0 +1,23 @@
+package corerepo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/repo/packstore"
+)
+
+// ErrNoPacks is returned by Compact for the repos not stored on disk.
+var ErrNoPacks = errors.New("the repo isn't stored on disk: there is nothing to compact")
+
+// Compact packs the small blocks of the repo of n, and rewrites its sparse
+// packs, while the node keeps running.
+func Compact(ctx context.Context, n *core.IpfsNode, o packstore.CompactOptions) (packstore.CompactResult, error) {
+	if n.Packs == nil {
+		return packstore.CompactResult{}, ErrNoPacks
+	}
+
+	defer log.EventBegin(ctx, "repoCompact").Done()
+	return n.Packs.Compact(ctx, o)
+}
@@ -84,13 +84,7 @@ func BestEffortRoots(filesRoot *mfs.Root) ([]cid.Cid, error) {
 }
 
 func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
-	roots, err := BestEffortRoots(n.FilesRoot)
-	if err != nil {
-		return err
-	}
-	rmed := gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
-
-	return CollectResult(ctx, rmed, nil)
+	return CollectResult(ctx, GarbageCollectAsync(n, ctx), nil)
 }
 
 // CollectResult collects the output of a garbage collection run and calls the
@@ -147,16 +141,53 @@ func (e *MultiError) Error() string {
 	return buf.String()
 }
 
+// GarbageCollectAsync starts a garbage collection paced by the Datastore.GC
+// config section, and returns its output.
 func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result {
-	roots, err := BestEffortRoots(n.FilesRoot)
+	return GarbageCollectWith(n, ctx, GCOptions{})
+}
+
+// GCOptions are the options of a collection started by GarbageCollectWith.
+type GCOptions struct {
+	// DryRun only reports the blocks the collection would remove.
+	DryRun bool
+
+	// Stats, if set, is filled with the blocks removed, once the output of
+	// the collection is closed. It is created with NewGCStats.
+	Stats *GCStats
+}
+
+// GarbageCollectWith starts a garbage collection like GarbageCollectAsync,
+// with the options o.
+func GarbageCollectWith(n *core.IpfsNode, ctx context.Context, o GCOptions) <-chan gc.Result {
+	opts, err := gcOptions(n.Repo)
 	if err != nil {
-		out := make(chan gc.Result)
+		out := make(chan gc.Result, 1)
 		out <- gc.Result{Error: err}
 		close(out)
 		return out
 	}
+	opts.BestEffortRoots = func() ([]cid.Cid, error) {
+		return BestEffortRoots(n.FilesRoot)
+	}
+	opts.DryRun = o.DryRun
+	if o.Stats != nil {
+		opts.Visitor = o.Stats.visitor(n.Blockstore, blockAges(n.Repo))
+	}
+
+	out := gc.Run(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, opts)
+	if o.DryRun {
+		return out
+	}
+	return n.Events.GC(n.Metrics.GC(out))
+}
 
-	return gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
+func gcOptions(r repo.Repo) (gc.Options, error) {
+	cfg, err := gc.LoadConfig(r)
+	if err != nil {
+		return gc.Options{}, err
+	}
+	return cfg.Options()
 }
 
 func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
@@ -204,6 +235,34 @@ func ConditionalGC(ctx context.Context, node *core.IpfsNode, offset uint64) erro
 	return gc.maybeGC(ctx, offset)
 }
 
+// QuotaGC collects the garbage every time the quota of the node asks for it,
+// the repo having grown past Datastore.StorageGCWatermark, until ctx is done.
+// It returns immediately if the quota isn't enabled.
+func QuotaGC(ctx context.Context, node *core.IpfsNode) error {
+	if node.Quota == nil {
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-node.Quota.GCRequests():
+		}
+
+		log.Info("Quota watermark exceeded. Starting repo GC...")
+		if err := GarbageCollect(node, ctx); err != nil {
+			log.Error(err)
+		}
+		node.Quota.Refresh()
+
+		// the writes made during the collection asked for another one
+		select {
+		case <-node.Quota.GCRequests():
+		default:
+		}
+	}
+}
+
 func (gc *GC) maybeGC(ctx context.Context, offset uint64) error {
 	storage, err := gc.Repo.GetStorageUsage()
 	if err != nil {
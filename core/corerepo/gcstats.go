@@ -0,0 +1,114 @@
+package corerepo
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ipfs/go-ipfs/repo"
+
+	"github.com/ipfs/go-cid"
+	flatfs "github.com/ipfs/go-ds-flatfs"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+)
+
+// UnknownAge is the age bucket of the blocks whose age isn't known.
+const UnknownAge = "unknown"
+
+// gcAgeBuckets are the buckets of the ages of the blocks removed, the last
+// one without bound.
+var gcAgeBuckets = []struct {
+	name string
+	max  time.Duration
+}{
+	{"<1h", time.Hour},
+	{"1h-1d", 24 * time.Hour},
+	{"1d-7d", 7 * 24 * time.Hour},
+	{"7d-30d", 30 * 24 * time.Hour},
+	{">30d", 0},
+}
+
+// GCAgeBucket sums the blocks removed of an age.
+type GCAgeBucket struct {
+	Age    string
+	Blocks uint64
+	Bytes  uint64
+}
+
+// GCStats sums the blocks removed by a collection, grouped by the time since
+// they were written.
+type GCStats struct {
+	Blocks uint64
+	Bytes  uint64
+	Ages   []GCAgeBucket
+}
+
+// NewGCStats returns empty statistics.
+func NewGCStats() *GCStats {
+	st := &GCStats{}
+	for _, b := range gcAgeBuckets {
+		st.Ages = append(st.Ages, GCAgeBucket{Age: b.name})
+	}
+	st.Ages = append(st.Ages, GCAgeBucket{Age: UnknownAge})
+	return st
+}
+
+func (st *GCStats) add(age time.Duration, known bool, size int) {
+	st.Blocks++
+	st.Bytes += uint64(size)
+
+	i := len(st.Ages) - 1
+	if known {
+		for j, b := range gcAgeBuckets {
+			if b.max == 0 || age < b.max {
+				i = j
+				break
+			}
+		}
+	}
+	st.Ages[i].Blocks++
+	st.Ages[i].Bytes += uint64(size)
+}
+
+// visitor returns the gc visitor summing the blocks removed in st.
+func (st *GCStats) visitor(bs bstore.Blockstore, ages func(cid.Cid) (time.Duration, bool)) func(cid.Cid) error {
+	return func(k cid.Cid) error {
+		size, err := bs.GetSize(k)
+		if err != nil {
+			return err
+		}
+		age, known := ages(k)
+		st.add(age, known, size)
+		return nil
+	}
+}
+
+// blockAges returns the time since the blocks were written, known for the
+// blocks stored in the flatfs datastore of r, from the modification time of
+// their file.
+func blockAges(r repo.Repo) func(cid.Cid) (time.Duration, bool) {
+	unknown := func(cid.Cid) (time.Duration, bool) { return 0, false }
+
+	fr, ok := r.(interface{ Path() string })
+	if !ok {
+		return unknown
+	}
+	dir := filepath.Join(fr.Path(), "blocks")
+	shard, err := flatfs.ReadShardFunc(dir)
+	if err != nil {
+		// not a flatfs repo
+		return unknown
+	}
+	shardFunc := shard.Func()
+
+	now := time.Now()
+	return func(k cid.Cid) (time.Duration, bool) {
+		name := dshelp.CidToDsKey(k).String()[1:]
+		fi, err := os.Stat(filepath.Join(dir, shardFunc(name), name+".data"))
+		if err != nil {
+			return 0, false
+		}
+		return now.Sub(fi.ModTime()), true
+	}
+}
@@ -3,13 +3,18 @@ package corerepo
 import (
 	"fmt"
 	"math"
+	"sort"
 
 	context "context"
 
 	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/repo"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+	"github.com/ipfs/go-ipfs/repo/packstore"
 
 	humanize "github.com/dustin/go-humanize"
+	cid "github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
 )
 
 // SizeStat wraps information about the repository size and its limit.
@@ -24,29 +29,107 @@ type Stat struct {
 	NumObjects uint64
 	RepoPath   string
 	Version    string
+
+	// Mounts are the sizes of the mounts of the datastore, when it has some.
+	Mounts []repo.MountStat `json:",omitempty"`
+
+	Detailed *DetailedStat `json:",omitempty"`
+}
+
+// sizeBuckets are the buckets of the sizes of the blocks, the last one
+// without bound.
+var sizeBuckets = []struct {
+	name string
+	max  int
+}{
+	{"<1KiB", 1 << 10},
+	{"1KiB-4KiB", 4 << 10},
+	{"4KiB-16KiB", 16 << 10},
+	{"16KiB-64KiB", 64 << 10},
+	{"64KiB-256KiB", 256 << 10},
+	{">256KiB", 0},
+}
+
+// SizeBucket sums the blocks of a size.
+type SizeBucket struct {
+	Size   string
+	Blocks uint64
+	Bytes  uint64
+}
+
+// PrefixStat sums the blocks of a CID prefix: CID version, codec and hash
+// function.
+type PrefixStat struct {
+	Prefix string
+	Blocks uint64
+	Bytes  uint64
+	Sizes  []SizeBucket
+}
+
+func (st *PrefixStat) add(size int) {
+	st.Blocks++
+	st.Bytes += uint64(size)
+
+	i := len(sizeBuckets) - 1
+	for j, b := range sizeBuckets {
+		if b.max == 0 || size < b.max {
+			i = j
+			break
+		}
+	}
+	st.Sizes[i].Blocks++
+	st.Sizes[i].Bytes += uint64(size)
+}
+
+// DetailedStat describes the blocks of the repo.
+type DetailedStat struct {
+	// Prefixes are the blocks by CID prefix, the most numerous first.
+	Prefixes []PrefixStat
+
+	// Packs describes the blocks packed by 'ipfs repo compact', if the repo
+	// is stored on disk.
+	Packs *packstore.PackStat `json:",omitempty"`
 }
 
 // NoLimit represents the value for unlimited storage
 const NoLimit uint64 = math.MaxUint64
 
-// RepoStat returns a *Stat object with all the fields set.
+// RepoStat returns a *Stat object with all the fields set. The size and the
+// number of objects are measured together, with the writes held back, from
+// the block count kept by the node.
 func RepoStat(ctx context.Context, n *core.IpfsNode) (Stat, error) {
-	sizeStat, err := RepoSize(ctx, n)
-	if err != nil {
-		return Stat{}, err
+	var sizeStat SizeStat
+	size := func() (err error) {
+		sizeStat, err = RepoSize(ctx, n)
+		return err
 	}
 
-	allKeys, err := n.Blockstore.AllKeysChan(ctx)
-	if err != nil {
-		return Stat{}, err
+	var count uint64
+	if n.BlockCount != nil {
+		c, err := n.BlockCount.Snapshot(ctx, size)
+		if err != nil {
+			return Stat{}, err
+		}
+		count = c.Blocks
+	} else {
+		if err := size(); err != nil {
+			return Stat{}, err
+		}
+		allKeys, err := n.Blockstore.AllKeysChan(ctx)
+		if err != nil {
+			return Stat{}, err
+		}
+		for range allKeys {
+			count++
+		}
 	}
 
-	count := uint64(0)
-	for range allKeys {
-		count++
+	path, err := fsrepo.BestKnownPath()
+	if err != nil {
+		return Stat{}, err
 	}
 
-	path, err := fsrepo.BestKnownPath()
+	mounts, err := n.Repo.MountStats()
 	if err != nil {
 		return Stat{}, err
 	}
@@ -59,9 +142,74 @@ func RepoStat(ctx context.Context, n *core.IpfsNode) (Stat, error) {
 		NumObjects: count,
 		RepoPath:   path,
 		Version:    fmt.Sprintf("fs-repo@%d", fsrepo.RepoVersion),
+		Mounts:     mounts,
 	}, nil
 }
 
+// RepoStatDetailed enumerates the blocks of the repo to describe them.
+func RepoStatDetailed(ctx context.Context, n *core.IpfsNode) (*DetailedStat, error) {
+	keys, err := n.Blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := make(map[cid.Prefix]*PrefixStat)
+	for k := range keys {
+		size, err := n.Blockstore.GetSize(k)
+		if err != nil {
+			// removed meanwhile
+			continue
+		}
+		p := k.Prefix()
+		st, ok := prefixes[p]
+		if !ok {
+			st = &PrefixStat{Prefix: prefixName(p)}
+			for _, b := range sizeBuckets {
+				st.Sizes = append(st.Sizes, SizeBucket{Size: b.name})
+			}
+			prefixes[p] = st
+		}
+		st.add(size)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	detailed := &DetailedStat{}
+	for _, st := range prefixes {
+		detailed.Prefixes = append(detailed.Prefixes, *st)
+	}
+	sort.Slice(detailed.Prefixes, func(i, j int) bool {
+		a, b := detailed.Prefixes[i], detailed.Prefixes[j]
+		if a.Blocks != b.Blocks {
+			return a.Blocks > b.Blocks
+		}
+		return a.Prefix < b.Prefix
+	})
+
+	if n.Packs != nil {
+		st, err := n.Packs.Stat(ctx)
+		if err != nil {
+			return nil, err
+		}
+		detailed.Packs = &st
+	}
+	return detailed, nil
+}
+
+// prefixName names p like "cidv1 raw sha2-256".
+func prefixName(p cid.Prefix) string {
+	codec, ok := cid.CodecToStr[p.Codec]
+	if !ok {
+		codec = fmt.Sprintf("codec-%x", p.Codec)
+	}
+	hash, ok := mh.Codes[p.MhType]
+	if !ok {
+		hash = fmt.Sprintf("hash-%x", p.MhType)
+	}
+	return fmt.Sprintf("cidv%d %s %s", p.Version, codec, hash)
+}
+
 // RepoSize returns a *Stat object with the RepoSize and StorageMax fields set.
 func RepoSize(ctx context.Context, n *core.IpfsNode) (SizeStat, error) {
 	r := n.Repo
@@ -43,7 +43,15 @@ type syncer interface {
 }
 
 // NewAdder Returns a new Adder used for a file add operation.
+//
+// When bs is a blockstore, the blocks the adder writes are recorded, to be
+// removed if ctx is canceled before the add is over.
 func NewAdder(ctx context.Context, p pin.Pinner, bs bstore.GCLocker, ds ipld.DAGService) (*Adder, error) {
+	var rollback *rollbackDAG
+	if blocks, ok := bs.(bstore.Blockstore); ok {
+		rollback = newRollbackDAG(ctx, blocks, ds)
+		ds = rollback
+	}
 	bufferedDS := ipld.NewBufferedDAG(ctx, ds)
 
 	return &Adder{
@@ -56,6 +64,7 @@ func NewAdder(ctx context.Context, p pin.Pinner, bs bstore.GCLocker, ds ipld.DAG
 		Pin:        true,
 		Trickle:    false,
 		Chunker:    "",
+		rollback:   rollback,
 	}, nil
 }
 
@@ -74,11 +83,15 @@ type Adder struct {
 	Silent     bool
 	NoCopy     bool
 	Chunker    string
+	Patch      *Patch
+	ProgressCh chan<- AddProgress
 	mroot      *mfs.Root
 	unlocker   bstore.Unlocker
 	tempRoot   cid.Cid
 	CidBuilder cid.Builder
 	liveNodes  uint64
+	readBytes  int64
+	rollback   *rollbackDAG
 }
 
 func (adder *Adder) mfsRoot() (*mfs.Root, error) {
@@ -102,9 +115,15 @@ func (adder *Adder) SetMfsRoot(r *mfs.Root) {
 
 // Constructs a node from reader's data, and adds it. Doesn't pin.
 func (adder *Adder) add(reader io.Reader) (ipld.Node, error) {
-	chnk, err := chunker.FromString(reader, adder.Chunker)
-	if err != nil {
-		return nil, err
+	var chnk chunker.Splitter
+	if adder.Patch != nil {
+		chnk = adder.Patch.Splitter(reader)
+	} else {
+		var err error
+		chnk, err = chunker.FromString(reader, adder.Chunker)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	params := ihelper.DagBuilderParams{
@@ -254,11 +273,23 @@ func (adder *Adder) addNode(node ipld.Node, path string) error {
 }
 
 // AddAllAndPin adds the given request's files and pin them.
-func (adder *Adder) AddAllAndPin(file files.Node) (ipld.Node, error) {
+//
+// When the context of the adder is canceled, the add stops at the next read
+// of a file, and the blocks it wrote, unless another add wrote them too, are
+// removed.
+func (adder *Adder) AddAllAndPin(file files.Node) (_ ipld.Node, err error) {
 	if adder.Pin {
 		adder.unlocker = adder.gcLocker.PinLock()
 	}
 	defer func() {
+		if err != nil && adder.ctx.Err() != nil {
+			if rerr := adder.rollBack(); rerr != nil {
+				log.Errorf("rolling back the canceled add: %s", rerr)
+			}
+		}
+		if adder.rollback != nil {
+			adder.rollback.release()
+		}
 		if adder.unlocker != nil {
 			adder.unlocker.Unlock()
 		}
@@ -327,15 +358,45 @@ func (adder *Adder) AddAllAndPin(file files.Node) (ipld.Node, error) {
 		}
 	}
 
+	if err := adder.ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if !adder.Pin {
 		return nd, nil
 	}
 	return nd, adder.PinRoot(nd)
 }
 
+// rollBack undoes a canceled add: it unpins the temporary root, and removes
+// the blocks written.
+func (adder *Adder) rollBack() error {
+	// the context of the adder is done
+	ctx := context.Background()
+
+	if adder.tempRoot.Defined() {
+		if err := adder.pinning.Unpin(ctx, adder.tempRoot, true); err != nil {
+			return err
+		}
+		if err := adder.pinning.Flush(ctx); err != nil {
+			return err
+		}
+		adder.tempRoot = cid.Undef
+	}
+
+	if adder.rollback == nil {
+		return nil
+	}
+	return adder.rollback.rollback()
+}
+
 func (adder *Adder) addFileNode(path string, file files.Node, toplevel bool) error {
 	defer file.Close()
 
+	if err := adder.ctx.Err(); err != nil {
+		return err
+	}
+
 	err := adder.maybePauseForGC()
 	if err != nil {
 		return err
@@ -384,16 +445,18 @@ func (adder *Adder) addSymlink(path string, l *files.Symlink) error {
 }
 
 func (adder *Adder) addFile(path string, file files.File) error {
+	// stop reading the file once the add is canceled
+	var reader io.Reader = newCtxReader(adder, path, file)
+
 	// if the progress flag was specified, wrap the file so that we can send
 	// progress updates to the client (over the output channel)
-	var reader io.Reader = file
 	if adder.Progress {
-		rdr := &progressReader{file: reader, path: path, out: adder.Out}
-		if fi, ok := file.(files.FileInfo); ok {
-			reader = &progressReader2{rdr, fi}
-		} else {
-			reader = rdr
-		}
+		reader = &progressReader{file: reader, path: path, out: adder.Out}
+	}
+
+	// keep the file info of the file visible, the filestore needs it
+	if fi, ok := file.(files.FileInfo); ok {
+		reader = &fileInfoReader{reader, fi}
 	}
 
 	dagnode, err := adder.add(reader)
@@ -512,11 +575,7 @@ func (i *progressReader) Read(p []byte) (int, error) {
 	return n, err
 }
 
-type progressReader2 struct {
-	*progressReader
+type fileInfoReader struct {
+	io.Reader
 	files.FileInfo
 }
-
-func (i *progressReader2) Read(p []byte) (int, error) {
-	return i.progressReader.Read(p)
-}
@@ -253,6 +253,122 @@ func TestAddGCLive(t *testing.T) {
 	}
 }
 
+func countBlocks(t *testing.T, bs blockstore.Blockstore) int {
+	keys, err := bs.AllKeysChan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range keys {
+		n++
+	}
+	return n
+}
+
+func TestAddCancelRollsBack(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: testPeerID, // required by offline node
+			},
+		},
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := countBlocks(t, node.Blockstore)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	progress := make(chan AddProgress)
+	adder, err := NewAdder(ctx, node.Pinning, node.Blockstore, node.DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adder.ProgressCh = progress
+
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(3)).Read(data) // Rand.Read never returns an error
+
+	// the second file hangs, once the first one is written
+	piper, pipew := io.Pipe()
+	slf := files.NewMapDirectory(map[string]files.Node{
+		"a": files.NewBytesFile(data),
+		"b": files.NewReaderFile(piper),
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := adder.AddAllAndPin(slf)
+		errs <- err
+	}()
+
+	go pipew.Write(data[:progressReaderIncrement])
+	for p := range progress {
+		if p.Name == "b" {
+			break
+		}
+	}
+	if n := countBlocks(t, node.Blockstore); n <= before {
+		t.Fatal("expected the blocks of the first file to be written")
+	}
+
+	cancel()
+	pipew.Close()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("expected the add to be canceled, got %v", err)
+	}
+	if n := countBlocks(t, node.Blockstore); n != before {
+		t.Fatalf("expected the %d blocks written to be removed, %d are left", n-before, n)
+	}
+}
+
+func TestAddProgress(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: testPeerID, // required by offline node
+			},
+		},
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := make(chan AddProgress)
+	ctx := WithProgress(context.Background(), progress)
+	adder, err := NewAdder(ctx, node.Pinning, node.Blockstore, node.DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adder.ProgressCh = ProgressFromContext(ctx)
+
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(4)).Read(data) // Rand.Read never returns an error
+
+	go func() {
+		defer close(progress)
+		if _, err := adder.AddAllAndPin(files.NewBytesFile(data)); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var last AddProgress
+	for p := range progress {
+		if p.Bytes < last.Bytes {
+			t.Fatalf("progress went back from %d to %d", last.Bytes, p.Bytes)
+		}
+		last = p
+	}
+	if last.Bytes != int64(len(data)) || last.Size != int64(len(data)) || last.Total != int64(len(data)) {
+		t.Fatalf("expected the last progress to cover the %d bytes, got %+v", len(data), last)
+	}
+}
+
 func testAddWPosInfo(t *testing.T, rawLeaves bool) {
 	r := &repo.Mock{
 		C: config.Config{
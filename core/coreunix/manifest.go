@@ -0,0 +1,240 @@
+package coreunix
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	gopath "path"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+	uio "github.com/ipfs/go-unixfs/io"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// ManifestType identifies manifest nodes.
+const ManifestType = "ipfs-manifest/1"
+
+// manifestMaxSize is the size of the largest block bitswap transfers; larger
+// manifests couldn't be retrieved.
+const manifestMaxSize = 1 << 20
+
+// ManifestEntry describes a file of a manifest.
+type ManifestEntry struct {
+	Cid  cid.Cid
+	Size uint64
+
+	// SHA256 is the hash of the content of the file, which doesn't depend
+	// on how the file was chunked.
+	SHA256 []byte
+}
+
+// Manifest lists the files of a tree, by path relative to its root.
+type Manifest struct {
+	Root    cid.Cid
+	Entries map[string]ManifestEntry
+}
+
+// BuildManifest walks the unixfs tree root and hashes the content of every
+// file and symlink.
+func BuildManifest(ctx context.Context, ds ipld.DAGService, root ipld.Node) (*Manifest, error) {
+	m := &Manifest{
+		Root:    root.Cid(),
+		Entries: make(map[string]ManifestEntry),
+	}
+	err := walkTree(ctx, ds, root, "", func(p string, nd ipld.Node) error {
+		e, err := manifestEntry(ctx, ds, nd)
+		if err != nil {
+			return fmt.Errorf("%s: %s", p, err)
+		}
+		m.Entries[p] = e
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// walkTree calls f with every file and symlink of the tree nd.
+func walkTree(ctx context.Context, ds ipld.DAGService, nd ipld.Node, p string, f func(string, ipld.Node) error) error {
+	if pn, ok := nd.(*dag.ProtoNode); ok {
+		fsn, err := unixfs.FSNodeFromBytes(pn.Data())
+		if err != nil {
+			return err
+		}
+		if fsn.Type() == unixfs.TDirectory || fsn.Type() == unixfs.THAMTShard {
+			dir, err := uio.NewDirectoryFromNode(ds, nd)
+			if err != nil {
+				return err
+			}
+			return dir.ForEachLink(ctx, func(l *ipld.Link) error {
+				child, err := l.GetNode(ctx, ds)
+				if err != nil {
+					return err
+				}
+				return walkTree(ctx, ds, child, gopath.Join(p, l.Name), f)
+			})
+		}
+	}
+	return f(p, nd)
+}
+
+func manifestEntry(ctx context.Context, ds ipld.DAGService, nd ipld.Node) (ManifestEntry, error) {
+	h := sha256.New()
+	if pn, ok := nd.(*dag.ProtoNode); ok {
+		fsn, err := unixfs.FSNodeFromBytes(pn.Data())
+		if err != nil {
+			return ManifestEntry{}, err
+		}
+		if fsn.Type() == unixfs.TSymlink {
+			h.Write(fsn.Data())
+			return ManifestEntry{Cid: nd.Cid(), Size: uint64(len(fsn.Data())), SHA256: h.Sum(nil)}, nil
+		}
+	}
+
+	r, err := uio.NewDagReader(ctx, nd, ds)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	return ManifestEntry{Cid: nd.Cid(), Size: uint64(n), SHA256: h.Sum(nil)}, nil
+}
+
+// Node returns the manifest as a dag-cbor node, linking to the root and to
+// every file.
+func (m *Manifest) Node() (ipld.Node, error) {
+	entries := make(map[string]interface{}, len(m.Entries))
+	for p, e := range m.Entries {
+		entries[p] = map[string]interface{}{
+			"cid":    e.Cid,
+			"size":   e.Size,
+			"sha256": e.SHA256,
+		}
+	}
+	nd, err := cbor.WrapObject(map[string]interface{}{
+		"type":    ManifestType,
+		"root":    m.Root,
+		"entries": entries,
+	}, mh.SHA2_256, -1)
+	if err != nil {
+		return nil, err
+	}
+	if len(nd.RawData()) > manifestMaxSize {
+		return nil, fmt.Errorf("the manifest of %d files is too large to be transferred", len(m.Entries))
+	}
+	return nd, nil
+}
+
+// DecodeManifest parses a manifest node.
+func DecodeManifest(nd ipld.Node) (*Manifest, error) {
+	var obj map[string]interface{}
+	if err := cbor.DecodeInto(nd.RawData(), &obj); err != nil {
+		return nil, fmt.Errorf("not a manifest: %s", err)
+	}
+	if t, _ := obj["type"].(string); t != ManifestType {
+		return nil, fmt.Errorf("not a manifest: unknown type %q", obj["type"])
+	}
+
+	root, ok := obj["root"].(cid.Cid)
+	if !ok {
+		return nil, fmt.Errorf("invalid manifest: no root")
+	}
+	entries, ok := obj["entries"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid manifest: no entries")
+	}
+
+	m := &Manifest{Root: root, Entries: make(map[string]ManifestEntry, len(entries))}
+	for p, v := range entries {
+		fields, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid manifest entry %q", p)
+		}
+		var e ManifestEntry
+		e.Cid, ok = fields["cid"].(cid.Cid)
+		if !ok {
+			return nil, fmt.Errorf("invalid manifest entry %q: no cid", p)
+		}
+		e.SHA256, ok = fields["sha256"].([]byte)
+		if !ok {
+			return nil, fmt.Errorf("invalid manifest entry %q: no hash", p)
+		}
+		switch size := fields["size"].(type) {
+		case int:
+			e.Size = uint64(size)
+		case int64:
+			e.Size = uint64(size)
+		case uint:
+			e.Size = uint64(size)
+		case uint64:
+			e.Size = size
+		default:
+			return nil, fmt.Errorf("invalid manifest entry %q: no size", p)
+		}
+		m.Entries[p] = e
+	}
+	return m, nil
+}
+
+// ManifestMismatch is a difference between a tree and its manifest.
+type ManifestMismatch struct {
+	Path   string
+	Reason string
+}
+
+// VerifyManifest checks the tree root against m: every file of the manifest
+// must be in the tree with the same size and content, and the tree must not
+// have other files. CIDs are compared only when root is the root of the
+// manifest, as other chunking or hash options give other CIDs for the same
+// content.
+func VerifyManifest(ctx context.Context, ds ipld.DAGService, m *Manifest, root ipld.Node) ([]ManifestMismatch, error) {
+	sameRoot := root.Cid().Equals(m.Root)
+	seen := make(map[string]bool, len(m.Entries))
+
+	var mismatches []ManifestMismatch
+	err := walkTree(ctx, ds, root, "", func(p string, nd ipld.Node) error {
+		want, ok := m.Entries[p]
+		if !ok {
+			mismatches = append(mismatches, ManifestMismatch{Path: p, Reason: "not in the manifest"})
+			return nil
+		}
+		seen[p] = true
+
+		got, err := manifestEntry(ctx, ds, nd)
+		if err != nil {
+			return fmt.Errorf("%s: %s", p, err)
+		}
+		switch {
+		case got.Size != want.Size:
+			mismatches = append(mismatches, ManifestMismatch{Path: p, Reason: fmt.Sprintf("size is %d, expected %d", got.Size, want.Size)})
+		case !bytes.Equal(got.SHA256, want.SHA256):
+			mismatches = append(mismatches, ManifestMismatch{Path: p, Reason: "content differs"})
+		case sameRoot && !got.Cid.Equals(want.Cid):
+			mismatches = append(mismatches, ManifestMismatch{Path: p, Reason: fmt.Sprintf("CID is %s, expected %s", got.Cid, want.Cid)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for p := range m.Entries {
+		if !seen[p] {
+			mismatches = append(mismatches, ManifestMismatch{Path: p, Reason: "missing"})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].Path < mismatches[j].Path
+	})
+	return mismatches, nil
+}
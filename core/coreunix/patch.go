@@ -0,0 +1,303 @@
+package coreunix
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+)
+
+// patchMinBlockSize is the size under which the blocks of the previous
+// version are not looked for: matching them saves little and weak checksums
+// of short windows collide often.
+const patchMinBlockSize = 64
+
+// patchMaxSizes bounds the number of distinct block sizes looked for, each
+// size costs a rolling checksum update per byte.
+const patchMaxSizes = 8
+
+type patchKey struct {
+	size int
+	weak uint32
+}
+
+// Patch holds the leaves of a previous version of a file. Used while adding a
+// new version, the file is cut at the boundaries of the unchanged leaves so
+// that they produce the same blocks, in the manner of rsync: only the changed
+// regions produce new blocks.
+type Patch struct {
+	strong map[patchKey][][sha256.Size]byte
+	sizes  []int
+
+	// filter has the bits of the weak checksums set, to skip most map
+	// lookups.
+	filter [1 << 16 / 64]uint64
+
+	// maxChunk is the size of the chunks cut from the changed regions.
+	maxChunk int
+
+	// ReusedBytes and NewBytes count the data found in the previous version
+	// and the changed data, once the file is added.
+	ReusedBytes uint64
+	NewBytes    uint64
+}
+
+type patchPtrKey struct{}
+
+// WithPatch returns a context making the adders created with it patch files
+// from p.
+func WithPatch(ctx context.Context, p *Patch) context.Context {
+	return context.WithValue(ctx, patchPtrKey{}, p)
+}
+
+// PatchFromContext returns the Patch set with WithPatch, or nil.
+func PatchFromContext(ctx context.Context) *Patch {
+	p, _ := ctx.Value(patchPtrKey{}).(*Patch)
+	return p
+}
+
+// NewPatch reads the leaves of the unixfs file root.
+func NewPatch(ctx context.Context, ng ipld.NodeGetter, root ipld.Node) (*Patch, error) {
+	p := &Patch{
+		strong:   make(map[patchKey][][sha256.Size]byte),
+		maxChunk: int(chunker.DefaultBlockSize),
+	}
+	counts := make(map[int]int)
+
+	err := walkLeaves(ctx, ng, root, func(data []byte) {
+		if len(data) < patchMinBlockSize {
+			return
+		}
+		k := patchKey{size: len(data), weak: newRollsum(data).digest()}
+		p.strong[k] = append(p.strong[k], sha256.Sum256(data))
+		h := filterIndex(k.weak)
+		p.filter[h/64] |= 1 << (h % 64)
+		counts[len(data)]++
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for size := range counts {
+		p.sizes = append(p.sizes, size)
+	}
+	sort.Slice(p.sizes, func(i, j int) bool {
+		if counts[p.sizes[i]] != counts[p.sizes[j]] {
+			return counts[p.sizes[i]] > counts[p.sizes[j]]
+		}
+		return p.sizes[i] > p.sizes[j]
+	})
+	if len(p.sizes) > patchMaxSizes {
+		p.sizes = p.sizes[:patchMaxSizes]
+	}
+	if len(p.sizes) > 0 && p.sizes[0] > p.maxChunk {
+		p.maxChunk = p.sizes[0]
+	}
+	return p, nil
+}
+
+func walkLeaves(ctx context.Context, ng ipld.NodeGetter, nd ipld.Node, leaf func([]byte)) error {
+	switch nd := nd.(type) {
+	case *dag.RawNode:
+		leaf(nd.RawData())
+		return nil
+	case *dag.ProtoNode:
+		fsn, err := unixfs.FSNodeFromBytes(nd.Data())
+		if err != nil {
+			return err
+		}
+		if fsn.Type() != unixfs.TRaw && fsn.Type() != unixfs.TFile {
+			return fmt.Errorf("%s is not a file", nd.Cid())
+		}
+		if len(nd.Links()) == 0 {
+			leaf(fsn.Data())
+			return nil
+		}
+		for _, l := range nd.Links() {
+			child, err := l.GetNode(ctx, ng)
+			if err != nil {
+				return err
+			}
+			if err := walkLeaves(ctx, ng, child, leaf); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s is not a unixfs file", nd.Cid())
+	}
+}
+
+// match returns whether window is a leaf of the previous version.
+func (p *Patch) match(window []byte, weak uint32) bool {
+	if h := filterIndex(weak); p.filter[h/64]&(1<<(h%64)) == 0 {
+		return false
+	}
+	strong, ok := p.strong[patchKey{size: len(window), weak: weak}]
+	if !ok {
+		return false
+	}
+	sum := sha256.Sum256(window)
+	for _, s := range strong {
+		if s == sum {
+			return true
+		}
+	}
+	return false
+}
+
+// Splitter returns a splitter cutting r at the boundaries of the leaves of
+// the previous version.
+func (p *Patch) Splitter(r io.Reader) chunker.Splitter {
+	return &patchSplitter{p: p, r: r, sums: make([]rollsum, len(p.sizes))}
+}
+
+type patchSplitter struct {
+	p   *Patch
+	r   io.Reader
+	eof bool
+
+	// buf holds the data not returned yet; buf[:pos] is changed data.
+	buf []byte
+	pos int
+
+	// sums are the rolling checksums of buf[pos:pos+size], for each size.
+	sums  []rollsum
+	valid bool
+}
+
+func (s *patchSplitter) Reader() io.Reader {
+	return s.r
+}
+
+func (s *patchSplitter) NextBytes() ([]byte, error) {
+	for {
+		if s.pos >= s.p.maxChunk {
+			return s.emit(s.pos, false), nil
+		}
+
+		if err := s.fill(); err != nil {
+			return nil, err
+		}
+
+		if !s.valid {
+			for i, size := range s.p.sizes {
+				if s.pos+size <= len(s.buf) {
+					s.sums[i] = newRollsum(s.buf[s.pos : s.pos+size])
+				}
+			}
+			s.valid = true
+		}
+
+		for i, size := range s.p.sizes {
+			if s.pos+size > len(s.buf) || !s.p.match(s.buf[s.pos:s.pos+size], s.sums[i].digest()) {
+				continue
+			}
+			if s.pos > 0 {
+				// Return the changed data first, the match is found again
+				// on the next call.
+				return s.emit(s.pos, false), nil
+			}
+			s.valid = false
+			return s.emit(size, true), nil
+		}
+
+		if s.pos == len(s.buf) {
+			if s.pos == 0 {
+				return nil, io.EOF
+			}
+			return s.emit(s.pos, false), nil
+		}
+
+		for i, size := range s.p.sizes {
+			if s.pos+size < len(s.buf) {
+				s.sums[i].roll(s.buf[s.pos], s.buf[s.pos+size])
+			}
+		}
+		s.pos++
+	}
+}
+
+// fill reads enough data to look for every block size at pos.
+func (s *patchSplitter) fill() error {
+	need := s.pos + 1
+	for _, size := range s.p.sizes {
+		if s.pos+size > need {
+			need = s.pos + size
+		}
+	}
+	if s.eof || len(s.buf) >= need {
+		return nil
+	}
+
+	// Read ahead by a chunk to keep the reads large.
+	need += s.p.maxChunk
+	if cap(s.buf) < need {
+		buf := make([]byte, len(s.buf), need)
+		copy(buf, s.buf)
+		s.buf = buf
+	}
+	for !s.eof && len(s.buf) < need {
+		n, err := s.r.Read(s.buf[len(s.buf):need])
+		s.buf = s.buf[:len(s.buf)+n]
+		if err == io.EOF {
+			s.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emit returns the first n bytes of buf and drops them.
+func (s *patchSplitter) emit(n int, reused bool) []byte {
+	out := make([]byte, n)
+	copy(out, s.buf[:n])
+	s.buf = s.buf[:copy(s.buf, s.buf[n:])]
+	s.pos -= n
+	if s.pos < 0 {
+		s.pos = 0
+	}
+
+	if reused {
+		s.p.ReusedBytes += uint64(n)
+	} else {
+		s.p.NewBytes += uint64(n)
+	}
+	return out
+}
+
+// rollsum is the rolling checksum of rsync.
+type rollsum struct {
+	a, b uint32
+	size uint32
+}
+
+func newRollsum(data []byte) rollsum {
+	r := rollsum{size: uint32(len(data))}
+	for i, c := range data {
+		r.a += uint32(c)
+		r.b += uint32(len(data)-i) * uint32(c)
+	}
+	return r
+}
+
+// roll moves the window by one byte, dropping out and adding in.
+func (r *rollsum) roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - r.size*uint32(out)
+}
+
+func (r rollsum) digest() uint32 {
+	return r.a&0xffff | r.b<<16
+}
+
+func filterIndex(weak uint32) uint32 {
+	return (weak ^ weak>>16) & 0xffff
+}
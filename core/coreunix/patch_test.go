@@ -0,0 +1,73 @@
+package coreunix
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	"github.com/ipfs/go-unixfs/importer"
+)
+
+func TestPatchReusesUnchangedBlocks(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+
+	const blockSize = 4096
+	old := make([]byte, 64*blockSize+100)
+	rand.New(rand.NewSource(1)).Read(old)
+
+	root, err := importer.BuildDagFromReader(ds, chunker.NewSizeSplitter(bytes.NewReader(old), blockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPatch(ctx, ds, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Insert a few bytes in the middle: with the size chunker, every block
+	// after the insertion would change.
+	insert := []byte("some inserted bytes")
+	mid := 20*blockSize + 10
+	modified := append(append(append([]byte{}, old[:mid]...), insert...), old[mid:]...)
+
+	spl := p.Splitter(bytes.NewReader(modified))
+	var out []byte
+	for {
+		b, err := spl.NextBytes()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, b...)
+	}
+
+	if !bytes.Equal(out, modified) {
+		t.Fatal("the splitter changed the data")
+	}
+	if p.ReusedBytes+p.NewBytes != uint64(len(modified)) {
+		t.Fatalf("expected %d bytes, counted %d reused and %d new", len(modified), p.ReusedBytes, p.NewBytes)
+	}
+	// Only the block holding the insertion and the short last block are new.
+	if p.NewBytes > blockSize+uint64(len(insert))+100 {
+		t.Fatalf("expected most of the data to be reused, %d bytes are new", p.NewBytes)
+	}
+}
+
+func TestPatchContext(t *testing.T) {
+	ctx := context.Background()
+	if PatchFromContext(ctx) != nil {
+		t.Fatal("expected no patch")
+	}
+	p := &Patch{}
+	if PatchFromContext(WithPatch(ctx, p)) != p {
+		t.Fatal("expected the patch set in the context")
+	}
+}
@@ -0,0 +1,90 @@
+package coreunix
+
+import (
+	"context"
+	"io"
+
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+// AddProgress reports how far an add went, sent as the files are read.
+type AddProgress struct {
+	// Name is the path of the file being read.
+	Name string
+
+	// Bytes is the number of bytes of the file read so far, out of Size, or
+	// -1 when the size of the file is unknown.
+	Bytes int64
+	Size  int64
+
+	// Total is the number of bytes of all the files read so far.
+	Total int64
+}
+
+type progressPtrKey struct{}
+
+// WithProgress returns a context making the adders created with it send their
+// progress on ch. The sends block until ch is read or the context is done.
+func WithProgress(ctx context.Context, ch chan<- AddProgress) context.Context {
+	return context.WithValue(ctx, progressPtrKey{}, ch)
+}
+
+// ProgressFromContext returns the channel set with WithProgress, or nil.
+func ProgressFromContext(ctx context.Context) chan<- AddProgress {
+	ch, _ := ctx.Value(progressPtrKey{}).(chan<- AddProgress)
+	return ch
+}
+
+// ctxReader reads a file being added until the add is canceled, which makes
+// the chunker stop at the next read.
+type ctxReader struct {
+	ctx  context.Context
+	file io.Reader
+
+	// progress is nil when the progress isn't reported.
+	progress     chan<- AddProgress
+	total        *int64
+	name         string
+	size         int64
+	bytes        int64
+	lastProgress int64
+}
+
+func newCtxReader(adder *Adder, path string, file files.File) *ctxReader {
+	r := &ctxReader{
+		ctx:      adder.ctx,
+		file:     file,
+		progress: adder.ProgressCh,
+		total:    &adder.readBytes,
+		name:     path,
+		size:     -1,
+	}
+	if size, err := file.Size(); err == nil {
+		r.size = size
+	}
+	return r
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.file.Read(p)
+	if cerr := r.ctx.Err(); cerr != nil {
+		// the read may have been waiting for the cancellation
+		return n, cerr
+	}
+	r.bytes += int64(n)
+	*r.total += int64(n)
+
+	if r.progress != nil && (r.bytes-r.lastProgress >= progressReaderIncrement || err == io.EOF) {
+		r.lastProgress = r.bytes
+		select {
+		case r.progress <- AddProgress{Name: r.name, Bytes: r.bytes, Size: r.size, Total: *r.total}:
+		case <-r.ctx.Done():
+			return n, r.ctx.Err()
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,142 @@
+package coreunix
+
+import (
+	"context"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// claims counts, for each block, the running adds which wrote it or found it
+// already stored. A canceled add only removes the blocks no other add claims,
+// so that two adds of the same content don't undo each other.
+var claims = struct {
+	sync.Mutex
+	m map[cid.Cid]int
+}{m: make(map[cid.Cid]int)}
+
+// rollbackDAG records the blocks an add writes, to remove the ones it
+// created when the add is canceled.
+type rollbackDAG struct {
+	ipld.DAGService
+
+	ctx context.Context
+	bs  bstore.Blockstore
+
+	// lk is held for reading while writing, and for writing while rolling
+	// back, so that no write outlives the rollback.
+	lk sync.RWMutex
+
+	// claimed and created are guarded by claims.
+	claimed map[cid.Cid]struct{}
+	created []cid.Cid
+}
+
+func newRollbackDAG(ctx context.Context, bs bstore.Blockstore, ds ipld.DAGService) *rollbackDAG {
+	return &rollbackDAG{
+		DAGService: ds,
+		ctx:        ctx,
+		bs:         bs,
+		claimed:    make(map[cid.Cid]struct{}),
+	}
+}
+
+func (r *rollbackDAG) Add(ctx context.Context, nd ipld.Node) error {
+	return r.AddMany(ctx, []ipld.Node{nd})
+}
+
+func (r *rollbackDAG) AddMany(ctx context.Context, nds []ipld.Node) error {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+
+	// the add was canceled, and may be rolled back already
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+
+	var created []cid.Cid
+	claims.Lock()
+	for _, nd := range nds {
+		c := nd.Cid()
+		if !r.claim(c) {
+			continue
+		}
+		has, err := r.bs.Has(c)
+		if err != nil {
+			claims.Unlock()
+			return err
+		}
+		if !has {
+			created = append(created, c)
+		}
+	}
+	claims.Unlock()
+
+	if err := r.DAGService.AddMany(ctx, nds); err != nil {
+		return err
+	}
+
+	claims.Lock()
+	r.created = append(r.created, created...)
+	claims.Unlock()
+	return nil
+}
+
+// claim records c as claimed by this add, and returns whether it wasn't
+// before. claims must be locked.
+func (r *rollbackDAG) claim(c cid.Cid) bool {
+	if _, ok := r.claimed[c]; ok {
+		return false
+	}
+	r.claimed[c] = struct{}{}
+	claims.m[c]++
+	return true
+}
+
+// Sync forwards to the wrapped DAGService, if it syncs.
+func (r *rollbackDAG) Sync() error {
+	if s, ok := r.DAGService.(syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// rollback removes the blocks the add created which no other running add
+// claims.
+func (r *rollbackDAG) rollback() error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	claims.Lock()
+	defer claims.Unlock()
+
+	var err error
+	for _, c := range r.created {
+		if claims.m[c] > 1 {
+			continue
+		}
+		if rerr := r.bs.DeleteBlock(c); rerr != nil && rerr != bstore.ErrNotFound && err == nil {
+			err = rerr
+		}
+	}
+	r.created = nil
+	return err
+}
+
+// release drops the claims of the add, once it is over.
+func (r *rollbackDAG) release() {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	claims.Lock()
+	defer claims.Unlock()
+
+	for c := range r.claimed {
+		if claims.m[c]--; claims.m[c] <= 0 {
+			delete(claims.m, c)
+		}
+	}
+	r.claimed = make(map[cid.Cid]struct{})
+}
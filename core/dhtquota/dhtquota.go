@@ -0,0 +1,313 @@
+// Package dhtquota bounds the records the node stores for the DHT.
+//
+// A node acting as a DHT server stores the provider records and the value
+// records (IPNS records and public keys) other peers put to it, without any
+// limit. The Store returned by New wraps the datastore given to the DHT and
+// evicts the least recently used records once their number or total size
+// goes over the configured limits, so that a small node doesn't run out of
+// disk. The records stored and evicted are exported as metrics.
+package dhtquota
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log"
+	metrics "github.com/ipfs/go-metrics-interface"
+)
+
+var log = logging.Logger("dhtquota")
+
+// ConfigKey is the config key of the record store section.
+const ConfigKey = "Routing.RecordStore"
+
+// By default, the store holds up to a million records, and 256MiB of them.
+const (
+	DefaultMaxRecords = 1000000
+	DefaultMaxBytes   = 256 << 20
+)
+
+// Kinds of records.
+const (
+	Providers = "providers"
+	Values    = "values"
+)
+
+// providersPrefix is where the DHT stores provider records.
+var providersPrefix = ds.NewKey("/providers")
+
+// valueKey matches the keys of the value records: the DHT stores them at the
+// root, under the base32 encoding of the record key.
+var valueKey = regexp.MustCompile("^/[A-Z2-7]+$")
+
+// Config holds the Routing.RecordStore config section.
+type Config struct {
+	// MaxRecords is the maximum number of records stored.
+	MaxRecords int
+
+	// MaxBytes is the maximum total size of the records stored, keys
+	// included.
+	MaxBytes int64
+}
+
+// LoadConfig reads the Routing.RecordStore section of the config of r, with
+// defaults for the missing settings.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	if err := repo.LoadConfigKey(r, ConfigKey, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxRecords <= 0 {
+		cfg.MaxRecords = DefaultMaxRecords
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultMaxBytes
+	}
+	return cfg, nil
+}
+
+// KindStats are the statistics of a kind of records.
+type KindStats struct {
+	Records int
+	Bytes   int64
+	Evicted uint64
+}
+
+// Stats are the statistics of a Store.
+type Stats struct {
+	MaxRecords int
+	MaxBytes   int64
+	Kinds      map[string]KindStats
+}
+
+type entry struct {
+	key  ds.Key
+	kind string
+	size int64
+}
+
+type kindMetrics struct {
+	records metrics.Gauge
+	bytes   metrics.Gauge
+	evicted metrics.Counter
+}
+
+func newKindMetrics(ctx context.Context, kind string) *kindMetrics {
+	return &kindMetrics{
+		records: metrics.NewCtx(ctx, "dht_record_store_"+kind+"_records", fmt.Sprintf("Number of DHT %s records stored", kind)).Gauge(),
+		bytes:   metrics.NewCtx(ctx, "dht_record_store_"+kind+"_bytes", fmt.Sprintf("Size of the DHT %s records stored", kind)).Gauge(),
+		evicted: metrics.NewCtx(ctx, "dht_record_store_"+kind+"_evicted_total", fmt.Sprintf("Number of DHT %s records evicted", kind)).Counter(),
+	}
+}
+
+// Store is a datastore evicting the least recently used DHT records when
+// over quota. The keys that aren't DHT records are passed through.
+type Store struct {
+	ds.Batching
+	cfg Config
+
+	mu      sync.Mutex
+	lru     *list.List // of *entry, most recently used first
+	entries map[ds.Key]*list.Element
+	bytes   int64
+	kinds   map[string]*KindStats
+	metrics map[string]*kindMetrics
+}
+
+// New wraps d, accounting for the DHT records already stored in it.
+func New(ctx context.Context, d ds.Batching, cfg Config) (*Store, error) {
+	s := &Store{
+		Batching: d,
+		cfg:      cfg,
+		lru:      list.New(),
+		entries:  make(map[ds.Key]*list.Element),
+		kinds:    make(map[string]*KindStats),
+		metrics:  make(map[string]*kindMetrics),
+	}
+	for _, kind := range []string{Providers, Values} {
+		s.kinds[kind] = &KindStats{}
+		s.metrics[kind] = newKindMetrics(ctx, kind)
+	}
+
+	if err := s.load(providersPrefix.String()); err != nil {
+		return nil, err
+	}
+	if err := s.load("/"); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s, s.evict()
+}
+
+// load accounts for the records under prefix.
+func (s *Store) load(prefix string) error {
+	res, err := s.Batching.Query(query.Query{Prefix: prefix})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		k := ds.NewKey(r.Key)
+		if _, ok := s.entries[k]; ok {
+			continue
+		}
+		if kind := kindOf(k); kind != "" {
+			s.add(k, kind, len(r.Value))
+		}
+	}
+	return nil
+}
+
+// kindOf returns the kind of the record at k, or "" if k isn't a record.
+func kindOf(k ds.Key) string {
+	switch {
+	case k.IsDescendantOf(providersPrefix):
+		return Providers
+	case valueKey.MatchString(k.String()):
+		return Values
+	default:
+		return ""
+	}
+}
+
+// add accounts for the record at k, or updates it, and marks it used.
+func (s *Store) add(k ds.Key, kind string, n int) {
+	size := int64(len(k.String()) + n)
+	if el, ok := s.entries[k]; ok {
+		e := el.Value.(*entry)
+		s.account(e, -1)
+		e.size = size
+		s.account(e, 1)
+		s.lru.MoveToFront(el)
+		return
+	}
+	e := &entry{key: k, kind: kind, size: size}
+	s.entries[k] = s.lru.PushFront(e)
+	s.account(e, 1)
+}
+
+func (s *Store) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	s.lru.Remove(el)
+	delete(s.entries, e.key)
+	s.account(e, -1)
+}
+
+// account adds (sign 1) or removes (sign -1) e from the totals.
+func (s *Store) account(e *entry, sign int) {
+	st, m := s.kinds[e.kind], s.metrics[e.kind]
+	st.Records += sign
+	st.Bytes += int64(sign) * e.size
+	s.bytes += int64(sign) * e.size
+	m.records.Add(float64(sign))
+	m.bytes.Add(float64(int64(sign) * e.size))
+}
+
+// evict deletes the least recently used records until the store is within
+// its limits.
+func (s *Store) evict() error {
+	for len(s.entries) > s.cfg.MaxRecords || s.bytes > s.cfg.MaxBytes {
+		el := s.lru.Back()
+		e := el.Value.(*entry)
+		if err := s.Batching.Delete(e.key); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+		s.remove(el)
+		s.kinds[e.kind].Evicted++
+		s.metrics[e.kind].evicted.Inc()
+		log.Debugf("evicted DHT record %s", e.key)
+	}
+	return nil
+}
+
+// touch marks the record at k used.
+func (s *Store) touch(k ds.Key) {
+	s.mu.Lock()
+	if el, ok := s.entries[k]; ok {
+		s.lru.MoveToFront(el)
+	}
+	s.mu.Unlock()
+}
+
+func (s *Store) Put(k ds.Key, v []byte) error {
+	if err := s.Batching.Put(k, v); err != nil {
+		return err
+	}
+	kind := kindOf(k)
+	if kind == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(k, kind, len(v))
+	return s.evict()
+}
+
+func (s *Store) Get(k ds.Key) ([]byte, error) {
+	v, err := s.Batching.Get(k)
+	if err == nil {
+		s.touch(k)
+	}
+	return v, err
+}
+
+func (s *Store) Has(k ds.Key) (bool, error) {
+	has, err := s.Batching.Has(k)
+	if has {
+		s.touch(k)
+	}
+	return has, err
+}
+
+func (s *Store) Delete(k ds.Key) error {
+	if err := s.Batching.Delete(k); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if el, ok := s.entries[k]; ok {
+		s.remove(el)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Batch returns a batch applying its operations through the store, so that
+// they are accounted for.
+func (s *Store) Batch() (ds.Batch, error) {
+	return ds.NewBasicBatch(s), nil
+}
+
+// Stats returns the statistics of the store. It is nil-safe.
+func (s *Store) Stats() *Stats {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := &Stats{
+		MaxRecords: s.cfg.MaxRecords,
+		MaxBytes:   s.cfg.MaxBytes,
+		Kinds:      make(map[string]KindStats, len(s.kinds)),
+	}
+	for kind, st := range s.kinds {
+		out.Kinds[kind] = *st
+	}
+	return out
+}
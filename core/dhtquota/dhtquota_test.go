@@ -0,0 +1,97 @@
+package dhtquota
+
+import (
+	"context"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+func providerKey(i int) ds.Key {
+	return providersPrefix.ChildString("CID").ChildString(string(rune('A' + i)))
+}
+
+func TestEvictLeastRecentlyUsed(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	s, err := New(context.Background(), d, Config{MaxRecords: 3, MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := s.Put(providerKey(i), []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first record is now the most recently used
+	if _, err := s.Get(providerKey(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ds.NewKey("/ABCDEF"), []byte("record")); err != nil {
+		t.Fatal(err)
+	}
+
+	if has, _ := d.Has(providerKey(1)); has {
+		t.Fatal("expected the least recently used record to be evicted")
+	}
+	for _, k := range []ds.Key{providerKey(0), providerKey(2), ds.NewKey("/ABCDEF")} {
+		if has, _ := d.Has(k); !has {
+			t.Fatalf("expected %s to be kept", k)
+		}
+	}
+
+	st := s.Stats()
+	if st.Kinds[Providers].Records != 2 || st.Kinds[Providers].Evicted != 1 || st.Kinds[Values].Records != 1 {
+		t.Fatalf("unexpected stats %+v", st.Kinds)
+	}
+}
+
+func TestOtherKeysIgnored(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	s, err := New(context.Background(), d, Config{MaxRecords: 1, MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range []string{"/local/filesroot", "/ipns/ABC", "/pins"} {
+		if err := s.Put(ds.NewKey(k), []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put(providerKey(0), []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"/local/filesroot", "/ipns/ABC", "/pins"} {
+		if has, _ := d.Has(ds.NewKey(k)); !has {
+			t.Fatalf("expected %s not to count as a record", k)
+		}
+	}
+}
+
+func TestLoadExisting(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	for i := 0; i < 4; i++ {
+		if err := d.Put(providerKey(i), make([]byte, 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the records already stored are accounted for, and trimmed to the
+	// limits
+	s, err := New(context.Background(), d, Config{MaxRecords: 10, MaxBytes: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := s.Stats()
+	if st.Kinds[Providers].Records != 2 || st.Kinds[Providers].Bytes > 300 {
+		t.Fatalf("expected the records to be trimmed to 300 bytes, got %+v", st.Kinds[Providers])
+	}
+
+	if err := s.Delete(providerKey(3)); err != nil && err != ds.ErrNotFound {
+		t.Fatal(err)
+	}
+	if s.Stats().Kinds[Providers].Records > 2 {
+		t.Fatal("expected deleted records to be forgotten")
+	}
+}
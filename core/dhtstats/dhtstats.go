@@ -0,0 +1,226 @@
+// Package dhtstats tracks the health of the DHT of the node: the size and
+// the bucket utilization of its routing table, the churn of the peers in the
+// table and the latency of the queries.
+//
+// A partitioned DHT shows up as a routing table shrinking to a few peers, a
+// churn spike, or queries timing out.
+package dhtstats
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	kb "github.com/libp2p/go-libp2p-kbucket"
+)
+
+// BucketSize is the number of peers a bucket of the routing table holds.
+const BucketSize = 20
+
+// ChurnWindow is the period over which the churn rate is computed.
+const ChurnWindow = 10 * time.Minute
+
+// maxChurnEvents bounds the memory used to compute the churn rate.
+const maxChurnEvents = 10000
+
+// ErrNoDHT is returned when the node doesn't run a DHT.
+var ErrNoDHT = errors.New("the node doesn't run a DHT")
+
+// LatencyBuckets are the upper bounds of the query latency histograms. The
+// last bucket counts the queries slower than the last bound.
+var LatencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+// Bucket holds the utilization of the routing table bucket of the peers
+// sharing CPL bits of prefix with the node.
+type Bucket struct {
+	CPL      int
+	Peers    int
+	Capacity int
+}
+
+// Histogram holds the latency histogram of a kind of query.
+type Histogram struct {
+	Count  uint64
+	Errors uint64
+	Total  time.Duration
+
+	// Buckets[i] counts the queries faster than LatencyBuckets[i], and not
+	// faster than the previous bound; the last count is for slower queries.
+	Buckets []uint64
+}
+
+// Mean returns the mean latency of the queries.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Total / time.Duration(h.Count)
+}
+
+// Stats is a snapshot of the DHT health.
+type Stats struct {
+	RoutingTableSize int
+	Buckets          []Bucket
+
+	PeersAdded   uint64
+	PeersRemoved uint64
+
+	// ChurnPerMinute is the number of peers added to or removed from the
+	// routing table per minute, over the last ChurnWindow.
+	ChurnPerMinute float64
+
+	// Queries holds the latency histograms, by kind of query.
+	Queries map[string]Histogram
+}
+
+// Tracker tracks the health of a DHT.
+type Tracker struct {
+	dht     *dht.IpfsDHT
+	started time.Time
+
+	mu      sync.Mutex
+	added   uint64
+	removed uint64
+	churn   []time.Time
+	queries map[string]*Histogram
+}
+
+// New starts tracking d. It must be called before d is bootstrapped.
+func New(d *dht.IpfsDHT) *Tracker {
+	t := &Tracker{
+		dht:     d,
+		started: time.Now(),
+		queries: make(map[string]*Histogram),
+	}
+
+	rt := d.RoutingTable()
+	added, removed := rt.PeerAdded, rt.PeerRemoved
+	rt.PeerAdded = func(p peer.ID) {
+		t.peerChanged(true)
+		if added != nil {
+			added(p)
+		}
+	}
+	rt.PeerRemoved = func(p peer.ID) {
+		t.peerChanged(false)
+		if removed != nil {
+			removed(p)
+		}
+	}
+	return t
+}
+
+func (t *Tracker) peerChanged(added bool) {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if added {
+		t.added++
+	} else {
+		t.removed++
+	}
+	t.churn = append(t.churn, now)
+	t.pruneChurn(now)
+}
+
+// pruneChurn drops the churn events older than ChurnWindow.
+func (t *Tracker) pruneChurn(now time.Time) {
+	i := sort.Search(len(t.churn), func(i int) bool {
+		return now.Sub(t.churn[i]) <= ChurnWindow
+	})
+	if len(t.churn)-i > maxChurnEvents {
+		i = len(t.churn) - maxChurnEvents
+	}
+	t.churn = append(t.churn[:0], t.churn[i:]...)
+}
+
+// query records a query of the given kind which took d.
+func (t *Tracker) query(kind string, d time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.queries[kind]
+	if !ok {
+		h = &Histogram{Buckets: make([]uint64, len(LatencyBuckets)+1)}
+		t.queries[kind] = h
+	}
+	h.Count++
+	h.Total += d
+	if err != nil {
+		h.Errors++
+	}
+	i := sort.Search(len(LatencyBuckets), func(i int) bool {
+		return d < LatencyBuckets[i]
+	})
+	h.Buckets[i]++
+}
+
+// Stats returns a snapshot of the DHT health. It fails with ErrNoDHT if t is
+// nil.
+func (t *Tracker) Stats() (Stats, error) {
+	if t == nil {
+		return Stats{}, ErrNoDHT
+	}
+
+	rt := t.dht.RoutingTable()
+	self := kb.ConvertPeerID(t.dht.PeerID())
+	byCPL := make(map[int]int)
+	maxCPL := 0
+	peers := rt.ListPeers()
+	for _, p := range peers {
+		cpl := kb.CommonPrefixLen(self, kb.ConvertPeerID(p))
+		byCPL[cpl]++
+		if cpl > maxCPL {
+			maxCPL = cpl
+		}
+	}
+
+	s := Stats{
+		RoutingTableSize: len(peers),
+		Queries:          make(map[string]Histogram),
+	}
+	for cpl := 0; cpl <= maxCPL && len(peers) > 0; cpl++ {
+		s.Buckets = append(s.Buckets, Bucket{CPL: cpl, Peers: byCPL[cpl], Capacity: BucketSize})
+	}
+
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pruneChurn(now)
+	// Right after startup, the routing table fills up: don't extrapolate
+	// from less than a minute.
+	window := ChurnWindow
+	if since := now.Sub(t.started); since < window {
+		window = since
+	}
+	if window < time.Minute {
+		window = time.Minute
+	}
+	s.ChurnPerMinute = float64(len(t.churn)) / window.Minutes()
+	s.PeersAdded = t.added
+	s.PeersRemoved = t.removed
+
+	for kind, h := range t.queries {
+		hc := *h
+		hc.Buckets = append([]uint64(nil), h.Buckets...)
+		s.Queries[kind] = hc
+	}
+	return s, nil
+}
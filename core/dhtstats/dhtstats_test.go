@@ -0,0 +1,74 @@
+package dhtstats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	routing "github.com/libp2p/go-libp2p-core/routing"
+)
+
+type slowRouting struct {
+	routing.Routing
+	delay time.Duration
+}
+
+func (r *slowRouting) FindPeer(ctx context.Context, p peer.ID) (peer.AddrInfo, error) {
+	time.Sleep(r.delay)
+	return peer.AddrInfo{}, routing.ErrNotFound
+}
+
+func newTestTracker() *Tracker {
+	return &Tracker{started: time.Now(), queries: make(map[string]*Histogram)}
+}
+
+func TestQueryHistogram(t *testing.T) {
+	tr := newTestTracker()
+	r := tr.Routing(&slowRouting{delay: 20 * time.Millisecond})
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.FindPeer(context.Background(), ""); err != routing.ErrNotFound {
+			t.Fatalf("expected the error of the wrapped router, got %v", err)
+		}
+	}
+
+	h := tr.queries[QueryFindPeer]
+	if h == nil || h.Count != 3 || h.Errors != 3 {
+		t.Fatalf("unexpected histogram: %+v", h)
+	}
+	// 20ms falls in the [10ms, 50ms) bucket.
+	if h.Buckets[1] != 3 {
+		t.Fatalf("expected the queries in the second bucket, got %v", h.Buckets)
+	}
+	if h.Mean() < 20*time.Millisecond {
+		t.Fatalf("expected a mean of at least 20ms, got %s", h.Mean())
+	}
+}
+
+func TestChurn(t *testing.T) {
+	tr := newTestTracker()
+	for i := 0; i < 5; i++ {
+		tr.peerChanged(true)
+	}
+	tr.peerChanged(false)
+
+	// Events older than the window are dropped.
+	tr.churn[0] = time.Now().Add(-2 * ChurnWindow)
+	tr.pruneChurn(time.Now())
+
+	if tr.added != 5 || tr.removed != 1 || len(tr.churn) != 5 {
+		t.Fatalf("unexpected churn: %d added, %d removed, %d events", tr.added, tr.removed, len(tr.churn))
+	}
+}
+
+func TestNilTracker(t *testing.T) {
+	var tr *Tracker
+	r := &slowRouting{}
+	if tr.Routing(r) != r {
+		t.Fatal("expected a nil Tracker not to wrap the router")
+	}
+	if _, err := tr.Stats(); err != ErrNoDHT {
+		t.Fatalf("expected ErrNoDHT, got %v", err)
+	}
+}
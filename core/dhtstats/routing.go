@@ -0,0 +1,135 @@
+package dhtstats
+
+import (
+	"context"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	routing "github.com/libp2p/go-libp2p-core/routing"
+)
+
+// Kinds of queries.
+const (
+	QueryFindPeer      = "find-peer"
+	QueryFindProviders = "find-providers"
+	QueryProvide       = "provide"
+	QueryGetValue      = "get-value"
+	QuerySearchValue   = "search-value"
+	QueryPutValue      = "put-value"
+)
+
+// Routing wraps r to record the latency of its queries. It is safe to call on
+// a nil Tracker, in which case r is returned as is.
+func (t *Tracker) Routing(r routing.Routing) routing.Routing {
+	if t == nil {
+		return r
+	}
+	return &trackedRouting{Routing: r, t: t}
+}
+
+type trackedRouting struct {
+	routing.Routing
+	t *Tracker
+}
+
+func (r *trackedRouting) FindPeer(ctx context.Context, p peer.ID) (peer.AddrInfo, error) {
+	start := time.Now()
+	pi, err := r.Routing.FindPeer(ctx, p)
+	r.t.query(QueryFindPeer, time.Since(start), err)
+	return pi, err
+}
+
+// FindProvidersAsync records the time until the first provider is found, or
+// until the query ends if none is.
+func (r *trackedRouting) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	start := time.Now()
+	in := r.Routing.FindProvidersAsync(ctx, c, count)
+	out := make(chan peer.AddrInfo)
+	go func() {
+		defer close(out)
+
+		found := false
+		for pi := range in {
+			if !found {
+				found = true
+				r.t.query(QueryFindProviders, time.Since(start), nil)
+			}
+			select {
+			case out <- pi:
+			case <-ctx.Done():
+				// Drain in, the query ends with ctx.
+				for range in {
+				}
+				return
+			}
+		}
+		if !found {
+			r.t.query(QueryFindProviders, time.Since(start), routing.ErrNotFound)
+		}
+	}()
+	return out
+}
+
+func (r *trackedRouting) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	start := time.Now()
+	err := r.Routing.Provide(ctx, c, announce)
+	if announce {
+		r.t.query(QueryProvide, time.Since(start), err)
+	}
+	return err
+}
+
+func (r *trackedRouting) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	start := time.Now()
+	val, err := r.Routing.GetValue(ctx, key, opts...)
+	r.t.query(QueryGetValue, time.Since(start), err)
+	return val, err
+}
+
+// SearchValue records the time until the search ends.
+func (r *trackedRouting) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	start := time.Now()
+	in, err := r.Routing.SearchValue(ctx, key, opts...)
+	if err != nil {
+		r.t.query(QuerySearchValue, time.Since(start), err)
+		return nil, err
+	}
+
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+
+		found := false
+		for val := range in {
+			found = true
+			select {
+			case out <- val:
+			case <-ctx.Done():
+				for range in {
+				}
+				r.t.query(QuerySearchValue, time.Since(start), ctx.Err())
+				return
+			}
+		}
+		var err error
+		if !found {
+			err = routing.ErrNotFound
+		}
+		r.t.query(QuerySearchValue, time.Since(start), err)
+	}()
+	return out, nil
+}
+
+func (r *trackedRouting) PutValue(ctx context.Context, key string, val []byte, opts ...routing.Option) error {
+	start := time.Now()
+	err := r.Routing.PutValue(ctx, key, val, opts...)
+	r.t.query(QueryPutValue, time.Since(start), err)
+	return err
+}
+
+// GetPublicKey keeps the fast path of the wrapped router, if any.
+func (r *trackedRouting) GetPublicKey(ctx context.Context, p peer.ID) (ci.PubKey, error) {
+	return routing.GetPublicKey(r.Routing, ctx, p)
+}
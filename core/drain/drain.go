@@ -0,0 +1,274 @@
+// Package drain lets the daemon finish its transfers before shutting down.
+//
+// When the node stops, the Drainer first tells the connected peers that the
+// node is going away, with a message on the goaway protocol, so that they
+// stop picking it as a provider. It then rejects the new inbound streams,
+// and waits until no block has been transferred for a moment, or until the
+// drain timeout, before the services and connections are closed.
+//
+// Like the stream meter, the Drainer wraps the host: only the streams opened
+// and handled through the wrapped host are seen.
+package drain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	logging "github.com/ipfs/go-log"
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+)
+
+var log = logging.Logger("drain")
+
+// ID is the protocol ID of the goaway protocol.
+const ID protocol.ID = "/ipfs/goaway/1.0.0"
+
+// ConfigKey is the config key of the drain timeout.
+const ConfigKey = "Swarm.DrainTimeout"
+
+// DefaultTimeout is the drain timeout when none is configured.
+const DefaultTimeout = 10 * time.Second
+
+var (
+	// IdleGrace is how long the transfers must have been idle for the
+	// drain to complete.
+	IdleGrace = 500 * time.Millisecond
+
+	// TransferProtocols are the prefixes of the protocols of the
+	// transfers waited for.
+	TransferProtocols = []protocol.ID{"/ipfs/bitswap"}
+)
+
+// goAwayTimeout bounds sending a goaway notice to a peer.
+const goAwayTimeout = 2 * time.Second
+
+// maxDepartTimeout caps the timeout announced by departing peers.
+const maxDepartTimeout = time.Minute
+
+// maxGoAwaySize bounds the size of the notices read from the stream.
+const maxGoAwaySize = 1 << 10
+
+// goAway is the notice sent to the peers of a draining node.
+type goAway struct {
+	// Timeout is how long the node keeps its connections open.
+	Timeout time.Duration
+}
+
+// LoadTimeout reads the drain timeout from the config of r. It returns 0 if
+// draining is disabled.
+func LoadTimeout(r repo.Repo) (time.Duration, error) {
+	var s string
+	if err := repo.LoadConfigKey(r, ConfigKey, &s); err != nil {
+		return 0, fmt.Errorf("%s: %s", ConfigKey, err)
+	}
+	if s == "" {
+		return DefaultTimeout, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", ConfigKey, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative", ConfigKey)
+	}
+	return d, nil
+}
+
+// Drainer drains the streams of a host on shutdown.
+type Drainer struct {
+	timeout time.Duration
+
+	draining   int32
+	lastActive int64 // unix nanoseconds, accessed atomically
+}
+
+// New creates a Drainer waiting up to timeout for the transfers to finish.
+// It returns nil if timeout is 0, which disables draining.
+func New(timeout time.Duration) *Drainer {
+	if timeout <= 0 {
+		return nil
+	}
+	return &Drainer{timeout: timeout}
+}
+
+// Host wraps h to track its transfers, and reject its new inbound streams
+// once draining. It is safe to call on a nil Drainer, in which case h is
+// returned as is.
+func (d *Drainer) Host(h host.Host) host.Host {
+	if d == nil {
+		return h
+	}
+	return &drainedHost{Host: h, d: d}
+}
+
+// Draining returns whether the node is draining.
+func (d *Drainer) Draining() bool {
+	return d != nil && atomic.LoadInt32(&d.draining) == 1
+}
+
+// HandleGoAway calls departing with the peers announcing they are going away,
+// and how long they keep their connections open.
+func HandleGoAway(h host.Host, departing func(p peer.ID, timeout time.Duration)) {
+	h.SetStreamHandler(ID, func(s inet.Stream) {
+		defer s.Close()
+		s.SetDeadline(time.Now().Add(goAwayTimeout))
+
+		var msg goAway
+		if err := json.NewDecoder(io.LimitReader(s, maxGoAwaySize)).Decode(&msg); err != nil {
+			s.Reset()
+			return
+		}
+		if msg.Timeout <= 0 || msg.Timeout > maxDepartTimeout {
+			msg.Timeout = maxDepartTimeout
+		}
+		p := s.Conn().RemotePeer()
+		log.Debugf("peer %s is going away", p.Pretty())
+		departing(p, msg.Timeout)
+	})
+}
+
+// Drain notifies the peers connected to h that the node is going away, then
+// rejects the new inbound streams and waits for the transfers to finish, at
+// most the drain timeout.
+func (d *Drainer) Drain(ctx context.Context, h host.Host) error {
+	if d == nil || !atomic.CompareAndSwapInt32(&d.draining, 0, 1) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	start := time.Now()
+	d.notify(ctx, h)
+
+	ticker := time.NewTicker(IdleGrace / 5)
+	defer ticker.Stop()
+	for !d.idle() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Warningf("transfers still active after the drain timeout of %s", d.timeout)
+			return nil
+		}
+	}
+	log.Infof("drained in %s", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// notify sends a goaway notice to the connected peers.
+func (d *Drainer) notify(ctx context.Context, h host.Host) {
+	ctx, cancel := context.WithTimeout(ctx, goAwayTimeout)
+	defer cancel()
+
+	msg := goAway{Timeout: d.timeout}
+	var wg sync.WaitGroup
+	for _, p := range h.Network().Peers() {
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			s, err := h.NewStream(ctx, p, ID)
+			if err != nil {
+				// peers running older versions don't speak the protocol
+				return
+			}
+			s.SetDeadline(time.Now().Add(goAwayTimeout))
+			if err := json.NewEncoder(s).Encode(&msg); err != nil {
+				s.Reset()
+				return
+			}
+			s.Close()
+		}(p)
+	}
+	wg.Wait()
+}
+
+// idle returns whether no transfer was active during the last IdleGrace.
+func (d *Drainer) idle() bool {
+	last := atomic.LoadInt64(&d.lastActive)
+	return time.Since(time.Unix(0, last)) >= IdleGrace
+}
+
+func (d *Drainer) active() {
+	atomic.StoreInt64(&d.lastActive, time.Now().UnixNano())
+}
+
+func isTransfer(p protocol.ID) bool {
+	for _, prefix := range TransferProtocols {
+		if strings.HasPrefix(string(p), string(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+type drainedHost struct {
+	host.Host
+	d *Drainer
+}
+
+func (h *drainedHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (inet.Stream, error) {
+	s, err := h.Host.NewStream(ctx, p, pids...)
+	if err != nil {
+		return nil, err
+	}
+	return h.d.track(s), nil
+}
+
+func (h *drainedHost) wrap(handler inet.StreamHandler) inet.StreamHandler {
+	return func(s inet.Stream) {
+		if h.d.Draining() && s.Protocol() != ID {
+			s.Reset()
+			return
+		}
+		handler(h.d.track(s))
+	}
+}
+
+func (h *drainedHost) SetStreamHandler(pid protocol.ID, handler inet.StreamHandler) {
+	h.Host.SetStreamHandler(pid, h.wrap(handler))
+}
+
+func (h *drainedHost) SetStreamHandlerMatch(pid protocol.ID, match func(string) bool, handler inet.StreamHandler) {
+	h.Host.SetStreamHandlerMatch(pid, match, h.wrap(handler))
+}
+
+// track marks the transfers as active whenever s carries data, if it is a
+// transfer stream.
+func (d *Drainer) track(s inet.Stream) inet.Stream {
+	if !isTransfer(s.Protocol()) {
+		return s
+	}
+	return &stream{Stream: s, d: d}
+}
+
+type stream struct {
+	inet.Stream
+	d *Drainer
+}
+
+func (s *stream) Read(b []byte) (int, error) {
+	n, err := s.Stream.Read(b)
+	if n > 0 {
+		s.d.active()
+	}
+	return n, err
+}
+
+func (s *stream) Write(b []byte) (int, error) {
+	n, err := s.Stream.Write(b)
+	if n > 0 {
+		s.d.active()
+	}
+	return n, err
+}
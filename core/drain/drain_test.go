@@ -0,0 +1,85 @@
+package drain
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+const testProtocol = "/ipfs/bitswap/test"
+
+func TestDrain(t *testing.T) {
+	defer func(grace time.Duration) { IdleGrace = grace }(IdleGrace)
+	IdleGrace = 50 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+
+	d := New(time.Second)
+	a, b := d.Host(hosts[0]), hosts[1]
+
+	a.SetStreamHandler(testProtocol, func(s inet.Stream) {
+		ioutil.ReadAll(s)
+		s.Close()
+	})
+
+	departed := make(chan peer.ID, 1)
+	HandleGoAway(b, func(p peer.ID, timeout time.Duration) {
+		if timeout != time.Second {
+			t.Errorf("expected the drain timeout, got %s", timeout)
+		}
+		departed <- p
+	})
+
+	// a transfer is active while the drain starts
+	d.active()
+
+	start := time.Now()
+	if err := d.Drain(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < IdleGrace/2 {
+		t.Fatal("expected the drain to wait for the active transfer")
+	}
+	if time.Since(start) >= time.Second {
+		t.Fatal("expected the drain to complete before the timeout")
+	}
+	if !d.Draining() {
+		t.Fatal("expected the node to be draining")
+	}
+
+	select {
+	case p := <-departed:
+		if p != a.ID() {
+			t.Fatalf("expected %s to depart, got %s", a.ID(), p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a goaway notice")
+	}
+
+	// new inbound streams are rejected
+	s, err := b.NewStream(ctx, a.ID(), testProtocol)
+	if err == nil {
+		s.Write([]byte("hello"))
+		if _, err = s.Read(make([]byte, 1)); err == nil || err == io.EOF {
+			t.Fatalf("expected the stream to be reset, got %v", err)
+		}
+	}
+
+	var nd *Drainer
+	if nd.Host(b) != b || nd.Draining() || nd.Drain(ctx, b) != nil {
+		t.Fatal("expected a nil drainer to do nothing")
+	}
+}
@@ -0,0 +1,224 @@
+// Package dsbreaker keeps a slow datastore from taking the node down.
+//
+// A Breaker tracks the latency of every datastore operation and the number of
+// operations in flight. When reads get slower than a threshold, or too many
+// operations pile up, the breaker opens: the blocks requested by other peers
+// over bitswap are no longer read from the datastore until it recovers, so
+// that serve requests are shed instead of queueing without bound. Local
+// operations are never shed.
+package dsbreaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("dsbreaker")
+
+// ConfigKey is the config key of the circuit breaker section.
+const ConfigKey = "Datastore.CircuitBreaker"
+
+// By default, the breaker opens when the reads take 500ms on average or 1024
+// operations are in flight, and stays open for 10 seconds.
+const (
+	DefaultMaxLatency  = 500 * time.Millisecond
+	DefaultMaxInFlight = 1024
+	DefaultCooldown    = 10 * time.Second
+)
+
+// ewmaWeight is the weight of a new latency sample in the moving average.
+const ewmaWeight = 0.1
+
+// ErrOverloaded is returned for the requests shed while the breaker is open.
+var ErrOverloaded = errors.New("datastore overloaded, request shed")
+
+// Config holds the Datastore.CircuitBreaker config section.
+type Config struct {
+	// Enabled tracks datastore latency and sheds bitswap requests when the
+	// datastore is saturated.
+	Enabled bool
+
+	// MaxLatency is the average read latency above which the breaker opens,
+	// e.g. "500ms".
+	MaxLatency string
+
+	// MaxInFlight is the number of concurrent datastore operations above
+	// which the breaker opens.
+	MaxInFlight int64
+
+	// Cooldown is how long the breaker stays open before letting requests
+	// through again, e.g. "10s".
+	Cooldown string
+}
+
+// OpStats are the statistics of one kind of datastore operation.
+type OpStats struct {
+	Count   uint64
+	Latency time.Duration // moving average
+}
+
+// Stats are the statistics of a Breaker.
+type Stats struct {
+	Open     bool
+	InFlight int64
+	Shed     uint64
+	Trips    uint64
+	Ops      map[string]OpStats
+}
+
+// Breaker tracks datastore latency and decides when to shed requests.
+type Breaker struct {
+	maxLatency  time.Duration
+	maxInFlight int64
+	cooldown    time.Duration
+
+	inFlight int64
+	shed     uint64
+
+	mu        sync.Mutex
+	ops       map[string]*OpStats
+	openUntil time.Time
+	trips     uint64
+}
+
+// Load returns a new Breaker if it is enabled in the config of r, or nil
+// otherwise.
+func Load(r repo.Repo) (*Breaker, error) {
+	var cfg Config
+	if err := repo.LoadConfigKey(r, ConfigKey, &cfg); err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	return New(cfg)
+}
+
+// New returns a Breaker configured with cfg. Its Enabled field is ignored.
+func New(cfg Config) (*Breaker, error) {
+	b := &Breaker{
+		maxInFlight: cfg.MaxInFlight,
+		ops:         make(map[string]*OpStats),
+	}
+	if b.maxInFlight <= 0 {
+		b.maxInFlight = DefaultMaxInFlight
+	}
+
+	var err error
+	if b.maxLatency, err = repo.ConfigDuration(ConfigKey, "MaxLatency", cfg.MaxLatency, DefaultMaxLatency); err != nil {
+		return nil, err
+	}
+	if b.cooldown, err = repo.ConfigDuration(ConfigKey, "Cooldown", cfg.Cooldown, DefaultCooldown); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Allow reports whether a request that can be shed may use the datastore.
+// It is safe to call on a nil Breaker.
+func (b *Breaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	if atomic.LoadInt64(&b.inFlight) > b.maxInFlight {
+		b.trip("too many datastore operations in flight")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(b.openUntil) {
+		atomic.AddUint64(&b.shed, 1)
+		return false
+	}
+
+	// Half-open: forget the latency measured while the datastore was
+	// saturated, and open again if new measurements are still too high.
+	b.openUntil = time.Time{}
+	for _, s := range b.ops {
+		s.Latency = 0
+	}
+	log.Info("datastore recovered, serving requests again")
+	return true
+}
+
+// Stats returns the current statistics.
+func (b *Breaker) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := Stats{
+		Open:     !b.openUntil.IsZero() && time.Now().Before(b.openUntil),
+		InFlight: atomic.LoadInt64(&b.inFlight),
+		Shed:     atomic.LoadUint64(&b.shed),
+		Trips:    b.trips,
+		Ops:      make(map[string]OpStats, len(b.ops)),
+	}
+	for op, st := range b.ops {
+		s.Ops[op] = *st
+	}
+	return s
+}
+
+// begin records the start of a datastore operation and returns the function
+// recording its end.
+func (b *Breaker) begin(op string) func() {
+	atomic.AddInt64(&b.inFlight, 1)
+	start := time.Now()
+	return func() {
+		atomic.AddInt64(&b.inFlight, -1)
+		b.record(op, time.Since(start))
+	}
+}
+
+func (b *Breaker) record(op string, d time.Duration) {
+	b.mu.Lock()
+	s, ok := b.ops[op]
+	if !ok {
+		s = new(OpStats)
+		b.ops[op] = s
+	}
+	s.Count++
+	if s.Latency == 0 {
+		s.Latency = d
+	} else {
+		s.Latency = time.Duration(ewmaWeight*float64(d) + (1-ewmaWeight)*float64(s.Latency))
+	}
+	slow := isRead(op) && s.Latency > b.maxLatency
+	latency := s.Latency
+	b.mu.Unlock()
+
+	if slow {
+		b.trip(fmt.Sprintf("datastore %s latency is %s", op, latency))
+	}
+}
+
+func (b *Breaker) trip(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(b.openUntil) {
+		return
+	}
+	b.openUntil = now.Add(b.cooldown)
+	b.trips++
+	log.Warningf("%s, shedding bitswap requests for %s", reason, b.cooldown)
+}
+
+func isRead(op string) bool {
+	switch op {
+	case opGet, opHas, opGetSize:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package dsbreaker
+
+import (
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+type slowDatastore struct {
+	ds.Batching
+	delay time.Duration
+}
+
+func (d *slowDatastore) Get(key ds.Key) ([]byte, error) {
+	time.Sleep(d.delay)
+	return d.Batching.Get(key)
+}
+
+func TestShedWhenSlow(t *testing.T) {
+	b, err := New(Config{MaxLatency: "10ms", Cooldown: "50ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slow := &slowDatastore{Batching: dssync.MutexWrap(ds.NewMapDatastore())}
+	local := blockstore.NewBlockstore(b.Datastore(slow))
+	served := b.Blockstore(local)
+
+	blk := blocks.NewBlock([]byte("some block"))
+	if err := local.Put(blk); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := served.Get(blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	slow.delay = 20 * time.Millisecond
+	for i := 0; i < 30 && !b.Stats().Open; i++ {
+		if _, err := local.Get(blk.Cid()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !b.Stats().Open {
+		t.Fatal("expected the breaker to be open")
+	}
+	if _, err := served.Get(blk.Cid()); err != ErrOverloaded {
+		t.Fatalf("expected the request to be shed, got %v", err)
+	}
+	if _, err := local.Get(blk.Cid()); err != nil {
+		t.Fatalf("local reads must not be shed: %s", err)
+	}
+
+	slow.delay = 0
+	time.Sleep(60 * time.Millisecond)
+	if _, err := served.Get(blk.Cid()); err != nil {
+		t.Fatalf("expected the breaker to close after the cooldown: %s", err)
+	}
+
+	s := b.Stats()
+	if s.Shed != 1 || s.Trips != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestShedWhenSaturated(t *testing.T) {
+	b, err := New(Config{MaxInFlight: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var done []func()
+	for i := 0; i < 3; i++ {
+		done = append(done, b.begin(opPut))
+	}
+	if b.Allow() {
+		t.Fatal("expected requests to be shed")
+	}
+	for _, f := range done {
+		f()
+	}
+}
+
+func TestNilBreaker(t *testing.T) {
+	var b *Breaker
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	if b.Datastore(d) != d {
+		t.Fatal("expected the datastore to be returned as is")
+	}
+	if !b.Allow() {
+		t.Fatal("a nil breaker must allow every request")
+	}
+}
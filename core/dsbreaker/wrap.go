@@ -0,0 +1,125 @@
+package dsbreaker
+
+import (
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// Names of the tracked datastore operations.
+const (
+	opGet     = "get"
+	opHas     = "has"
+	opGetSize = "getsize"
+	opPut     = "put"
+	opDelete  = "delete"
+	opQuery   = "query"
+	opBatch   = "batch"
+	opSync    = "sync"
+)
+
+// Datastore wraps d to track the latency of its operations. It is safe to
+// call on a nil Breaker, in which case d is returned as is.
+func (b *Breaker) Datastore(d ds.Batching) ds.Batching {
+	if b == nil {
+		return d
+	}
+	return &datastore{Batching: d, b: b}
+}
+
+type datastore struct {
+	ds.Batching
+	b *Breaker
+}
+
+func (d *datastore) Get(key ds.Key) ([]byte, error) {
+	defer d.b.begin(opGet)()
+	return d.Batching.Get(key)
+}
+
+func (d *datastore) Has(key ds.Key) (bool, error) {
+	defer d.b.begin(opHas)()
+	return d.Batching.Has(key)
+}
+
+func (d *datastore) GetSize(key ds.Key) (int, error) {
+	defer d.b.begin(opGetSize)()
+	return d.Batching.GetSize(key)
+}
+
+func (d *datastore) Put(key ds.Key, value []byte) error {
+	defer d.b.begin(opPut)()
+	return d.Batching.Put(key, value)
+}
+
+func (d *datastore) Delete(key ds.Key) error {
+	defer d.b.begin(opDelete)()
+	return d.Batching.Delete(key)
+}
+
+func (d *datastore) Query(q dsq.Query) (dsq.Results, error) {
+	defer d.b.begin(opQuery)()
+	return d.Batching.Query(q)
+}
+
+func (d *datastore) Sync(prefix ds.Key) error {
+	defer d.b.begin(opSync)()
+	return d.Batching.Sync(prefix)
+}
+
+func (d *datastore) Batch() (ds.Batch, error) {
+	batch, err := d.Batching.Batch()
+	if err != nil {
+		return nil, err
+	}
+	return &batchWrap{Batch: batch, b: d.b}, nil
+}
+
+type batchWrap struct {
+	ds.Batch
+	b *Breaker
+}
+
+func (bw *batchWrap) Commit() error {
+	defer bw.b.begin(opBatch)()
+	return bw.Batch.Commit()
+}
+
+// Blockstore wraps the blockstore used to serve other peers: while the
+// breaker is open, reads fail with ErrOverloaded without touching the
+// datastore. Writes are never shed. It is safe to call on a nil Breaker, in
+// which case bs is returned as is.
+func (b *Breaker) Blockstore(bs blockstore.Blockstore) blockstore.Blockstore {
+	if b == nil {
+		return bs
+	}
+	return &sheddingBlockstore{Blockstore: bs, b: b}
+}
+
+type sheddingBlockstore struct {
+	blockstore.Blockstore
+	b *Breaker
+}
+
+func (bs *sheddingBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	if !bs.b.Allow() {
+		return nil, ErrOverloaded
+	}
+	return bs.Blockstore.Get(c)
+}
+
+func (bs *sheddingBlockstore) GetSize(c cid.Cid) (int, error) {
+	if !bs.b.Allow() {
+		return -1, ErrOverloaded
+	}
+	return bs.Blockstore.GetSize(c)
+}
+
+func (bs *sheddingBlockstore) Has(c cid.Cid) (bool, error) {
+	if !bs.b.Allow() {
+		return false, ErrOverloaded
+	}
+	return bs.Blockstore.Has(c)
+}
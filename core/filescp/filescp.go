@@ -0,0 +1,192 @@
+// Package filescp tracks the copies of remote DAGs into MFS.
+//
+// Copying a DAG into MFS only links its root, and the rest of the DAG is
+// fetched lazily, when read. A Job fetches the whole DAG up front instead,
+// counting the blocks and bytes fetched so that the progress of the copy can
+// be reported while it runs, or later when it runs in the background.
+package filescp
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// maxFinished is the number of finished jobs kept for 'files status'.
+const maxFinished = 64
+
+// Status is the state of a copy.
+type Status struct {
+	ID      int
+	Source  string
+	Dest    string
+	Started time.Time
+
+	Done     bool
+	Finished time.Time `json:",omitempty"`
+	Error    string    `json:",omitempty"`
+
+	Blocks uint64
+	Bytes  uint64
+}
+
+// Job is a copy in progress.
+type Job struct {
+	id      int
+	src     string
+	dst     string
+	started time.Time
+
+	blocks uint64 // atomic
+	bytes  uint64 // atomic
+
+	mu       sync.Mutex
+	done     bool
+	finished time.Time
+	err      error
+}
+
+// Progress returns the number of blocks and bytes fetched so far.
+func (j *Job) Progress() (blocks, bytes uint64) {
+	return atomic.LoadUint64(&j.blocks), atomic.LoadUint64(&j.bytes)
+}
+
+func (j *Job) add(nd ipld.Node) {
+	atomic.AddUint64(&j.blocks, 1)
+	atomic.AddUint64(&j.bytes, uint64(len(nd.RawData())))
+}
+
+// Fetch fetches every block of the DAG of root through ng, the root
+// included, counting them in the progress of j.
+func (j *Job) Fetch(ctx context.Context, ng ipld.NodeGetter, root ipld.Node) error {
+	seen := cid.NewSet()
+	seen.Add(root.Cid())
+	j.add(root)
+	return j.fetchChildren(ctx, ng, root, seen)
+}
+
+func (j *Job) fetchChildren(ctx context.Context, ng ipld.NodeGetter, nd ipld.Node, seen *cid.Set) error {
+	var cids []cid.Cid
+	for _, l := range nd.Links() {
+		if seen.Visit(l.Cid) {
+			cids = append(cids, l.Cid)
+		}
+	}
+	if len(cids) == 0 {
+		return nil
+	}
+
+	// fetch the children at once, then descend into them
+	children := make([]ipld.Node, 0, len(cids))
+	for opt := range ng.GetMany(ctx, cids) {
+		if opt.Err != nil {
+			return opt.Err
+		}
+		j.add(opt.Node)
+		children = append(children, opt.Node)
+	}
+	if len(children) != len(cids) {
+		return ctx.Err()
+	}
+	for _, child := range children {
+		if err := j.fetchChildren(ctx, ng, child, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Finish marks j done, with the error of the copy if it failed.
+func (j *Job) Finish(err error) {
+	j.mu.Lock()
+	j.done = true
+	j.finished = time.Now()
+	j.err = err
+	j.mu.Unlock()
+}
+
+// Status returns the state of j.
+func (j *Job) Status() Status {
+	blocks, bytes := j.Progress()
+	st := Status{
+		ID:      j.id,
+		Source:  j.src,
+		Dest:    j.dst,
+		Started: j.started,
+		Blocks:  blocks,
+		Bytes:   bytes,
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st.Done = j.done
+	st.Finished = j.finished
+	if j.err != nil {
+		st.Error = j.err.Error()
+	}
+	return st
+}
+
+// Tracker keeps the copies of a node.
+type Tracker struct {
+	mu     sync.Mutex
+	nextID int
+	jobs   []*Job
+}
+
+// New returns an empty tracker.
+func New() *Tracker {
+	return &Tracker{nextID: 1}
+}
+
+// Start registers a copy from src to dst.
+func (t *Tracker) Start(src, dst string) *Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	j := &Job{id: t.nextID, src: src, dst: dst, started: time.Now()}
+	t.nextID++
+	t.jobs = append(t.jobs, j)
+	t.prune()
+	return j
+}
+
+// prune forgets the oldest finished jobs past maxFinished.
+func (t *Tracker) prune() {
+	finished := 0
+	for _, j := range t.jobs {
+		if j.Status().Done {
+			finished++
+		}
+	}
+	kept := t.jobs[:0]
+	for _, j := range t.jobs {
+		if finished > maxFinished && j.Status().Done {
+			finished--
+			continue
+		}
+		kept = append(kept, j)
+	}
+	t.jobs = kept
+}
+
+// Jobs returns the state of the copies in progress and of the last finished
+// ones, by ID.
+func (t *Tracker) Jobs() []Status {
+	t.mu.Lock()
+	out := make([]Status, 0, len(t.jobs))
+	for _, j := range t.jobs {
+		out = append(out, j.Status())
+	}
+	t.mu.Unlock()
+
+	sort.Slice(out, func(i, k int) bool {
+		return out[i].ID < out[k].ID
+	})
+	return out
+}
@@ -0,0 +1,74 @@
+package filescp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+func TestFetch(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+
+	leaf := dag.NodeWithData([]byte("leaf"))
+	mid := dag.NodeWithData([]byte("mid"))
+	if err := mid.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("mid", mid); err != nil {
+		t.Fatal(err)
+	}
+	// the leaf is linked twice, and fetched once
+	if err := root.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.AddMany(ctx, []ipld.Node{leaf, mid, root}); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := New()
+	j := tr.Start("/ipfs/"+root.Cid().String(), "/dst")
+	if err := j.Fetch(ctx, ds, root); err != nil {
+		t.Fatal(err)
+	}
+	j.Finish(nil)
+
+	blocks, bytes := j.Progress()
+	if blocks != 3 {
+		t.Fatalf("expected 3 blocks fetched, got %d", blocks)
+	}
+	size := uint64(len(leaf.RawData()) + len(mid.RawData()) + len(root.RawData()))
+	if bytes != size {
+		t.Fatalf("expected %d bytes fetched, got %d", size, bytes)
+	}
+
+	jobs := tr.Jobs()
+	if len(jobs) != 1 || !jobs[0].Done || jobs[0].Dest != "/dst" || jobs[0].Blocks != 3 {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tr := New()
+	running := tr.Start("/a", "/running")
+	for i := 0; i < maxFinished+10; i++ {
+		tr.Start("/a", "/b").Finish(errors.New("failed"))
+	}
+	tr.Start("/a", "/last")
+
+	jobs := tr.Jobs()
+	if len(jobs) > maxFinished+2 {
+		t.Fatalf("expected the finished jobs to be pruned, got %d jobs", len(jobs))
+	}
+	if jobs[0].ID != running.Status().ID || jobs[0].Done {
+		t.Fatal("expected the running job to be kept")
+	}
+	if jobs[len(jobs)-2].Error != "failed" {
+		t.Fatal("expected the error of the copy to be kept")
+	}
+}
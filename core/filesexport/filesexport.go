@@ -0,0 +1,314 @@
+// Package filesexport exports the changes of a unixfs tree since a snapshot
+// of it, for the periodic off-site syncs of the mfs of a writable node.
+//
+// A snapshot is the CID of the tree at a previous export. The tree is
+// compared with the snapshot, skipping the subtrees whose CID didn't change,
+// and the entries added or modified are written with a manifest listing them
+// and the paths deleted. The archive is either a tar file, holding the
+// content of the files changed, or a CAR file, holding the blocks of the tree
+// which are not in the snapshot: its receiver must hold the snapshot to
+// rebuild the tree.
+package filesexport
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	gopath "path"
+	"sort"
+	"time"
+
+	car "github.com/ipfs/go-ipfs/core/car"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	unixfs "github.com/ipfs/go-unixfs"
+	unixfile "github.com/ipfs/go-unixfs/file"
+	uio "github.com/ipfs/go-unixfs/io"
+)
+
+// ManifestName is the name of the manifest in the tar archives, written
+// first.
+const ManifestName = ".ipfs-export.json"
+
+// Archive formats.
+const (
+	FormatTar = "tar"
+	FormatCar = "car"
+)
+
+// Manifest describes an export. In a CAR file, it is the first root, as a
+// raw block, and the tree is the second one.
+type Manifest struct {
+	// Root is the snapshot exported, to give as the Since of the next
+	// export.
+	Root  string
+	Since string `json:",omitempty"`
+
+	// Changed lists the files and directories added or modified, and
+	// Deleted the paths removed, relative to the root. The deletions are
+	// applied first: a path changing from a file to a directory, or the
+	// other way around, is listed in both.
+	Changed []string
+	Deleted []string
+}
+
+type entry struct {
+	path string
+	nd   ipld.Node
+	dir  bool
+}
+
+// Diff holds the changes of a tree since a snapshot.
+type Diff struct {
+	Root  cid.Cid
+	Since cid.Cid
+
+	entries   []entry
+	deleted   []string
+	unchanged *cid.Set
+}
+
+// Compare compares the tree root with the snapshot since, which is nil for a
+// full export. Both must be unixfs directories.
+func Compare(ctx context.Context, ds ipld.DAGService, root, since ipld.Node) (*Diff, error) {
+	d := &Diff{
+		Root:      root.Cid(),
+		unchanged: cid.NewSet(),
+	}
+	if since != nil {
+		d.Since = since.Cid()
+	}
+	if !isDir(root) || (since != nil && !isDir(since)) {
+		return nil, fmt.Errorf("only directories can be exported")
+	}
+	if err := d.compare(ctx, ds, "", since, root); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Diff) compare(ctx context.Context, ds ipld.DAGService, p string, old, nd ipld.Node) error {
+	links, err := dirLinks(ctx, ds, nd)
+	if err != nil {
+		return err
+	}
+	oldLinks := map[string]*ipld.Link{}
+	if old != nil {
+		if oldLinks, err = dirLinks(ctx, ds, old); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range sortedNames(links) {
+		l, cp := links[name], gopath.Join(p, name)
+		ol, existed := oldLinks[name]
+		if existed && ol.Cid.Equals(l.Cid) {
+			d.unchanged.Add(l.Cid)
+			continue
+		}
+
+		child, err := l.GetNode(ctx, ds)
+		if err != nil {
+			return fmt.Errorf("%s: %s", cp, err)
+		}
+		var oldChild ipld.Node
+		if existed {
+			if oldChild, err = ol.GetNode(ctx, ds); err != nil {
+				return fmt.Errorf("%s: %s", cp, err)
+			}
+			if isDir(oldChild) != isDir(child) {
+				d.deleted = append(d.deleted, cp)
+				oldChild = nil
+			}
+		}
+
+		if !isDir(child) {
+			d.entries = append(d.entries, entry{path: cp, nd: child})
+			continue
+		}
+		if oldChild == nil {
+			d.entries = append(d.entries, entry{path: cp, nd: child, dir: true})
+		}
+		if err := d.compare(ctx, ds, cp, oldChild, child); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range sortedNames(oldLinks) {
+		if _, ok := links[name]; !ok {
+			d.deleted = append(d.deleted, gopath.Join(p, name))
+		}
+	}
+	return nil
+}
+
+// Manifest returns the manifest of d.
+func (d *Diff) Manifest() *Manifest {
+	m := &Manifest{
+		Root:    d.Root.String(),
+		Changed: make([]string, 0, len(d.entries)),
+		Deleted: append([]string{}, d.deleted...),
+	}
+	if d.Since.Defined() {
+		m.Since = d.Since.String()
+	}
+	for _, e := range d.entries {
+		m.Changed = append(m.Changed, e.path)
+	}
+	return m
+}
+
+// Write writes the archive of d to w, in format.
+func (d *Diff) Write(ctx context.Context, ds ipld.DAGService, format string, w io.Writer) error {
+	switch format {
+	case FormatTar:
+		return d.writeTar(ctx, ds, w)
+	case FormatCar:
+		return d.writeCar(ctx, ds, w)
+	default:
+		return fmt.Errorf("unknown export format %q: use %s or %s", format, FormatTar, FormatCar)
+	}
+}
+
+func (d *Diff) writeTar(ctx context.Context, ds ipld.DAGService, w io.Writer) error {
+	manifest, err := json.Marshal(d.Manifest())
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tw := tar.NewWriter(w)
+	err = tw.WriteHeader(&tar.Header{
+		Name:     ManifestName,
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     int64(len(manifest)),
+		ModTime:  now,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+
+	for _, e := range d.entries {
+		if e.dir {
+			err := tw.WriteHeader(&tar.Header{
+				Name:     e.path + "/",
+				Typeflag: tar.TypeDir,
+				Mode:     0755,
+				ModTime:  now,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		f, err := unixfile.NewUnixfsFile(ctx, ds, e.nd)
+		if err != nil {
+			return fmt.Errorf("%s: %s", e.path, err)
+		}
+		switch f := f.(type) {
+		case *files.Symlink:
+			err = tw.WriteHeader(&tar.Header{
+				Name:     e.path,
+				Typeflag: tar.TypeSymlink,
+				Linkname: f.Target,
+				Mode:     0777,
+				ModTime:  now,
+			})
+		case files.File:
+			err = writeTarFile(tw, e.path, f, now)
+		default:
+			err = fmt.Errorf("unexpected node type %T", f)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", e.path, err)
+		}
+	}
+	return tw.Close()
+}
+
+func writeTarFile(tw *tar.Writer, p string, f files.File, modTime time.Time) error {
+	defer f.Close()
+	size, err := f.Size()
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:     p,
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func (d *Diff) writeCar(ctx context.Context, ds ipld.DAGService, w io.Writer) error {
+	b, err := json.Marshal(d.Manifest())
+	if err != nil {
+		return err
+	}
+	manifest := dag.NewRawNode(b)
+	ng := manifestGetter{NodeGetter: ds, manifest: manifest}
+	return car.WriteSkipping(ctx, ng, []cid.Cid{manifest.Cid(), d.Root}, d.unchanged, w)
+}
+
+// manifestGetter gets the manifest node of a CAR file along the nodes of the
+// tree.
+type manifestGetter struct {
+	ipld.NodeGetter
+	manifest ipld.Node
+}
+
+func (g manifestGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	if c.Equals(g.manifest.Cid()) {
+		return g.manifest, nil
+	}
+	return g.NodeGetter.Get(ctx, c)
+}
+
+func isDir(nd ipld.Node) bool {
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return false
+	}
+	fsn, err := unixfs.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return false
+	}
+	return fsn.Type() == unixfs.TDirectory || fsn.Type() == unixfs.THAMTShard
+}
+
+func dirLinks(ctx context.Context, ds ipld.DAGService, nd ipld.Node) (map[string]*ipld.Link, error) {
+	dir, err := uio.NewDirectoryFromNode(ds, nd)
+	if err != nil {
+		return nil, err
+	}
+	links := make(map[string]*ipld.Link)
+	err = dir.ForEachLink(ctx, func(l *ipld.Link) error {
+		links[l.Name] = l
+		return nil
+	})
+	return links, err
+}
+
+func sortedNames(links map[string]*ipld.Link) []string {
+	names := make([]string, 0, len(links))
+	for name := range links {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
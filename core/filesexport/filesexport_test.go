@@ -0,0 +1,150 @@
+package filesexport
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	car "github.com/ipfs/go-ipfs/core/car"
+
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	unixfs "github.com/ipfs/go-unixfs"
+	uio "github.com/ipfs/go-unixfs/io"
+)
+
+func file(t *testing.T, ds ipld.DAGService, data string) ipld.Node {
+	nd := dag.NodeWithData(unixfs.FilePBData([]byte(data), uint64(len(data))))
+	if err := ds.Add(context.Background(), nd); err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func dir(t *testing.T, ds ipld.DAGService, children map[string]ipld.Node) ipld.Node {
+	ctx := context.Background()
+	d := uio.NewDirectory(ds)
+	for name, nd := range children {
+		if err := d.AddChild(ctx, name, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nd, err := d.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+
+	kept := dir(t, ds, map[string]ipld.Node{"big": file(t, ds, "unchanged")})
+	since := dir(t, ds, map[string]ipld.Node{
+		"kept":    kept,
+		"a":       file(t, ds, "a1"),
+		"gone":    file(t, ds, "gone"),
+		"became":  file(t, ds, "a file"),
+		"sub":     dir(t, ds, map[string]ipld.Node{"x": file(t, ds, "x1"), "y": file(t, ds, "y")}),
+		"emptied": dir(t, ds, map[string]ipld.Node{"z": file(t, ds, "z")}),
+	})
+	root := dir(t, ds, map[string]ipld.Node{
+		"kept":    kept,
+		"a":       file(t, ds, "a2"),
+		"new":     file(t, ds, "new"),
+		"became":  dir(t, ds, map[string]ipld.Node{"f": file(t, ds, "in a dir")}),
+		"sub":     dir(t, ds, map[string]ipld.Node{"x": file(t, ds, "x2"), "y": file(t, ds, "y")}),
+		"emptied": dir(t, ds, nil),
+	})
+
+	d, err := Compare(ctx, ds, root, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := d.Manifest()
+	expected := &Manifest{
+		Root:    root.Cid().String(),
+		Since:   since.Cid().String(),
+		Changed: []string{"a", "became", "became/f", "new", "sub/x"},
+		Deleted: []string{"became", "emptied/z", "gone"},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, m)
+	}
+
+	var buf bytes.Buffer
+	if err := d.Write(ctx, ds, FormatTar, &buf); err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(&buf)
+	contents := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[hdr.Name] = string(b)
+	}
+	var tm Manifest
+	if err := json.Unmarshal([]byte(contents[ManifestName]), &tm); err != nil || !reflect.DeepEqual(&tm, expected) {
+		t.Fatalf("unexpected manifest in the tar: %v %s", err, contents[ManifestName])
+	}
+	for p, data := range map[string]string{"a": "a2", "became/": "", "became/f": "in a dir", "new": "new", "sub/x": "x2"} {
+		if got, ok := contents[p]; !ok || got != data {
+			t.Fatalf("expected %s to hold %q, got %q", p, data, got)
+		}
+	}
+	if len(contents) != 6 {
+		t.Fatalf("unexpected tar entries %v", contents)
+	}
+
+	buf.Reset()
+	if err := d.Write(ctx, ds, FormatCar, &buf); err != nil {
+		t.Fatal(err)
+	}
+	cr, err := car.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cr.Header.Roots) != 2 || !cr.Header.Roots[1].Equals(root.Cid()) {
+		t.Fatalf("unexpected roots %v", cr.Header.Roots)
+	}
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blk.Cid().Equals(kept.Cid()) {
+			t.Fatal("expected the unchanged directory to be left out of the CAR file")
+		}
+	}
+
+	// a full export lists every entry
+	d, err = Compare(ctx, ds, root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := d.Manifest(); len(m.Changed) != 10 || len(m.Deleted) != 0 || m.Since != "" {
+		t.Fatalf("unexpected full export %+v", m)
+	}
+}
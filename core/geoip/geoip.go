@@ -0,0 +1,267 @@
+// Package geoip locates the addresses of the peers, by country and
+// autonomous system, in offline databases.
+//
+// The databases are CSV files with a header row, one IP range per row. The
+// range is given by a "network" column in CIDR notation, or by "start_ip" and
+// "end_ip" columns. The other columns recognized are:
+//
+//	country, country_code                            ISO 3166 country code
+//	asn, autonomous_system_number                    AS number, as 13335 or AS13335
+//	as_name, as_org, autonomous_system_organization  name of the AS
+//
+// This covers the ipinfo.io country_asn database and the MaxMind GeoLite2 ASN
+// CSV database, among others. The ranges of a database must not overlap.
+package geoip
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+// ConfigKey is the config key of the geolocation section.
+const ConfigKey = "Swarm.GeoIP"
+
+// Config holds the Swarm.GeoIP config section.
+type Config struct {
+	// Databases are the paths of the databases, relative to the repo if
+	// not absolute. The first database locating an address sets each
+	// field of its location.
+	Databases []string
+}
+
+// LoadConfig reads the Swarm.GeoIP section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// Location is where an address is.
+type Location struct {
+	Country string `json:",omitempty"`
+	ASN     uint32 `json:",omitempty"`
+	Org     string `json:",omitempty"`
+}
+
+// IsZero returns whether nothing is known of l.
+func (l Location) IsZero() bool {
+	return l == Location{}
+}
+
+// String returns the country and the AS of l, as "US AS13335".
+func (l Location) String() string {
+	var parts []string
+	if l.Country != "" {
+		parts = append(parts, l.Country)
+	}
+	if l.ASN != 0 {
+		parts = append(parts, fmt.Sprintf("AS%d", l.ASN))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ipRange is a range of addresses, in their 16 bytes form.
+type ipRange struct {
+	start, end net.IP
+	loc        *Location
+}
+
+// table is a database, sorted by the start of the ranges.
+type table []ipRange
+
+func (t table) lookup(ip net.IP) *Location {
+	i := sort.Search(len(t), func(i int) bool {
+		return bytes.Compare(t[i].start, ip) > 0
+	})
+	if i == 0 {
+		return nil
+	}
+	if r := t[i-1]; bytes.Compare(ip, r.end) <= 0 {
+		return r.loc
+	}
+	return nil
+}
+
+// DB locates addresses.
+type DB struct {
+	tables []table
+}
+
+// Open reads the databases of paths.
+func Open(paths ...string) (*DB, error) {
+	db := &DB{}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		t, err := readTable(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %s", p, err)
+		}
+		db.tables = append(db.tables, t)
+	}
+	return db, nil
+}
+
+// Read reads a database from r.
+func Read(r io.Reader) (*DB, error) {
+	t, err := readTable(r)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{tables: []table{t}}, nil
+}
+
+func readTable(r io.Reader) (table, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := make(map[string]int)
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	find := func(names ...string) int {
+		for _, n := range names {
+			if i, ok := col[n]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	network := find("network")
+	start, end := find("start_ip"), find("end_ip")
+	if network < 0 && (start < 0 || end < 0) {
+		return nil, fmt.Errorf("expected a network column, or start_ip and end_ip columns")
+	}
+	country := find("country", "country_code")
+	asn := find("asn", "autonomous_system_number")
+	org := find("as_name", "as_org", "autonomous_system_organization")
+
+	field := func(rec []string, i int) string {
+		if i < 0 || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	// the rows of a same location share it
+	locs := make(map[Location]*Location)
+	var t table
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var r ipRange
+		if network >= 0 && field(rec, network) != "" {
+			_, n, err := net.ParseCIDR(field(rec, network))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			r.start = n.IP.To16()
+			r.end = make(net.IP, net.IPv6len)
+			mask := n.Mask
+			if len(mask) == net.IPv4len {
+				mask = append(net.CIDRMask(96, 128)[:12:12], mask...)
+			}
+			for i := range r.end {
+				r.end[i] = r.start[i] | ^mask[i]
+			}
+		} else {
+			r.start = net.ParseIP(field(rec, start)).To16()
+			r.end = net.ParseIP(field(rec, end)).To16()
+			if r.start == nil || r.end == nil || bytes.Compare(r.start, r.end) > 0 {
+				return nil, fmt.Errorf("line %d: invalid range %s-%s", line, field(rec, start), field(rec, end))
+			}
+		}
+
+		var loc Location
+		loc.Country = strings.ToUpper(field(rec, country))
+		if s := strings.TrimPrefix(strings.ToUpper(field(rec, asn)), "AS"); s != "" {
+			n, err := strconv.ParseUint(s, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid AS number %q", line, field(rec, asn))
+			}
+			loc.ASN = uint32(n)
+		}
+		loc.Org = field(rec, org)
+		if loc.IsZero() {
+			continue
+		}
+		if l, ok := locs[loc]; ok {
+			r.loc = l
+		} else {
+			r.loc = &loc
+			locs[loc] = r.loc
+		}
+		t = append(t, r)
+	}
+
+	sort.Slice(t, func(i, j int) bool {
+		return bytes.Compare(t[i].start, t[j].start) < 0
+	})
+	return t, nil
+}
+
+// Lookup returns the location of ip, zero if unknown. A nil DB knows no
+// location.
+func (db *DB) Lookup(ip net.IP) Location {
+	var loc Location
+	if db == nil {
+		return loc
+	}
+	ip = ip.To16()
+	if ip == nil {
+		return loc
+	}
+	for _, t := range db.tables {
+		l := t.lookup(ip)
+		if l == nil {
+			continue
+		}
+		if loc.Country == "" {
+			loc.Country = l.Country
+		}
+		if loc.ASN == 0 {
+			loc.ASN, loc.Org = l.ASN, l.Org
+		}
+	}
+	return loc
+}
+
+// LookupAddr returns the location of the IP address of a, zero if unknown
+// or if a has no IP address, as a relay address.
+func (db *DB) LookupAddr(a ma.Multiaddr) Location {
+	if db == nil || a == nil {
+		return Location{}
+	}
+	if _, err := a.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+		return Location{}
+	}
+	ip, err := manet.ToIP(a)
+	if err != nil {
+		return Location{}
+	}
+	return db.Lookup(ip)
+}
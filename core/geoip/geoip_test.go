@@ -0,0 +1,75 @@
+package geoip
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const countryASN = `start_ip,end_ip,country,country_name,continent,continent_name,asn,as_name,as_domain
+1.0.0.0,1.0.0.255,AU,Australia,OC,Oceania,AS13335,Cloudflare,cloudflare.com
+8.8.8.0,8.8.8.255,US,United States,NA,North America,AS15169,Google LLC,google.com
+2001:4860::,2001:4860:ffff:ffff:ffff:ffff:ffff:ffff,US,United States,NA,North America,AS15169,Google LLC,google.com
+`
+
+const asnBlocks = `network,autonomous_system_number,autonomous_system_organization
+10.1.0.0/16,64512,Private Cloud
+1.0.0.0/24,13335,CLOUDFLARENET
+`
+
+func TestLookup(t *testing.T) {
+	db, err := Read(strings.NewReader(countryASN))
+	if err != nil {
+		t.Fatal(err)
+	}
+	asn, err := Read(strings.NewReader(asnBlocks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.tables = append(db.tables, asn.tables...)
+
+	for _, c := range []struct {
+		ip  string
+		loc Location
+	}{
+		{"1.0.0.1", Location{Country: "AU", ASN: 13335, Org: "Cloudflare"}},
+		{"8.8.8.8", Location{Country: "US", ASN: 15169, Org: "Google LLC"}},
+		{"8.8.9.1", Location{}},
+		{"2001:4860:4860::8888", Location{Country: "US", ASN: 15169, Org: "Google LLC"}},
+		{"10.1.2.3", Location{ASN: 64512, Org: "Private Cloud"}},
+		{"10.2.0.1", Location{}},
+		{"0.0.0.1", Location{}},
+	} {
+		if loc := db.Lookup(net.ParseIP(c.ip)); loc != c.loc {
+			t.Errorf("%s: expected %+v, got %+v", c.ip, c.loc, loc)
+		}
+	}
+
+	if loc := db.LookupAddr(ma.StringCast("/ip4/8.8.8.8/tcp/4001")); loc.String() != "US AS15169" {
+		t.Errorf("expected US AS15169, got %q", loc)
+	}
+	relay := ma.StringCast("/ip4/8.8.8.8/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ/p2p-circuit")
+	if loc := db.LookupAddr(relay); !loc.IsZero() {
+		t.Errorf("expected no location for a relay address, got %+v", loc)
+	}
+
+	var none *DB
+	if loc := none.Lookup(net.ParseIP("8.8.8.8")); !loc.IsZero() {
+		t.Errorf("expected no location from a nil DB, got %+v", loc)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, db := range []string{
+		"ip,country\n1.2.3.4,US\n",
+		"network,country\nnot-a-network,US\n",
+		"start_ip,end_ip,country\n1.0.0.9,1.0.0.1,US\n",
+		"network,asn\n1.0.0.0/24,ASX\n",
+	} {
+		if _, err := Read(strings.NewReader(db)); err == nil {
+			t.Errorf("expected an error reading %q", db)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+// Package gwfed fetches the blocks the network doesn't have from upstream
+// HTTP gateways.
+//
+// A node at the edge of a cluster can be configured with the gateways it
+// trusts to backstop it. The exchange returned by Exchange first asks the
+// network for a block, and when it isn't found within NetworkTimeout, asks
+// the upstream gateways for it, in order, as a raw block ('?format=raw').
+// The block is verified against its CID before it is stored, so an upstream
+// can't serve anything but the content asked for.
+//
+// A request made for an upstream is never forwarded to the upstreams of the
+// node: gateways federated with each other don't loop.
+package gwfed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	logging "github.com/ipfs/go-log"
+	metrics "github.com/ipfs/go-metrics-interface"
+)
+
+var log = logging.Logger("gwfed")
+
+// ConfigKey is the config key of the federation section.
+const ConfigKey = "Gateway.Federation"
+
+// By default, the upstreams are asked for a block missing from the network
+// after 5 seconds, and given 30 seconds to serve it.
+const (
+	DefaultNetworkTimeout = 5 * time.Second
+	DefaultTimeout        = 30 * time.Second
+)
+
+// Header marks the requests made for an upstream, which are answered
+// without asking the upstreams of the node.
+const Header = "X-Ipfs-Federated"
+
+// RawContentType is the content type of a raw block.
+const RawContentType = "application/vnd.ipld.raw"
+
+// maxBlockSize bounds the blocks read from an upstream, as bitswap does.
+const maxBlockSize = 2 << 20
+
+// Config holds the Gateway.Federation config section.
+type Config struct {
+	// Upstreams are the URLs of the gateways asked for the blocks the
+	// network doesn't have, in order.
+	Upstreams []string
+
+	// NetworkTimeout is how long the network is asked for a block before
+	// the upstreams are.
+	NetworkTimeout string
+
+	// Timeout bounds a request to an upstream.
+	Timeout string
+}
+
+// LoadConfig reads the Gateway.Federation section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// Stats are the statistics of the blocks fetched from the upstreams.
+type Stats struct {
+	Upstreams []string
+	Fetched   uint64
+	Bytes     uint64
+	Failed    uint64
+}
+
+// Federation fetches blocks from upstream gateways.
+type Federation struct {
+	upstreams      []string
+	networkTimeout time.Duration
+	client         *http.Client
+
+	mu    sync.Mutex
+	stats Stats
+
+	fetched metrics.Counter
+	bytes   metrics.Counter
+	failed  metrics.Counter
+}
+
+// New returns the federation configured by cfg, or nil if cfg has no
+// upstreams.
+func New(ctx context.Context, cfg Config) (*Federation, error) {
+	if len(cfg.Upstreams) == 0 {
+		return nil, nil
+	}
+
+	f := &Federation{
+		client: &http.Client{},
+
+		fetched: metrics.NewCtx(ctx, "gateway_federation_fetched_total", "Number of blocks fetched from upstream gateways").Counter(),
+		bytes:   metrics.NewCtx(ctx, "gateway_federation_fetched_bytes", "Size of the blocks fetched from upstream gateways").Counter(),
+		failed:  metrics.NewCtx(ctx, "gateway_federation_failed_total", "Number of blocks no upstream gateway could serve").Counter(),
+	}
+	for _, u := range cfg.Upstreams {
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			return nil, fmt.Errorf("invalid upstream gateway %q: expected an http or https URL", u)
+		}
+		f.upstreams = append(f.upstreams, strings.TrimSuffix(u, "/"))
+	}
+	var err error
+	if f.networkTimeout, err = repo.ConfigDuration(ConfigKey, "NetworkTimeout", cfg.NetworkTimeout, DefaultNetworkTimeout); err != nil {
+		return nil, err
+	}
+	if f.client.Timeout, err = repo.ConfigDuration(ConfigKey, "Timeout", cfg.Timeout, DefaultTimeout); err != nil {
+		return nil, err
+	}
+	f.stats.Upstreams = f.upstreams
+	return f, nil
+}
+
+// Stats returns the statistics of f. It is nil-safe.
+func (f *Federation) Stats() *Stats {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	st := f.stats
+	return &st
+}
+
+type localKey struct{}
+
+// Local returns a context under which the blocks are only fetched from the
+// network, not from the upstreams. The gateway uses it for the requests of
+// other federated gateways.
+func Local(ctx context.Context) context.Context {
+	return context.WithValue(ctx, localKey{}, true)
+}
+
+func isLocal(ctx context.Context) bool {
+	local, _ := ctx.Value(localKey{}).(bool)
+	return local
+}
+
+// errNotFound is returned when no upstream has a block.
+var errNotFound = errors.New("block not found on the upstream gateways")
+
+// fetch fetches the block of c from the first upstream having it.
+func (f *Federation) fetch(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	for _, u := range f.upstreams {
+		b, err := f.fetchFrom(ctx, u, c)
+		if err == nil {
+			f.mu.Lock()
+			f.stats.Fetched++
+			f.stats.Bytes += uint64(len(b.RawData()))
+			f.mu.Unlock()
+			f.fetched.Inc()
+			f.bytes.Add(float64(len(b.RawData())))
+			return b, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Debugf("failed to fetch %s from %s: %s", c, u, err)
+	}
+
+	f.mu.Lock()
+	f.stats.Failed++
+	f.mu.Unlock()
+	f.failed.Inc()
+	return nil, errNotFound
+}
+
+func (f *Federation) fetchFrom(ctx context.Context, upstream string, c cid.Cid) (blocks.Block, error) {
+	req, err := http.NewRequest("GET", upstream+"/ipfs/"+c.String()+"?format=raw", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", RawContentType)
+	req.Header.Set(Header, "1")
+
+	resp, err := f.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBlockSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxBlockSize {
+		return nil, fmt.Errorf("block larger than %d bytes", maxBlockSize)
+	}
+
+	// never trust an upstream: the block must hash to its CID
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return nil, err
+	}
+	if !sum.Equals(c) {
+		return nil, fmt.Errorf("block doesn't match its CID")
+	}
+	return blocks.NewBlockWithCid(data, c)
+}
+
+// Exchange returns ex, falling back to the upstreams for the blocks the
+// network doesn't have. The blocks fetched from the upstreams are added
+// through ex, which stores them. It is safe to call on a nil Federation, in
+// which case ex is returned as is.
+func (f *Federation) Exchange(ex exchange.Interface) exchange.Interface {
+	if f == nil {
+		return ex
+	}
+	fe := &fedExchange{Interface: ex, f: f}
+	if sex, ok := ex.(exchange.SessionExchange); ok {
+		return &fedSessionExchange{fedExchange: fe, sex: sex}
+	}
+	return fe
+}
+
+type fedExchange struct {
+	exchange.Interface
+	f *Federation
+}
+
+func (e *fedExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return e.f.getBlock(ctx, e.Interface, e.Interface, c)
+}
+
+func (e *fedExchange) GetBlocks(ctx context.Context, keys []cid.Cid) (<-chan blocks.Block, error) {
+	return e.f.getBlocks(ctx, e.Interface, e.Interface, keys)
+}
+
+type fedSessionExchange struct {
+	*fedExchange
+	sex exchange.SessionExchange
+}
+
+func (e *fedSessionExchange) NewSession(ctx context.Context) exchange.Fetcher {
+	return &fedFetcher{
+		Fetcher: e.sex.NewSession(ctx),
+		ex:      e.Interface,
+		f:       e.f,
+	}
+}
+
+type fedFetcher struct {
+	exchange.Fetcher
+	ex exchange.Interface
+	f  *Federation
+}
+
+func (s *fedFetcher) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return s.f.getBlock(ctx, s.Fetcher, s.ex, c)
+}
+
+func (s *fedFetcher) GetBlocks(ctx context.Context, keys []cid.Cid) (<-chan blocks.Block, error) {
+	return s.f.getBlocks(ctx, s.Fetcher, s.ex, keys)
+}
+
+// upstream fetches the block of c from the upstreams, and adds it through
+// ex.
+func (f *Federation) upstream(ctx context.Context, ex exchange.Interface, c cid.Cid) (blocks.Block, error) {
+	b, err := f.fetch(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if err := ex.HasBlock(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (f *Federation) getBlock(ctx context.Context, fetcher exchange.Fetcher, ex exchange.Interface, c cid.Cid) (blocks.Block, error) {
+	if isLocal(ctx) {
+		return fetcher.GetBlock(ctx, c)
+	}
+
+	nctx, cancel := context.WithTimeout(ctx, f.networkTimeout)
+	b, err := fetcher.GetBlock(nctx, c)
+	cancel()
+	if err == nil || ctx.Err() != nil {
+		return b, err
+	}
+	return f.upstream(ctx, ex, c)
+}
+
+func (f *Federation) getBlocks(ctx context.Context, fetcher exchange.Fetcher, ex exchange.Interface, keys []cid.Cid) (<-chan blocks.Block, error) {
+	if isLocal(ctx) {
+		return fetcher.GetBlocks(ctx, keys)
+	}
+
+	nctx, cancel := context.WithTimeout(ctx, f.networkTimeout)
+	in, err := fetcher.GetBlocks(nctx, keys)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	out := make(chan blocks.Block)
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		pending := make(map[cid.Cid]bool, len(keys))
+		for _, c := range keys {
+			pending[c] = true
+		}
+		send := func(b blocks.Block) bool {
+			select {
+			case out <- b:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for b := range in {
+			delete(pending, b.Cid())
+			if !send(b) {
+				return
+			}
+		}
+
+		// the network gave up on the rest, within the network timeout
+		for _, c := range keys {
+			if !pending[c] || ctx.Err() != nil {
+				continue
+			}
+			delete(pending, c)
+			b, err := f.upstream(ctx, ex, c)
+			if err != nil {
+				log.Debugf("failed to fetch %s from the upstreams: %s", c, err)
+				continue
+			}
+			if !send(b) {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,133 @@
+package gwfed
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+)
+
+// missingExchange never finds a block on the network, and records the blocks
+// added through it.
+type missingExchange struct {
+	exchange.Interface
+	added []blocks.Block
+}
+
+func (e *missingExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (e *missingExchange) GetBlocks(ctx context.Context, keys []cid.Cid) (<-chan blocks.Block, error) {
+	out := make(chan blocks.Block)
+	go func() {
+		<-ctx.Done()
+		close(out)
+	}()
+	return out, nil
+}
+
+func (e *missingExchange) HasBlock(b blocks.Block) error {
+	e.added = append(e.added, b)
+	return nil
+}
+
+// upstream serves the blocks it has, and data for any other CID.
+func upstream(t *testing.T, have ...blocks.Block) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "raw" || r.Header.Get(Header) == "" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		for _, b := range have {
+			if strings.HasSuffix(r.URL.Path, "/"+b.Cid().String()) {
+				w.Write(b.RawData())
+				return
+			}
+		}
+		w.Write([]byte("not the block"))
+	}))
+}
+
+func newFederation(t *testing.T, upstreams ...string) *Federation {
+	f, err := New(context.Background(), Config{Upstreams: upstreams, NetworkTimeout: "10ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFallback(t *testing.T) {
+	b := blocks.NewBlock([]byte("hello"))
+	srv := upstream(t, b)
+	defer srv.Close()
+
+	ex := &missingExchange{}
+	f := newFederation(t, srv.URL)
+	got, err := f.Exchange(ex).GetBlock(context.Background(), b.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Cid().Equals(b.Cid()) || len(ex.added) != 1 {
+		t.Fatal("expected the block to be fetched from the upstream and stored")
+	}
+	if st := f.Stats(); st.Fetched != 1 || st.Bytes != uint64(len(b.RawData())) {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	srv := upstream(t)
+	defer srv.Close()
+
+	ex := &missingExchange{}
+	f := newFederation(t, srv.URL)
+	c := blocks.NewBlock([]byte("wanted")).Cid()
+	if _, err := f.Exchange(ex).GetBlock(context.Background(), c); err == nil {
+		t.Fatal("expected a block not matching its CID to be refused")
+	}
+	if len(ex.added) != 0 || f.Stats().Failed != 1 {
+		t.Fatal("expected the block not to be stored")
+	}
+}
+
+func TestGetBlocks(t *testing.T) {
+	b1, b2 := blocks.NewBlock([]byte("one")), blocks.NewBlock([]byte("two"))
+	bad := upstream(t)
+	defer bad.Close()
+	good := upstream(t, b1, b2)
+	defer good.Close()
+
+	// the upstreams are tried in order
+	f := newFederation(t, bad.URL, good.URL)
+	ch, err := f.Exchange(&missingExchange{}).GetBlocks(context.Background(), []cid.Cid{b1.Cid(), b2.Cid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 blocks, got %d", n)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	b := blocks.NewBlock([]byte("hello"))
+	srv := upstream(t, b)
+	defer srv.Close()
+
+	f := newFederation(t, srv.URL)
+	ctx, cancel := context.WithTimeout(Local(context.Background()), 50*time.Millisecond)
+	defer cancel()
+	if _, err := f.Exchange(&missingExchange{}).GetBlock(ctx, b.Cid()); err == nil {
+		t.Fatal("expected a local request not to be forwarded to the upstreams")
+	}
+}
@@ -0,0 +1,117 @@
+// Package hashstats verifies the blocks read from the blockstore when
+// Datastore.HashOnRead is set, and keeps counters of the verification
+// throughput per hash function, so that operators can see what hashing costs
+// on their nodes.
+package hashstats
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	metrics "github.com/ipfs/go-metrics-interface"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// Counters holds the verification counters of a hash function.
+type Counters struct {
+	Blocks   uint64
+	Bytes    uint64
+	Failures uint64
+
+	// Duration is the total time spent hashing.
+	Duration time.Duration
+}
+
+// Throughput returns the verification throughput in bytes per second.
+func (c Counters) Throughput() float64 {
+	if c.Duration <= 0 {
+		return 0
+	}
+	return float64(c.Bytes) / c.Duration.Seconds()
+}
+
+// Stats verifies blocks and counts the verifications.
+type Stats struct {
+	mu     sync.Mutex
+	byCode map[uint64]*Counters
+
+	metrics struct {
+		blocks   metrics.Counter
+		bytes    metrics.Counter
+		failures metrics.Counter
+		seconds  metrics.Counter
+	}
+}
+
+// New returns a Stats exporting its counters as metrics in the scope of ctx.
+func New(ctx context.Context) *Stats {
+	s := &Stats{byCode: make(map[uint64]*Counters)}
+	s.metrics.blocks = metrics.NewCtx(ctx, "hash_verify_blocks_total", "Number of blocks verified on read").Counter()
+	s.metrics.bytes = metrics.NewCtx(ctx, "hash_verify_bytes_total", "Size of the blocks verified on read").Counter()
+	s.metrics.failures = metrics.NewCtx(ctx, "hash_verify_failures_total", "Number of blocks not matching their hash").Counter()
+	s.metrics.seconds = metrics.NewCtx(ctx, "hash_verify_seconds_total", "Time spent verifying blocks").Counter()
+	return s
+}
+
+// Verify hashes data and returns whether it matches c.
+func (s *Stats) Verify(c cid.Cid, data []byte) (bool, error) {
+	pref := c.Prefix()
+
+	start := time.Now()
+	rc, err := pref.Sum(data)
+	took := time.Since(start)
+	if err != nil {
+		return false, err
+	}
+
+	ok := rc.Equals(c)
+	s.record(pref.MhType, len(data), took, ok)
+	return ok, nil
+}
+
+func (s *Stats) record(code uint64, size int, took time.Duration, ok bool) {
+	s.metrics.blocks.Inc()
+	s.metrics.bytes.Add(float64(size))
+	s.metrics.seconds.Add(took.Seconds())
+	if !ok {
+		s.metrics.failures.Inc()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, found := s.byCode[code]
+	if !found {
+		c = new(Counters)
+		s.byCode[code] = c
+	}
+	c.Blocks++
+	c.Bytes += uint64(size)
+	c.Duration += took
+	if !ok {
+		c.Failures++
+	}
+}
+
+// Snapshot returns the counters, by hash function name. It returns nil if s
+// is nil.
+func (s *Stats) Snapshot() map[string]Counters {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]Counters, len(s.byCode))
+	for code, c := range s.byCode {
+		name, ok := mh.Codes[code]
+		if !ok {
+			name = "unknown"
+		}
+		out[name] = *c
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package hashstats
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+func TestVerifyOnRead(t *testing.T) {
+	s := New(context.Background())
+	base := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	bs := s.Blockstore(base)
+
+	good := blocks.NewBlock([]byte("good block"))
+	if err := base.Put(good); err != nil {
+		t.Fatal(err)
+	}
+	// The base blockstore doesn't verify blocks on write.
+	bad, err := blocks.NewBlockWithCid([]byte("bad block"), blocks.NewBlock([]byte("other block")).Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Put(bad); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bs.Get(good.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bs.Get(bad.Cid()); err != blockstore.ErrHashMismatch {
+		t.Fatalf("expected a hash mismatch, got %v", err)
+	}
+
+	c, ok := s.Snapshot()["sha2-256"]
+	if !ok {
+		t.Fatal("expected counters for sha2-256")
+	}
+	if c.Blocks != 2 || c.Failures != 1 || c.Bytes != uint64(len(good.RawData())+len(bad.RawData())) {
+		t.Fatalf("unexpected counters: %+v", c)
+	}
+
+	bs.HashOnRead(false)
+	if _, err := bs.Get(bad.Cid()); err != nil {
+		t.Fatalf("expected no verification once disabled, got %v", err)
+	}
+	if c := s.Snapshot()["sha2-256"]; c.Blocks != 2 {
+		t.Fatalf("expected no more verifications, got %+v", c)
+	}
+}
+
+func TestNilStats(t *testing.T) {
+	var s *Stats
+	base := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	if s.Blockstore(base) != base {
+		t.Fatal("expected a nil Stats not to wrap the blockstore")
+	}
+	if s.Snapshot() != nil {
+		t.Fatal("expected no counters")
+	}
+}
@@ -0,0 +1,50 @@
+package hashstats
+
+import (
+	"sync/atomic"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// Blockstore wraps bs to verify every block read, in place of the
+// HashOnRead option of bs. It is safe to call on a nil Stats, in which case
+// bs is returned as is.
+func (s *Stats) Blockstore(bs blockstore.Blockstore) blockstore.Blockstore {
+	if s == nil {
+		return bs
+	}
+	return &verifyingBlockstore{Blockstore: bs, s: s, enabled: 1}
+}
+
+type verifyingBlockstore struct {
+	blockstore.Blockstore
+	s *Stats
+
+	enabled int32
+}
+
+func (bs *verifyingBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	blk, err := bs.Blockstore.Get(c)
+	if err != nil || atomic.LoadInt32(&bs.enabled) == 0 {
+		return blk, err
+	}
+
+	ok, err := bs.s.Verify(c, blk.RawData())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, blockstore.ErrHashMismatch
+	}
+	return blk, nil
+}
+
+func (bs *verifyingBlockstore) HashOnRead(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&bs.enabled, v)
+}
@@ -0,0 +1,182 @@
+// Package keystats reports on the keys of the keystore: their type and size,
+// when they were written, the IPNS records published with them, and when
+// they were last used to publish.
+//
+// Uses are recorded in the datastore by peer ID, so that they follow the keys
+// when renamed.
+package keystats
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"sort"
+	"strconv"
+	"time"
+
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+
+	ds "github.com/ipfs/go-datastore"
+	ipns "github.com/ipfs/go-ipns"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	pb "github.com/libp2p/go-libp2p-core/crypto/pb"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+var usePrefix = ds.NewKey("/local/keyuse")
+
+// SelfName is the name of the key of the node.
+const SelfName = "self"
+
+// Stat describes a key.
+type Stat struct {
+	Name string
+	Id   string
+	Type string
+
+	// Size is the size of the key, in bits.
+	Size int
+
+	// Created is when the key was written to the keystore, or the zero time
+	// for the key of the node.
+	Created time.Time
+
+	// LastUsed is when the key was last used to publish, or the zero time
+	// if it wasn't since uses are recorded.
+	LastUsed time.Time
+
+	// Record is the IPNS record published with the key, if any.
+	Record *Record `json:",omitempty"`
+}
+
+// Record describes the IPNS record of a key.
+type Record struct {
+	Value    string
+	Sequence uint64
+	Expires  time.Time
+}
+
+// RecordUse records that the key of id was used now.
+func RecordUse(d ds.Datastore, id peer.ID) error {
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	return d.Put(useKey(id), []byte(now))
+}
+
+// LastUse returns when the key of id was last used, or the zero time if it
+// wasn't since uses are recorded.
+func LastUse(d ds.Datastore, id peer.ID) (time.Time, error) {
+	b, err := d.Get(useKey(id))
+	if err == ds.ErrNotFound {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	ns, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ns), nil
+}
+
+func useKey(id peer.ID) ds.Key {
+	return usePrefix.ChildString(id.Pretty())
+}
+
+// Stats returns the statistics of self, the key of the node, and of the keys
+// of ks, sorted by name after self.
+func Stats(ctx context.Context, self ci.PrivKey, ks keystore.Keystore, d ds.Datastore) ([]Stat, error) {
+	names, err := ks.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	pub := namesys.NewIpnsPublisher(nil, d)
+	out := make([]Stat, 0, len(names)+1)
+
+	st, err := stat(ctx, pub, d, SelfName, self)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, st)
+
+	for _, name := range names {
+		k, err := ks.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		st, err := stat(ctx, pub, d, name, k)
+		if err != nil {
+			return nil, err
+		}
+		if mt, ok := ks.(interface {
+			ModTime(string) (time.Time, error)
+		}); ok {
+			if st.Created, err = mt.ModTime(name); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+func stat(ctx context.Context, pub *namesys.IpnsPublisher, d ds.Datastore, name string, k ci.PrivKey) (Stat, error) {
+	id, err := peer.IDFromPrivateKey(k)
+	if err != nil {
+		return Stat{}, err
+	}
+	st := Stat{
+		Name: name,
+		Id:   id.Pretty(),
+		Type: pb.KeyType_name[int32(k.Type())],
+		Size: keySize(k.GetPublic()),
+	}
+
+	if st.LastUsed, err = LastUse(d, id); err != nil {
+		return Stat{}, err
+	}
+
+	entry, err := pub.GetPublished(ctx, id, false)
+	if err != nil {
+		return Stat{}, err
+	}
+	if entry != nil {
+		st.Record = &Record{
+			Value:    string(entry.GetValue()),
+			Sequence: entry.GetSequence(),
+		}
+		if eol, err := ipns.GetEOL(entry); err == nil {
+			st.Record.Expires = eol
+		}
+	}
+	return st, nil
+}
+
+// keySize returns the size of k in bits, or 0 if unknown.
+func keySize(k ci.PubKey) int {
+	switch k.Type() {
+	case pb.KeyType_Ed25519, pb.KeyType_Secp256k1:
+		return 256
+	}
+
+	raw, err := k.Raw()
+	if err != nil {
+		return 0
+	}
+	pk, err := x509.ParsePKIXPublicKey(raw)
+	if err != nil {
+		return 0
+	}
+	switch pk := pk.(type) {
+	case *rsa.PublicKey:
+		return pk.N.BitLen()
+	case *ecdsa.PublicKey:
+		return pk.Curve.Params().BitSize
+	default:
+		return 0
+	}
+}
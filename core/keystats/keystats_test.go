@@ -0,0 +1,92 @@
+package keystats
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	keystore "github.com/ipfs/go-ipfs/keystore"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestLastUse(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	id := peer.ID("QmTest")
+
+	last, err := LastUse(d, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.IsZero() {
+		t.Fatal("expected no use before one is recorded")
+	}
+
+	if err := RecordUse(d, id); err != nil {
+		t.Fatal(err)
+	}
+	last, err = LastUse(d, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.IsZero() {
+		t.Fatal("expected the use to be recorded")
+	}
+}
+
+func TestStats(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	ks := keystore.NewMemKeystore()
+
+	self, _, err := ci.GenerateKeyPairWithReader(ci.RSA, 1024, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed, _, err := ci.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("b", ed); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("a", self); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := peer.IDFromPrivateKey(ed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordUse(d, id); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := Stats(context.Background(), self, ks, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 3 {
+		t.Fatalf("expected 3 keys, got %d", len(stats))
+	}
+	if stats[0].Name != SelfName || stats[1].Name != "a" || stats[2].Name != "b" {
+		t.Fatal("expected self first, then the keys sorted by name")
+	}
+	if stats[0].Type != "RSA" || stats[0].Size != 1024 {
+		t.Fatalf("expected a 1024 bit RSA key, got %d bit %s", stats[0].Size, stats[0].Type)
+	}
+	if stats[2].Type != "Ed25519" || stats[2].Size != 256 {
+		t.Fatalf("expected a 256 bit Ed25519 key, got %d bit %s", stats[2].Size, stats[2].Type)
+	}
+	if !stats[0].LastUsed.IsZero() {
+		t.Fatal("expected self to be unused")
+	}
+	if stats[2].LastUsed.IsZero() {
+		t.Fatal("expected the use of b to be reported")
+	}
+	if stats[0].Record != nil {
+		t.Fatal("expected no record for self")
+	}
+}
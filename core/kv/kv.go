@@ -0,0 +1,127 @@
+// Package kv is a key-value store replicated between the nodes over pubsub.
+//
+// The store is a merkle-CRDT: every write is a node of a DAG, linking to the
+// writes it was made after, the heads of the DAG known to the writer. Nodes
+// broadcast their heads on the pubsub topic of the store; a node receiving
+// heads it doesn't know fetches the writes it misses through the DAG and
+// applies them. The value of a key is its last write: the one with the
+// greatest height in the DAG, ties broken by CID, so that every node ends up
+// with the same values whatever the order the writes arrived in.
+//
+// The writes aren't signed: every peer on the topic can write. The store is
+// meant to be shared within a private network, whose peers are trusted.
+package kv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// TopicPrefix is the prefix of the pubsub topics of the stores.
+const TopicPrefix = "/ipfs/kv/1.0.0/"
+
+// ConfigKey is the config key of the store section.
+const ConfigKey = "Experimental.KV"
+
+// DefaultName is the name of the store when none is configured.
+const DefaultName = "default"
+
+// maxHeadsSize bounds the size of the heads read from pubsub.
+const maxHeadsSize = 16 << 10
+
+// ErrNotFound is returned for keys without a value.
+var ErrNotFound = errors.New("key not found")
+
+// Config holds the Experimental.KV config section.
+type Config struct {
+	Enabled bool
+
+	// Name is the name of the store, shared by the nodes replicating it.
+	Name string
+}
+
+// LoadConfig reads the Experimental.KV section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// Topic returns the pubsub topic of the store named name.
+func Topic(name string) string {
+	if name == "" {
+		name = DefaultName
+	}
+	return TopicPrefix + name
+}
+
+// Entry is the value of a key.
+type Entry struct {
+	Key     string
+	Value   string `json:",omitempty"`
+	Deleted bool   `json:",omitempty"`
+
+	// Height and Cid are the height and CID of the write of the value.
+	Height uint64
+	Cid    cid.Cid
+}
+
+// newer returns whether e wins over other.
+func (e *Entry) newer(other *Entry) bool {
+	if e.Height != other.Height {
+		return e.Height > other.Height
+	}
+	return e.Cid.KeyString() > other.Cid.KeyString()
+}
+
+// op is the data of a write node.
+type op struct {
+	Key     string
+	Value   string `json:",omitempty"`
+	Deleted bool   `json:",omitempty"`
+	Height  uint64
+}
+
+// encodeOp returns the write node of o, made after the writes prev.
+func encodeOp(o *op, prev []cid.Cid) (*dag.ProtoNode, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	nd := dag.NodeWithData(data)
+	for _, c := range prev {
+		if err := nd.AddRawLink("prev", &ipld.Link{Cid: c}); err != nil {
+			return nil, err
+		}
+	}
+	return nd, nil
+}
+
+// decodeOp returns the write of nd, and the writes it was made after.
+func decodeOp(nd ipld.Node) (*op, []cid.Cid, error) {
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is not a write of the store", nd.Cid())
+	}
+	var o op
+	if err := json.Unmarshal(pn.Data(), &o); err != nil {
+		return nil, nil, fmt.Errorf("%s is not a write of the store: %s", nd.Cid(), err)
+	}
+	prev := make([]cid.Cid, 0, len(pn.Links()))
+	for _, l := range pn.Links() {
+		prev = append(prev, l.Cid)
+	}
+	return &o, prev, nil
+}
+
+// heads is the message broadcast on the topic of a store.
+type heads struct {
+	Heads []cid.Cid
+}
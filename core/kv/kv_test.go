@@ -0,0 +1,131 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+// newStore returns a store without pubsub, sharing the DAG service dserv.
+func newStore(ctx context.Context, dserv ipld.DAGService) *Service {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	pinner := pin.NewPinner(d, dserv, dserv)
+	return New(ctx, "", nil, d, dserv, pinner, bstore.NewGCLocker())
+}
+
+func expectValue(t *testing.T, s *Service, key, value string) {
+	t.Helper()
+	e, err := s.Get(key)
+	if value == "" {
+		if err != ErrNotFound {
+			t.Fatalf("expected %s to be removed, got %v, %v", key, e, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Value != value {
+		t.Fatalf("expected %s=%s, got %s", key, value, e.Value)
+	}
+}
+
+func TestConcurrentWritesConverge(t *testing.T) {
+	ctx := context.Background()
+	dserv := mdtest.Mock()
+	a, b := newStore(ctx, dserv), newStore(ctx, dserv)
+
+	if _, err := a.write(ctx, &op{Key: "y", Value: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.write(ctx, &op{Key: "x", Value: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.write(ctx, &op{Key: "x", Value: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.write(ctx, &op{Key: "z", Value: "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := a.Subscribe(ctx, "")
+
+	exchange := func() {
+		ha, err := a.Heads()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hb, err := b.Heads()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range hb {
+			if err := a.merge(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, c := range ha {
+			if err := b.merge(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	exchange()
+
+	// x was written at height 2 by a and 1 by b: a wins
+	for _, s := range []*Service{a, b} {
+		expectValue(t, s, "x", "1")
+		expectValue(t, s, "y", "1")
+		expectValue(t, s, "z", "2")
+
+		heads, err := s.Heads()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(heads) != 2 {
+			t.Fatalf("expected the two concurrent heads, got %v", heads)
+		}
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Key != "z" || !ev.Remote {
+			t.Fatalf("expected the remote write of z, got %+v", ev)
+		}
+	default:
+		t.Fatal("expected the remote write to be notified")
+	}
+
+	// the next write of b is made after both heads
+	if _, err := b.write(ctx, &op{Key: "y", Deleted: true}); err != nil {
+		t.Fatal(err)
+	}
+	exchange()
+	for _, s := range []*Service{a, b} {
+		expectValue(t, s, "y", "")
+		heads, err := s.Heads()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(heads) != 1 {
+			t.Fatalf("expected a single head, got %v", heads)
+		}
+		if _, pinned, err := s.pinning.IsPinnedWithType(ctx, heads[0], pin.Recursive); err != nil || !pinned {
+			t.Fatalf("expected the head to be pinned: %v", err)
+		}
+	}
+
+	entries, err := a.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Key != "x" || entries[1].Key != "z" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+}
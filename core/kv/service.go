@@ -0,0 +1,524 @@
+package kv
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsquery "github.com/ipfs/go-datastore/query"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+var log = logging.Logger("kv")
+
+// RebroadcastInterval is how often the heads of the store are broadcast
+// again, for the nodes that missed a write.
+var RebroadcastInterval = time.Minute
+
+// fetchTimeout bounds the time spent fetching the writes missing from a
+// store.
+const fetchTimeout = 10 * time.Minute
+
+var (
+	headsPrefix   = ds.NewKey("/kv/heads")
+	entriesPrefix = ds.NewKey("/kv/entries")
+	seenPrefix    = ds.NewKey("/kv/seen")
+)
+
+// Event notifies a change of the value of a key.
+type Event struct {
+	Entry
+
+	// Remote is set for the writes received from other nodes.
+	Remote bool `json:",omitempty"`
+}
+
+// Service replicates a store.
+type Service struct {
+	ctx   context.Context
+	topic string
+
+	ps      *pubsub.PubSub
+	ds      ds.Datastore
+	dag     ipld.DAGService
+	pinning pin.Pinner
+	gcl     bstore.GCLocker
+
+	// mu serializes the changes of the heads and values.
+	mu sync.Mutex
+
+	wmu      sync.Mutex
+	watchers map[*watcher]struct{}
+
+	cancel func()
+}
+
+type watcher struct {
+	prefix string
+	ch     chan Event
+}
+
+// New creates the service replicating the store name. Start subscribes to
+// its topic.
+func New(ctx context.Context, name string, ps *pubsub.PubSub, d ds.Datastore, dag ipld.DAGService, pinning pin.Pinner, gcl bstore.GCLocker) *Service {
+	return &Service{
+		ctx:      ctx,
+		topic:    Topic(name),
+		ps:       ps,
+		ds:       d,
+		dag:      dag,
+		pinning:  pinning,
+		gcl:      gcl,
+		watchers: make(map[*watcher]struct{}),
+		cancel:   func() {},
+	}
+}
+
+// Start subscribes to the topic of the store, and starts broadcasting its
+// heads.
+func (s *Service) Start() error {
+	psub, err := s.ps.Subscribe(s.topic)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.cancel = func() {
+		cancel()
+		psub.Cancel()
+	}
+
+	go s.receive(ctx, psub)
+	go s.rebroadcast(ctx)
+	return nil
+}
+
+// Close unsubscribes from the topic of the store.
+func (s *Service) Close() error {
+	s.cancel()
+	return nil
+}
+
+// Get returns the value of key.
+func (s *Service) Get(key string) (*Entry, error) {
+	e, err := s.entry(key)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil || e.Deleted {
+		return nil, ErrNotFound
+	}
+	return e, nil
+}
+
+// List returns the values of the keys starting with prefix, sorted by key.
+func (s *Service) List(prefix string) ([]*Entry, error) {
+	res, err := s.ds.Query(dsquery.Query{Prefix: entriesPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*Entry, 0, len(entries))
+	for _, r := range entries {
+		var e Entry
+		if err := json.Unmarshal(r.Value, &e); err != nil {
+			return nil, fmt.Errorf("invalid entry %s: %s", r.Key, err)
+		}
+		if !e.Deleted && strings.HasPrefix(e.Key, prefix) {
+			out = append(out, &e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Key < out[j].Key
+	})
+	return out, nil
+}
+
+// Put sets the value of key, and broadcasts the write.
+func (s *Service) Put(ctx context.Context, key, value string) (*Entry, error) {
+	e, err := s.write(ctx, &op{Key: key, Value: value})
+	if err != nil {
+		return nil, err
+	}
+	s.publish()
+	return e, nil
+}
+
+// Delete removes key, and broadcasts the write.
+func (s *Service) Delete(ctx context.Context, key string) (*Entry, error) {
+	if _, err := s.Get(key); err != nil {
+		return nil, err
+	}
+	e, err := s.write(ctx, &op{Key: key, Deleted: true})
+	if err != nil {
+		return nil, err
+	}
+	s.publish()
+	return e, nil
+}
+
+// Subscribe returns the changes of the keys starting with prefix, until ctx
+// is done. Changes are dropped if the channel isn't read fast enough.
+func (s *Service) Subscribe(ctx context.Context, prefix string) <-chan Event {
+	w := &watcher{prefix: prefix, ch: make(chan Event, 64)}
+	s.wmu.Lock()
+	s.watchers[w] = struct{}{}
+	s.wmu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.wmu.Lock()
+		delete(s.watchers, w)
+		close(w.ch)
+		s.wmu.Unlock()
+	}()
+	return w.ch
+}
+
+func (s *Service) notify(ev Event) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	for w := range s.watchers {
+		if !strings.HasPrefix(ev.Key, w.prefix) {
+			continue
+		}
+		select {
+		case w.ch <- ev:
+		default:
+			log.Warningf("dropping the change of %s for a slow subscriber", ev.Key)
+		}
+	}
+}
+
+// Heads returns the heads of the DAG of the writes.
+func (s *Service) Heads() ([]cid.Cid, error) {
+	hs, err := s.heads()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]cid.Cid, 0, len(hs))
+	for c := range hs {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].KeyString() < out[j].KeyString()
+	})
+	return out, nil
+}
+
+// heads returns the heads with their height.
+func (s *Service) heads() (map[cid.Cid]uint64, error) {
+	res, err := s.ds.Query(dsquery.Query{Prefix: headsPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	hs := make(map[cid.Cid]uint64, len(entries))
+	for _, r := range entries {
+		c, err := cid.Decode(ds.RawKey(r.Key).BaseNamespace())
+		if err != nil {
+			return nil, fmt.Errorf("invalid head %s: %s", r.Key, err)
+		}
+		height, err := strconv.ParseUint(string(r.Value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid head %s: %s", r.Key, err)
+		}
+		hs[c] = height
+	}
+	return hs, nil
+}
+
+// write adds the write o after the heads, and applies it.
+func (s *Service) write(ctx context.Context, o *op) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hs, err := s.heads()
+	if err != nil {
+		return nil, err
+	}
+	prev := make([]cid.Cid, 0, len(hs))
+	for c, height := range hs {
+		prev = append(prev, c)
+		if height >= o.Height {
+			o.Height = height + 1
+		}
+	}
+	if o.Height == 0 {
+		o.Height = 1
+	}
+	sort.Slice(prev, func(i, j int) bool {
+		return prev[i].KeyString() < prev[j].KeyString()
+	})
+
+	nd, err := encodeOp(o, prev)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.dag.Add(ctx, nd); err != nil {
+		return nil, err
+	}
+
+	e := &Entry{Key: o.Key, Value: o.Value, Deleted: o.Deleted, Height: o.Height, Cid: nd.Cid()}
+	if err := s.apply(e, false); err != nil {
+		return nil, err
+	}
+	if err := s.ds.Put(seenKey(nd.Cid()), []byte{}); err != nil {
+		return nil, err
+	}
+	return e, s.replaceHeads(ctx, prev, nd, o.Height)
+}
+
+// apply sets e as the value of its key if it is newer than the current one.
+func (s *Service) apply(e *Entry, remote bool) error {
+	cur, err := s.entry(e.Key)
+	if err != nil {
+		return err
+	}
+	if cur != nil && !e.newer(cur) {
+		return nil
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := s.ds.Put(entryKey(e.Key), data); err != nil {
+		return err
+	}
+	s.notify(Event{Entry: *e, Remote: remote})
+	return nil
+}
+
+func (s *Service) entry(key string) (*Entry, error) {
+	data, err := s.ds.Get(entryKey(key))
+	if err == ds.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("invalid entry of %s: %s", key, err)
+	}
+	return &e, nil
+}
+
+func (s *Service) seen(c cid.Cid) (bool, error) {
+	return s.ds.Has(seenKey(c))
+}
+
+// replaceHeads makes head a head of the DAG in place of old, and pins it.
+func (s *Service) replaceHeads(ctx context.Context, old []cid.Cid, head ipld.Node, height uint64) error {
+	for _, c := range old {
+		if err := s.ds.Delete(headKey(c)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	if err := s.ds.Put(headKey(head.Cid()), []byte(strconv.FormatUint(height, 10))); err != nil {
+		return err
+	}
+
+	defer s.gcl.PinLock().Unlock()
+	if len(old) == 1 {
+		if _, pinned, err := s.pinning.IsPinnedWithType(ctx, old[0], pin.Recursive); err != nil {
+			return err
+		} else if pinned {
+			if err := s.pinning.Update(ctx, old[0], head.Cid(), true); err != nil {
+				return err
+			}
+			return s.pinning.Flush(ctx)
+		}
+	}
+	if err := s.pinning.Pin(ctx, head, true); err != nil {
+		return err
+	}
+	for _, c := range old {
+		if err := s.pinning.Unpin(ctx, c, true); err != nil && err != pin.ErrNotPinned {
+			return err
+		}
+	}
+	return s.pinning.Flush(ctx)
+}
+
+// merge fetches the writes of the DAG of head the node doesn't have, and
+// applies them.
+func (s *Service) merge(ctx context.Context, head cid.Cid) error {
+	if seen, err := s.seen(head); err != nil || seen {
+		return err
+	}
+
+	type write struct {
+		c cid.Cid
+		o *op
+	}
+	var (
+		writes    []write
+		headNode  ipld.Node
+		ancestors = make(map[cid.Cid]bool)
+		visited   = make(map[cid.Cid]bool)
+		stack     = []cid.Cid{head}
+	)
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[c] {
+			continue
+		}
+		visited[c] = true
+		if seen, err := s.seen(c); err != nil {
+			return err
+		} else if seen {
+			continue
+		}
+
+		nd, err := s.dag.Get(ctx, c)
+		if err != nil {
+			return err
+		}
+		o, prev, err := decodeOp(nd)
+		if err != nil {
+			return err
+		}
+		if c.Equals(head) {
+			headNode = nd
+		}
+		writes = append(writes, write{c, o})
+		for _, p := range prev {
+			ancestors[p] = true
+			stack = append(stack, p)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a concurrent merge may have applied the same writes
+	if seen, err := s.seen(head); err != nil || seen {
+		return err
+	}
+	for _, w := range writes {
+		if seen, err := s.seen(w.c); err != nil {
+			return err
+		} else if seen {
+			continue
+		}
+		e := &Entry{Key: w.o.Key, Value: w.o.Value, Deleted: w.o.Deleted, Height: w.o.Height, Cid: w.c}
+		if err := s.apply(e, true); err != nil {
+			return err
+		}
+		if err := s.ds.Put(seenKey(w.c), []byte{}); err != nil {
+			return err
+		}
+	}
+
+	hs, err := s.heads()
+	if err != nil {
+		return err
+	}
+	var old []cid.Cid
+	for c := range hs {
+		if ancestors[c] {
+			old = append(old, c)
+		}
+	}
+	return s.replaceHeads(ctx, old, headNode, writes[0].o.Height)
+}
+
+// receive merges the heads broadcast by the other nodes.
+func (s *Service) receive(ctx context.Context, psub *pubsub.Subscription) {
+	for {
+		msg, err := psub.Next(ctx)
+		if err != nil {
+			return
+		}
+		if len(msg.Data) > maxHeadsSize {
+			log.Debugf("dropping heads from %s: too large", msg.GetFrom())
+			continue
+		}
+		var h heads
+		if err := json.Unmarshal(msg.Data, &h); err != nil {
+			log.Debugf("dropping heads from %s: %s", msg.GetFrom(), err)
+			continue
+		}
+
+		go func() {
+			ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+			defer cancel()
+			for _, c := range h.Heads {
+				if err := s.merge(ctx, c); err != nil && ctx.Err() == nil {
+					log.Errorf("merging %s: %s", c, err)
+				}
+			}
+		}()
+	}
+}
+
+// publish broadcasts the heads.
+func (s *Service) publish() {
+	hs, err := s.Heads()
+	if err != nil {
+		log.Errorf("listing the heads: %s", err)
+		return
+	}
+	if len(hs) == 0 {
+		return
+	}
+	data, err := json.Marshal(&heads{Heads: hs})
+	if err != nil {
+		log.Errorf("encoding the heads: %s", err)
+		return
+	}
+	if err := s.ps.Publish(s.topic, data); err != nil {
+		log.Errorf("broadcasting the heads: %s", err)
+	}
+}
+
+// rebroadcast broadcasts the heads every RebroadcastInterval.
+func (s *Service) rebroadcast(ctx context.Context) {
+	ticker := time.NewTicker(RebroadcastInterval)
+	defer ticker.Stop()
+
+	s.publish()
+	for {
+		select {
+		case <-ticker.C:
+			s.publish()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func headKey(c cid.Cid) ds.Key {
+	return headsPrefix.ChildString(c.String())
+}
+
+func seenKey(c cid.Cid) ds.Key {
+	return seenPrefix.ChildString(c.String())
+}
+
+// entryKey encodes key, which may hold any character.
+func entryKey(key string) ds.Key {
+	return entriesPrefix.ChildString(base32.RawStdEncoding.EncodeToString([]byte(key)))
+}
@@ -0,0 +1,478 @@
+// Package landisc lets the nodes of a local network find each other's
+// content without DHT lookups.
+//
+// Every Interval, and when a peer connects, the node sends a bloom filter of
+// its pinned roots to the peers it is connected to over a local network
+// address (loopback, private or link-local), which mDNS discovery connects
+// on a LAN. The network returned by Wrap answers the provider queries of
+// bitswap with the neighbors whose filter has the CID, and only falls back to
+// the routing when none has it. A false positive of a filter costs a want
+// sent to a neighbor before the routing is asked.
+//
+// The filters expire after three intervals without being refreshed.
+package landisc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	bsnet "github.com/ipfs/go-bitswap/network"
+	cid "github.com/ipfs/go-cid"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	logging "github.com/ipfs/go-log"
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+var log = logging.Logger("landisc")
+
+// ID is the protocol ID of the LAN discovery protocol.
+const ID protocol.ID = "/ipfs/lan-bloom/1.0.0"
+
+// ConfigKey is the config key of the LAN discovery section.
+const ConfigKey = "Discovery.LAN"
+
+// DefaultInterval is the time between two broadcasts when none is
+// configured.
+const DefaultInterval = time.Minute
+
+// Bloom filter parameters: 10 bits per root and 7 hashes give about 1% of
+// false positives.
+const (
+	bitsPerRoot = 10
+	numHashes   = 7
+)
+
+// sendTimeout bounds the sending of a filter.
+const sendTimeout = 30 * time.Second
+
+// maxMessageSize bounds the size of the messages read, and so the roots
+// announced.
+const maxMessageSize = 1 << 20
+
+// Config configures LAN discovery.
+type Config struct {
+	// Enabled broadcasts the pinned roots to the local network, and looks
+	// up the roots of the neighbors before the routing.
+	Enabled bool
+
+	// Interval is the time between two broadcasts, as a duration string.
+	Interval string
+}
+
+// LoadConfig reads the Discovery.LAN section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// BroadcastInterval returns the configured interval, or DefaultInterval.
+func (c Config) BroadcastInterval() (time.Duration, error) {
+	if c.Interval == "" {
+		return DefaultInterval, nil
+	}
+	d, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("%s.Interval: %s", ConfigKey, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s.Interval must be positive", ConfigKey)
+	}
+	return d, nil
+}
+
+// filter is a bloom filter of CIDs, keyed by their multihash so that the
+// versions of a CID match.
+type filter struct {
+	Roots int
+	Bits  []byte
+}
+
+func newFilter(roots int) *filter {
+	n := roots * bitsPerRoot / 8
+	if n < 8 {
+		n = 8
+	}
+	return &filter{Roots: roots, Bits: make([]byte, n)}
+}
+
+// positions returns the bits of c in a filter of m bits, by double hashing.
+func positions(c cid.Cid, m uint64) [numHashes]uint64 {
+	h := fnv.New64a()
+	h.Write(c.Hash())
+	h1 := h.Sum64()
+	h.Write([]byte{0xff})
+	h2 := h.Sum64() | 1
+
+	var out [numHashes]uint64
+	for i := range out {
+		out[i] = (h1 + uint64(i)*h2) % m
+	}
+	return out
+}
+
+func (f *filter) add(c cid.Cid) {
+	for _, p := range positions(c, uint64(len(f.Bits))*8) {
+		f.Bits[p/8] |= 1 << (p % 8)
+	}
+}
+
+func (f *filter) has(c cid.Cid) bool {
+	if len(f.Bits) == 0 {
+		return false
+	}
+	for _, p := range positions(c, uint64(len(f.Bits))*8) {
+		if f.Bits[p/8]&(1<<(p%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// falsePositiveRate estimates the rate of false positives of f.
+func (f *filter) falsePositiveRate() float64 {
+	m := float64(len(f.Bits) * 8)
+	return math.Pow(1-math.Exp(-numHashes*float64(f.Roots)/m), numHashes)
+}
+
+// localNets are the networks of the local addresses, besides loopback.
+var localNets = mustParseCIDRs(
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"169.254.0.0/16",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	out := make([]*net.IPNet, 0, len(cidrs))
+	for _, s := range cidrs {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// isLocal returns whether a is a loopback, private or link-local address.
+func isLocal(a ma.Multiaddr) bool {
+	na, err := manet.ToNetAddr(a)
+	if err != nil {
+		return false
+	}
+	var ip net.IP
+	switch na := na.(type) {
+	case *net.TCPAddr:
+		ip = na.IP
+	case *net.UDPAddr:
+		ip = na.IP
+	default:
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, n := range localNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type neighbor struct {
+	f        *filter
+	received time.Time
+}
+
+// NeighborStat describes the filter of a neighbor.
+type NeighborStat struct {
+	Peer              string
+	Roots             int
+	FalsePositiveRate float64
+	Received          time.Time
+}
+
+// Stats are the statistics of LAN discovery.
+type Stats struct {
+	Interval  time.Duration
+	Roots     int
+	Sent      uint64
+	Neighbors []NeighborStat
+
+	// Hits counts the provider queries answered by the neighbors, Misses
+	// the ones left to the routing.
+	Hits   uint64
+	Misses uint64
+}
+
+// Service broadcasts the pinned roots to the local network, and keeps the
+// roots of the neighbors.
+type Service struct {
+	h        host.Host
+	pinner   pin.Pinner
+	interval time.Duration
+	ctx      context.Context
+
+	mu        sync.Mutex
+	own       *filter
+	neighbors map[peer.ID]neighbor
+	sent      uint64
+	hits      uint64
+	misses    uint64
+}
+
+// New creates a Service broadcasting the roots pinned by pinner over h every
+// interval. Start starts the broadcasts.
+func New(h host.Host, pinner pin.Pinner, interval time.Duration) *Service {
+	return &Service{
+		h:         h,
+		pinner:    pinner,
+		interval:  interval,
+		own:       newFilter(0),
+		neighbors: make(map[peer.ID]neighbor),
+	}
+}
+
+// Start handles the filters of the neighbors, and broadcasts the roots every
+// interval and when a neighbor connects, until ctx is done.
+func (s *Service) Start(ctx context.Context) {
+	s.ctx = ctx
+	s.h.SetStreamHandler(ID, s.handleStream)
+	s.h.Network().Notify((*notifiee)(s))
+	go s.loop(ctx)
+}
+
+// Close stops handling the filters of the neighbors.
+func (s *Service) Close() error {
+	s.h.RemoveStreamHandler(ID)
+	return nil
+}
+
+func (s *Service) loop(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.refresh(); err != nil {
+			log.Errorf("listing the pinned roots: %s", err)
+		}
+		seen := make(map[peer.ID]bool)
+		for _, c := range s.h.Network().Conns() {
+			p := c.RemotePeer()
+			if !seen[p] && isLocal(c.RemoteMultiaddr()) {
+				seen[p] = true
+				go s.send(ctx, p)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh rebuilds the filter of the pinned roots.
+func (s *Service) refresh() error {
+	recursive, err := s.pinner.RecursiveKeys(s.ctx)
+	if err != nil {
+		return err
+	}
+	direct, err := s.pinner.DirectKeys(s.ctx)
+	if err != nil {
+		return err
+	}
+
+	f := newFilter(len(recursive) + len(direct))
+	for _, c := range recursive {
+		f.add(c)
+	}
+	for _, c := range direct {
+		f.add(c)
+	}
+
+	s.mu.Lock()
+	s.own = f
+	s.mu.Unlock()
+	return nil
+}
+
+// send sends the filter of the node to p.
+func (s *Service) send(ctx context.Context, p peer.ID) {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	s.mu.Lock()
+	f := s.own
+	s.mu.Unlock()
+
+	st, err := s.h.NewStream(ctx, p, ID)
+	if err != nil {
+		log.Debugf("sending the roots to %s: %s", p.Pretty(), err)
+		return
+	}
+	defer st.Close()
+	st.SetDeadline(time.Now().Add(sendTimeout))
+
+	if err := json.NewEncoder(st).Encode(f); err != nil {
+		st.Reset()
+		log.Debugf("sending the roots to %s: %s", p.Pretty(), err)
+		return
+	}
+
+	s.mu.Lock()
+	s.sent++
+	s.mu.Unlock()
+}
+
+func (s *Service) handleStream(st inet.Stream) {
+	defer st.Close()
+	st.SetDeadline(time.Now().Add(sendTimeout))
+
+	// only the neighbors are trusted to announce their roots
+	if !isLocal(st.Conn().RemoteMultiaddr()) {
+		st.Reset()
+		return
+	}
+
+	var f filter
+	if err := json.NewDecoder(io.LimitReader(st, maxMessageSize)).Decode(&f); err != nil {
+		st.Reset()
+		log.Debugf("receiving the roots of %s: %s", st.Conn().RemotePeer().Pretty(), err)
+		return
+	}
+
+	s.mu.Lock()
+	s.neighbors[st.Conn().RemotePeer()] = neighbor{f: &f, received: time.Now()}
+	s.mu.Unlock()
+}
+
+func (s *Service) expireLocked(now time.Time) {
+	for p, n := range s.neighbors {
+		if now.Sub(n.received) > 3*s.interval {
+			delete(s.neighbors, p)
+		}
+	}
+}
+
+// Providers returns the neighbors whose filter has c.
+func (s *Service) Providers(c cid.Cid) []peer.ID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(time.Now())
+
+	var out []peer.ID
+	for p, n := range s.neighbors {
+		if n.f.has(c) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Stats returns the statistics of s.
+func (s *Service) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(time.Now())
+
+	st := Stats{
+		Interval: s.interval,
+		Roots:    s.own.Roots,
+		Sent:     s.sent,
+		Hits:     s.hits,
+		Misses:   s.misses,
+	}
+	for p, n := range s.neighbors {
+		st.Neighbors = append(st.Neighbors, NeighborStat{
+			Peer:              p.Pretty(),
+			Roots:             n.f.Roots,
+			FalsePositiveRate: n.f.falsePositiveRate(),
+			Received:          n.received,
+		})
+	}
+	sort.Slice(st.Neighbors, func(i, j int) bool {
+		return st.Neighbors[i].Peer < st.Neighbors[j].Peer
+	})
+	return st
+}
+
+// ErrDisabled is returned when LAN discovery isn't enabled.
+var ErrDisabled = errors.New("LAN discovery is disabled, set Discovery.LAN.Enabled to enable it")
+
+// Wrap returns a network answering the provider queries with the neighbors
+// having the CID, before asking net. It is safe to call on a nil Service, in
+// which case net is returned as is.
+func (s *Service) Wrap(net bsnet.BitSwapNetwork) bsnet.BitSwapNetwork {
+	if s == nil {
+		return net
+	}
+	return &network{BitSwapNetwork: net, s: s}
+}
+
+type network struct {
+	bsnet.BitSwapNetwork
+	s *Service
+}
+
+func (n *network) FindProvidersAsync(ctx context.Context, k cid.Cid, max int) <-chan peer.ID {
+	peers := n.s.Providers(k)
+
+	n.s.mu.Lock()
+	if len(peers) == 0 {
+		n.s.misses++
+	} else {
+		n.s.hits++
+	}
+	n.s.mu.Unlock()
+
+	if len(peers) == 0 {
+		return n.BitSwapNetwork.FindProvidersAsync(ctx, k, max)
+	}
+	if max > 0 && len(peers) > max {
+		peers = peers[:max]
+	}
+	out := make(chan peer.ID, len(peers))
+	for _, p := range peers {
+		out <- p
+	}
+	close(out)
+	return out
+}
+
+type notifiee Service
+
+// Connected sends the roots to the neighbors the node dials; the neighbors
+// dialing the node do the same.
+func (n *notifiee) Connected(_ inet.Network, c inet.Conn) {
+	s := (*Service)(n)
+	if c.Stat().Direction == inet.DirOutbound && isLocal(c.RemoteMultiaddr()) {
+		go s.send(s.ctx, c.RemotePeer())
+	}
+}
+
+func (n *notifiee) Disconnected(inet.Network, inet.Conn)   {}
+func (n *notifiee) Listen(inet.Network, ma.Multiaddr)      {}
+func (n *notifiee) ListenClose(inet.Network, ma.Multiaddr) {}
+func (n *notifiee) OpenedStream(inet.Network, inet.Stream) {}
+func (n *notifiee) ClosedStream(inet.Network, inet.Stream) {}
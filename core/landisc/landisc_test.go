@@ -0,0 +1,99 @@
+package landisc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	bsnet "github.com/ipfs/go-bitswap/network"
+	cid "github.com/ipfs/go-cid"
+	u "github.com/ipfs/go-ipfs-util"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func testCid(i int) cid.Cid {
+	return cid.NewCidV0(u.Hash([]byte(fmt.Sprintf("root %d", i))))
+}
+
+func TestFilter(t *testing.T) {
+	f := newFilter(1000)
+	for i := 0; i < 1000; i++ {
+		f.add(testCid(i))
+	}
+	for i := 0; i < 1000; i++ {
+		if !f.has(testCid(i)) {
+			t.Fatalf("expected root %d in the filter", i)
+		}
+	}
+	// the CIDv1 of a root matches too
+	if !f.has(cid.NewCidV1(cid.DagProtobuf, testCid(0).Hash())) {
+		t.Fatal("expected the versions of a CID to match")
+	}
+
+	fp := 0
+	for i := 1000; i < 11000; i++ {
+		if f.has(testCid(i)) {
+			fp++
+		}
+	}
+	if fp > 300 {
+		t.Fatalf("too many false positives: %d out of 10000", fp)
+	}
+}
+
+func TestIsLocal(t *testing.T) {
+	for a, local := range map[string]bool{
+		"/ip4/127.0.0.1/tcp/4001":   true,
+		"/ip4/192.168.1.5/tcp/4001": true,
+		"/ip4/10.1.2.3/udp/4001":    true,
+		"/ip6/fe80::1/tcp/4001":     true,
+		"/ip4/8.8.8.8/tcp/4001":     false,
+		"/ip6/2001:db8::1/tcp/4001": false,
+	} {
+		if got := isLocal(ma.StringCast(a)); got != local {
+			t.Errorf("isLocal(%s) = %v, expected %v", a, got, local)
+		}
+	}
+}
+
+// routingNetwork is a network whose routing always finds the same peer.
+type routingNetwork struct {
+	bsnet.BitSwapNetwork
+	p peer.ID
+}
+
+func (n *routingNetwork) FindProvidersAsync(context.Context, cid.Cid, int) <-chan peer.ID {
+	out := make(chan peer.ID, 1)
+	out <- n.p
+	close(out)
+	return out
+}
+
+func TestWrap(t *testing.T) {
+	s := New(nil, nil, time.Minute)
+	f := newFilter(1)
+	f.add(testCid(1))
+	var near, far peer.ID = "near", "far"
+	s.neighbors[near] = neighbor{f: f, received: time.Now()}
+
+	net := s.Wrap(&routingNetwork{p: far})
+	find := func(c cid.Cid) []peer.ID {
+		var out []peer.ID
+		for p := range net.FindProvidersAsync(context.Background(), c, 10) {
+			out = append(out, p)
+		}
+		return out
+	}
+
+	if ps := find(testCid(1)); len(ps) != 1 || ps[0] != near {
+		t.Fatalf("expected the neighbor to provide root 1, got %v", ps)
+	}
+	if ps := find(testCid(2)); len(ps) != 1 || ps[0] != far {
+		t.Fatalf("expected the routing to provide root 2, got %v", ps)
+	}
+	if st := s.Stats(); st.Hits != 1 || st.Misses != 1 || len(st.Neighbors) != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
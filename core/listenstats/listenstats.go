@@ -0,0 +1,262 @@
+// Package listenstats counts the connections accepted on each listen address
+// of the swarm, the security handshakes which failed on them, and the bytes
+// their connections transferred, to find which of the addresses advertised
+// carry the traffic.
+//
+// The counters are kept by local address of the connections, and summed up
+// by listener when they are read: a listener on 0.0.0.0 sums up the
+// connections accepted on every IPv4 address. The handshakes and the bytes
+// are counted by wrapping the security transports, so the transports securing
+// their connections themselves, as QUIC, only count the connections accepted.
+package listenstats
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	logging "github.com/ipfs/go-log"
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	sec "github.com/libp2p/go-libp2p-core/sec"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+var log = logging.Logger("listenstats")
+
+// Listener is the statistics of a listen address.
+type Listener struct {
+	Addr string
+
+	// Accepted is the number of connections accepted, and Open the
+	// number still open.
+	Accepted int64
+	Open     int
+
+	// HandshakeFailures is the number of connections accepted whose
+	// security handshake failed.
+	HandshakeFailures int64
+
+	BytesIn  int64
+	BytesOut int64
+
+	// Closed is set for the addresses the swarm doesn't listen on
+	// anymore.
+	Closed bool `json:",omitempty"`
+}
+
+// counters are the counters of a local address. The fields are updated
+// atomically.
+type counters struct {
+	accepted int64
+	failures int64
+	bytesIn  int64
+	bytesOut int64
+}
+
+// Stats counts the connections of the listen addresses.
+type Stats struct {
+	mu    sync.Mutex
+	local map[string]*counters
+}
+
+// New creates a Stats.
+func New() *Stats {
+	return &Stats{local: make(map[string]*counters)}
+}
+
+func (s *Stats) counters(local ma.Multiaddr) *counters {
+	key := local.String()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.local[key]
+	if !ok {
+		c = new(counters)
+		s.local[key] = c
+	}
+	return c
+}
+
+// Watch counts the connections accepted by h until ctx is done.
+func (s *Stats) Watch(ctx context.Context, h host.Host) {
+	n := &notifee{s: s}
+	h.Network().Notify(n)
+	go func() {
+		<-ctx.Done()
+		h.Network().StopNotify(n)
+	}()
+}
+
+// Listeners returns the statistics of the listen addresses of h, followed by
+// the ones of the addresses h doesn't listen on anymore.
+func (s *Stats) Listeners(h host.Host) []Listener {
+	return s.listeners(h.Network().ListenAddresses(), h.Network().Conns())
+}
+
+func (s *Stats) listeners(listening []ma.Multiaddr, conns []inet.Conn) []Listener {
+	out := make([]Listener, len(listening))
+	index := make(map[string]int, len(listening))
+	for i, a := range listening {
+		out[i].Addr = a.String()
+		index[a.String()] = i
+	}
+	get := func(local ma.Multiaddr) *Listener {
+		if l := match(listening, local); l != nil {
+			return &out[index[l.String()]]
+		}
+		key := local.String()
+		i, ok := index[key]
+		if !ok {
+			i = len(out)
+			index[key] = i
+			out = append(out, Listener{Addr: key, Closed: true})
+		}
+		return &out[i]
+	}
+
+	s.mu.Lock()
+	locals := make(map[string]*counters, len(s.local))
+	for k, c := range s.local {
+		locals[k] = c
+	}
+	s.mu.Unlock()
+
+	keys := make([]string, 0, len(locals))
+	for k := range locals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		local, err := ma.NewMultiaddr(k)
+		if err != nil {
+			continue
+		}
+		c := locals[k]
+		l := get(local)
+		l.Accepted += atomic.LoadInt64(&c.accepted)
+		l.HandshakeFailures += atomic.LoadInt64(&c.failures)
+		l.BytesIn += atomic.LoadInt64(&c.bytesIn)
+		l.BytesOut += atomic.LoadInt64(&c.bytesOut)
+	}
+
+	for _, c := range conns {
+		if c.Stat().Direction == inet.DirInbound {
+			get(c.LocalMultiaddr()).Open++
+		}
+	}
+	return out
+}
+
+// match returns the listen address a connection with the local address local
+// was accepted on, or nil.
+func match(listening []ma.Multiaddr, local ma.Multiaddr) ma.Multiaddr {
+	for _, l := range listening {
+		if listensOn(l, local) {
+			return l
+		}
+	}
+	return nil
+}
+
+// listensOn returns whether a connection with local address addr was accepted
+// on the listen address l: they are equal, or l has an unspecified IP and
+// the same transport and port.
+func listensOn(l, addr ma.Multiaddr) bool {
+	if l.Equal(addr) {
+		return true
+	}
+
+	lip, lrest := ma.SplitFirst(l)
+	aip, arest := ma.SplitFirst(addr)
+	if lip == nil || aip == nil || lrest == nil || arest == nil {
+		return false
+	}
+	if lip.Protocol().Code != aip.Protocol().Code {
+		return false
+	}
+	if !manet.IsIPUnspecified(lip) {
+		return false
+	}
+	return lrest.Equal(arest)
+}
+
+// notifee counts the connections accepted.
+type notifee struct {
+	s *Stats
+}
+
+func (n *notifee) Connected(_ inet.Network, c inet.Conn) {
+	if c.Stat().Direction != inet.DirInbound {
+		return
+	}
+	atomic.AddInt64(&n.s.counters(c.LocalMultiaddr()).accepted, 1)
+}
+
+func (n *notifee) Disconnected(inet.Network, inet.Conn)   {}
+func (n *notifee) Listen(inet.Network, ma.Multiaddr)      {}
+func (n *notifee) ListenClose(inet.Network, ma.Multiaddr) {}
+func (n *notifee) OpenedStream(inet.Network, inet.Stream) {}
+func (n *notifee) ClosedStream(inet.Network, inet.Stream) {}
+
+// Security wraps t to count the handshakes which failed on the connections
+// accepted, and the bytes of the connections secured. It is safe to call on
+// a nil Stats, in which case t is returned as is.
+func (s *Stats) Security(t sec.SecureTransport) sec.SecureTransport {
+	if s == nil {
+		return t
+	}
+	return &security{SecureTransport: t, s: s}
+}
+
+type security struct {
+	sec.SecureTransport
+	s *Stats
+}
+
+// SecureInbound counts the handshake if it fails, and the bytes of the
+// connection once secured. The outbound connections are not counted.
+func (t *security) SecureInbound(ctx context.Context, insecure net.Conn) (sec.SecureConn, error) {
+	local, err := localAddr(insecure)
+	if err != nil {
+		log.Debugf("unknown local address of %s: %s", insecure.LocalAddr(), err)
+		return t.SecureTransport.SecureInbound(ctx, insecure)
+	}
+	c := t.s.counters(local)
+
+	conn, err := t.SecureTransport.SecureInbound(ctx, insecure)
+	if err != nil {
+		atomic.AddInt64(&c.failures, 1)
+		return nil, err
+	}
+	return &countedConn{SecureConn: conn, c: c}, nil
+}
+
+// localAddr returns the local multiaddr of conn, which carries the transport
+// unlike the net.Addr of the connections of some transports, as websockets.
+func localAddr(conn net.Conn) (ma.Multiaddr, error) {
+	if c, ok := conn.(manet.Conn); ok {
+		return c.LocalMultiaddr(), nil
+	}
+	return manet.FromNetAddr(conn.LocalAddr())
+}
+
+// countedConn counts the bytes read and written on a secured connection.
+type countedConn struct {
+	sec.SecureConn
+	c *counters
+}
+
+func (c *countedConn) Read(b []byte) (int, error) {
+	n, err := c.SecureConn.Read(b)
+	atomic.AddInt64(&c.c.bytesIn, int64(n))
+	return n, err
+}
+
+func (c *countedConn) Write(b []byte) (int, error) {
+	n, err := c.SecureConn.Write(b)
+	atomic.AddInt64(&c.c.bytesOut, int64(n))
+	return n, err
+}
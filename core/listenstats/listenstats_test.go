@@ -0,0 +1,110 @@
+package listenstats
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	sec "github.com/libp2p/go-libp2p-core/sec"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// maConn is a connection with a local multiaddr, as the ones of the
+// transports.
+type maConn struct {
+	net.Conn
+	local ma.Multiaddr
+}
+
+func (c *maConn) LocalMultiaddr() ma.Multiaddr  { return c.local }
+func (c *maConn) RemoteMultiaddr() ma.Multiaddr { return c.local }
+
+type secureConn struct {
+	sec.SecureConn
+	conn net.Conn
+}
+
+func (c *secureConn) Read(b []byte) (int, error)  { return c.conn.Read(b) }
+func (c *secureConn) Write(b []byte) (int, error) { return c.conn.Write(b) }
+
+// transport fails the handshakes of the connections when fail is set.
+type transport struct {
+	sec.SecureTransport
+	fail bool
+}
+
+func (t *transport) SecureInbound(ctx context.Context, insecure net.Conn) (sec.SecureConn, error) {
+	if t.fail {
+		return nil, errors.New("handshake failed")
+	}
+	return &secureConn{conn: insecure}, nil
+}
+
+func TestSecurity(t *testing.T) {
+	s := New()
+	local := ma.StringCast("/ip4/10.0.0.1/tcp/4001")
+	other := ma.StringCast("/ip4/127.0.0.1/tcp/4002")
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	conn, err := s.Security(&transport{}).SecureInbound(context.Background(), &maConn{Conn: a, local: local})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go b.Write([]byte("hello"))
+	if _, err := conn.Read(make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	go ioutil.ReadAll(b)
+	if _, err := conn.Write([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	failing := s.Security(&transport{fail: true})
+	for i := 0; i < 2; i++ {
+		if _, err := failing.SecureInbound(context.Background(), &maConn{Conn: a, local: other}); err == nil {
+			t.Fatal("expected the handshake to fail")
+		}
+	}
+
+	got := s.listeners([]ma.Multiaddr{ma.StringCast("/ip4/0.0.0.0/tcp/4001")}, nil)
+	if len(got) != 2 {
+		t.Fatalf("expected the listener and a closed address, got %+v", got)
+	}
+	if l := got[0]; l.Addr != "/ip4/0.0.0.0/tcp/4001" || l.BytesIn != 5 || l.BytesOut != 2 || l.HandshakeFailures != 0 || l.Closed {
+		t.Fatalf("unexpected statistics of the listener %+v", l)
+	}
+	if l := got[1]; l.Addr != other.String() || l.HandshakeFailures != 2 || !l.Closed {
+		t.Fatalf("unexpected statistics of the closed address %+v", l)
+	}
+}
+
+func TestListensOn(t *testing.T) {
+	for _, c := range []struct {
+		listener, local string
+		match           bool
+	}{
+		{"/ip4/0.0.0.0/tcp/4001", "/ip4/192.168.1.2/tcp/4001", true},
+		{"/ip4/0.0.0.0/tcp/4001", "/ip4/192.168.1.2/tcp/4002", false},
+		{"/ip4/0.0.0.0/tcp/4001", "/ip6/::1/tcp/4001", false},
+		{"/ip4/0.0.0.0/tcp/4001", "/ip4/192.168.1.2/tcp/4001/ws", false},
+		{"/ip6/::/udp/4001/quic", "/ip6/::1/udp/4001/quic", true},
+		{"/ip4/10.0.0.1/tcp/4001", "/ip4/10.0.0.1/tcp/4001", true},
+		{"/ip4/10.0.0.1/tcp/4001", "/ip4/10.0.0.2/tcp/4001", false},
+	} {
+		if got := listensOn(ma.StringCast(c.listener), ma.StringCast(c.local)); got != c.match {
+			t.Errorf("listensOn(%s, %s) = %v", c.listener, c.local, got)
+		}
+	}
+}
+
+func TestNilStats(t *testing.T) {
+	var s *Stats
+	tpt := &transport{}
+	if s.Security(tpt) != sec.SecureTransport(tpt) {
+		t.Fatal("expected a nil Stats not to wrap the transport")
+	}
+}
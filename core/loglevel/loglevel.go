@@ -0,0 +1,54 @@
+// Package loglevel sets the log levels of the subsystems from the config, at
+// startup and on 'ipfs config reload'.
+package loglevel
+
+import (
+	"fmt"
+	"sort"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	logging "github.com/ipfs/go-log"
+)
+
+// ConfigKey is the config key of the Logging section.
+const ConfigKey = "Logging"
+
+// allSubsystems sets the level of every subsystem, as in 'ipfs log level'.
+const allSubsystems = "all"
+
+// Config holds the Logging config section.
+type Config struct {
+	// Levels maps the subsystems, or "all", to their log level.
+	Levels map[string]string
+}
+
+// LoadConfig reads the Logging section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// Apply sets the levels of cfg, the level of "all" first so that the levels
+// of the subsystems override it.
+func (cfg Config) Apply() error {
+	subsystems := make([]string, 0, len(cfg.Levels))
+	for s := range cfg.Levels {
+		if s != allSubsystems {
+			subsystems = append(subsystems, s)
+		}
+	}
+	sort.Strings(subsystems)
+	if level, ok := cfg.Levels[allSubsystems]; ok {
+		if err := logging.SetLogLevel("*", level); err != nil {
+			return fmt.Errorf("invalid %s.Levels.%s %q: %s", ConfigKey, allSubsystems, level, err)
+		}
+	}
+	for _, s := range subsystems {
+		if err := logging.SetLogLevel(s, cfg.Levels[s]); err != nil {
+			return fmt.Errorf("invalid %s.Levels.%s %q: %s", ConfigKey, s, cfg.Levels[s], err)
+		}
+	}
+	return nil
+}
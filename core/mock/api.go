@@ -0,0 +1,105 @@
+package coremock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/keystore"
+	"github.com/ipfs/go-ipfs/repo"
+
+	"github.com/ipfs/go-datastore"
+	syncds "github.com/ipfs/go-datastore/sync"
+	config "github.com/ipfs/go-ipfs-config"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+// NewMockAPI returns a CoreAPI backed by an in-memory node, for use in tests
+// of applications embedding go-ipfs. Nothing touches the disk or the real
+// network. The node is stopped when ctx is cancelled.
+func NewMockAPI(ctx context.Context) (coreiface.CoreAPI, error) {
+	apis, err := NewMockAPISwarm(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	return apis[0], nil
+}
+
+// NewMockAPISwarm returns the CoreAPIs of n in-memory nodes, all connected to
+// each other over a simulated network. Every node has its own identity, so
+// Name, Key and Swarm work as they would on real nodes. The nodes are stopped
+// when ctx is cancelled.
+func NewMockAPISwarm(ctx context.Context, n int) ([]coreiface.CoreAPI, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("need at least one node, got %d", n)
+	}
+
+	mn := mocknet.New(ctx)
+	apis := make([]coreiface.CoreAPI, n)
+	for i := 0; i < n; i++ {
+		r, err := mockRepo(i)
+		if err != nil {
+			return nil, err
+		}
+
+		node, err := core.NewNode(ctx, &core.BuildCfg{
+			Repo:   r,
+			Host:   MockHostOption(mn),
+			Online: true,
+			ExtraOpts: map[string]bool{
+				"pubsub": true,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		apis[i], err = coreapi.NewCoreAPI(node)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mn.LinkAll(); err != nil {
+		return nil, err
+	}
+	if err := mn.ConnectAllButSelf(); err != nil {
+		return nil, err
+	}
+	return apis, nil
+}
+
+// mockRepo returns an in-memory repo for the i-th node of a mock swarm.
+func mockRepo(i int) (repo.Repo, error) {
+	sk, pk, err := ci.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	kbytes, err := sk.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	c := config.Config{}
+	c.Identity = config.Identity{
+		PeerID:  id.Pretty(),
+		PrivKey: base64.StdEncoding.EncodeToString(kbytes),
+	}
+	c.Addresses.Swarm = []string{fmt.Sprintf("/ip4/127.%d.%d.1/tcp/4001", i/256, i%256)}
+
+	return &repo.Mock{
+		C: c,
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+		K: keystore.NewMemKeystore(),
+	}, nil
+}
@@ -0,0 +1,49 @@
+package coremock
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+func TestMockAPISwarm(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	apis, err := NewMockAPISwarm(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peers, err := apis[0].Swarm().Peers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 {
+		t.Fatalf("expected 1 peer, got %d", len(peers))
+	}
+
+	data := []byte("hello mock api")
+	p, err := apis[0].Unixfs().Add(ctx, files.NewBytesFile(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apis[1].Pin().Add(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := apis[1].Unixfs().Get(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(files.ToFile(nd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("expected %q, got %q", data, out)
+	}
+}
@@ -0,0 +1,12 @@
+package node
+
+import (
+	"github.com/ipfs/go-ipfs/core/apiauth"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// APIAuth loads the tokens of API.Authorizations, which the HTTP API requires
+// once any is configured
+func APIAuth(repo repo.Repo) (*apiauth.Authorizer, error) {
+	return apiauth.New(repo)
+}
@@ -0,0 +1,18 @@
+package node
+
+import (
+	bserv "github.com/ipfs/go-blockservice"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+
+	"github.com/ipfs/go-ipfs/core/backup"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// Backup creates the store of the backup target mode, with the given config
+func Backup(cfg backup.Config) func(repo repo.Repo, bs bserv.BlockService, dag ipld.DAGService, pinning pin.Pinner, gcl blockstore.GCLocker) *backup.Store {
+	return func(repo repo.Repo, bs bserv.BlockService, dag ipld.DAGService, pinning pin.Pinner, gcl blockstore.GCLocker) *backup.Store {
+		return backup.New(cfg, repo.Datastore(), bs, dag, pinning, gcl)
+	}
+}
@@ -0,0 +1,30 @@
+package node
+
+import (
+	"context"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/channel"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// Channels creates the channel service, which publishes and follows channels
+// over pubsub
+func Channels(mctx helpers.MetricsCtx, lc fx.Lifecycle, ps *pubsub.PubSub, repo repo.Repo, dag ipld.DAGService, pinning pin.Pinner, gcl blockstore.GCLocker) *channel.Service {
+	svc := channel.New(helpers.LifecycleCtx(mctx, lc), ps, repo.Keystore(), repo.Datastore(), dag, pinning, gcl)
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			return svc.Start()
+		},
+		OnStop: func(ctx context.Context) error {
+			return svc.Close()
+		},
+	})
+	return svc
+}
@@ -0,0 +1,38 @@
+package node
+
+import (
+	"context"
+
+	host "github.com/libp2p/go-libp2p-core/host"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/clockskew"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// ClockSkew estimates the offset of the local clock, if enabled in the config
+func ClockSkew(repo repo.Repo) (*clockskew.Estimator, error) {
+	cfg, err := clockskew.LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	return clockskew.New(cfg)
+}
+
+// ClockSkewCheck answers the clock protocol, and starts the estimates of the
+// offset of the local clock, if enabled
+func ClockSkewCheck(lc fx.Lifecycle, h host.Host, e *clockskew.Estimator) {
+	clockskew.Serve(h)
+	if e == nil {
+		return
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			e.Start(h)
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			return e.Close()
+		},
+	})
+}
@@ -19,18 +19,44 @@ import (
 	"github.com/ipfs/go-mfs"
 	"github.com/ipfs/go-unixfs"
 	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/peerstore"
 	"github.com/libp2p/go-libp2p-core/routing"
 	"go.uber.org/fx"
 
+	"github.com/ipfs/go-ipfs/core/bspeer"
+	"github.com/ipfs/go-ipfs/core/bsqueue"
+	"github.com/ipfs/go-ipfs/core/bssession"
+	"github.com/ipfs/go-ipfs/core/dsbreaker"
+	"github.com/ipfs/go-ipfs/core/gwfed"
+	"github.com/ipfs/go-ipfs/core/landisc"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/core/nodeevents"
+	"github.com/ipfs/go-ipfs/core/peerscore"
+	"github.com/ipfs/go-ipfs/core/pinmeta"
+	"github.com/ipfs/go-ipfs/core/provsel"
+	"github.com/ipfs/go-ipfs/core/qos"
+	"github.com/ipfs/go-ipfs/core/tracing"
+	"github.com/ipfs/go-ipfs/gc"
 	"github.com/ipfs/go-ipfs/repo"
 )
 
+type blockServiceIn struct {
+	fx.In
+
+	Lifecycle  fx.Lifecycle
+	Blockstore blockstore.Blockstore
+	Exchange   exchange.Interface
+	Sessions   *bssession.Tracker `optional:"true"`
+	Federation *gwfed.Federation  `optional:"true"`
+	Tracer     *tracing.Tracer    `optional:"true"`
+}
+
 // BlockService creates new blockservice which provides an interface to fetch content-addressable blocks
-func BlockService(lc fx.Lifecycle, bs blockstore.Blockstore, rem exchange.Interface) blockservice.BlockService {
-	bsvc := blockservice.New(bs, rem)
+func BlockService(in blockServiceIn) blockservice.BlockService {
+	bsvc := blockservice.New(in.Blockstore, in.Tracer.Exchange(in.Federation.Exchange(in.Sessions.Exchange(in.Exchange))))
 
-	lc.Append(fx.Hook{
+	in.Lifecycle.Append(fx.Hook{
 		OnStop: func(ctx context.Context) error {
 			return bsvc.Close()
 		},
@@ -39,8 +65,14 @@ func BlockService(lc fx.Lifecycle, bs blockstore.Blockstore, rem exchange.Interf
 	return bsvc
 }
 
+// PinMeta opens the store of the names and metadata of the pins, migrating it
+// if needed
+func PinMeta(repo repo.Repo) (*pinmeta.Store, error) {
+	return pinmeta.Open(repo.Datastore())
+}
+
 // Pinning creates new pinner which tells GC which blocks should be kept
-func Pinning(bstore blockstore.Blockstore, ds format.DAGService, repo repo.Repo) (pin.Pinner, error) {
+func Pinning(bstore blockstore.Blockstore, ds format.DAGService, repo repo.Repo, meta *pinmeta.Store, barrier *gc.Barrier, events *nodeevents.Bus) (pin.Pinner, error) {
 	internalDag := merkledag.NewDAGService(blockservice.New(bstore, offline.Exchange(bstore)))
 	rootDS := repo.Datastore()
 
@@ -62,7 +94,7 @@ func Pinning(bstore blockstore.Blockstore, ds format.DAGService, repo repo.Repo)
 		pinning = pin.NewPinner(rootDS, syncDs, syncInternalDag)
 	}
 
-	return pinning, nil
+	return events.Pinner(barrier.Pinner(pinmeta.Wrap(pinning, meta))), nil
 }
 
 // syncDagService is used by the Pinner to ensure data gets persisted to the underlying datastore
@@ -82,17 +114,70 @@ func Dag(bs blockservice.BlockService) format.DAGService {
 
 // OnlineExchange creates new LibP2P backed block exchange (BitSwap)
 func OnlineExchange(provide bool) interface{} {
-	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, rt routing.Routing, bs blockstore.GCBlockstore) exchange.Interface {
-		bitswapNetwork := network.NewFromIpfsHost(host, rt)
-		exch := bitswap.New(helpers.LifecycleCtx(mctx, lc), bitswapNetwork, bs, bitswap.ProvideEnabled(provide))
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, rt routing.Routing, bs blockstore.GCBlockstore, brk *dsbreaker.Breaker, sel *provsel.Selector, peers *bspeer.Controls, sessions *bssession.Tracker, lan *landisc.Service, q *qos.Scheduler, scores *peerscore.Tracker, repo repo.Repo) (exchange.Interface, error) {
+		qcfg, err := bsqueue.LoadConfig(repo)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		bitswapNetwork := sessions.Wrap(sel.Wrap(lan.Wrap(bsqueue.Wrap(ctx, peers.Wrap(q.Wrap(scores.Wrap(network.NewFromIpfsHost(host, rt)))), qcfg))))
+		exch := bitswap.New(ctx, bitswapNetwork, brk.Blockstore(bs), bitswap.ProvideEnabled(provide))
 		lc.Append(fx.Hook{
 			OnStop: func(ctx context.Context) error {
 				return exch.Close()
 			},
 		})
-		return exch
+		return exch, nil
+
+	}
+}
+
+type providerSelectorIn struct {
+	fx.In
+
+	Peerstore peerstore.Peerstore
+	Reporter  *metrics.BandwidthCounter `optional:"true"`
+}
+
+// ProviderSelector creates the selector ranking the providers bitswap fetches
+// blocks from
+func ProviderSelector(in providerSelectorIn) *provsel.Selector {
+	var bwc metrics.Reporter
+	if in.Reporter != nil {
+		bwc = in.Reporter
+	}
+	return provsel.New(in.Peerstore, bwc)
+}
 
+// BitswapSessions creates the tracker of the bitswap sessions
+func BitswapSessions() *bssession.Tracker {
+	return bssession.New()
+}
+
+// GatewayFederation creates the fetcher of the blocks the network doesn't have
+// from the upstream gateways, nil unless some are configured
+func GatewayFederation(mctx helpers.MetricsCtx, repo repo.Repo) (*gwfed.Federation, error) {
+	cfg, err := gwfed.LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	return gwfed.New(mctx, cfg)
+}
+
+// BitswapPeers loads the per-peer bitswap limits
+func BitswapPeers(repo repo.Repo) (*bspeer.Controls, error) {
+	return bspeer.New(repo.Datastore())
+}
+
+// QoS creates the scheduler sharing the serving bandwidth between the classes
+// of peers, if configured
+func QoS(repo repo.Repo, host host.Host) (*qos.Scheduler, error) {
+	cfg, err := qos.LoadConfig(repo)
+	if err != nil {
+		return nil, err
 	}
+	return qos.New(cfg, host.ConnManager())
 }
 
 // Files loads persisted MFS root
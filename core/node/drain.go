@@ -0,0 +1,34 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/drain"
+	"github.com/ipfs/go-ipfs/core/provsel"
+)
+
+// goAwayTag is the connection manager tag of the peers going away, which
+// makes their connections the first ones trimmed.
+const goAwayTag = "goaway"
+
+// Drain drains the transfers of the host when the node stops, and ranks the
+// peers announcing they are going away last. It takes the exchange so that
+// the drain runs before bitswap is stopped
+func Drain(lc fx.Lifecycle, d *drain.Drainer, h host.Host, sel *provsel.Selector, _ exchange.Interface) {
+	drain.HandleGoAway(h, func(p peer.ID, timeout time.Duration) {
+		sel.Depart(p, timeout)
+		h.ConnManager().TagPeer(p, goAwayTag, -100)
+	})
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return d.Drain(ctx, h)
+		},
+	})
+}
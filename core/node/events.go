@@ -0,0 +1,21 @@
+package node
+
+import (
+	host "github.com/libp2p/go-libp2p-core/host"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/core/nodeevents"
+)
+
+// NodeEvents provides the bus of the events of the node, streamed by
+// 'ipfs diag events'
+func NodeEvents() *nodeevents.Bus {
+	return nodeevents.New()
+}
+
+// WatchEvents publishes the events of the swarm on the bus while the node
+// runs
+func WatchEvents(mctx helpers.MetricsCtx, lc fx.Lifecycle, bus *nodeevents.Bus, h host.Host) error {
+	return bus.Watch(helpers.LifecycleCtx(mctx, lc), h)
+}
@@ -0,0 +1,28 @@
+package node
+
+import (
+	"path/filepath"
+
+	"github.com/ipfs/go-ipfs/core/geoip"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// GeoIP loads the databases locating the peers, if set in the config
+func GeoIP(repo repo.Repo) (*geoip.DB, error) {
+	cfg, err := geoip.LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Databases) == 0 {
+		return nil, nil
+	}
+
+	paths := make([]string, len(cfg.Databases))
+	for i, p := range cfg.Databases {
+		if r, ok := repo.(interface{ Path() string }); ok && !filepath.IsAbs(p) {
+			p = filepath.Join(r.Path(), p)
+		}
+		paths[i] = p
+	}
+	return geoip.Open(paths...)
+}
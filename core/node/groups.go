@@ -9,10 +9,19 @@ import (
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	config "github.com/ipfs/go-ipfs-config"
 	util "github.com/ipfs/go-ipfs-util"
+	host "github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 
+	"github.com/ipfs/go-ipfs/core/backup"
+	"github.com/ipfs/go-ipfs/core/chaos"
+	"github.com/ipfs/go-ipfs/core/dsbreaker"
+	"github.com/ipfs/go-ipfs/core/filescp"
+	"github.com/ipfs/go-ipfs/core/listenstats"
 	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/core/reload"
+	"github.com/ipfs/go-ipfs/core/streammeter"
+	"github.com/ipfs/go-ipfs/core/watchdog"
 	"github.com/ipfs/go-ipfs/p2p"
 
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
@@ -28,40 +37,37 @@ var BaseLibP2P = fx.Options(
 	fx.Provide(libp2p.ConnectionManager),
 	fx.Provide(libp2p.DefaultTransports),
 
+	fx.Provide(streammeter.New),
+	fx.Provide(listenstats.New),
+	fx.Provide(libp2p.Drainer),
+	fx.Provide(libp2p.DHTRecordStore),
+	fx.Provide(libp2p.PeerScores),
 	fx.Provide(libp2p.Host),
 
 	fx.Provide(libp2p.DiscoveryHandler),
+	fx.Provide(libp2p.NewReachability),
+	fx.Provide(libp2p.Roaming),
+	fx.Provide(libp2p.ObservedAddrs),
+	fx.Invoke(libp2p.WatchListeners),
 
 	fx.Invoke(libp2p.PNetChecker),
+	fx.Provide(libp2p.PNetInvite),
+	fx.Provide(libp2p.PeerExchange),
+	fx.Invoke(libp2p.ProtectPeers),
+	fx.Invoke(libp2p.TagPeerScores),
+	fx.Invoke(libp2p.ReloadSwarm),
 )
 
 func LibP2P(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 	// parse ConnMgr config
 
-	grace := config.DefaultConnMgrGracePeriod
-	low := config.DefaultConnMgrLowWater
-	high := config.DefaultConnMgrHighWater
-
 	connmgr := fx.Options()
 
 	if cfg.Swarm.ConnMgr.Type != "none" {
-		switch cfg.Swarm.ConnMgr.Type {
-		case "":
-			// 'default' value is the basic connection manager
-			break
-		case "basic":
-			var err error
-			grace, err = time.ParseDuration(cfg.Swarm.ConnMgr.GracePeriod)
-			if err != nil {
-				return fx.Error(fmt.Errorf("parsing Swarm.ConnMgr.GracePeriod: %s", err))
-			}
-
-			low = cfg.Swarm.ConnMgr.LowWater
-			high = cfg.Swarm.ConnMgr.HighWater
-		default:
-			return fx.Error(fmt.Errorf("unrecognized ConnMgr.Type: %q", cfg.Swarm.ConnMgr.Type))
+		low, high, grace, err := libp2p.ConnMgrLimits(cfg.Swarm.ConnMgr)
+		if err != nil {
+			return fx.Error(err)
 		}
-
 		connmgr = fx.Provide(libp2p.ConnectionManager(low, high, grace))
 	}
 
@@ -99,6 +105,7 @@ func LibP2P(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 		fx.Provide(libp2p.AddrsFactory(cfg.Addresses.Announce, cfg.Addresses.NoAnnounce)),
 		fx.Provide(libp2p.SmuxTransport(bcfg.getOpt("mplex"))),
 		fx.Provide(libp2p.Relay(cfg.Swarm.DisableRelay, cfg.Swarm.EnableRelayHop)),
+		maybeInvoke(libp2p.StaticRelays, !cfg.Swarm.DisableRelay),
 		fx.Invoke(libp2p.StartListening(cfg.Addresses.Swarm)),
 		fx.Invoke(libp2p.SetupDiscovery(cfg.Discovery.MDNS.Enabled, cfg.Discovery.MDNS.Interval)),
 
@@ -137,7 +144,14 @@ func Storage(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 	return fx.Options(
 		fx.Provide(RepoConfig),
 		fx.Provide(Datastore),
-		fx.Provide(BaseBlockstoreCtor(cacheOpts, bcfg.NilRepo, cfg.Datastore.HashOnRead)),
+		fx.Provide(HashStats(cfg.Datastore.HashOnRead)),
+		fx.Provide(Metrics),
+		fx.Provide(Tracing),
+		fx.Provide(Packs),
+		fx.Provide(BaseBlockstoreCtor(cacheOpts, bcfg.NilRepo)),
+		fx.Provide(Quota),
+		fx.Provide(BlockCounter),
+		fx.Provide(ProvideDiff),
 		finalBstore,
 	)
 }
@@ -184,6 +198,7 @@ func Identity(cfg *config.Config) fx.Option {
 
 // IPNS groups namesys related units
 var IPNS = fx.Options(
+	fx.Provide(ClockSkew),
 	fx.Provide(RecordValidator),
 )
 
@@ -230,12 +245,28 @@ func Online(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 	shouldBitswapProvide := !cfg.Experimental.StrategicProviding
 
 	return fx.Options(
+		fx.Provide(ProviderSelector),
+		fx.Provide(BitswapPeers),
+		fx.Provide(BitswapSessions),
+		fx.Provide(QoS),
+		fx.Provide(GatewayFederation),
+		fx.Provide(LANDiscovery),
 		fx.Provide(OnlineExchange(shouldBitswapProvide)),
 		fx.Provide(Namesys(ipnsCacheSize)),
 
-		fx.Invoke(IpnsRepublisher(repubPeriod, recordLifetime)),
+		fx.Provide(IpnsRepublisher(repubPeriod, recordLifetime)),
 
 		fx.Provide(p2p.New),
+		maybeProvide(Channels, bcfg.getOpt("pubsub")),
+		maybeProvide(KV, bcfg.getOpt("pubsub")),
+		fx.Provide(Replica),
+		fx.Provide(PinPush),
+		fx.Provide(GeoIP),
+		fx.Provide(SLO),
+		fx.Provide(Partition),
+		fx.Invoke(ClockSkewCheck),
+		fx.Invoke(Drain),
+		fx.Invoke(WatchEvents),
 
 		LibP2P(bcfg, cfg),
 		OnlineProviders(cfg.Experimental.StrategicProviding, cfg.Reprovider.Strategy, cfg.Reprovider.Interval),
@@ -257,8 +288,15 @@ var Core = fx.Options(
 	fx.Provide(BlockService),
 	fx.Provide(Dag),
 	fx.Provide(resolver.NewBasicResolver),
+	fx.Provide(PinMeta),
+	fx.Provide(NodeEvents),
 	fx.Provide(Pinning),
 	fx.Provide(Files),
+	fx.Provide(filescp.New),
+	fx.Provide(APIAuth),
+	fx.Provide(reload.New),
+	fx.Invoke(LogLevels),
+	fx.Invoke(ReloadBootstrap),
 )
 
 func Networked(bcfg *BuildCfg, cfg *config.Config) fx.Option {
@@ -268,6 +306,32 @@ func Networked(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 	return Offline(cfg)
 }
 
+// Chaos provides the fault injector, which is nil unless enabled in the
+// config, and hooks it into the network
+func Chaos(bcfg *BuildCfg, inj *chaos.Injector) fx.Option {
+	return fx.Options(
+		fx.Provide(func() *chaos.Injector { return inj }),
+		maybeInvoke(func(h host.Host) {
+			h.Network().Notify(inj.Notifiee())
+		}, bcfg.Online && inj != nil),
+	)
+}
+
+// Watchdog runs the goroutine and deadlock watchdog, if enabled in the config
+func Watchdog(wd *watchdog.Watchdog) fx.Option {
+	return maybeInvoke(func(lc fx.Lifecycle) {
+		lc.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				wd.Start()
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				return wd.Close()
+			},
+		})
+	}, wd != nil)
+}
+
 // IPFS builds a group of fx Options based on the passed BuildCfg
 func IPFS(ctx context.Context, bcfg *BuildCfg) fx.Option {
 	if bcfg == nil {
@@ -282,10 +346,33 @@ func IPFS(ctx context.Context, bcfg *BuildCfg) fx.Option {
 	// TEMP: setting global sharding switch here
 	uio.UseHAMTSharding = cfg.Experimental.ShardingEnabled
 
+	inj, err := chaos.Load(bcfg.Repo)
+	if err != nil {
+		return fx.Error(err)
+	}
+
+	wd, err := watchdog.Load(bcfg.Repo)
+	if err != nil {
+		return fx.Error(err)
+	}
+
+	brk, err := dsbreaker.Load(bcfg.Repo)
+	if err != nil {
+		return fx.Error(err)
+	}
+
+	backupCfg, backupEnabled, err := backup.LoadConfig(bcfg.Repo)
+	if err != nil {
+		return fx.Error(err)
+	}
+
 	return fx.Options(
 		bcfgOpts,
 
 		fx.Provide(baseProcess),
+		Chaos(bcfg, inj),
+		Watchdog(wd),
+		fx.Provide(func() *dsbreaker.Breaker { return brk }),
 
 		Storage(bcfg, cfg),
 		Identity(cfg),
@@ -293,5 +380,6 @@ func IPFS(ctx context.Context, bcfg *BuildCfg) fx.Option {
 		Networked(bcfg, cfg),
 
 		Core,
+		maybeProvide(Backup(backupCfg), backupEnabled),
 	)
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/libp2p/go-libp2p-core/routing"
 	"github.com/libp2p/go-libp2p-record"
 
+	"github.com/ipfs/go-ipfs/core/clockskew"
 	"github.com/ipfs/go-ipfs/namesys"
 	"github.com/ipfs/go-ipfs/namesys/republisher"
 	"github.com/ipfs/go-ipfs/repo"
@@ -18,11 +19,15 @@ import (
 
 const DefaultIpnsCacheSize = 128
 
-// RecordValidator provides namesys compatible routing record validator
-func RecordValidator(ps peerstore.Peerstore) record.Validator {
+// RecordValidator provides namesys compatible routing record validator, the
+// IPNS records validated with the slack of the clock skew
+func RecordValidator(ps peerstore.Peerstore, skew *clockskew.Estimator) record.Validator {
 	return record.NamespacedValidator{
-		"pk":   record.PublicKeyValidator{},
-		"ipns": ipns.Validator{KeyBook: ps},
+		"pk": record.PublicKeyValidator{},
+		"ipns": clockskew.Validator{
+			Validator: ipns.Validator{KeyBook: ps},
+			Estimator: skew,
+		},
 	}
 }
 
@@ -34,13 +39,13 @@ func Namesys(cacheSize int) func(rt routing.Routing, repo repo.Repo) (namesys.Na
 }
 
 // IpnsRepublisher runs new IPNS republisher service
-func IpnsRepublisher(repubPeriod time.Duration, recordLifetime time.Duration) func(lcProcess, namesys.NameSystem, repo.Repo, crypto.PrivKey) error {
-	return func(lc lcProcess, namesys namesys.NameSystem, repo repo.Repo, privKey crypto.PrivKey) error {
+func IpnsRepublisher(repubPeriod time.Duration, recordLifetime time.Duration) func(lcProcess, namesys.NameSystem, repo.Repo, crypto.PrivKey) (*republisher.Republisher, error) {
+	return func(lc lcProcess, namesys namesys.NameSystem, repo repo.Repo, privKey crypto.PrivKey) (*republisher.Republisher, error) {
 		repub := republisher.NewRepublisher(namesys, repo.Datastore(), privKey, repo.Keystore())
 
 		if repubPeriod != 0 {
 			if !util.Debug && (repubPeriod < time.Minute || repubPeriod > (time.Hour*24)) {
-				return fmt.Errorf("config setting IPNS.RepublishPeriod is not between 1min and 1day: %s", repubPeriod)
+				return nil, fmt.Errorf("config setting IPNS.RepublishPeriod is not between 1min and 1day: %s", repubPeriod)
 			}
 
 			repub.Interval = repubPeriod
@@ -50,7 +55,25 @@ func IpnsRepublisher(repubPeriod time.Duration, recordLifetime time.Duration) fu
 			repub.RecordLifetime = recordLifetime
 		}
 
+		cfg, err := republisher.LoadConfig(repo)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Concurrency < 0 {
+			return nil, fmt.Errorf("config setting %s.Concurrency is negative", republisher.ConfigKey)
+		}
+		if cfg.Concurrency != 0 {
+			repub.Concurrency = cfg.Concurrency
+		}
+		if cfg.Jitter != "" {
+			d, err := time.ParseDuration(cfg.Jitter)
+			if err != nil {
+				return nil, fmt.Errorf("failure to parse config setting %s.Jitter: %s", republisher.ConfigKey, err)
+			}
+			repub.Jitter = d
+		}
+
 		lc.Append(repub.Run)
-		return nil
+		return repub, nil
 	}
 }
@@ -0,0 +1,35 @@
+package node
+
+import (
+	"context"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/kv"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// KV creates the service replicating the key-value store over pubsub, if
+// enabled in the config
+func KV(mctx helpers.MetricsCtx, lc fx.Lifecycle, ps *pubsub.PubSub, repo repo.Repo, dag ipld.DAGService, pinning pin.Pinner, gcl blockstore.GCLocker) (*kv.Service, error) {
+	cfg, err := kv.LoadConfig(repo)
+	if err != nil || !cfg.Enabled {
+		return nil, err
+	}
+
+	svc := kv.New(helpers.LifecycleCtx(mctx, lc), cfg.Name, ps, repo.Datastore(), dag, pinning, gcl)
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			return svc.Start()
+		},
+		OnStop: func(ctx context.Context) error {
+			return svc.Close()
+		},
+	})
+	return svc, nil
+}
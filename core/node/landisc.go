@@ -0,0 +1,39 @@
+package node
+
+import (
+	"context"
+
+	pin "github.com/ipfs/go-ipfs-pinner"
+	host "github.com/libp2p/go-libp2p-core/host"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/landisc"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// LANDiscovery broadcasts the pinned roots to the local network, and looks up
+// the roots of the neighbors before the routing, if enabled in the config
+func LANDiscovery(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, h host.Host, pinning pin.Pinner) (*landisc.Service, error) {
+	cfg, err := landisc.LoadConfig(repo)
+	if err != nil || !cfg.Enabled {
+		return nil, err
+	}
+	interval, err := cfg.BroadcastInterval()
+	if err != nil {
+		return nil, err
+	}
+
+	s := landisc.New(h, pinning, interval)
+	ctx := helpers.LifecycleCtx(mctx, lc)
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			s.Start(ctx)
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			return s.Close()
+		},
+	})
+	return s, nil
+}
@@ -3,6 +3,8 @@ package libp2p
 import (
 	"fmt"
 
+	"github.com/ipfs/go-ipfs/core/pnetrouter"
+
 	"github.com/libp2p/go-libp2p"
 	host "github.com/libp2p/go-libp2p-core/host"
 	p2pbhost "github.com/libp2p/go-libp2p/p2p/host/basic"
@@ -94,12 +96,14 @@ func listenAddresses(addresses []string) ([]ma.Multiaddr, error) {
 	return listen, nil
 }
 
-func StartListening(addresses []string) func(host host.Host) error {
-	return func(host host.Host) error {
+func StartListening(addresses []string) func(host host.Host, router *pnetrouter.Router) error {
+	return func(host host.Host, router *pnetrouter.Router) error {
 		listenAddrs, err := listenAddresses(addresses)
 		if err != nil {
 			return err
 		}
+		// and on the addresses of the private networks
+		listenAddrs = append(listenAddrs, router.ListenAddrs()...)
 
 		// Actually start listening:
 		if err := host.Network().Listen(listenAddrs...); err != nil {
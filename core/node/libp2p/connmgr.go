@@ -0,0 +1,176 @@
+package libp2p
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	config "github.com/ipfs/go-ipfs-config"
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
+	ifconnmgr "github.com/libp2p/go-libp2p-core/connmgr"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ConnMgr is the connection manager of the host, whose limits can change
+// while it runs. The basic connection manager takes its limits when created,
+// so a change replaces it by a new one, handed the connections, the tags and
+// the protections of the previous one.
+type ConnMgr struct {
+	mu        sync.RWMutex
+	cm        ifconnmgr.ConnManager
+	protected map[peer.ID]map[string]bool
+}
+
+// ConnMgrLimits returns the limits of the basic connection manager set in
+// cfg, whose Type is not "none".
+func ConnMgrLimits(cfg config.ConnMgr) (low, high int, grace time.Duration, err error) {
+	switch cfg.Type {
+	case "":
+		// 'default' value is the basic connection manager
+		return config.DefaultConnMgrLowWater, config.DefaultConnMgrHighWater, config.DefaultConnMgrGracePeriod, nil
+	case "basic":
+		grace, err = time.ParseDuration(cfg.GracePeriod)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("parsing Swarm.ConnMgr.GracePeriod: %s", err)
+		}
+		return cfg.LowWater, cfg.HighWater, grace, nil
+	default:
+		return 0, 0, 0, fmt.Errorf("unrecognized ConnMgr.Type: %q", cfg.Type)
+	}
+}
+
+// NewConnMgr creates a ConnMgr with the limits of the basic connection
+// manager.
+func NewConnMgr(low, high int, grace time.Duration) *ConnMgr {
+	return &ConnMgr{
+		cm:        connmgr.NewConnManager(low, high, grace),
+		protected: make(map[peer.ID]map[string]bool),
+	}
+}
+
+// SetLimits replaces the connection manager by one with the new limits,
+// tracking the connections of net.
+func (c *ConnMgr) SetLimits(net network.Network, low, high int, grace time.Duration) {
+	cm := connmgr.NewConnManager(low, high, grace)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.cm
+	notifee := cm.Notifee()
+	for _, conn := range net.Conns() {
+		notifee.Connected(net, conn)
+	}
+	for _, p := range net.Peers() {
+		if info := old.GetTagInfo(p); info != nil {
+			for tag, v := range info.Tags {
+				cm.TagPeer(p, tag, v)
+			}
+		}
+	}
+	for p, tags := range c.protected {
+		for tag := range tags {
+			cm.Protect(p, tag)
+		}
+	}
+	c.cm = cm
+
+	if closer, ok := old.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+func (c *ConnMgr) current() ifconnmgr.ConnManager {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cm
+}
+
+func (c *ConnMgr) TagPeer(p peer.ID, tag string, v int) {
+	c.current().TagPeer(p, tag, v)
+}
+
+func (c *ConnMgr) UntagPeer(p peer.ID, tag string) {
+	c.current().UntagPeer(p, tag)
+}
+
+func (c *ConnMgr) UpsertTag(p peer.ID, tag string, upsert func(int) int) {
+	c.current().UpsertTag(p, tag, upsert)
+}
+
+func (c *ConnMgr) GetTagInfo(p peer.ID) *ifconnmgr.TagInfo {
+	return c.current().GetTagInfo(p)
+}
+
+func (c *ConnMgr) TrimOpenConns(ctx context.Context) {
+	c.current().TrimOpenConns(ctx)
+}
+
+func (c *ConnMgr) Protect(p peer.ID, tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.protected[p] == nil {
+		c.protected[p] = make(map[string]bool)
+	}
+	c.protected[p][tag] = true
+	c.cm.Protect(p, tag)
+}
+
+func (c *ConnMgr) Unprotect(p peer.ID, tag string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.protected[p], tag)
+	if len(c.protected[p]) == 0 {
+		delete(c.protected, p)
+	}
+	return c.cm.Unprotect(p, tag)
+}
+
+func (c *ConnMgr) Close() error {
+	if closer, ok := c.current().(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Notifee returns the notifee of the connections, handed to the current
+// connection manager.
+func (c *ConnMgr) Notifee() network.Notifiee {
+	return (*connMgrNotifee)(c)
+}
+
+type connMgrNotifee ConnMgr
+
+func (n *connMgrNotifee) notifee() network.Notifiee {
+	c := (*ConnMgr)(n)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cm.Notifee()
+}
+
+func (n *connMgrNotifee) Listen(net network.Network, a ma.Multiaddr) {
+	n.notifee().Listen(net, a)
+}
+
+func (n *connMgrNotifee) ListenClose(net network.Network, a ma.Multiaddr) {
+	n.notifee().ListenClose(net, a)
+}
+
+func (n *connMgrNotifee) Connected(net network.Network, conn network.Conn) {
+	n.notifee().Connected(net, conn)
+}
+
+func (n *connMgrNotifee) Disconnected(net network.Network, conn network.Conn) {
+	n.notifee().Disconnected(net, conn)
+}
+
+func (n *connMgrNotifee) OpenedStream(net network.Network, s network.Stream) {
+	n.notifee().OpenedStream(net, s)
+}
+
+func (n *connMgrNotifee) ClosedStream(net network.Network, s network.Stream) {
+	n.notifee().ClosedStream(net, s)
+}
@@ -2,14 +2,17 @@ package libp2p
 
 import (
 	"context"
+	"sync"
 	"time"
 
+	config "github.com/ipfs/go-ipfs-config"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p/p2p/discovery"
 	"go.uber.org/fx"
 
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/core/reload"
 )
 
 const discoveryConnTimeout = time.Second * 30
@@ -35,19 +38,44 @@ func DiscoveryHandler(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host)
 	}
 }
 
-func SetupDiscovery(mdns bool, mdnsInterval int) func(helpers.MetricsCtx, fx.Lifecycle, host.Host, *discoveryHandler) error {
-	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, handler *discoveryHandler) error {
-		if mdns {
-			if mdnsInterval == 0 {
-				mdnsInterval = 5
-			}
-			service, err := discovery.NewMdnsService(helpers.LifecycleCtx(mctx, lc), host, time.Duration(mdnsInterval)*time.Second, discovery.ServiceTag)
-			if err != nil {
-				log.Error("mdns error: ", err)
-				return nil
-			}
-			service.RegisterNotifee(handler)
+// SetupDiscovery starts the mDNS discovery service if enabled, and restarts
+// it on the reloads of Discovery.MDNS.
+func SetupDiscovery(mdns bool, mdnsInterval int) func(helpers.MetricsCtx, fx.Lifecycle, host.Host, *discoveryHandler, *reload.Reloader) error {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, handler *discoveryHandler, rl *reload.Reloader) error {
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		service, err := startMdns(ctx, host, handler, mdns, mdnsInterval)
+		if err != nil {
+			log.Error("mdns error: ", err)
 		}
+
+		var mu sync.Mutex
+		rl.Register("Discovery.MDNS", func(_, cfg *config.Config) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if service != nil {
+				if err := service.Close(); err != nil {
+					log.Warningf("failed to stop mdns: %s", err)
+				}
+				service = nil
+			}
+			service, err = startMdns(ctx, host, handler, cfg.Discovery.MDNS.Enabled, cfg.Discovery.MDNS.Interval)
+			return err
+		})
 		return nil
 	}
 }
+
+func startMdns(ctx context.Context, host host.Host, handler *discoveryHandler, enabled bool, interval int) (discovery.Service, error) {
+	if !enabled {
+		return nil, nil
+	}
+	if interval == 0 {
+		interval = 5
+	}
+	service, err := discovery.NewMdnsService(ctx, host, time.Duration(interval)*time.Second, discovery.ServiceTag)
+	if err != nil {
+		return nil, err
+	}
+	service.RegisterNotifee(handler)
+	return service, nil
+}
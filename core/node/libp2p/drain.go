@@ -0,0 +1,16 @@
+package libp2p
+
+import (
+	"github.com/ipfs/go-ipfs/core/drain"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// Drainer creates the drainer of the host, with the drain timeout of the
+// config. It returns nil if draining is disabled.
+func Drainer(repo repo.Repo) (*drain.Drainer, error) {
+	timeout, err := drain.LoadTimeout(repo)
+	if err != nil {
+		return nil, err
+	}
+	return drain.New(timeout), nil
+}
@@ -3,6 +3,7 @@ package libp2p
 import (
 	"context"
 
+	"github.com/ipfs/go-datastore"
 	"github.com/libp2p/go-libp2p"
 	host "github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
@@ -12,7 +13,12 @@ import (
 	routedhost "github.com/libp2p/go-libp2p/p2p/host/routed"
 	"go.uber.org/fx"
 
+	"github.com/ipfs/go-ipfs/core/dhtquota"
+	"github.com/ipfs/go-ipfs/core/drain"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/core/nodemetrics"
+	"github.com/ipfs/go-ipfs/core/peerscore"
+	"github.com/ipfs/go-ipfs/core/streammeter"
 	"github.com/ipfs/go-ipfs/repo"
 )
 
@@ -25,6 +31,11 @@ type P2PHostIn struct {
 	RoutingOption RoutingOption
 	ID            peer.ID
 	Peerstore     peerstore.Peerstore
+	Meter         *streammeter.Meter
+	Drainer       *drain.Drainer
+	Metrics       *nodemetrics.Metrics
+	RecordStore   *dhtquota.Store    `optional:"true"`
+	Scores        *peerscore.Tracker `optional:"true"`
 
 	Opts [][]libp2p.Option `group:"libp2p"`
 }
@@ -44,8 +55,14 @@ func Host(mctx helpers.MetricsCtx, lc fx.Lifecycle, params P2PHostIn) (out P2PHo
 
 	ctx := helpers.LifecycleCtx(mctx, lc)
 
+	// the DHT stores its records through the quota, if any
+	var dstore datastore.Batching = params.Repo.Datastore()
+	if params.RecordStore != nil {
+		dstore = params.RecordStore
+	}
+
 	opts = append(opts, libp2p.Routing(func(h host.Host) (routing.PeerRouting, error) {
-		r, err := params.RoutingOption(ctx, h, params.Repo.Datastore(), params.Validator)
+		r, err := params.RoutingOption(ctx, params.Drainer.Host(params.Meter.Host(params.Metrics.Host(params.Scores.Host(h)))), dstore, params.Validator)
 		out.Routing = r
 		return r, err
 	}))
@@ -58,7 +75,7 @@ func Host(mctx helpers.MetricsCtx, lc fx.Lifecycle, params P2PHostIn) (out P2PHo
 	// this code is necessary just for tests: mock network constructions
 	// ignore the libp2p constructor options that actually construct the routing!
 	if out.Routing == nil {
-		r, err := params.RoutingOption(ctx, out.Host, params.Repo.Datastore(), params.Validator)
+		r, err := params.RoutingOption(ctx, params.Drainer.Host(params.Meter.Host(params.Metrics.Host(params.Scores.Host(out.Host)))), dstore, params.Validator)
 		if err != nil {
 			return P2PHostOut{}, err
 		}
@@ -66,6 +83,10 @@ func Host(mctx helpers.MetricsCtx, lc fx.Lifecycle, params P2PHostIn) (out P2PHo
 		out.Host = routedhost.Wrap(out.Host, out.Routing)
 	}
 
+	// count and score the dials, meter and drain the streams of the other services
+	// too, the routing was given a wrapped host above
+	out.Host = params.Drainer.Host(params.Meter.Host(params.Metrics.Host(params.Scores.Host(out.Host))))
+
 	lc.Append(fx.Hook{
 		OnStop: func(ctx context.Context) error {
 			return out.Host.Close()
@@ -7,7 +7,6 @@ import (
 
 	logging "github.com/ipfs/go-log"
 	"github.com/libp2p/go-libp2p"
-	"github.com/libp2p/go-libp2p-connmgr"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/peerstore"
@@ -26,9 +25,9 @@ type Libp2pOpts struct {
 
 var UserAgent = simpleOpt(libp2p.UserAgent(version.UserAgent))
 
-func ConnectionManager(low, high int, grace time.Duration) func() (opts Libp2pOpts, err error) {
-	return func() (opts Libp2pOpts, err error) {
-		cm := connmgr.NewConnManager(low, high, grace)
+func ConnectionManager(low, high int, grace time.Duration) func() (opts Libp2pOpts, cm *ConnMgr, err error) {
+	return func() (opts Libp2pOpts, cm *ConnMgr, err error) {
+		cm = NewConnMgr(low, high, grace)
 		opts.Opts = append(opts.Opts, libp2p.ConnectionManager(cm))
 		return
 	}
@@ -16,7 +16,7 @@ var NatPortMap = simpleOpt(libp2p.NATPortMap())
 func AutoNATService(quic bool) func(repo repo.Repo, mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host) error {
 	return func(repo repo.Repo, mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host) error {
 		// collect private net option in case swarm.key is presented
-		opts, _, err := PNet(repo)
+		opts, _, _, err := PNet(repo)
 		if err != nil {
 			// swarm key exists but was failed to decode
 			return err
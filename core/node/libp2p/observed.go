@@ -0,0 +1,24 @@
+package libp2p
+
+import (
+	"context"
+
+	host "github.com/libp2p/go-libp2p-core/host"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/core/observed"
+)
+
+// ObservedAddrs records the addresses the peers observe for the node.
+func ObservedAddrs(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host) *observed.Observer {
+	ctx := helpers.LifecycleCtx(mctx, lc)
+	o := observed.New(h)
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			o.Start(ctx)
+			return nil
+		},
+	})
+	return o
+}
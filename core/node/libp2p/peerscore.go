@@ -0,0 +1,48 @@
+package libp2p
+
+import (
+	"context"
+
+	host "github.com/libp2p/go-libp2p-core/host"
+	peerstore "github.com/libp2p/go-libp2p-core/peerstore"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/core/peerscore"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// PeerScores creates the tracker of the peer scores, nil unless enabled in the
+// config
+func PeerScores(repo repo.Repo, ps peerstore.Peerstore) (*peerscore.Tracker, error) {
+	cfg, err := peerscore.LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	return peerscore.New(repo.Datastore(), ps, cfg)
+}
+
+// TagPeerScores tags the connected peers with their score, if the scores are
+// enabled
+func TagPeerScores(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host, scores *peerscore.Tracker) {
+	if scores == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(helpers.LifecycleCtx(mctx, lc))
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				scores.Run(ctx, h)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			// wait for the counters to be saved
+			cancel()
+			<-done
+			return nil
+		},
+	})
+}
@@ -3,18 +3,47 @@ package libp2p
 import (
 	"context"
 
+	"github.com/ipfs/go-ipfs/core/addrbook"
+	"github.com/ipfs/go-ipfs/core/pnetrouter"
+	"github.com/ipfs/go-ipfs/repo"
+
 	"github.com/libp2p/go-libp2p-core/peerstore"
 	"github.com/libp2p/go-libp2p-peerstore/pstoremem"
 	"go.uber.org/fx"
 )
 
-func Peerstore(lc fx.Lifecycle) peerstore.Peerstore {
-	pstore := pstoremem.NewPeerstore()
+func Peerstore(lc fx.Lifecycle, repo repo.Repo) (peerstore.Peerstore, error) {
+	pstore := addrbook.Wrap(pstoremem.NewPeerstore())
+
+	// in private networks, only the addresses vouched for by their peer
+	// are accepted, unless configured otherwise
+	private, err := isPrivate(repo)
+	if err != nil {
+		return nil, err
+	}
+	accept, err := addrbook.LoadAcceptUnsigned(repo)
+	if err != nil {
+		return nil, err
+	}
+	if private && !accept {
+		pstore.RequireSigned()
+	}
+
 	lc.Append(fx.Hook{
 		OnStop: func(ctx context.Context) error {
 			return pstore.Close()
 		},
 	})
 
-	return pstore
+	return pstore, nil
+}
+
+// isPrivate returns whether the node is in a private network.
+func isPrivate(r repo.Repo) (bool, error) {
+	swarmkey, err := r.SwarmKey()
+	if err != nil || swarmkey != nil {
+		return swarmkey != nil, err
+	}
+	nets, err := pnetrouter.LoadConfig(r)
+	return len(nets) > 0, err
 }
@@ -0,0 +1,63 @@
+package libp2p
+
+import (
+	"context"
+	"fmt"
+
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/core/pex"
+	"github.com/ipfs/go-ipfs/core/pnetrouter"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+type peerExchangeIn struct {
+	fx.In
+
+	Repo   repo.Repo
+	Key    crypto.PrivKey
+	Host   host.Host
+	FP     PNetFingerprint    `optional:"true"`
+	Router *pnetrouter.Router `optional:"true"`
+}
+
+// PeerExchange exchanges the addresses of the members of the private
+// networks, if enabled in the config.
+func PeerExchange(mctx helpers.MetricsCtx, lc fx.Lifecycle, in peerExchangeIn) (*pex.Service, error) {
+	cfg, err := pex.LoadConfig(in.Repo)
+	if err != nil || !cfg.Enabled {
+		return nil, err
+	}
+	interval, err := cfg.RoundInterval()
+	if err != nil {
+		return nil, err
+	}
+	if in.FP == nil && in.Router == nil {
+		return nil, fmt.Errorf("%s.Enabled requires a private network", pex.ConfigKey)
+	}
+
+	network := func(c inet.Conn) (string, bool) {
+		if n := in.Router.Network(c.LocalMultiaddr(), c.RemoteMultiaddr()); n != nil {
+			return n.Name, true
+		}
+		// the other connections use the swarm key of the repo, if any
+		return pnetrouter.DefaultNetwork, in.FP != nil
+	}
+
+	s := pex.New(in.Host, in.Key, network, interval)
+	ctx := helpers.LifecycleCtx(mctx, lc)
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			s.Start(ctx)
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			return s.Close()
+		},
+	})
+	return s, nil
+}
@@ -8,28 +8,62 @@ import (
 
 	"github.com/libp2p/go-libp2p"
 	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ipnet "github.com/libp2p/go-libp2p-core/pnet"
 	pnet "github.com/libp2p/go-libp2p-pnet"
+	ma "github.com/multiformats/go-multiaddr"
 	"go.uber.org/fx"
 
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/core/pnetinvite"
+	"github.com/ipfs/go-ipfs/core/pnetrouter"
 	"github.com/ipfs/go-ipfs/repo"
 )
 
 type PNetFingerprint []byte
 
-func PNet(repo repo.Repo) (opts Libp2pOpts, fp PNetFingerprint, err error) {
-	swarmkey, err := repo.SwarmKey()
-	if err != nil || swarmkey == nil {
-		return opts, nil, err
-	}
+// ForcePNetConfigKey is the config key forcing the usage of a private
+// network, like the LIBP2P_FORCE_PNET environment variable.
+const ForcePNetConfigKey = "Swarm.ForcePrivateNetwork"
 
-	protec, err := pnet.NewProtector(bytes.NewReader(swarmkey))
+func PNet(r repo.Repo) (opts Libp2pOpts, fp PNetFingerprint, router *pnetrouter.Router, err error) {
+	swarmkey, err := r.SwarmKey()
 	if err != nil {
-		return opts, nil, fmt.Errorf("failed to configure private network: %s", err)
+		return opts, nil, nil, err
+	}
+
+	var force bool
+	if err := repo.LoadConfigKey(r, ForcePNetConfigKey, &force); err != nil {
+		return opts, nil, nil, err
+	}
+	if force {
+		// read by libp2p and the router, as set by LIBP2P_FORCE_PNET
+		ipnet.ForcePrivateNetwork = true
+	}
+
+	var protec ipnet.Protector
+	if swarmkey != nil {
+		protec, err = pnet.NewProtector(bytes.NewReader(swarmkey))
+		if err != nil {
+			return opts, nil, nil, fmt.Errorf("failed to configure private network: %s", err)
+		}
+		fp = protec.Fingerprint()
 	}
-	fp = protec.Fingerprint()
 
-	opts.Opts = append(opts.Opts, libp2p.PrivateNetwork(protec))
-	return opts, fp, nil
+	// several private networks, the repo swarm key being the default one
+	router, err = pnetrouter.Load(r, protec)
+	if err != nil {
+		return opts, nil, nil, err
+	}
+	if force && protec == nil && router == nil {
+		return opts, nil, nil, fmt.Errorf("%s is set, but no private network is configured", ForcePNetConfigKey)
+	}
+	if router != nil {
+		opts.Opts = append(opts.Opts, libp2p.PrivateNetwork(router))
+	} else if protec != nil {
+		opts.Opts = append(opts.Opts, libp2p.PrivateNetwork(protec))
+	}
+	return opts, fp, router, nil
 }
 
 func PNetChecker(repo repo.Repo, ph host.Host, lc fx.Lifecycle) error {
@@ -68,3 +102,38 @@ func PNetChecker(repo repo.Repo, ph host.Host, lc fx.Lifecycle) error {
 	})
 	return nil
 }
+
+// PNetInvite starts the invite host of the private network, if enabled in the
+// config.
+func PNetInvite(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, h host.Host) (*pnetinvite.Server, error) {
+	cfg, err := pnetinvite.LoadConfig(repo)
+	if err != nil || !cfg.Enabled {
+		return nil, err
+	}
+
+	swarmkey, err := repo.SwarmKey()
+	if err != nil {
+		return nil, err
+	}
+	if swarmkey == nil {
+		return nil, fmt.Errorf("%s.Enabled requires a swarm key", pnetinvite.ConfigKey)
+	}
+
+	s, err := pnetinvite.NewServer(helpers.LifecycleCtx(mctx, lc), cfg.ListenAddrs, swarmkey, func() []ma.Multiaddr {
+		addrs, err := peer.AddrInfoToP2pAddrs(host.InfoFromHost(h))
+		if err != nil {
+			log.Errorf("failed to build swarm addresses: %s", err)
+		}
+		return addrs
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lc.Append(fx.Hook{
+		OnStop: func(_ context.Context) error {
+			return s.Close()
+		},
+	})
+	return s, nil
+}
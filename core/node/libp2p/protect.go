@@ -0,0 +1,57 @@
+package libp2p
+
+import (
+	"fmt"
+
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// ProtectedPeersConfigKey is the config key listing the peers whose
+// connections the connection manager must never close.
+const ProtectedPeersConfigKey = "Swarm.ProtectedPeers"
+
+// ProtectTag is the connection manager tag protecting the peers listed in
+// the config.
+const ProtectTag = "ipfs-protected"
+
+// LoadProtectedPeers returns the peers listed under Swarm.ProtectedPeers.
+func LoadProtectedPeers(r repo.Repo) ([]peer.ID, error) {
+	var ids []string
+	if err := repo.LoadConfigKey(r, ProtectedPeersConfigKey, &ids); err != nil {
+		return nil, err
+	}
+
+	peers := make([]peer.ID, 0, len(ids))
+	for _, s := range ids {
+		pid, err := peer.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer ID %q in %s: %s", s, ProtectedPeersConfigKey, err)
+		}
+		peers = append(peers, pid)
+	}
+	return peers, nil
+}
+
+// StoreProtectedPeers replaces the Swarm.ProtectedPeers list.
+func StoreProtectedPeers(r repo.Repo, peers []peer.ID) error {
+	ids := make([]string, 0, len(peers))
+	for _, p := range peers {
+		ids = append(ids, p.Pretty())
+	}
+	return r.SetConfigKey(ProtectedPeersConfigKey, ids)
+}
+
+// ProtectPeers protects the connections to the peers listed in the config.
+func ProtectPeers(r repo.Repo, h host.Host) error {
+	peers, err := LoadProtectedPeers(r)
+	if err != nil {
+		return err
+	}
+	for _, p := range peers {
+		h.ConnManager().Protect(p, ProtectTag)
+	}
+	return nil
+}
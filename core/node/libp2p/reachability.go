@@ -0,0 +1,76 @@
+package libp2p
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/event"
+	host "github.com/libp2p/go-libp2p-core/host"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+)
+
+// Reachability statuses, as reported by AutoNAT.
+const (
+	ReachabilityUnknown = "unknown"
+	ReachabilityPublic  = "public"
+	ReachabilityPrivate = "private"
+)
+
+// Reachability tracks whether the node is reachable from the internet. The
+// status is updated from the events emitted by the AutoNAT client, which only
+// runs when auto relay is enabled; otherwise it stays unknown.
+type Reachability struct {
+	mu     sync.Mutex
+	status string
+	since  time.Time
+}
+
+// Status returns the current reachability status and when it last changed.
+func (r *Reachability) Status() (string, time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status, r.since
+}
+
+func (r *Reachability) set(status string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status != status {
+		r.status = status
+		r.since = time.Now()
+	}
+}
+
+// NewReachability subscribes to the reachability events of the host.
+func NewReachability(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host) (*Reachability, error) {
+	r := &Reachability{status: ReachabilityUnknown, since: time.Now()}
+	ctx := helpers.LifecycleCtx(mctx, lc)
+
+	for evt, status := range map[interface{}]string{
+		new(event.EvtLocalRoutabilityPublic):  ReachabilityPublic,
+		new(event.EvtLocalRoutabilityPrivate): ReachabilityPrivate,
+		new(event.EvtLocalRoutabilityUnknown): ReachabilityUnknown,
+	} {
+		sub, err := h.EventBus().Subscribe(evt)
+		if err != nil {
+			return nil, err
+		}
+		go func(sub event.Subscription, status string) {
+			defer sub.Close()
+			for {
+				select {
+				case _, ok := <-sub.Out():
+					if !ok {
+						return
+					}
+					r.set(status)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(sub, status)
+	}
+	return r, nil
+}
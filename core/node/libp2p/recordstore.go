@@ -0,0 +1,19 @@
+package libp2p
+
+import (
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/dhtquota"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// DHTRecordStore bounds the records stored for the DHT in the datastore of
+// the repo.
+func DHTRecordStore(mctx helpers.MetricsCtx, lc fx.Lifecycle, r repo.Repo) (*dhtquota.Store, error) {
+	cfg, err := dhtquota.LoadConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	return dhtquota.New(helpers.LifecycleCtx(mctx, lc), r.Datastore(), cfg)
+}
@@ -1,10 +1,29 @@
 package libp2p
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/libp2p/go-libp2p"
 	relay "github.com/libp2p/go-libp2p-circuit"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/addrbook"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/repo"
 )
 
+// StaticRelaysConfigKey is the config key listing the relays the node stays
+// connected to, as multiaddrs ending with /p2p/<peer ID>.
+const StaticRelaysConfigKey = "Swarm.StaticRelays"
+
+// RelayTag is the connection manager tag protecting the connections to the
+// static relays.
+const RelayTag = "ipfs-static-relay"
+
 func Relay(disable, enableHop bool) func() (opts Libp2pOpts, err error) {
 	return func() (opts Libp2pOpts, err error) {
 		if disable {
@@ -22,3 +41,74 @@ func Relay(disable, enableHop bool) func() (opts Libp2pOpts, err error) {
 }
 
 var AutoRelay = simpleOpt(libp2p.EnableAutoRelay())
+
+// LoadStaticRelays returns the relays listed under Swarm.StaticRelays.
+func LoadStaticRelays(r repo.Repo) ([]peer.AddrInfo, error) {
+	var addrs []string
+	if err := repo.LoadConfigKey(r, StaticRelaysConfigKey, &addrs); err != nil {
+		return nil, err
+	}
+
+	relays := make([]peer.AddrInfo, 0, len(addrs))
+	for _, s := range addrs {
+		pi, err := ParseRelay(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid relay %q in %s: %s", s, StaticRelaysConfigKey, err)
+		}
+		relays = append(relays, *pi)
+	}
+	return relays, nil
+}
+
+// StoreStaticRelays replaces the Swarm.StaticRelays list.
+func StoreStaticRelays(r repo.Repo, relays []peer.AddrInfo) error {
+	addrs := make([]string, 0, len(relays))
+	for _, pi := range relays {
+		p2paddrs, err := peer.AddrInfoToP2pAddrs(&pi)
+		if err != nil {
+			return err
+		}
+		for _, a := range p2paddrs {
+			addrs = append(addrs, a.String())
+		}
+	}
+	return r.SetConfigKey(StaticRelaysConfigKey, addrs)
+}
+
+// ParseRelay parses a relay multiaddr, which must end with /p2p/<peer ID>.
+func ParseRelay(s string) (*peer.AddrInfo, error) {
+	a, err := ma.NewMultiaddr(s)
+	if err != nil {
+		return nil, err
+	}
+	return peer.AddrInfoFromP2pAddr(a)
+}
+
+// ConnectRelay protects the connections to the given relay and connects to
+// it.
+func ConnectRelay(ctx context.Context, h host.Host, pi peer.AddrInfo) error {
+	h.ConnManager().Protect(pi.ID, RelayTag)
+	if r, ok := h.Peerstore().(*addrbook.Recorder); ok {
+		r.Mark(pi.ID, pi.Addrs, addrbook.SourceManual)
+	}
+	return h.Connect(ctx, pi)
+}
+
+// StaticRelays connects to the relays listed in the config when the node
+// starts.
+func StaticRelays(mctx helpers.MetricsCtx, lc fx.Lifecycle, r repo.Repo, h host.Host) error {
+	relays, err := LoadStaticRelays(r)
+	if err != nil {
+		return err
+	}
+
+	ctx := helpers.LifecycleCtx(mctx, lc)
+	for _, pi := range relays {
+		go func(pi peer.AddrInfo) {
+			if err := ConnectRelay(ctx, h, pi); err != nil {
+				log.Warningf("failed to connect to static relay %s: %s", pi.ID.Pretty(), err)
+			}
+		}(pi)
+	}
+	return nil
+}
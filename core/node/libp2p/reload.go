@@ -0,0 +1,75 @@
+package libp2p
+
+import (
+	"fmt"
+	"net"
+
+	config "github.com/ipfs/go-ipfs-config"
+	host "github.com/libp2p/go-libp2p-core/host"
+	swarm "github.com/libp2p/go-libp2p-swarm"
+	mafilter "github.com/libp2p/go-maddr-filter"
+	mamask "github.com/whyrusleeping/multiaddr-filter"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/reload"
+)
+
+type reloadSwarmIn struct {
+	fx.In
+
+	Reloader *reload.Reloader
+	Host     host.Host
+	ConnMgr  *ConnMgr `optional:"true"`
+}
+
+// ReloadSwarm makes the address filters and the limits of the connection
+// manager reloadable.
+func ReloadSwarm(in reloadSwarmIn) {
+	in.Reloader.Register("Swarm.AddrFilters", func(old, new *config.Config) error {
+		swrm, ok := in.Host.Network().(*swarm.Swarm)
+		if !ok {
+			return reload.ErrRestart
+		}
+		masks := make(map[string]*net.IPNet, len(new.Swarm.AddrFilters))
+		for _, f := range new.Swarm.AddrFilters {
+			mask, err := mamask.NewMask(f)
+			if err != nil {
+				return fmt.Errorf("incorrectly formatted address filter in config: %s", f)
+			}
+			masks[f] = mask
+		}
+
+		applied := make(map[string]bool, len(old.Swarm.AddrFilters))
+		for _, f := range old.Swarm.AddrFilters {
+			applied[f] = true
+			if _, ok := masks[f]; ok {
+				continue
+			}
+			if mask, err := mamask.NewMask(f); err == nil {
+				swrm.Filters.RemoveLiteral(*mask)
+			}
+		}
+		for f, mask := range masks {
+			if !applied[f] {
+				swrm.Filters.AddFilter(*mask, mafilter.ActionDeny)
+			}
+		}
+		return nil
+	})
+
+	in.Reloader.Register("Swarm.ConnMgr", func(old, new *config.Config) error {
+		if new.Swarm.ConnMgr.Type != old.Swarm.ConnMgr.Type {
+			return reload.ErrRestart
+		}
+		if in.ConnMgr == nil {
+			// Type "none"
+			return nil
+		}
+		low, high, grace, err := ConnMgrLimits(new.Swarm.ConnMgr)
+		if err != nil {
+			return err
+		}
+		in.ConnMgr.SetLimits(in.Host.Network(), low, high, grace)
+		return nil
+	})
+}
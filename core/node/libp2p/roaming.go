@@ -0,0 +1,32 @@
+package libp2p
+
+import (
+	"context"
+
+	host "github.com/libp2p/go-libp2p-core/host"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/listenstats"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/core/roaming"
+)
+
+// Roaming records the swarm events, and reconnects to the peers when the
+// local addresses change.
+func Roaming(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host) *roaming.Tracker {
+	ctx := helpers.LifecycleCtx(mctx, lc)
+	t := roaming.New(h)
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			t.Start(ctx)
+			return nil
+		},
+	})
+	return t
+}
+
+// WatchListeners counts the connections accepted on each listen address
+// while the node runs.
+func WatchListeners(mctx helpers.MetricsCtx, lc fx.Lifecycle, stats *listenstats.Stats, h host.Host) {
+	stats.Watch(helpers.LifecycleCtx(mctx, lc), h)
+}
@@ -14,7 +14,9 @@ import (
 	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
 	"go.uber.org/fx"
 
+	"github.com/ipfs/go-ipfs/core/dhtstats"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/core/tracing"
 )
 
 type BaseIpfsRouting routing.Routing
@@ -31,9 +33,10 @@ type p2pRouterOut struct {
 	Router Router `group:"routers"`
 }
 
-func BaseRouting(lc fx.Lifecycle, in BaseIpfsRouting) (out p2pRouterOut, dr *dht.IpfsDHT) {
+func BaseRouting(lc fx.Lifecycle, in BaseIpfsRouting, t *tracing.Tracer) (out p2pRouterOut, dr *dht.IpfsDHT, st *dhtstats.Tracker) {
 	if dht, ok := in.(*dht.IpfsDHT); ok {
 		dr = dht
+		st = dhtstats.New(dr)
 
 		lc.Append(fx.Hook{
 			OnStop: func(ctx context.Context) error {
@@ -45,9 +48,9 @@ func BaseRouting(lc fx.Lifecycle, in BaseIpfsRouting) (out p2pRouterOut, dr *dht
 	return p2pRouterOut{
 		Router: Router{
 			Priority: 1000,
-			Routing:  in,
+			Routing:  t.Routing(st.Routing(in)),
 		},
-	}, dr
+	}, dr, st
 }
 
 type p2pOnlineRoutingIn struct {
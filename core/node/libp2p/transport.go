@@ -2,10 +2,14 @@ package libp2p
 
 import (
 	"github.com/libp2p/go-libp2p"
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
 	metrics "github.com/libp2p/go-libp2p-core/metrics"
+	sec "github.com/libp2p/go-libp2p-core/sec"
 	libp2pquic "github.com/libp2p/go-libp2p-quic-transport"
 	secio "github.com/libp2p/go-libp2p-secio"
 	tls "github.com/libp2p/go-libp2p-tls"
+
+	"github.com/ipfs/go-ipfs/core/listenstats"
 )
 
 var DefaultTransports = simpleOpt(libp2p.DefaultTransports)
@@ -21,11 +25,28 @@ func Security(enabled, preferTLS bool) interface{} {
 			return opts
 		}
 	}
-	return func() (opts Libp2pOpts) {
+	return func(stats *listenstats.Stats) (opts Libp2pOpts) {
+		// the handshakes of the connections accepted are counted by
+		// listen address
+		tlsTpt := func(sk crypto.PrivKey) (sec.SecureTransport, error) {
+			t, err := tls.New(sk)
+			if err != nil {
+				return nil, err
+			}
+			return stats.Security(t), nil
+		}
+		secioTpt := func(sk crypto.PrivKey) (sec.SecureTransport, error) {
+			t, err := secio.New(sk)
+			if err != nil {
+				return nil, err
+			}
+			return stats.Security(t), nil
+		}
+
 		if preferTLS {
-			opts.Opts = append(opts.Opts, libp2p.ChainOptions(libp2p.Security(tls.ID, tls.New), libp2p.Security(secio.ID, secio.New)))
+			opts.Opts = append(opts.Opts, libp2p.ChainOptions(libp2p.Security(tls.ID, tlsTpt), libp2p.Security(secio.ID, secioTpt)))
 		} else {
-			opts.Opts = append(opts.Opts, libp2p.ChainOptions(libp2p.Security(secio.ID, secio.New), libp2p.Security(tls.ID, tls.New)))
+			opts.Opts = append(opts.Opts, libp2p.ChainOptions(libp2p.Security(secio.ID, secioTpt), libp2p.Security(tls.ID, tlsTpt)))
 		}
 		return opts
 	}
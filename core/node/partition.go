@@ -0,0 +1,63 @@
+package node
+
+import (
+	"context"
+
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/core/partition"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// Partition detects the loss of the bootstrap peers and of the peering set,
+// if enabled in the config
+func Partition(lc fx.Lifecycle, repo repo.Repo, h host.Host) (*partition.Detector, error) {
+	cfg, err := partition.LoadConfig(repo)
+	if err != nil || !cfg.Enabled {
+		return nil, err
+	}
+	extra, err := cfg.ParsePeers()
+	if err != nil {
+		return nil, err
+	}
+
+	// the reference peers are read on each check, to follow
+	// 'ipfs bootstrap' and 'ipfs swarm protect'
+	references := func() ([]peer.AddrInfo, error) {
+		rcfg, err := repo.Config()
+		if err != nil {
+			return nil, err
+		}
+		bootstrap, err := rcfg.BootstrapPeers()
+		if err != nil {
+			return nil, err
+		}
+		protected, err := libp2p.LoadProtectedPeers(repo)
+		if err != nil {
+			return nil, err
+		}
+		peers := append(append([]peer.AddrInfo(nil), extra...), bootstrap...)
+		for _, p := range protected {
+			peers = append(peers, peer.AddrInfo{ID: p})
+		}
+		return peers, nil
+	}
+
+	d, err := partition.New(h, cfg, references)
+	if err != nil {
+		return nil, err
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			d.Start()
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			return d.Close()
+		},
+	})
+	return d, nil
+}
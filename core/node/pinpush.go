@@ -0,0 +1,51 @@
+package node
+
+import (
+	"context"
+	"fmt"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/pinpush"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// PinPush accepts the pins pushed by the peers of Pin.Push.AllowFrom, on
+// private networks
+func PinPush(lc fx.Lifecycle, repo repo.Repo, h host.Host, bs blockstore.Blockstore, dag ipld.DAGService, pinning pin.Pinner, gcl blockstore.GCLocker) (*pinpush.Server, error) {
+	cfg, err := pinpush.LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.AllowFrom) == 0 {
+		return nil, nil
+	}
+	swarmKey, err := repo.SwarmKey()
+	if err != nil {
+		return nil, err
+	}
+	if swarmKey == nil {
+		return nil, fmt.Errorf("%s.AllowFrom is only allowed on private networks", pinpush.ConfigKey)
+	}
+
+	allowed := make([]peer.ID, 0, len(cfg.AllowFrom))
+	for _, s := range cfg.AllowFrom {
+		p, err := peer.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s.AllowFrom: invalid peer ID %q: %s", pinpush.ConfigKey, s, err)
+		}
+		allowed = append(allowed, p)
+	}
+	s := pinpush.NewServer(h, allowed, bs, dag, pinning, gcl)
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return s.Close()
+		},
+	})
+	return s, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	"github.com/ipfs/go-ipfs-pinner"
 	"github.com/ipfs/go-ipfs-provider"
 	q "github.com/ipfs/go-ipfs-provider/queue"
@@ -14,6 +15,7 @@ import (
 	"go.uber.org/fx"
 
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/core/provdiff"
 	"github.com/ipfs/go-ipfs/repo"
 )
 
@@ -102,7 +104,7 @@ func SimpleProviders(reprovideStrategy string, reprovideInterval string) fx.Opti
 	case "all":
 		fallthrough
 	case "":
-		keyProvider = fx.Provide(simple.NewBlockstoreProvider)
+		keyProvider = fx.Provide(blockstoreProviderStrategy)
 	case "roots":
 		keyProvider = fx.Provide(pinnedProviderStrategy(true))
 	case "pinned":
@@ -119,6 +121,10 @@ func SimpleProviders(reprovideStrategy string, reprovideInterval string) fx.Opti
 	)
 }
 
+func blockstoreProviderStrategy(bs blockstore.Blockstore, diff *provdiff.Tracker) simple.KeyChanFunc {
+	return diff.KeyProvider(simple.NewBlockstoreProvider(bs), bs)
+}
+
 func pinnedProviderStrategy(onlyRoots bool) interface{} {
 	return func(pinner pin.Pinner, dag ipld.DAGService) simple.KeyChanFunc {
 		return simple.NewPinnedProvider(onlyRoots, pinner, dag)
@@ -0,0 +1,36 @@
+package node
+
+import (
+	config "github.com/ipfs/go-ipfs-config"
+
+	"github.com/ipfs/go-ipfs/core/loglevel"
+	"github.com/ipfs/go-ipfs/core/reload"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// LogLevels sets the log levels of Logging.Levels, and sets them again on
+// the reloads of the config
+func LogLevels(repo repo.Repo, rl *reload.Reloader) error {
+	apply := func() error {
+		cfg, err := loglevel.LoadConfig(repo)
+		if err != nil {
+			return err
+		}
+		return cfg.Apply()
+	}
+	if err := apply(); err != nil {
+		return err
+	}
+	rl.Register(loglevel.ConfigKey, func(_, _ *config.Config) error {
+		return apply()
+	})
+	return nil
+}
+
+// ReloadBootstrap registers the Bootstrap list as reloadable: the bootstrap
+// rounds read it from the config.
+func ReloadBootstrap(rl *reload.Reloader) {
+	rl.Register("Bootstrap", func(_, _ *config.Config) error {
+		return nil
+	})
+}
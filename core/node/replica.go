@@ -0,0 +1,67 @@
+package node
+
+import (
+	"context"
+	"fmt"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	mfs "github.com/ipfs/go-mfs"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/core/replica"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// Replica starts the replication service, if the node has a primary or
+// replicas in the config
+func Replica(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, h host.Host, bs blockstore.Blockstore, dag ipld.DAGService, pinning pin.Pinner, gcl blockstore.GCLocker, root *mfs.Root) (*replica.Service, error) {
+	cfg, err := replica.LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	primary, err := cfg.PrimaryInfo()
+	if err != nil {
+		return nil, err
+	}
+	if primary == nil && len(cfg.Replicas) == 0 {
+		return nil, nil
+	}
+
+	svc := &replica.Service{}
+	if len(cfg.Replicas) > 0 {
+		allowed := make([]peer.ID, 0, len(cfg.Replicas))
+		for _, s := range cfg.Replicas {
+			p, err := peer.Decode(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s.Replicas: invalid peer ID %q: %s", replica.ConfigKey, s, err)
+			}
+			allowed = append(allowed, p)
+		}
+		svc.Server = replica.NewServer(h, allowed, replica.NodeState(pinning, root))
+	}
+	if primary != nil {
+		interval, err := cfg.SyncInterval()
+		if err != nil {
+			return nil, err
+		}
+		svc.Follower = replica.NewFollower(helpers.LifecycleCtx(mctx, lc), h, *primary, interval, repo.Datastore(), bs, dag, pinning, gcl)
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if svc.Follower != nil {
+				svc.Follower.Start()
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return svc.Close()
+		},
+	})
+	return svc, nil
+}
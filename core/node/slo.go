@@ -0,0 +1,40 @@
+package node
+
+import (
+	"context"
+
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/core/slo"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// SLO monitors the objectives of latency and availability of the peers set in
+// the config, if any
+func SLO(lc fx.Lifecycle, repo repo.Repo, h host.Host) (*slo.Monitor, error) {
+	cfg, err := slo.LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	// the protected peers are read on each round, to follow 'ipfs swarm protect'
+	protected := func() ([]peer.ID, error) {
+		return libp2p.LoadProtectedPeers(repo)
+	}
+	m, err := slo.New(h, repo.Datastore(), cfg, protected)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			m.Start()
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			return m.Close()
+		},
+	})
+	return m, nil
+}
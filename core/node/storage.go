@@ -1,7 +1,10 @@
 package node
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -12,8 +15,17 @@ import (
 	"go.uber.org/fx"
 
 	"github.com/ipfs/go-filestore"
+	"github.com/ipfs/go-ipfs/core/blockcount"
+	"github.com/ipfs/go-ipfs/core/chaos"
+	"github.com/ipfs/go-ipfs/core/dsbreaker"
+	"github.com/ipfs/go-ipfs/core/hashstats"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/core/nodemetrics"
+	"github.com/ipfs/go-ipfs/core/provdiff"
+	"github.com/ipfs/go-ipfs/core/quota"
+	"github.com/ipfs/go-ipfs/gc"
 	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/packstore"
 	"github.com/ipfs/go-ipfs/thirdparty/cidv0v1"
 	"github.com/ipfs/go-ipfs/thirdparty/verifbs"
 )
@@ -32,6 +44,23 @@ func RepoConfig(repo repo.Repo) (*config.Config, error) {
 	return repo.Config()
 }
 
+// HashStats provides the verification counters of the blocks read, if
+// Datastore.HashOnRead is set.
+func HashStats(hashOnRead bool) func(mctx helpers.MetricsCtx) *hashstats.Stats {
+	return func(mctx helpers.MetricsCtx) *hashstats.Stats {
+		if !hashOnRead {
+			return nil
+		}
+		return hashstats.New(mctx)
+	}
+}
+
+// Metrics provides the metrics of the swarm dials, of the blockstore and of
+// the garbage collections
+func Metrics(mctx helpers.MetricsCtx) *nodemetrics.Metrics {
+	return nodemetrics.New(mctx)
+}
+
 // Datastore provides the datastore
 func Datastore(repo repo.Repo) datastore.Datastore {
 	return repo.Datastore()
@@ -40,17 +69,36 @@ func Datastore(repo repo.Repo) datastore.Datastore {
 // BaseBlocks is the lower level blockstore without GC or Filestore layers
 type BaseBlocks blockstore.Blockstore
 
+// Packs opens the packs of small blocks of the repo, if it is stored on disk
+func Packs(lc fx.Lifecycle, repo repo.Repo) (*packstore.Packs, error) {
+	r, ok := repo.(interface{ Path() string })
+	if !ok {
+		return nil, nil
+	}
+	p, err := packstore.Open(repo.Datastore(), filepath.Join(r.Path(), packstore.Dir))
+	if err != nil {
+		return nil, err
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return p.Close()
+		},
+	})
+	return p, nil
+}
+
 // BaseBlockstoreCtor creates cached blockstore backed by the provided datastore
-func BaseBlockstoreCtor(cacheOpts blockstore.CacheOpts, nilRepo bool, hashOnRead bool) func(mctx helpers.MetricsCtx, repo repo.Repo, lc fx.Lifecycle) (bs BaseBlocks, err error) {
-	return func(mctx helpers.MetricsCtx, repo repo.Repo, lc fx.Lifecycle) (bs BaseBlocks, err error) {
+func BaseBlockstoreCtor(cacheOpts blockstore.CacheOpts, nilRepo bool) func(mctx helpers.MetricsCtx, repo repo.Repo, lc fx.Lifecycle, inj *chaos.Injector, brk *dsbreaker.Breaker, hs *hashstats.Stats, packs *packstore.Packs, m *nodemetrics.Metrics) (bs BaseBlocks, err error) {
+	return func(mctx helpers.MetricsCtx, repo repo.Repo, lc fx.Lifecycle, inj *chaos.Injector, brk *dsbreaker.Breaker, hs *hashstats.Stats, packs *packstore.Packs, m *nodemetrics.Metrics) (bs BaseBlocks, err error) {
 		rds := &retrystore.Datastore{
-			Batching:    repo.Datastore(),
+			Batching:    brk.Datastore(repo.Datastore()),
 			Delay:       time.Millisecond * 200,
 			Retries:     6,
 			TempErrFunc: isTooManyFDError,
 		}
 		// hash security
 		bs = blockstore.NewBlockstore(rds)
+		bs = packs.Wrap(bs)
 		bs = &verifbs.VerifBS{Blockstore: bs}
 
 		if !nilRepo {
@@ -62,32 +110,98 @@ func BaseBlockstoreCtor(cacheOpts blockstore.CacheOpts, nilRepo bool, hashOnRead
 
 		bs = blockstore.NewIdStore(bs)
 		bs = cidv0v1.NewBlockstore(bs)
+		bs = inj.Blockstore(bs)
 
-		if hashOnRead { // TODO: review: this is how it was done originally, is there a reason we can't just pass this directly?
-			bs.HashOnRead(true)
-		}
+		// hs is only set with Datastore.HashOnRead, it verifies the blocks
+		// read and counts the verifications.
+		bs = hs.Blockstore(bs)
+		bs = m.Blockstore(bs)
 
 		return
 	}
 }
 
+// Quota enforces Datastore.StorageMax on the blockstore, if enabled in the
+// config.
+func Quota(repo repo.Repo) (*quota.Enforcer, error) {
+	return quota.FromRepo(repo)
+}
+
+// BlockCounter keeps the number of blocks of the repo, saved in its datastore
+// when the node stops.
+func BlockCounter(lc fx.Lifecycle, repo repo.Repo) (*blockcount.Counter, error) {
+	c, err := blockcount.Open(repo.Datastore())
+	if err != nil {
+		return nil, err
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return c.Close()
+		},
+	})
+	return c, nil
+}
+
+// ProvideDiff records the blocks written since the last reprovide, if
+// enabled in the config.
+func ProvideDiff(lc fx.Lifecycle, repo repo.Repo) (*provdiff.Tracker, error) {
+	cfg, err := provdiff.LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	rcfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	switch rcfg.Reprovider.Strategy {
+	case "", "all":
+	default:
+		return nil, fmt.Errorf("%s only supports the reprovider strategy 'all', not '%s'", provdiff.ConfigKey, rcfg.Reprovider.Strategy)
+	}
+
+	fullInterval := provdiff.DefaultFullInterval
+	if cfg.FullInterval != "" {
+		fullInterval, err = time.ParseDuration(cfg.FullInterval)
+		if err != nil {
+			return nil, fmt.Errorf("%s.FullInterval: %s", provdiff.ConfigKey, err)
+		}
+	}
+
+	t, err := provdiff.Open(repo.Datastore(), fullInterval)
+	if err != nil {
+		return nil, err
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return t.Close()
+		},
+	})
+	return t, nil
+}
+
 // GcBlockstoreCtor wraps the base blockstore with GC and Filestore layers
-func GcBlockstoreCtor(bb BaseBlocks) (gclocker blockstore.GCLocker, gcbs blockstore.GCBlockstore, bs blockstore.Blockstore) {
+func GcBlockstoreCtor(bb BaseBlocks, q *quota.Enforcer, counter *blockcount.Counter, diff *provdiff.Tracker) (gclocker blockstore.GCLocker, gcbs blockstore.GCBlockstore, bs blockstore.Blockstore, barrier *gc.Barrier) {
 	gclocker = blockstore.NewGCLocker()
-	gcbs = blockstore.NewGCBlockstore(bb, gclocker)
+	barrier = gc.NewBarrier(diff.Wrap(counter.Wrap(q.Wrap(blockstore.NewGCBlockstore(bb, gclocker)))))
+	gcbs = barrier
 
 	bs = gcbs
 	return
 }
 
 // GcBlockstoreCtor wraps GcBlockstore and adds Filestore support
-func FilestoreBlockstoreCtor(repo repo.Repo, bb BaseBlocks) (gclocker blockstore.GCLocker, gcbs blockstore.GCBlockstore, bs blockstore.Blockstore, fstore *filestore.Filestore) {
+func FilestoreBlockstoreCtor(repo repo.Repo, bb BaseBlocks, q *quota.Enforcer, counter *blockcount.Counter, diff *provdiff.Tracker) (gclocker blockstore.GCLocker, gcbs blockstore.GCBlockstore, bs blockstore.Blockstore, fstore *filestore.Filestore, barrier *gc.Barrier) {
 	gclocker = blockstore.NewGCLocker()
 
 	// hash security
 	fstore = filestore.NewFilestore(bb, repo.FileManager())
 	gcbs = blockstore.NewGCBlockstore(fstore, gclocker)
-	gcbs = &verifbs.VerifBSGC{GCBlockstore: gcbs}
+	barrier = gc.NewBarrier(diff.Wrap(counter.Wrap(q.Wrap(&verifbs.VerifBSGC{GCBlockstore: gcbs}))))
+	gcbs = barrier
 
 	bs = gcbs
 	return
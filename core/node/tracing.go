@@ -0,0 +1,37 @@
+package node
+
+import (
+	"context"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/core/tracing"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// Tracing creates the tracer exporting the spans of the requests, if
+// configured, and makes it the global tracer while the node runs
+func Tracing(lc fx.Lifecycle, repo repo.Repo) (*tracing.Tracer, error) {
+	cfg, err := tracing.LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	t, err := tracing.New(cfg)
+	if err != nil || t == nil {
+		return nil, err
+	}
+
+	prev := opentracing.GlobalTracer()
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			opentracing.SetGlobalTracer(t)
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			opentracing.SetGlobalTracer(prev)
+			return t.Close()
+		},
+	})
+	return t, nil
+}
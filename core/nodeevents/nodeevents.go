@@ -0,0 +1,263 @@
+// Package nodeevents publishes the events of the node to the monitoring
+// scripts: the connections and disconnections of the peers, the changes of
+// reachability, the identifications of the peers, the pins added and removed
+// and the garbage collections.
+//
+// The events of the swarm come from the event bus of the host and from its
+// notifications, the others from the pinner and the garbage collections
+// wrapped by the Bus. The last events are kept, for a subscriber to catch up
+// with what happened before it subscribed.
+package nodeevents
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	event "github.com/libp2p/go-libp2p-core/event"
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("nodeevents")
+
+// maxEvents is the number of events kept.
+const maxEvents = 256
+
+// subscriberBuffer is the number of events queued for a subscriber, the
+// events past it are dropped.
+const subscriberBuffer = 128
+
+// Type is the type of an event.
+type Type string
+
+const (
+	PeerConnected    Type = "peer-connected"
+	PeerDisconnected Type = "peer-disconnected"
+	// Reachability is a change of the reachability of the node, as found
+	// by AutoNAT.
+	Reachability Type = "reachability"
+	// Identified is a peer identified, IdentifyFailed a peer which
+	// couldn't be.
+	Identified     Type = "identify-completed"
+	IdentifyFailed Type = "identify-failed"
+	PinAdded       Type = "pin-added"
+	PinRemoved     Type = "pin-removed"
+	// GC is a garbage collection, published when it ends.
+	GC Type = "gc"
+)
+
+// Types are the types of the events, in the order of the documentation.
+var Types = []Type{PeerConnected, PeerDisconnected, Reachability, Identified, IdentifyFailed, PinAdded, PinRemoved, GC}
+
+// Event is an event of the node.
+type Event struct {
+	Time time.Time
+	Type Type
+
+	// Peer and Addr are the peer and its address, for the events of the
+	// swarm. Direction is "inbound" or "outbound".
+	Peer      string `json:",omitempty"`
+	Addr      string `json:",omitempty"`
+	Direction string `json:",omitempty"`
+
+	// Reachability is "public", "private" or "unknown".
+	Reachability string `json:",omitempty"`
+
+	// Cid and Mode are the root and the mode of a pin.
+	Cid  string `json:",omitempty"`
+	Mode string `json:",omitempty"`
+
+	// Removed and Duration are the number of blocks removed by a garbage
+	// collection, and how long it took.
+	Removed  int           `json:",omitempty"`
+	Duration time.Duration `json:",omitempty"`
+
+	Error string `json:",omitempty"`
+}
+
+// Bus publishes the events to its subscribers.
+type Bus struct {
+	mu     sync.Mutex
+	events []Event
+	subs   map[chan Event]struct{}
+}
+
+// New creates a Bus.
+func New() *Bus {
+	return &Bus{subs: make(map[chan Event]struct{})}
+}
+
+// Publish sends ev to the subscribers, timestamped now if it has no time. It
+// is safe to call on a nil Bus.
+func (b *Bus) Publish(ev Event) {
+	if b == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.events) == maxEvents {
+		copy(b.events, b.events[1:])
+		b.events = b.events[:maxEvents-1]
+	}
+	b.events = append(b.events, ev)
+
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Events returns the last events, the oldest first.
+func (b *Bus) Events() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Event(nil), b.events...)
+}
+
+// Subscribe returns a channel receiving the new events, until cancel is
+// called. Events are dropped if the channel isn't drained.
+func (b *Bus) Subscribe() (events <-chan Event, cancel func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Watch publishes the events of the swarm of h until ctx is done.
+func (b *Bus) Watch(ctx context.Context, h host.Host) error {
+	for evt, status := range map[interface{}]string{
+		new(event.EvtLocalRoutabilityPublic):  "public",
+		new(event.EvtLocalRoutabilityPrivate): "private",
+		new(event.EvtLocalRoutabilityUnknown): "unknown",
+	} {
+		sub, err := h.EventBus().Subscribe(evt)
+		if err != nil {
+			return err
+		}
+		status := status
+		go b.watch(ctx, sub, func(interface{}) {
+			b.Publish(Event{Type: Reachability, Reachability: status})
+		})
+	}
+
+	sub, err := h.EventBus().Subscribe([]interface{}{
+		new(event.EvtPeerIdentificationCompleted),
+		new(event.EvtPeerIdentificationFailed),
+	})
+	if err != nil {
+		return err
+	}
+	go b.watch(ctx, sub, func(evt interface{}) {
+		switch evt := evt.(type) {
+		case event.EvtPeerIdentificationCompleted:
+			b.Publish(Event{Type: Identified, Peer: evt.Peer.Pretty()})
+		case event.EvtPeerIdentificationFailed:
+			ev := Event{Type: IdentifyFailed, Peer: evt.Peer.Pretty()}
+			if evt.Reason != nil {
+				ev.Error = evt.Reason.Error()
+			}
+			b.Publish(ev)
+		default:
+			log.Debugf("unexpected event %T", evt)
+		}
+	})
+
+	n := &notifee{b: b}
+	h.Network().Notify(n)
+	go func() {
+		<-ctx.Done()
+		h.Network().StopNotify(n)
+	}()
+	return nil
+}
+
+// watch calls publish with the events of sub until ctx is done.
+func (b *Bus) watch(ctx context.Context, sub event.Subscription, publish func(interface{})) {
+	defer sub.Close()
+	for {
+		select {
+		case evt, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			publish(evt)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// notifee publishes the connections and disconnections.
+type notifee struct {
+	b *Bus
+}
+
+func (n *notifee) Connected(_ inet.Network, c inet.Conn) {
+	n.b.Publish(connEvent(PeerConnected, c))
+}
+
+func (n *notifee) Disconnected(_ inet.Network, c inet.Conn) {
+	n.b.Publish(connEvent(PeerDisconnected, c))
+}
+
+func (n *notifee) Listen(inet.Network, ma.Multiaddr)      {}
+func (n *notifee) ListenClose(inet.Network, ma.Multiaddr) {}
+func (n *notifee) OpenedStream(inet.Network, inet.Stream) {}
+func (n *notifee) ClosedStream(inet.Network, inet.Stream) {}
+
+func connEvent(t Type, c inet.Conn) Event {
+	ev := Event{Type: t, Peer: c.RemotePeer().Pretty(), Addr: c.RemoteMultiaddr().String()}
+	switch c.Stat().Direction {
+	case inet.DirInbound:
+		ev.Direction = "inbound"
+	case inet.DirOutbound:
+		ev.Direction = "outbound"
+	}
+	return ev
+}
+
+// Filter returns a function matching the events of the types in types,
+// separated by commas, or every event if types is empty.
+func Filter(types string) (func(Event) bool, error) {
+	if types == "" {
+		return func(Event) bool { return true }, nil
+	}
+	want := make(map[Type]bool)
+	for _, s := range strings.Split(types, ",") {
+		t := Type(strings.TrimSpace(s))
+		if !known(t) {
+			return nil, fmt.Errorf("unknown event type %q", t)
+		}
+		want[t] = true
+	}
+	return func(ev Event) bool { return want[ev.Type] }, nil
+}
+
+func known(t Type) bool {
+	for _, k := range Types {
+		if k == t {
+			return true
+		}
+	}
+	return false
+}
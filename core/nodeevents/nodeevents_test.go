@@ -0,0 +1,108 @@
+package nodeevents
+
+import (
+	"errors"
+	"testing"
+
+	gc "github.com/ipfs/go-ipfs/gc"
+
+	blocks "github.com/ipfs/go-block-format"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	mdutils "github.com/ipfs/go-merkledag/test"
+)
+
+func TestPublish(t *testing.T) {
+	b := New()
+	events, cancel := b.Subscribe()
+
+	for i := 0; i < maxEvents+1; i++ {
+		b.Publish(Event{Type: PeerConnected})
+	}
+	if got := b.Events(); len(got) != maxEvents || got[0].Time.IsZero() {
+		t.Fatalf("expected the last %d events timestamped, got %d", maxEvents, len(got))
+	}
+	if len(events) != subscriberBuffer {
+		t.Fatalf("expected the events past %d dropped, got %d", subscriberBuffer, len(events))
+	}
+
+	cancel()
+	cancel()
+	b.Publish(Event{Type: GC})
+	if len(events) != subscriberBuffer {
+		t.Fatal("expected no events after cancel")
+	}
+}
+
+func TestPinner(t *testing.T) {
+	b := New()
+	events, cancel := b.Subscribe()
+	defer cancel()
+
+	p := b.Pinner(pin.NewPinner(dssync.MutexWrap(ds.NewMapDatastore()), mdutils.Mock(), mdutils.Mock()))
+	c := blocks.NewBlock([]byte("pinned")).Cid()
+	p.PinWithMode(c, pin.Recursive)
+	p.RemovePinWithMode(c, pin.Recursive)
+
+	for _, want := range []Type{PinAdded, PinRemoved} {
+		ev := <-events
+		if ev.Type != want || ev.Cid != c.String() || ev.Mode != "recursive" {
+			t.Fatalf("expected a %s event of %s, got %+v", want, c, ev)
+		}
+	}
+}
+
+func TestGC(t *testing.T) {
+	b := New()
+	events, cancel := b.Subscribe()
+	defer cancel()
+
+	out := make(chan gc.Result, 3)
+	out <- gc.Result{KeyRemoved: blocks.NewBlock([]byte("a")).Cid()}
+	out <- gc.Result{Error: errors.New("failed")}
+	out <- gc.Result{KeyRemoved: blocks.NewBlock([]byte("b")).Cid()}
+	close(out)
+
+	results := 0
+	for range b.GC(out) {
+		results++
+	}
+	if results != 3 {
+		t.Fatalf("expected every result passed on, got %d", results)
+	}
+	ev := <-events
+	if ev.Type != GC || ev.Removed != 2 || ev.Error != "failed" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+}
+
+func TestNilBus(t *testing.T) {
+	var b *Bus
+	b.Publish(Event{Type: GC})
+
+	out := make(chan gc.Result)
+	if b.GC(out) != (<-chan gc.Result)(out) {
+		t.Fatal("expected a nil Bus not to wrap the output")
+	}
+	p := pin.NewPinner(dssync.MutexWrap(ds.NewMapDatastore()), mdutils.Mock(), mdutils.Mock())
+	if b.Pinner(p) != p {
+		t.Fatal("expected a nil Bus not to wrap the pinner")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	match, err := Filter("gc, pin-added")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match(Event{Type: GC}) || !match(Event{Type: PinAdded}) || match(Event{Type: PinRemoved}) {
+		t.Fatal("expected only the gc and pin-added events matched")
+	}
+	if match, _ := Filter(""); !match(Event{Type: Reachability}) {
+		t.Fatal("expected every event matched without types")
+	}
+	if _, err := Filter("gc,reboot"); err == nil {
+		t.Fatal("expected an error for an unknown type")
+	}
+}
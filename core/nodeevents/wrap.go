@@ -0,0 +1,114 @@
+package nodeevents
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-ipfs/gc"
+
+	cid "github.com/ipfs/go-cid"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Pinner wraps p to publish the pins added and removed. It is safe to call
+// on a nil Bus, in which case p is returned as is.
+func (b *Bus) Pinner(p pin.Pinner) pin.Pinner {
+	if b == nil {
+		return p
+	}
+	return &pinner{Pinner: p, b: b}
+}
+
+type pinner struct {
+	pin.Pinner
+	b *Bus
+}
+
+func (p *pinner) Pin(ctx context.Context, node ipld.Node, recursive bool) error {
+	if err := p.Pinner.Pin(ctx, node, recursive); err != nil {
+		return err
+	}
+	p.publish(PinAdded, node.Cid(), recursiveMode(recursive))
+	return nil
+}
+
+func (p *pinner) Unpin(ctx context.Context, c cid.Cid, recursive bool) error {
+	if err := p.Pinner.Unpin(ctx, c, recursive); err != nil {
+		return err
+	}
+	p.publish(PinRemoved, c, recursiveMode(recursive))
+	return nil
+}
+
+func (p *pinner) PinWithMode(c cid.Cid, mode pin.Mode) {
+	p.Pinner.PinWithMode(c, mode)
+	p.publish(PinAdded, c, mode)
+}
+
+func (p *pinner) RemovePinWithMode(c cid.Cid, mode pin.Mode) {
+	p.Pinner.RemovePinWithMode(c, mode)
+	p.publish(PinRemoved, c, mode)
+}
+
+// Update publishes the new pin, and the removal of the old one if unpin is
+// set.
+func (p *pinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error {
+	if err := p.Pinner.Update(ctx, from, to, unpin); err != nil {
+		return err
+	}
+	p.publish(PinAdded, to, pin.Recursive)
+	if unpin {
+		p.publish(PinRemoved, from, pin.Recursive)
+	}
+	return nil
+}
+
+// DepthPins returns the depth-limited pins of the wrapped pinner, if any.
+func (p *pinner) DepthPins(ctx context.Context) (map[cid.Cid]int, error) {
+	if dp, ok := p.Pinner.(gc.DepthPinner); ok {
+		return dp.DepthPins(ctx)
+	}
+	return nil, nil
+}
+
+func (p *pinner) publish(t Type, c cid.Cid, mode pin.Mode) {
+	m, _ := pin.ModeToString(mode)
+	p.b.Publish(Event{Type: t, Cid: c.String(), Mode: m})
+}
+
+func recursiveMode(recursive bool) pin.Mode {
+	if recursive {
+		return pin.Recursive
+	}
+	return pin.Direct
+}
+
+// GC wraps the results of a garbage collection to publish it when it ends,
+// with the number of blocks removed and the first error, if any. It is safe
+// to call on a nil Bus, in which case out is returned as is.
+func (b *Bus) GC(out <-chan gc.Result) <-chan gc.Result {
+	if b == nil {
+		return out
+	}
+	start := time.Now()
+
+	tracked := make(chan gc.Result, cap(out))
+	go func() {
+		defer close(tracked)
+		ev := Event{Type: GC}
+		for res := range out {
+			if res.Error != nil {
+				if ev.Error == "" {
+					ev.Error = res.Error.Error()
+				}
+			} else {
+				ev.Removed++
+			}
+			tracked <- res
+		}
+		ev.Duration = time.Since(start)
+		b.Publish(ev)
+	}()
+	return tracked
+}
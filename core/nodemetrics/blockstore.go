@@ -0,0 +1,67 @@
+package nodemetrics
+
+import (
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	metrics "github.com/ipfs/go-metrics-interface"
+)
+
+// Blockstore wraps bs to time its operations. It is safe to call on a nil
+// Metrics, in which case bs is returned as is.
+func (m *Metrics) Blockstore(bs blockstore.Blockstore) blockstore.Blockstore {
+	if m == nil {
+		return bs
+	}
+	return &timedBlockstore{
+		Blockstore: bs,
+		get:        m.blockstore["get"],
+		getSize:    m.blockstore["get_size"],
+		has:        m.blockstore["has"],
+		put:        m.blockstore["put"],
+		putMany:    m.blockstore["put_many"],
+		del:        m.blockstore["delete"],
+	}
+}
+
+type timedBlockstore struct {
+	blockstore.Blockstore
+
+	get, getSize, has, put, putMany, del metrics.Histogram
+}
+
+func since(h metrics.Histogram, start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (bs *timedBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	defer since(bs.get, time.Now())
+	return bs.Blockstore.Get(c)
+}
+
+func (bs *timedBlockstore) GetSize(c cid.Cid) (int, error) {
+	defer since(bs.getSize, time.Now())
+	return bs.Blockstore.GetSize(c)
+}
+
+func (bs *timedBlockstore) Has(c cid.Cid) (bool, error) {
+	defer since(bs.has, time.Now())
+	return bs.Blockstore.Has(c)
+}
+
+func (bs *timedBlockstore) Put(b blocks.Block) error {
+	defer since(bs.put, time.Now())
+	return bs.Blockstore.Put(b)
+}
+
+func (bs *timedBlockstore) PutMany(bl []blocks.Block) error {
+	defer since(bs.putMany, time.Now())
+	return bs.Blockstore.PutMany(bl)
+}
+
+func (bs *timedBlockstore) DeleteBlock(c cid.Cid) error {
+	defer since(bs.del, time.Now())
+	return bs.Blockstore.DeleteBlock(c)
+}
@@ -0,0 +1,37 @@
+package nodemetrics
+
+import (
+	"time"
+
+	gc "github.com/ipfs/go-ipfs/gc"
+)
+
+// GC passes on the output of a garbage collection, counting the blocks
+// removed and timing the collection until its output is closed. It is safe
+// to call on a nil Metrics, in which case out is returned as is.
+func (m *Metrics) GC(out <-chan gc.Result) <-chan gc.Result {
+	if m == nil {
+		return out
+	}
+	start := time.Now()
+	m.gcRuns.Inc()
+
+	tracked := make(chan gc.Result, cap(out))
+	go func() {
+		defer close(tracked)
+		failed := false
+		for res := range out {
+			if res.Error != nil {
+				failed = true
+			} else {
+				m.gcRemoved.Inc()
+			}
+			tracked <- res
+		}
+		if failed {
+			m.gcFailures.Inc()
+		}
+		since(m.gcDuration, start)
+	}()
+	return tracked
+}
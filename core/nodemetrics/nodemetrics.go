@@ -0,0 +1,56 @@
+// Package nodemetrics exports the metrics of the swarm dials, of the
+// blockstore operations and of the garbage collections.
+//
+// The metrics are created through go-metrics-interface, in the scope of the
+// node, like those of the other subsystems: the daemon binds the interface to
+// Prometheus, which serves them on /debug/metrics/prometheus, and the
+// subsystems never import Prometheus themselves.
+package nodemetrics
+
+import (
+	"context"
+
+	metrics "github.com/ipfs/go-metrics-interface"
+)
+
+// latencyBuckets are the buckets of the latencies, in seconds.
+var latencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// gcBuckets are the buckets of the durations of the garbage collections, in
+// seconds.
+var gcBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600, 7200}
+
+// blockstoreOps are the blockstore operations timed.
+var blockstoreOps = []string{"get", "get_size", "has", "put", "put_many", "delete"}
+
+// Metrics holds the metrics of the node.
+type Metrics struct {
+	dials        metrics.Counter
+	dialFailures metrics.Counter
+
+	blockstore map[string]metrics.Histogram
+
+	gcRuns     metrics.Counter
+	gcFailures metrics.Counter
+	gcRemoved  metrics.Counter
+	gcDuration metrics.Histogram
+}
+
+// New returns the metrics, created in the scope of ctx.
+func New(ctx context.Context) *Metrics {
+	m := &Metrics{
+		dials:        metrics.NewCtx(ctx, "swarm_dials_total", "Number of dials to peers not connected").Counter(),
+		dialFailures: metrics.NewCtx(ctx, "swarm_dial_failures_total", "Number of dials to peers not connected that failed").Counter(),
+
+		blockstore: make(map[string]metrics.Histogram, len(blockstoreOps)),
+
+		gcRuns:     metrics.NewCtx(ctx, "gc_runs_total", "Number of garbage collections").Counter(),
+		gcFailures: metrics.NewCtx(ctx, "gc_failures_total", "Number of garbage collections that reported errors").Counter(),
+		gcRemoved:  metrics.NewCtx(ctx, "gc_removed_blocks_total", "Number of blocks removed by the garbage collections").Counter(),
+		gcDuration: metrics.NewCtx(ctx, "gc_duration_seconds", "Duration of the garbage collections").Histogram(gcBuckets),
+	}
+	for _, op := range blockstoreOps {
+		m.blockstore[op] = metrics.NewCtx(ctx, "blockstore_"+op+"_latency_seconds", "Latency of the blockstore "+op+" operations").Histogram(latencyBuckets)
+	}
+	return m
+}
@@ -0,0 +1,74 @@
+package nodemetrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gc "github.com/ipfs/go-ipfs/gc"
+
+	blocks "github.com/ipfs/go-block-format"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+func TestBlockstore(t *testing.T) {
+	m := New(context.Background())
+	base := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	bs := m.Blockstore(base)
+
+	b := blocks.NewBlock([]byte("timed block"))
+	if err := bs.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := bs.Has(b.Cid()); err != nil || !has {
+		t.Fatalf("expected the block, got %v, %v", has, err)
+	}
+	got, err := bs.Get(b.Cid())
+	if err != nil || !got.Cid().Equals(b.Cid()) {
+		t.Fatalf("expected the block, got %v", err)
+	}
+	if size, err := bs.GetSize(b.Cid()); err != nil || size != len(b.RawData()) {
+		t.Fatalf("expected the size %d, got %d, %v", len(b.RawData()), size, err)
+	}
+	if err := bs.DeleteBlock(b.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bs.Get(b.Cid()); err != blockstore.ErrNotFound {
+		t.Fatalf("expected the block deleted, got %v", err)
+	}
+}
+
+func TestGC(t *testing.T) {
+	m := New(context.Background())
+	out := make(chan gc.Result, 3)
+	out <- gc.Result{KeyRemoved: blocks.NewBlock([]byte("a")).Cid()}
+	out <- gc.Result{Error: errors.New("failed")}
+	out <- gc.Result{KeyRemoved: blocks.NewBlock([]byte("b")).Cid()}
+	close(out)
+
+	var removed, failed int
+	for res := range m.GC(out) {
+		if res.Error != nil {
+			failed++
+		} else {
+			removed++
+		}
+	}
+	if removed != 2 || failed != 1 {
+		t.Fatalf("expected every result passed on, got %d removed and %d failed", removed, failed)
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	base := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	if m.Blockstore(base) != base {
+		t.Fatal("expected a nil Metrics not to wrap the blockstore")
+	}
+	out := make(chan gc.Result)
+	if m.GC(out) != (<-chan gc.Result)(out) {
+		t.Fatal("expected a nil Metrics not to wrap the output")
+	}
+}
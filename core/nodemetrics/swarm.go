@@ -0,0 +1,58 @@
+package nodemetrics
+
+import (
+	"context"
+
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// Host wraps h to count the dials made through it, to the peers not
+// connected yet, and their failures. It is safe to call on a nil Metrics, in
+// which case h is returned as is.
+//
+// The dials made by libp2p itself, bypassing the wrapped host, aren't
+// counted.
+func (m *Metrics) Host(h host.Host) host.Host {
+	if m == nil {
+		return h
+	}
+	return &dialCountingHost{Host: h, m: m}
+}
+
+type dialCountingHost struct {
+	host.Host
+	m *Metrics
+}
+
+func (h *dialCountingHost) Connect(ctx context.Context, pi peer.AddrInfo) error {
+	dial := h.Network().Connectedness(pi.ID) != inet.Connected
+	err := h.Host.Connect(ctx, pi)
+	if dial {
+		h.m.countDial(ctx, err)
+	}
+	return err
+}
+
+func (h *dialCountingHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (inet.Stream, error) {
+	dial := h.Network().Connectedness(p) != inet.Connected
+	s, err := h.Host.NewStream(ctx, p, pids...)
+	if dial {
+		// a failed protocol negotiation on a new connection counts too
+		h.m.countDial(ctx, err)
+	}
+	return s, err
+}
+
+func (m *Metrics) countDial(ctx context.Context, err error) {
+	if err != nil && ctx.Err() != nil {
+		// abandoned by the caller
+		return
+	}
+	m.dials.Inc()
+	if err != nil {
+		m.dialFailures.Inc()
+	}
+}
@@ -0,0 +1,267 @@
+// Package observed collects the addresses other peers observe for the node.
+//
+// Every peer reports the address it sees the node connecting from in its
+// identify message. libp2p keeps these observations only to advertise the
+// addresses confirmed by enough peers, without the counts behind them, so the
+// Observer identifies the peers it connects to once more and keeps its own
+// record: which peers observed each address, on which local address, and
+// when. This is what's needed to verify that a NAT or a port forward maps the
+// listen addresses as intended.
+package observed
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	ggio "github.com/gogo/protobuf/io"
+	logging "github.com/ipfs/go-log"
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	identify "github.com/libp2p/go-libp2p/p2p/protocol/identify"
+	pb "github.com/libp2p/go-libp2p/p2p/protocol/identify/pb"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("observed")
+
+var (
+	// ObservationTTL is how long an observation is kept after it was
+	// last made.
+	ObservationTTL = 30 * time.Minute
+
+	// ActivationThresh is the number of peers which must observe an
+	// address for libp2p to advertise it, and for it to be confirmed.
+	ActivationThresh = 4
+)
+
+// maxIdentifySize bounds the size of the identify messages read.
+const maxIdentifySize = 2048
+
+// identifyTimeout bounds identifying a peer.
+const identifyTimeout = 10 * time.Second
+
+// maxIdentifying bounds the peers identified at once.
+const maxIdentifying = 4
+
+// Confidence levels of the addresses.
+const (
+	Low    = "low"
+	Medium = "medium"
+	High   = "high"
+)
+
+// Address is an address observed for the node.
+type Address struct {
+	Addr string
+
+	// Observers is the number of peers which observed the address, and
+	// Inbound the number of them which dialed the node.
+	Observers int
+	Inbound   int
+
+	// Local are the local addresses of the connections it was observed
+	// on.
+	Local []string
+
+	// Confidence is High if it was observed by at least ActivationThresh
+	// peers, Medium if by more than one, and Low otherwise.
+	Confidence string
+
+	// Advertised tells whether the node advertises the address.
+	Advertised bool
+
+	LastSeen time.Time
+}
+
+type observation struct {
+	local   string
+	inbound bool
+	seen    time.Time
+}
+
+// Observer records the addresses the peers observe for the node.
+type Observer struct {
+	h host.Host
+
+	sem chan struct{}
+
+	mu      sync.Mutex
+	addrs   map[string]map[peer.ID]observation
+	pending map[peer.ID]bool
+}
+
+// New creates an Observer for h. Start starts observing.
+func New(h host.Host) *Observer {
+	return &Observer{
+		h:       h,
+		sem:     make(chan struct{}, maxIdentifying),
+		addrs:   make(map[string]map[peer.ID]observation),
+		pending: make(map[peer.ID]bool),
+	}
+}
+
+// Start identifies the peers connecting to the host until ctx is done.
+func (o *Observer) Start(ctx context.Context) {
+	o.h.Network().Notify(&notifiee{o: o, ctx: ctx})
+}
+
+// Addrs returns the observed addresses, the most observed first.
+func (o *Observer) Addrs() []Address {
+	advertised := make(map[string]bool)
+	for _, a := range o.h.Addrs() {
+		advertised[a.String()] = true
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.expireLocked(time.Now())
+
+	out := make([]Address, 0, len(o.addrs))
+	for addr, obs := range o.addrs {
+		a := Address{Addr: addr, Observers: len(obs), Advertised: advertised[addr]}
+		local := make(map[string]bool)
+		for _, ob := range obs {
+			if ob.inbound {
+				a.Inbound++
+			}
+			if ob.seen.After(a.LastSeen) {
+				a.LastSeen = ob.seen
+			}
+			if !local[ob.local] {
+				local[ob.local] = true
+				a.Local = append(a.Local, ob.local)
+			}
+		}
+		sort.Strings(a.Local)
+		a.Confidence = confidence(a.Observers)
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Observers != out[j].Observers {
+			return out[i].Observers > out[j].Observers
+		}
+		return out[i].Addr < out[j].Addr
+	})
+	return out
+}
+
+func confidence(observers int) string {
+	switch {
+	case observers >= ActivationThresh:
+		return High
+	case observers > 1:
+		return Medium
+	default:
+		return Low
+	}
+}
+
+// record records that p observed the node at observed, over a connection from
+// the local address local. A peer's last observation replaces its previous
+// ones.
+func (o *Observer) record(p peer.ID, local, observed ma.Multiaddr, inbound bool) {
+	now := time.Now()
+	addr := observed.String()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for a, obs := range o.addrs {
+		if a != addr {
+			delete(obs, p)
+			if len(obs) == 0 {
+				delete(o.addrs, a)
+			}
+		}
+	}
+	obs, ok := o.addrs[addr]
+	if !ok {
+		obs = make(map[peer.ID]observation)
+		o.addrs[addr] = obs
+	}
+	obs[p] = observation{local: local.String(), inbound: inbound, seen: now}
+	o.expireLocked(now)
+}
+
+func (o *Observer) expireLocked(now time.Time) {
+	for a, obs := range o.addrs {
+		for p, ob := range obs {
+			if now.Sub(ob.seen) >= ObservationTTL {
+				delete(obs, p)
+			}
+		}
+		if len(obs) == 0 {
+			delete(o.addrs, a)
+		}
+	}
+}
+
+// identify asks p for its identify message, and records the address it
+// observes for the node.
+func (o *Observer) identify(ctx context.Context, p peer.ID) {
+	defer func() {
+		o.mu.Lock()
+		delete(o.pending, p)
+		o.mu.Unlock()
+	}()
+
+	select {
+	case o.sem <- struct{}{}:
+		defer func() { <-o.sem }()
+	case <-ctx.Done():
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, identifyTimeout)
+	defer cancel()
+	s, err := o.h.NewStream(ctx, p, identify.ID)
+	if err != nil {
+		log.Debugf("identifying %s: %s", p.Pretty(), err)
+		return
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(identifyTimeout))
+
+	var msg pb.Identify
+	if err := ggio.NewDelimitedReader(s, maxIdentifySize).ReadMsg(&msg); err != nil {
+		s.Reset()
+		log.Debugf("identifying %s: %s", p.Pretty(), err)
+		return
+	}
+	if len(msg.ObservedAddr) == 0 {
+		return
+	}
+	observed, err := ma.NewMultiaddrBytes(msg.ObservedAddr)
+	if err != nil {
+		log.Debugf("invalid address observed by %s: %s", p.Pretty(), err)
+		return
+	}
+
+	c := s.Conn()
+	o.record(p, c.LocalMultiaddr(), observed, c.Stat().Direction == inet.DirInbound)
+}
+
+type notifiee struct {
+	o   *Observer
+	ctx context.Context
+}
+
+func (n *notifiee) Connected(_ inet.Network, c inet.Conn) {
+	p := c.RemotePeer()
+	n.o.mu.Lock()
+	if n.o.pending[p] {
+		n.o.mu.Unlock()
+		return
+	}
+	n.o.pending[p] = true
+	n.o.mu.Unlock()
+	go n.o.identify(n.ctx, p)
+}
+
+func (n *notifiee) Disconnected(inet.Network, inet.Conn)   {}
+func (n *notifiee) Listen(inet.Network, ma.Multiaddr)      {}
+func (n *notifiee) ListenClose(inet.Network, ma.Multiaddr) {}
+func (n *notifiee) OpenedStream(inet.Network, inet.Stream) {}
+func (n *notifiee) ClosedStream(inet.Network, inet.Stream) {}
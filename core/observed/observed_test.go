@@ -0,0 +1,76 @@
+package observed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestObserve(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshLinked(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+
+	o := New(hosts[0])
+	o.Start(ctx)
+	if err := mn.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+
+	var addrs []Address
+	for i := 0; i < 50 && len(addrs) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+		addrs = o.Addrs()
+	}
+	if len(addrs) != 1 {
+		t.Fatalf("expected an observed address, got %v", addrs)
+	}
+	a := addrs[0]
+	if a.Observers != 1 || a.Confidence != Low || len(a.Local) != 1 {
+		t.Fatalf("unexpected observed address: %+v", a)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	o := New(nil)
+	local := ma.StringCast("/ip4/192.168.1.2/tcp/4001")
+	public := ma.StringCast("/ip4/1.2.3.4/tcp/4001")
+	other := ma.StringCast("/ip4/1.2.3.4/tcp/5678")
+
+	peers := []peer.ID{"a", "b", "c", "d"}
+	for _, p := range peers {
+		o.record(p, local, public, true)
+	}
+	o.record("e", local, other, false)
+
+	o.mu.Lock()
+	if n := len(o.addrs[public.String()]); n != 4 {
+		t.Fatalf("expected 4 observers, got %d", n)
+	}
+	o.mu.Unlock()
+	if c := confidence(4); c != High {
+		t.Fatalf("expected a high confidence, got %s", c)
+	}
+
+	// a new observation of a peer replaces its previous one
+	o.record("a", local, other, false)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.addrs[public.String()]) != 3 || len(o.addrs[other.String()]) != 2 {
+		t.Fatal("expected the observation to move to the new address")
+	}
+
+	o.expireLocked(time.Now().Add(ObservationTTL))
+	if len(o.addrs) != 0 {
+		t.Fatal("expected the observations to expire")
+	}
+}
@@ -0,0 +1,529 @@
+// Package partition detects when the node is cut off from its reference peers,
+// the bootstrap peers and the peering set, and tells a failure of the local
+// network from an outage on the side of the peers.
+//
+// Every Interval, the detector pings the reference peers over libp2p. While a
+// quorum of them answers, the node is healthy. Otherwise it takes other paths
+// to tell why: a local network failure leaves no network interface up, or
+// fails the plain TCP dials to the probe addresses, which are independent of
+// the peers; when the probes succeed, the network works and the peers are
+// out of reach, a remote outage. A state must be seen on two rounds in a row
+// to be reported, so that a single lost round doesn't flap it.
+package partition
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	logging "github.com/ipfs/go-log"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ping "github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+var log = logging.Logger("partition")
+
+// ConfigKey is the config key of the partition detection section.
+const ConfigKey = "Partition"
+
+// By default, the connectivity is checked every minute, and half of the
+// reference peers must answer.
+const (
+	DefaultInterval = time.Minute
+	DefaultQuorum   = 0.5
+)
+
+// DefaultProbes are public DNS resolvers, dialed over TCP.
+var DefaultProbes = []string{
+	"/ip4/1.1.1.1/tcp/53",
+	"/ip4/8.8.8.8/tcp/53",
+	"/ip6/2606:4700:4700::1111/tcp/53",
+	"/ip6/2001:4860:4860::8888/tcp/53",
+}
+
+// probeTimeout bounds a ping or a dial.
+const probeTimeout = 10 * time.Second
+
+// confirmRounds is the number of rounds in a row a state must be seen on to
+// be reported.
+const confirmRounds = 2
+
+// maxEvents is the number of events kept.
+const maxEvents = 64
+
+// Config holds the Partition config section.
+type Config struct {
+	Enabled bool
+
+	// Interval is the time between two checks, e.g. "1m".
+	Interval string
+
+	// Quorum is the share of the reference peers that must answer for the
+	// node to be healthy, between 0 and 1.
+	Quorum float64
+
+	// Peers are reference peers, as /p2p addresses or peer IDs, in
+	// addition to the bootstrap peers and to Swarm.ProtectedPeers.
+	Peers []string
+
+	// Probes are the addresses dialed over TCP to check the local network,
+	// DefaultProbes when unset. Use hosts out of the node's network, but
+	// reachable from it, as the gateway of a private network.
+	Probes []string
+}
+
+// LoadConfig reads the Partition section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// State is the connectivity of the node.
+type State string
+
+const (
+	// Unknown is the state before the first checks.
+	Unknown State = "unknown"
+	// Healthy is a quorum of the reference peers reachable.
+	Healthy State = "healthy"
+	// LocalFailure is the local network failing, the probes failing too.
+	LocalFailure State = "local-network-failure"
+	// RemoteOutage is the reference peers out of reach while the local
+	// network works.
+	RemoteOutage State = "remote-outage"
+)
+
+// Event is a change of state.
+type Event struct {
+	Time   time.Time
+	From   State
+	To     State
+	Reason string
+}
+
+// PeerStatus is the result of the ping of a reference peer.
+type PeerStatus struct {
+	Peer      string
+	Reachable bool
+	RTT       time.Duration `json:",omitempty"`
+	Error     string        `json:",omitempty"`
+}
+
+// ProbeStatus is the result of the dial of a probe address.
+type ProbeStatus struct {
+	Addr      string
+	Reachable bool
+	Error     string `json:",omitempty"`
+}
+
+// Report is the state of the node and the results of the last check.
+type Report struct {
+	State  State
+	Since  time.Time
+	Reason string
+
+	// Checked is the time of the last check, and Reachable the number of
+	// reference peers that answered, out of the Quorum needed.
+	Checked   time.Time
+	Reachable int
+	Quorum    int
+
+	Peers  []PeerStatus
+	Probes []ProbeStatus `json:",omitempty"`
+	// LocalAddrs is the number of addresses of the network interfaces,
+	// loopback and link-local excluded.
+	LocalAddrs int
+
+	Events []Event
+}
+
+// result is what a check found.
+type result struct {
+	peers      []PeerStatus
+	probes     []ProbeStatus
+	localAddrs int
+}
+
+// Detector checks the connectivity of the node.
+type Detector struct {
+	h          host.Host
+	interval   time.Duration
+	quorum     float64
+	references func() ([]peer.AddrInfo, error)
+	probes     []ma.Multiaddr
+
+	// the paths checked, replaced by the tests
+	pingPeer       func(ctx context.Context, pi peer.AddrInfo) (time.Duration, error)
+	dialProbe      func(ctx context.Context, a ma.Multiaddr) error
+	interfaceAddrs func() ([]ma.Multiaddr, error)
+
+	mu       sync.Mutex
+	state    State
+	since    time.Time
+	reason   string
+	pending  State
+	seen     int
+	last     result
+	checked  time.Time
+	events   []Event
+	subs     map[chan Event]struct{}
+	cancel   context.CancelFunc
+	stopped  chan struct{}
+	started  bool
+	required int
+}
+
+// New returns a detector for h, or nil if disabled in cfg. references returns
+// the reference peers, read on each check.
+func New(h host.Host, cfg Config, references func() ([]peer.AddrInfo, error)) (*Detector, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	d := &Detector{
+		h:              h,
+		quorum:         cfg.Quorum,
+		references:     references,
+		interfaceAddrs: manet.InterfaceMultiaddrs,
+		state:          Unknown,
+		since:          time.Now(),
+		subs:           make(map[chan Event]struct{}),
+	}
+	d.pingPeer = d.ping
+	d.dialProbe = dial
+
+	var err error
+	if d.interval, err = repo.ConfigDuration(ConfigKey, "Interval", cfg.Interval, DefaultInterval); err != nil {
+		return nil, err
+	}
+	if d.quorum == 0 {
+		d.quorum = DefaultQuorum
+	}
+	if d.quorum < 0 || d.quorum > 1 {
+		return nil, fmt.Errorf("invalid %s.Quorum: expected a share between 0 and 1", ConfigKey)
+	}
+
+	probes := cfg.Probes
+	if probes == nil {
+		probes = DefaultProbes
+	}
+	for _, s := range probes {
+		a, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q in %s.Probes: %s", s, ConfigKey, err)
+		}
+		if _, err := a.ValueForProtocol(ma.P_TCP); err != nil {
+			return nil, fmt.Errorf("invalid address %q in %s.Probes: expected a TCP address", s, ConfigKey)
+		}
+		d.probes = append(d.probes, a)
+	}
+	return d, nil
+}
+
+// ParsePeers parses the Peers of cfg.
+func (cfg Config) ParsePeers() ([]peer.AddrInfo, error) {
+	var out []peer.AddrInfo
+	for _, s := range cfg.Peers {
+		if id, err := peer.Decode(s); err == nil {
+			out = append(out, peer.AddrInfo{ID: id})
+			continue
+		}
+		a, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer %q in %s.Peers: %s", s, ConfigKey, err)
+		}
+		pi, err := peer.AddrInfoFromP2pAddr(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer %q in %s.Peers: %s", s, ConfigKey, err)
+		}
+		out = append(out, *pi)
+	}
+	return out, nil
+}
+
+// Start checks the connectivity every interval until Close is called.
+func (d *Detector) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.mu.Lock()
+	d.cancel = cancel
+	d.stopped = make(chan struct{})
+	d.started = true
+	d.mu.Unlock()
+
+	go func() {
+		defer close(d.stopped)
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			d.Check(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the checks.
+func (d *Detector) Close() error {
+	d.mu.Lock()
+	started := d.started
+	d.mu.Unlock()
+	if !started {
+		return nil
+	}
+	d.cancel()
+	<-d.stopped
+	return nil
+}
+
+// Check checks the connectivity once, and updates the state.
+func (d *Detector) Check(ctx context.Context) {
+	refs, err := d.references()
+	if err != nil {
+		log.Errorf("reading the reference peers: %s", err)
+		return
+	}
+	refs = dedupe(refs)
+
+	var res result
+	res.peers = make([]PeerStatus, len(refs))
+	var wg sync.WaitGroup
+	for i, pi := range refs {
+		wg.Add(1)
+		go func(i int, pi peer.AddrInfo) {
+			defer wg.Done()
+			st := PeerStatus{Peer: pi.ID.Pretty()}
+			rtt, err := d.pingPeer(ctx, pi)
+			if err != nil {
+				st.Error = err.Error()
+			} else {
+				st.Reachable, st.RTT = true, rtt
+			}
+			res.peers[i] = st
+		}(i, pi)
+	}
+
+	// the other paths are only needed to explain a lost quorum, but are
+	// checked along, for the report
+	res.probes = make([]ProbeStatus, len(d.probes))
+	for i, a := range d.probes {
+		wg.Add(1)
+		go func(i int, a ma.Multiaddr) {
+			defer wg.Done()
+			st := ProbeStatus{Addr: a.String()}
+			if err := d.dialProbe(ctx, a); err != nil {
+				st.Error = err.Error()
+			} else {
+				st.Reachable = true
+			}
+			res.probes[i] = st
+		}(i, a)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	if addrs, err := d.interfaceAddrs(); err != nil {
+		log.Warningf("listing the interface addresses: %s", err)
+	} else {
+		for _, a := range addrs {
+			if !manet.IsIPLoopback(a) && !manet.IsIP6LinkLocal(a) {
+				res.localAddrs++
+			}
+		}
+	}
+
+	d.update(res, time.Now())
+}
+
+// update classifies res, and changes the state once it is confirmed.
+func (d *Detector) update(res result, now time.Time) {
+	state, reason, required := d.classify(res)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.last, d.checked, d.required = res, now, required
+
+	if state == d.state {
+		d.pending, d.seen = "", 0
+		d.reason = reason
+		return
+	}
+	if state != d.pending {
+		d.pending, d.seen = state, 0
+	}
+	d.seen++
+	// the first state is reported right away
+	if d.state != Unknown && d.seen < confirmRounds {
+		return
+	}
+
+	ev := Event{Time: now, From: d.state, To: state, Reason: reason}
+	d.state, d.since, d.reason = state, now, reason
+	d.pending, d.seen = "", 0
+	if len(d.events) == maxEvents {
+		copy(d.events, d.events[1:])
+		d.events = d.events[:maxEvents-1]
+	}
+	d.events = append(d.events, ev)
+	for ch := range d.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+
+	if state == Healthy {
+		log.Infof("connectivity restored: %s", reason)
+	} else {
+		log.Warningf("%s: %s", state, reason)
+	}
+}
+
+// classify returns the state res shows, why, and the number of reference
+// peers needed for the quorum.
+func (d *Detector) classify(res result) (State, string, int) {
+	reachable := 0
+	for _, p := range res.peers {
+		if p.Reachable {
+			reachable++
+		}
+	}
+	required := quorumOf(len(res.peers), d.quorum)
+	if len(res.peers) == 0 {
+		return Unknown, "no reference peer", required
+	}
+	if reachable >= required {
+		return Healthy, fmt.Sprintf("%d of %d reference peers reachable", reachable, len(res.peers)), required
+	}
+
+	lost := fmt.Sprintf("%d of %d reference peers reachable, %d needed", reachable, len(res.peers), required)
+	if res.localAddrs == 0 {
+		return LocalFailure, lost + ", no network interface up", required
+	}
+	probes := 0
+	for _, p := range res.probes {
+		if p.Reachable {
+			probes++
+		}
+	}
+	switch {
+	case len(res.probes) == 0 && reachable == 0:
+		return LocalFailure, lost + ", no probe configured", required
+	case len(res.probes) == 0:
+		return RemoteOutage, lost, required
+	case probes == 0:
+		return LocalFailure, lost + ", no probe reachable", required
+	default:
+		return RemoteOutage, fmt.Sprintf("%s, %d of %d probes reachable", lost, probes, len(res.probes)), required
+	}
+}
+
+// quorumOf returns the number of peers out of n making a quorum, at least 1.
+func quorumOf(n int, quorum float64) int {
+	q := int(float64(n)*quorum + 0.999999)
+	if q < 1 {
+		q = 1
+	}
+	return q
+}
+
+// Report returns the state and the results of the last check.
+func (d *Detector) Report() Report {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	reachable := 0
+	for _, p := range d.last.peers {
+		if p.Reachable {
+			reachable++
+		}
+	}
+	return Report{
+		State:      d.state,
+		Since:      d.since,
+		Reason:     d.reason,
+		Checked:    d.checked,
+		Reachable:  reachable,
+		Quorum:     d.required,
+		Peers:      append([]PeerStatus(nil), d.last.peers...),
+		Probes:     append([]ProbeStatus(nil), d.last.probes...),
+		LocalAddrs: d.last.localAddrs,
+		Events:     append([]Event(nil), d.events...),
+	}
+}
+
+// Subscribe returns a channel receiving the changes of state, until cancel is
+// called. Events are dropped if the channel isn't drained.
+func (d *Detector) Subscribe() (events <-chan Event, cancel func()) {
+	ch := make(chan Event, 16)
+	d.mu.Lock()
+	d.subs[ch] = struct{}{}
+	d.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			d.mu.Lock()
+			delete(d.subs, ch)
+			d.mu.Unlock()
+		})
+	}
+}
+
+// ping dials pi if needed, and pings it.
+func (d *Detector) ping(ctx context.Context, pi peer.AddrInfo) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	if err := d.h.Connect(ctx, pi); err != nil {
+		return 0, err
+	}
+	r, ok := <-ping.Ping(ctx, d.h, pi.ID)
+	if !ok {
+		return 0, ctx.Err()
+	}
+	return r.RTT, r.Error
+}
+
+// dial opens, then closes, a TCP connection to a.
+func dial(ctx context.Context, a ma.Multiaddr) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	network, addr, err := manet.DialArgs(a)
+	if err != nil {
+		return err
+	}
+	var dialer net.Dialer
+	c, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// dedupe merges the addresses of the peers listed several times.
+func dedupe(peers []peer.AddrInfo) []peer.AddrInfo {
+	index := make(map[peer.ID]int)
+	var out []peer.AddrInfo
+	for _, pi := range peers {
+		if i, ok := index[pi.ID]; ok {
+			out[i].Addrs = append(out[i].Addrs, pi.Addrs...)
+			continue
+		}
+		index[pi.ID] = len(out)
+		out = append(out, pi)
+	}
+	return out
+}
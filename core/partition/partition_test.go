@@ -0,0 +1,137 @@
+package partition
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func newTestDetector(t *testing.T, peers []peer.AddrInfo) *Detector {
+	t.Helper()
+	d, err := New(nil, Config{Enabled: true, Probes: []string{"/ip4/192.0.2.1/tcp/53"}}, func() ([]peer.AddrInfo, error) {
+		return peers, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestStates(t *testing.T) {
+	peers := []peer.AddrInfo{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "a"}}
+	d := newTestDetector(t, peers)
+	events, cancel := d.Subscribe()
+	defer cancel()
+
+	up := map[peer.ID]bool{"a": true, "b": true, "c": true}
+	probeUp, ifaceUp := true, true
+	d.pingPeer = func(_ context.Context, pi peer.AddrInfo) (time.Duration, error) {
+		if up[pi.ID] {
+			return time.Millisecond, nil
+		}
+		return 0, errors.New("unreachable")
+	}
+	d.dialProbe = func(context.Context, ma.Multiaddr) error {
+		if probeUp {
+			return nil
+		}
+		return errors.New("unreachable")
+	}
+	d.interfaceAddrs = func() ([]ma.Multiaddr, error) {
+		if ifaceUp {
+			return []ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1"), ma.StringCast("/ip4/192.168.1.20")}, nil
+		}
+		return []ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1")}, nil
+	}
+
+	expect := func(s State) {
+		t.Helper()
+		d.Check(context.Background())
+		if r := d.Report(); r.State != s {
+			t.Fatalf("expected %s, got %s (%s)", s, r.State, r.Reason)
+		}
+	}
+
+	// the first state is reported right away, the duplicate peer counted once
+	expect(Healthy)
+	if r := d.Report(); len(r.Peers) != 3 || r.Quorum != 2 || r.Reachable != 3 || r.LocalAddrs != 1 {
+		t.Fatalf("unexpected report %+v", r)
+	}
+
+	// a quorum is still reachable
+	up["a"] = false
+	expect(Healthy)
+
+	// the others need two rounds to be reported
+	up["b"] = false
+	expect(Healthy)
+	expect(RemoteOutage)
+
+	probeUp = false
+	expect(RemoteOutage)
+	expect(LocalFailure)
+
+	probeUp, ifaceUp = true, false
+	expect(LocalFailure)
+	expect(LocalFailure)
+
+	// a single round doesn't change the state
+	ifaceUp, up["a"] = true, true
+	expect(LocalFailure)
+	up["a"] = false
+	expect(LocalFailure)
+
+	up["a"], up["b"] = true, true
+	expect(LocalFailure)
+	expect(Healthy)
+
+	want := []State{Healthy, RemoteOutage, LocalFailure, Healthy}
+	got := d.Report().Events
+	if len(got) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), got)
+	}
+	for i, s := range want {
+		if got[i].To != s {
+			t.Fatalf("event %d: expected %s, got %+v", i, s, got[i])
+		}
+		select {
+		case ev := <-events:
+			if ev.To != s {
+				t.Fatalf("event %d: expected %s, got %+v", i, s, ev)
+			}
+		default:
+			t.Fatal("expected the subscription to receive the events")
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	if d, err := New(nil, Config{}, nil); d != nil || err != nil {
+		t.Fatalf("expected no detector when disabled, got %v, %v", d, err)
+	}
+	for _, cfg := range []Config{
+		{Enabled: true, Quorum: 1.5},
+		{Enabled: true, Interval: "soon"},
+		{Enabled: true, Probes: []string{"/ip4/192.0.2.1/udp/53"}},
+	} {
+		if _, err := New(nil, cfg, nil); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+
+	cfg := Config{Peers: []string{
+		"QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ",
+		"/ip4/10.0.0.1/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ",
+	}}
+	peers, err := cfg.ParsePeers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peers = dedupe(peers); len(peers) != 1 || len(peers[0].Addrs) != 1 {
+		t.Fatalf("expected one peer with one address, got %+v", peers)
+	}
+}
@@ -0,0 +1,325 @@
+// Package pathnorm implements optional unicode and case normalization of
+// path components for MFS and gateway lookups.
+//
+// Content added on macOS typically carries NFD-normalized file names while
+// most other systems produce NFC, so a name typed on one system may not match
+// the link stored by the other byte for byte. When enabled, lookups that fail
+// to find an exact match fall back to comparing normalized names.
+package pathnorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	mfs "github.com/ipfs/go-mfs"
+	resolver "github.com/ipfs/go-path/resolver"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ConfigKey is the key of the normalization section in the repo config.
+const ConfigKey = "PathNormalization"
+
+// ErrNoMatch is returned when no entry matches a name, even after
+// normalization.
+var ErrNoMatch = errors.New("no matching entry")
+
+// Config holds the PathNormalization config section.
+type Config struct {
+	// Form is the unicode normalization form names are compared in. One of
+	// "NFC", "NFD", "NFKC", "NFKD", or empty to disable unicode normalization.
+	Form string
+
+	// CaseFold makes name comparisons case-insensitive.
+	CaseFold bool
+
+	// MFS enables normalization for 'ipfs files' paths.
+	MFS bool
+
+	// Gateway enables normalization for gateway lookups.
+	Gateway bool
+}
+
+// Load reads the PathNormalization section from the repo config.
+func Load(r repo.Repo) (*Config, error) {
+	cfg := &Config{}
+	if err := repo.LoadConfigKey(r, ConfigKey, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Normalizer compares path components according to a normalization policy.
+// A nil Normalizer compares names byte for byte.
+type Normalizer struct {
+	form     norm.Form
+	useForm  bool
+	caseFold bool
+}
+
+// New returns a Normalizer for the given unicode form and case policy. It
+// returns nil if neither normalization is requested.
+func New(form string, caseFold bool) (*Normalizer, error) {
+	n := &Normalizer{caseFold: caseFold}
+
+	switch strings.ToUpper(form) {
+	case "":
+	case "NFC":
+		n.form, n.useForm = norm.NFC, true
+	case "NFD":
+		n.form, n.useForm = norm.NFD, true
+	case "NFKC":
+		n.form, n.useForm = norm.NFKC, true
+	case "NFKD":
+		n.form, n.useForm = norm.NFKD, true
+	default:
+		return nil, fmt.Errorf("unknown unicode normalization form %q", form)
+	}
+
+	if !n.Enabled() {
+		return nil, nil
+	}
+	return n, nil
+}
+
+// ForMFS returns the Normalizer configured for MFS paths, or nil.
+func ForMFS(r repo.Repo) (*Normalizer, error) {
+	cfg, err := Load(r)
+	if err != nil || !cfg.MFS {
+		return nil, err
+	}
+	return New(cfg.Form, cfg.CaseFold)
+}
+
+// ForGateway returns the Normalizer configured for gateway lookups, or nil.
+func ForGateway(r repo.Repo) (*Normalizer, error) {
+	cfg, err := Load(r)
+	if err != nil || !cfg.Gateway {
+		return nil, err
+	}
+	return New(cfg.Form, cfg.CaseFold)
+}
+
+// Enabled reports whether n normalizes names at all.
+func (n *Normalizer) Enabled() bool {
+	return n != nil && (n.useForm || n.caseFold)
+}
+
+// Name returns name in the configured unicode form. Case is preserved, this
+// is the form new entries are created with.
+func (n *Normalizer) Name(name string) string {
+	if n == nil || !n.useForm {
+		return name
+	}
+	return n.form.String(name)
+}
+
+// Key returns the key name is compared by.
+func (n *Normalizer) Key(name string) string {
+	name = n.Name(name)
+	if n != nil && n.caseFold {
+		name = cases.Fold().String(name)
+	}
+	return name
+}
+
+// Match returns the entry in names that matches name. An exact match always
+// wins; otherwise exactly one entry must match after normalization.
+func (n *Normalizer) Match(names []string, name string) (string, error) {
+	for _, s := range names {
+		if s == name {
+			return s, nil
+		}
+	}
+	if !n.Enabled() {
+		return "", ErrNoMatch
+	}
+
+	key := n.Key(name)
+	var found []string
+	for _, s := range names {
+		if n.Key(s) == key {
+			found = append(found, s)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", ErrNoMatch
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("name %q is ambiguous after normalization: %q", name, found)
+	}
+}
+
+// MFSPath rewrites the cleaned, absolute MFS path p so that every component
+// refers to an existing entry where one matches. Components that don't
+// exist yet are converted to the configured unicode form so new entries are
+// created normalized. The trailing slash of p, if any, is kept.
+func (n *Normalizer) MFSPath(ctx context.Context, root *mfs.Root, p string) (string, error) {
+	if !n.Enabled() || p == "/" {
+		return p, nil
+	}
+
+	var out []string
+	cur := root.GetDirectory()
+	for _, part := range strings.Split(strings.Trim(p, "/"), "/") {
+		if cur == nil {
+			out = append(out, n.Name(part))
+			continue
+		}
+
+		names, err := cur.ListNames(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		match, err := n.Match(names, part)
+		switch err {
+		case nil:
+		case ErrNoMatch:
+			out = append(out, n.Name(part))
+			cur = nil
+			continue
+		default:
+			return "", err
+		}
+		out = append(out, match)
+
+		child, err := cur.Child(match)
+		if err != nil {
+			return "", err
+		}
+		cur, _ = child.(*mfs.Directory)
+	}
+
+	res := "/" + strings.Join(out, "/")
+	if strings.HasSuffix(p, "/") {
+		res += "/"
+	}
+	return res, nil
+}
+
+// ResolvePath resolves p through api. If the path can't be resolved because
+// a link is missing, it is walked again component by component, matching
+// directory entries by their normalized names.
+func (n *Normalizer) ResolvePath(ctx context.Context, api coreiface.CoreAPI, p ipath.Path) (ipath.Resolved, error) {
+	rp, err := api.ResolvePath(ctx, p)
+	if _, ok := err.(resolver.ErrNoLink); !ok || !n.Enabled() {
+		return rp, err
+	}
+
+	segs := strings.Split(strings.Trim(p.String(), "/"), "/")
+	if len(segs) < 3 {
+		return rp, err
+	}
+
+	cur, err := api.ResolvePath(ctx, ipath.New("/"+segs[0]+"/"+segs[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, seg := range segs[2:] {
+		if seg == "" {
+			continue
+		}
+
+		next, err := api.ResolvePath(ctx, ipath.Join(cur, seg))
+		if _, ok := err.(resolver.ErrNoLink); ok {
+			match, merr := n.matchChild(ctx, api, cur, seg)
+			if merr != nil {
+				return nil, err
+			}
+			next, err = api.ResolvePath(ctx, ipath.Join(cur, match))
+		}
+		if err != nil {
+			return nil, err
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+func (n *Normalizer) matchChild(ctx context.Context, api coreiface.CoreAPI, dir ipath.Resolved, name string) (string, error) {
+	entries, err := api.Unixfs().Ls(ctx, dir, options.Unixfs.ResolveChildren(false))
+	if err != nil {
+		return "", err
+	}
+
+	var names []string
+	for e := range entries {
+		if e.Err != nil {
+			return "", e.Err
+		}
+		names = append(names, e.Name)
+	}
+	return n.Match(names, name)
+}
+
+// Step is a node a path goes through, and the name of the link it was
+// reached by. The first step of a path has no name.
+type Step struct {
+	Name string
+	Node ipath.Resolved
+}
+
+// Walk resolves p like ResolvePath, and returns every node the path goes
+// through. An /ipns/ name is resolved first, and the steps of its target
+// come before the steps of the rest of p; the number of the former is
+// returned as well.
+func (n *Normalizer) Walk(ctx context.Context, api coreiface.CoreAPI, p ipath.Path) ([]Step, int, error) {
+	segs := strings.Split(strings.Trim(p.String(), "/"), "/")
+	if len(segs) < 2 {
+		return nil, 0, fmt.Errorf("invalid path %q", p)
+	}
+
+	var steps []Step
+	if segs[0] == "ipns" {
+		target, err := api.Name().Resolve(ctx, segs[1])
+		if err != nil {
+			return nil, 0, err
+		}
+		if steps, _, err = n.Walk(ctx, api, target); err != nil {
+			return nil, 0, err
+		}
+	} else {
+		root, err := api.ResolvePath(ctx, ipath.New("/"+segs[0]+"/"+segs[1]))
+		if err != nil {
+			return nil, 0, err
+		}
+		steps = []Step{{Node: root}}
+	}
+	rootSteps := len(steps)
+
+	cur := steps[len(steps)-1].Node
+	for _, seg := range segs[2:] {
+		if seg == "" {
+			continue
+		}
+
+		name := seg
+		next, err := api.ResolvePath(ctx, ipath.Join(cur, seg))
+		if _, ok := err.(resolver.ErrNoLink); ok && n.Enabled() {
+			match, merr := n.matchChild(ctx, api, cur, seg)
+			if merr != nil {
+				return nil, 0, err
+			}
+			name = match
+			next, err = api.ResolvePath(ctx, ipath.Join(cur, match))
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		steps = append(steps, Step{Name: name, Node: next})
+		cur = next
+	}
+	return steps, rootSteps, nil
+}
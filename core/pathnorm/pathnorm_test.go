@@ -0,0 +1,73 @@
+package pathnorm
+
+import "testing"
+
+const (
+	nfc = "caf\u00e9"
+	nfd = "cafe\u0301"
+)
+
+func TestNewDisabled(t *testing.T) {
+	n, err := New("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Enabled() {
+		t.Fatal("expected normalization to be disabled")
+	}
+	if _, err := n.Match([]string{nfd}, nfc); err != ErrNoMatch {
+		t.Fatalf("expected ErrNoMatch, got %v", err)
+	}
+
+	if _, err := New("NFX", false); err == nil {
+		t.Fatal("expected error for unknown form")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	n, err := New("NFC", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := n.Match([]string{"a", nfd}, nfc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != nfd {
+		t.Fatalf("expected stored name %q, got %q", nfd, m)
+	}
+
+	if n.Name(nfd) != nfc {
+		t.Fatal("expected name to be converted to NFC")
+	}
+
+	if _, err := n.Match([]string{"Cafe"}, "cafe"); err != ErrNoMatch {
+		t.Fatalf("expected case-sensitive comparison, got %v", err)
+	}
+}
+
+func TestMatchCaseFold(t *testing.T) {
+	n, err := New("NFC", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := n.Match([]string{"README.md"}, "readme.MD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != "README.md" {
+		t.Fatalf("unexpected match %q", m)
+	}
+
+	// exact matches win over normalized ones
+	m, err = n.Match([]string{"Readme", "readme"}, "readme")
+	if err != nil || m != "readme" {
+		t.Fatalf("expected exact match, got %q (%v)", m, err)
+	}
+
+	if _, err := n.Match([]string{"Readme", "README"}, "readme"); err == nil {
+		t.Fatal("expected ambiguous match error")
+	}
+}
@@ -0,0 +1,491 @@
+// Package peerscore keeps a score of the peers, from their dial failures,
+// their misbehavior, the useful blocks they served and their latency.
+//
+// The counters of a peer decay with a half-life, so that old failures are
+// forgiven and a peer must keep serving to keep its score, and they are saved
+// in the datastore to survive the restarts. The score of the connected peers
+// is set as a connection manager tag, so that the connections of the useful
+// peers are kept when the connection manager trims, and those of the failing
+// ones go first.
+//
+// A block is useful if it was in the wantlist sent to the peer. A block sent
+// by a peer it was never asked for counts as misbehavior.
+package peerscore
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-ipfs/repo"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log"
+	connmgr "github.com/libp2p/go-libp2p-core/connmgr"
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	peerstore "github.com/libp2p/go-libp2p-core/peerstore"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+)
+
+var log = logging.Logger("peerscore")
+
+// ConfigKey is the config key of the peer score section.
+const ConfigKey = "Swarm.PeerScore"
+
+// Tag is the connection manager tag holding the score of a peer.
+const Tag = "ipfs-score"
+
+// By default, the tags are updated and the counters saved every minute, the
+// counters are halved every day, and the tags are between -20 and 20.
+const (
+	DefaultInterval = time.Minute
+	DefaultHalfLife = 24 * time.Hour
+	DefaultMaxTag   = 20
+)
+
+// Weights of the counters in the score.
+const (
+	blockWeight       = 1
+	dialFailureWeight = -2
+	misbehaviorWeight = -10
+
+	// latencyUnit is the latency costing a point, up to maxLatencyPenalty.
+	latencyUnit       = 100 * time.Millisecond
+	maxLatencyPenalty = 10
+)
+
+// wantTTL is how long a block stays wanted from a peer after it was asked
+// for, the cancels racing with the blocks already sent.
+const wantTTL = 10 * time.Minute
+
+// negligible is the total of the counters below which a peer is forgotten.
+const negligible = 0.01
+
+var prefix = ds.NewKey("/local/peerscore")
+
+// Config holds the Swarm.PeerScore config section.
+type Config struct {
+	Enabled bool
+
+	// Interval is the time between two updates of the tags and saves of
+	// the counters, e.g. "1m".
+	Interval string
+
+	// HalfLife is the time after which the counters are halved, e.g.
+	// "24h".
+	HalfLife string
+
+	// MaxTag bounds the tag set on the connection manager, which is
+	// between -MaxTag and MaxTag.
+	MaxTag int
+}
+
+// LoadConfig reads the Swarm.PeerScore section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// Counters are the decayed counters of a peer, saved in the datastore.
+type Counters struct {
+	DialFailures float64
+	Misbehavior  float64
+	BlocksServed float64
+
+	// Updated is the time the counters were decayed to.
+	Updated time.Time
+}
+
+// decay halves the counters every halfLife since they were updated.
+func (c *Counters) decay(now time.Time, halfLife time.Duration) {
+	if elapsed := now.Sub(c.Updated); elapsed > 0 {
+		f := math.Pow(0.5, float64(elapsed)/float64(halfLife))
+		c.DialFailures *= f
+		c.Misbehavior *= f
+		c.BlocksServed *= f
+	}
+	c.Updated = now
+}
+
+func (c *Counters) total() float64 {
+	return c.DialFailures + c.Misbehavior + c.BlocksServed
+}
+
+// Score is the score of a peer, with the counters and latency it is computed
+// from.
+type Score struct {
+	Peer  peer.ID
+	Score float64
+	Counters
+	Latency time.Duration
+}
+
+// score computes the score of counters and latency.
+func score(c Counters, latency time.Duration) float64 {
+	penalty := float64(latency) / float64(latencyUnit)
+	if penalty > maxLatencyPenalty {
+		penalty = maxLatencyPenalty
+	}
+	return c.BlocksServed*blockWeight + c.DialFailures*dialFailureWeight + c.Misbehavior*misbehaviorWeight - penalty
+}
+
+// Tracker records the counters of the peers.
+type Tracker struct {
+	ds       ds.Datastore
+	ps       peerstore.Peerstore
+	interval time.Duration
+	halfLife time.Duration
+	maxTag   int
+
+	mu    sync.Mutex
+	peers map[peer.ID]*Counters
+	dirty map[peer.ID]bool
+	wants map[peer.ID]map[cid.Cid]time.Time
+}
+
+// New creates a Tracker with the counters saved in d, taking the latencies
+// of the peers from ps. It returns nil if the scores are not enabled in cfg.
+func New(d ds.Datastore, ps peerstore.Peerstore, cfg Config) (*Tracker, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	t := &Tracker{
+		ds:     d,
+		ps:     ps,
+		maxTag: cfg.MaxTag,
+		peers:  make(map[peer.ID]*Counters),
+		dirty:  make(map[peer.ID]bool),
+		wants:  make(map[peer.ID]map[cid.Cid]time.Time),
+	}
+	var err error
+	if t.interval, err = repo.ConfigDuration(ConfigKey, "Interval", cfg.Interval, DefaultInterval); err != nil {
+		return nil, err
+	}
+	if t.halfLife, err = repo.ConfigDuration(ConfigKey, "HalfLife", cfg.HalfLife, DefaultHalfLife); err != nil {
+		return nil, err
+	}
+	if t.maxTag <= 0 {
+		t.maxTag = DefaultMaxTag
+	}
+
+	res, err := d.Query(query.Query{Prefix: prefix.String() + "/"})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		p, err := peer.Decode(ds.RawKey(e.Key).BaseNamespace())
+		if err != nil {
+			log.Warningf("invalid peer score %s: %s", e.Key, err)
+			continue
+		}
+		c := new(Counters)
+		if err := json.Unmarshal(e.Value, c); err != nil {
+			log.Warningf("invalid peer score %s: %s", e.Key, err)
+			continue
+		}
+		t.peers[p] = c
+	}
+	return t, nil
+}
+
+// record adds to the counters of p with add.
+func (t *Tracker) record(p peer.ID, add func(c *Counters)) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.peers[p]
+	if !ok {
+		c = new(Counters)
+		t.peers[p] = c
+	}
+	c.decay(time.Now(), t.halfLife)
+	add(c)
+	t.dirty[p] = true
+}
+
+// DialFailed records a failed dial of p.
+func (t *Tracker) DialFailed(p peer.ID) {
+	t.record(p, func(c *Counters) { c.DialFailures++ })
+}
+
+// Misbehaved records a misbehavior of p.
+func (t *Tracker) Misbehaved(p peer.ID) {
+	t.record(p, func(c *Counters) { c.Misbehavior++ })
+}
+
+// BlockServed records a useful block received from p.
+func (t *Tracker) BlockServed(p peer.ID) {
+	t.record(p, func(c *Counters) { c.BlocksServed++ })
+}
+
+func (t *Tracker) latency(p peer.ID) time.Duration {
+	if t.ps == nil {
+		return 0
+	}
+	return t.ps.LatencyEWMA(p)
+}
+
+// Scores returns the scores of the peers with counters, highest first.
+func (t *Tracker) Scores() []Score {
+	now := time.Now()
+	t.mu.Lock()
+	out := make([]Score, 0, len(t.peers))
+	for p, c := range t.peers {
+		c.decay(now, t.halfLife)
+		out = append(out, Score{Peer: p, Counters: *c})
+	}
+	t.mu.Unlock()
+
+	for i := range out {
+		out[i].Latency = t.latency(out[i].Peer)
+		out[i].Score = score(out[i].Counters, out[i].Latency)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Peer < out[j].Peer
+	})
+	return out
+}
+
+// Score returns the score of p.
+func (t *Tracker) Score(p peer.ID) float64 {
+	t.mu.Lock()
+	var c Counters
+	if pc, ok := t.peers[p]; ok {
+		pc.decay(time.Now(), t.halfLife)
+		c = *pc
+	}
+	t.mu.Unlock()
+	return score(c, t.latency(p))
+}
+
+// Tag sets the score of peers as their tag on cm, rounded and bounded by
+// MaxTag.
+func (t *Tracker) Tag(cm connmgr.ConnManager, peers []peer.ID) {
+	max := float64(t.maxTag)
+	for _, p := range peers {
+		v := math.Max(-max, math.Min(max, math.Round(t.Score(p))))
+		if v == 0 {
+			cm.UntagPeer(p, Tag)
+			continue
+		}
+		cm.TagPeer(p, Tag, int(v))
+	}
+}
+
+// Flush saves the counters changed since the last flush, and forgets the
+// peers whose counters decayed to nothing.
+func (t *Tracker) Flush() error {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for p, c := range t.peers {
+		c.decay(now, t.halfLife)
+		if c.total() >= negligible {
+			continue
+		}
+		delete(t.peers, p)
+		delete(t.dirty, p)
+		if err := t.ds.Delete(scoreKey(p)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	for p := range t.dirty {
+		b, err := json.Marshal(t.peers[p])
+		if err != nil {
+			return err
+		}
+		if err := t.ds.Put(scoreKey(p), b); err != nil {
+			return err
+		}
+		delete(t.dirty, p)
+	}
+	return nil
+}
+
+// Run tags the connected peers of h with their score and saves the counters
+// every interval, until ctx is done.
+func (t *Tracker) Run(ctx context.Context, h host.Host) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if err := t.Flush(); err != nil {
+				log.Errorf("saving the peer scores: %s", err)
+			}
+			return
+		}
+
+		t.Tag(h.ConnManager(), h.Network().Peers())
+		t.expireWants(time.Now())
+		if err := t.Flush(); err != nil {
+			log.Errorf("saving the peer scores: %s", err)
+		}
+	}
+}
+
+func scoreKey(p peer.ID) ds.Key {
+	return prefix.ChildString(p.Pretty())
+}
+
+// Host wraps h to count the failed dials made through it. It is safe to call
+// on a nil Tracker, in which case h is returned as is.
+func (t *Tracker) Host(h host.Host) host.Host {
+	if t == nil {
+		return h
+	}
+	return &scoringHost{Host: h, t: t}
+}
+
+type scoringHost struct {
+	host.Host
+	t *Tracker
+}
+
+func (h *scoringHost) Connect(ctx context.Context, pi peer.AddrInfo) error {
+	dial := h.Network().Connectedness(pi.ID) != inet.Connected
+	err := h.Host.Connect(ctx, pi)
+	if dial && err != nil && ctx.Err() == nil {
+		h.t.DialFailed(pi.ID)
+	}
+	return err
+}
+
+func (h *scoringHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (inet.Stream, error) {
+	dial := h.Network().Connectedness(p) != inet.Connected
+	s, err := h.Host.NewStream(ctx, p, pids...)
+	if dial && err != nil && ctx.Err() == nil {
+		h.t.DialFailed(p)
+	}
+	return s, err
+}
+
+// wanted records the blocks asked of p in msg.
+func (t *Tracker) wanted(p peer.ID, msg bsmsg.BitSwapMessage) {
+	entries := msg.Wantlist()
+	if len(entries) == 0 {
+		return
+	}
+
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, e := range entries {
+		if e.Cancel {
+			// the block may already be on its way
+			continue
+		}
+		if t.wants[p] == nil {
+			t.wants[p] = make(map[cid.Cid]time.Time)
+		}
+		t.wants[p][e.Cid] = now
+	}
+}
+
+// received counts the blocks of msg as served by p if they were asked of p,
+// or as misbehavior if not.
+func (t *Tracker) received(p peer.ID, msg bsmsg.BitSwapMessage) {
+	for _, b := range msg.Blocks() {
+		t.mu.Lock()
+		_, ok := t.wants[p][b.Cid()]
+		delete(t.wants[p], b.Cid())
+		t.mu.Unlock()
+
+		if ok {
+			t.BlockServed(p)
+		} else {
+			t.Misbehaved(p)
+		}
+	}
+}
+
+// expireWants forgets the blocks asked for longer than wantTTL ago.
+func (t *Tracker) expireWants(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for p, wants := range t.wants {
+		for c, asked := range wants {
+			if now.Sub(asked) > wantTTL {
+				delete(wants, c)
+			}
+		}
+		if len(wants) == 0 {
+			delete(t.wants, p)
+		}
+	}
+}
+
+// Wrap returns a network recording the blocks asked of the peers and those
+// they send. It is safe to call on a nil Tracker, in which case net is
+// returned as is.
+func (t *Tracker) Wrap(net bsnet.BitSwapNetwork) bsnet.BitSwapNetwork {
+	if t == nil {
+		return net
+	}
+	return &network{BitSwapNetwork: net, t: t}
+}
+
+type network struct {
+	bsnet.BitSwapNetwork
+	t *Tracker
+}
+
+func (n *network) SendMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) error {
+	n.t.wanted(p, msg)
+	return n.BitSwapNetwork.SendMessage(ctx, p, msg)
+}
+
+func (n *network) NewMessageSender(ctx context.Context, p peer.ID) (bsnet.MessageSender, error) {
+	ms, err := n.BitSwapNetwork.NewMessageSender(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return &sender{MessageSender: ms, t: n.t, p: p}, nil
+}
+
+func (n *network) SetDelegate(r bsnet.Receiver) {
+	n.BitSwapNetwork.SetDelegate(&receiver{Receiver: r, t: n.t})
+}
+
+type sender struct {
+	bsnet.MessageSender
+	t *Tracker
+	p peer.ID
+}
+
+func (s *sender) SendMsg(ctx context.Context, msg bsmsg.BitSwapMessage) error {
+	s.t.wanted(s.p, msg)
+	return s.MessageSender.SendMsg(ctx, msg)
+}
+
+type receiver struct {
+	bsnet.Receiver
+	t *Tracker
+}
+
+func (r *receiver) ReceiveMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) {
+	r.t.received(p, msg)
+	r.Receiver.ReceiveMessage(ctx, p, msg)
+}
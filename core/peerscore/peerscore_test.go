@@ -0,0 +1,134 @@
+package peerscore
+
+import (
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	blocks "github.com/ipfs/go-block-format"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	connmgr "github.com/libp2p/go-libp2p-core/connmgr"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	testPeer  = "QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+	otherPeer = "QmSoLnSGccFuZQJzRadHn95W2CrSFmZuTdDWP8HXaHca9z"
+)
+
+type tagRecorder struct {
+	connmgr.NullConnMgr
+	tags map[peer.ID]int
+}
+
+func (r *tagRecorder) TagPeer(p peer.ID, tag string, v int) {
+	r.tags[p] = v
+}
+
+func (r *tagRecorder) UntagPeer(p peer.ID, tag string) {
+	delete(r.tags, p)
+}
+
+func TestScores(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	tr, err := New(d, nil, Config{Enabled: true, MaxTag: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := peer.Decode(testPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := peer.Decode(otherPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wanted := blocks.NewBlock([]byte("wanted"))
+	unsolicited := blocks.NewBlock([]byte("unsolicited"))
+	want := bsmsg.New(false)
+	want.AddEntry(wanted.Cid(), 1)
+	tr.wanted(p, want)
+
+	for _, b := range []blocks.Block{wanted, unsolicited} {
+		msg := bsmsg.New(false)
+		msg.AddBlock(b)
+		tr.received(p, msg)
+	}
+	msg := bsmsg.New(false)
+	msg.AddBlock(wanted)
+	tr.received(p, msg)
+	for i := 0; i < 3; i++ {
+		tr.BlockServed(other)
+	}
+	tr.DialFailed(other)
+
+	scores := tr.Scores()
+	if len(scores) != 2 || scores[0].Peer != other || scores[1].Peer != p {
+		t.Fatalf("unexpected scores %+v", scores)
+	}
+	// a block asked once is counted once, the others are misbehavior
+	if c := scores[1].Counters; !near(c.BlocksServed, 1) || !near(c.Misbehavior, 2) {
+		t.Fatalf("unexpected counters %+v", c)
+	}
+	if !near(scores[0].Score, 1) || !near(scores[1].Score, -19) {
+		t.Fatalf("unexpected scores %+v", scores)
+	}
+
+	// the tags are bounded by MaxTag
+	rec := &tagRecorder{tags: map[peer.ID]int{p: 5}}
+	tr.Tag(rec, []peer.ID{p, other})
+	if rec.tags[p] != -10 || rec.tags[other] != 1 {
+		t.Fatalf("unexpected tags %v", rec.tags)
+	}
+
+	// the counters are saved, and decay
+	if err := tr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	tr, err = New(d, nil, Config{Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.mu.Lock()
+	tr.peers[other].Updated = tr.peers[other].Updated.Add(-DefaultHalfLife)
+	tr.mu.Unlock()
+	if s := tr.Score(other); !near(s, 0.5) {
+		t.Fatalf("expected the score to be halved, got %f", s)
+	}
+
+	tr.mu.Lock()
+	tr.peers[other].Updated = tr.peers[other].Updated.Add(-100 * DefaultHalfLife)
+	tr.mu.Unlock()
+	if err := tr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := d.Has(scoreKey(other)); err != nil || has {
+		t.Fatalf("expected the decayed peer to be forgotten: %v", err)
+	}
+
+	// wants expire
+	tr.wanted(p, want)
+	tr.expireWants(time.Now().Add(wantTTL + time.Second))
+	if len(tr.wants) != 0 {
+		t.Fatal("expected the wants to expire")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	tr, err := New(ds.NewMapDatastore(), nil, Config{})
+	if err != nil || tr != nil {
+		t.Fatal("expected no tracker when disabled")
+	}
+	// the recording is safe on a nil tracker
+	tr.DialFailed("p")
+
+	if _, err := New(ds.NewMapDatastore(), nil, Config{Enabled: true, HalfLife: "-1h"}); err == nil {
+		t.Fatal("expected an invalid half-life to fail")
+	}
+}
+
+func near(a, b float64) bool {
+	return a-b < 1e-6 && b-a < 1e-6
+}
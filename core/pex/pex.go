@@ -0,0 +1,464 @@
+// Package pex implements peer exchange within private networks.
+//
+// The members of a private network gossip signed records of their addresses
+// to each other, so that a new node only needs to reach one member to find
+// all the others. Every round, and whenever a member connects, the node sends
+// the records it knows to each connected member of the network and receives
+// theirs. A record is signed with the key of the peer it describes, so a
+// member can't advertise wrong addresses for another one, and it expires
+// RecordTTL after it was signed. The node dials the members it learns of and
+// isn't connected to.
+//
+// Records are only exchanged with the peers connected over a private network,
+// and with several private networks, only within the network they were
+// received on.
+package pex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	addrbook "github.com/ipfs/go-ipfs/core/addrbook"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	logging "github.com/ipfs/go-log"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("pex")
+
+// ID is the protocol ID of the peer exchange protocol.
+const ID protocol.ID = "/ipfs/pex/1.0.0"
+
+// ConfigKey is the config key of the peer exchange section.
+const ConfigKey = "Swarm.PeerExchange"
+
+// DefaultInterval is the time between two rounds when none is configured.
+const DefaultInterval = time.Minute
+
+var (
+	// RecordTTL is how long a record is valid after it was signed.
+	RecordTTL = time.Hour
+
+	// MaxRecords bounds the records sent in an exchange.
+	MaxRecords = 256
+)
+
+// signPrefix separates the signatures of the records from other uses of the
+// keys.
+const signPrefix = "ipfs-pex-record:"
+
+// exchangeTimeout bounds an exchange with a peer.
+const exchangeTimeout = 30 * time.Second
+
+// maxMessageSize bounds the size of the messages read.
+const maxMessageSize = 1 << 20
+
+// maxDials bounds the members dialed at once.
+const maxDials = 8
+
+// Config configures peer exchange.
+type Config struct {
+	// Enabled exchanges peers with the members of the private network.
+	Enabled bool
+
+	// Interval is the time between two rounds, as a duration string.
+	Interval string
+}
+
+// LoadConfig reads the Swarm.PeerExchange section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// RoundInterval returns the configured interval, or DefaultInterval.
+func (c Config) RoundInterval() (time.Duration, error) {
+	if c.Interval == "" {
+		return DefaultInterval, nil
+	}
+	d, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("%s.Interval: %s", ConfigKey, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s.Interval must be positive", ConfigKey)
+	}
+	return d, nil
+}
+
+// Record is the signed addresses of a member.
+type Record struct {
+	Peer  string
+	Addrs []string
+	// Seq is the time the record was signed, in unix nanoseconds.
+	Seq    int64
+	PubKey []byte
+	Sig    []byte
+}
+
+type unsignedRecord struct {
+	Peer  string
+	Addrs []string
+	Seq   int64
+}
+
+func (r *Record) payload() ([]byte, error) {
+	b, err := json.Marshal(unsignedRecord{Peer: r.Peer, Addrs: r.Addrs, Seq: r.Seq})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(signPrefix), b...), nil
+}
+
+// expires returns when r expires.
+func (r *Record) expires() time.Time {
+	return time.Unix(0, r.Seq).Add(RecordTTL)
+}
+
+// signRecord creates the record of the peer of sk, at addrs.
+func signRecord(sk ci.PrivKey, addrs []ma.Multiaddr) (*Record, error) {
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := ci.MarshalPublicKey(sk.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Record{Peer: id.Pretty(), Seq: time.Now().UnixNano(), PubKey: pub}
+	for _, a := range addrs {
+		r.Addrs = append(r.Addrs, a.String())
+	}
+	payload, err := r.payload()
+	if err != nil {
+		return nil, err
+	}
+	if r.Sig, err = sk.Sign(payload); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// verify checks the signature of r, and returns its peer and addresses.
+func (r *Record) verify() (peer.ID, []ma.Multiaddr, error) {
+	id, err := peer.Decode(r.Peer)
+	if err != nil {
+		return "", nil, err
+	}
+	pub, err := ci.UnmarshalPublicKey(r.PubKey)
+	if err != nil {
+		return "", nil, err
+	}
+	if !id.MatchesPublicKey(pub) {
+		return "", nil, errors.New("the key doesn't match the peer")
+	}
+	payload, err := r.payload()
+	if err != nil {
+		return "", nil, err
+	}
+	if ok, err := pub.Verify(payload, r.Sig); err != nil || !ok {
+		return "", nil, errors.New("invalid signature")
+	}
+
+	addrs := make([]ma.Multiaddr, 0, len(r.Addrs))
+	for _, s := range r.Addrs {
+		a, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return "", nil, err
+		}
+		addrs = append(addrs, a)
+	}
+	return id, addrs, nil
+}
+
+// message is the records sent in an exchange.
+type message struct {
+	Records []*Record
+}
+
+type known struct {
+	rec     *Record
+	addrs   []ma.Multiaddr
+	network string
+}
+
+// NetworkFunc returns the private network of a connection, and false if it
+// isn't in a private network.
+type NetworkFunc func(c inet.Conn) (string, bool)
+
+// Service exchanges the records of the members of the private networks.
+type Service struct {
+	h        host.Host
+	sk       ci.PrivKey
+	network  NetworkFunc
+	interval time.Duration
+
+	ctx   context.Context
+	dials chan struct{}
+
+	mu      sync.Mutex
+	records map[peer.ID]known
+	dialing map[peer.ID]bool
+}
+
+// New creates a Service exchanging records over h, signed with sk, with the
+// peers for which network returns a private network. Start starts the
+// exchanges.
+func New(h host.Host, sk ci.PrivKey, network NetworkFunc, interval time.Duration) *Service {
+	return &Service{
+		h:        h,
+		sk:       sk,
+		network:  network,
+		interval: interval,
+		dials:    make(chan struct{}, maxDials),
+		records:  make(map[peer.ID]known),
+		dialing:  make(map[peer.ID]bool),
+	}
+}
+
+// Start handles the exchanges of the peers, and exchanges records with the
+// connected members every interval and when they connect, until ctx is done.
+func (s *Service) Start(ctx context.Context) {
+	s.ctx = ctx
+	s.h.SetStreamHandler(ID, s.handleStream)
+	s.h.Network().Notify((*notifiee)(s))
+	go s.loop(ctx)
+}
+
+// Close stops handling the exchanges.
+func (s *Service) Close() error {
+	s.h.RemoveStreamHandler(ID)
+	return nil
+}
+
+func (s *Service) loop(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		seen := make(map[peer.ID]bool)
+		for _, c := range s.h.Network().Conns() {
+			p := c.RemotePeer()
+			if seen[p] {
+				continue
+			}
+			if nw, ok := s.network(c); ok {
+				seen[p] = true
+				go s.exchange(ctx, p, nw)
+			}
+		}
+	}
+}
+
+// Peers returns the members learned from the other members, by network.
+func (s *Service) Peers() map[string][]peer.AddrInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(time.Now())
+
+	out := make(map[string][]peer.AddrInfo)
+	for p, k := range s.records {
+		out[k.network] = append(out[k.network], peer.AddrInfo{ID: p, Addrs: k.addrs})
+	}
+	return out
+}
+
+func (s *Service) expireLocked(now time.Time) {
+	for p, k := range s.records {
+		if now.After(k.rec.expires()) {
+			delete(s.records, p)
+		}
+	}
+}
+
+// outgoing returns the records to send to the members of network: the record
+// of the node, then the ones received on network, except the one of to.
+func (s *Service) outgoing(network string, to peer.ID) (*message, error) {
+	self, err := signRecord(s.sk, s.h.Addrs())
+	if err != nil {
+		return nil, err
+	}
+	msg := &message{Records: []*Record{self}}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(time.Now())
+	for p, k := range s.records {
+		if len(msg.Records) >= MaxRecords {
+			break
+		}
+		if k.network == network && p != to {
+			msg.Records = append(msg.Records, k.rec)
+		}
+	}
+	return msg, nil
+}
+
+// exchange sends the records of network to p, and takes its records.
+func (s *Service) exchange(ctx context.Context, p peer.ID, network string) {
+	ctx, cancel := context.WithTimeout(ctx, exchangeTimeout)
+	defer cancel()
+
+	msg, err := s.outgoing(network, p)
+	if err != nil {
+		log.Errorf("signing the peer record: %s", err)
+		return
+	}
+
+	st, err := s.h.NewStream(ctx, p, ID)
+	if err != nil {
+		log.Debugf("exchanging peers with %s: %s", p.Pretty(), err)
+		return
+	}
+	defer st.Close()
+	st.SetDeadline(time.Now().Add(exchangeTimeout))
+
+	var resp message
+	if err := json.NewEncoder(st).Encode(msg); err != nil {
+		st.Reset()
+		return
+	}
+	if err := json.NewDecoder(io.LimitReader(st, maxMessageSize)).Decode(&resp); err != nil {
+		st.Reset()
+		log.Debugf("exchanging peers with %s: %s", p.Pretty(), err)
+		return
+	}
+	s.take(ctx, network, &resp)
+}
+
+func (s *Service) handleStream(st inet.Stream) {
+	defer st.Close()
+	st.SetDeadline(time.Now().Add(exchangeTimeout))
+
+	c := st.Conn()
+	network, ok := s.network(c)
+	if !ok {
+		st.Reset()
+		return
+	}
+
+	var req message
+	if err := json.NewDecoder(io.LimitReader(st, maxMessageSize)).Decode(&req); err != nil {
+		st.Reset()
+		return
+	}
+	msg, err := s.outgoing(network, c.RemotePeer())
+	if err != nil {
+		log.Errorf("signing the peer record: %s", err)
+		st.Reset()
+		return
+	}
+	if err := json.NewEncoder(st).Encode(msg); err != nil {
+		st.Reset()
+		return
+	}
+	s.take(s.ctx, network, &req)
+}
+
+// take records the valid records of msg, received on network, and dials the
+// new members.
+func (s *Service) take(ctx context.Context, network string, msg *message) {
+	now := time.Now()
+	for i, r := range msg.Records {
+		if i == MaxRecords {
+			break
+		}
+		if now.After(r.expires()) {
+			continue
+		}
+		p, addrs, err := r.verify()
+		if err != nil {
+			log.Debugf("invalid peer record of %s: %s", r.Peer, err)
+			continue
+		}
+		if p == s.h.ID() {
+			continue
+		}
+
+		s.mu.Lock()
+		if k, ok := s.records[p]; ok && k.rec.Seq >= r.Seq {
+			s.mu.Unlock()
+			continue
+		}
+		s.records[p] = known{rec: r, addrs: addrs, network: network}
+		s.mu.Unlock()
+
+		if ab, ok := s.h.Peerstore().(*addrbook.Recorder); ok {
+			ab.MarkSigned(p, addrs, r.Sig)
+		}
+		s.h.Peerstore().AddAddrs(p, addrs, time.Until(r.expires()))
+		if s.h.Network().Connectedness(p) != inet.Connected {
+			s.dial(ctx, p)
+		}
+	}
+}
+
+// dial connects to p in the background.
+func (s *Service) dial(ctx context.Context, p peer.ID) {
+	s.mu.Lock()
+	if s.dialing[p] {
+		s.mu.Unlock()
+		return
+	}
+	s.dialing[p] = true
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.dialing, p)
+			s.mu.Unlock()
+		}()
+
+		select {
+		case s.dials <- struct{}{}:
+			defer func() { <-s.dials }()
+		case <-ctx.Done():
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, exchangeTimeout)
+		defer cancel()
+		if err := s.h.Connect(ctx, peer.AddrInfo{ID: p}); err != nil {
+			log.Debugf("connecting to member %s: %s", p.Pretty(), err)
+		}
+	}()
+}
+
+type notifiee Service
+
+// Connected exchanges records with the members the node dials; the members
+// dialing the node do the same.
+func (n *notifiee) Connected(_ inet.Network, c inet.Conn) {
+	s := (*Service)(n)
+	if c.Stat().Direction != inet.DirOutbound {
+		return
+	}
+	if nw, ok := s.network(c); ok {
+		go s.exchange(s.ctx, c.RemotePeer(), nw)
+	}
+}
+
+func (n *notifiee) Disconnected(inet.Network, inet.Conn)   {}
+func (n *notifiee) Listen(inet.Network, ma.Multiaddr)      {}
+func (n *notifiee) ListenClose(inet.Network, ma.Multiaddr) {}
+func (n *notifiee) OpenedStream(inet.Network, inet.Stream) {}
+func (n *notifiee) ClosedStream(inet.Network, inet.Stream) {}
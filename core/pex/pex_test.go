@@ -0,0 +1,94 @@
+package pex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	inet "github.com/libp2p/go-libp2p-core/network"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+func TestExchange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshLinked(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	member := func(inet.Conn) (string, bool) { return "default", true }
+	for _, h := range hosts {
+		New(h, h.Peerstore().PrivKey(h.ID()), member, time.Hour).Start(ctx)
+	}
+	a, b, c := hosts[0], hosts[1], hosts[2]
+
+	if _, err := mn.ConnectPeers(b.ID(), c.ID()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// a only knows b, and finds c through it
+	if _, err := mn.ConnectPeers(a.ID(), b.ID()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; a.Network().Connectedness(c.ID()) != inet.Connected; i++ {
+		if i == 100 {
+			t.Fatal("expected a to connect to c")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.WithNPeers(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, other := mn.Hosts()[0], mn.Hosts()[1]
+
+	r, err := signRecord(h.Peerstore().PrivKey(h.ID()), h.Addrs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, addrs, err := r.verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != h.ID() || len(addrs) != len(h.Addrs()) {
+		t.Fatal("expected the record to describe the host")
+	}
+
+	// a member can't advertise addresses for another one
+	forged := *r
+	forged.Addrs = []string{"/ip4/1.2.3.4/tcp/4001"}
+	if _, _, err := forged.verify(); err == nil {
+		t.Fatal("expected the changed record to be rejected")
+	}
+	forged = *r
+	forged.Peer = other.ID().Pretty()
+	if _, _, err := forged.verify(); err == nil {
+		t.Fatal("expected the record of another peer to be rejected")
+	}
+
+	// expired records are ignored
+	s := New(other, other.Peerstore().PrivKey(other.ID()), nil, time.Hour)
+	s.ctx = ctx
+	old, err := signRecord(h.Peerstore().PrivKey(h.ID()), h.Addrs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Seq = time.Now().Add(-2 * RecordTTL).UnixNano()
+	s.take(ctx, "default", &message{Records: []*Record{old}})
+	if len(s.Peers()) != 0 {
+		t.Fatal("expected the expired record to be ignored")
+	}
+	s.take(ctx, "default", &message{Records: []*Record{r}})
+	if len(s.Peers()["default"]) != 1 {
+		t.Fatal("expected the record to be taken")
+	}
+}
@@ -0,0 +1,245 @@
+// Package pinmeta stores a name and key/value metadata for the pins.
+//
+// The pinset format belongs to go-ipfs-pinner and has no room for them, so
+// they are kept in their own versioned namespace of the datastore, migrated
+// when the node starts. The pinner returned by Wrap keeps them in sync with
+// the pinset: they are removed with their pin and carried over by updates.
+package pinmeta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("pinmeta")
+
+// Version is the version of the format of the pin metadata.
+const Version = 1
+
+var (
+	prefix        = ds.NewKey("/local/pinmeta")
+	versionKey    = prefix.ChildString("version")
+	entriesPrefix = prefix.ChildString("pins")
+)
+
+// migrations[v] migrates the metadata from version v to version v+1.
+var migrations = []func(d ds.Datastore) error{
+	// version 0 is a repo from before pin metadata: there is nothing to
+	// convert, the namespace only has to be stamped
+	func(d ds.Datastore) error { return nil },
+}
+
+// Meta is the metadata of a pin.
+type Meta struct {
+	Name string            `json:",omitempty"`
+	Meta map[string]string `json:",omitempty"`
+
+	// Depth is set on the depth-limited pins: direct pins whose
+	// descendants are kept down to Depth levels below them.
+	Depth int `json:",omitempty"`
+}
+
+// IsEmpty returns whether m holds nothing.
+func (m Meta) IsEmpty() bool {
+	return m.Name == "" && len(m.Meta) == 0 && m.Depth == 0
+}
+
+// Store holds the metadata of the pins.
+type Store struct {
+	d  ds.Datastore
+	mu sync.Mutex
+}
+
+// Open returns the store of the metadata in d, migrating it to Version if
+// needed.
+func Open(d ds.Datastore) (*Store, error) {
+	v, err := version(d)
+	if err != nil {
+		return nil, err
+	}
+	if v > Version {
+		return nil, fmt.Errorf("the pin metadata has version %d, newer than the supported version %d: upgrade ipfs", v, Version)
+	}
+	for ; v < Version; v++ {
+		log.Infof("migrating the pin metadata from version %d to %d", v, v+1)
+		if err := migrations[v](d); err != nil {
+			return nil, fmt.Errorf("failed to migrate the pin metadata to version %d: %s", v+1, err)
+		}
+		if err := d.Put(versionKey, []byte(strconv.Itoa(v+1))); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{d: d}, nil
+}
+
+func version(d ds.Datastore) (int, error) {
+	b, err := d.Get(versionKey)
+	if err == ds.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.Atoi(string(b))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pin metadata version %q", b)
+	}
+	return v, nil
+}
+
+func entryKey(c cid.Cid) ds.Key {
+	return entriesPrefix.ChildString(c.String())
+}
+
+// Get returns the metadata of the pin of c, if any.
+func (s *Store) Get(c cid.Cid) (Meta, bool, error) {
+	var m Meta
+	b, err := s.d.Get(entryKey(c))
+	if err == ds.ErrNotFound {
+		return m, false, nil
+	}
+	if err != nil {
+		return m, false, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, false, err
+	}
+	return m, true, nil
+}
+
+// Set sets the metadata of the pin of c, or removes it if m is empty.
+func (s *Store) Set(c cid.Cid, m Meta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set(c, m)
+}
+
+func (s *Store) set(c cid.Cid, m Meta) error {
+	if m.IsEmpty() {
+		err := s.d.Delete(entryKey(c))
+		if err == ds.ErrNotFound {
+			err = nil
+		}
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return s.d.Put(entryKey(c), b)
+}
+
+// Delete removes the metadata of the pin of c.
+func (s *Store) Delete(c cid.Cid) error {
+	return s.Set(c, Meta{})
+}
+
+// Copy copies the metadata of the pin of from to the pin of to, and removes
+// it from the pin of from if move is set.
+func (s *Store) Copy(from, to cid.Cid, move bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok, err := s.Get(from)
+	if err != nil || !ok {
+		return err
+	}
+	if err := s.set(to, m); err != nil {
+		return err
+	}
+	if move && !from.Equals(to) {
+		return s.set(from, Meta{})
+	}
+	return nil
+}
+
+// All returns the metadata of every pin that has some.
+func (s *Store) All() (map[cid.Cid]Meta, error) {
+	res, err := s.d.Query(query.Query{Prefix: entriesPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	out := make(map[cid.Cid]Meta)
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		c, err := cid.Decode(ds.NewKey(r.Key).BaseNamespace())
+		if err != nil {
+			log.Warningf("ignoring pin metadata at %s: %s", r.Key, err)
+			continue
+		}
+		var m Meta
+		if err := json.Unmarshal(r.Value, &m); err != nil {
+			log.Warningf("ignoring pin metadata of %s: %s", c, err)
+			continue
+		}
+		out[c] = m
+	}
+	return out, nil
+}
+
+// Depths returns the depths of the depth-limited pins.
+func (s *Store) Depths() (map[cid.Cid]int, error) {
+	all, err := s.All()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[cid.Cid]int)
+	for c, m := range all {
+		if m.Depth > 0 {
+			out[c] = m.Depth
+		}
+	}
+	return out, nil
+}
+
+// pinner keeps the metadata of the pins in sync with the pinset.
+type pinner struct {
+	pin.Pinner
+	s *Store
+}
+
+// Wrap returns a pinner removing the metadata of the pins removed from p, and
+// carrying it over when a pin is updated.
+func Wrap(p pin.Pinner, s *Store) pin.Pinner {
+	return &pinner{Pinner: p, s: s}
+}
+
+// DepthPins returns the depths of the depth-limited pins, so that the garbage
+// collection keeps their descendants.
+func (p *pinner) DepthPins(ctx context.Context) (map[cid.Cid]int, error) {
+	return p.s.Depths()
+}
+
+func (p *pinner) Unpin(ctx context.Context, c cid.Cid, recursive bool) error {
+	if err := p.Pinner.Unpin(ctx, c, recursive); err != nil {
+		return err
+	}
+	return p.s.Delete(c)
+}
+
+func (p *pinner) RemovePinWithMode(c cid.Cid, mode pin.Mode) {
+	p.Pinner.RemovePinWithMode(c, mode)
+	if err := p.s.Delete(c); err != nil {
+		log.Errorf("failed to remove the metadata of the pin of %s: %s", c, err)
+	}
+}
+
+func (p *pinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error {
+	if err := p.Pinner.Update(ctx, from, to, unpin); err != nil {
+		return err
+	}
+	return p.s.Copy(from, to, unpin)
+}
@@ -0,0 +1,73 @@
+package pinmeta
+
+import (
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	u "github.com/ipfs/go-ipfs-util"
+)
+
+func testCid(s string) cid.Cid {
+	return cid.NewCidV0(u.Hash([]byte(s)))
+}
+
+func TestOpenMigrates(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	if _, err := Open(d); err != nil {
+		t.Fatal(err)
+	}
+	v, err := version(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != Version {
+		t.Fatalf("expected version %d, got %d", Version, v)
+	}
+
+	if err := d.Put(versionKey, []byte("1000")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(d); err == nil {
+		t.Fatal("expected a newer version to be refused")
+	}
+}
+
+func TestSetGetCopy(t *testing.T) {
+	s, err := Open(dssync.MutexWrap(ds.NewMapDatastore()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := testCid("a"), testCid("b")
+
+	m := Meta{Name: "photos", Meta: map[string]string{"owner": "alice"}}
+	if err := s.Set(a, m); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := s.Get(a)
+	if err != nil || !ok || got.Name != "photos" || got.Meta["owner"] != "alice" {
+		t.Fatalf("unexpected metadata %+v %v %v", got, ok, err)
+	}
+
+	if err := s.Copy(a, b, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.Get(a); ok {
+		t.Fatal("expected the metadata to be moved away")
+	}
+	all, err := s.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[b].Name != "photos" {
+		t.Fatalf("unexpected metadata %+v", all)
+	}
+
+	if err := s.Set(b, Meta{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.Get(b); ok {
+		t.Fatal("expected empty metadata to be removed")
+	}
+}
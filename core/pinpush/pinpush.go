@@ -0,0 +1,384 @@
+// Package pinpush pushes pins to the consenting peers of a private network.
+//
+// 'ipfs pin push' asks a remote peer to pin a DAG, then streams it the blocks
+// of the DAG directly, as a CAR file, instead of leaving it to fetch them
+// over bitswap. Once the blocks are stored, the remote peer pins the root
+// recursively and reports the result. This is a primitive for the manual
+// rebalancing of the content of a private network.
+//
+// A node only accepts the pushes of the peers listed in Pin.Push.AllowFrom,
+// and only on a private network.
+//
+// The pusher may ask for a receipt, which the remote peer signs once the DAG
+// is pinned, as the proof of its delivery.
+package pinpush
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core/addrbook"
+	"github.com/ipfs/go-ipfs/core/car"
+	"github.com/ipfs/go-ipfs/core/receipt"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+)
+
+var log = logging.Logger("pinpush")
+
+// ID is the protocol ID of the pin push protocol.
+const ID protocol.ID = "/ipfs/pin-push/1.0.0"
+
+// ConfigKey is the config key of the pin push section.
+const ConfigKey = "Pin.Push"
+
+// streamTimeout bounds the exchange of the request and of the result, and
+// idleTimeout the wait for the next bytes of the blocks.
+const (
+	streamTimeout = time.Minute
+	idleTimeout   = time.Minute
+)
+
+// pinTimeout bounds the pinning of a pushed DAG, which fetches the blocks
+// the pusher didn't send.
+const pinTimeout = 10 * time.Minute
+
+// maxMessageSize bounds the requests and results read from the stream.
+const maxMessageSize = 4 << 10
+
+// ErrNotAllowed is returned by Push when the remote peer doesn't accept the
+// pushes of the node.
+var ErrNotAllowed = errors.New("the peer doesn't accept pushes from this node")
+
+// Config holds the Pin.Push config section.
+type Config struct {
+	// AllowFrom are the peer IDs of the nodes allowed to push pins to this
+	// node.
+	AllowFrom []string
+}
+
+// LoadConfig reads the Pin.Push section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// request asks the remote peer to pin Cid, and to sign a receipt of it.
+type request struct {
+	Cid     cid.Cid
+	Receipt bool `json:",omitempty"`
+}
+
+// response accepts or refuses a request.
+type response struct {
+	Error string `json:",omitempty"`
+}
+
+// Result is the outcome of a push, as reported by the remote peer.
+type Result struct {
+	// Blocks and Bytes count the blocks received.
+	Blocks int
+	Bytes  int64
+
+	Pinned bool
+	Error  string `json:",omitempty"`
+
+	// Receipt is the receipt of the DAG pinned, if asked for.
+	Receipt *receipt.Receipt `json:",omitempty"`
+}
+
+// Progress counts the blocks sent by a push in progress. It is safe to read
+// while the push runs.
+type Progress struct {
+	blocks int64
+	bytes  int64
+}
+
+// Blocks returns the number of blocks sent.
+func (p *Progress) Blocks() int64 {
+	return atomic.LoadInt64(&p.blocks)
+}
+
+// Bytes returns the number of bytes sent, blocks and framing included.
+func (p *Progress) Bytes() int64 {
+	return atomic.LoadInt64(&p.bytes)
+}
+
+// Write counts the bytes written through p.
+func (p *Progress) Write(b []byte) (int, error) {
+	atomic.AddInt64(&p.bytes, int64(len(b)))
+	return len(b), nil
+}
+
+// countingGetter counts the nodes fetched in a Progress.
+type countingGetter struct {
+	ipld.NodeGetter
+	p *Progress
+}
+
+func (g countingGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	nd, err := g.NodeGetter.Get(ctx, c)
+	if err == nil {
+		atomic.AddInt64(&g.p.blocks, 1)
+	}
+	return nd, err
+}
+
+// writeMessage writes v to w as JSON, without the trailing newline of
+// json.Encoder, so that nothing follows it when the blocks come next.
+func writeMessage(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// idleReader reads from a stream, failing if no bytes come for idleTimeout.
+type idleReader struct {
+	s inet.Stream
+}
+
+func (r idleReader) Read(b []byte) (int, error) {
+	r.s.SetReadDeadline(time.Now().Add(idleTimeout))
+	return r.s.Read(b)
+}
+
+// Push asks the peer pi to pin the DAG of c, and sends it the blocks of the
+// DAG, read from ng. progress, if not nil, counts the blocks sent. With
+// wantReceipt, the peer must return a valid receipt of the DAG pinned.
+func Push(ctx context.Context, h host.Host, ng ipld.NodeGetter, pi peer.AddrInfo, c cid.Cid, progress *Progress, wantReceipt bool) (*Result, error) {
+	if progress == nil {
+		progress = new(Progress)
+	}
+
+	if len(pi.Addrs) > 0 {
+		if r, ok := h.Peerstore().(*addrbook.Recorder); ok {
+			r.Mark(pi.ID, pi.Addrs, addrbook.SourceManual)
+		}
+		if err := h.Connect(ctx, pi); err != nil {
+			return nil, err
+		}
+	}
+	str, err := h.NewStream(ctx, pi.ID, ID)
+	if err != nil {
+		return nil, err
+	}
+	defer str.Close()
+
+	// the context of the command interrupts the push
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			str.Reset()
+		case <-done:
+		}
+	}()
+
+	str.SetDeadline(time.Now().Add(streamTimeout))
+	if err := writeMessage(str, &request{Cid: c, Receipt: wantReceipt}); err != nil {
+		str.Reset()
+		return nil, err
+	}
+	dec := json.NewDecoder(io.LimitReader(str, maxMessageSize))
+	var resp response
+	if err := dec.Decode(&resp); err != nil {
+		str.Reset()
+		return nil, err
+	}
+	switch resp.Error {
+	case "":
+	case ErrNotAllowed.Error():
+		return nil, ErrNotAllowed
+	default:
+		return nil, errors.New(resp.Error)
+	}
+
+	str.SetDeadline(time.Time{})
+	w := io.MultiWriter(str, progress)
+	if err := car.Write(ctx, countingGetter{ng, progress}, []cid.Cid{c}, w); err != nil {
+		str.Reset()
+		return nil, err
+	}
+	// closing the stream for writing ends the blocks
+	if err := str.Close(); err != nil {
+		str.Reset()
+		return nil, err
+	}
+
+	// the peer pins the DAG before answering
+	str.SetReadDeadline(time.Now().Add(pinTimeout + streamTimeout))
+	var res Result
+	if err := json.NewDecoder(io.LimitReader(str, maxMessageSize)).Decode(&res); err != nil {
+		str.Reset()
+		return nil, fmt.Errorf("reading the result of the push: %s", err)
+	}
+	if res.Error != "" {
+		return &res, errors.New(res.Error)
+	}
+	if wantReceipt {
+		if err := checkReceipt(res.Receipt, c, h.ID(), pi.ID); err != nil {
+			return &res, err
+		}
+	}
+	return &res, nil
+}
+
+// checkReceipt checks that r is the receipt of the delivery of root by from
+// to p, signed by p.
+func checkReceipt(r *receipt.Receipt, root cid.Cid, from, p peer.ID) error {
+	if r == nil {
+		return errors.New("the peer returned no receipt")
+	}
+	if !r.Root.Equals(root) || r.From != from || r.Peer != p {
+		return errors.New("the peer returned the receipt of another transfer")
+	}
+	return r.Verify()
+}
+
+// Server accepts the pushes of the allowed peers.
+type Server struct {
+	host    host.Host
+	allowed map[peer.ID]struct{}
+
+	bs      bstore.Blockstore
+	dag     ipld.DAGService
+	pinning pin.Pinner
+	gcl     bstore.GCLocker
+}
+
+// NewServer handles the pin push protocol on h for the allowed peers,
+// storing the blocks pushed in bs and pinning them with pinning.
+func NewServer(h host.Host, allowed []peer.ID, bs bstore.Blockstore, dag ipld.DAGService, pinning pin.Pinner, gcl bstore.GCLocker) *Server {
+	s := &Server{
+		host:    h,
+		allowed: make(map[peer.ID]struct{}, len(allowed)),
+		bs:      bs,
+		dag:     dag,
+		pinning: pinning,
+		gcl:     gcl,
+	}
+	for _, p := range allowed {
+		s.allowed[p] = struct{}{}
+	}
+	h.SetStreamHandler(ID, s.handleStream)
+	return s
+}
+
+func (s *Server) handleStream(str inet.Stream) {
+	defer str.Close()
+
+	p := str.Conn().RemotePeer()
+	if _, ok := s.allowed[p]; !ok {
+		log.Warningf("peer %s is not allowed to push pins", p.Pretty())
+		str.SetDeadline(time.Now().Add(streamTimeout))
+		writeMessage(str, &response{Error: ErrNotAllowed.Error()})
+		return
+	}
+
+	str.SetDeadline(time.Now().Add(streamTimeout))
+	dec := json.NewDecoder(io.LimitReader(str, maxMessageSize))
+	var req request
+	if err := dec.Decode(&req); err != nil || !req.Cid.Defined() {
+		str.Reset()
+		return
+	}
+
+	// the blocks received are kept from the garbage collection until
+	// they are pinned
+	defer s.gcl.PinLock().Unlock()
+
+	if err := writeMessage(str, &response{}); err != nil {
+		str.Reset()
+		return
+	}
+	log.Infof("receiving the push of %s from %s", req.Cid, p.Pretty())
+
+	str.SetDeadline(time.Time{})
+	res := s.receive(req.Cid, io.MultiReader(dec.Buffered(), idleReader{str}))
+	if res.Error != "" {
+		log.Warningf("push of %s from %s failed: %s", req.Cid, p.Pretty(), res.Error)
+	}
+	if req.Receipt && res.Pinned {
+		r, err := receipt.Sign(s.host.Peerstore().PrivKey(s.host.ID()), req.Cid, p)
+		if err != nil {
+			log.Errorf("failed to sign the receipt of %s: %s", req.Cid, err)
+		}
+		res.Receipt = r
+	}
+
+	str.SetDeadline(time.Now().Add(streamTimeout))
+	if err := writeMessage(str, res); err != nil {
+		str.Reset()
+	}
+}
+
+// receive stores the blocks of the DAG of root read from r, then pins it.
+func (s *Server) receive(root cid.Cid, r io.Reader) *Result {
+	res := &Result{}
+	fail := func(err error) *Result {
+		res.Error = err.Error()
+		return res
+	}
+
+	cr, err := car.NewReader(r)
+	if err != nil {
+		return fail(err)
+	}
+	if len(cr.Header.Roots) != 1 || !cr.Header.Roots[0].Equals(root) {
+		return fail(fmt.Errorf("expected the blocks of %s", root))
+	}
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
+		if err := s.bs.Put(blk); err != nil {
+			return fail(err)
+		}
+		res.Blocks++
+		res.Bytes += int64(len(blk.RawData()))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pinTimeout)
+	defer cancel()
+	nd, err := s.dag.Get(ctx, root)
+	if err != nil {
+		return fail(err)
+	}
+	if err := s.pinning.Pin(ctx, nd, true); err != nil {
+		return fail(err)
+	}
+	if err := s.pinning.Flush(ctx); err != nil {
+		return fail(err)
+	}
+	res.Pinned = true
+	return res
+}
+
+// Close stops accepting pushes.
+func (s *Server) Close() error {
+	s.host.RemoveStreamHandler(ID)
+	return nil
+}
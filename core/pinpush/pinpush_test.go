@@ -0,0 +1,89 @@
+package pinpush
+
+import (
+	"context"
+	"testing"
+
+	bserv "github.com/ipfs/go-blockservice"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+func newStore() (bstore.Blockstore, ipld.DAGService, pin.Pinner) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewBlockstore(d)
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	return bs, dserv, pin.NewPinner(d, dserv, dserv)
+}
+
+func TestPush(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pusher, receiver, stranger := mn.Hosts()[0], mn.Hosts()[1], mn.Hosts()[2]
+
+	bs, dserv, pinner := newStore()
+	NewServer(receiver, []peer.ID{pusher.ID()}, bs, dserv, pinner, bstore.NewGCLocker())
+
+	_, local, _ := newStore()
+	leaf := dag.NodeWithData([]byte("leaf"))
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.AddMany(ctx, []ipld.Node{leaf, root}); err != nil {
+		t.Fatal(err)
+	}
+
+	progress := new(Progress)
+	res, err := Push(ctx, pusher, local, peer.AddrInfo{ID: receiver.ID()}, root.Cid(), progress, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Receipt == nil || res.Receipt.Peer != receiver.ID() || res.Receipt.From != pusher.ID() {
+		t.Fatalf("expected a receipt of the receiver, got %+v", res.Receipt)
+	}
+	if !res.Pinned || res.Blocks != 2 || res.Bytes != int64(len(leaf.RawData())+len(root.RawData())) {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if progress.Blocks() != 2 || progress.Bytes() <= res.Bytes {
+		t.Fatalf("unexpected progress: %d blocks, %d bytes", progress.Blocks(), progress.Bytes())
+	}
+	if _, pinned, err := pinner.IsPinnedWithType(ctx, root.Cid(), pin.Recursive); err != nil || !pinned {
+		t.Fatalf("expected the root to be pinned (%v)", err)
+	}
+	if has, err := bs.Has(leaf.Cid()); err != nil || !has {
+		t.Fatalf("expected the leaf to be stored (%v)", err)
+	}
+
+	if _, err := Push(ctx, stranger, local, peer.AddrInfo{ID: receiver.ID()}, root.Cid(), nil, false); err != ErrNotAllowed {
+		t.Fatalf("expected ErrNotAllowed, got %v", err)
+	}
+
+	// the pusher must have the whole DAG
+	missing := dag.NodeWithData([]byte("missing"))
+	partial := dag.NodeWithData([]byte("partial"))
+	if err := partial.AddNodeLink("missing", missing); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Add(ctx, partial); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Push(ctx, pusher, local, peer.AddrInfo{ID: receiver.ID()}, partial.Cid(), nil, true); err == nil {
+		t.Fatal("expected an error pushing an incomplete DAG")
+	}
+	if _, pinned, _ := pinner.IsPinned(ctx, partial.Cid()); pinned {
+		t.Fatal("expected the incomplete DAG not to be pinned")
+	}
+}
@@ -0,0 +1,272 @@
+// Package pnetinvite hands the private network swarm key to invited peers.
+//
+// A peer that doesn't have the swarm key can't connect to the nodes of a
+// private network. When enabled, a node of the network runs a second libp2p
+// host, which doesn't use the swarm key and only speaks the invite protocol.
+// The invite host has an ephemeral identity, so that it doesn't tie the peer
+// ID of the node to addresses outside of the private network.
+// An administrator creates a one-time token for the peer ID of the invited
+// peer; the invited peer then connects to that host with its own identity and
+// exchanges the token for the swarm key, over a libp2p connection which
+// authenticates both peers and encrypts the exchange.
+package pnetinvite
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("pnetinvite")
+
+// ID is the protocol ID of the invite protocol.
+const ID protocol.ID = "/ipfs/pnet-invite/1.0.0"
+
+// ConfigKey is the config key of the invite section.
+const ConfigKey = "Swarm.PNetInvite"
+
+// DefaultTTL is how long an invite is valid when no TTL is given.
+const DefaultTTL = 10 * time.Minute
+
+// streamTimeout bounds an invite exchange.
+const streamTimeout = time.Minute
+
+// maxTokenLen bounds the size of the token read from the stream.
+const maxTokenLen = 128
+
+// ErrInvalidInvite is returned to peers presenting an unknown, expired or
+// already used token, or a token issued for another peer.
+var ErrInvalidInvite = errors.New("invalid or expired invite")
+
+// Config holds the Swarm.PNetInvite config section.
+type Config struct {
+	// Enabled starts the invite host, on nodes of a private network.
+	Enabled bool
+
+	// ListenAddrs are the addresses of the invite host. They must differ
+	// from the swarm addresses.
+	ListenAddrs []string
+}
+
+// LoadConfig reads the Swarm.PNetInvite section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// response is sent back to the invited peer.
+type response struct {
+	// SwarmKey is the swarm key, in the swarm.key file format.
+	SwarmKey []byte `json:",omitempty"`
+
+	// Peers are the swarm addresses of the inviting node, to bootstrap
+	// from once in the private network.
+	Peers []string `json:",omitempty"`
+
+	Error string `json:",omitempty"`
+}
+
+type invite struct {
+	peer    peer.ID
+	expires time.Time
+}
+
+// Server runs the invite host and keeps the pending invites.
+type Server struct {
+	host     host.Host
+	swarmKey []byte
+	peers    func() []ma.Multiaddr
+
+	mu      sync.Mutex
+	invites map[string]invite
+}
+
+// NewServer starts an invite host with a new identity, listening on listen.
+// Invited peers receive swarmKey and the addresses returned by peers.
+func NewServer(ctx context.Context, listen []string, swarmKey []byte, peers func() []ma.Multiaddr) (*Server, error) {
+	if len(listen) == 0 {
+		return nil, fmt.Errorf("%s.ListenAddrs must not be empty", ConfigKey)
+	}
+
+	sk, _, err := ci.GenerateKeyPair(ci.Ed25519, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := libp2p.New(ctx,
+		libp2p.Identity(sk),
+		libp2p.ListenAddrStrings(listen...),
+		libp2p.DisableRelay(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the invite host: %s", err)
+	}
+
+	s := &Server{
+		host:     h,
+		swarmKey: swarmKey,
+		peers:    peers,
+		invites:  make(map[string]invite),
+	}
+	h.SetStreamHandler(ID, s.handleStream)
+	return s, nil
+}
+
+// Addrs returns the addresses invited peers must connect to, including the
+// peer ID of the invite host.
+func (s *Server) Addrs() []ma.Multiaddr {
+	addrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: s.host.ID(), Addrs: s.host.Addrs()})
+	if err != nil {
+		log.Errorf("failed to build invite addresses: %s", err)
+	}
+	return addrs
+}
+
+// Invite creates a one-time token allowing p to get the swarm key before ttl
+// elapses.
+func (s *Server) Invite(p peer.ID, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for t, inv := range s.invites {
+		if now.After(inv.expires) {
+			delete(s.invites, t)
+		}
+	}
+	s.invites[token] = invite{peer: p, expires: now.Add(ttl)}
+	return token, nil
+}
+
+// redeem consumes the token if it is valid for p.
+func (s *Server) redeem(p peer.ID, token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, ok := s.invites[token]
+	if !ok || inv.peer != p || time.Now().After(inv.expires) {
+		return false
+	}
+	delete(s.invites, token)
+	return true
+}
+
+func (s *Server) handleStream(str inet.Stream) {
+	defer str.Close()
+	str.SetDeadline(time.Now().Add(streamTimeout))
+
+	p := str.Conn().RemotePeer()
+	// a token without a newline within maxTokenLen bytes ends in io.EOF
+	token, err := bufio.NewReader(io.LimitReader(str, maxTokenLen+1)).ReadString('\n')
+	if err != nil {
+		str.Reset()
+		return
+	}
+
+	var resp response
+	if s.redeem(p, strings.TrimSpace(token)) {
+		log.Infof("peer %s joined the private network", p.Pretty())
+		resp.SwarmKey = s.swarmKey
+		for _, a := range s.peers() {
+			resp.Peers = append(resp.Peers, a.String())
+		}
+	} else {
+		log.Warningf("peer %s presented an invalid invite", p.Pretty())
+		resp.Error = ErrInvalidInvite.Error()
+	}
+
+	if err := json.NewEncoder(str).Encode(&resp); err != nil {
+		str.Reset()
+	}
+}
+
+// Close stops the invite host.
+func (s *Server) Close() error {
+	return s.host.Close()
+}
+
+// Join connects to the invite host at addr with identity sk, and exchanges
+// token for the swarm key. It returns the swarm key and the swarm addresses
+// of the inviting node.
+func Join(ctx context.Context, sk ci.PrivKey, addr ma.Multiaddr, token string) ([]byte, []peer.AddrInfo, error) {
+	pi, err := peer.AddrInfoFromP2pAddr(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h, err := libp2p.New(ctx,
+		libp2p.Identity(sk),
+		libp2p.NoListenAddrs,
+		libp2p.DisableRelay(),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer h.Close()
+
+	if err := h.Connect(ctx, *pi); err != nil {
+		return nil, nil, err
+	}
+	str, err := h.NewStream(ctx, pi.ID, ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer str.Close()
+	str.SetDeadline(time.Now().Add(streamTimeout))
+
+	if _, err := fmt.Fprintf(str, "%s\n", token); err != nil {
+		return nil, nil, err
+	}
+
+	var resp response
+	if err := json.NewDecoder(str).Decode(&resp); err != nil {
+		return nil, nil, err
+	}
+	if resp.Error != "" {
+		return nil, nil, errors.New(resp.Error)
+	}
+
+	var maddrs []ma.Multiaddr
+	for _, s := range resp.Peers {
+		a, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid peer address %q: %s", s, err)
+		}
+		maddrs = append(maddrs, a)
+	}
+	peers, err := peer.AddrInfosFromP2pAddrs(maddrs...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.SwarmKey, peers, nil
+}
@@ -0,0 +1,277 @@
+// Package pnetrouter lets a node participate in several private networks.
+//
+// Each private network configured under Swarm.PrivateNetworks has its own
+// swarm key and listen addresses. The Router is the private network protector
+// of the node: it selects the swarm key of every new connection from its
+// addresses, since the private network handshake doesn't tell which key the
+// remote peer uses. A connection belongs to a network if its remote address
+// is in one of the Peers ranges of the network, or else if its local address
+// is one of the ListenAddrs of the network. Other connections use the swarm
+// key of the repo, if any, and are not protected otherwise.
+//
+// Outbound connections reusing the port of a listen address have it as local
+// address, so the networks must be told apart by the Peers ranges when the
+// nodes of several networks dial each other.
+package pnetrouter
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	ipnet "github.com/libp2p/go-libp2p-core/pnet"
+	pnet "github.com/libp2p/go-libp2p-pnet"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+	mamask "github.com/whyrusleeping/multiaddr-filter"
+)
+
+// ConfigKey is the config key of the list of private networks.
+const ConfigKey = "Swarm.PrivateNetworks"
+
+// DefaultNetwork is the name of the network of the connections which belong
+// to no configured network.
+const DefaultNetwork = "default"
+
+// NetworkConfig configures a private network.
+type NetworkConfig struct {
+	// Name identifies the network.
+	Name string
+
+	// KeyFile is the path of the swarm key of the network, in the
+	// swarm.key format, relative to the repo.
+	KeyFile string
+
+	// ListenAddrs are the swarm addresses of the node in the network.
+	ListenAddrs []string
+
+	// Peers are the address ranges of the peers of the network, in the
+	// multiaddr-filter format, e.g. /ip4/10.1.0.0/ipcidr/16.
+	Peers []string
+}
+
+// LoadConfig reads the Swarm.PrivateNetworks section of the config of r.
+func LoadConfig(r repo.Repo) ([]NetworkConfig, error) {
+	var cfg []NetworkConfig
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// Network is a private network of the node.
+type Network struct {
+	Name        string
+	Fingerprint []byte
+	ListenAddrs []ma.Multiaddr
+
+	prot  ipnet.Protector
+	peers []*net.IPNet
+}
+
+// Router selects the private network of every connection.
+type Router struct {
+	def  ipnet.Protector
+	nets []*Network
+}
+
+// New creates a Router for the networks configured in cfgs, with their swarm
+// keys read relative to dir. def protects the connections belonging to no
+// network, and may be nil.
+func New(def ipnet.Protector, cfgs []NetworkConfig, dir string) (*Router, error) {
+	r := &Router{def: def}
+	names := map[string]bool{DefaultNetwork: true}
+	for _, cfg := range cfgs {
+		if cfg.Name == "" || names[cfg.Name] {
+			return nil, fmt.Errorf("%s: invalid or duplicate network name %q", ConfigKey, cfg.Name)
+		}
+		names[cfg.Name] = true
+
+		n, err := newNetwork(cfg, dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: network %s: %s", ConfigKey, cfg.Name, err)
+		}
+		r.nets = append(r.nets, n)
+	}
+	return r, nil
+}
+
+// Load creates a Router for the networks configured in r, with def for the
+// other connections. It returns nil if no network is configured.
+func Load(r repo.Repo, def ipnet.Protector) (*Router, error) {
+	cfgs, err := LoadConfig(r)
+	if err != nil || len(cfgs) == 0 {
+		return nil, err
+	}
+
+	dir := ""
+	if pr, ok := r.(interface{ Path() string }); ok {
+		dir = pr.Path()
+	}
+	return New(def, cfgs, dir)
+}
+
+func newNetwork(cfg NetworkConfig, dir string) (*Network, error) {
+	if cfg.KeyFile == "" {
+		return nil, fmt.Errorf("no KeyFile")
+	}
+	path := cfg.KeyFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	prot, err := pnet.NewProtector(bytes.NewReader(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid swarm key: %s", err)
+	}
+
+	n := &Network{
+		Name:        cfg.Name,
+		Fingerprint: prot.Fingerprint(),
+		prot:        prot,
+	}
+	for _, s := range cfg.ListenAddrs {
+		a, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, err
+		}
+		n.ListenAddrs = append(n.ListenAddrs, a)
+	}
+	for _, s := range cfg.Peers {
+		m, err := mamask.NewMask(s)
+		if err != nil {
+			return nil, err
+		}
+		n.peers = append(n.peers, m)
+	}
+	return n, nil
+}
+
+// Networks returns the configured networks.
+func (r *Router) Networks() []*Network {
+	if r == nil {
+		return nil
+	}
+	return r.nets
+}
+
+// ListenAddrs returns the listen addresses of all the networks.
+func (r *Router) ListenAddrs() []ma.Multiaddr {
+	var addrs []ma.Multiaddr
+	for _, n := range r.Networks() {
+		addrs = append(addrs, n.ListenAddrs...)
+	}
+	return addrs
+}
+
+// Network returns the network of a connection between local and remote, or
+// nil if it belongs to no configured network.
+func (r *Router) Network(local, remote ma.Multiaddr) *Network {
+	if r == nil {
+		return nil
+	}
+
+	if ip := addrIP(remote); ip != nil {
+		for _, n := range r.nets {
+			for _, m := range n.peers {
+				if m.Contains(ip) {
+					return n
+				}
+			}
+		}
+	}
+	for _, n := range r.nets {
+		for _, l := range n.ListenAddrs {
+			if listensOn(l, local) {
+				return n
+			}
+		}
+	}
+	return nil
+}
+
+// Protect protects c with the swarm key of its network.
+func (r *Router) Protect(c net.Conn) (net.Conn, error) {
+	local, remote, err := connAddrs(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if n := r.Network(local, remote); n != nil {
+		return n.prot.Protect(c)
+	}
+	if r.def != nil {
+		return r.def.Protect(c)
+	}
+	if ipnet.ForcePrivateNetwork {
+		return nil, ipnet.ErrNotInPrivateNetwork
+	}
+	return c, nil
+}
+
+// Fingerprint returns the fingerprint of the swarm key of the repo, or nil if
+// there is none.
+func (r *Router) Fingerprint() []byte {
+	if r.def == nil {
+		return nil
+	}
+	return r.def.Fingerprint()
+}
+
+// addrIP returns the IP of addr, or nil if it has none.
+func addrIP(addr ma.Multiaddr) net.IP {
+	na, err := manet.ToNetAddr(addr)
+	if err != nil {
+		return nil
+	}
+	switch na := na.(type) {
+	case *net.TCPAddr:
+		return na.IP
+	case *net.UDPAddr:
+		return na.IP
+	case *net.IPAddr:
+		return na.IP
+	default:
+		return nil
+	}
+}
+
+func connAddrs(c net.Conn) (local, remote ma.Multiaddr, err error) {
+	if mc, ok := c.(manet.Conn); ok {
+		return mc.LocalMultiaddr(), mc.RemoteMultiaddr(), nil
+	}
+	if local, err = manet.FromNetAddr(c.LocalAddr()); err != nil {
+		return nil, nil, err
+	}
+	if remote, err = manet.FromNetAddr(c.RemoteAddr()); err != nil {
+		return nil, nil, err
+	}
+	return local, remote, nil
+}
+
+// listensOn returns whether a connection with local address addr was accepted
+// on the listen address l: they are equal, or l has an unspecified IP and
+// the same transport and port.
+func listensOn(l, addr ma.Multiaddr) bool {
+	if l.Equal(addr) {
+		return true
+	}
+
+	lip, lrest := ma.SplitFirst(l)
+	aip, arest := ma.SplitFirst(addr)
+	if lip == nil || aip == nil || lrest == nil || arest == nil {
+		return false
+	}
+	if lip.Protocol().Code != aip.Protocol().Code {
+		return false
+	}
+	if !manet.IsIPUnspecified(lip) {
+		return false
+	}
+	return lrest.Equal(arest)
+}
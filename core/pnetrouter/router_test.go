@@ -0,0 +1,89 @@
+package pnetrouter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func writeKey(t *testing.T, dir, name, hex string) {
+	key := "/key/swarm/psk/1.0.0/\n/base16/\n" + hex + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(key), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pnetrouter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeKey(t, dir, "lab.key", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	writeKey(t, dir, "prod.key", "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210")
+
+	r, err := New(nil, []NetworkConfig{
+		{Name: "lab", KeyFile: "lab.key", ListenAddrs: []string{"/ip4/0.0.0.0/tcp/4101"}},
+		{Name: "prod", KeyFile: filepath.Join(dir, "prod.key"), ListenAddrs: []string{"/ip4/10.2.0.5/tcp/4001"}, Peers: []string{"/ip4/10.2.0.0/ipcidr/16"}},
+	}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nets := r.Networks()
+	if len(nets) != 2 || string(nets[0].Fingerprint) == string(nets[1].Fingerprint) {
+		t.Fatalf("expected 2 networks with different keys, got %v", nets)
+	}
+
+	cases := []struct {
+		local, remote string
+		network       string
+	}{
+		// accepted on the lab port of any interface
+		{"/ip4/192.168.1.2/tcp/4101", "/ip4/192.168.1.3/tcp/50000", "lab"},
+		// dialing a peer in the prod range, whatever the local port
+		{"/ip4/10.2.0.5/tcp/4101", "/ip4/10.2.3.4/tcp/4001", "prod"},
+		// accepted on the prod address
+		{"/ip4/10.2.0.5/tcp/4001", "/ip4/10.3.0.1/tcp/50000", "prod"},
+		// the prod port on another address
+		{"/ip4/10.9.0.5/tcp/4001", "/ip4/10.3.0.1/tcp/50000", ""},
+		{"/ip4/192.168.1.2/udp/4101/quic", "/ip4/192.168.1.3/udp/50000/quic", ""},
+		{"/ip4/192.168.1.2/tcp/4001", "/ip4/192.168.1.3/tcp/50000", ""},
+	}
+	for _, c := range cases {
+		n := r.Network(ma.StringCast(c.local), ma.StringCast(c.remote))
+		name := ""
+		if n != nil {
+			name = n.Name
+		}
+		if name != c.network {
+			t.Errorf("%s -> %s: expected network %q, got %q", c.local, c.remote, c.network, name)
+		}
+	}
+
+	if len(r.ListenAddrs()) != 2 {
+		t.Fatalf("expected 2 listen addresses, got %v", r.ListenAddrs())
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, cfgs := range [][]NetworkConfig{
+		{{Name: "", KeyFile: "x"}},
+		{{Name: DefaultNetwork, KeyFile: "x"}},
+		{{Name: "lab"}},
+		{{Name: "lab", KeyFile: "/nonexistent/lab.key"}},
+	} {
+		if _, err := New(nil, cfgs, ""); err == nil {
+			t.Errorf("expected %v to be rejected", cfgs)
+		}
+	}
+
+	var r *Router
+	if r.Network(ma.StringCast("/ip4/1.2.3.4/tcp/1"), ma.StringCast("/ip4/1.2.3.5/tcp/1")) != nil || r.ListenAddrs() != nil {
+		t.Fatal("expected a nil router to have no networks")
+	}
+}
@@ -0,0 +1,309 @@
+// Package provdiff announces, at most reprovides, only the blocks written
+// since the previous one.
+//
+// The blockstore returned by Tracker.Wrap records the blocks it didn't hold
+// yet. The writes belong to the current generation of the tracker, which each
+// reprovide ends: a reprovide announces the blocks of the generation ending,
+// rather than every block of the repo, which on an active node, such as one
+// updating a large files API tree, is mostly the blocks announced already.
+//
+// The records of the older blocks still expire from the routing system, so a
+// full reprovide runs every FullInterval. It also runs after a node stopped
+// without saving the blocks pending, and once too many blocks are pending.
+package provdiff
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs-provider/simple"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("provdiff")
+
+// ConfigKey is the config key of the diff reprovide section.
+const ConfigKey = "Reprovider.Diff"
+
+// DefaultFullInterval is the time between the full reprovides, below the
+// lifetime of the provider records of the DHT.
+const DefaultFullInterval = 12 * time.Hour
+
+// maxPending bounds the blocks pending; past it, the next reprovide is a
+// full one.
+const maxPending = 1 << 16
+
+var stateKey = ds.NewKey("/local/provdiff")
+
+// Config holds the Reprovider.Diff config section.
+type Config struct {
+	// Enabled announces only the new blocks at most reprovides.
+	Enabled bool
+
+	// FullInterval is the time between the full reprovides, as a duration
+	// string.
+	FullInterval string
+}
+
+// LoadConfig reads the Reprovider.Diff section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// state is what a tracker saves when the node stops.
+type state struct {
+	Generation uint64
+	LastFull   time.Time
+	Full       bool
+	Pending    []cid.Cid `json:",omitempty"`
+}
+
+// Tracker records the blocks written since the last reprovide.
+type Tracker struct {
+	d            ds.Datastore
+	fullInterval time.Duration
+
+	mu         sync.Mutex
+	generation uint64
+	pending    map[cid.Cid]struct{}
+	lastFull   time.Time
+	// full is set when the next reprovide must announce every block
+	full bool
+}
+
+// Open returns the tracker saved in d, or one whose first reprovide is a
+// full one if none was. The full reprovides run every fullInterval.
+func Open(d ds.Datastore, fullInterval time.Duration) (*Tracker, error) {
+	t := &Tracker{
+		d:            d,
+		fullInterval: fullInterval,
+		pending:      make(map[cid.Cid]struct{}),
+		full:         true,
+	}
+
+	data, err := d.Get(stateKey)
+	switch err {
+	case nil:
+		var st state
+		if err := json.Unmarshal(data, &st); err != nil {
+			log.Errorf("ignoring the invalid saved reprovide state: %s", err)
+			break
+		}
+		t.generation, t.lastFull, t.full = st.Generation, st.LastFull, st.Full
+		for _, c := range st.Pending {
+			t.pending[c] = struct{}{}
+		}
+	case ds.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	// the blocks pending are only known while the node runs
+	if err := d.Delete(stateKey); err != nil && err != ds.ErrNotFound {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Close saves the blocks pending in the datastore.
+func (t *Tracker) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st := state{Generation: t.generation, LastFull: t.lastFull, Full: t.full}
+	if !t.full {
+		st.Pending = make([]cid.Cid, 0, len(t.pending))
+		for c := range t.pending {
+			st.Pending = append(st.Pending, c)
+		}
+	}
+	data, err := json.Marshal(&st)
+	if err != nil {
+		return err
+	}
+	return t.d.Put(stateKey, data)
+}
+
+// Generation returns the number of reprovides the tracker ended.
+func (t *Tracker) Generation() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.generation
+}
+
+// record adds the new blocks ks to the current generation.
+func (t *Tracker) record(ks ...cid.Cid) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.full {
+		// the next reprovide announces them anyway
+		return
+	}
+	for _, k := range ks {
+		t.pending[k] = struct{}{}
+	}
+	if len(t.pending) > maxPending {
+		log.Infof("more than %d blocks written since the last reprovide, the next one is a full one", maxPending)
+		t.full = true
+		t.pending = make(map[cid.Cid]struct{})
+	}
+}
+
+// restore adds back the blocks a cancelled reprovide didn't announce.
+func (t *Tracker) restore(ks map[cid.Cid]struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.full {
+		return
+	}
+	for k := range ks {
+		t.pending[k] = struct{}{}
+	}
+}
+
+// KeyProvider returns the keys of the reprovides: the blocks written to bs
+// since the last one, or the keys of full when a full reprovide is due. If
+// t is nil, it returns full.
+func (t *Tracker) KeyProvider(full simple.KeyChanFunc, bs bstore.Blockstore) simple.KeyChanFunc {
+	if t == nil {
+		return full
+	}
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		t.mu.Lock()
+		if t.full || time.Since(t.lastFull) >= t.fullInterval {
+			// the blocks written from now on are pending again, whether
+			// the enumeration sees them or not
+			t.full = false
+			t.pending = make(map[cid.Cid]struct{})
+			t.lastFull = time.Now()
+			t.generation++
+			t.mu.Unlock()
+			return t.provideAll(ctx, full)
+		}
+		pending := t.pending
+		t.pending = make(map[cid.Cid]struct{})
+		t.generation++
+		t.mu.Unlock()
+
+		log.Debugf("reproviding the %d blocks written since the last reprovide", len(pending))
+		out := make(chan cid.Cid)
+		go func() {
+			defer close(out)
+			for k := range pending {
+				has, err := bs.Has(k)
+				if err != nil {
+					log.Errorf("reproviding %s: %s", k, err)
+					t.restore(pending)
+					return
+				}
+				if !has {
+					// removed since
+					delete(pending, k)
+					continue
+				}
+				select {
+				case out <- k:
+					delete(pending, k)
+				case <-ctx.Done():
+					t.restore(pending)
+					return
+				}
+			}
+		}()
+		return out, nil
+	}
+}
+
+// provideAll returns the keys of full, marking the next reprovide as a full
+// one if the enumeration doesn't complete.
+func (t *Tracker) provideAll(ctx context.Context, full simple.KeyChanFunc) (<-chan cid.Cid, error) {
+	failed := func() {
+		t.mu.Lock()
+		t.full = true
+		t.pending = make(map[cid.Cid]struct{})
+		t.mu.Unlock()
+	}
+
+	log.Debug("reproviding every block")
+	keys, err := full(ctx)
+	if err != nil {
+		failed()
+		return nil, err
+	}
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+		for k := range keys {
+			select {
+			case out <- k:
+			case <-ctx.Done():
+				failed()
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			// the enumeration was cut short
+			failed()
+		}
+	}()
+	return out, nil
+}
+
+// Wrap returns bs, recording the blocks written to it. If t is nil, it
+// returns bs.
+func (t *Tracker) Wrap(bs bstore.GCBlockstore) bstore.GCBlockstore {
+	if t == nil {
+		return bs
+	}
+	return &blockstore{GCBlockstore: bs, t: t}
+}
+
+type blockstore struct {
+	bstore.GCBlockstore
+	t *Tracker
+}
+
+func (bs *blockstore) Put(b blocks.Block) error {
+	has, err := bs.GCBlockstore.Has(b.Cid())
+	if err != nil {
+		return err
+	}
+	if err := bs.GCBlockstore.Put(b); err != nil {
+		return err
+	}
+	if !has {
+		bs.t.record(b.Cid())
+	}
+	return nil
+}
+
+func (bs *blockstore) PutMany(blks []blocks.Block) error {
+	var added []cid.Cid
+	for _, b := range blks {
+		has, err := bs.GCBlockstore.Has(b.Cid())
+		if err != nil {
+			return err
+		}
+		if !has {
+			added = append(added, b.Cid())
+		}
+	}
+	if err := bs.GCBlockstore.PutMany(blks); err != nil {
+		return err
+	}
+	bs.t.record(added...)
+	return nil
+}
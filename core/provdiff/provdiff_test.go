@@ -0,0 +1,132 @@
+package provdiff
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs-provider/simple"
+)
+
+func block(i int) blocks.Block {
+	return blocks.NewBlock([]byte(fmt.Sprintf("block %03d", i)))
+}
+
+func open(t *testing.T, d ds.Datastore) (*Tracker, bstore.GCBlockstore, simple.KeyChanFunc) {
+	tr, err := Open(d, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := tr.Wrap(bstore.NewGCBlockstore(bstore.NewBlockstore(d), bstore.NewGCLocker()))
+	return tr, bs, tr.KeyProvider(simple.NewBlockstoreProvider(bs), bs)
+}
+
+func expectKeys(t *testing.T, keys simple.KeyChanFunc, expected ...int) {
+	t.Helper()
+	ch, err := keys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[cid.Cid]struct{})
+	for k := range ch {
+		got[k] = struct{}{}
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d keys, got %d", len(expected), len(got))
+	}
+	for _, i := range expected {
+		if _, ok := got[block(i).Cid()]; !ok {
+			t.Fatalf("expected the key of block %d", i)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	tr, bs, keys := open(t, d)
+
+	if err := bs.PutMany([]blocks.Block{block(0), block(1)}); err != nil {
+		t.Fatal(err)
+	}
+	// the first reprovide is a full one
+	expectKeys(t, keys, 0, 1)
+
+	// then only the new blocks are announced
+	if err := bs.PutMany([]blocks.Block{block(1), block(2), block(3)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Put(block(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.DeleteBlock(block(3).Cid()); err != nil {
+		t.Fatal(err)
+	}
+	expectKeys(t, keys, 2, 4)
+	expectKeys(t, keys)
+	if g := tr.Generation(); g != 3 {
+		t.Fatalf("expected the generation 3, got %d", g)
+	}
+
+	// the blocks pending are saved on close
+	if err := bs.Put(block(5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tr, bs, keys = open(t, d)
+	expectKeys(t, keys, 5)
+
+	// without a clean close, the next reprovide is a full one
+	if err := bs.Put(block(6)); err != nil {
+		t.Fatal(err)
+	}
+	_, _, keys = open(t, d)
+	expectKeys(t, keys, 0, 1, 2, 4, 5, 6)
+
+	// as it is once the full interval elapsed
+	tr, _, keys = open(t, d)
+	tr.full = false
+	tr.lastFull = time.Now().Add(-2 * time.Hour)
+	expectKeys(t, keys, 0, 1, 2, 4, 5, 6)
+}
+
+func TestCancel(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	tr, bs, keys := open(t, d)
+	tr.full = false
+	tr.lastFull = time.Now()
+
+	if err := bs.PutMany([]blocks.Block{block(0), block(1), block(2)}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := keys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+	cancel()
+	n := 1
+	for range ch {
+		n++
+	}
+
+	// the blocks not announced are announced by the next reprovide
+	ch, err = keys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range ch {
+		n++
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 keys in all, got %d", n)
+	}
+}
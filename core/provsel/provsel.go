@@ -0,0 +1,340 @@
+// Package provsel selects the providers bitswap fetches blocks from.
+//
+// Bitswap connects to the providers of a block in the order the routing
+// finds them. The network returned by Wrap collects the providers found
+// during CollectWindow instead, ranks them by expected fetch time, and hands
+// the best Fanout ones to bitswap first, the others after FallbackDelay if the
+// query is still running. The expected fetch time of a peer is its measured
+// latency plus the time to transfer a block at its measured bandwidth,
+// weighted by the share of blocks it served out of the dials and sends to it.
+//
+// Peers given to Prefer are handed to bitswap before any other provider, for
+// as long as the preference is held. Peers given to Depart, which announced
+// they are going away, are ranked last.
+package provsel
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	cid "github.com/ipfs/go-cid"
+	metrics "github.com/libp2p/go-libp2p-core/metrics"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pstore "github.com/libp2p/go-libp2p-core/peerstore"
+)
+
+var (
+	// CollectWindow is how long providers are collected before being
+	// ranked.
+	CollectWindow = 100 * time.Millisecond
+
+	// Fanout is the number of ranked providers handed to bitswap at once.
+	Fanout = 3
+
+	// FallbackDelay is how long the other providers are held back.
+	FallbackDelay = time.Second
+)
+
+// unknownLatency is assumed for peers without a latency measurement.
+const unknownLatency = 500 * time.Millisecond
+
+// blockSize is the block size used to estimate transfer times.
+const blockSize = 256 << 10
+
+// PeerStats are the fetch statistics of a provider.
+type PeerStats struct {
+	// Blocks and Bytes count the blocks received from the peer.
+	Blocks uint64
+	Bytes  uint64
+
+	// Failures counts the failed dials and sends to the peer.
+	Failures uint64
+}
+
+// Selector ranks providers, and keeps their statistics.
+type Selector struct {
+	ps  pstore.Peerstore
+	bwc metrics.Reporter
+
+	mu        sync.Mutex
+	stats     map[peer.ID]*PeerStats
+	preferred map[peer.ID]int
+	departing map[peer.ID]time.Time
+}
+
+// New creates a Selector measuring latencies with ps and bandwidths with
+// bwc, which may be nil.
+func New(ps pstore.Peerstore, bwc metrics.Reporter) *Selector {
+	return &Selector{
+		ps:        ps,
+		bwc:       bwc,
+		stats:     make(map[peer.ID]*PeerStats),
+		preferred: make(map[peer.ID]int),
+		departing: make(map[peer.ID]time.Time),
+	}
+}
+
+// Prefer hands peers to bitswap before the other providers of every block,
+// until release is called.
+func (s *Selector) Prefer(peers []peer.ID) (release func()) {
+	if s == nil || len(peers) == 0 {
+		return func() {}
+	}
+
+	s.mu.Lock()
+	for _, p := range peers {
+		s.preferred[p]++
+	}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for _, p := range peers {
+				if s.preferred[p]--; s.preferred[p] <= 0 {
+					delete(s.preferred, p)
+				}
+			}
+		})
+	}
+}
+
+// Depart ranks p after the other providers for timeout, as it is going away.
+func (s *Selector) Depart(p peer.ID, timeout time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for dp, until := range s.departing {
+		if now.After(until) {
+			delete(s.departing, dp)
+		}
+	}
+	s.departing[p] = now.Add(timeout)
+}
+
+// Stats returns the statistics of the providers.
+func (s *Selector) Stats() map[peer.ID]PeerStats {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[peer.ID]PeerStats, len(s.stats))
+	for p, st := range s.stats {
+		out[p] = *st
+	}
+	return out
+}
+
+func (s *Selector) preferredPeers() []peer.ID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]peer.ID, 0, len(s.preferred))
+	for p := range s.preferred {
+		out = append(out, p)
+	}
+	return out
+}
+
+// statsLocked returns the statistics of p, creating them if needed.
+func (s *Selector) statsLocked(p peer.ID) *PeerStats {
+	st, ok := s.stats[p]
+	if !ok {
+		st = &PeerStats{}
+		s.stats[p] = st
+	}
+	return st
+}
+
+func (s *Selector) received(p peer.ID, msg bsmsg.BitSwapMessage) {
+	blks := msg.Blocks()
+	if len(blks) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.statsLocked(p)
+	for _, b := range blks {
+		st.Blocks++
+		st.Bytes += uint64(len(b.RawData()))
+	}
+}
+
+func (s *Selector) failed(p peer.ID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statsLocked(p).Failures++
+}
+
+// cost is the expected time to fetch a block from p.
+func (s *Selector) cost(p peer.ID) float64 {
+	if until, ok := s.departing[p]; ok && time.Now().Before(until) {
+		return math.Inf(1)
+	}
+
+	t := s.ps.LatencyEWMA(p)
+	if t == 0 {
+		t = unknownLatency
+	}
+	if s.bwc != nil {
+		if rate := s.bwc.GetBandwidthForPeer(p).RateIn; rate > 0 {
+			t += time.Duration(blockSize / rate * float64(time.Second))
+		}
+	}
+
+	var st PeerStats
+	if pst, ok := s.stats[p]; ok {
+		st = *pst
+	}
+	// smoothed share of blocks served, so new peers aren't penalized
+	success := float64(st.Blocks+1) / float64(st.Blocks+st.Failures+2)
+	return float64(t) / success
+}
+
+// rank sorts peers by increasing cost.
+func (s *Selector) rank(peers []peer.ID) {
+	s.mu.Lock()
+	costs := make(map[peer.ID]float64, len(peers))
+	for _, p := range peers {
+		costs[p] = s.cost(p)
+	}
+	s.mu.Unlock()
+
+	sort.SliceStable(peers, func(i, j int) bool {
+		return costs[peers[i]] < costs[peers[j]]
+	})
+}
+
+// Wrap returns a network ranking the providers found by net, and recording
+// the statistics of the peers. It is safe to call on a nil Selector, in which
+// case net is returned as is.
+func (s *Selector) Wrap(net bsnet.BitSwapNetwork) bsnet.BitSwapNetwork {
+	if s == nil {
+		return net
+	}
+	return &network{BitSwapNetwork: net, s: s}
+}
+
+type network struct {
+	bsnet.BitSwapNetwork
+	s *Selector
+}
+
+func (n *network) SetDelegate(r bsnet.Receiver) {
+	n.BitSwapNetwork.SetDelegate(&receiver{Receiver: r, s: n.s})
+}
+
+func (n *network) ConnectTo(ctx context.Context, p peer.ID) error {
+	err := n.BitSwapNetwork.ConnectTo(ctx, p)
+	if err != nil && ctx.Err() == nil {
+		n.s.failed(p)
+	}
+	return err
+}
+
+func (n *network) SendMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) error {
+	err := n.BitSwapNetwork.SendMessage(ctx, p, msg)
+	if err != nil && ctx.Err() == nil {
+		n.s.failed(p)
+	}
+	return err
+}
+
+// FindProvidersAsync hands the preferred peers first, then the providers
+// found during CollectWindow, best first, holding all but Fanout of them back
+// for FallbackDelay, then the providers found later as they come.
+func (n *network) FindProvidersAsync(ctx context.Context, k cid.Cid, max int) <-chan peer.ID {
+	in := n.BitSwapNetwork.FindProvidersAsync(ctx, k, max)
+	out := make(chan peer.ID)
+
+	go func() {
+		defer close(out)
+		// don't leave the routing blocked on in
+		defer func() {
+			for range in {
+			}
+		}()
+
+		sent := make(map[peer.ID]bool)
+		emit := func(p peer.ID) bool {
+			if sent[p] {
+				return true
+			}
+			sent[p] = true
+			select {
+			case out <- p:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for _, p := range n.s.preferredPeers() {
+			if !emit(p) {
+				return
+			}
+		}
+
+		var found []peer.ID
+		timer := time.NewTimer(CollectWindow)
+		defer timer.Stop()
+	collect:
+		for len(found) < max {
+			select {
+			case p, ok := <-in:
+				if !ok {
+					break collect
+				}
+				found = append(found, p)
+			case <-timer.C:
+				break collect
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		n.s.rank(found)
+		for i, p := range found {
+			if i == Fanout {
+				select {
+				case <-time.After(FallbackDelay):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if !emit(p) {
+				return
+			}
+		}
+
+		for p := range in {
+			if !emit(p) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+type receiver struct {
+	bsnet.Receiver
+	s *Selector
+}
+
+func (r *receiver) ReceiveMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) {
+	r.s.received(p, msg)
+	r.Receiver.ReceiveMessage(ctx, p, msg)
+}
@@ -0,0 +1,100 @@
+package provsel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	bsnet "github.com/ipfs/go-bitswap/network"
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-peerstore/pstoremem"
+)
+
+type fakeNetwork struct {
+	bsnet.BitSwapNetwork
+	providers []peer.ID
+	down      map[peer.ID]bool
+}
+
+func (n *fakeNetwork) FindProvidersAsync(ctx context.Context, k cid.Cid, max int) <-chan peer.ID {
+	out := make(chan peer.ID, len(n.providers))
+	for _, p := range n.providers {
+		out <- p
+	}
+	close(out)
+	return out
+}
+
+func (n *fakeNetwork) ConnectTo(ctx context.Context, p peer.ID) error {
+	if n.down[p] {
+		return errors.New("dial failed")
+	}
+	return nil
+}
+
+func collect(ch <-chan peer.ID) []peer.ID {
+	var out []peer.ID
+	for p := range ch {
+		out = append(out, p)
+	}
+	return out
+}
+
+func TestRanking(t *testing.T) {
+	defer func(fanout int, delay time.Duration) {
+		Fanout, FallbackDelay = fanout, delay
+	}(Fanout, FallbackDelay)
+	Fanout, FallbackDelay = 1, 10*time.Millisecond
+
+	ps := pstoremem.NewPeerstore()
+	slow, fast, flaky, unknown := peer.ID("slow"), peer.ID("fast"), peer.ID("flaky"), peer.ID("unknown")
+	ps.RecordLatency(slow, 800*time.Millisecond)
+	ps.RecordLatency(fast, 10*time.Millisecond)
+	ps.RecordLatency(flaky, 5*time.Millisecond)
+
+	s := New(ps, nil)
+	fn := &fakeNetwork{
+		providers: []peer.ID{slow, unknown, flaky, fast},
+		down:      map[peer.ID]bool{flaky: true},
+	}
+	net := s.Wrap(fn)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := net.ConnectTo(ctx, flaky); err == nil {
+			t.Fatal("expected the dial to fail")
+		}
+	}
+	if st := s.Stats()[flaky]; st.Failures != 3 {
+		t.Fatalf("expected 3 failures, got %+v", st)
+	}
+
+	got := collect(net.FindProvidersAsync(ctx, cid.Cid{}, 10))
+	want := []peer.ID{fast, flaky, unknown, slow}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+
+	release := s.Prefer([]peer.ID{slow})
+	got = collect(net.FindProvidersAsync(ctx, cid.Cid{}, 10))
+	if len(got) != 4 || got[0] != slow {
+		t.Fatalf("expected the preferred peer first, got %v", got)
+	}
+	release()
+	if len(s.preferredPeers()) != 0 {
+		t.Fatal("expected the preference to be released")
+	}
+
+	s.Depart(fast, time.Minute)
+	got = collect(net.FindProvidersAsync(ctx, cid.Cid{}, 10))
+	if len(got) != 4 || got[0] != flaky || got[3] != fast {
+		t.Fatalf("expected the departing peer last, got %v", got)
+	}
+}
@@ -0,0 +1,475 @@
+// Package qos shares the bandwidth the node serves content with between
+// classes of peers, so that the replication partners of the node are served
+// before the peers merely leeching from it.
+//
+// A peer belongs to the first class listing its ID, or else to the first
+// class listing one of the tags the connection manager holds for it, or else
+// to the default class. The blocks bitswap sends to a peer wait for the
+// scheduler, which lets the node send QoS.Bandwidth bytes per second at most.
+// When sends wait, the scheduler first serves the classes which got less
+// than their share of the recent traffic, then the others by priority: the
+// share of a class is the bandwidth it is guaranteed when it has blocks to
+// send, and the rest goes to the classes of the highest priority.
+//
+// The responses of the gateway are served in the class QoS.Gateway, and the
+// requests of the gateways federated with the node, which fetch the blocks
+// it is the origin of, in the class QoS.Federated.
+package qos
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	humanize "github.com/dustin/go-humanize"
+	logging "github.com/ipfs/go-log"
+	connmgr "github.com/libp2p/go-libp2p-core/connmgr"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+var log = logging.Logger("qos")
+
+// ConfigKey is the config key of the QoS section.
+const ConfigKey = "QoS"
+
+// DefaultClass is the name of the class of the peers in no class, unless
+// QoS.Default names another one.
+const DefaultClass = "default"
+
+const (
+	// usageHalfLife is the half-life of the traffic the shares of the
+	// classes are measured against.
+	usageHalfLife = 10 * time.Second
+
+	// classTTL is how long the class of a peer is cached, as its tags
+	// change.
+	classTTL = 10 * time.Second
+
+	// maxCachedPeers bounds the classes of the peers cached.
+	maxCachedPeers = 4096
+)
+
+// ClassConfig is a class of the QoS section.
+type ClassConfig struct {
+	Name string
+
+	// Priority orders the classes served once every class got its share,
+	// the highest first.
+	Priority int
+
+	// Share is the fraction of the bandwidth guaranteed to the class, from
+	// 0 to 1.
+	Share float64
+
+	// Peers and Tags select the peers of the class, by ID and by the tags
+	// of the connection manager.
+	Peers []string
+	Tags  []string
+}
+
+// Config holds the QoS config section.
+type Config struct {
+	// Bandwidth is the rate the node serves at, in bytes per second, e.g.
+	// "10MB". The classes only apply when it is set.
+	Bandwidth string
+
+	Classes []ClassConfig
+
+	// Default, Gateway and Federated are the classes of the peers in no
+	// class, of the responses of the gateway, and of the requests of the
+	// federated gateways. Gateway and Federated default to Default.
+	Default   string
+	Gateway   string
+	Federated string
+}
+
+// LoadConfig reads the QoS section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// ClassStats are the statistics of a class.
+type ClassStats struct {
+	Name     string
+	Priority int
+	Share    float64
+
+	// Usage is the fraction of the recent traffic the class got.
+	Usage float64
+
+	BytesSent uint64
+
+	// Waits is the number of sends which waited for the scheduler, and
+	// WaitTime how long they waited in total.
+	Waits    uint64
+	WaitTime time.Duration
+}
+
+type class struct {
+	name     string
+	priority int
+	share    float64
+
+	// under the lock of the scheduler
+	usage    float64
+	sent     uint64
+	waits    uint64
+	waitTime time.Duration
+}
+
+type cachedClass struct {
+	c       *class
+	expires time.Time
+}
+
+// waiter is a send waiting for the scheduler.
+type waiter struct {
+	c       *class
+	n       int
+	seq     uint64
+	granted bool
+	ready   chan struct{}
+}
+
+// Scheduler shares the bandwidth between the classes.
+type Scheduler struct {
+	rate    float64
+	classes []*class
+	byPeer  map[peer.ID]*class
+	byTag   []tagClass
+	def     *class
+	gateway *class
+	fed     *class
+	cm      connmgr.ConnManager
+
+	mu      sync.Mutex
+	tokens  float64
+	last    time.Time
+	waiting []*waiter
+	seq     uint64
+	timer   *time.Timer
+	cache   map[peer.ID]cachedClass
+}
+
+type tagClass struct {
+	tag string
+	c   *class
+}
+
+// New returns the scheduler configured by cfg, or nil if cfg sets no
+// bandwidth. The tags of the peers are read from cm, if not nil.
+func New(cfg Config, cm connmgr.ConnManager) (*Scheduler, error) {
+	if cfg.Bandwidth == "" {
+		if len(cfg.Classes) > 0 {
+			return nil, fmt.Errorf("%s.Classes require %s.Bandwidth", ConfigKey, ConfigKey)
+		}
+		return nil, nil
+	}
+	rate, err := humanize.ParseBytes(cfg.Bandwidth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s.Bandwidth: %s", ConfigKey, err)
+	}
+	if rate == 0 {
+		return nil, fmt.Errorf("invalid %s.Bandwidth: must be positive", ConfigKey)
+	}
+
+	s := &Scheduler{
+		rate:   float64(rate),
+		byPeer: make(map[peer.ID]*class),
+		cm:     cm,
+		tokens: float64(rate),
+		last:   time.Now(),
+		cache:  make(map[peer.ID]cachedClass),
+	}
+
+	byName := make(map[string]*class)
+	total := 0.0
+	for _, cc := range cfg.Classes {
+		if cc.Name == "" {
+			return nil, fmt.Errorf("%s.Classes: a class has no name", ConfigKey)
+		}
+		if _, ok := byName[cc.Name]; ok {
+			return nil, fmt.Errorf("%s.Classes: duplicate class %q", ConfigKey, cc.Name)
+		}
+		if cc.Share < 0 || cc.Share > 1 {
+			return nil, fmt.Errorf("%s.Classes: the share of %q must be between 0 and 1", ConfigKey, cc.Name)
+		}
+		total += cc.Share
+
+		c := &class{name: cc.Name, priority: cc.Priority, share: cc.Share}
+		byName[cc.Name] = c
+		s.classes = append(s.classes, c)
+
+		for _, id := range cc.Peers {
+			p, err := peer.Decode(id)
+			if err != nil {
+				return nil, fmt.Errorf("%s.Classes: invalid peer ID %q in %q: %s", ConfigKey, id, cc.Name, err)
+			}
+			if _, ok := s.byPeer[p]; !ok {
+				s.byPeer[p] = c
+			}
+		}
+		for _, tag := range cc.Tags {
+			s.byTag = append(s.byTag, tagClass{tag: tag, c: c})
+		}
+	}
+	if total > 1 {
+		return nil, fmt.Errorf("%s.Classes: the shares add up to %g, more than 1", ConfigKey, total)
+	}
+
+	lookup := func(key, name string, def *class) (*class, error) {
+		if name == "" {
+			return def, nil
+		}
+		c, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("%s.%s: unknown class %q", ConfigKey, key, name)
+		}
+		return c, nil
+	}
+	if cfg.Default == "" || cfg.Default == DefaultClass {
+		if s.def = byName[DefaultClass]; s.def == nil {
+			s.def = &class{name: DefaultClass}
+			s.classes = append(s.classes, s.def)
+		}
+	} else if s.def, err = lookup("Default", cfg.Default, nil); err != nil {
+		return nil, err
+	}
+	if s.gateway, err = lookup("Gateway", cfg.Gateway, s.def); err != nil {
+		return nil, err
+	}
+	if s.fed, err = lookup("Federated", cfg.Federated, s.def); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Class returns the name of the class of p.
+func (s *Scheduler) Class(p peer.ID) string {
+	return s.classOf(p).name
+}
+
+func (s *Scheduler) classOf(p peer.ID) *class {
+	if c, ok := s.byPeer[p]; ok {
+		return c
+	}
+	if len(s.byTag) == 0 || s.cm == nil {
+		return s.def
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	cached, ok := s.cache[p]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.c
+	}
+
+	c := s.def
+	if info := s.cm.GetTagInfo(p); info != nil {
+		for _, tc := range s.byTag {
+			if _, ok := info.Tags[tc.tag]; ok {
+				c = tc.c
+				break
+			}
+		}
+	}
+
+	s.mu.Lock()
+	if len(s.cache) >= maxCachedPeers {
+		for p, cached := range s.cache {
+			if !now.Before(cached.expires) {
+				delete(s.cache, p)
+			}
+		}
+	}
+	if len(s.cache) < maxCachedPeers {
+		s.cache[p] = cachedClass{c: c, expires: now.Add(classTTL)}
+	}
+	s.mu.Unlock()
+	return c
+}
+
+// Classes returns the statistics of the classes, in the order of the config.
+func (s *Scheduler) Classes() []ClassStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refill(time.Now())
+
+	total := 0.0
+	for _, c := range s.classes {
+		total += c.usage
+	}
+	out := make([]ClassStats, 0, len(s.classes))
+	for _, c := range s.classes {
+		st := ClassStats{
+			Name:      c.name,
+			Priority:  c.priority,
+			Share:     c.share,
+			BytesSent: c.sent,
+			Waits:     c.waits,
+			WaitTime:  c.waitTime,
+		}
+		if total > 0 {
+			st.Usage = c.usage / total
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// wait blocks until n bytes can be sent in the class c.
+func (s *Scheduler) wait(ctx context.Context, c *class, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	start := time.Now()
+	s.mu.Lock()
+	s.refill(start)
+	if len(s.waiting) == 0 && s.tokens >= s.need(n) {
+		s.grant(c, n)
+		s.mu.Unlock()
+		return nil
+	}
+	w := s.enqueue(c, n)
+	s.dispatch(start)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if w.granted {
+			return nil
+		}
+		s.remove(w)
+		return ctx.Err()
+	}
+
+	s.mu.Lock()
+	c.waits++
+	c.waitTime += time.Since(start)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Scheduler) enqueue(c *class, n int) *waiter {
+	s.seq++
+	w := &waiter{c: c, n: n, seq: s.seq, ready: make(chan struct{})}
+	s.waiting = append(s.waiting, w)
+	return w
+}
+
+func (s *Scheduler) remove(w *waiter) {
+	for i, o := range s.waiting {
+		if o == w {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// refill adds the tokens of the time elapsed since the last refill, up to a
+// burst of one second, and decays the usage of the classes.
+func (s *Scheduler) refill(now time.Time) {
+	elapsed := now.Sub(s.last)
+	if elapsed <= 0 {
+		return
+	}
+	s.last = now
+
+	s.tokens += elapsed.Seconds() * s.rate
+	if s.tokens > s.rate {
+		s.tokens = s.rate
+	}
+	decay := math.Exp2(-elapsed.Seconds() / usageHalfLife.Seconds())
+	for _, c := range s.classes {
+		c.usage *= decay
+	}
+}
+
+func (s *Scheduler) grant(c *class, n int) {
+	s.tokens -= float64(n)
+	c.usage += float64(n)
+	c.sent += uint64(n)
+}
+
+// need is the tokens a send of n bytes waits for: n, or the burst for the
+// sends larger than it, which leave the tokens negative and the next sends
+// waiting for the debt to be paid.
+func (s *Scheduler) need(n int) float64 {
+	return math.Min(float64(n), s.rate)
+}
+
+// dispatch grants the tokens available to the waiting sends, the classes
+// below their share first, then by priority, and schedules the next dispatch
+// if sends are left waiting.
+func (s *Scheduler) dispatch(now time.Time) {
+	s.refill(now)
+	for len(s.waiting) > 0 {
+		w := s.next()
+		if s.tokens < s.need(w.n) {
+			s.schedule(w)
+			return
+		}
+		s.remove(w)
+		s.grant(w.c, w.n)
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+// schedule dispatches again once the tokens w waits for are available.
+func (s *Scheduler) schedule(w *waiter) {
+	d := time.Duration((s.need(w.n) - s.tokens) / s.rate * float64(time.Second))
+	if s.timer == nil {
+		s.timer = time.AfterFunc(d, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.dispatch(time.Now())
+		})
+	} else {
+		s.timer.Reset(d)
+	}
+}
+
+// next returns the waiting send to serve first.
+func (s *Scheduler) next() *waiter {
+	total := 0.0
+	for _, c := range s.classes {
+		total += c.usage
+	}
+	below := func(c *class) bool {
+		return c.share > 0 && (total == 0 || c.usage/total < c.share)
+	}
+
+	var best *waiter
+	for _, w := range s.waiting {
+		if best == nil {
+			best = w
+			continue
+		}
+		wb, bb := below(w.c), below(best.c)
+		switch {
+		case wb != bb:
+			if wb {
+				best = w
+			}
+		case w.c.priority != best.c.priority:
+			if w.c.priority > best.c.priority {
+				best = w
+			}
+		case w.seq < best.seq:
+			best = w
+		}
+	}
+	return best
+}
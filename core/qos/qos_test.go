@@ -0,0 +1,189 @@
+package qos
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gwfed "github.com/ipfs/go-ipfs/core/gwfed"
+
+	connmgr "github.com/libp2p/go-libp2p-core/connmgr"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+const testPeer = "QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+
+type tagsConnManager struct {
+	connmgr.NullConnMgr
+	tags map[peer.ID]map[string]int
+}
+
+func (cm *tagsConnManager) GetTagInfo(p peer.ID) *connmgr.TagInfo {
+	return &connmgr.TagInfo{Tags: cm.tags[p]}
+}
+
+func testConfig() Config {
+	return Config{
+		Bandwidth: "1kB",
+		Classes: []ClassConfig{
+			{Name: "partners", Priority: 10, Share: 0.5, Peers: []string{testPeer}, Tags: []string{"user-connect"}},
+			{Name: "leechers", Priority: 0, Share: 0.1},
+		},
+		Default: "leechers",
+	}
+}
+
+func TestConfig(t *testing.T) {
+	s, err := New(Config{}, nil)
+	if err != nil || s != nil {
+		t.Fatalf("expected no scheduler without a bandwidth, got %v %v", s, err)
+	}
+
+	for _, cfg := range []Config{
+		{Classes: []ClassConfig{{Name: "a"}}},
+		{Bandwidth: "fast"},
+		{Bandwidth: "1MB", Classes: []ClassConfig{{Name: "a", Share: 0.6}, {Name: "b", Share: 0.6}}},
+		{Bandwidth: "1MB", Classes: []ClassConfig{{Name: "a"}, {Name: "a"}}},
+		{Bandwidth: "1MB", Classes: []ClassConfig{{Name: "a", Peers: []string{"nope"}}}},
+		{Bandwidth: "1MB", Gateway: "missing"},
+	} {
+		if _, err := New(cfg, nil); err == nil {
+			t.Errorf("expected %+v to be invalid", cfg)
+		}
+	}
+
+	// the default class is implicit
+	s, err = New(Config{Bandwidth: "1MB"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if classes := s.Classes(); len(classes) != 1 || classes[0].Name != DefaultClass {
+		t.Fatalf("expected the default class only, got %+v", classes)
+	}
+}
+
+func TestClassOf(t *testing.T) {
+	p, err := peer.Decode(testPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tagged, other peer.ID = "tagged", "other"
+	cm := &tagsConnManager{tags: map[peer.ID]map[string]int{tagged: {"user-connect": 1}}}
+	s, err := New(testConfig(), cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for p, class := range map[peer.ID]string{p: "partners", tagged: "partners", other: "leechers"} {
+		if c := s.Class(p); c != class {
+			t.Errorf("expected %s in %s, got %s", p, class, c)
+		}
+	}
+
+	// the classes of the tags are cached
+	delete(cm.tags, tagged)
+	if c := s.Class(tagged); c != "partners" {
+		t.Errorf("expected the class of %s cached, got %s", tagged, c)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	s, err := New(testConfig(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partners, leechers := s.classes[0], s.classes[1]
+
+	now := time.Now()
+	s.mu.Lock()
+	s.last = now
+	s.tokens = 0
+	l1 := s.enqueue(leechers, 100)
+	p1 := s.enqueue(partners, 100)
+	l2 := s.enqueue(leechers, 100)
+
+	// the partners are served first by priority
+	s.dispatch(now.Add(100 * time.Millisecond))
+	granted := func(ws ...*waiter) bool {
+		for _, w := range ws {
+			if !w.granted {
+				return false
+			}
+		}
+		return true
+	}
+	if !granted(p1) || granted(l1) || granted(l2) {
+		t.Fatal("expected the partners to be served first")
+	}
+
+	// the leechers are served when below their share, before the partners
+	p2 := s.enqueue(partners, 100)
+	partners.usage, leechers.usage = 1000, 0
+	s.dispatch(now.Add(200 * time.Millisecond))
+	if !granted(l1) || granted(l2) || granted(p2) {
+		t.Fatal("expected the leechers below their share to be served first")
+	}
+	if partners.sent != 100 || leechers.sent != 100 {
+		t.Fatalf("expected 100 bytes sent to each class, got %d and %d", partners.sent, leechers.sent)
+	}
+	s.timer.Stop()
+	s.mu.Unlock()
+}
+
+func TestWait(t *testing.T) {
+	s, err := New(testConfig(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s.def
+
+	// the burst of one second is sent right away, the rest waits
+	ctx := context.Background()
+	start := time.Now()
+	if err := s.wait(ctx, c, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 50*time.Millisecond {
+		t.Fatal("expected the burst not to wait")
+	}
+	if err := s.wait(ctx, c, 100); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 80*time.Millisecond {
+		t.Fatal("expected to wait for the bandwidth")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := s.wait(ctx, c, 100); err != context.Canceled {
+		t.Fatalf("expected the wait to be canceled, got %v", err)
+	}
+	if stats := s.Classes()[1]; stats.Waits != 1 || stats.BytesSent != 1100 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	cfg := testConfig()
+	cfg.Federated = "partners"
+	s, err := New(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 100)))
+	}))
+
+	r := httptest.NewRequest("GET", "/ipfs/x", nil)
+	r.Header.Set(gwfed.Header, "1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ipfs/x", nil))
+
+	classes := s.Classes()
+	if classes[0].BytesSent != 100 || classes[1].BytesSent != 100 {
+		t.Fatalf("expected the federated requests served as partners, got %+v", classes)
+	}
+}
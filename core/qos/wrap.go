@@ -0,0 +1,119 @@
+package qos
+
+import (
+	"context"
+	"net/http"
+
+	gwfed "github.com/ipfs/go-ipfs/core/gwfed"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// chunkSize is the most bytes of a response of the gateway written at once,
+// so that large responses wait for the scheduler in turns with the others.
+const chunkSize = 64 << 10
+
+// Wrap returns a network waiting for the scheduler before sending blocks to
+// a peer, in the class of the peer. It is safe to call on a nil Scheduler, in
+// which case net is returned as is.
+func (s *Scheduler) Wrap(net bsnet.BitSwapNetwork) bsnet.BitSwapNetwork {
+	if s == nil {
+		return net
+	}
+	return &network{BitSwapNetwork: net, s: s}
+}
+
+type network struct {
+	bsnet.BitSwapNetwork
+	s *Scheduler
+}
+
+func (n *network) SendMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) error {
+	if err := n.s.wait(ctx, n.s.classOf(p), blocksSize(msg)); err != nil {
+		return err
+	}
+	return n.BitSwapNetwork.SendMessage(ctx, p, msg)
+}
+
+func (n *network) NewMessageSender(ctx context.Context, p peer.ID) (bsnet.MessageSender, error) {
+	ms, err := n.BitSwapNetwork.NewMessageSender(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return &sender{MessageSender: ms, s: n.s, p: p}, nil
+}
+
+type sender struct {
+	bsnet.MessageSender
+	s *Scheduler
+	p peer.ID
+}
+
+func (s *sender) SendMsg(ctx context.Context, msg bsmsg.BitSwapMessage) error {
+	if err := s.s.wait(ctx, s.s.classOf(s.p), blocksSize(msg)); err != nil {
+		return err
+	}
+	return s.MessageSender.SendMsg(ctx, msg)
+}
+
+// blocksSize is the size of the blocks of msg, the bytes the scheduler
+// accounts for.
+func blocksSize(msg bsmsg.BitSwapMessage) int {
+	n := 0
+	for _, b := range msg.Blocks() {
+		n += len(b.RawData())
+	}
+	return n
+}
+
+// Handler returns a handler writing the responses of h as the scheduler
+// allows, in the class QoS.Federated for the requests of the federated
+// gateways and in the class QoS.Gateway for the others. It is safe to call on
+// a nil Scheduler, in which case h is returned as is.
+func (s *Scheduler) Handler(h http.Handler) http.Handler {
+	if s == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := s.gateway
+		if r.Header.Get(gwfed.Header) != "" {
+			c = s.fed
+		}
+		h.ServeHTTP(&responseWriter{ResponseWriter: w, s: s, c: c, ctx: r.Context()}, r)
+	})
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	s   *Scheduler
+	c   *class
+	ctx context.Context
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		n := len(b)
+		if n > chunkSize {
+			n = chunkSize
+		}
+		if err := w.s.wait(w.ctx, w.c, n); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(b[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
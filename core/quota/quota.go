@@ -0,0 +1,337 @@
+// Package quota enforces Datastore.StorageMax.
+//
+// When enabled, the blockstore returned by Enforcer.Wrap rejects the new
+// blocks once the repo holds StorageMax, with an *ExceededError, and asks
+// for a garbage collection once the repo holds StorageGCWatermark percent
+// of it. The daemon runs the collections asked for.
+//
+// The size of the repo is expensive to compute, so it is computed in the
+// background every RefreshInterval, and kept up to date in between with the
+// size of the blocks written and deleted.
+package quota
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	humanize "github.com/dustin/go-humanize"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("quota")
+
+// ConfigKey is the config key of the quota section.
+const ConfigKey = "Datastore.Quota"
+
+// By default, the repo is limited to 10GB, a collection is requested once it
+// is 90% full, and its size is computed again every 10 seconds.
+const (
+	DefaultStorageMax         = "10GB"
+	DefaultStorageGCWatermark = 90
+	DefaultRefreshInterval    = 10 * time.Second
+)
+
+// Config holds the Datastore.Quota config section.
+type Config struct {
+	// Enabled turns StorageMax into a hard limit.
+	Enabled bool
+
+	// RefreshInterval is how often the size of the repo is computed again,
+	// as a duration string.
+	RefreshInterval string
+}
+
+// LoadConfig reads the Datastore.Quota section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// exceededMessage starts the message of the errors, which is all that is
+// left of them over the HTTP API.
+const exceededMessage = "repo quota exceeded"
+
+// ExceededError is returned for the blocks that would make the repo grow past
+// its quota.
+type ExceededError struct {
+	Usage uint64
+	Max   uint64
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s: %s used of the %s allowed by Datastore.StorageMax; run 'ipfs repo gc' or raise the quota",
+		exceededMessage, humanize.Bytes(e.Usage), humanize.Bytes(e.Max))
+}
+
+// IsExceeded returns whether err is, or reports, an *ExceededError, including
+// after it was wrapped or sent over the HTTP API.
+func IsExceeded(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := err.(*ExceededError); ok {
+		return true
+	}
+	return strings.Contains(err.Error(), exceededMessage)
+}
+
+// Enforcer enforces the quota of a repo.
+type Enforcer struct {
+	usage     func() (uint64, error)
+	max       uint64
+	watermark uint64
+	refresh   time.Duration
+
+	// ready is closed once the size of the repo is first computed
+	ready chan struct{}
+
+	mu         sync.Mutex
+	used       uint64
+	refreshed  time.Time
+	refreshing bool
+	// changed is the size written less the size deleted while refreshing
+	changed int64
+
+	gc chan struct{}
+}
+
+// New returns an enforcer of the quota max, asking for a collection past
+// watermark. usage returns the size of the repo, computed in the background
+// every refresh, starting right away.
+func New(usage func() (uint64, error), max, watermark uint64, refresh time.Duration) *Enforcer {
+	e := &Enforcer{
+		usage:      usage,
+		max:        max,
+		watermark:  watermark,
+		refresh:    refresh,
+		ready:      make(chan struct{}),
+		refreshing: true,
+		gc:         make(chan struct{}, 1),
+	}
+	go e.refreshUsage()
+	return e
+}
+
+// FromRepo returns the enforcer configured for r, or nil if the quota isn't
+// enabled.
+func FromRepo(r repo.Repo) (*Enforcer, error) {
+	qcfg, err := LoadConfig(r)
+	if err != nil || !qcfg.Enabled {
+		return nil, err
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	storageMax := cfg.Datastore.StorageMax
+	if storageMax == "" {
+		storageMax = DefaultStorageMax
+	}
+	max, err := humanize.ParseBytes(storageMax)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Datastore.StorageMax: %s", err)
+	}
+	watermark := cfg.Datastore.StorageGCWatermark
+	if watermark == 0 {
+		watermark = DefaultStorageGCWatermark
+	}
+
+	refresh, err := repo.ConfigDuration(ConfigKey, "RefreshInterval", qcfg.RefreshInterval, DefaultRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	return New(r.GetStorageUsage, max, max*uint64(watermark)/100, refresh), nil
+}
+
+// Usage returns the size of the repo as last known, and its quota. It is
+// nil-safe.
+func (e *Enforcer) Usage() (used, max uint64) {
+	if e == nil {
+		return 0, 0
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.used, e.max
+}
+
+// GCRequests returns the channel receiving the requests for a collection.
+// It is nil-safe.
+func (e *Enforcer) GCRequests() <-chan struct{} {
+	if e == nil {
+		return nil
+	}
+	return e.gc
+}
+
+// Refresh starts computing the size of the repo again, e.g. after a
+// collection. It is nil-safe.
+func (e *Enforcer) Refresh() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	e.refreshed = time.Time{}
+	e.maybeRefresh()
+	e.mu.Unlock()
+}
+
+// maybeRefresh starts computing the size of the repo in the background, if
+// it is due. e.mu must be held.
+func (e *Enforcer) maybeRefresh() {
+	if e.refreshing || time.Since(e.refreshed) < e.refresh {
+		return
+	}
+	e.refreshing = true
+	e.changed = 0
+	go e.refreshUsage()
+}
+
+// refreshUsage computes the size of the repo without holding e.mu, then
+// adds the changes made meanwhile to it. A block written during the walk may
+// be counted twice until the next refresh, which only makes the quota
+// stricter.
+func (e *Enforcer) refreshUsage() {
+	used, err := e.usage()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		log.Errorf("computing the size of the repo: %s", err)
+	} else {
+		e.used = 0
+		if v := int64(used) + e.changed; v > 0 {
+			e.used = uint64(v)
+		}
+		e.refreshed = time.Now()
+	}
+	e.refreshing = false
+	e.changed = 0
+
+	select {
+	case <-e.ready:
+	default:
+		close(e.ready)
+	}
+}
+
+// reserve accounts for size more bytes, or returns an *ExceededError if the
+// quota doesn't leave room for them. The first writes wait for the size of
+// the repo to be computed.
+func (e *Enforcer) reserve(size uint64) error {
+	<-e.ready
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.maybeRefresh()
+
+	if e.used >= e.watermark {
+		select {
+		case e.gc <- struct{}{}:
+			log.Infof("repo size %s past the watermark of %s, asking for a collection", humanize.Bytes(e.used), humanize.Bytes(e.watermark))
+		default:
+		}
+	}
+	if e.used+size > e.max {
+		return &ExceededError{Usage: e.used, Max: e.max}
+	}
+	e.used += size
+	if e.refreshing {
+		e.changed += int64(size)
+	}
+	return nil
+}
+
+// release accounts for size bytes deleted, or reserved but not written.
+func (e *Enforcer) release(size uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if size > e.used {
+		e.used = 0
+	} else {
+		e.used -= size
+	}
+	if e.refreshing {
+		e.changed -= int64(size)
+	}
+}
+
+// Wrap returns bs, rejecting the new blocks past the quota. It is safe to
+// call on a nil Enforcer, in which case bs is returned as is.
+func (e *Enforcer) Wrap(bs bstore.GCBlockstore) bstore.GCBlockstore {
+	if e == nil {
+		return bs
+	}
+	return &blockstore{GCBlockstore: bs, e: e}
+}
+
+type blockstore struct {
+	bstore.GCBlockstore
+	e *Enforcer
+}
+
+func (bs *blockstore) Put(b blocks.Block) error {
+	// storing a block again takes no room
+	has, err := bs.Has(b.Cid())
+	if err != nil {
+		return err
+	}
+	if has {
+		return bs.GCBlockstore.Put(b)
+	}
+	size := uint64(len(b.RawData()))
+	if err := bs.e.reserve(size); err != nil {
+		return err
+	}
+	if err := bs.GCBlockstore.Put(b); err != nil {
+		bs.e.release(size)
+		return err
+	}
+	return nil
+}
+
+func (bs *blockstore) PutMany(blks []blocks.Block) error {
+	var size uint64
+	for _, b := range blks {
+		has, err := bs.Has(b.Cid())
+		if err != nil {
+			return err
+		}
+		if !has {
+			size += uint64(len(b.RawData()))
+		}
+	}
+	if err := bs.e.reserve(size); err != nil {
+		return err
+	}
+	if err := bs.GCBlockstore.PutMany(blks); err != nil {
+		bs.e.release(size)
+		return err
+	}
+	return nil
+}
+
+func (bs *blockstore) DeleteBlock(c cid.Cid) error {
+	size, err := bs.GetSize(c)
+	if err == bstore.ErrNotFound {
+		return bs.GCBlockstore.DeleteBlock(c)
+	}
+	if err != nil {
+		return err
+	}
+	if err := bs.GCBlockstore.DeleteBlock(c); err != nil {
+		return err
+	}
+	bs.e.release(uint64(size))
+	return nil
+}
@@ -0,0 +1,163 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// newBlockstore returns a blockstore enforcing a quota of max bytes, asking
+// for a collection past watermark, whose usage is only measured at first.
+func newBlockstore(max, watermark uint64) (bstore.GCBlockstore, *Enforcer) {
+	bs := bstore.NewGCBlockstore(bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore())), bstore.NewGCLocker())
+	usage := func() (uint64, error) {
+		keys, err := bs.AllKeysChan(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		var used uint64
+		for k := range keys {
+			size, err := bs.GetSize(k)
+			if err != nil {
+				return 0, err
+			}
+			used += uint64(size)
+		}
+		return used, nil
+	}
+	e := New(usage, max, watermark, time.Hour)
+	return e.Wrap(bs), e
+}
+
+func block(i, size int) blocks.Block {
+	data := make([]byte, size)
+	copy(data, fmt.Sprint(i))
+	return blocks.NewBlock(data)
+}
+
+func TestExceeded(t *testing.T) {
+	bs, e := newBlockstore(1000, 500)
+
+	for i := 0; i < 3; i++ {
+		if err := bs.Put(block(i, 300)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := bs.Put(block(3, 300))
+	if !IsExceeded(err) {
+		t.Fatalf("expected the quota to be exceeded, got %v", err)
+	}
+	if err := bs.PutMany([]blocks.Block{block(4, 10), block(5, 300)}); !IsExceeded(err) {
+		t.Fatalf("expected the quota to be exceeded, got %v", err)
+	}
+	if has, _ := bs.Has(block(4, 10).Cid()); has {
+		t.Fatal("expected no block of the rejected batch to be stored")
+	}
+
+	// storing a block again takes no room
+	if err := bs.Put(block(0, 300)); err != nil {
+		t.Fatal(err)
+	}
+
+	if used, max := e.Usage(); used != 900 || max != 1000 {
+		t.Fatalf("expected 900 of 1000 bytes used, got %d of %d", used, max)
+	}
+
+	if !IsExceeded(errors.New("add failed: " + err.Error())) {
+		t.Fatal("expected the message of the error to be recognized")
+	}
+}
+
+func TestWatermark(t *testing.T) {
+	bs, e := newBlockstore(1000, 500)
+
+	if err := bs.Put(block(0, 400)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-e.GCRequests():
+		t.Fatal("expected no collection below the watermark")
+	default:
+	}
+
+	if err := bs.Put(block(1, 400)); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Put(block(2, 100)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-e.GCRequests():
+	default:
+		t.Fatal("expected a collection past the watermark")
+	}
+}
+
+func TestDeleteBlock(t *testing.T) {
+	bs, e := newBlockstore(1000, 1000)
+
+	for i := 0; i < 3; i++ {
+		if err := bs.Put(block(i, 300)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bs.DeleteBlock(block(0, 300).Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.DeleteBlock(block(0, 300).Cid()); err != nil && err != bstore.ErrNotFound {
+		t.Fatal(err)
+	}
+	if used, _ := e.Usage(); used != 600 {
+		t.Fatalf("expected 600 bytes used after the deletion, got %d", used)
+	}
+	if err := bs.Put(block(3, 400)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	computed := make(chan uint64)
+	e := New(func() (uint64, error) { return <-computed, nil }, 1000, 1000, time.Hour)
+	computed <- 100
+	if err := e.reserve(100); err != nil {
+		t.Fatal(err)
+	}
+
+	// the writes go on while the size of the repo is computed again
+	e.Refresh()
+	if err := e.reserve(100); err != nil {
+		t.Fatal(err)
+	}
+	computed <- 500
+	for {
+		e.mu.Lock()
+		refreshing := e.refreshing
+		e.mu.Unlock()
+		if !refreshing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if used, _ := e.Usage(); used != 600 {
+		t.Fatalf("expected the write made while refreshing to be counted, got %d", used)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	var e *Enforcer
+	bs := bstore.NewGCBlockstore(bstore.NewBlockstore(ds.NewMapDatastore()), bstore.NewGCLocker())
+	if e.Wrap(bs) != bs {
+		t.Fatal("expected a nil enforcer to leave the blockstore as is")
+	}
+	if e.GCRequests() != nil {
+		t.Fatal("expected no collection requests from a nil enforcer")
+	}
+	e.Refresh()
+}
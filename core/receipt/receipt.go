@@ -0,0 +1,150 @@
+// Package receipt implements the signed receipts of the content transfers of
+// a private network.
+//
+// A peer receiving a root pushed to it signs a receipt once it fetched the
+// whole DAG of the root, with the key of its peer ID. The sender checks the
+// receipt and keeps it as the proof of delivery of the root, listed by 'ipfs
+// transfer receipts'. The receipt carries the public key of its signer, so
+// that it can be checked again without contacting the signer.
+package receipt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// domain prefixes the signed bytes, so that a receipt signature can't be
+// mistaken for another signature of the peer.
+const domain = "/ipfs/transfer-receipt/1.0.0"
+
+var prefix = ds.NewKey("/local/receipts")
+
+// ErrInvalid is returned by Verify when the signature of a receipt doesn't
+// match its content and signer.
+var ErrInvalid = errors.New("invalid receipt signature")
+
+// Receipt acknowledges the delivery of the DAG of Root to Peer by From.
+type Receipt struct {
+	Root cid.Cid
+	From peer.ID
+
+	// Peer is the receiving peer, and signer of the receipt.
+	Peer peer.ID
+	Time time.Time
+
+	// Key is the public key of Peer, marshalled.
+	Key       []byte
+	Signature []byte
+}
+
+func (r *Receipt) payload() []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n%s\n%s\n%d", domain, r.Root, r.From.Pretty(), r.Peer.Pretty(), r.Time.UnixNano()))
+}
+
+// Sign returns the receipt of the delivery of root by from, signed with sk.
+func Sign(sk crypto.PrivKey, root cid.Cid, from peer.ID) (*Receipt, error) {
+	if sk == nil {
+		return nil, errors.New("no private key to sign the receipt with")
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.MarshalPublicKey(sk.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	r := &Receipt{
+		Root: root,
+		From: from,
+		Peer: id,
+		Time: time.Now().UTC(),
+		Key:  key,
+	}
+	r.Signature, err = sk.Sign(r.payload())
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Verify checks that r is signed by the key of r.Peer.
+func (r *Receipt) Verify() error {
+	pk, err := crypto.UnmarshalPublicKey(r.Key)
+	if err != nil {
+		return fmt.Errorf("invalid receipt key: %s", err)
+	}
+	if !r.Peer.MatchesPublicKey(pk) {
+		return fmt.Errorf("the receipt key is not the key of %s", r.Peer.Pretty())
+	}
+	ok, err := pk.Verify(r.payload(), r.Signature)
+	if err != nil || !ok {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// Store holds the receipts received, at most one per root and peer.
+type Store struct {
+	d ds.Datastore
+}
+
+// NewStore returns the store of the receipts in d.
+func NewStore(d ds.Datastore) *Store {
+	return &Store{d: d}
+}
+
+func receiptKey(root cid.Cid, p peer.ID) ds.Key {
+	return prefix.ChildString(root.String()).ChildString(p.Pretty())
+}
+
+// Put records r, replacing a previous receipt of its peer for its root.
+func (s *Store) Put(r *Receipt) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.d.Put(receiptKey(r.Root, r.Peer), b)
+}
+
+// Receipts returns the receipts of root, or of every root if root is
+// undefined, sorted by root and peer.
+func (s *Store) Receipts(root cid.Cid) ([]*Receipt, error) {
+	q := query.Query{Prefix: prefix.String() + "/"}
+	if root.Defined() {
+		q.Prefix = prefix.ChildString(root.String()).String() + "/"
+	}
+	res, err := s.d.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*Receipt, 0, len(entries))
+	for _, e := range entries {
+		r := new(Receipt)
+		if err := json.Unmarshal(e.Value, r); err != nil {
+			return nil, fmt.Errorf("invalid receipt %s: %s", e.Key, err)
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Root != out[j].Root {
+			return out[i].Root.String() < out[j].Root.String()
+		}
+		return out[i].Peer < out[j].Peer
+	})
+	return out, nil
+}
@@ -0,0 +1,68 @@
+package receipt
+
+import (
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestReceipt(t *testing.T) {
+	sk, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := peer.IDFromPrivateKey(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := mh.Sum([]byte("root"), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := cid.NewCidV1(cid.Raw, h)
+
+	r, err := Sign(sk, root, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStore(dssync.MutexWrap(ds.NewMapDatastore()))
+	if err := s.Put(r); err != nil {
+		t.Fatal(err)
+	}
+	receipts, err := s.Receipts(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 1 || !receipts[0].Root.Equals(root) || receipts[0].From != from {
+		t.Fatalf("unexpected receipts %+v", receipts)
+	}
+	// the receipts read back are still valid
+	if err := receipts[0].Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	forged := *r
+	forged.Time = forged.Time.Add(time.Hour)
+	if err := forged.Verify(); err != ErrInvalid {
+		t.Fatalf("expected ErrInvalid for a changed receipt, got %v", err)
+	}
+	forged = *r
+	forged.Peer = from
+	if err := forged.Verify(); err == nil {
+		t.Fatal("expected an error for a receipt signed by another peer")
+	}
+}
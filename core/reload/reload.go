@@ -0,0 +1,228 @@
+// Package reload applies the changes of the config to the running node.
+//
+// The subsystems able to apply a change of their config without a restart
+// register the keys they read. A reload reads the config file, which may
+// have been edited while the daemon runs, and compares it with the config the
+// subsystems run with: the subsystems of the keys changed are handed the new
+// config, and the other keys changed are reported as requiring a restart.
+package reload
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+	common "github.com/ipfs/go-ipfs/repo/common"
+
+	config "github.com/ipfs/go-ipfs-config"
+	serialize "github.com/ipfs/go-ipfs-config/serialize"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("reload")
+
+// ErrRestart is returned by a Func which can't apply the change of its key,
+// which then requires a restart.
+var ErrRestart = errors.New("the change requires a restart")
+
+// Func applies the new config of a key to a running subsystem. old is the
+// config the subsystem runs with.
+type Func func(old, new *config.Config) error
+
+// Failure is a key whose change failed to apply.
+type Failure struct {
+	Key   string
+	Error string
+}
+
+// Result lists the keys changed by a reload: the keys applied, the keys
+// requiring a restart, and the keys which failed to apply.
+type Result struct {
+	Applied []string
+	Restart []string
+	Failed  []Failure
+}
+
+// Reloader holds the reloadable keys, and the config the node runs with.
+type Reloader struct {
+	repo repo.Repo
+
+	mu      sync.Mutex
+	funcs   map[string][]Func
+	running map[string]interface{}
+}
+
+// New returns a Reloader of the node whose repo is r, running with the
+// config of r.
+func New(r repo.Repo) (*Reloader, error) {
+	running, err := readConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Reloader{
+		repo:    r,
+		funcs:   make(map[string][]Func),
+		running: running,
+	}, nil
+}
+
+// Register calls f on the reloads changing key, or the keys under it. A key
+// may be registered more than once. It is safe to call on a nil Reloader, in
+// which case key is not reloadable.
+func (rl *Reloader) Register(key string, f Func) {
+	if rl == nil {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.funcs[key] = append(rl.funcs[key], f)
+}
+
+// Keys returns the reloadable keys, sorted.
+func (rl *Reloader) Keys() []string {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	keys := make([]string, 0, len(rl.funcs))
+	for k := range rl.funcs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Reload reads the config file, and applies its changes to the subsystems
+// of the keys changed. The repo holds the new config afterwards, even for the
+// keys requiring a restart, as after 'ipfs config'.
+func (rl *Reloader) Reload() (*Result, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	next, err := readConfig(rl.repo)
+	if err != nil {
+		return nil, err
+	}
+	newCfg, err := config.FromMap(next)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+	oldCfg, err := config.FromMap(rl.running)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	diff("", rl.running, next, &changed)
+	sort.Strings(changed)
+	res := &Result{}
+	if len(changed) == 0 {
+		return res, nil
+	}
+	if err := rl.repo.SetConfig(newCfg); err != nil {
+		return nil, err
+	}
+
+	done := make(map[string]bool)
+	for _, k := range changed {
+		key := rl.registered(k)
+		if key == "" {
+			res.Restart = append(res.Restart, k)
+			continue
+		}
+		if done[key] {
+			continue
+		}
+		done[key] = true
+
+		if err := rl.apply(key, oldCfg, newCfg); err != nil {
+			if err == ErrRestart {
+				res.Restart = append(res.Restart, key)
+			} else {
+				log.Errorf("failed to reload %s: %s", key, err)
+				res.Failed = append(res.Failed, Failure{Key: key, Error: err.Error()})
+			}
+			continue
+		}
+		res.Applied = append(res.Applied, key)
+		v, err := common.MapGetKV(next, key)
+		if err != nil {
+			v = nil
+		}
+		if err := common.MapSetKV(rl.running, key, v); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (rl *Reloader) apply(key string, oldCfg, newCfg *config.Config) error {
+	for _, f := range rl.funcs[key] {
+		if err := f(oldCfg, newCfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registered returns the longest reloadable key k is, or is under, or "".
+func (rl *Reloader) registered(k string) string {
+	best := ""
+	for key := range rl.funcs {
+		if (k == key || strings.HasPrefix(k, key+".")) && len(key) > len(best) {
+			best = key
+		}
+	}
+	return best
+}
+
+// readConfig reads the config file of r, or the config r holds when it has
+// no file.
+func readConfig(r repo.Repo) (map[string]interface{}, error) {
+	if fr, ok := r.(interface{ Path() string }); ok {
+		filename, err := config.Filename(fr.Path())
+		if err != nil {
+			return nil, err
+		}
+		var m map[string]interface{}
+		if err := serialize.ReadConfigFile(filename, &m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+	return config.ToMap(cfg)
+}
+
+// diff appends to out the keys whose values differ between a and b, down to
+// the values which are not objects.
+func diff(prefix string, a, b interface{}, out *[]string) {
+	am, aMap := a.(map[string]interface{})
+	bm, bMap := b.(map[string]interface{})
+	if !aMap && !bMap || !aMap && a != nil || !bMap && b != nil {
+		if !reflect.DeepEqual(a, b) {
+			*out = append(*out, prefix)
+		}
+		return
+	}
+
+	keys := make(map[string]bool, len(am)+len(bm))
+	for k := range am {
+		keys[k] = true
+	}
+	for k := range bm {
+		keys[k] = true
+	}
+	for k := range keys {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		diff(key, am[k], bm[k], out)
+	}
+}
@@ -0,0 +1,104 @@
+package reload
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	datastore "github.com/ipfs/go-datastore"
+	syncds "github.com/ipfs/go-datastore/sync"
+	config "github.com/ipfs/go-ipfs-config"
+)
+
+func TestReload(t *testing.T) {
+	r := &repo.Mock{D: syncds.MutexWrap(datastore.NewMapDatastore())}
+	r.C.Gateway.HTTPHeaders = map[string][]string{"X-Test": {"a"}}
+	rl, err := New(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var headers []string
+	rl.Register("Gateway.HTTPHeaders", func(old, new *config.Config) error {
+		if old.Gateway.HTTPHeaders["X-Test"][0] != "a" {
+			t.Errorf("expected the old headers, got %v", old.Gateway.HTTPHeaders)
+		}
+		headers = new.Gateway.HTTPHeaders["X-Test"]
+		return nil
+	})
+	rl.Register("Swarm.ConnMgr", func(old, new *config.Config) error {
+		return ErrRestart
+	})
+	rl.Register("Swarm.AddrFilters", func(old, new *config.Config) error {
+		return errors.New("invalid filter")
+	})
+	if keys := rl.Keys(); !reflect.DeepEqual(keys, []string{"Gateway.HTTPHeaders", "Swarm.AddrFilters", "Swarm.ConnMgr"}) {
+		t.Fatalf("unexpected reloadable keys %v", keys)
+	}
+
+	res, err := rl.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Applied)+len(res.Restart)+len(res.Failed) != 0 {
+		t.Fatalf("expected no change, got %+v", res)
+	}
+
+	cfg := r.C
+	cfg.Gateway.HTTPHeaders = map[string][]string{"X-Test": {"b"}}
+	cfg.Addresses.Swarm = []string{"/ip4/0.0.0.0/tcp/4002"}
+	cfg.Swarm.ConnMgr.HighWater = 100
+	cfg.Swarm.AddrFilters = []string{"/ip4/10.0.0.0/ipcidr/8"}
+	r.C = cfg
+
+	res, err = rl.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(headers, []string{"b"}) {
+		t.Fatalf("expected the new headers applied, got %v", headers)
+	}
+	expected := &Result{
+		Applied: []string{"Gateway.HTTPHeaders"},
+		Restart: []string{"Addresses.Swarm", "Swarm.ConnMgr"},
+		Failed:  []Failure{{Key: "Swarm.AddrFilters", Error: "invalid filter"}},
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, res)
+	}
+
+	// the keys not applied are still changed
+	headers = nil
+	res, err = rl.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected.Applied = nil
+	if !reflect.DeepEqual(res, expected) || headers != nil {
+		t.Fatalf("expected %+v, got %+v", expected, res)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := map[string]interface{}{
+		"A": map[string]interface{}{"B": 1.0, "C": []interface{}{"x"}},
+		"D": "d",
+	}
+	b := map[string]interface{}{
+		"A": map[string]interface{}{"B": 2.0, "C": []interface{}{"x"}},
+		"E": map[string]interface{}{"F": true},
+	}
+	var changed []string
+	diff("", a, b, &changed)
+	expected := map[string]bool{"A.B": true, "D": true, "E.F": true}
+	if len(changed) != len(expected) {
+		t.Fatalf("expected %v changed, got %v", expected, changed)
+	}
+	for _, k := range changed {
+		if !expected[k] {
+			t.Fatalf("expected %v changed, got %v", expected, changed)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package replica
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsquery "github.com/ipfs/go-datastore/query"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// pinTimeout bounds the time spent fetching the content of a pin.
+const pinTimeout = time.Hour
+
+// pinsPrefix holds the pins made for the primary, with their mode.
+var pinsPrefix = ds.NewKey("/replica/pins")
+
+// Status is the replication status of a replica.
+type Status struct {
+	Primary string
+
+	// LastContact is when the primary last answered, zero if it never did.
+	LastContact time.Time
+	LastError   string `json:",omitempty"`
+
+	// Synced is the time of the last state of the primary fully
+	// replicated, zero if none was.
+	Synced time.Time
+
+	// Lag is how old the replicated state is.
+	Lag time.Duration
+
+	// Replicated is the number of pins made for the primary, and Pending
+	// the number of pins of the primary not replicated yet.
+	Replicated int
+	Pending    int
+}
+
+// Follower replicates the state of a primary.
+type Follower struct {
+	ctx    context.Context
+	cancel func()
+
+	primary  peer.AddrInfo
+	interval time.Duration
+	fetch    func(context.Context, report) (*State, error)
+
+	ds      ds.Datastore
+	bs      bstore.Blockstore
+	dag     ipld.DAGService
+	pinning pin.Pinner
+	gcl     bstore.GCLocker
+
+	mu          sync.Mutex
+	lastContact time.Time
+	lastErr     error
+	synced      time.Time
+	replicated  int
+	pending     map[cid.Cid]bool
+}
+
+// NewFollower creates a Follower replicating primary over h every interval.
+// Start starts syncing.
+func NewFollower(ctx context.Context, h host.Host, primary peer.AddrInfo, interval time.Duration, d ds.Datastore, bs bstore.Blockstore, dag ipld.DAGService, pinning pin.Pinner, gcl bstore.GCLocker) *Follower {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Follower{
+		ctx:      ctx,
+		cancel:   cancel,
+		primary:  primary,
+		interval: interval,
+		fetch: func(ctx context.Context, rep report) (*State, error) {
+			return fetchState(ctx, h, primary, rep)
+		},
+		ds:      d,
+		bs:      bs,
+		dag:     dag,
+		pinning: pinning,
+		gcl:     gcl,
+	}
+}
+
+// Start syncs with the primary every interval, until Close is called.
+func (f *Follower) Start() {
+	go f.loop()
+}
+
+func (f *Follower) loop() {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.sync(f.ctx); err != nil && f.ctx.Err() == nil {
+			log.Errorf("syncing with %s: %s", f.primary.ID.Pretty(), err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-f.ctx.Done():
+			return
+		}
+	}
+}
+
+// sync fetches the state of the primary and replicates it.
+func (f *Follower) sync(ctx context.Context) error {
+	f.mu.Lock()
+	rep := report{Synced: f.synced, Pending: len(f.pending)}
+	f.mu.Unlock()
+
+	st, err := f.fetch(ctx, rep)
+
+	f.mu.Lock()
+	f.lastErr = err
+	if err == nil {
+		f.lastContact = time.Now()
+	}
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = f.apply(ctx, st)
+	if err != nil {
+		f.mu.Lock()
+		f.lastErr = err
+		f.mu.Unlock()
+	}
+	return err
+}
+
+// apply pins the content of st missing locally, and unpins the content
+// pinned for the primary which st no longer has.
+func (f *Follower) apply(ctx context.Context, st *State) error {
+	want := make(map[cid.Cid]pin.Mode, len(st.Recursive)+len(st.Direct)+1)
+	for _, c := range st.Direct {
+		want[c] = pin.Direct
+	}
+	for _, c := range st.Recursive {
+		want[c] = pin.Recursive
+	}
+	if st.FilesRoot.Defined() {
+		want[st.FilesRoot] = pin.Recursive
+	}
+
+	have, err := f.replicatedPins()
+	if err != nil {
+		return err
+	}
+
+	pending := make(map[cid.Cid]bool)
+	for c, mode := range want {
+		if m, ok := have[c]; !ok || m != mode {
+			pending[c] = true
+		}
+	}
+	f.mu.Lock()
+	f.pending = pending
+	f.replicated = len(have)
+	f.mu.Unlock()
+
+	for c := range pending {
+		mode := want[c]
+		pinned, err := f.pin(ctx, c, mode)
+		if err != nil {
+			return fmt.Errorf("replicating %s: %s", c, err)
+		}
+		if pinned {
+			if err := f.ds.Put(pinKey(c), []byte(modeName(mode))); err != nil {
+				return err
+			}
+			have[c] = mode
+		}
+
+		f.mu.Lock()
+		delete(f.pending, c)
+		f.replicated = len(have)
+		f.mu.Unlock()
+	}
+
+	for c, mode := range have {
+		if m, ok := want[c]; ok && m == mode {
+			continue
+		}
+		if err := f.unpin(ctx, c, mode); err != nil {
+			return fmt.Errorf("unpinning %s: %s", c, err)
+		}
+		if err := f.ds.Delete(pinKey(c)); err != nil {
+			return err
+		}
+		delete(have, c)
+	}
+
+	f.mu.Lock()
+	f.synced = st.Time
+	f.replicated = len(have)
+	f.mu.Unlock()
+	return nil
+}
+
+// replicatedPins returns the pins made for the primary.
+func (f *Follower) replicatedPins() (map[cid.Cid]pin.Mode, error) {
+	res, err := f.ds.Query(dsquery.Query{Prefix: pinsPrefix.String() + "/"})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	pins := make(map[cid.Cid]pin.Mode, len(entries))
+	for _, e := range entries {
+		c, err := cid.Decode(ds.RawKey(e.Key).BaseNamespace())
+		if err != nil {
+			return nil, fmt.Errorf("invalid replicated pin %s: %s", e.Key, err)
+		}
+		mode, ok := pin.StringToMode(string(e.Value))
+		if !ok {
+			return nil, fmt.Errorf("invalid mode of replicated pin %s: %q", e.Key, e.Value)
+		}
+		pins[c] = mode
+	}
+	return pins, nil
+}
+
+// pin pins c with mode, fetching it if needed. It returns false if c was
+// already pinned with mode by the node itself.
+func (f *Follower) pin(ctx context.Context, c cid.Cid, mode pin.Mode) (bool, error) {
+	if _, pinned, err := f.pinning.IsPinnedWithType(ctx, c, mode); err != nil || pinned {
+		return false, err
+	}
+	if mode == pin.Direct {
+		// the pinner refuses direct pins of recursively pinned blocks
+		if _, pinned, err := f.pinning.IsPinnedWithType(ctx, c, pin.Recursive); err != nil || pinned {
+			return false, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pinTimeout)
+	defer cancel()
+
+	nd, err := f.dag.Get(ctx, c)
+	if err != nil {
+		return false, err
+	}
+
+	defer f.gcl.PinLock().Unlock()
+	if err := f.pinning.Pin(ctx, nd, mode == pin.Recursive); err != nil {
+		return false, err
+	}
+	return true, f.pinning.Flush(ctx)
+}
+
+func (f *Follower) unpin(ctx context.Context, c cid.Cid, mode pin.Mode) error {
+	defer f.gcl.PinLock().Unlock()
+	if err := f.pinning.Unpin(ctx, c, mode == pin.Recursive); err != nil && err != pin.ErrNotPinned {
+		return err
+	}
+	return f.pinning.Flush(ctx)
+}
+
+// Available returns whether the content under root can be served: it isn't
+// waiting to be replicated, and its root block is stored.
+func (f *Follower) Available(root cid.Cid) (bool, error) {
+	f.mu.Lock()
+	pending := f.pending[root]
+	f.mu.Unlock()
+	if pending {
+		return false, nil
+	}
+	return f.bs.Has(root)
+}
+
+// Interval returns how often the follower syncs with its primary.
+func (f *Follower) Interval() time.Duration {
+	return f.interval
+}
+
+// Status returns the replication status.
+func (f *Follower) Status() Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	st := Status{
+		Primary:     f.primary.ID.Pretty(),
+		LastContact: f.lastContact,
+		Synced:      f.synced,
+		Replicated:  f.replicated,
+		Pending:     len(f.pending),
+	}
+	if f.lastErr != nil {
+		st.LastError = f.lastErr.Error()
+	}
+	if !f.synced.IsZero() {
+		st.Lag = time.Since(f.synced)
+	}
+	return st
+}
+
+// Close stops syncing.
+func (f *Follower) Close() {
+	f.cancel()
+}
+
+func modeName(mode pin.Mode) string {
+	if mode == pin.Direct {
+		return "direct"
+	}
+	return "recursive"
+}
+
+func pinKey(c cid.Cid) ds.Key {
+	return pinsPrefix.ChildString(c.String())
+}
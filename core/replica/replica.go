@@ -0,0 +1,296 @@
+// Package replica keeps read-only gateway replicas in sync with a primary.
+//
+// A replica registers with its primary over the replica protocol, and polls
+// it every Interval for its state: the recursive and direct pins, and the
+// root of its MFS. The replica pins the same content, fetching it over
+// bitswap, and unpins what the primary no longer has. Only the pins made for
+// the primary are removed, the pins of the replica itself are left alone.
+//
+// Until a root is replicated, the gateway of a replica answers the requests
+// for it with 503 Service Unavailable, so that a load balancer can retry them
+// on another node, instead of fetching the content from the network.
+//
+// The primary only answers the peers listed in Replicas, and reports how far
+// behind each of them is.
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	addrbook "github.com/ipfs/go-ipfs/core/addrbook"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	cid "github.com/ipfs/go-cid"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	logging "github.com/ipfs/go-log"
+	mfs "github.com/ipfs/go-mfs"
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("replica")
+
+// ID is the protocol ID of the replica protocol.
+const ID protocol.ID = "/ipfs/replica/1.0.0"
+
+// ConfigKey is the config key of the replica section.
+const ConfigKey = "Replica"
+
+// DefaultInterval is how often a replica syncs with its primary when no
+// interval is configured.
+const DefaultInterval = 30 * time.Second
+
+// streamTimeout bounds a state exchange.
+const streamTimeout = time.Minute
+
+// maxReportSize and maxStateSize bound the messages read from the stream.
+const (
+	maxReportSize = 4 << 10
+	maxStateSize  = 64 << 20
+)
+
+// Config holds the Replica config section.
+type Config struct {
+	// Primary is the peer ID, or the /p2p address, of the node this node
+	// replicates. Setting it makes this node a replica.
+	Primary string
+
+	// Interval is how often the replica syncs with its primary.
+	Interval string
+
+	// Replicas are the peer IDs of the nodes allowed to replicate this
+	// node.
+	Replicas []string
+}
+
+// LoadConfig reads the Replica section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// PrimaryInfo parses cfg.Primary. It returns nil if no primary is set.
+func (cfg Config) PrimaryInfo() (*peer.AddrInfo, error) {
+	if cfg.Primary == "" {
+		return nil, nil
+	}
+	if id, err := peer.Decode(cfg.Primary); err == nil {
+		return &peer.AddrInfo{ID: id}, nil
+	}
+	a, err := ma.NewMultiaddr(cfg.Primary)
+	if err != nil {
+		return nil, fmt.Errorf("%s.Primary: not a peer ID or address: %q", ConfigKey, cfg.Primary)
+	}
+	return peer.AddrInfoFromP2pAddr(a)
+}
+
+// SyncInterval parses cfg.Interval.
+func (cfg Config) SyncInterval() (time.Duration, error) {
+	if cfg.Interval == "" {
+		return DefaultInterval, nil
+	}
+	d, err := time.ParseDuration(cfg.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("%s.Interval: %s", ConfigKey, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s.Interval must be positive", ConfigKey)
+	}
+	return d, nil
+}
+
+// State is the content a primary has replicated.
+type State struct {
+	Recursive []cid.Cid
+	Direct    []cid.Cid
+	FilesRoot cid.Cid
+
+	// Time is when the primary took the state.
+	Time time.Time
+}
+
+// report is sent by a replica when requesting the state of its primary.
+type report struct {
+	// Synced is the time of the last state fully replicated.
+	Synced  time.Time
+	Pending int
+}
+
+// Service is the replication service of a node, which may both replicate a
+// primary and be the primary of other nodes.
+type Service struct {
+	// Server answers the replicas of the node, nil if it has none.
+	Server *Server
+	// Follower replicates the primary of the node, nil if it has none.
+	Follower *Follower
+}
+
+// Close stops the service.
+func (s *Service) Close() error {
+	if s.Follower != nil {
+		s.Follower.Close()
+	}
+	if s.Server != nil {
+		s.Server.Close()
+	}
+	return nil
+}
+
+// ReplicaInfo is a replica as seen from its primary.
+type ReplicaInfo struct {
+	Peer string
+
+	// LastSeen is when the replica last requested the state, zero if it
+	// never did.
+	LastSeen time.Time
+
+	// Synced is the time of the last state of the primary the replica has
+	// fully replicated.
+	Synced  time.Time
+	Pending int
+}
+
+// Server answers the state requests of the replicas.
+type Server struct {
+	host  host.Host
+	state func(context.Context) (*State, error)
+
+	mu       sync.Mutex
+	replicas map[peer.ID]*ReplicaInfo
+}
+
+// NewServer handles the replica protocol on h for the allowed peers, with
+// state returning the current state of the node.
+func NewServer(h host.Host, allowed []peer.ID, state func(context.Context) (*State, error)) *Server {
+	s := &Server{
+		host:     h,
+		state:    state,
+		replicas: make(map[peer.ID]*ReplicaInfo, len(allowed)),
+	}
+	for _, p := range allowed {
+		s.replicas[p] = &ReplicaInfo{Peer: p.Pretty()}
+	}
+	h.SetStreamHandler(ID, s.handleStream)
+	return s
+}
+
+// NodeState returns the state of a node with pinning and the MFS root.
+func NodeState(pinning pin.Pinner, root *mfs.Root) func(context.Context) (*State, error) {
+	return func(ctx context.Context) (*State, error) {
+		st := &State{Time: time.Now()}
+
+		var err error
+		if st.Recursive, err = pinning.RecursiveKeys(ctx); err != nil {
+			return nil, err
+		}
+		if st.Direct, err = pinning.DirectKeys(ctx); err != nil {
+			return nil, err
+		}
+
+		nd, err := root.GetDirectory().GetNode()
+		if err != nil {
+			return nil, err
+		}
+		st.FilesRoot = nd.Cid()
+		return st, nil
+	}
+}
+
+// Replicas returns the allowed replicas, sorted by peer ID.
+func (s *Server) Replicas() []ReplicaInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]ReplicaInfo, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Peer < out[j].Peer })
+	return out
+}
+
+func (s *Server) handleStream(str inet.Stream) {
+	defer str.Close()
+	str.SetDeadline(time.Now().Add(streamTimeout))
+
+	p := str.Conn().RemotePeer()
+	s.mu.Lock()
+	info, ok := s.replicas[p]
+	s.mu.Unlock()
+	if !ok {
+		log.Warningf("peer %s is not an allowed replica", p.Pretty())
+		str.Reset()
+		return
+	}
+
+	var rep report
+	if err := json.NewDecoder(io.LimitReader(str, maxReportSize)).Decode(&rep); err != nil {
+		str.Reset()
+		return
+	}
+
+	s.mu.Lock()
+	info.LastSeen = time.Now()
+	info.Synced = rep.Synced
+	info.Pending = rep.Pending
+	s.mu.Unlock()
+
+	st, err := s.state(context.Background())
+	if err != nil {
+		log.Errorf("reading the replicated state: %s", err)
+		str.Reset()
+		return
+	}
+	if err := json.NewEncoder(str).Encode(st); err != nil {
+		str.Reset()
+	}
+}
+
+// Close stops answering the replicas.
+func (s *Server) Close() error {
+	s.host.RemoveStreamHandler(ID)
+	return nil
+}
+
+// fetchState registers with the primary pi and returns its state.
+func fetchState(ctx context.Context, h host.Host, pi peer.AddrInfo, rep report) (*State, error) {
+	ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+	defer cancel()
+
+	if len(pi.Addrs) > 0 {
+		if r, ok := h.Peerstore().(*addrbook.Recorder); ok {
+			r.Mark(pi.ID, pi.Addrs, addrbook.SourceManual)
+		}
+		if err := h.Connect(ctx, pi); err != nil {
+			return nil, err
+		}
+	}
+	str, err := h.NewStream(ctx, pi.ID, ID)
+	if err != nil {
+		return nil, err
+	}
+	defer str.Close()
+	str.SetDeadline(time.Now().Add(streamTimeout))
+
+	if err := json.NewEncoder(str).Encode(&rep); err != nil {
+		str.Reset()
+		return nil, err
+	}
+
+	var st State
+	if err := json.NewDecoder(io.LimitReader(str, maxStateSize)).Decode(&st); err != nil {
+		str.Reset()
+		return nil, err
+	}
+	return &st, nil
+}
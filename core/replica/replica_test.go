@@ -0,0 +1,132 @@
+package replica
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewBlockstore(d)
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pinner := pin.NewPinner(d, dserv, dserv)
+
+	f := &Follower{
+		interval: time.Minute,
+		ds:       d,
+		bs:       bs,
+		dag:      dserv,
+		pinning:  pinner,
+		gcl:      bstore.NewGCLocker(),
+	}
+
+	var roots []cid.Cid
+	for i := 0; i < 4; i++ {
+		nd := dag.NodeWithData([]byte{byte(i)})
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, nd.Cid())
+	}
+	missing := dag.NodeWithData([]byte("missing")).Cid()
+
+	// roots[0] is pinned by the replica itself, and stays pinned.
+	nd, err := dserv.Get(ctx, roots[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Pin(ctx, nd, true); err != nil {
+		t.Fatal(err)
+	}
+
+	checkPinned := func(c cid.Cid, mode pin.Mode, want bool) {
+		t.Helper()
+		_, pinned, err := pinner.IsPinnedWithType(ctx, c, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pinned != want {
+			t.Fatalf("%s: expected pinned to be %t", c, want)
+		}
+	}
+
+	first := &State{
+		Recursive: []cid.Cid{roots[0], roots[1]},
+		Direct:    []cid.Cid{roots[2]},
+		FilesRoot: roots[3],
+		Time:      time.Now().Add(-time.Minute),
+	}
+	if err := f.apply(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	checkPinned(roots[1], pin.Recursive, true)
+	checkPinned(roots[2], pin.Direct, true)
+	checkPinned(roots[3], pin.Recursive, true)
+
+	st := f.Status()
+	if st.Replicated != 3 || st.Pending != 0 || !st.Synced.Equal(first.Time) || st.Lag < time.Minute {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	// everything is dropped by the primary, and a root can't be fetched
+	second := &State{Recursive: []cid.Cid{missing}, Time: time.Now()}
+	if err := f.apply(ctx, second); err == nil {
+		t.Fatal("expected fetching the missing root to fail")
+	}
+	if ok, _ := f.Available(missing); ok {
+		t.Fatal("expected the missing root to be unavailable")
+	}
+	if ok, _ := f.Available(roots[0]); !ok {
+		t.Fatal("expected a replicated root to be available")
+	}
+	if st := f.Status(); st.Pending != 1 || !st.Synced.Equal(first.Time) {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	if err := f.apply(ctx, &State{Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	checkPinned(roots[0], pin.Recursive, true)
+	checkPinned(roots[1], pin.Recursive, false)
+	checkPinned(roots[2], pin.Direct, false)
+	checkPinned(roots[3], pin.Recursive, false)
+	if st := f.Status(); st.Replicated != 0 || st.Pending != 0 {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	cfg := Config{Primary: "/ip4/10.0.0.1/tcp/4001/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"}
+	pi, err := cfg.PrimaryInfo()
+	if err != nil || len(pi.Addrs) != 1 {
+		t.Fatalf("unexpected primary %v: %v", pi, err)
+	}
+
+	cfg.Primary = "QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+	if pi, err := cfg.PrimaryInfo(); err != nil || pi.ID.Pretty() != cfg.Primary || len(pi.Addrs) != 0 {
+		t.Fatalf("unexpected primary %v: %v", pi, err)
+	}
+
+	cfg.Primary = "nope"
+	if _, err := cfg.PrimaryInfo(); err == nil {
+		t.Fatal("expected an invalid primary to be rejected")
+	}
+
+	if d, err := (Config{}).SyncInterval(); err != nil || d != DefaultInterval {
+		t.Fatalf("expected the default interval, got %s, %v", d, err)
+	}
+	if _, err := (Config{Interval: "-1s"}).SyncInterval(); err == nil {
+		t.Fatal("expected a negative interval to be rejected")
+	}
+}
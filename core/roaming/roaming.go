@@ -0,0 +1,299 @@
+// Package roaming keeps the node connected to its peers when addresses
+// change, and records the connection events of the swarm.
+//
+// The QUIC transport of this version of libp2p doesn't support connection
+// migration: a connection stays bound to the addresses it was established
+// with, and its streams end when its path breaks. So when the local addresses
+// of the node change, as when a laptop moves to another network, the Tracker
+// closes the connections whose local address is gone instead of waiting for
+// them to time out, and dials their peers again right away. A peer which
+// reconnects within MigrateWindow over another address, because either side
+// moved, is reported as migrated.
+package roaming
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+var log = logging.Logger("roaming")
+
+var (
+	// PollInterval is how often the addresses of the network interfaces
+	// are checked.
+	PollInterval = 5 * time.Second
+
+	// MigrateWindow is how soon a peer must reconnect for its connection
+	// to be reported as migrated.
+	MigrateWindow = 30 * time.Second
+)
+
+// maxEvents is the number of events kept.
+const maxEvents = 256
+
+// redialTimeout bounds the dials to the peers of the closed connections.
+const redialTimeout = 30 * time.Second
+
+// EventType is the type of a swarm event.
+type EventType string
+
+const (
+	Connected    EventType = "connected"
+	Disconnected EventType = "disconnected"
+	// Migrated is a peer reconnected over other addresses.
+	Migrated EventType = "migrated"
+	// AddrsChanged is a change of the addresses of the network interfaces.
+	AddrsChanged EventType = "addrs-changed"
+)
+
+// Event is a swarm event.
+type Event struct {
+	Time time.Time
+	Type EventType
+	Peer string `json:",omitempty"`
+
+	// Addr is the remote address of the connection, and OldAddr the remote
+	// address of the connection a migrated peer had.
+	Addr    string `json:",omitempty"`
+	OldAddr string `json:",omitempty"`
+
+	// Local are the addresses of the network interfaces, for AddrsChanged.
+	Local []string `json:",omitempty"`
+}
+
+type lostConn struct {
+	addr string
+	at   time.Time
+}
+
+// Tracker records the swarm events, and redials the peers of the connections
+// broken by a change of the local addresses.
+type Tracker struct {
+	h              host.Host
+	interfaceAddrs func() ([]ma.Multiaddr, error)
+
+	mu     sync.Mutex
+	events []Event
+	subs   map[chan Event]struct{}
+	lost   map[peer.ID]lostConn
+	local  map[string]bool
+}
+
+// New creates a Tracker for h. Start starts tracking.
+func New(h host.Host) *Tracker {
+	return &Tracker{
+		h:              h,
+		interfaceAddrs: manet.InterfaceMultiaddrs,
+		subs:           make(map[chan Event]struct{}),
+		lost:           make(map[peer.ID]lostConn),
+	}
+}
+
+// Start records the connection events of the host, and polls the addresses
+// of the network interfaces until ctx is done.
+func (t *Tracker) Start(ctx context.Context) {
+	t.h.Network().Notify((*notifiee)(t))
+	if ips, err := t.localIPs(); err == nil {
+		t.local = ips
+	}
+	go t.poll(ctx)
+}
+
+// Events returns the recent events, oldest first.
+func (t *Tracker) Events() []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Event(nil), t.events...)
+}
+
+// Subscribe returns a channel receiving the new events, until cancel is
+// called. Events are dropped if the channel isn't drained.
+func (t *Tracker) Subscribe() (events <-chan Event, cancel func()) {
+	ch := make(chan Event, 64)
+	t.mu.Lock()
+	t.subs[ch] = struct{}{}
+	t.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			t.mu.Lock()
+			delete(t.subs, ch)
+			t.mu.Unlock()
+		})
+	}
+}
+
+// emitLocked records ev and sends it to the subscribers.
+func (t *Tracker) emitLocked(ev Event) {
+	ev.Time = time.Now()
+	if len(t.events) == maxEvents {
+		copy(t.events, t.events[1:])
+		t.events = t.events[:maxEvents-1]
+	}
+	t.events = append(t.events, ev)
+
+	for ch := range t.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (t *Tracker) connected(p peer.ID, addr ma.Multiaddr) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ev := Event{Type: Connected, Peer: p.Pretty(), Addr: addr.String()}
+	if l, ok := t.lost[p]; ok {
+		delete(t.lost, p)
+		if time.Since(l.at) < MigrateWindow && l.addr != ev.Addr {
+			ev.Type = Migrated
+			ev.OldAddr = l.addr
+		}
+	}
+	t.emitLocked(ev)
+}
+
+func (t *Tracker) disconnected(p peer.ID, addr ma.Multiaddr) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for lp, l := range t.lost {
+		if now.Sub(l.at) >= MigrateWindow {
+			delete(t.lost, lp)
+		}
+	}
+	t.lost[p] = lostConn{addr: addr.String(), at: now}
+	t.emitLocked(Event{Type: Disconnected, Peer: p.Pretty(), Addr: addr.String()})
+}
+
+func (t *Tracker) poll(ctx context.Context) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		t.checkAddrs(ctx)
+	}
+}
+
+// checkAddrs closes the connections whose local address is gone when the
+// addresses of the network interfaces change, and redials their peers.
+func (t *Tracker) checkAddrs(ctx context.Context) {
+	ips, err := t.localIPs()
+	if err != nil {
+		log.Warningf("listing the interface addresses: %s", err)
+		return
+	}
+
+	t.mu.Lock()
+	changed := !sameSet(ips, t.local)
+	t.local = ips
+	if changed {
+		local := make([]string, 0, len(ips))
+		for ip := range ips {
+			local = append(local, ip)
+		}
+		sort.Strings(local)
+		t.emitLocked(Event{Type: AddrsChanged, Local: local})
+	}
+	t.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	var stale []peer.ID
+	for _, c := range t.h.Network().Conns() {
+		ip, ok := addrIP(c.LocalMultiaddr())
+		if !ok || ips[ip] {
+			continue
+		}
+		stale = append(stale, c.RemotePeer())
+		c.Close()
+	}
+	if len(stale) > 0 {
+		log.Infof("local addresses changed, reconnecting to %d peers", len(stale))
+	}
+
+	for _, p := range stale {
+		go func(p peer.ID) {
+			ctx, cancel := context.WithTimeout(ctx, redialTimeout)
+			defer cancel()
+			if err := t.h.Connect(ctx, peer.AddrInfo{ID: p}); err != nil {
+				log.Debugf("reconnecting to %s: %s", p.Pretty(), err)
+			}
+		}(p)
+	}
+}
+
+// localIPs returns the IPs of the network interfaces.
+func (t *Tracker) localIPs() (map[string]bool, error) {
+	addrs, err := t.interfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	ips := make(map[string]bool, len(addrs))
+	for _, a := range addrs {
+		if ip, ok := addrIP(a); ok {
+			ips[ip] = true
+		}
+	}
+	return ips, nil
+}
+
+// addrIP returns the IP component of a, if it is a specified IP.
+func addrIP(a ma.Multiaddr) (string, bool) {
+	first, _ := ma.SplitFirst(a)
+	if first == nil || manet.IsIPUnspecified(first) {
+		return "", false
+	}
+	switch first.Protocol().Code {
+	case ma.P_IP4, ma.P_IP6:
+		return first.Value(), true
+	default:
+		return "", false
+	}
+}
+
+func sameSet(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if !b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+type notifiee Tracker
+
+func (n *notifiee) Connected(_ inet.Network, c inet.Conn) {
+	(*Tracker)(n).connected(c.RemotePeer(), c.RemoteMultiaddr())
+}
+
+func (n *notifiee) Disconnected(_ inet.Network, c inet.Conn) {
+	(*Tracker)(n).disconnected(c.RemotePeer(), c.RemoteMultiaddr())
+}
+
+func (n *notifiee) Listen(inet.Network, ma.Multiaddr)      {}
+func (n *notifiee) ListenClose(inet.Network, ma.Multiaddr) {}
+func (n *notifiee) OpenedStream(inet.Network, inet.Stream) {}
+func (n *notifiee) ClosedStream(inet.Network, inet.Stream) {}
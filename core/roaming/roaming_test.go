@@ -0,0 +1,91 @@
+package roaming
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestMigration(t *testing.T) {
+	tr := New(nil)
+	events, cancel := tr.Subscribe()
+	defer cancel()
+
+	p := peer.ID("roaming")
+	wifi := ma.StringCast("/ip4/192.168.1.20/udp/4001/quic")
+	lte := ma.StringCast("/ip4/10.64.3.7/udp/4001/quic")
+
+	tr.connected(p, wifi)
+	tr.disconnected(p, wifi)
+	tr.connected(p, lte)
+	tr.disconnected(p, lte)
+	tr.connected(p, lte)
+
+	want := []EventType{Connected, Disconnected, Migrated, Disconnected, Connected}
+	got := tr.Events()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d events, got %v", len(want), got)
+	}
+	for i, ev := range got {
+		if ev.Type != want[i] {
+			t.Fatalf("event %d: expected %s, got %+v", i, want[i], ev)
+		}
+	}
+	if ev := got[2]; ev.Addr != lte.String() || ev.OldAddr != wifi.String() {
+		t.Fatalf("unexpected migration: %+v", ev)
+	}
+
+	for i := range want {
+		select {
+		case ev := <-events:
+			if ev.Type != want[i] {
+				t.Fatalf("event %d: expected %s, got %+v", i, want[i], ev)
+			}
+		default:
+			t.Fatal("expected the subscription to receive the events")
+		}
+	}
+}
+
+func TestAddrsChanged(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mn.Hosts()[0]
+	local, _ := addrIP(h.Network().Conns()[0].LocalMultiaddr())
+
+	tr := New(h)
+	addrs := []ma.Multiaddr{ma.StringCast("/ip4/" + local)}
+	tr.interfaceAddrs = func() ([]ma.Multiaddr, error) { return addrs, nil }
+	tr.Start(ctx)
+
+	// the same addresses: nothing happens
+	tr.checkAddrs(ctx)
+	if len(tr.Events()) != 0 || len(h.Network().Conns()) != 1 {
+		t.Fatalf("unexpected events: %v", tr.Events())
+	}
+
+	// the address of the connection is gone
+	addrs = []ma.Multiaddr{ma.StringCast("/ip4/10.64.3.7")}
+	tr.checkAddrs(ctx)
+
+	var types []EventType
+	for i := 0; i < 50 && len(types) < 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+		types = types[:0]
+		for _, ev := range tr.Events() {
+			types = append(types, ev.Type)
+		}
+	}
+	if len(types) < 3 || types[0] != AddrsChanged || types[1] != Disconnected || types[2] != Connected {
+		t.Fatalf("expected the connection to be closed and redialed, got %v", types)
+	}
+}
@@ -0,0 +1,557 @@
+// Package slo watches the latency and the availability of chosen peers, such
+// as the replication partners of a node, against service level objectives.
+//
+// The peers of each objective are pinged every Interval. A ping is good when
+// it succeeds within the MaxLatency of the objective; the objective is
+// breached for a peer when, over a whole Window, the share of good pings falls
+// below its Target. A breach opens an incident, which is resolved once the
+// share of good pings is back over the target. Incidents are logged, posted to
+// a webhook if configured, and kept in the datastore for 'ipfs slo report'.
+package slo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log"
+	"github.com/jbenet/goprocess"
+	"github.com/jbenet/goprocess/periodic"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ping "github.com/libp2p/go-libp2p/p2p/protocol/ping"
+)
+
+var log = logging.Logger("slo")
+
+// ConfigKey is the key of the SLO section in the repo config.
+const ConfigKey = "SLO"
+
+// By default, the peers are pinged every 30 seconds, and an objective expects
+// 99% of good pings over 5 minutes.
+const (
+	DefaultInterval = 30 * time.Second
+	DefaultWindow   = 5 * time.Minute
+	DefaultTarget   = 99.0
+)
+
+// maxPingTimeout bounds the wait for a ping.
+const maxPingTimeout = 10 * time.Second
+
+// webhookTimeout bounds the posting of an alert.
+const webhookTimeout = 10 * time.Second
+
+// maxIncidents is the number of incidents kept in the datastore.
+const maxIncidents = 1000
+
+var incidentsPrefix = ds.NewKey("/local/slo/incidents")
+
+// Config holds the SLO config section.
+type Config struct {
+	// Interval is the time between two pings of a peer, e.g. "30s".
+	Interval string
+
+	// Webhook, when set, is the URL the alerts are posted to, as JSON.
+	Webhook string
+
+	Objectives []Objective
+}
+
+// Objective is the service level objective of a set of peers.
+type Objective struct {
+	Name string
+
+	// Peers are the peer IDs the objective applies to.
+	Peers []string
+	// Protected applies the objective to the peers of
+	// Swarm.ProtectedPeers as well.
+	Protected bool
+
+	// MaxLatency, when set, is the round trip time above which a ping
+	// counts as bad, e.g. "200ms".
+	MaxLatency string
+	// Target is the percentage of good pings expected over Window.
+	Target float64
+	// Window is the time the pings are measured over, e.g. "5m".
+	Window string
+}
+
+// LoadConfig reads the SLO section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// Incident is a breach of an objective by a peer.
+type Incident struct {
+	Objective string
+	Peer      string
+	Start     time.Time
+	// End is unset while the incident is open.
+	End *time.Time `json:",omitempty"`
+
+	// Good is the percentage of good pings when the incident opened, and
+	// Worst the lowest one during the incident.
+	Good  float64
+	Worst float64
+	// Target is the percentage of good pings expected.
+	Target float64
+
+	// Interrupted is set on the incidents left open when the node stopped.
+	Interrupted bool `json:",omitempty"`
+}
+
+func (inc *Incident) key() ds.Key {
+	return incidentsPrefix.ChildString(fmt.Sprintf("%020d-%s-%s", inc.Start.UnixNano(), inc.Peer, inc.Objective))
+}
+
+// Alert is the body of the requests posted to the webhook.
+type Alert struct {
+	// Event is "breach" when an incident opens, "resolved" when it ends.
+	Event    string
+	Incident *Incident
+}
+
+// Status is the state of an objective for a peer.
+type Status struct {
+	Objective string
+	Peer      string
+
+	// Pings is the number of pings in the window, and Good the percentage
+	// of them that were good.
+	Pings int
+	Good  float64
+	// Latency is the mean round trip time of the successful pings.
+	Latency time.Duration
+	// Measured is set once the pings cover a whole window.
+	Measured bool
+	Breached bool
+}
+
+type sample struct {
+	time    time.Time
+	ok      bool
+	latency time.Duration
+}
+
+// series are the pings of a peer for an objective.
+type series struct {
+	first    time.Time
+	samples  []sample
+	incident *Incident
+}
+
+type objective struct {
+	name       string
+	peers      []peer.ID
+	protected  bool
+	maxLatency time.Duration
+	target     float64
+	window     time.Duration
+
+	series map[peer.ID]*series
+}
+
+// Monitor pings the peers of the objectives and records the incidents.
+type Monitor struct {
+	h         host.Host
+	d         ds.Datastore
+	interval  time.Duration
+	webhook   string
+	protected func() ([]peer.ID, error)
+
+	mu         sync.Mutex
+	objectives []*objective
+
+	proc goprocess.Process
+}
+
+// New returns a monitor of the objectives of cfg, or nil if there are none.
+// protected returns the peers of Swarm.ProtectedPeers. The incidents left
+// open in d by a previous run are closed.
+func New(h host.Host, d ds.Datastore, cfg Config, protected func() ([]peer.ID, error)) (*Monitor, error) {
+	if len(cfg.Objectives) == 0 {
+		return nil, nil
+	}
+	m := &Monitor{
+		h:         h,
+		d:         d,
+		webhook:   cfg.Webhook,
+		protected: protected,
+	}
+
+	var err error
+	if m.interval, err = repo.ConfigDuration(ConfigKey, "Interval", cfg.Interval, DefaultInterval); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for i, o := range cfg.Objectives {
+		field := fmt.Sprintf("Objectives[%d]", i)
+		if o.Name == "" || strings.ContainsAny(o.Name, "/ ") {
+			return nil, fmt.Errorf("invalid %s.%s.Name %q", ConfigKey, field, o.Name)
+		}
+		if names[o.Name] {
+			return nil, fmt.Errorf("duplicate objective %q in %s", o.Name, ConfigKey)
+		}
+		names[o.Name] = true
+
+		obj := &objective{
+			name:      o.Name,
+			protected: o.Protected,
+			target:    o.Target,
+			series:    make(map[peer.ID]*series),
+		}
+		if obj.target == 0 {
+			obj.target = DefaultTarget
+		}
+		if obj.target < 0 || obj.target > 100 {
+			return nil, fmt.Errorf("invalid %s.%s.Target: expected a percentage", ConfigKey, field)
+		}
+		if obj.maxLatency, err = repo.ConfigDuration(ConfigKey, field+".MaxLatency", o.MaxLatency, 0); err != nil {
+			return nil, err
+		}
+		if obj.window, err = repo.ConfigDuration(ConfigKey, field+".Window", o.Window, DefaultWindow); err != nil {
+			return nil, err
+		}
+		for _, s := range o.Peers {
+			p, err := peer.Decode(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid peer ID %q in %s.%s.Peers: %s", s, ConfigKey, field, err)
+			}
+			obj.peers = append(obj.peers, p)
+		}
+		if len(obj.peers) == 0 && !obj.protected {
+			return nil, fmt.Errorf("%s.%s applies to no peer", ConfigKey, field)
+		}
+		m.objectives = append(m.objectives, obj)
+	}
+
+	if err := m.closeInterrupted(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Start pings the peers every interval until Close is called.
+func (m *Monitor) Start() {
+	m.proc = periodic.Every(m.interval, func(proc goprocess.Process) {
+		m.round(goprocess.WithProcessClosing(context.Background(), proc))
+	})
+}
+
+// Close stops the monitor. The incidents still open stay open in the
+// datastore, and are closed as interrupted by the next run.
+func (m *Monitor) Close() error {
+	if m.proc == nil {
+		return nil
+	}
+	return m.proc.Close()
+}
+
+// peersOf returns the peers of o.
+func (m *Monitor) peersOf(o *objective) []peer.ID {
+	if !o.protected || m.protected == nil {
+		return o.peers
+	}
+	protected, err := m.protected()
+	if err != nil {
+		log.Errorf("reading the protected peers: %s", err)
+		return o.peers
+	}
+	seen := make(map[peer.ID]bool)
+	var peers []peer.ID
+	for _, p := range append(o.peers, protected...) {
+		if !seen[p] {
+			seen[p] = true
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// round pings the peers of every objective once.
+func (m *Monitor) round(ctx context.Context) {
+	timeout := m.interval
+	if timeout > maxPingTimeout {
+		timeout = maxPingTimeout
+	}
+
+	// a peer shared by several objectives is pinged once
+	m.mu.Lock()
+	targets := make(map[*objective][]peer.ID)
+	all := make(map[peer.ID]struct{})
+	for _, o := range m.objectives {
+		targets[o] = m.peersOf(o)
+		for _, p := range targets[o] {
+			all[p] = struct{}{}
+		}
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	var resMu sync.Mutex
+	results := make(map[peer.ID]sample, len(all))
+	for p := range all {
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			s := m.ping(ctx, p, timeout)
+			resMu.Lock()
+			results[p] = s
+			resMu.Unlock()
+		}(p)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	for o, peers := range targets {
+		for _, p := range peers {
+			m.record(o, p, results[p])
+		}
+	}
+}
+
+func (m *Monitor) ping(ctx context.Context, p peer.ID, timeout time.Duration) sample {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	s := sample{time: time.Now()}
+	r, ok := <-ping.Ping(ctx, m.h, p)
+	if ok && r.Error == nil {
+		s.ok = true
+		s.latency = r.RTT
+	}
+	return s
+}
+
+// record adds the ping s of p to o, and opens or resolves the incident of p.
+func (m *Monitor) record(o *objective, p peer.ID, s sample) {
+	if s.ok && o.maxLatency > 0 && s.latency > o.maxLatency {
+		s.ok = false
+	}
+
+	m.mu.Lock()
+	sr, ok := o.series[p]
+	if !ok {
+		sr = &series{first: s.time}
+		o.series[p] = sr
+	}
+	sr.samples = append(sr.samples, s)
+	start := s.time.Add(-o.window)
+	for len(sr.samples) > 0 && sr.samples[0].time.Before(start) {
+		sr.samples = sr.samples[1:]
+	}
+	st := o.status(p, sr, s.time)
+
+	var event string
+	var inc Incident
+	switch {
+	case st.Breached && sr.incident == nil:
+		sr.incident = &Incident{
+			Objective: o.name,
+			Peer:      p.Pretty(),
+			Start:     s.time,
+			Good:      st.Good,
+			Worst:     st.Good,
+			Target:    o.target,
+		}
+		event, inc = "breach", *sr.incident
+	case sr.incident != nil && st.Good < sr.incident.Worst:
+		sr.incident.Worst = st.Good
+	}
+	if sr.incident != nil && st.Measured && !st.Breached {
+		end := s.time
+		sr.incident.End = &end
+		event, inc = "resolved", *sr.incident
+		sr.incident = nil
+	}
+	m.mu.Unlock()
+
+	if event == "" {
+		return
+	}
+	if event == "breach" {
+		log.Warningf("objective %s breached by peer %s: %.1f%% of good pings over %s, below %.1f%%", inc.Objective, inc.Peer, inc.Good, o.window, inc.Target)
+	} else {
+		log.Infof("objective %s met again by peer %s, after %s", inc.Objective, inc.Peer, inc.End.Sub(inc.Start).Round(time.Second))
+	}
+	if err := m.save(&inc); err != nil {
+		log.Errorf("saving the incident: %s", err)
+	}
+	if m.webhook != "" {
+		go m.post(&Alert{Event: event, Incident: &inc})
+	}
+}
+
+// status returns the status of p for o, at now. It is called with mu held.
+func (o *objective) status(p peer.ID, sr *series, now time.Time) Status {
+	st := Status{
+		Objective: o.name,
+		Peer:      p.Pretty(),
+		Pings:     len(sr.samples),
+		Measured:  !now.Before(sr.first.Add(o.window)),
+	}
+	var good, answered int
+	var total time.Duration
+	for _, s := range sr.samples {
+		if s.ok {
+			good++
+		}
+		if s.latency > 0 {
+			answered++
+			total += s.latency
+		}
+	}
+	if answered > 0 {
+		st.Latency = total / time.Duration(answered)
+	}
+	if st.Pings > 0 {
+		st.Good = 100 * float64(good) / float64(st.Pings)
+	}
+	st.Breached = st.Measured && st.Pings > 0 && st.Good < o.target
+	return st
+}
+
+// Status returns the status of every peer of every objective.
+func (m *Monitor) Status() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var out []Status
+	for _, o := range m.objectives {
+		for p, sr := range o.series {
+			out = append(out, o.status(p, sr, now))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Objective != out[j].Objective {
+			return out[i].Objective < out[j].Objective
+		}
+		return out[i].Peer < out[j].Peer
+	})
+	return out
+}
+
+// Incidents returns the incidents open, or started since since, the most
+// recent first.
+func (m *Monitor) Incidents(since time.Time) ([]Incident, error) {
+	res, err := m.d.Query(query.Query{Prefix: incidentsPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Incident
+	for _, e := range entries {
+		var inc Incident
+		if err := json.Unmarshal(e.Value, &inc); err != nil {
+			log.Errorf("ignoring the invalid incident %s: %s", e.Key, err)
+			continue
+		}
+		if inc.End == nil || !inc.Start.Before(since) {
+			out = append(out, inc)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Start.After(out[j].Start)
+	})
+	return out, nil
+}
+
+// save stores inc, and removes the oldest incidents past maxIncidents.
+func (m *Monitor) save(inc *Incident) error {
+	data, err := json.Marshal(inc)
+	if err != nil {
+		return err
+	}
+	if err := m.d.Put(inc.key(), data); err != nil {
+		return err
+	}
+
+	res, err := m.d.Query(query.Query{Prefix: incidentsPrefix.String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+	if len(entries) <= maxIncidents {
+		return nil
+	}
+	// the keys start with the time the incidents started
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	for _, e := range entries[:len(entries)-maxIncidents] {
+		if err := m.d.Delete(ds.RawKey(e.Key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeInterrupted closes the incidents left open by a previous run, at the
+// time they are found.
+func (m *Monitor) closeInterrupted() error {
+	open, err := m.Incidents(time.Now())
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range open {
+		inc := &open[i]
+		if inc.End != nil {
+			continue
+		}
+		inc.End = &now
+		inc.Interrupted = true
+		if err := m.save(inc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// post sends a to the webhook.
+func (m *Monitor) post(a *Alert) {
+	body, err := json.Marshal(a)
+	if err != nil {
+		log.Errorf("encoding the alert: %s", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest("POST", m.webhook, bytes.NewReader(body))
+	if err != nil {
+		log.Errorf("posting the alert: %s", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		log.Errorf("posting the alert: %s", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Errorf("posting the alert: the webhook answered %s", resp.Status)
+	}
+}
@@ -0,0 +1,127 @@
+package slo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+const testPeer = "QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ"
+
+func TestIncidents(t *testing.T) {
+	alerts := make(chan Alert, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Error(err)
+		}
+		alerts <- a
+	}))
+	defer srv.Close()
+
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	cfg := Config{
+		Webhook: srv.URL,
+		Objectives: []Objective{{
+			Name:       "replicas",
+			Peers:      []string{testPeer},
+			MaxLatency: "100ms",
+			Target:     75,
+			Window:     "1m",
+		}},
+	}
+	m, err := New(nil, d, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := m.objectives[0]
+	p, _ := peer.Decode(testPeer)
+
+	start := time.Now().Add(-time.Hour)
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * 15 * time.Second) }
+	good := func(i int) sample { return sample{time: at(i), ok: true, latency: 10 * time.Millisecond} }
+	slow := func(i int) sample { return sample{time: at(i), ok: true, latency: time.Second} }
+	lost := func(i int) sample { return sample{time: at(i)} }
+
+	// no breach before the pings cover a whole window
+	m.record(o, p, lost(0))
+	m.record(o, p, lost(1))
+	if st := m.Status(); len(st) != 1 || st[0].Measured || st[0].Breached {
+		t.Fatalf("expected a peer being measured, got %+v", st)
+	}
+	m.record(o, p, good(2))
+	m.record(o, p, good(3))
+	m.record(o, p, slow(4))
+
+	a := <-alerts
+	if a.Event != "breach" || a.Incident.Peer != testPeer || a.Incident.Good != 40 {
+		t.Fatalf("unexpected alert %+v", a)
+	}
+	st := m.Status()[0]
+	if !st.Breached || st.Pings != 5 {
+		t.Fatalf("expected a breach over 5 pings, got %+v", st)
+	}
+
+	// the lost pings leave the window
+	m.record(o, p, good(5))
+	m.record(o, p, good(6))
+	m.record(o, p, good(7))
+	a = <-alerts
+	if a.Event != "resolved" || a.Incident.End == nil || a.Incident.Worst != 40 {
+		t.Fatalf("unexpected alert %+v", a)
+	}
+
+	m.record(o, p, lost(8))
+	m.record(o, p, lost(9))
+	m.record(o, p, lost(10))
+	<-alerts
+
+	incs, err := m.Incidents(time.Now().Add(-2 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incs) != 2 || incs[0].End != nil || incs[1].End == nil {
+		t.Fatalf("expected an open incident, then a resolved one, got %+v", incs)
+	}
+	if incs, _ = m.Incidents(time.Now()); len(incs) != 1 {
+		t.Fatalf("expected only the open incident, got %+v", incs)
+	}
+
+	// the next run closes the open incident
+	m, err = New(nil, d, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	incs, err = m.Incidents(time.Now().Add(-2 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incs) != 2 || incs[0].End == nil || !incs[0].Interrupted {
+		t.Fatalf("expected the open incident to be interrupted, got %+v", incs)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	d := ds.NewMapDatastore()
+	if m, err := New(nil, d, Config{}, nil); m != nil || err != nil {
+		t.Fatalf("expected no monitor without objectives, got %v, %v", m, err)
+	}
+	for _, o := range []Objective{
+		{Name: "", Peers: []string{testPeer}},
+		{Name: "a", Peers: []string{"not-a-peer"}},
+		{Name: "a"},
+		{Name: "a", Peers: []string{testPeer}, Target: 101},
+		{Name: "a", Peers: []string{testPeer}, Window: "-1m"},
+		{Name: "a", Peers: []string{testPeer}, MaxLatency: "fast"},
+	} {
+		if _, err := New(nil, d, Config{Objectives: []Objective{o}}, nil); err == nil {
+			t.Errorf("expected an error for %+v", o)
+		}
+	}
+}
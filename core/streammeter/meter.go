@@ -0,0 +1,207 @@
+// Package streammeter counts the bytes transferred on each stream, and when
+// it was opened.
+//
+// Streams are metered by wrapping the host: the streams opened with NewStream
+// and the streams passed to the stream handlers are tracked until they are
+// closed or reset. Streams opened by libp2p itself, such as identify, bypass
+// the wrapped host and aren't metered.
+package streammeter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	host "github.com/libp2p/go-libp2p-core/host"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// Info describes a metered stream.
+type Info struct {
+	Protocol     protocol.ID
+	Direction    inet.Direction
+	Opened       time.Time
+	BytesRead    int64
+	BytesWritten int64
+}
+
+// Meter tracks the open streams of a host.
+type Meter struct {
+	mu      sync.Mutex
+	streams map[inet.Conn]map[*stream]struct{}
+}
+
+// New creates a Meter.
+func New() *Meter {
+	return &Meter{streams: make(map[inet.Conn]map[*stream]struct{})}
+}
+
+// Host wraps h to meter its streams. It is safe to call on a nil Meter, in
+// which case h is returned as is.
+func (m *Meter) Host(h host.Host) host.Host {
+	if m == nil {
+		return h
+	}
+	return &meteredHost{Host: h, m: m}
+}
+
+// Streams returns the metered streams of the connection c.
+func (m *Meter) Streams(c inet.Conn) []Info {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]Info, 0, len(m.streams[c]))
+	for s := range m.streams[c] {
+		out = append(out, s.info())
+	}
+	return out
+}
+
+// Prune forgets the streams of the connections which are not in conns, in
+// case they were not closed before their connection was.
+func (m *Meter) Prune(conns []inet.Conn) {
+	if m == nil {
+		return
+	}
+
+	open := make(map[inet.Conn]bool, len(conns))
+	for _, c := range conns {
+		open[c] = true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for c := range m.streams {
+		if !open[c] {
+			delete(m.streams, c)
+		}
+	}
+}
+
+func (m *Meter) track(s inet.Stream, dir inet.Direction) inet.Stream {
+	ms := &stream{Stream: s, m: m, dir: dir, opened: time.Now()}
+	c := s.Conn()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.streams[c] == nil {
+		m.streams[c] = make(map[*stream]struct{})
+	}
+	m.streams[c][ms] = struct{}{}
+	return ms
+}
+
+func (m *Meter) untrack(s *stream) {
+	c := s.Conn()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.streams[c], s)
+	if len(m.streams[c]) == 0 {
+		delete(m.streams, c)
+	}
+}
+
+type meteredHost struct {
+	host.Host
+	m *Meter
+}
+
+func (h *meteredHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (inet.Stream, error) {
+	s, err := h.Host.NewStream(ctx, p, pids...)
+	if err != nil {
+		return nil, err
+	}
+	return h.m.track(s, inet.DirOutbound), nil
+}
+
+func (h *meteredHost) wrap(handler inet.StreamHandler) inet.StreamHandler {
+	return func(s inet.Stream) {
+		handler(h.m.track(s, inet.DirInbound))
+	}
+}
+
+func (h *meteredHost) SetStreamHandler(pid protocol.ID, handler inet.StreamHandler) {
+	h.Host.SetStreamHandler(pid, h.wrap(handler))
+}
+
+func (h *meteredHost) SetStreamHandlerMatch(pid protocol.ID, match func(string) bool, handler inet.StreamHandler) {
+	h.Host.SetStreamHandlerMatch(pid, match, h.wrap(handler))
+}
+
+type stream struct {
+	// read and written come first, to be 64-bit aligned for atomic access.
+	read    int64
+	written int64
+
+	inet.Stream
+	m *Meter
+
+	dir    inet.Direction
+	opened time.Time
+
+	mu          sync.Mutex
+	writeClosed bool
+	readDone    bool
+	untracked   bool
+}
+
+func (s *stream) Read(b []byte) (int, error) {
+	n, err := s.Stream.Read(b)
+	atomic.AddInt64(&s.read, int64(n))
+	if err != nil {
+		s.done(func() { s.readDone = true })
+	}
+	return n, err
+}
+
+func (s *stream) Write(b []byte) (int, error) {
+	n, err := s.Stream.Write(b)
+	atomic.AddInt64(&s.written, int64(n))
+	return n, err
+}
+
+// Close closes the stream for writing; it stays tracked until the remote
+// end closes it too.
+func (s *stream) Close() error {
+	s.done(func() { s.writeClosed = true })
+	return s.Stream.Close()
+}
+
+func (s *stream) Reset() error {
+	s.done(func() { s.writeClosed, s.readDone = true, true })
+	return s.Stream.Reset()
+}
+
+// done applies f to the state of the stream, and untracks it once it is
+// closed both ways.
+func (s *stream) done(f func()) {
+	s.mu.Lock()
+	f()
+	untrack := s.writeClosed && s.readDone && !s.untracked
+	if untrack {
+		s.untracked = true
+	}
+	s.mu.Unlock()
+
+	if untrack {
+		s.m.untrack(s)
+	}
+}
+
+func (s *stream) info() Info {
+	return Info{
+		Protocol:     s.Protocol(),
+		Direction:    s.dir,
+		Opened:       s.opened,
+		BytesRead:    atomic.LoadInt64(&s.read),
+		BytesWritten: atomic.LoadInt64(&s.written),
+	}
+}
@@ -0,0 +1,83 @@
+package streammeter
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	inet "github.com/libp2p/go-libp2p-core/network"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+const testProtocol = "/test/meter/1.0.0"
+
+func TestMeter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+
+	m := New()
+	a, b := m.Host(hosts[0]), m.Host(hosts[1])
+
+	handled := make(chan struct{})
+	b.SetStreamHandler(testProtocol, func(s inet.Stream) {
+		defer close(handled)
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(s, buf); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := s.Write(buf[:3]); err != nil {
+			t.Error(err)
+		}
+	})
+
+	s, err := a.NewStream(ctx, b.ID(), testProtocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(s, make([]byte, 3)); err != nil {
+		t.Fatal(err)
+	}
+	<-handled
+
+	check := func(c inet.Conn, dir inet.Direction, read, written int64) {
+		t.Helper()
+		infos := m.Streams(c)
+		if len(infos) != 1 {
+			t.Fatalf("expected 1 stream, got %d", len(infos))
+		}
+		info := infos[0]
+		if info.Protocol != testProtocol || info.Direction != dir || info.Opened.IsZero() {
+			t.Fatalf("unexpected stream: %+v", info)
+		}
+		if info.BytesRead != read || info.BytesWritten != written {
+			t.Fatalf("expected %d bytes read and %d written, got %d and %d", read, written, info.BytesRead, info.BytesWritten)
+		}
+	}
+	check(s.Conn(), inet.DirOutbound, 3, 5)
+	check(b.Network().ConnsToPeer(a.ID())[0], inet.DirInbound, 5, 3)
+
+	if err := s.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if infos := m.Streams(s.Conn()); len(infos) != 0 {
+		t.Fatalf("expected a reset stream to be untracked, got %+v", infos)
+	}
+}
+
+func TestNilMeter(t *testing.T) {
+	var m *Meter
+	if m.Streams(nil) != nil {
+		t.Fatal("expected no streams")
+	}
+	m.Prune(nil)
+}
@@ -0,0 +1,414 @@
+// Package testnet spawns ephemeral, fully connected networks of IPFS nodes
+// for integration tests and local experiments.
+//
+// Nodes either run in-process, in which case each node exposes its
+// *core.IpfsNode and CoreAPI, or as 'ipfs daemon' subprocesses sharing a
+// temporary directory. Identities and the optional private network key are
+// derived from Options.Seed so that a given seed always yields the same peer
+// IDs.
+package testnet
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	repo "github.com/ipfs/go-ipfs/repo"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+
+	datastore "github.com/ipfs/go-datastore"
+	syncds "github.com/ipfs/go-datastore/sync"
+	config "github.com/ipfs/go-ipfs-config"
+	logging "github.com/ipfs/go-log"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("testnet")
+
+// daemonStartTimeout bounds how long we wait for a subprocess daemon to
+// expose its API.
+const daemonStartTimeout = time.Minute
+
+// Options configures a test network.
+type Options struct {
+	// N is the number of nodes to spawn.
+	N int
+
+	// PNet puts all nodes in a private network sharing a generated key.
+	PNet bool
+
+	// Seed derives the node identities and the network key.
+	Seed int64
+
+	// Subprocess runs every node as an 'ipfs daemon' process instead of
+	// in-process.
+	Subprocess bool
+
+	// Binary is the ipfs executable used in subprocess mode. Defaults to
+	// "ipfs" in $PATH.
+	Binary string
+
+	// Dir is where subprocess repos are created. Defaults to a new temporary
+	// directory, removed on Close.
+	Dir string
+}
+
+// Node is a member of a test network.
+type Node struct {
+	Index int
+	ID    peer.ID
+	Addrs []ma.Multiaddr
+
+	// Node and API are only set for in-process nodes.
+	Node *core.IpfsNode
+	API  coreiface.CoreAPI
+
+	// Repo is the IPFS_PATH of subprocess nodes.
+	Repo string
+
+	bin string
+	cmd *exec.Cmd
+}
+
+// Network is a set of spawned nodes.
+type Network struct {
+	Nodes []*Node
+
+	// SwarmKey is the private network key, if any, in swarm.key format.
+	SwarmKey []byte
+
+	cancel  context.CancelFunc
+	tempDir string
+}
+
+// Spawn starts a network of opts.N nodes and connects every pair of them.
+// The returned network must be closed by the caller.
+func Spawn(ctx context.Context, opts Options) (*Network, error) {
+	if opts.N <= 0 {
+		return nil, fmt.Errorf("testnet: need at least one node, got %d", opts.N)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	tn := &Network{cancel: cancel}
+	if opts.PNet {
+		tn.SwarmKey = swarmKey(opts.Seed)
+	}
+
+	var err error
+	if opts.Subprocess {
+		err = tn.spawnProcesses(ctx, opts)
+	} else {
+		err = tn.spawnInProcess(ctx, opts)
+	}
+	if err == nil {
+		err = tn.ConnectAll(ctx)
+	}
+	if err != nil {
+		tn.Close()
+		return nil, err
+	}
+	return tn, nil
+}
+
+// ConnectAll connects every pair of nodes in the network.
+func (tn *Network) ConnectAll(ctx context.Context) error {
+	for i, a := range tn.Nodes {
+		for _, b := range tn.Nodes[i+1:] {
+			if err := a.Connect(ctx, b); err != nil {
+				return fmt.Errorf("testnet: connecting node %d to node %d: %s", a.Index, b.Index, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close stops every node and removes temporary repos.
+func (tn *Network) Close() error {
+	var firstErr error
+	for _, n := range tn.Nodes {
+		if err := n.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	tn.cancel()
+	if tn.tempDir != "" {
+		if err := os.RemoveAll(tn.tempDir); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Connect connects n to other.
+func (n *Node) Connect(ctx context.Context, other *Node) error {
+	if n.Node != nil {
+		return n.Node.PeerHost.Connect(ctx, peer.AddrInfo{ID: other.ID, Addrs: other.Addrs})
+	}
+
+	if len(other.Addrs) == 0 {
+		return fmt.Errorf("node %d has no addresses", other.Index)
+	}
+	addr := fmt.Sprintf("%s/p2p/%s", other.Addrs[0], other.ID.Pretty())
+	_, err := n.Run(ctx, "swarm", "connect", addr)
+	return err
+}
+
+// Run runs an ipfs command against a subprocess node and returns its
+// standard output.
+func (n *Node) Run(ctx context.Context, args ...string) ([]byte, error) {
+	if n.cmd == nil {
+		return nil, errors.New("testnet: Run is only supported on subprocess nodes")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, n.bin, args...)
+	cmd.Env = append(os.Environ(), "IPFS_PATH="+n.Repo)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ipfs %v: %s: %s", args, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func (n *Node) close() error {
+	if n.Node != nil {
+		return n.Node.Close()
+	}
+	if n.cmd != nil && n.cmd.Process != nil {
+		if err := n.cmd.Process.Signal(os.Interrupt); err != nil {
+			return n.cmd.Process.Kill()
+		}
+		// The daemon exits with a non-zero status when interrupted.
+		_ = n.cmd.Wait()
+	}
+	return nil
+}
+
+func (tn *Network) spawnInProcess(ctx context.Context, opts Options) error {
+	nodes := make([]*Node, opts.N)
+	errs := make([]error, opts.N)
+
+	var wg sync.WaitGroup
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			nodes[i], errs[i] = tn.newInProcessNode(ctx, opts, i)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, n := range nodes {
+		if n != nil {
+			tn.Nodes = append(tn.Nodes, n)
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tn *Network) newInProcessNode(ctx context.Context, opts Options, i int) (*Node, error) {
+	cfg, err := nodeConfig(opts.Seed, i, "/ip4/127.0.0.1/tcp/0")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &repo.Mock{
+		C:   *cfg,
+		D:   syncds.MutexWrap(datastore.NewMapDatastore()),
+		K:   keystore.NewMemKeystore(),
+		PSK: tn.SwarmKey,
+	}
+
+	nd, err := core.NewNode(ctx, &core.BuildCfg{
+		Online: true,
+		Repo:   r,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	api, err := coreapi.NewCoreAPI(nd)
+	if err != nil {
+		nd.Close()
+		return nil, err
+	}
+
+	return &Node{
+		Index: i,
+		ID:    nd.Identity,
+		Addrs: nd.PeerHost.Addrs(),
+		Node:  nd,
+		API:   api,
+	}, nil
+}
+
+func (tn *Network) spawnProcesses(ctx context.Context, opts Options) error {
+	bin := opts.Binary
+	if bin == "" {
+		bin = "ipfs"
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		var err error
+		dir, err = ioutil.TempDir("", "ipfs-testnet")
+		if err != nil {
+			return err
+		}
+		tn.tempDir = dir
+	}
+
+	for i := 0; i < opts.N; i++ {
+		n, err := tn.newProcessNode(ctx, opts, bin, filepath.Join(dir, fmt.Sprintf("node%d", i)), i)
+		if n != nil {
+			tn.Nodes = append(tn.Nodes, n)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tn *Network) newProcessNode(ctx context.Context, opts Options, bin, repoPath string, i int) (*Node, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	swarmAddr := fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", port)
+
+	cfg, err := nodeConfig(opts.Seed, i, swarmAddr)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Datastore = config.DefaultDatastoreConfig()
+	cfg.Addresses.API = []string{"/ip4/127.0.0.1/tcp/0"}
+
+	if err := fsrepo.Init(repoPath, cfg); err != nil {
+		return nil, err
+	}
+	if tn.SwarmKey != nil {
+		if err := ioutil.WriteFile(filepath.Join(repoPath, "swarm.key"), tn.SwarmKey, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := peer.Decode(cfg.Identity.PeerID)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := ma.NewMultiaddr(swarmAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, bin, "daemon")
+	cmd.Env = append(os.Environ(), "IPFS_PATH="+repoPath)
+	if tn.SwarmKey != nil {
+		cmd.Env = append(cmd.Env, "LIBP2P_FORCE_PNET=1")
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	n := &Node{
+		Index: i,
+		ID:    id,
+		Addrs: []ma.Multiaddr{addr},
+		Repo:  repoPath,
+		bin:   bin,
+		cmd:   cmd,
+	}
+	if err := waitForAPI(ctx, repoPath); err != nil {
+		return n, fmt.Errorf("testnet: node %d: %s", i, err)
+	}
+	log.Debugf("started node %d (%s) in %s", i, id, repoPath)
+	return n, nil
+}
+
+// waitForAPI waits for the daemon using repoPath to write its API file.
+func waitForAPI(ctx context.Context, repoPath string) error {
+	ctx, cancel := context.WithTimeout(ctx, daemonStartTimeout)
+	defer cancel()
+
+	for {
+		if _, err := fsrepo.APIAddr(repoPath); err == nil {
+			return nil
+		}
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return errors.New("daemon did not start in time")
+		}
+	}
+}
+
+// nodeConfig returns the config of the i-th node of a network built with
+// seed, listening on swarmAddr.
+func nodeConfig(seed int64, i int, swarmAddr string) (*config.Config, error) {
+	sk, pk, err := ci.GenerateKeyPairWithReader(ci.Ed25519, 0, rand.New(rand.NewSource(seed+int64(i))))
+	if err != nil {
+		return nil, err
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	skbytes, err := sk.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config.Config{}
+	cfg.Identity = config.Identity{
+		PeerID:  id.Pretty(),
+		PrivKey: base64.StdEncoding.EncodeToString(skbytes),
+	}
+	cfg.Addresses.Swarm = []string{swarmAddr}
+	cfg.Bootstrap = []string{}
+	cfg.Swarm.DisableNatPortMap = true
+	cfg.Discovery.MDNS.Enabled = false
+	return cfg, nil
+}
+
+// swarmKey derives a private network key from seed, in swarm.key format.
+func swarmKey(seed int64) []byte {
+	key := make([]byte, 32)
+	// math/rand.Read never fails.
+	rand.New(rand.NewSource(seed)).Read(key)
+	return []byte("/key/swarm/psk/1.0.0/\n/base16/\n" + hex.EncodeToString(key) + "\n")
+}
+
+// freePort returns a TCP port that is currently free on the loopback
+// interface.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
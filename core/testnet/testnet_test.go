@@ -0,0 +1,74 @@
+package testnet
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+func TestNodeConfigDeterministic(t *testing.T) {
+	a, err := nodeConfig(42, 1, "/ip4/127.0.0.1/tcp/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := nodeConfig(42, 1, "/ip4/127.0.0.1/tcp/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := nodeConfig(42, 2, "/ip4/127.0.0.1/tcp/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Identity != b.Identity {
+		t.Error("same seed and index should yield the same identity")
+	}
+	if a.Identity.PeerID == c.Identity.PeerID {
+		t.Error("different indexes should yield different identities")
+	}
+	if !bytes.Equal(swarmKey(7), swarmKey(7)) || bytes.Equal(swarmKey(7), swarmKey(8)) {
+		t.Error("swarm keys should only depend on the seed")
+	}
+}
+
+func TestSpawnInProcess(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tn, err := Spawn(ctx, Options{N: 3, PNet: true, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tn.Close()
+
+	for _, n := range tn.Nodes {
+		if peers := n.Node.PeerHost.Network().Peers(); len(peers) != 2 {
+			t.Fatalf("node %d: expected 2 peers, got %d", n.Index, len(peers))
+		}
+		if n.Node.PNetFingerprint == nil {
+			t.Fatalf("node %d: expected a private network", n.Index)
+		}
+	}
+
+	data := []byte("hello testnet")
+	p, err := tn.Nodes[0].API.Unixfs().Add(ctx, files.NewBytesFile(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := tn.Nodes[2].API.Unixfs().Get(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(files.ToFile(nd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("expected %q, got %q", data, out)
+	}
+}
@@ -0,0 +1,220 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+const (
+	// batchSize is the number of spans exported at once.
+	batchSize = 128
+	// batchInterval is the longest a finished span waits to be exported.
+	batchInterval = 5 * time.Second
+	// queueSize is the number of spans waiting to be exported, the spans
+	// finished past it are dropped.
+	queueSize = 4096
+)
+
+// zipkinSpan is a span in the Zipkin v2 JSON format.
+type zipkinSpan struct {
+	TraceID       string             `json:"traceId"`
+	ID            string             `json:"id"`
+	ParentID      string             `json:"parentId,omitempty"`
+	Name          string             `json:"name"`
+	Kind          string             `json:"kind,omitempty"`
+	Timestamp     int64              `json:"timestamp"`
+	Duration      int64              `json:"duration"`
+	LocalEndpoint zipkinEndpoint     `json:"localEndpoint"`
+	Tags          map[string]string  `json:"tags,omitempty"`
+	Annotations   []zipkinAnnotation `json:"annotations,omitempty"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinAnnotation struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// zipkin returns the span finished at end, in the Zipkin format. The caller
+// holds s.mu.
+func (s *span) zipkin(end time.Time) zipkinSpan {
+	z := zipkinSpan{
+		TraceID:       s.ctx.TraceID(),
+		ID:            fmt.Sprintf("%016x", s.ctx.spanID),
+		Name:          s.name,
+		Timestamp:     s.start.UnixNano() / int64(time.Microsecond),
+		Duration:      int64(end.Sub(s.start) / time.Microsecond),
+		LocalEndpoint: zipkinEndpoint{ServiceName: s.tracer.service},
+	}
+	if s.parentID != 0 {
+		z.ParentID = fmt.Sprintf("%016x", s.parentID)
+	}
+	if z.Duration < 1 {
+		z.Duration = 1
+	}
+
+	if len(s.tags) > 0 {
+		z.Tags = make(map[string]string, len(s.tags))
+	}
+	for k, v := range s.tags {
+		if k == string(ext.SpanKind) {
+			switch fmt.Sprint(v) {
+			case string(ext.SpanKindRPCServerEnum):
+				z.Kind = "SERVER"
+			case string(ext.SpanKindRPCClientEnum):
+				z.Kind = "CLIENT"
+			}
+			continue
+		}
+		z.Tags[k] = fmt.Sprint(v)
+	}
+
+	for _, lr := range s.logs {
+		fields := make([]string, 0, len(lr.fields))
+		for _, f := range lr.fields {
+			fields = append(fields, fmt.Sprintf("%s=%v", f.Key(), f.Value()))
+		}
+		z.Annotations = append(z.Annotations, zipkinAnnotation{
+			Timestamp: lr.at.UnixNano() / int64(time.Microsecond),
+			Value:     strings.Join(fields, " "),
+		})
+	}
+	return z
+}
+
+// exporter sends the finished spans to the tracing backend.
+type exporter interface {
+	export(zipkinSpan)
+	close() error
+}
+
+// batcher queues the finished spans, and sends them in batches.
+type batcher struct {
+	send  func([]zipkinSpan) error
+	queue chan zipkinSpan
+
+	closeOnce sync.Once
+	done      chan struct{}
+	err       error
+}
+
+func newBatcher(send func([]zipkinSpan) error) *batcher {
+	b := &batcher{
+		send:  send,
+		queue: make(chan zipkinSpan, queueSize),
+		done:  make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+func (b *batcher) export(s zipkinSpan) {
+	select {
+	case b.queue <- s:
+	default:
+		log.Debugf("dropping span %s of trace %s, the export queue is full", s.Name, s.TraceID)
+	}
+}
+
+func (b *batcher) loop() {
+	defer close(b.done)
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	var batch []zipkinSpan
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := b.send(batch); err != nil {
+			log.Warningf("failed to export %d spans: %s", len(batch), err)
+			b.err = err
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case s, ok := <-b.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// close sends the spans queued, and returns the last error sending spans.
+// The spans finished after close are lost.
+func (b *batcher) close() error {
+	b.closeOnce.Do(func() {
+		close(b.queue)
+	})
+	<-b.done
+	return b.err
+}
+
+// newHTTPExporter posts the spans to the Zipkin endpoint.
+func newHTTPExporter(endpoint string) exporter {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return newBatcher(func(spans []zipkinSpan) error {
+		body, err := json.Marshal(spans)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("%s answered %s", endpoint, resp.Status)
+		}
+		return nil
+	})
+}
+
+// fileExporter appends the spans to a file, a JSON array of a batch per
+// line.
+type fileExporter struct {
+	*batcher
+	f *os.File
+}
+
+func newFileExporter(path string) (exporter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failure to open the spans file %s: %s", path, err)
+	}
+	enc := json.NewEncoder(f)
+	return &fileExporter{
+		batcher: newBatcher(func(spans []zipkinSpan) error {
+			return enc.Encode(spans)
+		}),
+		f: f,
+	}, nil
+}
+
+func (e *fileExporter) close() error {
+	err := e.batcher.close()
+	if cerr := e.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+package tracing
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// spanContext identifies a span and its trace.
+type spanContext struct {
+	traceHi, traceLo uint64
+	spanID           uint64
+	sampled          bool
+	baggage          map[string]string
+}
+
+// ForeachBaggageItem implements opentracing.SpanContext.
+func (c spanContext) ForeachBaggageItem(handler func(k, v string) bool) {
+	for k, v := range c.baggage {
+		if !handler(k, v) {
+			return
+		}
+	}
+}
+
+// TraceID returns the ID of the trace, in hex.
+func (c spanContext) TraceID() string {
+	if c.traceHi == 0 {
+		return fmt.Sprintf("%016x", c.traceLo)
+	}
+	return fmt.Sprintf("%016x%016x", c.traceHi, c.traceLo)
+}
+
+// TraceID returns the ID of the trace of the span sp, or "" if sp is not
+// recorded by a Tracer.
+func TraceID(sp opentracing.Span) string {
+	if sp == nil {
+		return ""
+	}
+	c, ok := sp.Context().(spanContext)
+	if !ok {
+		return ""
+	}
+	return c.TraceID()
+}
+
+type logRecord struct {
+	at     time.Time
+	fields []otlog.Field
+}
+
+// span is a span recorded by a Tracer, exported when finished if its trace
+// is sampled.
+type span struct {
+	tracer   *Tracer
+	ctx      spanContext
+	parentID uint64
+	start    time.Time
+
+	mu       sync.Mutex
+	name     string
+	tags     map[string]interface{}
+	logs     []logRecord
+	finished bool
+}
+
+var _ opentracing.Span = (*span)(nil)
+
+func (s *span) Finish() {
+	s.FinishWithOptions(opentracing.FinishOptions{})
+}
+
+func (s *span) FinishWithOptions(opts opentracing.FinishOptions) {
+	end := opts.FinishTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return
+	}
+	s.finished = true
+	if !s.ctx.sampled {
+		return
+	}
+	for _, ld := range opts.LogRecords {
+		s.logs = append(s.logs, logRecord{at: ld.Timestamp, fields: ld.Fields})
+	}
+	for _, ld := range opts.BulkLogData {
+		lr := ld.ToLogRecord()
+		s.logs = append(s.logs, logRecord{at: lr.Timestamp, fields: lr.Fields})
+	}
+	s.tracer.exp.export(s.zipkin(end))
+}
+
+func (s *span) Context() opentracing.SpanContext {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ctx
+}
+
+func (s *span) SetOperationName(name string) opentracing.Span {
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+	return s
+}
+
+func (s *span) SetTag(key string, value interface{}) opentracing.Span {
+	s.mu.Lock()
+	s.tags[key] = value
+	s.mu.Unlock()
+	return s
+}
+
+func (s *span) LogFields(fields ...otlog.Field) {
+	s.mu.Lock()
+	if s.ctx.sampled {
+		s.logs = append(s.logs, logRecord{at: time.Now(), fields: fields})
+	}
+	s.mu.Unlock()
+}
+
+func (s *span) LogKV(alternatingKeyValues ...interface{}) {
+	fields, err := otlog.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		fields = []otlog.Field{otlog.Error(err)}
+	}
+	s.LogFields(fields...)
+}
+
+func (s *span) SetBaggageItem(key, value string) opentracing.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	baggage := make(map[string]string, len(s.ctx.baggage)+1)
+	for k, v := range s.ctx.baggage {
+		baggage[k] = v
+	}
+	baggage[key] = value
+	s.ctx.baggage = baggage
+	return s
+}
+
+func (s *span) BaggageItem(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ctx.baggage[key]
+}
+
+func (s *span) Tracer() opentracing.Tracer {
+	return s.tracer
+}
+
+func (s *span) LogEvent(event string) {
+	s.LogFields(otlog.String("event", event))
+}
+
+func (s *span) LogEventWithPayload(event string, payload interface{}) {
+	s.LogFields(otlog.String("event", event), otlog.Object("payload", payload))
+}
+
+func (s *span) Log(ld opentracing.LogData) {
+	lr := ld.ToLogRecord()
+	s.mu.Lock()
+	if s.ctx.sampled {
+		s.logs = append(s.logs, logRecord{at: lr.Timestamp, fields: lr.Fields})
+	}
+	s.mu.Unlock()
+}
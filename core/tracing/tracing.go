@@ -0,0 +1,301 @@
+// Package tracing records the spans of the requests to the node, from the
+// commands HTTP handler through the CoreAPI, the block exchange and the
+// routing queries, and exports them to a tracing backend.
+//
+// The Tracer implements the opentracing API, which the node and its
+// libraries, go-log events included, already report their spans to: once
+// set as the global tracer, the spans started with the context of a request
+// are the children of the span of the request. Finished spans are exported
+// in the Zipkin v2 JSON format, accepted by Zipkin, by Jaeger and by the
+// OpenTelemetry collector, either to an HTTP endpoint or to a file.
+//
+// The trace context crosses the HTTP API in the B3 headers: a client sending
+// X-B3-Sampled: 1 has its request traced whatever the sample rate.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	mrand "math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	logging "github.com/ipfs/go-log"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+var log = logging.Logger("tracing")
+
+// ConfigKey is the config key of the tracing section.
+const ConfigKey = "Tracing"
+
+// Exporters.
+const (
+	ExporterZipkin = "zipkin"
+	ExporterFile   = "file"
+)
+
+// By default, the spans are posted to a Zipkin collector on localhost, under
+// the service name go-ipfs.
+const (
+	DefaultEndpoint    = "http://localhost:9411/api/v2/spans"
+	DefaultServiceName = "go-ipfs"
+)
+
+// Config holds the Tracing config section.
+type Config struct {
+	// Exporter is ExporterZipkin, to post the spans to Endpoint, or
+	// ExporterFile, to append them to File. Tracing is disabled when unset.
+	Exporter string
+
+	// Endpoint is the URL the spans are posted to, DefaultEndpoint when
+	// unset. Jaeger and the OpenTelemetry collector accept them on their
+	// Zipkin receiver.
+	Endpoint string
+
+	// File is the file the spans are appended to, one JSON array per line.
+	File string
+
+	// ServiceName names the node in the traces.
+	ServiceName string
+
+	// SampleRate is the share of the requests traced, between 0 and 1.
+	// The requests asking to be traced always are.
+	SampleRate *float64 `json:",omitempty"`
+}
+
+// LoadConfig reads the Tracing section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// Tracer records the spans, and exports those of the sampled traces.
+type Tracer struct {
+	service string
+	sample  float64
+	exp     exporter
+
+	mu   sync.Mutex
+	rand *mrand.Rand
+}
+
+var _ opentracing.Tracer = (*Tracer)(nil)
+
+// New returns a tracer exporting as set in cfg, or nil if tracing is
+// disabled.
+func New(cfg Config) (*Tracer, error) {
+	if cfg.Exporter == "" {
+		return nil, nil
+	}
+	t := &Tracer{
+		service: cfg.ServiceName,
+		sample:  1,
+		rand:    mrand.New(mrand.NewSource(seed())),
+	}
+	if t.service == "" {
+		t.service = DefaultServiceName
+	}
+	if cfg.SampleRate != nil {
+		if *cfg.SampleRate < 0 || *cfg.SampleRate > 1 {
+			return nil, fmt.Errorf("config setting %s.SampleRate is not between 0 and 1", ConfigKey)
+		}
+		t.sample = *cfg.SampleRate
+	}
+
+	switch cfg.Exporter {
+	case ExporterZipkin:
+		endpoint := cfg.Endpoint
+		if endpoint == "" {
+			endpoint = DefaultEndpoint
+		}
+		t.exp = newHTTPExporter(endpoint)
+	case ExporterFile:
+		if cfg.File == "" {
+			return nil, fmt.Errorf("config setting %s.File must be set with the %s exporter", ConfigKey, ExporterFile)
+		}
+		exp, err := newFileExporter(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		t.exp = exp
+	default:
+		return nil, fmt.Errorf("unknown exporter %q in config setting %s.Exporter", cfg.Exporter, ConfigKey)
+	}
+	return t, nil
+}
+
+// Close exports the spans not exported yet.
+func (t *Tracer) Close() error {
+	return t.exp.close()
+}
+
+// StartSpan implements opentracing.Tracer.
+func (t *Tracer) StartSpan(name string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	var o opentracing.StartSpanOptions
+	for _, opt := range opts {
+		opt.Apply(&o)
+	}
+
+	s := &span{
+		tracer: t,
+		name:   name,
+		start:  o.StartTime,
+		tags:   make(map[string]interface{}, len(o.Tags)),
+	}
+	if s.start.IsZero() {
+		s.start = time.Now()
+	}
+	for k, v := range o.Tags {
+		s.tags[k] = v
+	}
+
+	for _, ref := range o.References {
+		parent, ok := ref.ReferencedContext.(spanContext)
+		if !ok {
+			continue
+		}
+		s.ctx = spanContext{
+			traceHi: parent.traceHi,
+			traceLo: parent.traceLo,
+			sampled: parent.sampled,
+			baggage: parent.baggage,
+		}
+		s.parentID = parent.spanID
+		break
+	}
+
+	t.mu.Lock()
+	if s.ctx.traceHi == 0 && s.ctx.traceLo == 0 {
+		// a new trace, unless the parent only asked for sampling
+		s.ctx.traceHi, s.ctx.traceLo = t.rand.Uint64(), t.rand.Uint64()
+		s.ctx.sampled = s.ctx.sampled || t.rand.Float64() < t.sample
+	}
+	s.ctx.spanID = t.rand.Uint64()
+	t.mu.Unlock()
+	return s
+}
+
+// B3 headers carrying the trace context.
+const (
+	headerTraceID = "X-B3-TraceId"
+	headerSpanID  = "X-B3-SpanId"
+	headerSampled = "X-B3-Sampled"
+	baggagePrefix = "ot-baggage-"
+)
+
+// Inject implements opentracing.Tracer, with the B3 headers.
+func (t *Tracer) Inject(sc opentracing.SpanContext, format interface{}, carrier interface{}) error {
+	ctx, ok := sc.(spanContext)
+	if !ok {
+		return opentracing.ErrInvalidSpanContext
+	}
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok || (format != opentracing.HTTPHeaders && format != opentracing.TextMap) {
+		return opentracing.ErrUnsupportedFormat
+	}
+	w.Set(headerTraceID, ctx.TraceID())
+	w.Set(headerSpanID, fmt.Sprintf("%016x", ctx.spanID))
+	sampled := "0"
+	if ctx.sampled {
+		sampled = "1"
+	}
+	w.Set(headerSampled, sampled)
+	for k, v := range ctx.baggage {
+		w.Set(baggagePrefix+k, v)
+	}
+	return nil
+}
+
+// Extract implements opentracing.Tracer, with the B3 headers. A carrier
+// with only X-B3-Sampled set returns a context starting a new trace, sampled
+// as asked.
+func (t *Tracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	r, ok := carrier.(opentracing.TextMapReader)
+	if !ok || (format != opentracing.HTTPHeaders && format != opentracing.TextMap) {
+		return nil, opentracing.ErrUnsupportedFormat
+	}
+
+	var ctx spanContext
+	var traceID, spanID string
+	found := false
+	err := r.ForeachKey(func(k, v string) error {
+		switch lk := strings.ToLower(k); {
+		case lk == strings.ToLower(headerTraceID):
+			traceID = v
+		case lk == strings.ToLower(headerSpanID):
+			spanID = v
+		case lk == strings.ToLower(headerSampled):
+			ctx.sampled = v == "1" || v == "true"
+			found = true
+		case strings.HasPrefix(lk, baggagePrefix):
+			if ctx.baggage == nil {
+				ctx.baggage = make(map[string]string)
+			}
+			ctx.baggage[strings.TrimPrefix(lk, baggagePrefix)] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if traceID == "" {
+		if !found {
+			return nil, opentracing.ErrSpanContextNotFound
+		}
+		return ctx, nil
+	}
+	if ctx.traceHi, ctx.traceLo, err = parseTraceID(traceID); err != nil {
+		return nil, opentracing.ErrSpanContextCorrupted
+	}
+	if ctx.spanID, err = strconv.ParseUint(spanID, 16, 64); err != nil {
+		return nil, opentracing.ErrSpanContextCorrupted
+	}
+	return ctx, nil
+}
+
+func parseTraceID(s string) (hi, lo uint64, err error) {
+	if len(s) > 32 {
+		return 0, 0, fmt.Errorf("trace ID too long")
+	}
+	if len(s) > 16 {
+		if hi, err = strconv.ParseUint(s[:len(s)-16], 16, 64); err != nil {
+			return 0, 0, err
+		}
+		s = s[len(s)-16:]
+	}
+	lo, err = strconv.ParseUint(s, 16, 64)
+	return hi, lo, err
+}
+
+// NewTraceHeaders returns the B3 headers of a new sampled trace, for a
+// client asking the node to trace its request, and the ID of the trace.
+func NewTraceHeaders() (traceID string, headers map[string]string) {
+	var buf [24]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		// the trace is still sampled, under an ID chosen by the node
+		return "", map[string]string{headerSampled: "1"}
+	}
+	traceID = hex.EncodeToString(buf[:16])
+	return traceID, map[string]string{
+		headerTraceID: traceID,
+		headerSpanID:  hex.EncodeToString(buf[16:]),
+		headerSampled: "1",
+	}
+}
+
+func seed() int64 {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.LittleEndian.Uint64(buf[:]))
+}
@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// readSpans returns the spans exported to the file at path.
+func readSpans(t *testing.T, path string) []zipkinSpan {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var spans []zipkinSpan
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var batch []zipkinSpan
+		if err := json.Unmarshal(sc.Bytes(), &batch); err != nil {
+			t.Fatal(err)
+		}
+		spans = append(spans, batch...)
+	}
+	return spans
+}
+
+func newFileTracer(t *testing.T, rate float64) (*Tracer, string, func()) {
+	dir, err := ioutil.TempDir("", "tracing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "spans.json")
+	tr, err := New(Config{Exporter: ExporterFile, File: file, SampleRate: &rate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr, file, func() { os.RemoveAll(dir) }
+}
+
+func TestConfig(t *testing.T) {
+	if tr, err := New(Config{}); tr != nil || err != nil {
+		t.Fatal("expected no tracer when disabled")
+	}
+	if _, err := New(Config{Exporter: "carrier-pigeon"}); err == nil {
+		t.Fatal("expected an error for an unknown exporter")
+	}
+	if _, err := New(Config{Exporter: ExporterFile}); err == nil {
+		t.Fatal("expected an error for the file exporter without a file")
+	}
+	rate := 1.5
+	if _, err := New(Config{Exporter: ExporterZipkin, SampleRate: &rate}); err == nil {
+		t.Fatal("expected an error for a sample rate above 1")
+	}
+
+	var tr *Tracer
+	h := http.NotFoundHandler()
+	if tr.Handler(h) == nil || tr.Routing(nil) != nil || tr.Exchange(nil) != nil {
+		t.Fatal("expected a nil tracer to return its arguments")
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	tr, _, cleanup := newFileTracer(t, 1)
+	defer cleanup()
+	defer tr.Close()
+
+	sp := tr.StartSpan("parent")
+	sp.SetBaggageItem("user", "alice")
+	h := make(http.Header)
+	if err := tr.Inject(sp.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h)); err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := tr.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := tr.StartSpan("child", opentracing.ChildOf(ctx))
+	if TraceID(child) != TraceID(sp) {
+		t.Fatalf("expected the trace %s, got %s", TraceID(sp), TraceID(child))
+	}
+	if child.(*span).parentID != sp.Context().(spanContext).spanID {
+		t.Fatal("expected the child of the injected span")
+	}
+	if child.BaggageItem("user") != "alice" {
+		t.Fatal("expected the baggage propagated")
+	}
+
+	if _, err := tr.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(http.Header{})); err != opentracing.ErrSpanContextNotFound {
+		t.Fatalf("expected no span context, got %v", err)
+	}
+	h.Set(headerSpanID, "not hex")
+	if _, err := tr.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h)); err != opentracing.ErrSpanContextCorrupted {
+		t.Fatalf("expected a corrupted span context, got %v", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	// nothing is sampled unless asked
+	tr, file, cleanup := newFileTracer(t, 0)
+	defer cleanup()
+
+	var inner opentracing.Span
+	h := tr.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sp, _ := StartSpan(r.Context(), "work")
+		FinishSpan(sp, errors.New("failed"))
+		inner = sp
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v0/cat", nil))
+	if rec.Header().Get(TraceHeader) != "" {
+		t.Fatal("expected the request not sampled")
+	}
+
+	id, headers := NewTraceHeaders()
+	req := httptest.NewRequest("POST", "/api/v0/cat", nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get(TraceHeader); got != id {
+		t.Fatalf("expected the trace %s, got %q", id, got)
+	}
+	if TraceID(inner) != id {
+		t.Fatal("expected the span of the handler in the context of the request")
+	}
+
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	spans := readSpans(t, file)
+	if len(spans) != 2 {
+		t.Fatalf("expected the 2 spans of the sampled request, got %d", len(spans))
+	}
+	work, api := spans[0], spans[1]
+	if api.Name != "/api/v0/cat" || api.Kind != "SERVER" || api.TraceID != id || api.ParentID != headers[headerSpanID] {
+		t.Fatalf("unexpected span %+v", api)
+	}
+	if work.Name != "work" || work.ParentID != api.ID || work.Tags["error"] != "true" || len(work.Annotations) != 1 {
+		t.Fatalf("unexpected span %+v", work)
+	}
+}
+
+func TestStartSpan(t *testing.T) {
+	if sp, ctx := StartSpan(context.Background(), "background"); sp != nil || ctx != context.Background() {
+		t.Fatal("expected no span without a parent")
+	}
+	FinishSpan(nil, errors.New("ignored"))
+}
@@ -0,0 +1,314 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	routing "github.com/libp2p/go-libp2p-core/routing"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// TraceHeader is the response header carrying the ID of the trace of a
+// sampled API request.
+const TraceHeader = "X-Ipfs-Trace-Id"
+
+// Handler wraps h to record a span for each request, the child of the span
+// of the client if the request carries one. The span is in the context of
+// the request. It is safe to call on a nil Tracer, in which case h is
+// returned as is.
+func (t *Tracer) Handler(h http.Handler) http.Handler {
+	if t == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent, _ := t.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+		sp := t.StartSpan(r.URL.Path, ext.RPCServerOption(parent))
+		defer sp.Finish()
+		ext.Component.Set(sp, "api")
+		ext.HTTPMethod.Set(sp, r.Method)
+		ext.HTTPUrl.Set(sp, r.URL.String())
+
+		if sp.Context().(spanContext).sampled {
+			w.Header().Set(TraceHeader, TraceID(sp))
+		}
+		h.ServeHTTP(w, r.WithContext(opentracing.ContextWithSpan(r.Context(), sp)))
+	})
+}
+
+// child starts a span of ctx named name, the child of the span in ctx. It
+// returns nil if ctx carries no span: the background work of the node, as
+// the reprovider, is not traced.
+func (t *Tracer) child(ctx context.Context, name string) (opentracing.Span, context.Context) {
+	parent := opentracing.SpanFromContext(ctx)
+	if parent == nil {
+		return nil, ctx
+	}
+	if _, ok := parent.Context().(spanContext); !ok {
+		return nil, ctx
+	}
+	sp := t.StartSpan(name, opentracing.ChildOf(parent.Context()))
+	return sp, opentracing.ContextWithSpan(ctx, sp)
+}
+
+// StartSpan starts a span named name, the child of the span in ctx, and
+// returns it with the context carrying it. It returns nil if ctx carries no
+// span, for the work done outside of the traced requests not to start
+// traces of its own.
+func StartSpan(ctx context.Context, name string) (opentracing.Span, context.Context) {
+	parent := opentracing.SpanFromContext(ctx)
+	if parent == nil {
+		return nil, ctx
+	}
+	sp := parent.Tracer().StartSpan(name, opentracing.ChildOf(parent.Context()))
+	return sp, opentracing.ContextWithSpan(ctx, sp)
+}
+
+// FinishSpan finishes sp, if any, marking it failed with err.
+func FinishSpan(sp opentracing.Span, err error) {
+	if sp == nil {
+		return
+	}
+	if err != nil {
+		ext.Error.Set(sp, true)
+		sp.LogFields(otlog.Error(err))
+	}
+	sp.Finish()
+}
+
+// Routing wraps r to record a span for each query made for a traced
+// request. It is safe to call on a nil Tracer, in which case r is returned
+// as is.
+func (t *Tracer) Routing(r routing.Routing) routing.Routing {
+	if t == nil {
+		return r
+	}
+	return &tracedRouting{Routing: r, t: t}
+}
+
+type tracedRouting struct {
+	routing.Routing
+	t *Tracer
+}
+
+func (r *tracedRouting) FindPeer(ctx context.Context, p peer.ID) (peer.AddrInfo, error) {
+	sp, ctx := r.t.child(ctx, "routing.FindPeer")
+	if sp != nil {
+		sp.SetTag("peer", p.Pretty())
+	}
+	pi, err := r.Routing.FindPeer(ctx, p)
+	FinishSpan(sp, err)
+	return pi, err
+}
+
+// FindProvidersAsync finishes the span when the query ends, with the number
+// of providers found.
+func (r *tracedRouting) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	sp, ctx := r.t.child(ctx, "routing.FindProviders")
+	if sp == nil {
+		return r.Routing.FindProvidersAsync(ctx, c, count)
+	}
+	sp.SetTag("cid", c.String())
+	in := r.Routing.FindProvidersAsync(ctx, c, count)
+	out := make(chan peer.AddrInfo)
+	go func() {
+		defer close(out)
+
+		found := 0
+		defer func() {
+			sp.SetTag("providers", found)
+			sp.Finish()
+		}()
+		for pi := range in {
+			if found == 0 {
+				sp.LogFields(otlog.String("event", "first provider"))
+			}
+			found++
+			select {
+			case out <- pi:
+			case <-ctx.Done():
+				// Drain in, the query ends with ctx.
+				for range in {
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (r *tracedRouting) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	sp, ctx := r.t.child(ctx, "routing.Provide")
+	if sp != nil {
+		sp.SetTag("cid", c.String())
+		sp.SetTag("announce", announce)
+	}
+	err := r.Routing.Provide(ctx, c, announce)
+	FinishSpan(sp, err)
+	return err
+}
+
+func (r *tracedRouting) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	sp, ctx := r.t.child(ctx, "routing.GetValue")
+	val, err := r.Routing.GetValue(ctx, key, opts...)
+	FinishSpan(sp, err)
+	return val, err
+}
+
+// SearchValue finishes the span when the search ends.
+func (r *tracedRouting) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	sp, ctx := r.t.child(ctx, "routing.SearchValue")
+	in, err := r.Routing.SearchValue(ctx, key, opts...)
+	if sp == nil || err != nil {
+		FinishSpan(sp, err)
+		return in, err
+	}
+
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		defer sp.Finish()
+
+		found := 0
+		for val := range in {
+			found++
+			select {
+			case out <- val:
+			case <-ctx.Done():
+				for range in {
+				}
+				return
+			}
+		}
+		sp.SetTag("values", found)
+	}()
+	return out, nil
+}
+
+func (r *tracedRouting) PutValue(ctx context.Context, key string, val []byte, opts ...routing.Option) error {
+	sp, ctx := r.t.child(ctx, "routing.PutValue")
+	err := r.Routing.PutValue(ctx, key, val, opts...)
+	FinishSpan(sp, err)
+	return err
+}
+
+// GetPublicKey keeps the fast path of the wrapped router, if any.
+func (r *tracedRouting) GetPublicKey(ctx context.Context, p peer.ID) (ci.PubKey, error) {
+	return routing.GetPublicKey(r.Routing, ctx, p)
+}
+
+// Exchange wraps ex to record a span for each fetch made for a traced
+// request, and for the sessions. It is safe to call on a nil Tracer, in
+// which case ex is returned as is.
+func (t *Tracer) Exchange(ex exchange.Interface) exchange.Interface {
+	if t == nil {
+		return ex
+	}
+	if sex, ok := ex.(exchange.SessionExchange); ok {
+		return &tracedSessionExchange{
+			tracedExchange: tracedExchange{Interface: ex, t: t},
+			sex:            sex,
+		}
+	}
+	return &tracedExchange{Interface: ex, t: t}
+}
+
+type tracedExchange struct {
+	exchange.Interface
+	t *Tracer
+}
+
+func (e *tracedExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return getBlock(ctx, e.t, e.Interface, "exchange.GetBlock", c)
+}
+
+func (e *tracedExchange) GetBlocks(ctx context.Context, keys []cid.Cid) (<-chan blocks.Block, error) {
+	return getBlocks(ctx, e.t, e.Interface, "exchange.GetBlocks", keys)
+}
+
+type tracedSessionExchange struct {
+	tracedExchange
+	sex exchange.SessionExchange
+}
+
+// NewSession records a span lasting as long as the session, the parent of
+// the spans of its fetches.
+func (e *tracedSessionExchange) NewSession(ctx context.Context) exchange.Fetcher {
+	sp, sctx := e.t.child(ctx, "exchange.Session")
+	f := e.sex.NewSession(sctx)
+	if sp == nil {
+		return f
+	}
+	go func() {
+		<-ctx.Done()
+		sp.Finish()
+	}()
+	return &tracedFetcher{Fetcher: f, t: e.t, session: sp}
+}
+
+type tracedFetcher struct {
+	exchange.Fetcher
+	t       *Tracer
+	session opentracing.Span
+}
+
+func (f *tracedFetcher) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return getBlock(f.sessionContext(ctx), f.t, f.Fetcher, "session.GetBlock", c)
+}
+
+func (f *tracedFetcher) GetBlocks(ctx context.Context, keys []cid.Cid) (<-chan blocks.Block, error) {
+	return getBlocks(f.sessionContext(ctx), f.t, f.Fetcher, "session.GetBlocks", keys)
+}
+
+// sessionContext returns ctx carrying the span of the session, for the
+// spans of the fetches to be its children.
+func (f *tracedFetcher) sessionContext(ctx context.Context) context.Context {
+	return opentracing.ContextWithSpan(ctx, f.session)
+}
+
+func getBlock(ctx context.Context, t *Tracer, f exchange.Fetcher, name string, c cid.Cid) (blocks.Block, error) {
+	sp, ctx := t.child(ctx, name)
+	if sp != nil {
+		sp.SetTag("cid", c.String())
+	}
+	b, err := f.GetBlock(ctx, c)
+	FinishSpan(sp, err)
+	return b, err
+}
+
+// getBlocks finishes the span when the last block is received, or the fetch
+// ends.
+func getBlocks(ctx context.Context, t *Tracer, f exchange.Fetcher, name string, keys []cid.Cid) (<-chan blocks.Block, error) {
+	sp, ctx := t.child(ctx, name)
+	in, err := f.GetBlocks(ctx, keys)
+	if sp == nil || err != nil {
+		FinishSpan(sp, err)
+		return in, err
+	}
+	sp.SetTag("blocks", len(keys))
+
+	out := make(chan blocks.Block)
+	go func() {
+		defer close(out)
+		received := 0
+		defer func() {
+			sp.SetTag("received", received)
+			sp.Finish()
+		}()
+		for b := range in {
+			received++
+			select {
+			case out <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,322 @@
+// Package watchdog detects nodes that wedge silently.
+//
+// When enabled through the Watchdog.Enabled config key, the watchdog samples
+// the number of goroutines and looks for goroutines blocked on a mutex for a
+// long time. It logs a warning when the number of goroutines exceeds a
+// threshold or keeps growing, and when goroutines look deadlocked. If a
+// capture directory is configured, it also writes the goroutine, heap and
+// mutex profiles there, so that the problem can be investigated after the
+// node has been restarted.
+package watchdog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/jbenet/goprocess"
+	"github.com/jbenet/goprocess/periodic"
+)
+
+var log = logging.Logger("watchdog")
+
+// ConfigKey is the key of the watchdog section in the repo config.
+const ConfigKey = "Watchdog"
+
+// By default, the watchdog samples the runtime every minute, warns past
+// 20000 goroutines or when their number grows for 10 samples in a row, and
+// reports the goroutines waiting on a mutex for 10 minutes. It captures the
+// diagnostics at most once an hour.
+const (
+	DefaultInterval        = time.Minute
+	DefaultMaxGoroutines   = 20000
+	DefaultLeakSamples     = 10
+	DefaultBlockedFor      = 10 * time.Minute
+	DefaultCaptureInterval = time.Hour
+)
+
+// Config holds the Watchdog config section.
+type Config struct {
+	// Enabled starts the watchdog with the daemon.
+	Enabled bool
+
+	// Interval is how often the goroutines are sampled, e.g. "1m".
+	Interval string
+
+	// MaxGoroutines is the number of goroutines above which a warning is
+	// emitted.
+	MaxGoroutines int
+
+	// LeakSamples is the number of consecutive samples in which the number
+	// of goroutines grows before a leak is reported.
+	LeakSamples int
+
+	// BlockedFor is how long a goroutine must wait on a mutex to be reported
+	// as deadlocked, e.g. "10m". The Go runtime reports waits in minutes.
+	BlockedFor string
+
+	// MutexProfileFraction, when positive, enables mutex contention
+	// profiling with runtime.SetMutexProfileFraction so that the captured
+	// mutex profiles are not empty.
+	MutexProfileFraction int
+
+	// CaptureDir, when set, is the directory diagnostics are written to
+	// when a warning is emitted.
+	CaptureDir string
+
+	// CaptureInterval is the minimum time between two captures, e.g. "1h".
+	CaptureInterval string
+}
+
+// Sample is a measurement taken by the watchdog.
+type Sample struct {
+	Time       time.Time
+	Goroutines int
+
+	// Blocked is the number of goroutines blocked on a mutex for longer
+	// than the configured threshold.
+	Blocked int
+}
+
+// Watchdog periodically samples the runtime and reports anomalies.
+type Watchdog struct {
+	interval        time.Duration
+	maxGoroutines   int
+	leakSamples     int
+	blockedFor      time.Duration
+	captureDir      string
+	captureInterval time.Duration
+
+	mu          sync.Mutex
+	last        Sample
+	growing     int
+	lastCapture time.Time
+
+	proc goprocess.Process
+}
+
+// Load returns a new Watchdog if it is enabled in the config of r, or nil
+// otherwise.
+func Load(r repo.Repo) (*Watchdog, error) {
+	var cfg Config
+	if err := repo.LoadConfigKey(r, ConfigKey, &cfg); err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	return New(cfg)
+}
+
+// New returns a Watchdog configured with cfg. Its Enabled field is ignored.
+func New(cfg Config) (*Watchdog, error) {
+	w := &Watchdog{
+		maxGoroutines: cfg.MaxGoroutines,
+		leakSamples:   cfg.LeakSamples,
+		captureDir:    cfg.CaptureDir,
+	}
+	if w.maxGoroutines <= 0 {
+		w.maxGoroutines = DefaultMaxGoroutines
+	}
+	if w.leakSamples <= 0 {
+		w.leakSamples = DefaultLeakSamples
+	}
+
+	var err error
+	if w.interval, err = repo.ConfigDuration(ConfigKey, "Interval", cfg.Interval, DefaultInterval); err != nil {
+		return nil, err
+	}
+	if w.blockedFor, err = repo.ConfigDuration(ConfigKey, "BlockedFor", cfg.BlockedFor, DefaultBlockedFor); err != nil {
+		return nil, err
+	}
+	if w.captureInterval, err = repo.ConfigDuration(ConfigKey, "CaptureInterval", cfg.CaptureInterval, DefaultCaptureInterval); err != nil {
+		return nil, err
+	}
+
+	if cfg.MutexProfileFraction > 0 {
+		runtime.SetMutexProfileFraction(cfg.MutexProfileFraction)
+	}
+	return w, nil
+}
+
+// Start samples the runtime every configured interval until Close is called.
+func (w *Watchdog) Start() {
+	w.proc = periodic.Every(w.interval, func(goprocess.Process) {
+		w.Check(w.Sample())
+	})
+}
+
+// Close stops the watchdog.
+func (w *Watchdog) Close() error {
+	if w.proc == nil {
+		return nil
+	}
+	return w.proc.Close()
+}
+
+// Last returns the last sample checked.
+func (w *Watchdog) Last() Sample {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last
+}
+
+// Sample measures the current state of the runtime.
+func (w *Watchdog) Sample() Sample {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+		log.Errorf("failed to dump goroutines: %s", err)
+	}
+	return Sample{
+		Time:       time.Now(),
+		Goroutines: runtime.NumGoroutine(),
+		Blocked:    countBlocked(buf.Bytes(), w.blockedFor),
+	}
+}
+
+// Check compares s with the previous samples and returns the warnings it
+// raised. Warnings are logged and trigger a capture if configured.
+func (w *Watchdog) Check(s Sample) []string {
+	w.mu.Lock()
+	if w.last.Goroutines > 0 && s.Goroutines > w.last.Goroutines {
+		w.growing++
+	} else {
+		w.growing = 0
+	}
+	growing := w.growing
+	w.last = s
+	w.mu.Unlock()
+
+	var warnings []string
+	if s.Goroutines > w.maxGoroutines {
+		warnings = append(warnings, fmt.Sprintf("%d goroutines running, more than the %d allowed", s.Goroutines, w.maxGoroutines))
+	}
+	if growing >= w.leakSamples {
+		warnings = append(warnings, fmt.Sprintf("number of goroutines grew in the last %d samples, up to %d: possible leak", growing, s.Goroutines))
+	}
+	if s.Blocked > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d goroutines blocked on a mutex for more than %s: possible deadlock", s.Blocked, w.blockedFor))
+	}
+
+	for _, warning := range warnings {
+		log.Warning(warning)
+	}
+	if len(warnings) > 0 {
+		w.maybeCapture(s.Time)
+	}
+	return warnings
+}
+
+func (w *Watchdog) maybeCapture(now time.Time) {
+	if w.captureDir == "" {
+		return
+	}
+
+	w.mu.Lock()
+	if !w.lastCapture.IsZero() && now.Sub(w.lastCapture) < w.captureInterval {
+		w.mu.Unlock()
+		return
+	}
+	w.lastCapture = now
+	w.mu.Unlock()
+
+	dir, err := Capture(w.captureDir, now)
+	if err != nil {
+		log.Errorf("failed to capture diagnostics: %s", err)
+		return
+	}
+	log.Warningf("diagnostics written to %s", dir)
+}
+
+// Capture writes the goroutine, heap and mutex profiles to a new directory
+// under dir, and returns the path of that directory.
+func Capture(dir string, now time.Time) (string, error) {
+	out := filepath.Join(dir, "watchdog-"+now.UTC().Format("20060102T150405Z"))
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return "", err
+	}
+
+	for _, p := range []struct {
+		name  string
+		file  string
+		debug int
+	}{
+		{"goroutine", "goroutines.txt", 2},
+		{"heap", "heap.pprof", 0},
+		{"mutex", "mutex.pprof", 0},
+	} {
+		if err := writeProfile(filepath.Join(out, p.file), p.name, p.debug); err != nil {
+			return "", err
+		}
+	}
+	return out, nil
+}
+
+func writeProfile(path, name string, debug int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup(name).WriteTo(f, debug); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// countBlocked counts the goroutines of a goroutine dump that have been
+// waiting on a mutex for at least d.
+//
+// Goroutine headers look like "goroutine 42 [semacquire, 12 minutes]:". The
+// wait state is named "sync.Mutex.Lock" or "sync.RWMutex.Lock" in recent Go
+// releases.
+func countBlocked(dump []byte, d time.Duration) int {
+	count := 0
+	scanner := bufio.NewScanner(bytes.NewReader(dump))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "goroutine ") {
+			continue
+		}
+		start := strings.IndexByte(line, '[')
+		end := strings.LastIndexByte(line, ']')
+		if start < 0 || end < start {
+			continue
+		}
+
+		fields := strings.Split(line[start+1:end], ", ")
+		if !isMutexWait(fields[0]) {
+			continue
+		}
+		for _, f := range fields[1:] {
+			if !strings.HasSuffix(f, " minutes") {
+				continue
+			}
+			m, err := strconv.Atoi(strings.TrimSuffix(f, " minutes"))
+			if err == nil && time.Duration(m)*time.Minute >= d {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func isMutexWait(state string) bool {
+	switch state {
+	case "semacquire", "sync.Mutex.Lock", "sync.RWMutex.Lock", "sync.RWMutex.RLock":
+		return true
+	}
+	return false
+}
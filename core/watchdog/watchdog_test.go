@@ -0,0 +1,95 @@
+package watchdog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const dump = `goroutine 1 [running]:
+main.main()
+
+goroutine 7 [semacquire, 15 minutes]:
+sync.runtime_SemacquireMutex(0xc0000a2004, 0x0)
+
+goroutine 8 [sync.Mutex.Lock, 42 minutes, locked to thread]:
+sync.runtime_SemacquireMutex(0xc0000a2004, 0x0)
+
+goroutine 9 [semacquire, 2 minutes]:
+sync.runtime_SemacquireMutex(0xc0000a2004, 0x0)
+
+goroutine 10 [chan receive, 60 minutes]:
+main.worker()
+`
+
+func TestCountBlocked(t *testing.T) {
+	if n := countBlocked([]byte(dump), 10*time.Minute); n != 2 {
+		t.Fatalf("expected 2 blocked goroutines, got %d", n)
+	}
+	if n := countBlocked([]byte(dump), time.Minute); n != 3 {
+		t.Fatalf("expected 3 blocked goroutines, got %d", n)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	w, err := New(Config{MaxGoroutines: 100, LeakSamples: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i, n := range []int{10, 20, 30} {
+		if warnings := w.Check(Sample{Time: now, Goroutines: n}); len(warnings) != 0 {
+			t.Fatalf("sample %d: unexpected warnings %v", i, warnings)
+		}
+	}
+	if warnings := w.Check(Sample{Time: now, Goroutines: 40}); len(warnings) != 1 {
+		t.Fatalf("expected a leak warning, got %v", warnings)
+	}
+	if warnings := w.Check(Sample{Time: now, Goroutines: 30}); len(warnings) != 0 {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+	if warnings := w.Check(Sample{Time: now, Goroutines: 200, Blocked: 1}); len(warnings) != 2 {
+		t.Fatalf("expected goroutine and deadlock warnings, got %v", warnings)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := New(Config{MaxGoroutines: 1, CaptureDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	w.Check(Sample{Time: now, Goroutines: 2})
+	w.Check(Sample{Time: now.Add(time.Second), Goroutines: 2})
+
+	captures, err := filepath.Glob(filepath.Join(dir, "watchdog-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(captures) != 1 {
+		t.Fatalf("expected a single capture, got %v", captures)
+	}
+	for _, f := range []string{"goroutines.txt", "heap.pprof", "mutex.pprof"} {
+		if _, err := os.Stat(filepath.Join(captures[0], f)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	if _, err := New(Config{Interval: "soon"}); err == nil {
+		t.Fatal("expected an invalid interval to be rejected")
+	}
+	if _, err := New(Config{BlockedFor: "-1m"}); err == nil {
+		t.Fatal("expected a negative duration to be rejected")
+	}
+}
@@ -0,0 +1,134 @@
+// Package zerocopy serves the content of the node to the clients running on
+// the same host without streaming it through the HTTP API.
+//
+// The server listens on a Unix socket. A client sends a Request as a line of
+// JSON, and the server answers with a Response, passing the content as a
+// file descriptor with SCM_RIGHTS: a sealed memfd holding a copy of the
+// content, which the client can read or map without it going through a
+// socket. The content larger than the MaxSize of the config is refused with
+// ErrTooLarge, for the memfd is held in memory. A sidecar reading multi-GB
+// files this way saves the HTTP framing and the copies through the kernel
+// socket buffers of both processes.
+//
+// It is only supported on Linux.
+package zerocopy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	files "github.com/ipfs/go-ipfs-files"
+	logging "github.com/ipfs/go-log"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+var log = logging.Logger("zerocopy")
+
+// ConfigKey is the config key of the zero-copy API section.
+const ConfigKey = "Experimental.ZeroCopyAPI"
+
+// DefaultSocket is the name of the socket in the repo when none is
+// configured.
+const DefaultSocket = "zerocopy.sock"
+
+// DefaultMaxSize bounds the size of the content served when no MaxSize is
+// configured. The content is held in memory until the client closes it.
+const DefaultMaxSize = 1 << 30
+
+// Commands served.
+const (
+	CmdCat      = "cat"
+	CmdBlockGet = "block/get"
+)
+
+// ErrUnsupported is returned on the platforms without file descriptor
+// passing or memfd.
+var ErrUnsupported = errors.New("the zero-copy API is only supported on linux")
+
+// ErrTooLarge is returned for the content larger than the MaxSize of the
+// server. Clients read it through the HTTP API instead.
+var ErrTooLarge = errors.New("the content is too large for the zero-copy API")
+
+// Config holds the Experimental.ZeroCopyAPI config section.
+type Config struct {
+	Enabled bool
+
+	// Socket is the path of the Unix socket, relative to the repo if not
+	// absolute.
+	Socket string
+
+	// MaxSize bounds the size of the content served, in bytes.
+	// DefaultMaxSize when zero.
+	MaxSize int64
+}
+
+// LoadConfig reads the Experimental.ZeroCopyAPI section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// Limit returns the size of the largest content served.
+func (c Config) Limit() int64 {
+	if c.MaxSize <= 0 {
+		return DefaultMaxSize
+	}
+	return c.MaxSize
+}
+
+// SocketPath returns the path of the socket for the repo at repoPath.
+func (c Config) SocketPath(repoPath string) string {
+	if c.Socket == "" {
+		return filepath.Join(repoPath, DefaultSocket)
+	}
+	if filepath.IsAbs(c.Socket) {
+		return c.Socket
+	}
+	return filepath.Join(repoPath, c.Socket)
+}
+
+// Request asks for the content of Path, as the Command of the HTTP API would
+// return it.
+type Request struct {
+	Command string
+	Path    string
+}
+
+// Response answers a Request. It comes with the file descriptor of the
+// content unless Error is set.
+type Response struct {
+	Size  int64  `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+// opener returns the content requested.
+type opener func(ctx context.Context, req Request) (io.Reader, error)
+
+func apiOpener(api coreiface.CoreAPI) opener {
+	return func(ctx context.Context, req Request) (io.Reader, error) {
+		switch req.Command {
+		case CmdBlockGet:
+			return api.Block().Get(ctx, path.New(req.Path))
+		case CmdCat:
+			nd, err := api.Unixfs().Get(ctx, path.New(req.Path))
+			if err != nil {
+				return nil, err
+			}
+			f, ok := nd.(files.File)
+			if !ok {
+				nd.Close()
+				return nil, fmt.Errorf("%s is not a file", req.Path)
+			}
+			return f, nil
+		default:
+			return nil, fmt.Errorf("unknown command %q, expected %q or %q", req.Command, CmdCat, CmdBlockGet)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package zerocopy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	files "github.com/ipfs/go-ipfs-files"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	"golang.org/x/sys/unix"
+)
+
+// Listen listens on the Unix socket at socket, which only the user of the
+// daemon may connect to. A socket left at that path by a daemon that didn't
+// shut down cleanly is removed; any other file fails Listen.
+func Listen(socket string) (*net.UnixListener, error) {
+	fi, err := os.Lstat(socket)
+	switch {
+	case err == nil && fi.Mode()&os.ModeSocket == 0:
+		return nil, fmt.Errorf("%s exists and is not a socket", socket)
+	case err == nil:
+		if err := os.Remove(socket); err != nil {
+			return nil, err
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	lis, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// the socket is created with the mode the umask allows: a client of
+	// another user connecting before the chmod is refused by serve
+	if err := os.Chmod(socket, 0600); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
+
+// Serve answers the requests of the clients connecting to lis with the
+// content of api, up to maxSize bytes, until ctx is done.
+func Serve(ctx context.Context, lis *net.UnixListener, api coreiface.CoreAPI, maxSize int64) error {
+	return serve(ctx, lis, apiOpener(api), maxSize)
+}
+
+func serve(ctx context.Context, lis *net.UnixListener, open opener, maxSize int64) error {
+	go func() {
+		<-ctx.Done()
+		lis.Close()
+	}()
+
+	for {
+		conn, err := lis.AcceptUnix()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := checkPeer(conn); err != nil {
+			log.Infof("refused a client: %s", err)
+			conn.Close()
+			continue
+		}
+		go handle(ctx, conn, open, maxSize)
+	}
+}
+
+// checkPeer returns an error unless the client of conn runs as the user of
+// the daemon.
+func checkPeer(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var cred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return err
+	}
+	if credErr != nil {
+		return credErr
+	}
+	if int(cred.Uid) != os.Getuid() {
+		return fmt.Errorf("the client runs as uid %d", cred.Uid)
+	}
+	return nil
+}
+
+func handle(ctx context.Context, conn *net.UnixConn, open opener, maxSize int64) {
+	defer conn.Close()
+
+	dec := json.NewDecoder(conn)
+	for {
+		var req Request
+		if err := dec.Decode(&req); err != nil {
+			if err != io.EOF {
+				log.Debugf("invalid request: %s", err)
+			}
+			return
+		}
+
+		f, size, err := contentFile(ctx, req, open, maxSize)
+		if err != nil {
+			if err := writeResponse(conn, Response{Error: err.Error()}, nil); err != nil {
+				return
+			}
+			continue
+		}
+		err = writeResponse(conn, Response{Size: size}, f)
+		f.Close()
+		if err != nil {
+			log.Debugf("failed to answer %s %s: %s", req.Command, req.Path, err)
+			return
+		}
+	}
+}
+
+// contentFile copies the content requested to a sealed memfd, unless it is
+// larger than maxSize.
+func contentFile(ctx context.Context, req Request, open opener, maxSize int64) (*os.File, int64, error) {
+	r, err := open(ctx, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	if f, ok := r.(files.File); ok {
+		if size, err := f.Size(); err == nil && size > maxSize {
+			return nil, 0, ErrTooLarge
+		}
+	}
+
+	fd, err := unix.MemfdCreate("ipfs-"+req.Command, unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, 0, err
+	}
+	f := os.NewFile(uintptr(fd), "ipfs-"+req.Command)
+
+	size, err := io.Copy(f, io.LimitReader(r, maxSize+1))
+	if err == nil && size > maxSize {
+		err = ErrTooLarge
+	}
+	if err == nil {
+		// the client gets the content as it was: neither end can
+		// change it
+		_, err = unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL)
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, size, nil
+}
+
+func writeResponse(conn *net.UnixConn, resp Response, f *os.File) error {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	var oob []byte
+	if f != nil {
+		oob = unix.UnixRights(int(f.Fd()))
+	}
+	_, _, err = conn.WriteMsgUnix(b, oob, nil)
+	return err
+}
+
+// Open asks the server listening on socket for the content of req. The file
+// returned is positioned at the start of the content, which is size bytes
+// long, and can be mapped read-only.
+func Open(ctx context.Context, socket string, req Request) (f *os.File, size int64, err error) {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, 0, err
+	}
+	conn := c.(*net.UnixConn)
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, 0, err
+	}
+
+	buf := make([]byte, 4096)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fd := -1
+	if oobn > 0 {
+		msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, msg := range msgs {
+			fds, err := unix.ParseUnixRights(&msg)
+			if err != nil {
+				continue
+			}
+			for _, rfd := range fds {
+				if fd < 0 {
+					fd = rfd
+				} else {
+					unix.Close(rfd)
+				}
+			}
+		}
+	}
+
+	var resp Response
+	if err := json.Unmarshal(bytes.TrimSpace(buf[:n]), &resp); err != nil {
+		if fd >= 0 {
+			unix.Close(fd)
+		}
+		return nil, 0, fmt.Errorf("invalid response: %s", err)
+	}
+	if resp.Error != "" {
+		if fd >= 0 {
+			unix.Close(fd)
+		}
+		if resp.Error == ErrTooLarge.Error() {
+			return nil, 0, ErrTooLarge
+		}
+		return nil, 0, errors.New(resp.Error)
+	}
+	if fd < 0 {
+		return nil, 0, errors.New("the response carries no file descriptor")
+	}
+	return os.NewFile(uintptr(fd), req.Command+" "+req.Path), resp.Size, nil
+}
@@ -0,0 +1,26 @@
+// +build !linux
+
+package zerocopy
+
+import (
+	"context"
+	"net"
+	"os"
+
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+)
+
+// Listen returns ErrUnsupported.
+func Listen(socket string) (*net.UnixListener, error) {
+	return nil, ErrUnsupported
+}
+
+// Serve returns ErrUnsupported.
+func Serve(ctx context.Context, lis *net.UnixListener, api coreiface.CoreAPI, maxSize int64) error {
+	return ErrUnsupported
+}
+
+// Open returns ErrUnsupported.
+func Open(ctx context.Context, socket string, req Request) (*os.File, int64, error) {
+	return nil, 0, ErrUnsupported
+}
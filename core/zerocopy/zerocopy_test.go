@@ -0,0 +1,146 @@
+// +build linux
+
+package zerocopy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func startServer(t *testing.T, open opener, maxSize int64) (string, func()) {
+	dir, err := ioutil.TempDir("", "zerocopy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, DefaultSocket)
+	lis, err := Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- serve(ctx, lis, open, maxSize) }()
+	return socket, func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	content := strings.Repeat("zero copy ", 100000)
+	socket, stop := startServer(t, func(ctx context.Context, req Request) (io.Reader, error) {
+		if req.Command != CmdCat || req.Path != "/ipfs/QmFoo" {
+			return nil, errors.New("not found")
+		}
+		return strings.NewReader(content), nil
+	}, DefaultMaxSize)
+	defer stop()
+
+	ctx := context.Background()
+	f, size, err := Open(ctx, socket, Request{Command: CmdCat, Path: "/ipfs/QmFoo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if size != int64(len(content)) {
+		t.Fatalf("expected size %d, got %d", len(content), size)
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != content {
+		t.Fatal("content mismatch")
+	}
+
+	// the memfd is sealed
+	if _, err := f.WriteAt([]byte("x"), 0); err == nil {
+		t.Fatal("expected the content to be read-only")
+	}
+
+	_, _, err = Open(ctx, socket, Request{Command: CmdCat, Path: "/ipfs/QmBar"})
+	if err == nil || err.Error() != "not found" {
+		t.Fatalf("expected the error of the server, got %v", err)
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	socket, stop := startServer(t, func(ctx context.Context, req Request) (io.Reader, error) {
+		return strings.NewReader(req.Path), nil
+	}, 4)
+	defer stop()
+
+	f, _, err := Open(context.Background(), socket, Request{Command: CmdCat, Path: "four"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, _, err := Open(context.Background(), socket, Request{Command: CmdCat, Path: "five!"}); err != ErrTooLarge {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zerocopy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, DefaultSocket)
+
+	lis, err := Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Fatalf("expected the socket to be private, got %s", perm)
+	}
+
+	// a socket left over is replaced
+	lis.SetUnlinkOnClose(false)
+	lis.Close()
+	lis, err = Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.Close()
+
+	// other files are not removed
+	if err := ioutil.WriteFile(socket, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(socket); err == nil {
+		t.Fatal("expected a file that isn't a socket to be kept")
+	}
+	if b, err := ioutil.ReadFile(socket); err != nil || string(b) != "data" {
+		t.Fatalf("expected the file to be kept: %v", err)
+	}
+}
+
+func TestSocketPath(t *testing.T) {
+	for _, tc := range []struct {
+		socket, expected string
+	}{
+		{"", "/repo/zerocopy.sock"},
+		{"api.sock", "/repo/api.sock"},
+		{"/run/ipfs.sock", "/run/ipfs.sock"},
+	} {
+		if p := (Config{Socket: tc.socket}).SocketPath("/repo"); p != tc.expected {
+			t.Errorf("%q: expected %s, got %s", tc.socket, tc.expected, p)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package gc
+
+import (
+	"context"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Barrier is a blockstore letting the garbage collections run concurrently
+// with writes.
+//
+// A collection only holds the GC lock while it snapshots the pinset and the
+// best effort roots. While it marks and sweeps, the barrier marks the blocks
+// written, and shades the blocks they link to and the blocks pinned through
+// the pinner returned by Pinner: the collection marks their descendants
+// before sweeping, so that content written or pinned during a collection is
+// never removed.
+type Barrier struct {
+	bstore.GCBlockstore
+
+	// running serializes the collections.
+	running sync.Mutex
+
+	// mu orders the writes with the deletions of the sweep: a block is
+	// either marked before the sweep checks it, or written after it was
+	// deleted.
+	mu  sync.Mutex
+	run *marker
+}
+
+// NewBarrier wraps bs.
+func NewBarrier(bs bstore.GCBlockstore) *Barrier {
+	return &Barrier{GCBlockstore: bs}
+}
+
+// marker is the marked set of a collection.
+type marker struct {
+	mu   sync.Mutex
+	set  *cid.Set
+	grey []cid.Cid
+}
+
+func newMarker() *marker {
+	return &marker{set: cid.NewSet()}
+}
+
+// visit marks c, and returns whether it wasn't marked yet.
+func (m *marker) visit(c cid.Cid) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.set.Visit(c)
+}
+
+func (m *marker) has(c cid.Cid) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.set.Has(c)
+}
+
+func (m *marker) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.set.Len()
+}
+
+// shade queues c for marking with its descendants.
+func (m *marker) shade(c cid.Cid) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.set.Has(c) {
+		m.grey = append(m.grey, c)
+	}
+}
+
+// takeGrey returns the queued roots.
+func (m *marker) takeGrey() []cid.Cid {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	grey := m.grey
+	m.grey = nil
+	return grey
+}
+
+// start starts recording the writes for a collection.
+func (b *Barrier) start() *marker {
+	m := newMarker()
+	b.mu.Lock()
+	b.run = m
+	b.mu.Unlock()
+	return m
+}
+
+// stop stops recording the writes.
+func (b *Barrier) stop() {
+	b.mu.Lock()
+	b.run = nil
+	b.mu.Unlock()
+}
+
+// written marks blk, and shades the blocks it links to.
+func (b *Barrier) written(blk blocks.Block) {
+	m := b.run
+	if m == nil {
+		return
+	}
+	m.visit(blk.Cid())
+	nd, err := ipld.Decode(blk)
+	if err != nil {
+		// not a format we know the links of
+		return
+	}
+	for _, l := range nd.Links() {
+		m.shade(l.Cid)
+	}
+}
+
+// shade shades c, if a collection is running.
+func (b *Barrier) shade(c cid.Cid) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.run != nil {
+		b.run.shade(c)
+	}
+}
+
+func (b *Barrier) Put(blk blocks.Block) error {
+	b.mu.Lock()
+	b.written(blk)
+	b.mu.Unlock()
+	return b.GCBlockstore.Put(blk)
+}
+
+func (b *Barrier) PutMany(blks []blocks.Block) error {
+	b.mu.Lock()
+	for _, blk := range blks {
+		b.written(blk)
+	}
+	b.mu.Unlock()
+	return b.GCBlockstore.PutMany(blks)
+}
+
+// Pinner returns pn, shading the roots pinned while a collection runs.
+func (b *Barrier) Pinner(pn pin.Pinner) pin.Pinner {
+	return &barrierPinner{Pinner: pn, b: b}
+}
+
+type barrierPinner struct {
+	pin.Pinner
+	b *Barrier
+}
+
+func (p *barrierPinner) Pin(ctx context.Context, node ipld.Node, recursive bool) error {
+	p.b.shade(node.Cid())
+	return p.Pinner.Pin(ctx, node, recursive)
+}
+
+func (p *barrierPinner) PinWithMode(c cid.Cid, mode pin.Mode) {
+	p.b.shade(c)
+	p.Pinner.PinWithMode(c, mode)
+}
+
+func (p *barrierPinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error {
+	p.b.shade(to)
+	return p.Pinner.Update(ctx, from, to, unpin)
+}
+
+// DepthPins returns the depth-limited pins of the wrapped pinner, if any.
+func (p *barrierPinner) DepthPins(ctx context.Context) (map[cid.Cid]int, error) {
+	if dp, ok := p.Pinner.(DepthPinner); ok {
+		return dp.DepthPins(ctx)
+	}
+	return nil, nil
+}
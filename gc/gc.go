@@ -6,6 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
 
 	bserv "github.com/ipfs/go-blockservice"
 	cid "github.com/ipfs/go-cid"
@@ -23,6 +26,7 @@ var log = logging.Logger("gc")
 
 // Result represents an incremental output from a garbage collection
 // run.  It contains either an error, or the cid of a removed object.
+// A dry run reports the objects it would remove.
 type Result struct {
 	KeyRemoved cid.Cid
 	Error      error
@@ -37,117 +41,369 @@ type Result struct {
 //
 // The routine then iterates over every block in the blockstore and
 // deletes any block that is not found in the marked set.
+//
+// GC returns once the collection holds the GC lock. See Run for how long it
+// keeps it.
 func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid) <-chan Result {
+	return Run(ctx, bs, dstor, pn, Options{
+		BestEffortRoots: func() ([]cid.Cid, error) { return bestEffortRoots, nil },
+	})
+}
+
+// Options configure a garbage collection.
+type Options struct {
+	// BestEffortRoots returns the roots kept with their descendants found
+	// in the blockstore, such as the root of the files API. It is called
+	// with the GC lock held.
+	BestEffortRoots func() ([]cid.Cid, error)
+
+	// BatchSize is the number of blocks checked and removed at once while
+	// sweeping, DefaultBatchSize if zero.
+	BatchSize int
+
+	// Pause is how long the sweep waits between two batches.
+	Pause time.Duration
+
+	// Visitor, if set, is called with each block the collection removes,
+	// before it is removed. An error is reported, and the block kept.
+	Visitor func(k cid.Cid) error
+
+	// DryRun keeps every block: the collection only reports, and passes to
+	// Visitor, the blocks it would remove.
+	DryRun bool
+}
+
+// Run performs a garbage collection like GC does.
+//
+// When bs is a Barrier, the GC lock is only held while the pinset and the
+// best effort roots are snapshotted: the blocks are then marked and swept
+// while the node keeps adding and pinning content, the barrier keeping what
+// is written or pinned meanwhile. The sweep removes the blocks opts.BatchSize
+// at a time, pausing opts.Pause between two batches so that the collection
+// doesn't starve the other users of the blockstore.
+//
+// Otherwise, the GC lock is held during the whole collection.
+func Run(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, opts Options) <-chan Result {
 	ctx, cancel := context.WithCancel(ctx)
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.BestEffortRoots == nil {
+		opts.BestEffortRoots = func() ([]cid.Cid, error) { return nil, nil }
+	}
+
+	b, concurrent := bs.(*Barrier)
+	if concurrent {
+		// one collection at a time: the barrier records for one
+		b.running.Lock()
+	}
 
 	elock := log.EventBegin(ctx, "GC.lockWait")
 	unlocker := bs.GCLock()
 	elock.Done()
 	elock = log.EventBegin(ctx, "GC.locked")
-	emark := log.EventBegin(ctx, "GC.mark")
 
 	bsrv := bserv.New(bs, offline.Exchange(bs))
 	ds := dag.NewDAGService(bsrv)
 
 	output := make(chan Result, 128)
 
+	if !concurrent {
+		go func() {
+			defer cancel()
+			defer close(output)
+			defer unlocker.Unlock()
+			defer elock.Done()
+
+			emark := log.EventBegin(ctx, "GC.mark")
+			roots, err := opts.BestEffortRoots()
+			if err != nil {
+				sendError(ctx, output, err)
+				return
+			}
+			gcs, err := ColoredSet(ctx, pn, ds, roots, output)
+			if err != nil {
+				sendError(ctx, output, err)
+				return
+			}
+			emark.Append(logging.LoggableMap{
+				"blackSetSize": fmt.Sprintf("%d", gcs.Len()),
+			})
+			emark.Done()
+
+			s := &sweeper{bs: bs, output: output, opts: opts}
+			if !s.sweep(ctx, opts.BatchSize, 0, func(batch []cid.Cid) bool {
+				for _, k := range batch {
+					if !gcs.Has(k) && !s.remove(ctx, k) {
+						return false
+					}
+				}
+				return true
+			}) {
+				return
+			}
+			if !opts.DryRun {
+				collectDatastore(ctx, dstor, output)
+			}
+		}()
+		return output
+	}
+
+	// snapshot under the GC lock: from now on, the barrier records what
+	// is written and pinned
+	m := b.start()
+	snap, err := snapshot(ctx, pn)
+	var roots []cid.Cid
+	if err == nil {
+		roots, err = opts.BestEffortRoots()
+	}
+	unlocker.Unlock()
+	elock.Done()
+
 	go func() {
 		defer cancel()
 		defer close(output)
-		defer unlocker.Unlock()
-		defer elock.Done()
+		defer b.running.Unlock()
+		defer b.stop()
 
-		gcs, err := ColoredSet(ctx, pn, ds, bestEffortRoots, output)
 		if err != nil {
-			select {
-			case output <- Result{Error: err}:
-			case <-ctx.Done():
-			}
+			sendError(ctx, output, err)
+			return
+		}
+
+		emark := log.EventBegin(ctx, "GC.mark")
+		if err := colorSnapshot(ctx, snap, ds, roots, output, m.visit); err != nil {
+			sendError(ctx, output, err)
 			return
 		}
 		emark.Append(logging.LoggableMap{
-			"blackSetSize": fmt.Sprintf("%d", gcs.Len()),
+			"blackSetSize": fmt.Sprintf("%d", m.len()),
 		})
 		emark.Done()
-		esweep := log.EventBegin(ctx, "GC.sweep")
 
-		keychan, err := bs.AllKeysChan(ctx)
-		if err != nil {
-			select {
-			case output <- Result{Error: err}:
-			case <-ctx.Done():
+		// the links of the blocks written and the roots pinned since
+		// the snapshot may be missing from the blockstore: they are
+		// marked on a best effort basis
+		getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+			links, err := ipld.GetLinks(ctx, ds, c)
+			if err != nil {
+				log.Debugf("could not retrieve links for %s: %s", c, err)
 			}
-			return
+			return links, nil
+		}
+		drain := func() error {
+			for grey := m.takeGrey(); len(grey) > 0; grey = m.takeGrey() {
+				if err := descendants(ctx, getLinks, m.visit, grey); err != nil {
+					return err
+				}
+			}
+			return nil
 		}
 
-		errors := false
-		var removed uint64
+		s := &sweeper{bs: b.GCBlockstore, output: output, opts: opts}
+		if !s.sweep(ctx, opts.BatchSize, opts.Pause, func(batch []cid.Cid) bool {
+			// mark most of what was written since the last batch
+			// without blocking the writes
+			if err := drain(); err != nil {
+				sendError(ctx, output, err)
+				return false
+			}
 
-	loop:
-		for ctx.Err() == nil { // select may not notice that we're "done".
-			select {
-			case k, ok := <-keychan:
-				if !ok {
-					break loop
-				}
-				if !gcs.Has(k) {
-					err := bs.DeleteBlock(k)
-					removed++
-					if err != nil {
-						errors = true
-						select {
-						case output <- Result{Error: &CannotDeleteBlockError{k, err}}:
-						case <-ctx.Done():
-							break loop
-						}
-						// continue as error is non-fatal
-						continue loop
-					}
-					select {
-					case output <- Result{KeyRemoved: k}:
-					case <-ctx.Done():
-						break loop
-					}
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if err := drain(); err != nil {
+				sendError(ctx, output, err)
+				return false
+			}
+			for _, k := range batch {
+				if !m.has(k) && !s.remove(ctx, k) {
+					return false
 				}
-			case <-ctx.Done():
-				break loop
 			}
+			return true
+		}) {
+			return
+		}
+		if !opts.DryRun {
+			collectDatastore(ctx, dstor, output)
 		}
+	}()
+
+	return output
+}
+
+// DefaultBatchSize is the number of blocks removed at once by a collection
+// when none is configured.
+const DefaultBatchSize = 1024
+
+// ConfigKey is the config key of the garbage collection section.
+const ConfigKey = "Datastore.GC"
+
+// Config holds the Datastore.GC config section.
+type Config struct {
+	// BatchSize is the number of blocks checked and removed at once while
+	// sweeping.
+	BatchSize int
+
+	// Pause is how long the sweep waits between two batches, as a
+	// duration string.
+	Pause string
+}
+
+// LoadConfig reads the Datastore.GC section of the config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// Options returns the options configured by c.
+func (c Config) Options() (Options, error) {
+	opts := Options{BatchSize: c.BatchSize}
+	if c.BatchSize < 0 {
+		return opts, fmt.Errorf("invalid %s.BatchSize: must not be negative", ConfigKey)
+	}
+	if c.Pause != "" {
+		d, err := time.ParseDuration(c.Pause)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s.Pause: %s", ConfigKey, err)
+		}
+		opts.Pause = d
+	}
+	return opts, nil
+}
+
+func sendError(ctx context.Context, output chan<- Result, err error) {
+	select {
+	case output <- Result{Error: err}:
+	case <-ctx.Done():
+	}
+}
+
+// sweeper removes the blocks of a collection.
+type sweeper struct {
+	bs      bstore.GCBlockstore
+	output  chan<- Result
+	opts    Options
+	removed uint64
+	failed  bool
+}
+
+// sweep passes the keys of the blockstore to removeBatch, batchSize at a
+// time, pausing between two batches. It returns false if the collection
+// was aborted.
+func (s *sweeper) sweep(ctx context.Context, batchSize int, pause time.Duration, removeBatch func([]cid.Cid) bool) bool {
+	esweep := log.EventBegin(ctx, "GC.sweep")
+	defer func() {
 		esweep.Append(logging.LoggableMap{
-			"whiteSetSize": fmt.Sprintf("%d", removed),
+			"whiteSetSize": fmt.Sprintf("%d", s.removed),
 		})
 		esweep.Done()
-		if errors {
+	}()
+
+	keychan, err := s.bs.AllKeysChan(ctx)
+	if err != nil {
+		sendError(ctx, s.output, err)
+		return false
+	}
+
+	batch := make([]cid.Cid, 0, batchSize)
+	flush := func() bool {
+		if len(batch) == 0 {
+			return true
+		}
+		if !removeBatch(batch) {
+			return false
+		}
+		batch = batch[:0]
+		if pause > 0 {
 			select {
-			case output <- Result{Error: ErrCannotDeleteSomeBlocks}:
+			case <-time.After(pause):
 			case <-ctx.Done():
-				return
+				return false
 			}
 		}
+		return true
+	}
 
-		defer log.EventBegin(ctx, "GC.datastore").Done()
-		gds, ok := dstor.(dstore.GCDatastore)
-		if !ok {
-			return
+loop:
+	for ctx.Err() == nil { // select may not notice that we're "done".
+		select {
+		case k, ok := <-keychan:
+			if !ok {
+				break loop
+			}
+			batch = append(batch, k)
+			if len(batch) == batchSize && !flush() {
+				return false
+			}
+		case <-ctx.Done():
+			return false
 		}
+	}
+	if ctx.Err() != nil || !flush() {
+		return false
+	}
 
-		err = gds.CollectGarbage()
-		if err != nil {
-			select {
-			case output <- Result{Error: err}:
-			case <-ctx.Done():
-			}
-			return
+	if s.failed {
+		select {
+		case s.output <- Result{Error: ErrCannotDeleteSomeBlocks}:
+		case <-ctx.Done():
+			return false
 		}
-	}()
+	}
+	return true
+}
 
-	return output
+// remove removes the block of k. It returns false if the collection was
+// aborted.
+func (s *sweeper) remove(ctx context.Context, k cid.Cid) bool {
+	var err error
+	if s.opts.Visitor != nil {
+		err = s.opts.Visitor(k)
+	}
+	if err == nil && !s.opts.DryRun {
+		err = s.bs.DeleteBlock(k)
+	}
+	s.removed++
+	if err != nil {
+		s.failed = true
+		select {
+		case s.output <- Result{Error: &CannotDeleteBlockError{k, err}}:
+			// continue as error is non-fatal
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	select {
+	case s.output <- Result{KeyRemoved: k}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func collectDatastore(ctx context.Context, dstor dstore.Datastore, output chan<- Result) {
+	defer log.EventBegin(ctx, "GC.datastore").Done()
+	gds, ok := dstor.(dstore.GCDatastore)
+	if !ok {
+		return
+	}
+
+	if err := gds.CollectGarbage(); err != nil {
+		sendError(ctx, output, err)
+	}
 }
 
 // Descendants recursively finds all the descendants of the given roots and
 // adds them to the given cid.Set, using the provided dag.GetLinks function
 // to walk the tree.
 func Descendants(ctx context.Context, getLinks dag.GetLinks, set *cid.Set, roots []cid.Cid) error {
+	return descendants(ctx, getLinks, set.Visit, roots)
+}
+
+func descendants(ctx context.Context, getLinks dag.GetLinks, visit func(cid.Cid) bool, roots []cid.Cid) error {
 	verifyGetLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
 		err := verifcid.ValidateCid(c)
 		if err != nil {
@@ -170,7 +426,7 @@ func Descendants(ctx context.Context, getLinks dag.GetLinks, set *cid.Set, roots
 
 	for _, c := range roots {
 		// Walk recursively walks the dag and adds the keys to the given set
-		err := dag.Walk(ctx, verifyGetLinks, c, set.Visit, dag.Concurrent())
+		err := dag.Walk(ctx, verifyGetLinks, c, visit, dag.Concurrent())
 
 		if err != nil {
 			err = verboseCidError(err)
@@ -184,10 +440,102 @@ func Descendants(ctx context.Context, getLinks dag.GetLinks, set *cid.Set, roots
 // ColoredSet computes the set of nodes in the graph that are pinned by the
 // pins in the given pinner.
 func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result) (*cid.Set, error) {
+	snap, err := snapshot(ctx, pn)
+	if err != nil {
+		return nil, err
+	}
 	// KeySet currently implemented in memory, in the future, may be bloom filter or
 	// disk backed to conserve memory.
-	errors := false
 	gcs := cid.NewSet()
+	if err := colorSnapshot(ctx, snap, ng, bestEffortRoots, output, gcs.Visit); err != nil {
+		return nil, err
+	}
+	return gcs, nil
+}
+
+// DepthPinner is implemented by the pinners keeping depth-limited pins:
+// direct pins whose descendants are kept too, down to a number of levels
+// below them.
+type DepthPinner interface {
+	// DepthPins returns the depths of the depth-limited pins, by root.
+	DepthPins(ctx context.Context) (map[cid.Cid]int, error)
+}
+
+// pinSnapshot holds the pins of a pinner at the start of a collection.
+type pinSnapshot struct {
+	recursive, direct, internal []cid.Cid
+
+	// depth holds the depths of the depth-limited direct pins.
+	depth map[cid.Cid]int
+}
+
+func snapshot(ctx context.Context, pn pin.Pinner) (pinSnapshot, error) {
+	var snap pinSnapshot
+	var err error
+	if snap.recursive, err = pn.RecursiveKeys(ctx); err != nil {
+		return snap, err
+	}
+	if snap.direct, err = pn.DirectKeys(ctx); err != nil {
+		return snap, err
+	}
+	if dp, ok := pn.(DepthPinner); ok {
+		depths, err := dp.DepthPins(ctx)
+		if err != nil {
+			return snap, err
+		}
+		// only the roots still pinned count
+		snap.depth = make(map[cid.Cid]int)
+		for _, c := range snap.direct {
+			if d, ok := depths[c]; ok {
+				snap.depth[c] = d
+			}
+		}
+	}
+	snap.internal, err = pn.InternalPins(ctx)
+	return snap, err
+}
+
+// WalkDepth calls visit with the roots and their descendants down to the depth
+// of each root, fetching the links with getLinks. A node reached from several
+// roots is walked down to the deepest level any of them reaches.
+func WalkDepth(ctx context.Context, getLinks dag.GetLinks, roots map[cid.Cid]int, visit func(cid.Cid) bool) error {
+	// the largest depth each node was walked with
+	walked := make(map[cid.Cid]int)
+	var walk func(c cid.Cid, depth int) error
+	walk = func(c cid.Cid, depth int) error {
+		if d, ok := walked[c]; ok && d >= depth {
+			return nil
+		}
+		walked[c] = depth
+		visit(c)
+		if depth == 0 {
+			return nil
+		}
+		if err := verifcid.ValidateCid(c); err != nil {
+			return err
+		}
+		links, err := getLinks(ctx, c)
+		if err != nil {
+			return err
+		}
+		for _, l := range links {
+			if err := walk(l.Cid, depth-1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for c, depth := range roots {
+		if err := walk(c, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// colorSnapshot marks the nodes pinned by snap with visit.
+func colorSnapshot(ctx context.Context, snap pinSnapshot, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result, visit func(cid.Cid) bool) error {
+	errors := false
 	getLinks := func(ctx context.Context, cid cid.Cid) ([]*ipld.Link, error) {
 		links, err := ipld.GetLinks(ctx, ng, cid)
 		if err != nil {
@@ -200,17 +548,13 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 		}
 		return links, nil
 	}
-	rkeys, err := pn.RecursiveKeys(ctx)
-	if err != nil {
-		return nil, err
-	}
-	err = Descendants(ctx, getLinks, gcs, rkeys)
+	err := descendants(ctx, getLinks, visit, snap.recursive)
 	if err != nil {
 		errors = true
 		select {
 		case output <- Result{Error: err}:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 
@@ -226,43 +570,45 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 		}
 		return links, nil
 	}
-	err = Descendants(ctx, bestEffortGetLinks, gcs, bestEffortRoots)
+	err = descendants(ctx, bestEffortGetLinks, visit, bestEffortRoots)
 	if err != nil {
 		errors = true
 		select {
 		case output <- Result{Error: err}:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 
-	dkeys, err := pn.DirectKeys(ctx)
-	if err != nil {
-		return nil, err
-	}
-	for _, k := range dkeys {
-		gcs.Add(k)
+	for _, k := range snap.direct {
+		visit(k)
 	}
 
-	ikeys, err := pn.InternalPins(ctx)
+	err = WalkDepth(ctx, getLinks, snap.depth, visit)
 	if err != nil {
-		return nil, err
+		errors = true
+		select {
+		case output <- Result{Error: err}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
-	err = Descendants(ctx, getLinks, gcs, ikeys)
+
+	err = descendants(ctx, getLinks, visit, snap.internal)
 	if err != nil {
 		errors = true
 		select {
 		case output <- Result{Error: err}:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 
 	if errors {
-		return nil, ErrCannotFetchAllLinks
+		return ErrCannotFetchAllLinks
 	}
 
-	return gcs, nil
+	return nil
 }
 
 // ErrCannotFetchAllLinks is returned as the last Result in the GC output
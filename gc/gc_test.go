@@ -0,0 +1,265 @@
+package gc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+type fixture struct {
+	bs    bstore.GCBlockstore
+	b     *Barrier
+	dserv ipld.DAGService
+	pn    pin.Pinner
+	dstor ds.Datastore
+}
+
+func newFixture(barrier bool) *fixture {
+	dstor := dssync.MutexWrap(ds.NewMapDatastore())
+	var bs bstore.GCBlockstore = bstore.NewGCBlockstore(bstore.NewBlockstore(dstor), bstore.NewGCLocker())
+	f := &fixture{dstor: dstor}
+	if barrier {
+		f.b = NewBarrier(bs)
+		bs = f.b
+	}
+	f.bs = bs
+	f.dserv = dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	f.pn = pin.NewPinner(dstor, f.dserv, f.dserv)
+	if barrier {
+		f.pn = f.b.Pinner(f.pn)
+	}
+	return f
+}
+
+func (f *fixture) add(t *testing.T, data string, links ...ipld.Node) *dag.ProtoNode {
+	nd := dag.NodeWithData([]byte(data))
+	for _, l := range links {
+		if err := nd.AddNodeLink(l.Cid().String(), l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.dserv.Add(context.Background(), nd); err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func (f *fixture) has(t *testing.T, c cid.Cid) bool {
+	has, err := f.bs.Has(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return has
+}
+
+func collect(t *testing.T, out <-chan Result) int {
+	removed := 0
+	for res := range out {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		removed++
+	}
+	return removed
+}
+
+func testCollect(t *testing.T, barrier bool) {
+	ctx := context.Background()
+	f := newFixture(barrier)
+
+	leaf := f.add(t, "leaf")
+	root := f.add(t, "root", leaf)
+	if err := f.pn.Pin(ctx, root, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.pn.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mfs := f.add(t, "mfs")
+	garbage := []*dag.ProtoNode{f.add(t, "a"), f.add(t, "b"), f.add(t, "c")}
+
+	out := Run(ctx, f.bs, f.dstor, f.pn, Options{
+		BestEffortRoots: func() ([]cid.Cid, error) { return []cid.Cid{mfs.Cid()}, nil },
+		BatchSize:       2,
+	})
+	collect(t, out)
+
+	for _, nd := range []*dag.ProtoNode{leaf, root, mfs} {
+		if !f.has(t, nd.Cid()) {
+			t.Errorf("%s was removed", nd.Data())
+		}
+	}
+	for _, nd := range garbage {
+		if f.has(t, nd.Cid()) {
+			t.Errorf("%s was kept", nd.Data())
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	testCollect(t, true)
+}
+
+func TestCollectStopTheWorld(t *testing.T) {
+	testCollect(t, false)
+}
+
+func TestWritesDuringCollection(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(true)
+
+	for _, data := range []string{"a", "b", "c", "d"} {
+		f.add(t, data)
+	}
+
+	out := Run(ctx, f.bs, f.dstor, f.pn, Options{BatchSize: 1, Pause: 50 * time.Millisecond})
+
+	// written while the collection runs, and unpinned: only the barrier
+	// keeps it
+	written := f.add(t, "written")
+	if n := collect(t, out); n < 4 {
+		t.Errorf("expected the unpinned blocks to be removed, %d were", n)
+	}
+	if !f.has(t, written.Cid()) {
+		t.Error("the block written during the collection was removed")
+	}
+}
+
+func TestPinsDuringCollectionAreShaded(t *testing.T) {
+	f := newFixture(true)
+	nd := f.add(t, "pinned")
+
+	m := f.b.start()
+	f.pn.PinWithMode(nd.Cid(), pin.Recursive)
+	grey := m.takeGrey()
+	if len(grey) != 1 || !grey[0].Equals(nd.Cid()) {
+		t.Fatalf("expected %s to be shaded, got %v", nd.Cid(), grey)
+	}
+	f.b.stop()
+
+	f.pn.PinWithMode(nd.Cid(), pin.Direct)
+	if grey := m.takeGrey(); len(grey) != 0 {
+		t.Fatalf("expected nothing to be shaded after the collection, got %v", grey)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(true)
+
+	garbage := []*dag.ProtoNode{f.add(t, "a"), f.add(t, "b")}
+
+	visited := make(map[cid.Cid]bool)
+	out := Run(ctx, f.bs, f.dstor, f.pn, Options{
+		Visitor: func(k cid.Cid) error {
+			visited[k] = true
+			return nil
+		},
+		DryRun: true,
+	})
+	if n := collect(t, out); n != len(garbage) {
+		t.Fatalf("expected %d blocks to be reported, got %d", len(garbage), n)
+	}
+	for _, nd := range garbage {
+		if !visited[nd.Cid()] {
+			t.Errorf("%s wasn't visited", nd.Data())
+		}
+		if !f.has(t, nd.Cid()) {
+			t.Errorf("%s was removed by a dry run", nd.Data())
+		}
+	}
+}
+
+// depthPinner keeps depth-limited pins for the tests.
+type depthPinner struct {
+	pin.Pinner
+	depths map[cid.Cid]int
+}
+
+func (p *depthPinner) DepthPins(ctx context.Context) (map[cid.Cid]int, error) {
+	return p.depths, nil
+}
+
+func testDepthPins(t *testing.T, barrier bool) {
+	ctx := context.Background()
+	f := newFixture(barrier)
+
+	deep := f.add(t, "deep")
+	leaf := f.add(t, "leaf", deep)
+	mid := f.add(t, "mid", leaf)
+	root := f.add(t, "root", mid)
+	// a depth recorded for a root which isn't pinned anymore is ignored
+	unpinned := f.add(t, "unpinned", f.add(t, "child"))
+
+	dp := &depthPinner{depths: map[cid.Cid]int{root.Cid(): 2, unpinned.Cid(): 1}}
+	if barrier {
+		dp.Pinner = f.pn.(*barrierPinner).Pinner
+		f.pn = f.b.Pinner(dp)
+	} else {
+		dp.Pinner = f.pn
+		f.pn = dp
+	}
+	if err := f.pn.Pin(ctx, root, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.pn.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	collect(t, Run(ctx, f.bs, f.dstor, f.pn, Options{}))
+
+	for _, nd := range []*dag.ProtoNode{root, mid, leaf} {
+		if !f.has(t, nd.Cid()) {
+			t.Errorf("%s was removed", nd.Data())
+		}
+	}
+	for _, nd := range []*dag.ProtoNode{deep, unpinned} {
+		if f.has(t, nd.Cid()) {
+			t.Errorf("%s was kept", nd.Data())
+		}
+	}
+}
+
+func TestDepthPins(t *testing.T) {
+	testDepthPins(t, true)
+}
+
+func TestDepthPinsStopTheWorld(t *testing.T) {
+	testDepthPins(t, false)
+}
+
+func TestWalkDepth(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(false)
+
+	c := f.add(t, "c")
+	b := f.add(t, "b", c)
+	a := f.add(t, "a", b)
+	visited := cid.NewSet()
+	err := WalkDepth(ctx, dag.GetLinksWithDAG(f.dserv), map[cid.Cid]int{a.Cid(): 1}, visited.Visit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visited.Len() != 2 || visited.Has(c.Cid()) {
+		t.Fatalf("expected a and b to be visited, got %v", visited.Keys())
+	}
+	// b is reached at depth 0 from a, and at depth 1 from itself: c is
+	// walked whichever comes first
+	err = WalkDepth(ctx, dag.GetLinksWithDAG(f.dserv), map[cid.Cid]int{a.Cid(): 1, b.Cid(): 1}, visited.Visit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !visited.Has(c.Cid()) {
+		t.Fatal("expected c to be visited from b")
+	}
+}
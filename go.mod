@@ -104,8 +104,10 @@ require (
 	go.uber.org/goleak v0.10.0 // indirect
 	go.uber.org/multierr v1.1.0 // indirect
 	go4.org v0.0.0-20190313082347-94abd6928b1d // indirect
+	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
 	golang.org/x/sync v0.0.0-20190423024810-112230192c58 // indirect
 	golang.org/x/sys v0.0.0-20190926180325-855e68c8590b
+	golang.org/x/text v0.3.2
 	gopkg.in/cheggaaa/pb.v1 v1.0.28
 )
 
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	logging "github.com/ipfs/go-log"
 	ci "github.com/libp2p/go-libp2p-core/crypto"
@@ -149,6 +150,22 @@ func (ks *FSKeystore) Delete(name string) error {
 	return os.Remove(kp)
 }
 
+// ModTime returns when the key was written to the keystore
+func (ks *FSKeystore) ModTime(name string) (time.Time, error) {
+	if err := validateName(name); err != nil {
+		return time.Time{}, err
+	}
+
+	fi, err := os.Stat(filepath.Join(ks.dir, name))
+	if os.IsNotExist(err) {
+		return time.Time{}, ErrNoSuchKey
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
 // List return a list of key identifier
 func (ks *FSKeystore) List() ([]string, error) {
 	dir, err := os.Open(ks.dir)
@@ -164,6 +181,10 @@ func (ks *FSKeystore) List() ([]string, error) {
 	list := make([]string, 0, len(dirs))
 
 	for _, name := range dirs {
+		if name == swarmKeyName {
+			continue
+		}
+
 		err := validateName(name)
 		if err == nil {
 			list = append(list, name)
@@ -0,0 +1,194 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// swarmKeyName is the name of the file holding the swarm key in the keystore
+// directory. Key names can't begin with a period, so it never clashes with a
+// key.
+const swarmKeyName = ".swarmkey"
+
+// Ciphers of stored swarm keys.
+const (
+	swarmKeyPlain  = "none"
+	swarmKeyScrypt = "scrypt-aes256-gcm"
+)
+
+// scrypt parameters, as recommended for interactive logins.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// ErrPassphraseRequired is returned when the swarm key is encrypted and no
+// passphrase was provided.
+var ErrPassphraseRequired = errors.New("the swarm key is encrypted, a passphrase is required")
+
+// ErrBadPassphrase is returned when the swarm key can't be decrypted with the
+// provided passphrase.
+var ErrBadPassphrase = errors.New("failed to decrypt the swarm key: wrong passphrase")
+
+// SwarmKeyStore stores the private network swarm key.
+type SwarmKeyStore interface {
+	// HasSwarmKey returns whether a swarm key is stored.
+	HasSwarmKey() (bool, error)
+	// PutSwarmKey stores the swarm key, replacing the stored one if any. If
+	// passphrase isn't empty, the key is encrypted with it.
+	PutSwarmKey(key []byte, passphrase []byte) error
+	// SwarmKey returns the stored swarm key, or nil if there is none. If the
+	// key is encrypted, passphrase is called to get the passphrase.
+	SwarmKey(passphrase func() ([]byte, error)) ([]byte, error)
+	// DeleteSwarmKey removes the stored swarm key.
+	DeleteSwarmKey() error
+}
+
+var _ SwarmKeyStore = (*FSKeystore)(nil)
+
+// storedSwarmKey is the format of the swarm key file.
+type storedSwarmKey struct {
+	Cipher string
+	Salt   []byte `json:",omitempty"`
+	Nonce  []byte `json:",omitempty"`
+	Data   []byte
+}
+
+// HasSwarmKey returns whether a swarm key is stored.
+func (ks *FSKeystore) HasSwarmKey() (bool, error) {
+	_, err := os.Stat(filepath.Join(ks.dir, swarmKeyName))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// PutSwarmKey stores the swarm key, replacing the stored one if any. If
+// passphrase isn't empty, the key is encrypted with it.
+func (ks *FSKeystore) PutSwarmKey(key []byte, passphrase []byte) error {
+	stored := storedSwarmKey{Cipher: swarmKeyPlain, Data: key}
+	if len(passphrase) > 0 {
+		stored.Cipher = swarmKeyScrypt
+		stored.Salt = make([]byte, saltLen)
+		if _, err := rand.Read(stored.Salt); err != nil {
+			return err
+		}
+
+		aead, err := swarmKeyCipher(passphrase, stored.Salt)
+		if err != nil {
+			return err
+		}
+		stored.Nonce = make([]byte, aead.NonceSize())
+		if _, err := rand.Read(stored.Nonce); err != nil {
+			return err
+		}
+		stored.Data = aead.Seal(nil, stored.Nonce, key, nil)
+	}
+
+	b, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that a failure never leaves a
+	// truncated key behind.
+	kp := filepath.Join(ks.dir, swarmKeyName)
+	tmp := kp + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, kp)
+}
+
+// SwarmKey returns the stored swarm key, or nil if there is none. If the key
+// is encrypted, passphrase is called to get the passphrase.
+func (ks *FSKeystore) SwarmKey(passphrase func() ([]byte, error)) ([]byte, error) {
+	b, err := ioutil.ReadFile(filepath.Join(ks.dir, swarmKeyName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var stored storedSwarmKey
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse the stored swarm key: %s", err)
+	}
+
+	switch stored.Cipher {
+	case swarmKeyPlain:
+		return stored.Data, nil
+	case swarmKeyScrypt:
+		if passphrase == nil {
+			return nil, ErrPassphraseRequired
+		}
+		pass, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if len(pass) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+
+		aead, err := swarmKeyCipher(pass, stored.Salt)
+		if err != nil {
+			return nil, err
+		}
+		key, err := aead.Open(nil, stored.Nonce, stored.Data, nil)
+		if err != nil {
+			return nil, ErrBadPassphrase
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unknown swarm key cipher %q", stored.Cipher)
+	}
+}
+
+// DeleteSwarmKey removes the stored swarm key.
+func (ks *FSKeystore) DeleteSwarmKey() error {
+	err := os.Remove(filepath.Join(ks.dir, swarmKeyName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func swarmKeyCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ReadPassphrase prints prompt and reads a passphrase from the terminal
+// without echoing it. It fails if stdin isn't a terminal.
+func ReadPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, errors.New("cannot prompt for a passphrase: stdin is not a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return pass, err
+}
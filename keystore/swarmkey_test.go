@@ -0,0 +1,97 @@
+package keystore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+var testSwarmKey = []byte("/key/swarm/psk/1.0.0/\n/base16/\n0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef\n")
+
+func TestSwarmKey(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	ks, err := NewFSKeystore(tdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key, err := ks.SwarmKey(nil); err != nil || key != nil {
+		t.Fatalf("expected no swarm key, got %q, %v", key, err)
+	}
+
+	if err := ks.PutSwarmKey(testSwarmKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ks.SwarmKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, testSwarmKey) {
+		t.Fatalf("expected %q, got %q", testSwarmKey, key)
+	}
+
+	// The swarm key is not a key.
+	names, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Fatalf("expected no keys, got %v", names)
+	}
+
+	if err := ks.DeleteSwarmKey(); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := ks.HasSwarmKey(); err != nil || has {
+		t.Fatalf("expected the swarm key to be deleted, got %t, %v", has, err)
+	}
+}
+
+func TestEncryptedSwarmKey(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	ks, err := NewFSKeystore(tdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.PutSwarmKey(testSwarmKey, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(tdir + "/" + swarmKeyName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("0123456789abcdef")) {
+		t.Fatal("the swarm key is stored in clear")
+	}
+
+	if _, err := ks.SwarmKey(nil); err != ErrPassphraseRequired {
+		t.Fatalf("expected a passphrase to be required, got %v", err)
+	}
+
+	passphrase := func(p string) func() ([]byte, error) {
+		return func() ([]byte, error) { return []byte(p), nil }
+	}
+	if _, err := ks.SwarmKey(passphrase("wrong")); err != ErrBadPassphrase {
+		t.Fatalf("expected a wrong passphrase to be rejected, got %v", err)
+	}
+	key, err := ks.SwarmKey(passphrase("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, testSwarmKey) {
+		t.Fatalf("expected %q, got %q", testSwarmKey, key)
+	}
+}
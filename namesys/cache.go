@@ -1,11 +1,105 @@
 package namesys
 
 import (
+	"sync/atomic"
 	"time"
 
 	path "github.com/ipfs/go-path"
 )
 
+// CacheStats reports how effective the resolution cache of a name system is.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+
+	// Entries is the number of cached names, including expired entries
+	// that haven't been evicted yet. Capacity is the maximum number of
+	// entries, as set by Ipns.ResolveCacheSize.
+	Entries  int
+	Capacity int
+}
+
+// CacheEntry is a resolved name held in the resolution cache.
+type CacheEntry struct {
+	Name  string
+	Value path.Path
+	EOL   time.Time
+}
+
+// Cache is implemented by name systems that cache resolved names.
+type Cache interface {
+	// CacheStats returns the counters of the cache.
+	CacheStats() CacheStats
+
+	// CacheEntries lists the unexpired entries of the cache.
+	CacheEntries() []CacheEntry
+
+	// CacheRemove evicts the given name from the cache, reporting whether
+	// it was cached.
+	CacheRemove(name string) bool
+
+	// CachePurge evicts all entries, returning how many there were.
+	CachePurge() int
+}
+
+// CacheStats implements Cache.
+func (ns *mpns) CacheStats() CacheStats {
+	stats := CacheStats{
+		Hits:   atomic.LoadUint64(&ns.cacheHits),
+		Misses: atomic.LoadUint64(&ns.cacheMisses),
+	}
+	if ns.cache != nil {
+		stats.Entries = ns.cache.Len()
+		stats.Capacity = ns.cacheSize
+	}
+	return stats
+}
+
+// CacheEntries implements Cache.
+func (ns *mpns) CacheEntries() []CacheEntry {
+	if ns.cache == nil {
+		return nil
+	}
+
+	now := time.Now()
+	var entries []CacheEntry
+	for _, k := range ns.cache.Keys() {
+		ientry, ok := ns.cache.Peek(k)
+		if !ok {
+			continue
+		}
+		entry, ok := ientry.(cacheEntry)
+		if !ok || !now.Before(entry.eol) {
+			continue
+		}
+		entries = append(entries, CacheEntry{
+			Name:  k.(string),
+			Value: entry.val,
+			EOL:   entry.eol,
+		})
+	}
+	return entries
+}
+
+// CacheRemove implements Cache.
+func (ns *mpns) CacheRemove(name string) bool {
+	if ns.cache == nil || !ns.cache.Contains(name) {
+		return false
+	}
+	ns.cache.Remove(name)
+	return true
+}
+
+// CachePurge implements Cache.
+func (ns *mpns) CachePurge() int {
+	if ns.cache == nil {
+		return 0
+	}
+	n := ns.cache.Len()
+	ns.cache.Purge()
+	return n
+}
+
 func (ns *mpns) cacheGet(name string) (path.Path, bool) {
 	if ns.cache == nil {
 		return "", false
@@ -13,6 +107,7 @@ func (ns *mpns) cacheGet(name string) (path.Path, bool) {
 
 	ientry, ok := ns.cache.Get(name)
 	if !ok {
+		atomic.AddUint64(&ns.cacheMisses, 1)
 		return "", false
 	}
 
@@ -23,10 +118,12 @@ func (ns *mpns) cacheGet(name string) (path.Path, bool) {
 	}
 
 	if time.Now().Before(entry.eol) {
+		atomic.AddUint64(&ns.cacheHits, 1)
 		return entry.val, true
 	}
 
 	ns.cache.Remove(name)
+	atomic.AddUint64(&ns.cacheMisses, 1)
 
 	return "", false
 }
@@ -26,10 +26,14 @@ import (
 // It can only publish to: (a) IPFS routing naming.
 //
 type mpns struct {
+	// accessed atomically, keep 64-bit aligned
+	cacheHits, cacheMisses uint64
+
 	dnsResolver, proquintResolver, ipnsResolver resolver
 	ipnsPublisher                               Publisher
 
-	cache *lru.Cache
+	cache     *lru.Cache
+	cacheSize int
 }
 
 // NewNameSystem will construct the IPFS naming system based on Routing
@@ -45,6 +49,7 @@ func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int) NameSys
 		ipnsResolver:     NewIpnsResolver(r),
 		ipnsPublisher:    NewIpnsPublisher(r, ds),
 		cache:            cache,
+		cacheSize:        cachesize,
 	}
 }
 
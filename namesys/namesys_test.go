@@ -163,3 +163,46 @@ func TestPublishWithTTL(t *testing.T) {
 		t.Fatalf("bad cache ttl: expected %s, got %s", eol, entry.eol)
 	}
 }
+
+func TestCacheStats(t *testing.T) {
+	dst := dssync.MutexWrap(ds.NewMapDatastore())
+	routing := offroute.NewOfflineRouter(dst, record.NamespacedValidator{
+		"pk": record.PublicKeyValidator{},
+	})
+
+	nsys := NewNameSystem(routing, dst, 128).(*mpns)
+	p, err := path.ParsePath(unixfs.EmptyDirNode().Cid().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := nsys.cacheGet("example.com"); ok {
+		t.Fatal("expected cache miss")
+	}
+	nsys.cacheSet("example.com", p, time.Minute)
+	if _, ok := nsys.cacheGet("example.com"); !ok {
+		t.Fatal("expected cache hit")
+	}
+
+	stats := nsys.CacheStats()
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("expected 1 hit and 1 miss, got %+v", stats)
+	}
+	if stats.Entries != 1 || stats.Capacity != 128 {
+		t.Fatalf("expected 1 of 128 entries, got %+v", stats)
+	}
+
+	nsys.cacheSet("stale.example.com", p, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	entries := nsys.CacheEntries()
+	if len(entries) != 1 || entries[0].Name != "example.com" || entries[0].Value != p {
+		t.Fatalf("unexpected cache entries: %+v", entries)
+	}
+
+	if !nsys.CacheRemove("example.com") || nsys.CacheRemove("example.com") {
+		t.Fatal("expected exactly one successful removal")
+	}
+	if n := nsys.CachePurge(); n != 1 {
+		t.Fatalf("expected the stale entry to be purged, got %d", n)
+	}
+}
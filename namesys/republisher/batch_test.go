@@ -0,0 +1,134 @@
+package republisher_test
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	. "github.com/ipfs/go-ipfs/namesys/republisher"
+	path "github.com/ipfs/go-path"
+
+	proto "github.com/gogo/protobuf/proto"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ipns "github.com/ipfs/go-ipns"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// countingPublisher records the number of concurrent publishes.
+type countingPublisher struct {
+	mu        sync.Mutex
+	active    int
+	maxActive int
+	published int
+}
+
+func (p *countingPublisher) Publish(ctx context.Context, k ci.PrivKey, value path.Path) error {
+	return p.PublishWithEOL(ctx, k, value, time.Now().Add(time.Hour))
+}
+
+func (p *countingPublisher) PublishWithEOL(ctx context.Context, k ci.PrivKey, value path.Path, eol time.Time) error {
+	p.mu.Lock()
+	p.active++
+	if p.active > p.maxActive {
+		p.maxActive = p.active
+	}
+	p.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	p.mu.Lock()
+	p.active--
+	p.published++
+	p.mu.Unlock()
+	return nil
+}
+
+func putRecord(t *testing.T, d ds.Datastore, k ci.PrivKey) {
+	id, err := peer.IDFromPrivateKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := ipns.Create(k, []byte("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"), 0, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := proto.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Put(namesys.IpnsDsKey(id), data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepublishNow(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	ks := keystore.NewMemKeystore()
+
+	self, _, err := ci.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		k, _, err := ci.GenerateEd25519Key(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.Put(fmt.Sprintf("key%d", i), k); err != nil {
+			t.Fatal(err)
+		}
+		// key0 has never been published
+		if i > 0 {
+			putRecord(t, d, k)
+		}
+	}
+
+	pub := &countingPublisher{}
+	repub := NewRepublisher(pub, d, self, ks)
+	repub.Concurrency = 2
+
+	statuses, err := repub.RepublishNow(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 6 {
+		t.Fatalf("expected the statuses of 6 keys, got %d", len(statuses))
+	}
+	republished := 0
+	for _, s := range statuses {
+		if s.Error != "" {
+			t.Fatalf("%s: %s", s.Name, s.Error)
+		}
+		if s.Republished {
+			republished++
+		}
+	}
+	if republished != 4 || pub.published != 4 {
+		t.Fatalf("expected 4 records to be republished, got %d", republished)
+	}
+	if pub.maxActive > 2 {
+		t.Fatalf("expected at most 2 republishes at once, got %d", pub.maxActive)
+	}
+	if len(repub.Statuses()) != 6 {
+		t.Fatal("expected the statuses to be kept")
+	}
+
+	statuses, err = repub.RepublishNow(context.Background(), "key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Name != "key1" || !statuses[0].Republished {
+		t.Fatal("expected only key1 to be republished")
+	}
+
+	if _, err := repub.RepublishNow(context.Background(), "nope"); err == nil {
+		t.Fatal("expected an unknown key to be rejected")
+	}
+}
@@ -3,10 +3,15 @@ package republisher
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
 	"time"
 
 	keystore "github.com/ipfs/go-ipfs/keystore"
 	namesys "github.com/ipfs/go-ipfs/namesys"
+	repo "github.com/ipfs/go-ipfs/repo"
 	path "github.com/ipfs/go-path"
 
 	proto "github.com/gogo/protobuf/proto"
@@ -21,6 +26,8 @@ import (
 
 var errNoEntry = errors.New("no previous entry")
 
+const selfName = "self"
+
 var log = logging.Logger("ipns-repub")
 
 // DefaultRebroadcastInterval is the default interval at which we rebroadcast IPNS records
@@ -35,6 +42,49 @@ var FailureRetryInterval = time.Minute * 5
 // DefaultRecordLifetime is the default lifetime for IPNS records
 const DefaultRecordLifetime = time.Hour * 24
 
+// DefaultConcurrency is the default number of records republished at once
+const DefaultConcurrency = 4
+
+// DefaultJitter is the default maximum delay of a republish within a cycle
+var DefaultJitter = time.Minute * 5
+
+// ConfigKey is the config key of the republisher settings.
+const ConfigKey = "Ipns.Republish"
+
+// Config is the configuration of the republisher.
+type Config struct {
+	// Concurrency is the number of records republished at once.
+	Concurrency int
+
+	// Jitter is the maximum random delay of each republish within a cycle,
+	// as a duration string, so that the republishes of many keys are
+	// spread out instead of all hitting the network at once.
+	Jitter string
+}
+
+// LoadConfig reads the republisher config of r.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+	err := repo.LoadConfigKey(r, ConfigKey, &cfg)
+	return cfg, err
+}
+
+// Status is the outcome of the last republish of a key.
+type Status struct {
+	Name string
+	Id   string
+	Time time.Time
+
+	// Republished is false if there is no record to republish for the key.
+	Republished bool
+	Error       string `json:",omitempty"`
+}
+
+type namedKey struct {
+	name string
+	priv ic.PrivKey
+}
+
 type Republisher struct {
 	ns   namesys.Publisher
 	ds   ds.Datastore
@@ -45,6 +95,17 @@ type Republisher struct {
 
 	// how long records that are republished should be valid for
 	RecordLifetime time.Duration
+
+	// how many records are republished at once
+	Concurrency int
+
+	// the maximum delay of a republish within a cycle, capped to a quarter
+	// of the interval
+	Jitter time.Duration
+
+	mu   sync.Mutex
+	last map[string]Status
+	next time.Time
 }
 
 // NewRepublisher creates a new Republisher
@@ -56,25 +117,34 @@ func NewRepublisher(ns namesys.Publisher, ds ds.Datastore, self ic.PrivKey, ks k
 		ks:             ks,
 		Interval:       DefaultRebroadcastInterval,
 		RecordLifetime: DefaultRecordLifetime,
+		Concurrency:    DefaultConcurrency,
+		Jitter:         DefaultJitter,
+		last:           make(map[string]Status),
 	}
 }
 
 func (rp *Republisher) Run(proc goprocess.Process) {
 	timer := time.NewTimer(InitialRebroadcastDelay)
 	defer timer.Stop()
+	delay := InitialRebroadcastDelay
 	if rp.Interval < InitialRebroadcastDelay {
-		timer.Reset(rp.Interval)
+		delay = rp.Interval
+		timer.Reset(delay)
 	}
+	rp.schedule(delay)
 
 	for {
 		select {
 		case <-timer.C:
-			timer.Reset(rp.Interval)
+			delay = rp.Interval
+			timer.Reset(delay)
+			rp.schedule(delay)
 			err := rp.republishEntries(proc)
 			if err != nil {
 				log.Info("republisher failed to republish: ", err)
 				if FailureRetryInterval < rp.Interval {
 					timer.Reset(FailureRetryInterval)
+					rp.schedule(FailureRetryInterval)
 				}
 			}
 		case <-proc.Closing():
@@ -83,6 +153,46 @@ func (rp *Republisher) Run(proc goprocess.Process) {
 	}
 }
 
+func (rp *Republisher) schedule(delay time.Duration) {
+	rp.mu.Lock()
+	rp.next = time.Now().Add(delay)
+	rp.mu.Unlock()
+}
+
+// Next returns when the next cycle starts.
+func (rp *Republisher) Next() time.Time {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return rp.next
+}
+
+// Statuses returns the outcome of the last republish of every key that was
+// republished since the start, sorted by name.
+func (rp *Republisher) Statuses() []Status {
+	rp.mu.Lock()
+	out := make([]Status, 0, len(rp.last))
+	for _, s := range rp.last {
+		out = append(out, s)
+	}
+	rp.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// RepublishNow republishes the records of the keys of names, or of every
+// key if none is given, without waiting for the next cycle. "self" names
+// the key of the node.
+func (rp *Republisher) RepublishNow(ctx context.Context, names ...string) ([]Status, error) {
+	keys, err := rp.keys(names)
+	if err != nil {
+		return nil, err
+	}
+	return rp.republish(ctx, keys, 0), nil
+}
+
 func (rp *Republisher) republishEntries(p goprocess.Process) error {
 	ctx, cancel := context.WithCancel(gpctx.OnClosingContext(p))
 	defer cancel()
@@ -91,52 +201,136 @@ func (rp *Republisher) republishEntries(p goprocess.Process) error {
 	// because:
 	// 1. There's no way to get keys from the keystore by ID.
 	// 2. We don't actually have access to the IPNS publisher.
-	err := rp.republishEntry(ctx, rp.self)
+	keys, err := rp.keys(nil)
 	if err != nil {
 		return err
 	}
 
-	if rp.ks != nil {
-		keyNames, err := rp.ks.List()
-		if err != nil {
-			return err
+	jitter := rp.Jitter
+	if jitter > rp.Interval/4 {
+		jitter = rp.Interval / 4
+	}
+	for _, s := range rp.republish(ctx, keys, jitter) {
+		if s.Error != "" {
+			return fmt.Errorf("%s: %s", s.Name, s.Error)
 		}
-		for _, name := range keyNames {
-			priv, err := rp.ks.Get(name)
-			if err != nil {
-				return err
-			}
-			err = rp.republishEntry(ctx, priv)
+	}
+	return nil
+}
+
+// keys returns the keys of names, or self followed by the keys of the
+// keystore if names is empty.
+func (rp *Republisher) keys(names []string) ([]namedKey, error) {
+	if len(names) == 0 {
+		names = []string{selfName}
+		if rp.ks != nil {
+			ksNames, err := rp.ks.List()
 			if err != nil {
-				return err
+				return nil, err
 			}
+			names = append(names, ksNames...)
+		}
+	}
 
+	keys := make([]namedKey, 0, len(names))
+	for _, name := range names {
+		if name == selfName {
+			keys = append(keys, namedKey{name, rp.self})
+			continue
+		}
+		if rp.ks == nil {
+			return nil, fmt.Errorf("no key named %s", name)
 		}
+		priv, err := rp.ks.Get(name)
+		if err == keystore.ErrNoSuchKey {
+			return nil, fmt.Errorf("no key named %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, namedKey{name, priv})
 	}
+	return keys, nil
+}
 
-	return nil
+// republish republishes the records of keys, at most rp.Concurrency at once,
+// each after a random delay of up to jitter.
+func (rp *Republisher) republish(ctx context.Context, keys []namedKey, jitter time.Duration) []Status {
+	concurrency := rp.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+
+	out := make([]Status, len(keys))
+	var wg sync.WaitGroup
+	for i, k := range keys {
+		wg.Add(1)
+		go func(i int, k namedKey) {
+			defer wg.Done()
+			out[i] = Status{Name: k.name}
+
+			if jitter > 0 {
+				t := time.NewTimer(time.Duration(rand.Int63n(int64(jitter))))
+				defer t.Stop()
+				select {
+				case <-t.C:
+				case <-ctx.Done():
+					out[i].Error = ctx.Err().Error()
+					return
+				}
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				out[i].Error = ctx.Err().Error()
+				return
+			}
+			defer func() { <-sem }()
+
+			out[i] = rp.republishEntry(ctx, k)
+		}(i, k)
+	}
+	wg.Wait()
+
+	rp.mu.Lock()
+	for _, s := range out {
+		if s.Id != "" {
+			rp.last[s.Id] = s
+		}
+	}
+	rp.mu.Unlock()
+	return out
 }
 
-func (rp *Republisher) republishEntry(ctx context.Context, priv ic.PrivKey) error {
-	id, err := peer.IDFromPrivateKey(priv)
+func (rp *Republisher) republishEntry(ctx context.Context, k namedKey) Status {
+	st := Status{Name: k.name, Time: time.Now()}
+	id, err := peer.IDFromPrivateKey(k.priv)
 	if err != nil {
-		return err
+		st.Error = err.Error()
+		return st
 	}
+	st.Id = id.Pretty()
 
 	log.Debugf("republishing ipns entry for %s", id)
 
 	// Look for it locally only
 	p, err := rp.getLastVal(id)
 	if err != nil {
-		if err == errNoEntry {
-			return nil
+		if err != errNoEntry {
+			st.Error = err.Error()
 		}
-		return err
+		return st
 	}
 
 	// update record with same sequence number
 	eol := time.Now().Add(rp.RecordLifetime)
-	return rp.ns.PublishWithEOL(ctx, priv, p, eol)
+	if err := rp.ns.PublishWithEOL(ctx, k.priv, p, eol); err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	st.Republished = true
+	return st
 }
 
 func (rp *Republisher) getLastVal(id peer.ID) (path.Path, error) {
@@ -0,0 +1,259 @@
+package namesys
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	ipns "github.com/ipfs/go-ipns"
+	pb "github.com/ipfs/go-ipns/pb"
+	path "github.com/ipfs/go-path"
+	opts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+	isd "github.com/jbenet/go-is-domain"
+	ic "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pstore "github.com/libp2p/go-libp2p-core/peerstore"
+	routing "github.com/libp2p/go-libp2p-core/routing"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	record "github.com/libp2p/go-libp2p-record"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// maxChainLength bounds the names followed by a ChainVerifier.
+const maxChainLength = 32
+
+// Where the public key of a record was found, as RecordReport.PublicKey.
+const (
+	KeyEmbedded  = "embedded"
+	KeyInlined   = "inlined"
+	KeyPeerstore = "peerstore"
+	KeyMissing   = "missing"
+)
+
+// RecordSource is a routing store queried for the IPNS records, as the DHT
+// or the pubsub store.
+type RecordSource struct {
+	Name  string
+	Store routing.ValueStore
+}
+
+// RecordReport describes an IPNS record and how it validated.
+type RecordReport struct {
+	Source string
+	// From is the peer that sent the record, when the source tells.
+	From string `json:",omitempty"`
+
+	Value    string
+	Sequence uint64
+	Validity time.Time
+	TTL      time.Duration
+
+	// PublicKey tells where the key checking the signature was found:
+	// KeyEmbedded in the record, KeyInlined in the peer ID, KeyPeerstore,
+	// or KeyMissing.
+	PublicKey string
+	Signature bool
+
+	// Error is why the record is rejected, if it is.
+	Error string `json:",omitempty"`
+	// Selected marks the record the name resolves to, the best of the
+	// valid ones.
+	Selected bool
+}
+
+// ChainStep is the resolution of a name of the chain.
+type ChainStep struct {
+	Name string
+	// Kind is "ipns" for a name resolved from its records, or "dns" and
+	// "proquint".
+	Kind  string
+	Value string `json:",omitempty"`
+
+	// Cached is the value in the resolution cache, if any.
+	Cached string `json:",omitempty"`
+
+	Records []RecordReport `json:",omitempty"`
+	// Split is set when valid records with the sequence number of the
+	// selected one hold other values, as when several nodes publish with
+	// the same key.
+	Split bool   `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+// ChainVerifier resolves names one step at a time, reporting the records of
+// each IPNS name found in each source.
+type ChainVerifier struct {
+	NameSystem NameSystem
+	Validator  record.Validator
+	KeyBook    pstore.KeyBook
+	Sources    []RecordSource
+
+	// Count is the number of records asked to the sources that return the
+	// records of several peers, as the DHT.
+	Count int
+}
+
+// Verify resolves name, an /ipns/ path, and returns the steps of the chain.
+// It stops at the first step failing, reported with its error.
+func (v *ChainVerifier) Verify(ctx context.Context, name string) []ChainStep {
+	var steps []ChainStep
+	for i := 0; i < maxChainLength && strings.HasPrefix(name, ipnsPrefix); i++ {
+		key := strings.SplitN(strings.TrimPrefix(name, ipnsPrefix), "/", 2)[0]
+		rest := strings.TrimPrefix(name, ipnsPrefix+key)
+
+		step := v.step(ctx, key)
+		steps = append(steps, step)
+		if step.Error != "" {
+			return steps
+		}
+		name = strings.TrimRight(step.Value, "/") + rest
+	}
+	if strings.HasPrefix(name, ipnsPrefix) {
+		steps = append(steps, ChainStep{Name: name, Error: ErrResolveRecursion.Error()})
+	}
+	return steps
+}
+
+// Candidates returns the records of name, an /ipns/ path, found in each
+// source, without following the value of the selected one. A name that is
+// not a key, as a DNSLink, is returned resolved by the name system, without
+// records.
+func (v *ChainVerifier) Candidates(ctx context.Context, name string) ChainStep {
+	key := strings.SplitN(strings.TrimPrefix(name, ipnsPrefix), "/", 2)[0]
+	return v.step(ctx, key)
+}
+
+func (v *ChainVerifier) step(ctx context.Context, key string) ChainStep {
+	step := ChainStep{Name: ipnsPrefix + key}
+	if cache, ok := v.NameSystem.(Cache); ok {
+		for _, e := range cache.CacheEntries() {
+			if e.Name == key {
+				step.Cached = e.Value.String()
+			}
+		}
+	}
+
+	if _, err := mh.FromB58String(key); err != nil {
+		// a DNSLink or a proquint, the name system resolves it
+		step.Kind = "proquint"
+		if isd.IsDomain(key) {
+			step.Kind = "dns"
+		}
+		p, err := v.NameSystem.Resolve(ctx, step.Name, opts.Depth(1))
+		if err != nil && err != ErrResolveRecursion {
+			step.Error = err.Error()
+			return step
+		}
+		step.Value = p.String()
+		return step
+	}
+
+	step.Kind = "ipns"
+	pid, err := peer.Decode(key)
+	if err != nil {
+		step.Error = err.Error()
+		return step
+	}
+	rkey := ipns.RecordKey(pid)
+
+	var values [][]byte
+	var selectable []int
+	for _, src := range v.Sources {
+		for _, r := range v.fetch(ctx, src, rkey) {
+			report := v.inspect(pid, rkey, r.Val)
+			report.Source = src.Name
+			if r.From != "" {
+				report.From = r.From.Pretty()
+			}
+			if report.Error == "" {
+				selectable = append(selectable, len(step.Records))
+				values = append(values, r.Val)
+			}
+			step.Records = append(step.Records, report)
+		}
+	}
+	if len(values) == 0 {
+		step.Error = "no valid record found"
+		return step
+	}
+	best, err := v.Validator.Select(rkey, values)
+	if err != nil {
+		step.Error = err.Error()
+		return step
+	}
+	selected := &step.Records[selectable[best]]
+	selected.Selected = true
+	step.Value = selected.Value
+	for _, i := range selectable {
+		r := step.Records[i]
+		if r.Sequence == selected.Sequence && r.Value != selected.Value {
+			step.Split = true
+		}
+	}
+	return step
+}
+
+// fetch returns the records of key held by src, with the peers that sent
+// them when src tells.
+func (v *ChainVerifier) fetch(ctx context.Context, src RecordSource, key string) []dht.RecvdVal {
+	if multi, ok := src.Store.(interface {
+		GetValues(ctx context.Context, key string, nvals int) ([]dht.RecvdVal, error)
+	}); ok && v.Count > 0 {
+		vals, err := multi.GetValues(ctx, key, v.Count)
+		if err != nil {
+			log.Debugf("verify chain: getting the records of %s from %s: %s", key, src.Name, err)
+		}
+		return vals
+	}
+	val, err := src.Store.GetValue(ctx, key)
+	if err != nil {
+		log.Debugf("verify chain: getting the record of %s from %s: %s", key, src.Name, err)
+		return nil
+	}
+	return []dht.RecvdVal{{Val: val}}
+}
+
+// inspect decodes the record value of key, and checks it.
+func (v *ChainVerifier) inspect(pid peer.ID, key string, value []byte) RecordReport {
+	var r RecordReport
+	entry := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(value, entry); err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Value = string(entry.GetValue())
+	if p, err := path.ParsePath(r.Value); err == nil {
+		r.Value = p.String()
+	}
+	r.Sequence = entry.GetSequence()
+	r.TTL = time.Duration(entry.GetTtl())
+	if eol, err := ipns.GetEOL(entry); err == nil {
+		r.Validity = eol
+	}
+
+	var pk ic.PubKey
+	if len(entry.PubKey) > 0 {
+		r.PublicKey = KeyEmbedded
+		pk, _ = ic.UnmarshalPublicKey(entry.PubKey)
+	} else if pk, _ = pid.ExtractPublicKey(); pk != nil {
+		r.PublicKey = KeyInlined
+	} else if pk = v.KeyBook.PubKey(pid); pk != nil {
+		r.PublicKey = KeyPeerstore
+	} else {
+		r.PublicKey = KeyMissing
+	}
+	if pk != nil {
+		switch ipns.Validate(pk, entry) {
+		case nil, ipns.ErrExpiredRecord:
+			// the signature is checked before the end of life
+			r.Signature = true
+		}
+	}
+
+	// the validator of the node decides, with the slack of its clock
+	if err := v.Validator.Validate(key, value); err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
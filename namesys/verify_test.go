@@ -0,0 +1,201 @@
+package namesys
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	offroute "github.com/ipfs/go-ipfs-routing/offline"
+	ipns "github.com/ipfs/go-ipns"
+	path "github.com/ipfs/go-path"
+	"github.com/ipfs/go-unixfs"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pstoremem "github.com/libp2p/go-libp2p-peerstore/pstoremem"
+	record "github.com/libp2p/go-libp2p-record"
+)
+
+func TestVerifyChain(t *testing.T) {
+	ctx := context.Background()
+	ps := pstoremem.NewPeerstore()
+	validator := record.NamespacedValidator{
+		"ipns": ipns.Validator{KeyBook: ps},
+		"pk":   record.PublicKeyValidator{},
+	}
+	dst := dssync.MutexWrap(ds.NewMapDatastore())
+	local := offroute.NewOfflineRouter(dst, validator)
+	other := offroute.NewOfflineRouter(dssync.MutexWrap(ds.NewMapDatastore()), validator)
+	nsys := NewNameSystem(local, dst, 128)
+
+	// the RSA key is embedded in its records, the ed25519 key inlined in
+	// its peer ID
+	rsa, _, err := ci.GenerateKeyPair(ci.RSA, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed, _, err := ci.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaID, err := peer.IDFromPrivateKey(rsa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edID, err := peer.IDFromPrivateKey(ed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := path.ParsePath(unixfs.EmptyDirNode().Cid().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nsys.Publish(ctx, ed, target); err != nil {
+		t.Fatal(err)
+	}
+	if err := nsys.Publish(ctx, rsa, path.FromString("/ipns/"+edID.Pretty())); err != nil {
+		t.Fatal(err)
+	}
+
+	// the other source holds a stale record of the ed25519 key
+	stale, err := ipns.Create(ed, []byte("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"), 0, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := proto.Marshal(stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.PutValue(ctx, ipns.RecordKey(edID), data); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &ChainVerifier{
+		NameSystem: nsys,
+		Validator:  validator,
+		KeyBook:    ps,
+		Sources:    []RecordSource{{Name: "local", Store: local}, {Name: "other", Store: other}},
+	}
+	steps := v.Verify(ctx, "/ipns/"+rsaID.Pretty())
+	if len(steps) != 2 {
+		t.Fatalf("expected 2 steps, got %+v", steps)
+	}
+
+	first := steps[0]
+	if first.Kind != "ipns" || first.Value != "/ipns/"+edID.Pretty() || first.Error != "" {
+		t.Fatalf("unexpected first step %+v", first)
+	}
+	if len(first.Records) != 1 || first.Records[0].PublicKey != KeyEmbedded || !first.Records[0].Signature || !first.Records[0].Selected {
+		t.Fatalf("unexpected records %+v", first.Records)
+	}
+
+	second := steps[1]
+	if second.Value != target.String() || second.Cached != target.String() {
+		t.Fatalf("unexpected second step %+v", second)
+	}
+	if len(second.Records) != 2 {
+		t.Fatalf("expected a record from each source, got %+v", second.Records)
+	}
+	fresh, old := second.Records[0], second.Records[1]
+	if fresh.Source != "local" || !fresh.Selected || fresh.PublicKey != KeyInlined {
+		t.Fatalf("expected the local record selected, got %+v", fresh)
+	}
+	if old.Source != "other" || old.Selected || old.Sequence != 0 || !old.Signature {
+		t.Fatalf("expected the stale record reported, got %+v", old)
+	}
+}
+
+func TestVerifyChainMissing(t *testing.T) {
+	ps := pstoremem.NewPeerstore()
+	validator := record.NamespacedValidator{"ipns": ipns.Validator{KeyBook: ps}}
+	dst := dssync.MutexWrap(ds.NewMapDatastore())
+	local := offroute.NewOfflineRouter(dst, validator)
+
+	_, pub, err := ci.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &ChainVerifier{
+		NameSystem: NewNameSystem(local, dst, 0),
+		Validator:  validator,
+		KeyBook:    ps,
+		Sources:    []RecordSource{{Name: "local", Store: local}},
+	}
+	steps := v.Verify(context.Background(), "/ipns/"+id.Pretty())
+	if len(steps) != 1 || steps[0].Error == "" {
+		t.Fatalf("expected a failed step, got %+v", steps)
+	}
+}
+
+func TestCandidatesSplit(t *testing.T) {
+	ctx := context.Background()
+	ps := pstoremem.NewPeerstore()
+	validator := record.NamespacedValidator{"ipns": ipns.Validator{KeyBook: ps}}
+	dst := dssync.MutexWrap(ds.NewMapDatastore())
+	a := offroute.NewOfflineRouter(dst, validator)
+	b := offroute.NewOfflineRouter(dssync.MutexWrap(ds.NewMapDatastore()), validator)
+
+	sk, _, err := ci.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two nodes publish the same sequence number with the key
+	values := map[string]string{
+		"a": "/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn",
+		"b": "/ipns/" + id.Pretty(),
+	}
+	sources := []RecordSource{{Name: "a", Store: a}, {Name: "b", Store: b}}
+	for _, src := range sources {
+		entry, err := ipns.Create(sk, []byte(values[src.Name]), 3, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := proto.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := src.Store.PutValue(ctx, ipns.RecordKey(id), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	v := &ChainVerifier{
+		NameSystem: NewNameSystem(a, dst, 0),
+		Validator:  validator,
+		KeyBook:    ps,
+		Sources:    sources,
+	}
+	step := v.Candidates(ctx, "/ipns/"+id.Pretty())
+	if step.Error != "" || len(step.Records) != 2 {
+		t.Fatalf("expected both candidates, got %+v", step)
+	}
+	if !step.Split {
+		t.Fatal("expected the records reported split")
+	}
+	selected := 0
+	for _, r := range step.Records {
+		if r.Sequence != 3 || r.Value != values[r.Source] {
+			t.Fatalf("unexpected candidate %+v", r)
+		}
+		if r.Selected {
+			selected++
+		}
+	}
+	if selected != 1 {
+		t.Fatalf("expected a single candidate selected, got %d", selected)
+	}
+}
@@ -0,0 +1,14 @@
+package plugin
+
+import (
+	"github.com/ipfs/go-ipfs/core/archive"
+)
+
+// PluginArchiver is an interface that can be implemented to add an archiver,
+// to which 'ipfs archive offload' hands the CAR files of pins
+type PluginArchiver interface {
+	Plugin
+
+	ArchiverName() string
+	Archiver() archive.Archiver
+}
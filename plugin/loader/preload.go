@@ -5,6 +5,7 @@ import (
 	pluginflatfs "github.com/ipfs/go-ipfs/plugin/plugins/flatfs"
 	pluginipldgit "github.com/ipfs/go-ipfs/plugin/plugins/git"
 	pluginlevelds "github.com/ipfs/go-ipfs/plugin/plugins/levelds"
+	plugins3ds "github.com/ipfs/go-ipfs/plugin/plugins/s3ds"
 )
 
 // DO NOT EDIT THIS FILE
@@ -16,4 +17,5 @@ func init() {
 	Preload(pluginbadgerds.Plugins...)
 	Preload(pluginflatfs.Plugins...)
 	Preload(pluginlevelds.Plugins...)
+	Preload(plugins3ds.Plugins...)
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/ipfs/go-ipfs/plugin"
 	"github.com/ipfs/go-ipfs/repo"
@@ -43,7 +44,13 @@ type datastoreConfig struct {
 	syncWrites bool
 	truncate   bool
 
-	vlogFileSize int64
+	vlogFileSize   int64
+	valueThreshold int
+	maxTableSize   int64
+	numMemtables   int
+
+	gcDiscardRatio float64
+	gcInterval     time.Duration
 }
 
 // BadgerdsDatastoreConfig returns a configuration stub for a badger datastore
@@ -96,10 +103,75 @@ func (*badgerdsPlugin) DatastoreConfigParser() fsrepo.ConfigFromMap {
 			}
 		}
 
+		// the tuning knobs below default to the ones of badger
+		defaults := badgerds.DefaultOptions
+		c.valueThreshold = defaults.ValueThreshold
+		c.maxTableSize = defaults.MaxTableSize
+		c.numMemtables = defaults.NumMemtables
+		c.gcDiscardRatio = defaults.GcDiscardRatio
+		c.gcInterval = defaults.GcInterval
+
+		if v, ok := params["valueThreshold"]; ok {
+			size, err := parseSize("valueThreshold", v)
+			if err != nil {
+				return nil, err
+			}
+			c.valueThreshold = int(size)
+		}
+		if v, ok := params["maxTableSize"]; ok {
+			size, err := parseSize("maxTableSize", v)
+			if err != nil {
+				return nil, err
+			}
+			c.maxTableSize = int64(size)
+		}
+		if v, ok := params["numMemtables"]; ok {
+			n, ok := v.(float64)
+			if !ok || n < 1 {
+				return nil, fmt.Errorf("'numMemtables' field was not a positive number")
+			}
+			c.numMemtables = int(n)
+		}
+		if v, ok := params["gcDiscardRatio"]; ok {
+			r, ok := v.(float64)
+			if !ok || r <= 0 || r >= 1 {
+				return nil, fmt.Errorf("'gcDiscardRatio' field was not a number between 0 and 1")
+			}
+			c.gcDiscardRatio = r
+		}
+		if v, ok := params["gcInterval"]; ok {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("'gcInterval' field was not a string")
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("'gcInterval' field is invalid: %s", err)
+			}
+			c.gcInterval = d
+		}
+		if _, ok := params["compression"]; ok {
+			// compression came with badger v2
+			return nil, fmt.Errorf("'compression' is not supported by the version of badger of this build")
+		}
+
 		return &c, nil
 	}
 }
 
+// parseSize parses the field name, a size string such as "1MB".
+func parseSize(name string, v interface{}) (uint64, error) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("'%s' field was not a string", name)
+	}
+	size, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' field is invalid: %s", name, err)
+	}
+	return size, nil
+}
+
 func (c *datastoreConfig) DiskSpec() fsrepo.DiskSpec {
 	return map[string]interface{}{
 		"type": "badgerds",
@@ -122,6 +194,11 @@ func (c *datastoreConfig) Create(path string) (repo.Datastore, error) {
 	defopts.SyncWrites = c.syncWrites
 	defopts.Truncate = c.truncate
 	defopts.ValueLogFileSize = c.vlogFileSize
+	defopts.ValueThreshold = c.valueThreshold
+	defopts.MaxTableSize = c.maxTableSize
+	defopts.NumMemtables = c.numMemtables
+	defopts.GcDiscardRatio = c.gcDiscardRatio
+	defopts.GcInterval = c.gcInterval
 
 	return badgerds.NewDatastore(p, &defopts)
 }
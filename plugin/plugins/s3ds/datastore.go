@@ -0,0 +1,241 @@
+package s3ds
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"sync/atomic"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	query "github.com/ipfs/go-datastore/query"
+)
+
+var (
+	// cacheKeysPrefix holds the sizes of the objects, by key.
+	cacheKeysPrefix = ds.NewKey("/keys")
+
+	// cacheFilledKey is set once the cache lists all the objects of the
+	// bucket.
+	cacheFilledKey = ds.NewKey("/filled")
+)
+
+// Datastore stores its values as the objects of an S3 bucket, under a root
+// directory. The keys and sizes of the objects are cached in a local
+// datastore, which answers Has, GetSize, Query with KeysOnly and DiskUsage
+// without a request to the bucket.
+type Datastore struct {
+	client *client
+	root   string
+
+	cache ds.Batching
+	keys  ds.Datastore
+
+	// size is the sum of the sizes of the objects.
+	size int64
+}
+
+var _ ds.Batching = (*Datastore)(nil)
+var _ ds.PersistentDatastore = (*Datastore)(nil)
+
+// newDatastore returns a datastore storing its values in the bucket of c,
+// under root, with the local cache. The cache is filled from the bucket when
+// it is new.
+func newDatastore(c *client, root string, cache ds.Batching) (*Datastore, error) {
+	d := &Datastore{
+		client: c,
+		root:   strings.Trim(root, "/"),
+		cache:  cache,
+		keys:   namespace.Wrap(cache, cacheKeysPrefix),
+	}
+
+	filled, err := cache.Has(cacheFilledKey)
+	if err != nil {
+		return nil, err
+	}
+	if !filled {
+		if err := d.fillCache(); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := d.keys.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		d.size += decodeSize(r.Value)
+	}
+	return d, nil
+}
+
+// fillCache lists the objects of the bucket into the cache.
+func (d *Datastore) fillCache() error {
+	prefix := ""
+	if d.root != "" {
+		prefix = d.root + "/"
+	}
+	err := d.client.list(context.Background(), prefix, func(o s3Object) error {
+		return d.keys.Put(ds.NewKey(strings.TrimPrefix(o.Key, prefix)), encodeSize(o.Size))
+	})
+	if err != nil {
+		return err
+	}
+	return d.cache.Put(cacheFilledKey, nil)
+}
+
+// objectKey returns the key of the object holding the value of k.
+func (d *Datastore) objectKey(k ds.Key) string {
+	key := strings.TrimPrefix(k.String(), "/")
+	if d.root == "" {
+		return key
+	}
+	return d.root + "/" + key
+}
+
+func (d *Datastore) Put(k ds.Key, value []byte) error {
+	old, err := d.GetSize(k)
+	switch err {
+	case nil:
+	case ds.ErrNotFound:
+		old = 0
+	default:
+		return err
+	}
+
+	if err := d.client.put(context.Background(), d.objectKey(k), value); err != nil {
+		return err
+	}
+	if err := d.keys.Put(k, encodeSize(int64(len(value)))); err != nil {
+		return err
+	}
+	atomic.AddInt64(&d.size, int64(len(value)-old))
+	return nil
+}
+
+func (d *Datastore) Get(k ds.Key) ([]byte, error) {
+	if has, err := d.keys.Has(k); err != nil || !has {
+		if err == nil {
+			err = ds.ErrNotFound
+		}
+		return nil, err
+	}
+
+	value, err := d.client.get(context.Background(), d.objectKey(k))
+	if err == errNoSuchKey {
+		// removed from the bucket by another client
+		d.forget(k)
+		return nil, ds.ErrNotFound
+	}
+	return value, err
+}
+
+func (d *Datastore) Has(k ds.Key) (bool, error) {
+	return d.keys.Has(k)
+}
+
+func (d *Datastore) GetSize(k ds.Key) (int, error) {
+	v, err := d.keys.Get(k)
+	if err != nil {
+		return -1, err
+	}
+	return int(decodeSize(v)), nil
+}
+
+func (d *Datastore) Delete(k ds.Key) error {
+	size, err := d.GetSize(k)
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = d.client.delete(context.Background(), d.objectKey(k))
+	if err != nil && err != errNoSuchKey {
+		return err
+	}
+	if err := d.keys.Delete(k); err != nil {
+		return err
+	}
+	atomic.AddInt64(&d.size, -int64(size))
+	return nil
+}
+
+// forget removes k from the cache.
+func (d *Datastore) forget(k ds.Key) {
+	if size, err := d.GetSize(k); err == nil {
+		if d.keys.Delete(k) == nil {
+			atomic.AddInt64(&d.size, -int64(size))
+		}
+	}
+}
+
+// Query answers from the cache, and fetches the values from the bucket
+// unless q is KeysOnly.
+func (d *Datastore) Query(q query.Query) (query.Results, error) {
+	res, err := d.keys.Query(query.Query{Prefix: q.Prefix, KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	next := res.Next()
+	inner := query.ResultsFromIterator(q, query.Iterator{
+		Next: func() (query.Result, bool) {
+			for {
+				r, ok := <-next
+				if !ok || r.Error != nil || q.KeysOnly {
+					return r, ok
+				}
+
+				value, err := d.Get(ds.RawKey(r.Key))
+				if err == ds.ErrNotFound {
+					// removed meanwhile
+					continue
+				}
+				if err != nil {
+					return query.Result{Error: err}, true
+				}
+				r.Value = value
+				return r, true
+			}
+		},
+		Close: res.Close,
+	})
+
+	// the prefix was applied by the cache
+	q.Prefix = ""
+	return query.NaiveQueryApply(q, inner), nil
+}
+
+func (d *Datastore) Batch() (ds.Batch, error) {
+	return ds.NewBasicBatch(d), nil
+}
+
+// DiskUsage returns the sum of the sizes of the objects.
+func (d *Datastore) DiskUsage() (uint64, error) {
+	return uint64(atomic.LoadInt64(&d.size)), nil
+}
+
+// Sync syncs the cache, the objects are durable once written.
+func (d *Datastore) Sync(prefix ds.Key) error {
+	return d.keys.Sync(prefix)
+}
+
+func (d *Datastore) Close() error {
+	return d.cache.Close()
+}
+
+func encodeSize(size int64) []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	return b[:binary.PutVarint(b, size)]
+}
+
+func decodeSize(b []byte) int64 {
+	size, _ := binary.Varint(b)
+	return size
+}
@@ -0,0 +1,142 @@
+package s3ds
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/go-ipfs/plugin"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+
+	levelds "github.com/ipfs/go-ds-leveldb"
+)
+
+// Plugins is exported list of plugins that will be loaded
+var Plugins = []plugin.Plugin{
+	&s3dsPlugin{},
+}
+
+type s3dsPlugin struct{}
+
+var _ plugin.PluginDatastore = (*s3dsPlugin)(nil)
+
+func (*s3dsPlugin) Name() string {
+	return "ds-s3"
+}
+
+func (*s3dsPlugin) Version() string {
+	return "0.1.0"
+}
+
+func (*s3dsPlugin) Init(_ *plugin.Environment) error {
+	return nil
+}
+
+func (*s3dsPlugin) DatastoreTypeName() string {
+	return "s3ds"
+}
+
+type datastoreConfig struct {
+	bucket         string
+	region         string
+	regionEndpoint string
+	rootDirectory  string
+	accessKey      string
+	secretKey      string
+	cachePath      string
+}
+
+// DatastoreConfigParser returns a configuration stub for an S3 datastore
+// from the given parameters
+func (*s3dsPlugin) DatastoreConfigParser() fsrepo.ConfigFromMap {
+	return func(params map[string]interface{}) (fsrepo.DatastoreConfig, error) {
+		var c datastoreConfig
+		var ok bool
+
+		c.bucket, ok = params["bucket"].(string)
+		if !ok || c.bucket == "" {
+			return nil, fmt.Errorf("'bucket' field is missing or not string")
+		}
+		c.region, ok = params["region"].(string)
+		if !ok || c.region == "" {
+			return nil, fmt.Errorf("'region' field is missing or not string")
+		}
+
+		for name, field := range map[string]*string{
+			"regionEndpoint": &c.regionEndpoint,
+			"rootDirectory":  &c.rootDirectory,
+			"accessKey":      &c.accessKey,
+			"secretKey":      &c.secretKey,
+			"cachePath":      &c.cachePath,
+		} {
+			v, ok := params[name]
+			if !ok {
+				continue
+			}
+			if *field, ok = v.(string); !ok {
+				return nil, fmt.Errorf("'%s' field was not a string", name)
+			}
+		}
+
+		if c.regionEndpoint == "" {
+			c.regionEndpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", c.region)
+		}
+		if c.cachePath == "" {
+			c.cachePath = "s3cache"
+		}
+		// keep the credentials out of the config file if need be
+		if c.accessKey == "" {
+			c.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		}
+		if c.secretKey == "" {
+			c.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		}
+
+		return &c, nil
+	}
+}
+
+func (c *datastoreConfig) DiskSpec() fsrepo.DiskSpec {
+	return map[string]interface{}{
+		"type":          "s3ds",
+		"bucket":        c.bucket,
+		"region":        c.region,
+		"rootDirectory": c.rootDirectory,
+	}
+}
+
+func (c *datastoreConfig) Create(path string) (repo.Datastore, error) {
+	endpoint, err := url.Parse(c.regionEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("'regionEndpoint' field is invalid: %s", err)
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return nil, fmt.Errorf("no credentials for the bucket %s: set 'accessKey' and 'secretKey', or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY", c.bucket)
+	}
+
+	p := c.cachePath
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(path, p)
+	}
+	cache, err := levelds.NewDatastore(p, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := newDatastore(&client{
+		endpoint:  endpoint,
+		bucket:    c.bucket,
+		region:    c.region,
+		accessKey: c.accessKey,
+		secretKey: c.secretKey,
+		http:      http.DefaultClient,
+	}, c.rootDirectory, cache)
+	if err != nil {
+		cache.Close()
+		return nil, err
+	}
+	return d, nil
+}
@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-ipfs/repo/common"
+)
+
+// LoadConfigKey decodes the value stored under key in the repo configuration
+// into out. It is meant for settings that are not (yet) part of the
+// go-ipfs-config structure and therefore can't be read through Config(). If
+// the key isn't set, out is left untouched so callers can pre-fill defaults.
+func LoadConfigKey(r Repo, key string, out interface{}) error {
+	v, err := r.GetConfigKey(key)
+	if err != nil {
+		if _, ok := err.(common.KeyNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, out)
+}
+
+// ConfigDuration parses s, the duration string of the setting key.field, or
+// returns def if s is empty. The duration must be positive.
+func ConfigDuration(key, field, s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s.%s: %s", key, field, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %s.%s: must be positive", key, field)
+	}
+	return d, nil
+}
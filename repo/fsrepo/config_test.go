@@ -10,6 +10,7 @@ import (
 	"github.com/ipfs/go-ipfs/plugin/loader"
 	"github.com/ipfs/go-ipfs/repo/fsrepo"
 
+	datastore "github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-ipfs-config"
 )
 
@@ -234,3 +235,39 @@ func TestMeasureConfig(t *testing.T) {
 		t.Errorf("expected '*measure.measure' got '%s'", typ)
 	}
 }
+
+func TestMountStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-datastore-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	if err := fsrepo.Init(dir, &config.Config{Datastore: config.DefaultDatastoreConfig()}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := fsrepo.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	value := make([]byte, 4096)
+	if err := r.Datastore().Put(datastore.NewKey("/blocks/CIQTEST"), value); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := r.MountStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 mounts, got %v", stats)
+	}
+	if m := stats[0]; m.Mountpoint != "/" || m.Type != "levelds" {
+		t.Errorf("expected the levelds mount at /, got %v", m)
+	}
+	if m := stats[1]; m.Mountpoint != "/blocks" || m.Type != "flatfs" || m.Size < uint64(len(value)) {
+		t.Errorf("expected the flatfs mount at /blocks holding the value, got %v", m)
+	}
+}
@@ -90,11 +90,34 @@ func AnyDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error)
 
 type mountDatastoreConfig struct {
 	mounts []premount
+
+	// created are the datastores of the mounts, once created.
+	created []mounted
 }
 
 type premount struct {
 	ds     DatastoreConfig
 	prefix ds.Key
+	typ    string
+}
+
+type mounted struct {
+	prefix ds.Key
+	typ    string
+	ds     repo.Datastore
+}
+
+// storeType returns the type of the datastore holding the values of the
+// datastore of params, looking through measure and log.
+func storeType(params map[string]interface{}) string {
+	typ, _ := params["type"].(string)
+	switch typ {
+	case "measure", "log":
+		if child, ok := params["child"].(map[string]interface{}); ok {
+			return storeType(child)
+		}
+	}
+	return typ
 }
 
 // MountDatastoreConfig returns a mount DatastoreConfig from a spec
@@ -123,6 +146,7 @@ func MountDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error
 		res.mounts = append(res.mounts, premount{
 			ds:     child,
 			prefix: ds.NewKey(prefix.(string)),
+			typ:    storeType(cfg),
 		})
 	}
 	sort.Slice(res.mounts,
@@ -150,6 +174,7 @@ func (c *mountDatastoreConfig) DiskSpec() DiskSpec {
 
 func (c *mountDatastoreConfig) Create(path string) (repo.Datastore, error) {
 	mounts := make([]mount.Mount, len(c.mounts))
+	c.created = nil
 	for i, m := range c.mounts {
 		ds, err := m.ds.Create(path)
 		if err != nil {
@@ -157,10 +182,30 @@ func (c *mountDatastoreConfig) Create(path string) (repo.Datastore, error) {
 		}
 		mounts[i].Datastore = ds
 		mounts[i].Prefix = m.prefix
+		c.created = append(c.created, mounted{prefix: m.prefix, typ: m.typ, ds: ds})
 	}
 	return mount.New(mounts), nil
 }
 
+func mountStats(mounts []mounted) ([]repo.MountStat, error) {
+	stats := make([]repo.MountStat, 0, len(mounts))
+	for _, m := range mounts {
+		size, err := ds.DiskUsage(m.ds)
+		if err != nil {
+			return nil, fmt.Errorf("measuring the mount %s: %s", m.prefix, err)
+		}
+		stats = append(stats, repo.MountStat{
+			Mountpoint: m.prefix.String(),
+			Type:       m.typ,
+			Size:       size,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Mountpoint < stats[j].Mountpoint
+	})
+	return stats, nil
+}
+
 type memDatastoreConfig struct {
 	cfg map[string]interface{}
 }
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,6 +17,7 @@ import (
 	repo "github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-ipfs/repo/common"
 	mfsr "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+	packstore "github.com/ipfs/go-ipfs/repo/packstore"
 	dir "github.com/ipfs/go-ipfs/thirdparty/dir"
 
 	ds "github.com/ipfs/go-datastore"
@@ -66,6 +68,19 @@ func (err NoRepoError) Error() string {
 const apiFile = "api"
 const swarmKeyFile = "swarm.key"
 
+// EnvSwarmKeyPassphrase is the environment variable holding the passphrase of
+// the swarm key stored encrypted in the keystore.
+const EnvSwarmKeyPassphrase = "IPFS_SWARM_KEY_PASSPHRASE"
+
+// EnvSwarmKeyFile is the environment variable holding the path of a swarm key
+// file, such as a secret mounted in a container.
+const EnvSwarmKeyFile = "IPFS_SWARM_KEY_FILE"
+
+// SwarmKeyPassphrase, if set, is called to get the passphrase of the swarm key
+// stored encrypted in the keystore, when EnvSwarmKeyPassphrase is not set.
+// The daemon sets it to prompt for the passphrase on the terminal.
+var SwarmKeyPassphrase func() ([]byte, error)
+
 const specFn = "datastore_spec"
 
 var (
@@ -101,8 +116,14 @@ type FSRepo struct {
 	lockfile io.Closer
 	config   *config.Config
 	ds       repo.Datastore
+	mounts   []mounted
 	keystore keystore.Keystore
 	filemgr  *filestore.FileManager
+
+	// swarmKey caches the swarm key once loaded, so that the passphrase of
+	// an encrypted key is only asked once.
+	swarmKeyLk sync.Mutex
+	swarmKey   []byte
 }
 
 var _ repo.Repo = (*FSRepo)(nil)
@@ -426,6 +447,9 @@ func (r *FSRepo) openDatastore() error {
 		return err
 	}
 	r.ds = d
+	if m, ok := dsc.(*mountDatastoreConfig); ok {
+		r.mounts = m.created
+	}
 
 	// Wrap it with metrics gathering
 	prefix := "ipfs.fsrepo.datastore"
@@ -533,7 +557,8 @@ func (r *FSRepo) setConfigUnsynced(updated *config.Config) error {
 	}
 	// to avoid clobbering user-provided keys, must read the config from disk
 	// as a map, write the updated struct values to the map and write the map
-	// to disk.
+	// to disk. Nested sections are merged too, so keys unknown to the config
+	// struct (see repo.LoadConfigKey) survive inside known sections.
 	var mapconf map[string]interface{}
 	if err := serialize.ReadConfigFile(configFilename, &mapconf); err != nil {
 		return err
@@ -542,9 +567,7 @@ func (r *FSRepo) setConfigUnsynced(updated *config.Config) error {
 	if err != nil {
 		return err
 	}
-	for k, v := range m {
-		mapconf[k] = v
-	}
+	mergeConfigMaps(mapconf, m, reflect.TypeOf(config.Config{}))
 	if err := serialize.WriteConfigFile(configFilename, mapconf); err != nil {
 		return err
 	}
@@ -677,12 +700,57 @@ func (r *FSRepo) Datastore() repo.Datastore {
 	return d
 }
 
-// GetStorageUsage computes the storage space taken by the repo in bytes
+// GetStorageUsage computes the storage space taken by the repo in bytes,
+// including the packs of blocks
 func (r *FSRepo) GetStorageUsage() (uint64, error) {
-	return ds.DiskUsage(r.Datastore())
+	usage, err := ds.DiskUsage(r.Datastore())
+	if err != nil {
+		return 0, err
+	}
+	packed, err := packstore.DiskUsage(filepath.Join(r.path, packstore.Dir))
+	if err != nil {
+		return 0, err
+	}
+	return usage + packed, nil
+}
+
+// MountStats returns the disk usage of each mount of the datastore, or nil
+// when the datastore isn't a mount.
+func (r *FSRepo) MountStats() ([]repo.MountStat, error) {
+	packageLock.Lock()
+	mounts := r.mounts
+	packageLock.Unlock()
+
+	if mounts == nil {
+		return nil, nil
+	}
+	return mountStats(mounts)
 }
 
+// SwarmKey returns the swarm key stored in the keystore if any, or the content
+// of the swarm.key file of the repo otherwise.
 func (r *FSRepo) SwarmKey() ([]byte, error) {
+	r.swarmKeyLk.Lock()
+	defer r.swarmKeyLk.Unlock()
+
+	if r.swarmKey != nil {
+		return r.swarmKey, nil
+	}
+
+	if ks, ok := r.keystore.(keystore.SwarmKeyStore); ok {
+		key, err := ks.SwarmKey(swarmKeyPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			if _, err := os.Stat(filepath.Join(r.path, swarmKeyFile)); err == nil {
+				log.Warningf("ignoring %s: the swarm key stored in the keystore is used instead", swarmKeyFile)
+			}
+			r.swarmKey = key
+			return key, nil
+		}
+	}
+
 	repoPath := filepath.Clean(r.path)
 	spath := filepath.Join(repoPath, swarmKeyFile)
 
@@ -698,6 +766,24 @@ func (r *FSRepo) SwarmKey() ([]byte, error) {
 	return ioutil.ReadAll(f)
 }
 
+// WriteSwarmKeyFile writes key to the swarm.key file of the repo at
+// repoPath, readable by the owner only.
+func WriteSwarmKeyFile(repoPath string, key []byte) error {
+	return ioutil.WriteFile(filepath.Join(repoPath, swarmKeyFile), key, 0600)
+}
+
+// swarmKeyPassphrase returns the passphrase of the swarm key, from the
+// environment or from SwarmKeyPassphrase.
+func swarmKeyPassphrase() ([]byte, error) {
+	if pass := os.Getenv(EnvSwarmKeyPassphrase); pass != "" {
+		return []byte(pass), nil
+	}
+	if SwarmKeyPassphrase == nil {
+		return nil, keystore.ErrPassphraseRequired
+	}
+	return SwarmKeyPassphrase()
+}
+
 var _ io.Closer = &FSRepo{}
 var _ repo.Repo = &FSRepo{}
 
@@ -2,6 +2,8 @@ package fsrepo
 
 import (
 	"os"
+	"reflect"
+	"strings"
 
 	config "github.com/ipfs/go-ipfs-config"
 	homedir "github.com/mitchellh/go-homedir"
@@ -21,3 +23,46 @@ func BestKnownPath() (string, error) {
 	}
 	return ipfsPath, nil
 }
+
+// mergeConfigMaps writes the values of src into dst. Sections that map onto a
+// struct in t are merged key by key, so settings the config struct doesn't
+// know about are preserved. Everything else, including map-typed fields such
+// as Gateway.HTTPHeaders, is replaced wholesale.
+func mergeConfigMaps(dst, src map[string]interface{}, t reflect.Type) {
+	for k, v := range src {
+		ft, ok := configFieldType(t, k)
+		sm, sok := v.(map[string]interface{})
+		dm, dok := dst[k].(map[string]interface{})
+		if ok && sok && dok && ft.Kind() == reflect.Struct {
+			mergeConfigMaps(dm, sm, ft)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// configFieldType returns the type of the field of struct t serialized under
+// the given JSON key.
+func configFieldType(t reflect.Type, key string) (reflect.Type, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		if name == key {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			return ft, true
+		}
+	}
+	return nil, false
+}
@@ -5,6 +5,7 @@ import (
 
 	filestore "github.com/ipfs/go-filestore"
 	keystore "github.com/ipfs/go-ipfs/keystore"
+	common "github.com/ipfs/go-ipfs/repo/common"
 
 	config "github.com/ipfs/go-ipfs-config"
 	ma "github.com/multiformats/go-multiaddr"
@@ -18,6 +19,9 @@ type Mock struct {
 	D Datastore
 	K keystore.Keystore
 	F *filestore.FileManager
+
+	// PSK is the private network key returned by SwarmKey, if any.
+	PSK []byte
 }
 
 func (m *Mock) Config() (*config.Config, error) {
@@ -38,13 +42,19 @@ func (m *Mock) SetConfigKey(key string, value interface{}) error {
 }
 
 func (m *Mock) GetConfigKey(key string) (interface{}, error) {
-	return nil, errTODO
+	cfg, err := config.ToMap(&m.C)
+	if err != nil {
+		return nil, err
+	}
+	return common.MapGetKV(cfg, key)
 }
 
 func (m *Mock) Datastore() Datastore { return m.D }
 
 func (m *Mock) GetStorageUsage() (uint64, error) { return 0, nil }
 
+func (m *Mock) MountStats() ([]MountStat, error) { return nil, nil }
+
 func (m *Mock) Close() error { return m.D.Close() }
 
 func (m *Mock) SetAPIAddr(addr ma.Multiaddr) error { return errTODO }
@@ -52,7 +62,7 @@ func (m *Mock) SetAPIAddr(addr ma.Multiaddr) error { return errTODO }
 func (m *Mock) Keystore() keystore.Keystore { return m.K }
 
 func (m *Mock) SwarmKey() ([]byte, error) {
-	return nil, nil
+	return m.PSK, nil
 }
 
 func (m *Mock) FileManager() *filestore.FileManager { return m.F }
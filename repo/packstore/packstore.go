@@ -0,0 +1,740 @@
+// Package packstore packs the small blocks of a blockstore into larger
+// append-only files, so that a flatfs repo needn't hold a file per block.
+//
+// The blocks are moved by Compact: they are appended to a pack file, indexed
+// in the datastore of the repo, then removed from the blockstore. The
+// blockstore returned by Wrap reads the packed blocks from their pack, and
+// removes them from the index only: the room of the removed blocks is
+// reclaimed by a later compaction, which rewrites the packs that hold mostly
+// removed blocks.
+//
+// A pack is a sequence of records, each the length of a CID, the CID, the
+// length of the block and the block, the lengths as uvarints.
+package packstore
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("packstore")
+
+// Dir is the directory of the packs in the repo.
+const Dir = "packs"
+
+const packExt = ".pack"
+
+var (
+	prefix      = ds.NewKey("/local/packs")
+	nextKey     = prefix.ChildString("next")
+	indexPrefix = prefix.ChildString("index")
+)
+
+// Defaults of the compaction.
+const (
+	DefaultMaxBlockSize = 4 << 10
+	DefaultPackSize     = 256 << 20
+)
+
+// flushBlocks bounds the number of blocks packed before they are indexed and
+// removed from the blockstore.
+const flushBlocks = 4096
+
+// location is where a block is stored in the packs.
+type location struct {
+	pack   uint64
+	offset int64
+	size   int
+}
+
+func (l location) bytes() []byte {
+	buf := make([]byte, 3*binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, l.pack)
+	n += binary.PutUvarint(buf[n:], uint64(l.offset))
+	n += binary.PutUvarint(buf[n:], uint64(l.size))
+	return buf[:n]
+}
+
+func parseLocation(b []byte) (location, error) {
+	var vals [3]uint64
+	for i := range vals {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return location{}, errors.New("invalid pack index entry")
+		}
+		vals[i] = v
+		b = b[n:]
+	}
+	return location{pack: vals[0], offset: int64(vals[1]), size: int(vals[2])}, nil
+}
+
+func indexKey(c cid.Cid) ds.Key {
+	return indexPrefix.Child(dshelp.CidToDsKey(c))
+}
+
+// Packs is the set of packs of a repo.
+type Packs struct {
+	d   ds.Batching
+	dir string
+
+	// the reads of the blocks hold mu for reading, the removal of a pack
+	// for writing
+	mu    sync.RWMutex
+	fmu   sync.Mutex
+	files map[uint64]*os.File
+
+	// compact serializes the compactions
+	compact sync.Mutex
+
+	loose bstore.Blockstore
+}
+
+// Open returns the packs stored in dir, indexed in d.
+func Open(d ds.Batching, dir string) (*Packs, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Packs{
+		d:     d,
+		dir:   dir,
+		files: make(map[uint64]*os.File),
+	}, nil
+}
+
+// Close closes the pack files.
+func (p *Packs) Close() error {
+	p.fmu.Lock()
+	defer p.fmu.Unlock()
+	for id, f := range p.files {
+		f.Close()
+		delete(p.files, id)
+	}
+	return nil
+}
+
+// DiskUsage returns the size of the packs stored in dir.
+func DiskUsage(dir string) (uint64, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var size uint64
+	for _, fi := range fis {
+		if strings.HasSuffix(fi.Name(), packExt) {
+			size += uint64(fi.Size())
+		}
+	}
+	return size, nil
+}
+
+func (p *Packs) path(id uint64) string {
+	return filepath.Join(p.dir, fmt.Sprintf("%08d%s", id, packExt))
+}
+
+func (p *Packs) file(id uint64) (*os.File, error) {
+	p.fmu.Lock()
+	defer p.fmu.Unlock()
+	if f, ok := p.files[id]; ok {
+		return f, nil
+	}
+	f, err := os.Open(p.path(id))
+	if err != nil {
+		return nil, err
+	}
+	p.files[id] = f
+	return f, nil
+}
+
+func (p *Packs) locate(c cid.Cid) (location, error) {
+	b, err := p.d.Get(indexKey(c))
+	if err == ds.ErrNotFound {
+		return location{}, bstore.ErrNotFound
+	}
+	if err != nil {
+		return location{}, err
+	}
+	return parseLocation(b)
+}
+
+func (p *Packs) read(c cid.Cid) ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	loc, err := p.locate(c)
+	if err != nil {
+		return nil, err
+	}
+	return p.readAt(loc)
+}
+
+func (p *Packs) readAt(loc location) ([]byte, error) {
+	f, err := p.file(loc.pack)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, loc.size)
+	if _, err := f.ReadAt(data, loc.offset); err != nil {
+		return nil, fmt.Errorf("failed to read pack %d: %s", loc.pack, err)
+	}
+	return data, nil
+}
+
+// Wrap returns bs, reading the blocks packed by Compact from the packs. The
+// blocks bs holds are those Compact packs. It is safe to call on nil Packs,
+// in which case bs is returned as is.
+func (p *Packs) Wrap(bs bstore.Blockstore) bstore.Blockstore {
+	if p == nil {
+		return bs
+	}
+	p.loose = bs
+	return &blockstore{Blockstore: bs, p: p}
+}
+
+type blockstore struct {
+	bstore.Blockstore
+	p *Packs
+}
+
+func (bs *blockstore) Get(c cid.Cid) (blocks.Block, error) {
+	blk, err := bs.Blockstore.Get(c)
+	if err != bstore.ErrNotFound {
+		return blk, err
+	}
+	data, err := bs.p.read(c)
+	if err != nil {
+		return nil, err
+	}
+	return blocks.NewBlockWithCid(data, c)
+}
+
+func (bs *blockstore) Has(c cid.Cid) (bool, error) {
+	has, err := bs.Blockstore.Has(c)
+	if err != nil || has {
+		return has, err
+	}
+	return bs.p.d.Has(indexKey(c))
+}
+
+func (bs *blockstore) GetSize(c cid.Cid) (int, error) {
+	size, err := bs.Blockstore.GetSize(c)
+	if err != bstore.ErrNotFound {
+		return size, err
+	}
+	loc, err := bs.p.locate(c)
+	if err != nil {
+		return -1, err
+	}
+	return loc.size, nil
+}
+
+func (bs *blockstore) Put(b blocks.Block) error {
+	packed, err := bs.p.d.Has(indexKey(b.Cid()))
+	if err != nil || packed {
+		return err
+	}
+	return bs.Blockstore.Put(b)
+}
+
+func (bs *blockstore) PutMany(blks []blocks.Block) error {
+	loose := make([]blocks.Block, 0, len(blks))
+	for _, b := range blks {
+		packed, err := bs.p.d.Has(indexKey(b.Cid()))
+		if err != nil {
+			return err
+		}
+		if !packed {
+			loose = append(loose, b)
+		}
+	}
+	return bs.Blockstore.PutMany(loose)
+}
+
+func (bs *blockstore) DeleteBlock(c cid.Cid) error {
+	looseErr := bs.Blockstore.DeleteBlock(c)
+	if looseErr != nil && looseErr != ds.ErrNotFound && looseErr != bstore.ErrNotFound {
+		return looseErr
+	}
+	removed := looseErr == nil
+
+	k := indexKey(c)
+	packed, err := bs.p.d.Has(k)
+	if err != nil {
+		return err
+	}
+	if packed {
+		if err := bs.p.d.Delete(k); err != nil {
+			return err
+		}
+		removed = true
+	}
+	if !removed {
+		return looseErr
+	}
+	return nil
+}
+
+func (bs *blockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	loose, err := bs.Blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := bs.p.d.Query(query.Query{Prefix: indexPrefix.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+		defer res.Close()
+
+		for c := range loose {
+			select {
+			case out <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for e := range res.Next() {
+			if e.Error != nil {
+				log.Errorf("failed to list the packed blocks: %s", e.Error)
+				return
+			}
+			c, err := dshelp.DsKeyToCid(ds.NewKey(ds.RawKey(e.Key).BaseNamespace()))
+			if err != nil {
+				log.Warningf("invalid pack index key %s: %s", e.Key, err)
+				continue
+			}
+			// a compaction interrupted between indexing a block and
+			// removing it leaves it in both
+			if has, err := bs.Blockstore.Has(c); err == nil && has {
+				continue
+			}
+			select {
+			case out <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// CompactOptions are the options of a compaction.
+type CompactOptions struct {
+	// MaxBlockSize is the size of the largest block packed.
+	MaxBlockSize int
+
+	// PackSize is the size past which a new pack is started.
+	PackSize int64
+}
+
+// CompactResult reports what a compaction did.
+type CompactResult struct {
+	// Packed and PackedBytes are the blocks moved into the packs.
+	Packed      uint64
+	PackedBytes uint64
+
+	// Rewritten is the number of packs rewritten, reclaiming the room of
+	// the blocks removed from them.
+	Rewritten int
+	Reclaimed uint64
+}
+
+// PackStat describes the packs.
+type PackStat struct {
+	Packs  int
+	Blocks uint64
+	Bytes  uint64
+
+	// Size is the size of the pack files, including the room of the blocks
+	// removed from them.
+	Size uint64
+}
+
+// Stat describes the packs and the blocks they hold.
+func (p *Packs) Stat(ctx context.Context) (PackStat, error) {
+	live, err := p.liveBytes(ctx)
+	if err != nil {
+		return PackStat{}, err
+	}
+	ids, err := p.packs()
+	if err != nil {
+		return PackStat{}, err
+	}
+
+	st := PackStat{Packs: len(ids)}
+	for _, l := range live {
+		st.Blocks += l.blocks
+		st.Bytes += l.bytes
+	}
+	st.Size, err = DiskUsage(p.dir)
+	return st, err
+}
+
+// packs returns the ids of the pack files.
+func (p *Packs) packs() ([]uint64, error) {
+	fis, err := ioutil.ReadDir(p.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for _, fi := range fis {
+		name := fi.Name()
+		if !strings.HasSuffix(name, packExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, packExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+type usage struct {
+	blocks uint64
+	bytes  uint64
+}
+
+// liveBytes returns the blocks indexed in every pack.
+func (p *Packs) liveBytes(ctx context.Context) (map[uint64]*usage, error) {
+	res, err := p.d.Query(query.Query{Prefix: indexPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	live := make(map[uint64]*usage)
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		loc, err := parseLocation(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		u, ok := live[loc.pack]
+		if !ok {
+			u = &usage{}
+			live[loc.pack] = u
+		}
+		u.blocks++
+		u.bytes += uint64(loc.size)
+	}
+	return live, nil
+}
+
+// Compact packs the blocks of the blockstore passed to Wrap no larger than
+// o.MaxBlockSize, and rewrites the packs holding less than half of live
+// blocks. The blocks stay readable throughout; a block removed while being
+// packed may be kept, until the next garbage collection removes it again.
+func (p *Packs) Compact(ctx context.Context, o CompactOptions) (CompactResult, error) {
+	p.compact.Lock()
+	defer p.compact.Unlock()
+
+	if p.loose == nil {
+		return CompactResult{}, errors.New("the packs aren't attached to a blockstore")
+	}
+	if o.MaxBlockSize <= 0 {
+		o.MaxBlockSize = DefaultMaxBlockSize
+	}
+	if o.PackSize <= 0 {
+		o.PackSize = DefaultPackSize
+	}
+
+	var res CompactResult
+	w := &writer{p: p, max: o.PackSize}
+	defer w.close()
+
+	// the packs to rewrite are chosen first, so that the pack written
+	// isn't one of them
+	live, err := p.liveBytes(ctx)
+	if err != nil {
+		return res, err
+	}
+	ids, err := p.packs()
+	if err != nil {
+		return res, err
+	}
+	sparse := make(map[uint64]bool)
+	for _, id := range ids {
+		fi, err := os.Stat(p.path(id))
+		if err != nil {
+			return res, err
+		}
+		var used uint64
+		if u, ok := live[id]; ok {
+			used = u.bytes
+		}
+		if used*2 < uint64(fi.Size()) || fi.Size() == 0 {
+			sparse[id] = true
+			res.Reclaimed += uint64(fi.Size()) - used
+		}
+	}
+
+	// pack the small loose blocks
+	keys, err := p.loose.AllKeysChan(ctx)
+	if err != nil {
+		return res, err
+	}
+	for k := range keys {
+		size, err := p.loose.GetSize(k)
+		if err == bstore.ErrNotFound || size > o.MaxBlockSize {
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		b, err := p.loose.Get(k)
+		if err == bstore.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		if err := w.add(k, b.RawData(), true); err != nil {
+			return res, err
+		}
+		res.Packed++
+		res.PackedBytes += uint64(len(b.RawData()))
+	}
+	if err := ctx.Err(); err != nil {
+		return res, err
+	}
+
+	// move the live blocks of the sparse packs to the pack written
+	if len(sparse) > 0 {
+		if err := p.rewrite(ctx, w, sparse); err != nil {
+			return res, err
+		}
+	}
+	if err := w.flush(); err != nil {
+		return res, err
+	}
+
+	for id := range sparse {
+		if err := p.remove(id); err != nil {
+			return res, err
+		}
+		res.Rewritten++
+	}
+	return res, nil
+}
+
+func (p *Packs) rewrite(ctx context.Context, w *writer, sparse map[uint64]bool) error {
+	res, err := p.d.Query(query.Query{Prefix: indexPrefix.String()})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	for e := range res.Next() {
+		if e.Error != nil {
+			return e.Error
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		loc, err := parseLocation(e.Value)
+		if err != nil {
+			return err
+		}
+		if !sparse[loc.pack] {
+			continue
+		}
+		c, err := dshelp.DsKeyToCid(ds.NewKey(ds.RawKey(e.Key).BaseNamespace()))
+		if err != nil {
+			return err
+		}
+		data, err := p.readAt(loc)
+		if err != nil {
+			return err
+		}
+		if err := w.add(c, data, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove removes the pack id, once no read is in progress.
+func (p *Packs) remove(id uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.fmu.Lock()
+	if f, ok := p.files[id]; ok {
+		f.Close()
+		delete(p.files, id)
+	}
+	p.fmu.Unlock()
+
+	return os.Remove(p.path(id))
+}
+
+// nextPack returns the id of a new pack.
+func (p *Packs) nextPack() (uint64, error) {
+	var id uint64
+	b, err := p.d.Get(nextKey)
+	switch err {
+	case nil:
+		id, err = strconv.ParseUint(string(b), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid next pack id: %s", err)
+		}
+	case ds.ErrNotFound:
+	default:
+		return 0, err
+	}
+	if err := p.d.Put(nextKey, []byte(strconv.FormatUint(id+1, 10))); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// pending is a block appended to the pack and not yet indexed.
+type pending struct {
+	c     cid.Cid
+	loc   location
+	loose bool
+}
+
+// writer appends the blocks to packs, starting a new one past max bytes.
+type writer struct {
+	p   *Packs
+	max int64
+
+	id      uint64
+	f       *os.File
+	buf     *bufio.Writer
+	off     int64
+	pending []pending
+}
+
+func (w *writer) add(c cid.Cid, data []byte, loose bool) error {
+	if w.f != nil && w.off >= w.max {
+		if err := w.flush(); err != nil {
+			return err
+		}
+		if err := w.close(); err != nil {
+			return err
+		}
+	}
+	if w.f == nil {
+		id, err := w.p.nextPack()
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(w.p.path(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		w.id, w.f, w.buf, w.off = id, f, bufio.NewWriter(f), 0
+	}
+
+	if err := w.write(c.Bytes()); err != nil {
+		return err
+	}
+	// the block starts after its length
+	var hdr [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(hdr[:], uint64(len(data)))
+	w.pending = append(w.pending, pending{
+		c:     c,
+		loc:   location{pack: w.id, offset: w.off + int64(n), size: len(data)},
+		loose: loose,
+	})
+	if err := w.write(data); err != nil {
+		return err
+	}
+
+	if len(w.pending) >= flushBlocks {
+		return w.flush()
+	}
+	return nil
+}
+
+// write appends the length of field, and field.
+func (w *writer) write(field []byte) error {
+	var hdr [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(hdr[:], uint64(len(field)))
+	if _, err := w.buf.Write(hdr[:n]); err != nil {
+		return err
+	}
+	if _, err := w.buf.Write(field); err != nil {
+		return err
+	}
+	w.off += int64(n + len(field))
+	return nil
+}
+
+// flush syncs the pack, indexes the blocks appended to it, and removes the
+// loose ones from the blockstore.
+func (w *writer) flush() error {
+	if w.f == nil || len(w.pending) == 0 {
+		return nil
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		return err
+	}
+
+	batch, err := w.p.d.Batch()
+	if err != nil {
+		return err
+	}
+	for _, e := range w.pending {
+		if err := batch.Put(indexKey(e.c), e.loc.bytes()); err != nil {
+			return err
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+
+	for _, e := range w.pending {
+		if !e.loose {
+			continue
+		}
+		if err := w.p.loose.DeleteBlock(e.c); err != nil && err != ds.ErrNotFound && err != bstore.ErrNotFound {
+			return err
+		}
+	}
+	w.pending = w.pending[:0]
+	return nil
+}
+
+func (w *writer) close() error {
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f, w.buf = nil, nil
+	return err
+}
@@ -0,0 +1,141 @@
+package packstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+func block(i, size int) blocks.Block {
+	data := bytes.Repeat([]byte{'x'}, size)
+	copy(data, fmt.Sprint(i))
+	return blocks.NewBlock(data)
+}
+
+func expectBlock(t *testing.T, bs bstore.Blockstore, b blocks.Block) {
+	t.Helper()
+	got, err := bs.Get(b.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.RawData(), b.RawData()) {
+		t.Fatalf("unexpected content for %s", b.Cid())
+	}
+	size, err := bs.GetSize(b.Cid())
+	if err != nil || size != len(b.RawData()) {
+		t.Fatalf("expected size %d, got %d, %v", len(b.RawData()), size, err)
+	}
+}
+
+func countKeys(t *testing.T, bs bstore.Blockstore) int {
+	t.Helper()
+	keys, err := bs.AllKeysChan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range keys {
+		n++
+	}
+	return n
+}
+
+func TestCompact(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "packstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	p, err := Open(d, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	loose := bstore.NewBlockstore(d)
+	bs := p.Wrap(loose)
+
+	var small []blocks.Block
+	for i := 0; i < 10; i++ {
+		small = append(small, block(i, 100))
+	}
+	big := block(10, 8<<10)
+	if err := bs.PutMany(append(small, big)); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := p.Compact(ctx, CompactOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Packed != 10 || res.PackedBytes != 1000 {
+		t.Fatalf("expected the 10 small blocks to be packed, got %+v", res)
+	}
+	for _, b := range small {
+		if has, _ := loose.Has(b.Cid()); has {
+			t.Fatalf("expected %s to be removed from the blockstore", b.Cid())
+		}
+		expectBlock(t, bs, b)
+	}
+	expectBlock(t, bs, big)
+	if n := countKeys(t, bs); n != 11 {
+		t.Fatalf("expected 11 blocks, got %d", n)
+	}
+
+	// writing a packed block again doesn't store it twice
+	if err := bs.Put(small[0]); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := loose.Has(small[0].Cid()); has {
+		t.Fatal("expected the packed block not to be stored again")
+	}
+
+	// removing most of the pack gets it rewritten
+	for _, b := range small[2:] {
+		if err := bs.DeleteBlock(b.Cid()); err != nil {
+			t.Fatal(err)
+		}
+		if has, _ := bs.Has(b.Cid()); has {
+			t.Fatalf("expected %s to be removed", b.Cid())
+		}
+	}
+	before, err := DiskUsage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = p.Compact(ctx, CompactOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Packed != 0 || res.Rewritten != 1 {
+		t.Fatalf("expected the pack to be rewritten, got %+v", res)
+	}
+	after, err := DiskUsage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after >= before {
+		t.Fatalf("expected the packs to shrink, from %d to %d bytes", before, after)
+	}
+	for _, b := range small[:2] {
+		expectBlock(t, bs, b)
+	}
+
+	st, err := p.Stat(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Packs != 1 || st.Blocks != 2 || st.Bytes != 200 || st.Size != after {
+		t.Fatalf("unexpected pack stats %+v", st)
+	}
+}
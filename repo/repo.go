@@ -41,6 +41,10 @@ type Repo interface {
 	// GetStorageUsage returns the number of bytes stored.
 	GetStorageUsage() (uint64, error)
 
+	// MountStats returns the number of bytes stored by each mount of the
+	// datastore, or nil when the datastore isn't a mount.
+	MountStats() ([]MountStat, error)
+
 	// Keystore returns a reference to the key management interface.
 	Keystore() keystore.Keystore
 
@@ -56,6 +60,13 @@ type Repo interface {
 	io.Closer
 }
 
+// MountStat is the number of bytes stored by a mount of the datastore.
+type MountStat struct {
+	Mountpoint string
+	Type       string
+	Size       uint64
+}
+
 // Datastore is the interface required from a datastore to be
 // acceptable to FSRepo.
 type Datastore interface {
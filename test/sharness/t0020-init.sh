@@ -195,6 +195,36 @@ test_expect_success "clean up ipfs dir" '
   rm -rf "$IPFS_PATH"
 '
 
+test_expect_success "'ipfs init --swarm-key-gen' generates a swarm key" '
+  ipfs init --bits=2048 --swarm-key-gen > init_out &&
+  grep "^generated swarm key [0-9a-f]\{32\}$" init_out &&
+  test_should_contain "/key/swarm/psk/1.0.0/" "$IPFS_PATH/swarm.key" &&
+  ipfs config Bootstrap > actual_config &&
+  test $(cat actual_config) = "[]" &&
+  test $(ipfs config Swarm.ForcePrivateNetwork) = true
+'
+
+test_expect_success "'ipfs init --swarm-key-file' installs the swarm key" '
+  FINGERPRINT=$(grep "^generated swarm key" init_out | cut -d" " -f4) &&
+  cp "$IPFS_PATH/swarm.key" gen.key &&
+  rm -rf "$IPFS_PATH" &&
+  ipfs init --bits=2048 --swarm-key-file=gen.key > init_out &&
+  grep "^installed swarm key $FINGERPRINT from gen.key$" init_out &&
+  test_cmp gen.key "$IPFS_PATH/swarm.key"
+'
+
+test_expect_success "'ipfs init' rejects an invalid swarm key file" '
+  rm -rf "$IPFS_PATH" &&
+  echo "not a key" > bad.key &&
+  test_must_fail ipfs init --bits=2048 --swarm-key-file=bad.key 2> init_err &&
+  grep "invalid swarm key in bad.key" init_err &&
+  test_must_fail test -e "$IPFS_PATH/config"
+'
+
+test_expect_success "clean up ipfs dir" '
+  rm -rf "$IPFS_PATH"
+'
+
 test_init_ipfs
 
 test_launch_ipfs_daemon
@@ -291,5 +291,56 @@ test_launch_ipfs_daemon
 test_config_cmd
 test_kill_ipfs_daemon
 
+test_expect_success "'ipfs config reload' requires a daemon" '
+  test_must_fail ipfs config reload
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs config reload' applies nothing without changes" '
+  ipfs config reload >reload_out &&
+  echo "no change to apply" >expected &&
+  test_cmp expected reload_out
+'
+
+test_expect_success "'ipfs config reload' applies the gateway headers" '
+  ipfs config --json Gateway.HTTPHeaders.X-Reload "[\"yes\"]" &&
+  ipfs config reload >reload_out &&
+  echo "applied Gateway.HTTPHeaders" >expected &&
+  test_cmp expected reload_out &&
+  curl -sv "http://127.0.0.1:$GWAY_PORT/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn" >/dev/null 2>curl_output &&
+  grep "< X-Reload: yes" curl_output
+'
+
+test_expect_success "'ipfs config reload' lists the keys requiring a restart" '
+  ipfs config --json Addresses.Swarm "[\"/ip4/127.0.0.1/tcp/0\"]" &&
+  ipfs config --json Logging.Levels "{\"reload\": \"debug\"}" &&
+  ipfs config reload >reload_out &&
+  grep "^applied Logging$" reload_out &&
+  grep "^restart required for Addresses.Swarm$" reload_out &&
+  ipfs config reload >reload_out &&
+  test_expect_code 1 grep "^applied" reload_out &&
+  grep "^restart required for Addresses.Swarm$" reload_out
+'
+
+test_expect_success "'ipfs config profile apply --live' applies the profile to the daemon" '
+  ipfs config --json Discovery.MDNS.Enabled true &&
+  ipfs bootstrap add --default &&
+  ipfs config reload &&
+  ipfs config profile apply --live pnet >profile_out &&
+  grep "^applied Bootstrap$" profile_out &&
+  grep "^applied Discovery.MDNS$" profile_out &&
+  grep "^restart required for Swarm.ForcePrivateNetwork$" profile_out &&
+  ipfs bootstrap list >bootstrap_out &&
+  test_must_be_empty bootstrap_out &&
+  test $(ipfs config Swarm.ForcePrivateNetwork) = true
+'
+
+test_expect_success "'ipfs config profile apply --live' rejects --dry-run" '
+  test_must_fail ipfs config profile apply --live --dry-run pnet
+'
+
+test_kill_ipfs_daemon
+
 
 test_done
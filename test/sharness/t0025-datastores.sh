@@ -13,4 +13,20 @@ test_expect_success "'ipfs pin ls' works" '
   ipfs pin ls | wc -l | grep 9
 '
 
+test_expect_success "'ipfs repo badger-gc' reclaims the removed objects" '
+  random 5000000 42 >large &&
+  HASH=$(ipfs add -q large) &&
+  ipfs pin rm "$HASH" &&
+  ipfs repo gc >/dev/null &&
+  ipfs repo badger-gc >badger_gc_out &&
+  grep "Reclaimed" badger_gc_out
+'
+
+test_expect_success "'ipfs repo badger-gc' fails without badger" '
+  export IPFS_PATH="$(pwd)/.ipfs-flatfs" &&
+  ipfs init --bits=2048 --profile=test >/dev/null &&
+  test_must_fail ipfs repo badger-gc 2>badger_gc_err &&
+  grep "isn.t stored in badger" badger_gc_err
+'
+
 test_done
@@ -817,6 +817,68 @@ test_expect_success "ipfs add --cid-version=9 fails" '
   grep -q "unknown CID version" add_out
 '
 
+test_expect_success "ipfs add --hash=sha3-256 succeeds and reads back" '
+  echo "sha3 content" > sha3file.txt &&
+  SHA3_HASH=$(ipfs add -q --hash=sha3-256 sha3file.txt) &&
+  ipfs cat "$SHA3_HASH" > sha3_out &&
+  test_cmp sha3file.txt sha3_out
+'
+
+test_expect_success "ipfs add --hash with an insecure hash function fails" '
+  test_must_fail ipfs add --hash=sha1 afile.txt 2>&1 | tee add_out &&
+  grep -q "can.t be used to add data" add_out
+'
+
+test_expect_success "ipfs add --hash with an unknown hash function lists the supported ones" '
+  test_must_fail ipfs add --hash=blake3 afile.txt 2>&1 | tee add_out &&
+  grep -q "unrecognized hash function: blake3 (supported: .*sha3-256" add_out
+'
+
+test_expect_success "ipfs add --patch-from reuses the unchanged blocks" '
+  random 1048576 42 > patch_v1 &&
+  { head -c 500000 patch_v1 && echo "inserted" && tail -c +500001 patch_v1; } > patch_v2 &&
+  PATCH_V1=$(ipfs add -q patch_v1) &&
+  ipfs add --patch-from="$PATCH_V1" patch_v2 2> patch_err > patch_out &&
+  grep "patched: " patch_err &&
+  PATCH_V2=$(cut -d" " -f2 patch_out) &&
+  ipfs cat "$PATCH_V2" > patch_v2_out &&
+  test_cmp patch_v2 patch_v2_out
+'
+
+test_expect_success "ipfs add --patch-from reports the reused data" '
+  ipfs add --enc=json --patch-from="$PATCH_V1" patch_v2 | grep "\"ReusedBytes\":786432"
+'
+
+test_expect_success "ipfs add --manifest adds a manifest of the tree" '
+  mkdir -p manifest_dir/sub &&
+  echo "first" > manifest_dir/a &&
+  echo "second" > manifest_dir/sub/b &&
+  ipfs add -r --manifest manifest_dir > manifest_out &&
+  MANIFEST_ROOT=$(grep "^added .* manifest_dir$" manifest_out | cut -d" " -f2) &&
+  MANIFEST=$(grep "^manifest " manifest_out | cut -d" " -f2) &&
+  test -n "$MANIFEST"
+'
+
+test_expect_success "ipfs verify-manifest verifies the tree" '
+  ipfs verify-manifest "$MANIFEST" > verify_out &&
+  echo "verified 2 files of $MANIFEST_ROOT" > verify_exp &&
+  test_cmp verify_exp verify_out
+'
+
+test_expect_success "ipfs verify-manifest verifies a copy added with other options" '
+  COPY=$(ipfs add -r -Q --raw-leaves manifest_dir) &&
+  ipfs verify-manifest "$MANIFEST" "$COPY"
+'
+
+test_expect_success "ipfs verify-manifest detects changes" '
+  echo "changed" > manifest_dir/sub/b &&
+  echo "extra" > manifest_dir/c &&
+  CHANGED=$(ipfs add -r -Q manifest_dir) &&
+  test_must_fail ipfs verify-manifest "$MANIFEST" "$CHANGED" 2> verify_err &&
+  grep "/sub/b: content differs" verify_err &&
+  grep "/c: not in the manifest" verify_err
+'
+
 test_kill_ipfs_daemon
 
 # should work offline
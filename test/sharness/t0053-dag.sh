@@ -268,6 +268,52 @@ test_dag_cmd() {
     test_cmp resolve_obj_exp resolve_obj &&
     test_cmp resolve_data_exp resolve_data
   '
+
+  test_expect_success "dag export succeeds" '
+    ipfs dag export $HASH > dag.car &&
+    test -s dag.car
+  '
+
+  test_expect_success "dag import pins the root" '
+    ipfs pin rm $HASH 2>/dev/null;
+    ipfs dag import dag.car > import_out &&
+    echo "pinned root $HASH" > import_exp &&
+    test_cmp import_exp import_out &&
+    ipfs pin ls --type=recursive | grep $HASH
+  '
+
+  test_expect_success "dag import --pin-roots=false doesn't pin" '
+    ipfs pin rm $HASH &&
+    ipfs dag import --pin-roots=false dag.car > import_out &&
+    echo "root $HASH" > import_exp &&
+    test_cmp import_exp import_out
+  '
+
+  test_expect_success "dag import of a truncated CAR file fails" '
+    head -c $(( $(wc -c < dag.car) - 1 )) dag.car > truncated.car &&
+    test_must_fail ipfs dag import truncated.car
+  '
+
+  test_expect_success "dag stat counts shared blocks once" '
+    SHARED=$(printf {\"a\":1} | ipfs dag put) &&
+    STATROOT=$(printf "{\"x\":{\"/\":\"$SHARED\"},\"y\":{\"/\":\"$SHARED\"}}" | ipfs dag put) &&
+    ipfs dag stat $STATROOT > stat_out &&
+    grep -q "^NumBlocks: 2$" stat_out &&
+    grep -q "^MaxDepth: 1$" stat_out &&
+    test_must_fail grep -q RawNumBlocks stat_out
+  '
+
+  test_expect_success "dag stat --raw counts shared blocks per link" '
+    ipfs dag stat --raw $STATROOT > stat_raw_out &&
+    grep -q "^NumBlocks: 2$" stat_raw_out &&
+    grep -q "^RawNumBlocks: 3$" stat_raw_out
+  '
+
+  test_expect_success "dag stat of a single block" '
+    ipfs dag stat $SHARED > stat_leaf_out &&
+    grep -q "^NumBlocks: 1$" stat_leaf_out &&
+    grep -q "^MaxDepth: 0$" stat_leaf_out
+  '
 }
 
 # should work offline
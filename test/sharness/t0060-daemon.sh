@@ -190,4 +190,35 @@ test_expect_success "daemon didnt throw any errors" '
 
 test_kill_ipfs_daemon
 
+test_launch_ipfs_daemon --ready-file="$(pwd)/ready"
+
+test_expect_success "daemon creates the ready file" '
+  test_wait_for_file 50 100ms "$(pwd)/ready" &&
+  grep "^$IPFS_PID$" ready
+'
+
+test_expect_success "/health answers the daemon is alive" '
+  curl -sf "http://$API_ADDR/health" >actual &&
+  grep "\"Status\":\"ok\"" actual
+'
+
+test_expect_success "/ready lists its checks" '
+  curl -sf "http://$API_ADDR/ready" >actual &&
+  grep "\"Ready\":true" actual &&
+  grep "\"Name\":\"repo\",\"OK\":true" actual &&
+  grep "\"Name\":\"swarm\",\"OK\":true" actual &&
+  grep "\"Name\":\"bootstrap\",\"OK\":true" actual
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "daemon removes the ready file when it stops" '
+  test ! -e ready
+'
+
+test_expect_success "daemon refuses a standard file descriptor for --ready-fd" '
+  test_must_fail ipfs daemon --ready-fd=1 2>daemon_err &&
+  grep "is not a file descriptor the supervisor passed" daemon_err
+'
+
 test_done
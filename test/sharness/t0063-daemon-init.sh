@@ -49,4 +49,43 @@ test_expect_success "create empty \$IPFS_PATH dir" '
 
 test_ipfs_daemon_init
 
+test_expect_success "remove \$IPFS_PATH dir" '
+  rm -rf "$IPFS_PATH"
+'
+
+test_expect_success "'ipfs daemon --init --swarm-key-from-env' succeeds" '
+  IPFS_SWARM_KEY=$(printf "%064d" 7) ipfs daemon --init --init-profile=pnet-cluster,test --swarm-key-from-env >actual_daemon 2>daemon_err &
+  IPFS_PID=$!
+  sleep 2 &&
+  if ! kill -0 $IPFS_PID; then cat daemon_err; return 1; fi
+'
+
+test_expect_success "the swarm key was installed" '
+  grep "Installed swarm key [0-9a-f]* from IPFS_SWARM_KEY" actual_daemon &&
+  grep "Swarm is limited to private network" actual_daemon
+'
+
+test_expect_success "'ipfs daemon' can be killed" '
+  test_kill_repeat_10_sec $IPFS_PID
+'
+
+test_expect_success "the pnet-cluster profile was applied" '
+  echo "[]" > bootstrap_exp &&
+  ipfs config Bootstrap > bootstrap_actual &&
+  test_cmp bootstrap_exp bootstrap_actual &&
+  test "$(ipfs config Routing.Type)" = dht &&
+  test "$(ipfs config Swarm.ForcePrivateNetwork)" = true
+'
+
+test_expect_success "'ipfs daemon --swarm-key-from-env' fails without a key" '
+  test_must_fail ipfs daemon --swarm-key-from-env 2>daemon_err &&
+  grep "neither IPFS_SWARM_KEY nor IPFS_SWARM_KEY_FILE is set" daemon_err
+'
+
+test_expect_success "'ipfs daemon --swarm-key-from-env' rejects an invalid key" '
+  echo "not a key" > bad.key &&
+  test_must_fail env IPFS_SWARM_KEY_FILE=bad.key ipfs daemon --swarm-key-from-env 2>daemon_err &&
+  grep "invalid swarm key in bad.key" daemon_err
+'
+
 test_done
@@ -47,6 +47,24 @@ test_expect_success "'ipfs pin rm' output looks good" '
   test_cmp expected1 actual1
 '
 
+test_expect_success "'ipfs repo gc --dry-run' lists the unpinned file" '
+  ipfs repo gc --dry-run >dry_out &&
+  grep "would remove $HASH" dry_out
+'
+
+test_expect_success "'ipfs repo gc --dry-run' doesnt remove the file" '
+  ipfs cat "$HASH" >out &&
+  test_cmp out afile
+'
+
+test_expect_success "'ipfs repo gc --dry-run --stats' reports the file by age" '
+  ipfs repo gc --dry-run --stats >stats_out &&
+  grep "^Would remove [1-9][0-9]* objects, " stats_out &&
+  grep "^AGE  *OBJECTS  *SIZE" stats_out &&
+  grep "^<1h  *[1-9]" stats_out &&
+  test_must_fail grep "$HASH" stats_out
+'
+
 test_expect_success "ipfs repo gc fully reverse ipfs add (part 1)" '
   ipfs repo gc &&
   random 100000 41 >gcfile &&
@@ -241,6 +259,11 @@ test_expect_success "repo stats came out correct" '
   grep "StorageMax" repo-stats
 '
 
+test_expect_success "repo stats report the mounts" '
+  grep "Mount /blocks (flatfs)" repo-stats &&
+  grep "Mount / (levelds)" repo-stats
+'
+
 test_expect_success "'ipfs repo stat --human' succeeds" '
   ipfs repo stat --human > repo-stats-human
 '
@@ -0,0 +1,61 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs repo compact"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add small and large files" '
+  for i in $(test_seq 1 20); do random 3000 $i >small$i || return 1; done &&
+  ipfs add -q small* >small_hashes &&
+  random 100000 41 >large &&
+  ipfs add -q --raw-leaves large >large_hash
+'
+
+test_expect_success "'ipfs repo stat' before compaction succeeds" '
+  ipfs repo stat >stat_before &&
+  grep "NumObjects" stat_before >objects_before
+'
+
+test_expect_success "'ipfs repo compact' packs the small objects" '
+  ipfs repo compact >compact_out &&
+  grep "Packed [1-9][0-9]* objects" compact_out &&
+  ls "$IPFS_PATH/packs"/*.pack
+'
+
+test_expect_success "the packed objects are still readable" '
+  for h in $(cat small_hashes); do ipfs cat $h >/dev/null || return 1; done &&
+  ipfs cat $(cat large_hash) >large_out &&
+  test_cmp large large_out
+'
+
+test_expect_success "the number of objects is unchanged" '
+  ipfs repo stat >stat_after &&
+  grep "NumObjects" stat_after >objects_after &&
+  test_cmp objects_before objects_after
+'
+
+test_expect_success "'ipfs repo stat --detailed' reports the packs and prefixes" '
+  ipfs repo stat --detailed >stat_detailed &&
+  grep "NumPacks:" stat_detailed &&
+  grep "PackedObjects:" stat_detailed &&
+  grep "cidv0 dag-pb sha2-256" stat_detailed &&
+  grep "cidv1 raw sha2-256" stat_detailed
+'
+
+test_expect_success "packed objects are collected" '
+  for h in $(cat small_hashes); do ipfs pin rm $h >/dev/null || return 1; done &&
+  ipfs repo gc >/dev/null &&
+  test_must_fail ipfs block stat --offline $(head -1 small_hashes)
+'
+
+test_expect_success "compaction rewrites the emptied pack" '
+  ipfs repo compact >compact_out &&
+  grep "Rewrote 1 packs" compact_out
+'
+
+test_done
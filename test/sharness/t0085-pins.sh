@@ -164,6 +164,86 @@ test_pin_progress() {
   '
 }
 
+test_pin_names() {
+  test_expect_success "'ipfs pin add --name --meta' succeeds" '
+    NAMED=$(echo "named pin" | ipfs add -q --pin=false) &&
+    OTHER=$(echo "other pin" | ipfs add -q --pin=false) &&
+    ipfs pin add --name=photos-2019 --meta=owner=alice,year=2019 $NAMED &&
+    ipfs pin add --name=music $OTHER
+  '
+
+  test_expect_success "'ipfs pin ls' lists the names" '
+    ipfs pin ls --type=recursive >actual &&
+    grep "$NAMED recursive photos-2019" actual &&
+    grep "$OTHER recursive music" actual
+  '
+
+  test_expect_success "'ipfs pin ls --name' filters by name" '
+    echo "$NAMED recursive photos-2019" >expected &&
+    ipfs pin ls --name="photos-*" >actual &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "'ipfs pin ls --enc=json' lists the metadata" '
+    ipfs pin ls --name="photos-*" --enc=json >actual &&
+    grep "\"owner\":\"alice\"" actual &&
+    grep "\"year\":\"2019\"" actual
+  '
+
+  test_expect_success "'ipfs pin add --meta' rejects invalid metadata" '
+    test_must_fail ipfs pin add --meta=owner $NAMED 2>err &&
+    grep "expected key=value" err
+  '
+
+  test_expect_success "'ipfs pin rm' removes the name" '
+    ipfs pin rm $NAMED &&
+    ipfs pin add $NAMED &&
+    ipfs pin ls --name="photos-*" >actual &&
+    test_must_be_empty actual
+  '
+
+  test_expect_success "clean up the named pins" '
+    ipfs pin rm $NAMED $OTHER
+  '
+}
+
+test_pin_depth() {
+  test_expect_success "'ipfs pin add --depth' succeeds" '
+    mkdir -p deep/a/b &&
+    echo "deep file" >deep/a/b/file &&
+    ROOT=$(ipfs add -r -Q --pin=false deep) &&
+    LEVEL1=$(ipfs resolve -r /ipfs/$ROOT/a | cut -d/ -f3) &&
+    LEVEL2=$(ipfs resolve -r /ipfs/$ROOT/a/b | cut -d/ -f3) &&
+    FILE=$(ipfs resolve -r /ipfs/$ROOT/a/b/file | cut -d/ -f3) &&
+    ipfs pin add --depth=1 $ROOT >actual &&
+    echo "pinned $ROOT to depth 1" >expected &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "'ipfs pin ls' lists the depth" '
+    ipfs pin ls --type=direct >actual &&
+    grep "^$ROOT direct depth=1$" actual &&
+    ipfs pin ls --type=direct --enc=json >actual &&
+    grep "\"Depth\":1" actual
+  '
+
+  test_expect_success "'ipfs repo gc' keeps the pinned levels only" '
+    ipfs repo gc &&
+    ipfs refs local >actual &&
+    grep $ROOT actual &&
+    grep $LEVEL1 actual &&
+    test_expect_code 1 grep $LEVEL2 actual &&
+    test_expect_code 1 grep $FILE actual
+  '
+
+  test_expect_success "'ipfs pin rm' removes the depth-limited pin" '
+    ipfs pin rm $ROOT &&
+    ipfs repo gc &&
+    ipfs refs local >actual &&
+    test_expect_code 1 grep $LEVEL1 actual
+  '
+}
+
 test_init_ipfs
 
 test_pins '' '' ''
@@ -180,6 +260,10 @@ test_pin_dag --raw-leaves
 
 test_pin_progress
 
+test_pin_names
+
+test_pin_depth
+
 test_launch_ipfs_daemon --offline
 
 test_pins '' '' ''
@@ -196,6 +280,10 @@ test_pin_dag --raw-leaves
 
 test_pin_progress
 
+test_pin_names
+
+test_pin_depth
+
 test_kill_ipfs_daemon
 
 test_done
@@ -0,0 +1,51 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the enforcement of Datastore.StorageMax"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "generate a 500 kB file and an 8 MB file" '
+  random 500k 41 >500k &&
+  random 8M 42 >8M
+'
+
+test_expect_success "enforce a 5 MB quota" '
+  test_config_set Datastore.StorageMax "5MB" &&
+  test_config_set --json Datastore.Quota.Enabled true &&
+  test_config_set Datastore.Quota.RefreshInterval "0s"
+'
+
+test_expect_success "adding below the quota succeeds" '
+  ipfs add -q 500k >small_hash
+'
+
+test_expect_success "adding past the quota fails" '
+  test_must_fail ipfs add -q 8M 2>add_err &&
+  grep "repo quota exceeded" add_err
+'
+
+test_expect_success "adding content already stored still succeeds" '
+  ipfs add -q 500k >small_hash2 &&
+  test_cmp small_hash small_hash2
+'
+
+test_expect_success "putting a block past the quota fails" '
+  test_must_fail ipfs block put 8M 2>put_err &&
+  grep "repo quota exceeded" put_err
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "adding past the quota fails through the API" '
+  test_must_fail ipfs add -q 8M 2>add_err &&
+  grep "repo quota exceeded" add_err
+'
+
+test_kill_ipfs_daemon
+
+test_done
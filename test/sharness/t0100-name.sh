@@ -84,6 +84,30 @@ test_expect_success "ipfs cat on published content succeeds" '
   test_cmp expected actual
 '
 
+test_expect_success "'ipfs name resolve --verify-chain' shows the record" '
+  ipfs name resolve --verify-chain "$PEERID" >chain_out &&
+  grep -q "^/ipns/$PEERID (ipns)" chain_out &&
+  grep -q "record: *routing, valid, selected" chain_out &&
+  grep -q "signature: *valid" chain_out &&
+  grep -q "value: */ipfs/$HASH_WELCOME_DOCS/help" chain_out
+'
+
+test_expect_success "'ipfs name resolve --verify-chain' fails with --stream" '
+  test_must_fail ipfs name resolve --verify-chain --stream "$PEERID"
+'
+
+test_expect_success "'ipfs name resolve --all-candidates' lists the record" '
+  ipfs name resolve --all-candidates "$PEERID" >candidates_out &&
+  grep -q "^/ipfs/$HASH_WELCOME_DOCS/help$" candidates_out &&
+  grep -q "^routing .*/ipfs/$HASH_WELCOME_DOCS/help  *selected$" candidates_out &&
+  ! grep -q "^split" candidates_out
+'
+
+test_expect_success "'ipfs name resolve --all-candidates' fails for a domain name" '
+  test_must_fail ipfs name resolve --all-candidates ipfs.io 2>candidates_err &&
+  grep -q "not an IPNS key" candidates_err
+'
+
 # publish with an explicit node ID
 
 test_expect_failure "'ipfs name publish --allow-offline <local-id> <hash>' succeeds" '
@@ -199,6 +223,25 @@ test_expect_success "empty request to name publish doesn't panic and returns err
     grep "argument \"ipfs-path\" is required" curl_out
 '
 
+test_expect_success "'ipfs name republish' shows the next cycle" '
+  ipfs name republish > republish_out &&
+  grep -q "^next cycle: " republish_out
+'
+
+test_expect_success "'ipfs name republish --now self' reports self" '
+  ipfs name republish --now self > republish_out &&
+  grep -q "^self  *${PEERID} " republish_out
+'
+
+test_expect_success "'ipfs name republish --now' fails with an unknown key" '
+  test_must_fail ipfs name republish --now nokey 2> republish_err &&
+  grep -q "no key named nokey" republish_err
+'
+
+test_expect_success "'ipfs name republish' fails with keys but no --now" '
+  test_must_fail ipfs name republish self
+'
+
 test_kill_ipfs_daemon
 
 
@@ -166,6 +166,13 @@ test_expect_success "refs IPFS directory file through readonly API succeeds" '
   test_curl_gateway_api "refs?arg=$HASH2/test"
 '
 
+test_expect_success "resolve through readonly API uses the default concurrency" '
+  test_curl_gateway_api "resolve?arg=/ipfs/$HASH2/test&arg=/ipfs/$HASH2" &&
+  grep "\"Name\":\"/ipfs/$HASH2/test\"" actual &&
+  curl -s "http://127.0.0.1:$port/api/v0/resolve?arg=/ipfs/$HASH2/test&arg=/ipfs/$HASH2&concurrency=64" >actual &&
+  grep "option --concurrency is not allowed on this API" actual
+'
+
 for cmd in add  \
            block/put \
            bootstrap \
@@ -220,6 +227,62 @@ test_expect_success "GET compact blocks succeeds" '
   test_cmp expected actual
 '
 
+test_expect_success "GET with ?format=car returns the DAG of the path" '
+  mkdir cardir && echo "a" >cardir/a && echo "b" >cardir/b &&
+  DIR_HASH=$(ipfs add -rQ cardir) &&
+  curl -sf -D car_headers -o gateway.car "http://127.0.0.1:$port/ipfs/$DIR_HASH?format=car" &&
+  ipfs dag export $DIR_HASH >expected.car &&
+  test_cmp expected.car gateway.car &&
+  grep "Content-Type: application/vnd.ipld.car; version=1" car_headers &&
+  grep "Etag: \"$DIR_HASH.car\"" car_headers
+'
+
+test_expect_success "GET with Accept: application/vnd.ipld.car returns the DAG of the path" '
+  curl -sf -H "Accept: application/vnd.ipld.car" -o accept.car "http://127.0.0.1:$port/ipfs/$DIR_HASH" &&
+  test_cmp expected.car accept.car
+'
+
+test_expect_success "GET with ?format=raw returns the block of the path" '
+  curl -sf -D raw_headers -o raw_block "http://127.0.0.1:$port/ipfs/$DIR_HASH?format=raw" &&
+  ipfs block get $DIR_HASH >expected_block &&
+  test_cmp expected_block raw_block &&
+  grep "Content-Type: application/vnd.ipld.raw" raw_headers
+'
+
+test_expect_success "GET a directory with Accept: application/json lists its entries" '
+  A_HASH=$(ipfs add -Q cardir/a) &&
+  curl -sf -H "Accept: application/json" -o listing.json "http://127.0.0.1:$port/ipfs/$DIR_HASH/" &&
+  grep "\"Cid\":\"$DIR_HASH\"" listing.json &&
+  grep "{\"Name\":\"a\",\"Cid\":\"$A_HASH\",\"Size\":2,\"Type\":\"file\"}" listing.json &&
+  grep "\"Total\":2,\"Page\":1,\"Pages\":1" listing.json
+'
+
+test_expect_success "GET a directory listing sorts and paginates its entries" '
+  curl -sf -o listing.json "http://127.0.0.1:$port/ipfs/$DIR_HASH/?format=json&order=desc&limit=1" &&
+  grep "\"Entries\":\[{\"Name\":\"b\"" listing.json &&
+  curl -sf -o listing.html "http://127.0.0.1:$port/ipfs/$DIR_HASH/?order=desc&limit=1&page=2" &&
+  grep ">a</a>" listing.html &&
+  grep "page 2 of 2" listing.html &&
+  test_curl_resp_http_code "http://127.0.0.1:$port/ipfs/$DIR_HASH/?sort=date" "HTTP/1.1 400 Bad Request"
+'
+
+test_expect_success "GET with a Range header returns the range of a file" '
+  random 1048576 42 >large &&
+  LARGE_HASH=$(ipfs add -Q --chunker=size-65536 large) &&
+  curl -s -o range_actual -w "%{http_code}\n" -H "Range: bytes=500000-500099" "http://127.0.0.1:$port/ipfs/$LARGE_HASH" >range_code &&
+  echo 206 >range_expected_code &&
+  test_cmp range_expected_code range_code &&
+  dd if=large of=range_expected bs=100 skip=5000 count=1 2>/dev/null &&
+  test_cmp range_expected range_actual
+'
+
+test_expect_success "GET with several ranges returns them as multipart/byteranges" '
+  curl -sf -D ranges_headers -o ranges_body -H "Range: bytes=0-9,900000-900009" "http://127.0.0.1:$port/ipfs/$LARGE_HASH" &&
+  grep "Content-Type: multipart/byteranges" ranges_headers &&
+  grep "Content-Range: bytes 0-9/1048576" ranges_body &&
+  grep "Content-Range: bytes 900000-900009/1048576" ranges_body
+'
+
 test_kill_ipfs_daemon
 
 
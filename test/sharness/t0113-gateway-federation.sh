@@ -0,0 +1,65 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test fetching blocks from upstream gateways"
+
+. lib/test-lib.sh
+
+test_expect_success "init iptb" '
+  iptb testbed create -type localipfs -count 2 -force -init
+'
+
+test_expect_success "disable discovery between the nodes" '
+  ipfsi 0 config --json Discovery.MDNS.Enabled false &&
+  ipfsi 1 config --json Discovery.MDNS.Enabled false
+'
+
+test_expect_success "node 1 uses the gateway of node 0 as upstream" '
+  GWAY_PORT=$(ipfsi 0 config Addresses.Gateway | sed "s|.*/tcp/||") &&
+  ipfsi 1 config --json Gateway.Federation "{\"Upstreams\": [\"http://127.0.0.1:$GWAY_PORT\"], \"NetworkTimeout\": \"1s\"}"
+'
+
+test_expect_success "start the nodes, unconnected" '
+  iptb start -wait
+'
+
+test_expect_success "add a file on node 0" '
+  random 100000 > filea &&
+  FILEA_HASH=$(ipfsi 0 add -q filea)
+'
+
+test_expect_success "the gateway serves raw blocks" '
+  curl -sf "http://127.0.0.1:$GWAY_PORT/ipfs/$FILEA_HASH?format=raw" >raw_block &&
+  ipfsi 0 block get $FILEA_HASH >expected_block &&
+  test_cmp expected_block raw_block
+'
+
+test_expect_success "node 1 fetches the file from its upstream" '
+  ipfsi 1 cat $FILEA_HASH >fetch_out &&
+  test_cmp filea fetch_out
+'
+
+test_expect_success "the blocks are cached on node 1" '
+  ipfsi 1 cat --offline $FILEA_HASH >fetch_out &&
+  test_cmp filea fetch_out
+'
+
+test_expect_success "'ipfs stats federation' counts the blocks fetched" '
+  ipfsi 1 stats federation >stats_out &&
+  grep "Upstream: http://127.0.0.1:$GWAY_PORT" stats_out &&
+  grep "Failed: 0 blocks" stats_out &&
+  ! grep "Fetched: 0 blocks" stats_out
+'
+
+test_expect_success "node 0 has no upstream" '
+  test_must_fail ipfsi 0 stats federation 2>stats_err &&
+  grep "no upstream gateways configured" stats_err
+'
+
+test_expect_success "stop the nodes" '
+  iptb stop
+'
+
+test_done
@@ -0,0 +1,70 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the templates of the gateway pages"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "write the templates" '
+  echo "<title>listing</title>{{range .Listing}}[{{.Name}}]{{end}}" >listing.html &&
+  echo "<title>error</title><p>{{.Status}}: {{.Message}}</p>" >error.html &&
+  CSS=$(echo "body { color: red; }" | ipfs add -Q)
+'
+
+test_expect_success "configure the templates" '
+  ipfs config --json Gateway.Templates "{
+    \"DirectoryListing\": \"$(pwd)/listing.html\",
+    \"Error\": \"$(pwd)/error.html\",
+    \"CSS\": \"/ipfs/$CSS\"
+  }"
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "the directory listing uses the template" '
+  mkdir dir &&
+  echo "a" >dir/a.txt &&
+  DIR=$(ipfs add -rQ dir) &&
+  curl -sf "http://$GWAY_ADDR/ipfs/$DIR/" >listing_out &&
+  grep "<title>listing</title>\[a.txt\]" listing_out
+'
+
+test_expect_success "the error pages use the template" '
+  curl -s -o error_out -w "%{http_code} %{content_type}\n" "http://$GWAY_ADDR/ipfs/$DIR/missing" >status_out &&
+  echo "404 text/html; charset=utf-8" >expected &&
+  test_cmp expected status_out &&
+  grep "<title>error</title><p>404: ipfs resolve -r " error_out
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "the default listing includes the stylesheet" '
+  ipfs config --json Gateway.Templates "{\"CSS\": \"/ipfs/$CSS\"}"
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "the stylesheet is in the default listing" '
+  curl -sf "http://$GWAY_ADDR/ipfs/$DIR/" >default_out &&
+  grep "body { color: red; }" default_out
+'
+
+test_expect_success "the error pages are plain text without a template" '
+  curl -s -o /dev/null -w "%{content_type}\n" "http://$GWAY_ADDR/ipfs/$DIR/missing" >status_out &&
+  echo "text/plain; charset=utf-8" >expected &&
+  test_cmp expected status_out
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "the daemon fails to start with a missing template" '
+  ipfs config --json Gateway.Templates "{\"Error\": \"$(pwd)/nonexistent.html\"}" &&
+  test_must_fail ipfs daemon 2>daemon_err &&
+  grep "Gateway.Templates.Error" daemon_err
+'
+
+test_done
@@ -0,0 +1,71 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the content types of the files served by the gateway"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add files without a known extension" '
+  mkdir files &&
+  echo "<svg xmlns=\"http://www.w3.org/2000/svg\"/>" >files/image &&
+  echo "# gemini" >files/page.gmi &&
+  echo "unknown" >files/blob &&
+  DIR=$(ipfs add -rQ files) &&
+  BLOB=$(ipfs add -Q files/blob)
+'
+
+test_expect_success "'ipfs content-type detect' sniffs the content" '
+  ipfs content-type detect /ipfs/$DIR/image >actual &&
+  echo "image/svg+xml" >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "override the content types" '
+  ipfs content-type set .gmi text/gemini &&
+  ipfs content-type set $BLOB application/x-custom &&
+  ipfs content-type ls >actual &&
+  printf ".gmi text/gemini\n%s application/x-custom\n" $(ipfs cid base32 $BLOB) >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "invalid overrides are rejected" '
+  test_must_fail ipfs content-type set gmi text/gemini &&
+  test_must_fail ipfs content-type set .gmi "not a type"
+'
+
+test_launch_ipfs_daemon
+
+content_type() {
+  curl -s -o /dev/null -w "%{content_type}\n" "http://$GWAY_ADDR/ipfs/$1"
+}
+
+test_expect_success "the gateway serves the sniffed content type" '
+  echo "image/svg+xml" >expected &&
+  content_type $DIR/image >actual &&
+  test_cmp expected actual
+'
+
+test_expect_success "the gateway serves the overrides" '
+  echo "text/gemini" >expected &&
+  content_type $DIR/page.gmi >actual &&
+  test_cmp expected actual &&
+  echo "application/x-custom" >expected &&
+  content_type $DIR/blob >actual &&
+  test_cmp expected actual
+'
+
+test_expect_success "a removed override no longer applies" '
+  ipfs content-type rm .gmi &&
+  content_type $DIR/page.gmi >actual &&
+  echo "text/plain; charset=utf-8" >expected &&
+  test_cmp expected actual &&
+  test_must_fail ipfs content-type rm .gmi
+'
+
+test_kill_ipfs_daemon
+
+test_done
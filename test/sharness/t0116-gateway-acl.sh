@@ -0,0 +1,68 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the access control of the gateway paths"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add the content" '
+  mkdir site &&
+  echo "public" >site/index.txt &&
+  echo "private" >site/private.txt &&
+  SITE=$(ipfs add -rQ site) &&
+  SECRET=$(echo "secret" | ipfs add -Q) &&
+  OTHER=$(echo "other" | ipfs add -Q)
+'
+
+test_expect_success "configure the ACL" '
+  ipfs config --json Gateway.ACL "{
+    \"Default\": \"deny\",
+    \"Rules\": [
+      {\"Action\": \"deny\", \"Path\": \"/ipfs/$SITE/private.txt\"},
+      {\"Action\": \"allow\", \"Cid\": \"$SITE\"},
+      {\"Action\": \"allow\", \"Cid\": \"$SECRET\", \"Tokens\": [\"t0ken\"]}
+    ]
+  }"
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "allowed paths are served" '
+  curl -sf "http://127.0.0.1:$GWAY_PORT/ipfs/$SITE/index.txt" >actual &&
+  echo "public" >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "denied paths are answered with 403" '
+  curl -s -o /dev/null -w "%{http_code}\n" "http://127.0.0.1:$GWAY_PORT/ipfs/$SITE/private.txt" >actual &&
+  curl -s -o /dev/null -w "%{http_code}\n" "http://127.0.0.1:$GWAY_PORT/ipfs/$OTHER" >>actual &&
+  printf "403\n403\n" >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "paths requiring a token are answered with 401 without it" '
+  curl -s -o /dev/null -D headers -w "%{http_code}\n" "http://127.0.0.1:$GWAY_PORT/ipfs/$SECRET" >actual &&
+  echo 401 >expected &&
+  test_cmp expected actual &&
+  grep -i "^WWW-Authenticate: Bearer" headers
+'
+
+test_expect_success "paths requiring a token are served with it" '
+  curl -sf -H "Authorization: Bearer t0ken" "http://127.0.0.1:$GWAY_PORT/ipfs/$SECRET" >actual &&
+  echo "secret" >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "the read-only API is not served on the gateway address" '
+  curl -s -o /dev/null -w "%{http_code}\n" "http://127.0.0.1:$GWAY_PORT/api/v0/cat?arg=$OTHER" >actual &&
+  echo 404 >expected &&
+  test_cmp expected actual
+'
+
+test_kill_ipfs_daemon
+
+test_done
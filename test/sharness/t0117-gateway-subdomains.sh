@@ -0,0 +1,56 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the subdomain gateways"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add the content" '
+  mkdir site &&
+  echo "hello" >site/index.txt &&
+  SITE=$(ipfs add -rQ site) &&
+  SITE_V1=$(ipfs cid base32 $SITE)
+'
+
+test_expect_success "configure the public gateways" '
+  ipfs config --json Gateway.PublicGateways "{
+    \"gw.example.com\": {\"UseSubdomains\": true},
+    \"paths.example.com\": {\"Paths\": [\"/ipfs\"], \"NoDNSLink\": true}
+  }"
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "the paths are redirected to the subdomains" '
+  curl -s -o /dev/null -D headers -w "%{http_code}\n" -H "Host: gw.example.com" "http://127.0.0.1:$GWAY_PORT/ipfs/$SITE/index.txt" >actual &&
+  echo 301 >expected &&
+  test_cmp expected actual &&
+  grep -i "^Location: http://$SITE_V1.ipfs.gw.example.com/index.txt" headers
+'
+
+test_expect_success "the subdomains serve their content" '
+  curl -sf -H "Host: $SITE_V1.ipfs.gw.example.com" "http://127.0.0.1:$GWAY_PORT/index.txt" >actual &&
+  echo "hello" >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "the gateways without subdomains serve their paths" '
+  curl -sf -H "Host: paths.example.com" "http://127.0.0.1:$GWAY_PORT/ipfs/$SITE/index.txt" >actual &&
+  echo "hello" >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "the other paths are not found" '
+  curl -s -o /dev/null -w "%{http_code}\n" -H "Host: paths.example.com" "http://127.0.0.1:$GWAY_PORT/ipns/example.com" >actual &&
+  curl -s -o /dev/null -w "%{http_code}\n" -H "Host: gw.example.com" "http://127.0.0.1:$GWAY_PORT/api/v0/id" >>actual &&
+  printf "404\n404\n" >expected &&
+  test_cmp expected actual
+'
+
+test_kill_ipfs_daemon
+
+test_done
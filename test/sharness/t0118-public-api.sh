@@ -0,0 +1,78 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the read-only public API"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add the content" '
+  mkdir dir &&
+  echo "public" >dir/file.txt &&
+  DIR=$(ipfs add -rQ --pin=false dir) &&
+  FILE=$(ipfs add -Q --pin=false dir/file.txt)
+'
+
+test_expect_success "configure the public API" '
+  ipfs config --json Addresses.PublicAPI "[\"/ip4/127.0.0.1/tcp/0\"]"
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "the public API listens" '
+  PUB_MADDR=$(sed -n "s/^Public API server listening on //p" actual_daemon) &&
+  PUB_PORT=$(port_from_maddr $PUB_MADDR) &&
+  PUB_URL="http://127.0.0.1:$PUB_PORT/api/v0"
+'
+
+test_expect_success "cat is served" '
+  curl -sf -X POST "$PUB_URL/cat?arg=$FILE" >actual &&
+  echo "public" >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "ls, dag get, resolve and version are served" '
+  curl -sf -X POST "$PUB_URL/ls?arg=$DIR" >actual &&
+  grep "file.txt" actual &&
+  curl -sf -X POST "$PUB_URL/dag/get?arg=$DIR" >actual &&
+  grep "file.txt" actual &&
+  curl -sf -X POST "$PUB_URL/resolve?arg=/ipfs/$DIR/file.txt" >actual &&
+  grep "$FILE" actual &&
+  curl -sf -X POST "$PUB_URL/version" >actual &&
+  grep "\"Version\"" actual
+'
+
+test_expect_success "the options with side effects are rejected" '
+  curl -s -X POST "$PUB_URL/cat?arg=$FILE&prefer-peer=/ip4/127.0.0.1/tcp/22/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN" >actual &&
+  grep "option --prefer-peer is not allowed on this API" actual &&
+  curl -s -X POST "$PUB_URL/resolve?arg=/ipns/$(ipfs id -f="<id>")&dht-timeout=0" >actual &&
+  grep "option --dht-timeout is not allowed on this API" actual &&
+  curl -s -X POST "$PUB_URL/resolve?arg=/ipfs/$DIR/file.txt&arg=/ipfs/$DIR&concurrency=64" >actual &&
+  grep "option --concurrency is not allowed on this API" actual
+'
+
+test_expect_success "the other commands can not be routed to" '
+  for cmd in add pin/add pin/rm files/write config config/show dag/put block/rm repo/gc shutdown name/publish key/gen id; do
+    curl -s -o /dev/null -w "%{http_code}\n" -X POST "$PUB_URL/$cmd?arg=$FILE"
+  done >actual &&
+  test $(wc -l <actual) -eq 13 &&
+  test_must_fail grep "^200$" actual
+'
+
+test_expect_success "the node was neither changed nor shut down" '
+  test_must_fail ipfs pin ls --type=recursive $FILE &&
+  ipfs id >/dev/null
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "the public API can not be served with Gateway.ACL" '
+  ipfs config --json Gateway.ACL "{\"Default\": \"deny\"}" &&
+  test_must_fail ipfs daemon 2>daemon_err &&
+  grep "Addresses.PublicAPI can.t be served with Gateway.ACL enabled" daemon_err
+'
+
+test_done
@@ -47,6 +47,31 @@ test_expect_success "cant trigger a dial backoff with swarm connect" '
   test_expect_code 1 grep "backoff" connect_out
 '
 
+test_expect_success "'ipfs swarm listen add' opens a listener" '
+  ipfs swarm addrs listen | grep -c "^/ip4/127.0.0.1/tcp/" >before &&
+  ipfs swarm listen add /ip4/127.0.0.1/tcp/0 >actual &&
+  echo /ip4/127.0.0.1/tcp/0 >expected &&
+  test_cmp expected actual &&
+  ipfs swarm addrs listen | grep -c "^/ip4/127.0.0.1/tcp/" >after &&
+  test $(cat after) -gt $(cat before)
+'
+
+test_expect_success "'ipfs swarm listen add' saves the address" '
+  ipfs config Addresses.Swarm >swarm_cfg &&
+  grep -q "\"/ip4/127.0.0.1/tcp/0\"" swarm_cfg
+'
+
+test_expect_success "'ipfs swarm listen rm' removes the address from the config" '
+  ipfs swarm listen rm /ip4/127.0.0.1/tcp/0 >actual &&
+  grep -q "^/ip4/127.0.0.1/tcp/0$" actual &&
+  ipfs config Addresses.Swarm >swarm_cfg &&
+  test_must_fail grep -q "\"/ip4/127.0.0.1/tcp/0\"" swarm_cfg
+'
+
+test_expect_success "'ipfs swarm listen add' rejects an invalid address" '
+  test_must_fail ipfs swarm listen add /ip4/not-an-ip/tcp/0
+'
+
 test_kill_ipfs_daemon
 
 announceCfg='["/ip4/127.0.0.1/tcp/4001", "/ip4/1.2.3.4/tcp/1234"]'
@@ -123,6 +148,107 @@ test_expect_success "/p2p addresses work" '
   [ $(ipfsi 0 swarm peers | wc -l) -eq 1 ]
 '
 
+test_expect_success "swarm connect dials the addresses in parallel, within the timeout" '
+  PEERID_1=$(iptb attr get 1 id) &&
+  UNREACHABLE=QmUWKoHbjsqsSMesRC2Zoscs8edyFz6F77auBB1YBBhgpX &&
+  ipfsi 0 swarm disconnect "/p2p/$PEERID_1" &&
+  START=$(date +%s) &&
+  ipfsi 0 swarm connect --timeout=2s "/ip4/10.255.255.1/tcp/4001/p2p/$UNREACHABLE" "/p2p/$PEERID_1" >actual &&
+  END=$(date +%s) &&
+  test $((END - START)) -lt 10 &&
+  grep "^connect $UNREACHABLE failure: " actual &&
+  grep "^connect $PEERID_1 success$" actual &&
+  [ $(ipfsi 0 swarm peers | wc -l) -eq 1 ]
+'
+
+test_expect_success "swarm connect reports the addresses it cannot parse or resolve" '
+  ipfsi 0 swarm disconnect "/p2p/$PEERID_1" &&
+  ipfsi 0 swarm connect --timeout=2s not-an-address /ip4/10.255.255.1/tcp/4001 "/p2p/$PEERID_1" >actual &&
+  grep "^connect not-an-address failure: " actual &&
+  grep "^connect /ip4/10.255.255.1/tcp/4001 failure: found no ipfs peers" actual &&
+  grep "^connect $PEERID_1 success$" actual
+'
+
+test_expect_success "swarm connect fails when no address is reachable" '
+  test_expect_code 1 ipfsi 0 swarm connect --timeout=1s "/ip4/10.255.255.1/tcp/4001/p2p/$UNREACHABLE" 2>connect_err &&
+  grep "connect $UNREACHABLE failure: " connect_err
+'
+
+test_expect_success "swarm addrs --peer lists the addresses of the peer" '
+  PEERID_1=$(iptb attr get 1 id) &&
+  ipfsi 0 swarm addrs --peer=$PEERID_1 >actual &&
+  grep "^$PEERID_1 (" actual &&
+  grep "/ip4/127.0.0.1/tcp/" actual &&
+  [ $(grep -c "^[^[:space:]]" actual) -eq 1 ]
+'
+
+test_expect_success "swarm addrs --peer fails for an unknown peer" '
+  test_must_fail ipfsi 0 swarm addrs --peer=QmUWKoHbjsqsSMesRC2Zoscs8edyFz6F77auBB1YBBhgpX
+'
+
+test_expect_success "swarm addrs --addr finds the peer at an address" '
+  ipfsi 0 swarm addrs --addr=/ip4/127.0.0.1 >actual &&
+  grep "^$PEERID_1 (" actual &&
+  ipfsi 0 swarm addrs --addr=/ip4/10.255.255.1 >actual &&
+  test_must_be_empty actual
+'
+
+test_expect_success "swarm addrs --verbose shows the source of the addresses" '
+  ipfsi 0 swarm addrs --peer=$PEERID_1 -v >actual &&
+  grep -E "/ip4/127.0.0.1/tcp/[0-9]+ +(observed|manual) +permanent" actual
+'
+
+test_expect_success "swarm events lists the disconnections and connections" '
+  ipfsi 0 swarm events >actual &&
+  grep " disconnected $PEERID_1 /ip4/127.0.0.1/tcp/" actual &&
+  grep " connected $PEERID_1 /ip4/127.0.0.1/tcp/" actual
+'
+
+test_expect_success "swarm addrs external lists the address observed by the peer" '
+  sleep 1 &&
+  ipfsi 0 swarm addrs external >actual &&
+  grep -E "^/ip4/127.0.0.1/tcp/[0-9]+.* +1 +[01] +low +/ip4/127.0.0.1/tcp/" actual
+'
+
+test_expect_success "swarm listeners counts the connections accepted" '
+  ipfsi 1 swarm listeners --enc=json >actual &&
+  grep "\"Addr\":\"/ip4/127.0.0.1/tcp/" actual &&
+  grep -E "\"Accepted\":[1-9]" actual &&
+  grep -E "\"Open\":1" actual &&
+  grep -E "\"BytesIn\":[1-9]" actual
+'
+
+test_expect_success "swarm listeners prints a table" '
+  ipfsi 1 swarm listeners >actual &&
+  head -1 actual | grep -E "^Address +Accepted +Open +Handshake Failures +Total In +Total Out"
+'
+
+test_expect_success "swarm scores fails while the scores are disabled" '
+  test_must_fail ipfsi 0 swarm scores 2>err &&
+  grep "peer scores disabled" err
+'
+
+test_expect_success "restart a node with the peer scores enabled" '
+  iptb stop 0 &&
+  ipfsi 0 config --json Swarm.PeerScore.Enabled true &&
+  iptb start -wait 0 &&
+  iptb connect 0 1
+'
+
+test_expect_success "swarm scores counts the blocks served by a peer" '
+  HASH=$(echo "scored block" | ipfsi 1 add -q) &&
+  ipfsi 0 cat $HASH >/dev/null &&
+  ipfsi 0 swarm scores --enc=json >actual &&
+  grep -E "\"Peer\":\"$PEERID_1\",\"Score\":[0-9]" actual &&
+  grep -E "\"BlocksServed\":(1|0\.99)" actual
+'
+
+test_expect_success "swarm scores prints a table" '
+  ipfsi 0 swarm scores --connected >actual &&
+  head -1 actual | grep -E "^PEER +SCORE +BLOCKS +DIAL FAILURES +MISBEHAVIOR +LATENCY +CONNECTED" &&
+  grep -E "^$PEERID_1 +[0-9.]+ +1\.0 +0\.0 +0\.0 .* true$" actual
+'
+
 test_expect_success "stopping cluster" '
   iptb stop
 '
@@ -99,6 +99,38 @@ test_swarm_filters() {
   test_swarm_filter_cmd
 
   test_config_swarm_addrfilters_cmd
+
+  test_expect_success "'ipfs swarm filter add --session-only' succeeds" '
+    ipfs swarm filters add --session-only $AF1
+  '
+
+  test_swarm_filter_cmd $AF1
+
+  test_config_swarm_addrfilters_cmd
+
+  test_expect_success "'ipfs swarm filter add --permanent' succeeds" '
+    ipfs swarm filters add --permanent $AF2
+  '
+
+  test_expect_success "'ipfs swarm filters -v' marks persisted filters" '
+    printf "$AF1\tsession\n$AF2\tpersisted\n" >verbose_expected &&
+    ipfs swarm filters -v >verbose_actual &&
+    test_sort_cmp verbose_expected verbose_actual
+  '
+
+  test_expect_success "'ipfs swarm filter rm --session-only' succeeds" '
+    ipfs swarm filters rm --session-only $AF2
+  '
+
+  test_swarm_filter_cmd $AF1
+
+  test_config_swarm_addrfilters_cmd $AF2
+
+  test_expect_success "'ipfs swarm filter add --permanent --session-only' fails" '
+    test_must_fail ipfs swarm filters add --permanent --session-only $AF3
+  '
+
+  ipfs swarm filters rm all
 }
 
 test_expect_success "init without any filters" '
@@ -0,0 +1,66 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the discovery of content on the local network"
+
+. lib/test-lib.sh
+
+test_expect_success "init iptb" '
+  iptb testbed create -type localipfs -count 2 -force -init
+'
+
+test_expect_success "enable LAN discovery" '
+  for i in 0 1; do
+    ipfsi $i config --json Discovery.LAN "{\"Enabled\": true, \"Interval\": \"1s\"}" || return 1
+  done
+'
+
+test_expect_success "add a file on node 0" '
+  random 100000 > filea &&
+  FILEA_HASH=$(ipfsi 0 add -q filea)
+'
+
+startup_cluster 2
+
+test_expect_success "node 1 receives the roots of node 0" '
+  PEERID_0=$(iptb attr get 0 id) &&
+  for i in $(test_seq 1 50); do
+    ipfsi 1 discovery lan stats >stats_out &&
+    grep "$PEERID_0" stats_out && break
+    go-sleep 100ms
+  done &&
+  grep "$PEERID_0" stats_out
+'
+
+test_expect_success "node 1 fetches the file from its neighbor" '
+  ipfsi 1 cat $FILEA_HASH >fetch_out &&
+  test_cmp filea fetch_out
+'
+
+test_expect_success "'ipfs discovery lan stats' reports the lookups" '
+  ipfsi 1 discovery lan stats >stats_out &&
+  grep "^Roots announced: " stats_out &&
+  grep "^Lookups: " stats_out
+'
+
+test_expect_success "stop the nodes" '
+  iptb stop
+'
+
+test_expect_success "init a node without LAN discovery" '
+  iptb testbed create -type localipfs -count 1 -force -init &&
+  iptb start -wait
+'
+
+test_expect_success "'ipfs discovery lan stats' fails when disabled" '
+  test_must_fail ipfsi 0 discovery lan stats 2>stats_err &&
+  grep "LAN discovery is disabled" stats_err
+'
+
+test_expect_success "stop the node" '
+  iptb stop
+'
+
+test_done
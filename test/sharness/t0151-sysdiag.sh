@@ -45,4 +45,66 @@ test_expect_success "output is similar to uname" '
   esac
 '
 
+test_expect_success "ipfs diag hashperf succeeds" '
+  ipfs diag hashperf --size 64KiB --runs 1 > hashperf_out
+'
+
+test_expect_success "hashperf output lists sha2-256 and a recommendation" '
+  grep "^sha2-256 " hashperf_out &&
+  grep "^Recommended: " hashperf_out &&
+  grep "HashOnRead is not set" hashperf_out
+'
+
+test_expect_success "hashperf reports verifications with HashOnRead" '
+  ipfs config --json Datastore.HashOnRead true &&
+  HASH=$(echo "verified" | ipfs add -q) &&
+  ipfs cat "$HASH" >/dev/null &&
+  ipfs diag hashperf --size 64KiB --runs 1 > hashperf_out &&
+  grep "^VERIFIED " hashperf_out &&
+  ipfs config --json Datastore.HashOnRead false
+'
+
+test_expect_success "ipfs diag events requires the daemon" '
+  test_must_fail ipfs diag events 2>events_err &&
+  grep "this command must be run in online mode" events_err
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "diag events streams the pins" '
+  { curl -sN --max-time 5 "http://$API_ADDR/debug/events?type=pin-added,pin-removed" >sse & } &&
+  { ipfs diag events --type=pin-added >events & } &&
+  EVENTS_PID=$! &&
+  sleep 1 &&
+  HASH=$(echo "event" | ipfs add -q --pin=false) &&
+  ipfs pin add "$HASH" &&
+  ipfs pin rm "$HASH" &&
+  sleep 1 &&
+  kill $EVENTS_PID &&
+  grep " pin-added $HASH recursive" events &&
+  test_must_fail grep "pin-removed" events
+'
+
+test_expect_success "/debug/events streams the pins as server-sent events" '
+  sleep 4 &&
+  grep "^event: pin-added" sse &&
+  grep "^event: pin-removed" sse &&
+  grep "^data: {.*\"Cid\":\"$HASH\"" sse
+'
+
+test_expect_success "diag events --recent prints the last events" '
+  { ipfs diag events --recent --type=pin-removed >recent & } &&
+  EVENTS_PID=$! &&
+  sleep 1 &&
+  kill $EVENTS_PID &&
+  grep " pin-removed $HASH recursive" recent
+'
+
+test_expect_success "diag events refuses unknown types" '
+  test_must_fail ipfs diag events --type=reboot 2>events_err &&
+  grep "unknown event type" events_err
+'
+
+test_kill_ipfs_daemon
+
 test_done
@@ -161,6 +161,18 @@ test_resolve_cmd_fail() {
 test_resolve_cmd
 test_resolve_cmd_b32
 
+test_expect_success "resolve rejects a concurrency below 1" '
+  test_must_fail ipfs resolve --concurrency=0 "/ipfs/$a_hash/b" "/ipfs/$b_hash/c" 2>concurrency_err &&
+  grep "concurrency must be greater than 0" concurrency_err
+'
+
+test_expect_success "resolve bounds a large concurrency" '
+  ipfs resolve --concurrency=1000000 "/ipfs/$a_hash/b" "/ipfs/$b_hash/c" >actual &&
+  printf "/ipfs/$a_hash/b: /ipfs/$b_hash\n/ipfs/$b_hash/c: /ipfs/$c_hash\n" | sort >expected &&
+  sort actual >actual_sorted &&
+  test_cmp expected actual_sorted
+'
+
 # should work online
 test_launch_ipfs_daemon
 test_resolve_cmd_fail
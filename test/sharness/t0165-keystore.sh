@@ -74,6 +74,18 @@ test_key_cmd() {
     test_must_fail ipfs key rename -f fooed self 2>&1 | tee key_rename_out &&
     grep -q "Error: cannot overwrite key with name" key_rename_out
   '
+
+  test_expect_success "key stats lists self and the keys" '
+    ipfs key stats > stats_out &&
+    grep -q "^NAME" stats_out &&
+    grep -q "^self " stats_out &&
+    grep "^fooed " stats_out | grep -q "Ed25519  *256" &&
+    grep "^key2 " stats_out | grep -q "RSA  *2048"
+  '
+
+  test_expect_success "key stats shows no last use for unused keys" '
+    grep "^key2 " stats_out | grep -q "  -  *-$"
+  '
 }
 
 test_key_cmd
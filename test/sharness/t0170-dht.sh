@@ -88,6 +88,17 @@ test_dht() {
     test_might_fail test_fsh cat actual
   '
 
+  test_expect_success 'stats dht reports the routing table' '
+    ipfsi 3 stats dht > dht_stats &&
+    grep "^Routing table: [1-9][0-9]* peers" dht_stats &&
+    grep "^CPL " dht_stats
+  '
+
+  test_expect_success 'stats dht reports the record store' '
+    grep "^Record store: [0-9]*/1000000 records" dht_stats &&
+    ipfsi 3 stats dht --enc=json | grep -q "\"MaxRecords\":1000000"
+  '
+
   test_expect_success 'stop iptb' '
     iptb stop
   '
@@ -98,7 +109,9 @@ test_dht() {
     test_must_fail ipfsi 0 dht put "/ipns/$PEERID_2" "get_result" 2>err_put &&
     test_should_contain "this command must be run in online mode" err_findprovs &&
     test_should_contain "this command must be run in online mode" err_findpeer &&
-    test_should_contain "this command must be run in online mode" err_put
+    test_should_contain "this command must be run in online mode" err_put &&
+    test_must_fail ipfsi 0 stats dht 2>err_stats &&
+    test_should_contain "this command must be run in online mode" err_stats
   '
 }
 
@@ -93,6 +93,18 @@ test_expect_success "nodes 3 and 4 have connected" '
   [ $(ipfsi 4 swarm peers | wc -l) -eq 1 ]
 '
 
+test_expect_success "swarm key verify fails in the public network" '
+  test_must_fail ipfsi 0 swarm key verify
+'
+
+test_expect_success "nodes in the same pnet have the same key fingerprint" '
+  ipfsi 1 swarm key verify | grep "fingerprint" > fp1 &&
+  ipfsi 2 swarm key verify | grep "fingerprint" > fp2 &&
+  ipfsi 3 swarm key verify | grep "fingerprint" > fp3 &&
+  test_cmp fp1 fp2 &&
+  test_must_fail test_cmp fp1 fp3
+'
+
 
 run_single_file_test() {
   node1=$1
@@ -134,4 +146,26 @@ test_expect_success "stop testbed" '
 
 test_kill_ipfs_daemon
 
+test_expect_success "set up a repo to import swarm keys" '
+  export IPFS_PATH="$(pwd)/.ipfs-import" &&
+  ipfs init --profile=test >/dev/null &&
+  pnet_key >import.key
+'
+
+test_expect_success "swarm key import reads IPFS_SWARM_KEY_FILE" '
+  IPFS_SWARM_KEY_FILE=import.key ipfs swarm key import >import_out &&
+  grep "imported swarm key" import_out
+'
+
+test_expect_success "swarm key import reads --swarm-key-stdin" '
+  ipfs swarm key rm &&
+  ipfs swarm key import --swarm-key-stdin <import.key >import_out &&
+  grep "imported swarm key" import_out
+'
+
+test_expect_success "swarm key import fails with an empty key" '
+  ipfs swarm key rm &&
+  test_must_fail ipfs swarm key import </dev/null
+'
+
 test_done
@@ -0,0 +1,81 @@
+#!/usr/bin/env bash
+
+test_description="Test channels over pubsub"
+
+. lib/test-lib.sh
+
+NUM_NODES=3
+test_expect_success 'init iptb' '
+  iptb testbed create -type localipfs -count $NUM_NODES -init
+'
+
+startup_cluster $NUM_NODES --enable-pubsub-experiment
+
+test_expect_success 'create a channel' '
+  CHANNEL=$(ipfsi 0 channel create releases) &&
+  test -n "$CHANNEL"
+'
+
+test_expect_success 'subscribe to the channel' '
+  ipfsi 1 channel subscribe --keep=1 $CHANNEL &&
+  ipfsi 2 channel subscribe $CHANNEL &&
+  printf "$CHANNEL\t1\n" > expected &&
+  ipfsi 1 channel ls > subs1 &&
+  test_cmp expected subs1
+'
+
+test_expect_success 'wait for the subscriptions to propagate' '
+  sleep 1
+'
+
+test_expect_success 'publish two revisions' '
+  V1=$(echo "version 1" | ipfsi 0 add -q) &&
+  V2=$(echo "version 2" | ipfsi 0 add -q) &&
+  ipfsi 0 channel publish releases $V1 > publish1 &&
+  grep "published revision 1 of $CHANNEL: $V1" publish1 &&
+  sleep 1 &&
+  ipfsi 0 channel publish releases $V2 > publish2 &&
+  grep "published revision 2 of $CHANNEL: $V2" publish2
+'
+
+# pinning is asynchronous
+wait_pinned() {
+  for i in $(seq 20); do
+    ipfsi "$1" pin ls --type=recursive "$2" >/dev/null 2>&1 && return 0
+    sleep 0.5
+  done
+  return 1
+}
+
+test_expect_success 'subscribers pin the latest revisions' '
+  wait_pinned 1 $V2 &&
+  wait_pinned 2 $V2 &&
+  wait_pinned 2 $V1
+'
+
+test_expect_success 'older revisions are unpinned' '
+  ipfsi 1 channel history $CHANNEL > history1 &&
+  grep "^2 .*$V2  *pinned" history1 &&
+  grep "^1 .*$V1 *$" history1 &&
+  test_must_fail ipfsi 1 pin ls --type=recursive $V1
+'
+
+test_expect_success 'unsubscribe unpins the revisions' '
+  ipfsi 2 channel unsubscribe $CHANNEL &&
+  test_must_fail ipfsi 2 pin ls --type=recursive $V2 &&
+  ipfsi 2 channel ls > subs2 &&
+  test_must_be_empty subs2
+'
+
+test_expect_success 'channel commands fail without pubsub' '
+  iptb stop 0 &&
+  iptb start -wait 0 &&
+  test_must_fail ipfsi 0 channel ls 2> err &&
+  grep "enable-pubsub-experiment" err
+'
+
+test_expect_success "shut down iptb" '
+  iptb stop
+'
+
+test_done
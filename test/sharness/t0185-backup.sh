@@ -0,0 +1,67 @@
+#!/usr/bin/env bash
+
+test_description="Test the backup target mode"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "backup commands fail when disabled" '
+  test_must_fail ipfs backup ls 2> err &&
+  grep "Backup.Enabled" err
+'
+
+test_expect_success "enable the backup target mode" '
+  ipfs config --json Backup.Enabled true &&
+  ipfs config --json Backup.Retention "{\"daily\": 1}"
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "upload chunks" '
+  echo "chunk a" > a &&
+  echo "chunk b" > b &&
+  A=$(ipfs backup put --client=laptop a) &&
+  B=$(ipfs backup put --client=laptop b) &&
+  ipfs pin ls --type=direct > pins &&
+  grep $A pins
+'
+
+test_expect_success "only missing chunks are listed" '
+  C=$(echo "chunk c" | ipfs add -q --raw-leaves --only-hash --cid-version=1) &&
+  ipfs backup missing $A $B $C > actual &&
+  echo $C > expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "commit a snapshot" '
+  ROOT1=$(ipfs object patch $(ipfs object new) add-link a $A) &&
+  ipfs backup commit --client=laptop --label=daily $ROOT1 > actual &&
+  echo "committed snapshot 1 of laptop: $ROOT1" > expected &&
+  test_cmp expected actual &&
+  ipfs pin ls --type=recursive > pins &&
+  grep $ROOT1 pins &&
+  ipfs pin ls --type=direct > pins &&
+  test_must_fail grep $A pins
+'
+
+test_expect_success "committing with a label removes the snapshots beyond its retention" '
+  ROOT2=$(ipfs object patch $ROOT1 add-link b $B) &&
+  ipfs backup commit --client=laptop --label=daily $ROOT2 > actual &&
+  grep "committed snapshot 2 of laptop: $ROOT2" actual &&
+  grep "removed snapshot 1 of laptop: $ROOT1" actual &&
+  ipfs backup ls --client=laptop > snaps &&
+  test_line_count = 1 snaps &&
+  grep $ROOT2 snaps
+'
+
+test_expect_success "remove a snapshot" '
+  ipfs backup rm --client=laptop 2 &&
+  ipfs backup ls > snaps &&
+  test_must_be_empty snaps &&
+  test_must_fail ipfs backup rm --client=laptop 2
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -0,0 +1,85 @@
+#!/usr/bin/env bash
+
+test_description="Test read replicas of a gateway"
+
+. lib/test-lib.sh
+
+GWPORT=32564
+
+test_expect_success 'init iptb' '
+  iptb testbed create -type localipfs -count 2 -init &&
+  PRIMARY=$(iptb attr get 0 id) &&
+  REPLICA=$(iptb attr get 1 id)
+'
+
+test_expect_success 'configure the replica and its primary' '
+  ipfsi 0 config --json Replica.Replicas "[\"$REPLICA\"]" &&
+  ipfsi 1 config Replica.Primary $PRIMARY &&
+  ipfsi 1 config Replica.Interval 1s &&
+  ipfsi 1 config Addresses.Gateway /ip4/127.0.0.1/tcp/$GWPORT
+'
+
+startup_cluster 2
+
+# replication is asynchronous
+wait_pinned() {
+  for i in $(seq 20); do
+    ipfsi 1 pin ls --type="$2" "$1" >/dev/null 2>&1 && return 0
+    sleep 0.5
+  done
+  return 1
+}
+
+test_expect_success 'the replica pins the content of the primary' '
+  HASH=$(echo "replicated" | ipfsi 0 add -q) &&
+  echo "in mfs" | ipfsi 0 files write --create /file &&
+  MFS=$(ipfsi 0 files stat --hash /) &&
+  wait_pinned $HASH recursive &&
+  wait_pinned $MFS recursive
+'
+
+test_expect_success 'the replica gateway serves the replicated content' '
+  curl -sf "http://127.0.0.1:$GWPORT/ipfs/$HASH" > served &&
+  echo "replicated" > expected &&
+  test_cmp expected served
+'
+
+test_expect_success 'the replica gateway answers 503 for other content' '
+  OTHER=$(echo "not replicated" | ipfsi 0 add -q --pin=false) &&
+  curl -s -o /dev/null -D headers -w "%{http_code}" "http://127.0.0.1:$GWPORT/ipfs/$OTHER" > code &&
+  echo 503 > expected &&
+  test_cmp expected code &&
+  grep -i "^Retry-After: 1" headers
+'
+
+test_expect_success 'ipfs replica status shows the sync lag' '
+  ipfsi 1 replica status > status1 &&
+  grep "primary: *$PRIMARY" status1 &&
+  grep "lag: " status1 &&
+  grep "pending: *0" status1 &&
+  ipfsi 0 replica status > status0 &&
+  grep "^$REPLICA " status0
+'
+
+test_expect_success 'the replica unpins what the primary no longer has' '
+  ipfsi 0 pin rm $HASH &&
+  for i in $(seq 20); do
+    ipfsi 1 pin ls --type=recursive $HASH >/dev/null 2>&1 || break
+    sleep 0.5
+  done &&
+  test_must_fail ipfsi 1 pin ls --type=recursive $HASH
+'
+
+test_expect_success 'ipfs replica status fails without replication' '
+  iptb stop 1 &&
+  ipfsi 1 config --json Replica {} &&
+  iptb start -wait 1 &&
+  test_must_fail ipfsi 1 replica status 2> err &&
+  grep "Replica.Primary" err
+'
+
+test_expect_success "shut down iptb" '
+  iptb stop
+'
+
+test_done
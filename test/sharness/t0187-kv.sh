@@ -0,0 +1,76 @@
+#!/usr/bin/env bash
+
+test_description="Test the key-value store shared over pubsub"
+
+. lib/test-lib.sh
+
+NUM_NODES=2
+test_expect_success 'init iptb' '
+  iptb testbed create -type localipfs -count $NUM_NODES -init
+'
+
+test_expect_success 'enable the key-value store' '
+  for i in $(test_seq 0 $((NUM_NODES - 1))); do
+    ipfsi $i config --json Experimental.KV.Enabled true || return 1
+  done
+'
+
+startup_cluster $NUM_NODES --enable-pubsub-experiment
+
+test_expect_success 'wait for the subscriptions to propagate' '
+  sleep 1
+'
+
+test_expect_success 'put a key on node 0' '
+  ipfsi 0 kv put service/api 10.0.0.3:8080 > put_out &&
+  test -n "$(cat put_out)" &&
+  echo "10.0.0.3:8080" > expected &&
+  ipfsi 0 kv get service/api > get_out &&
+  test_cmp expected get_out
+'
+
+test_expect_success 'node 1 receives the key' '
+  for i in $(test_seq 1 50); do
+    ipfsi 1 kv get service/api > get_out 2>/dev/null && break
+    go-sleep 100ms
+  done &&
+  test_cmp expected get_out
+'
+
+test_expect_success 'list the keys' '
+  ipfsi 1 kv put service/db 10.0.0.4:5432 &&
+  ipfsi 1 kv put other value &&
+  printf "service/api  10.0.0.3:8080  \nservice/db   10.0.0.4:5432  \n" > expected &&
+  ipfsi 1 kv ls service/ > ls_out &&
+  test_cmp expected ls_out
+'
+
+test_expect_success 'remove a key' '
+  ipfsi 1 kv rm service/db &&
+  test_must_fail ipfsi 1 kv get service/db 2> rm_err &&
+  grep "key not found" rm_err
+'
+
+test_expect_success 'node 0 receives the removal' '
+  for i in $(test_seq 1 50); do
+    test_must_fail ipfsi 0 kv get service/db 2>/dev/null && break
+    go-sleep 100ms
+  done &&
+  test_must_fail ipfsi 0 kv get service/db
+'
+
+test_expect_success 'stop the cluster' '
+  iptb stop
+'
+
+test_expect_success 'the store is disabled without pubsub' '
+  iptb start -wait 0 &&
+  test_must_fail ipfsi 0 kv get service/api 2> disabled_err &&
+  grep "key-value store is disabled" disabled_err
+'
+
+test_expect_success 'stop the node' '
+  iptb stop
+'
+
+test_done
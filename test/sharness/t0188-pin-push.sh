@@ -0,0 +1,72 @@
+#!/usr/bin/env bash
+
+test_description="Test pushing pins to another node"
+
+. lib/test-lib.sh
+
+pnet_key() {
+  echo '/key/swarm/psk/1.0.0/'
+  echo '/bin/'
+  random 32
+}
+
+test_expect_success 'init iptb' '
+  iptb testbed create -type localipfs -count 3 -init &&
+  pnet_key > swarm.key &&
+  for i in 0 1 2; do
+    cp swarm.key "${IPTB_ROOT}/testbeds/default/$i/swarm.key"
+  done &&
+  PUSHER=$(iptb attr get 0 id) &&
+  RECEIVER=$(iptb attr get 1 id)
+'
+
+test_expect_success 'allow node 0 to push pins to node 1' '
+  ipfsi 1 config --json Pin.Push.AllowFrom "[\"$PUSHER\"]"
+'
+
+startup_cluster 3
+
+test_expect_success 'ipfs pin push pins the DAG on the peer' '
+  mkdir -p pushed/sub &&
+  echo "first" > pushed/a &&
+  echo "second" > pushed/sub/b &&
+  HASH=$(ipfsi 0 add -rQ pushed) &&
+  ipfsi 0 pin push $HASH $RECEIVER > actual &&
+  grep "^pushed $HASH to $RECEIVER: 4 blocks (.*), pinned$" actual &&
+  ipfsi 1 pin ls --type=recursive $HASH
+'
+
+test_expect_success 'the peer stored the blocks of the DAG' '
+  ipfsi 1 refs local > local &&
+  for c in $(ipfsi 0 refs -r $HASH); do
+    grep $c local || return 1
+  done
+'
+
+test_expect_success 'ipfs pin push --receipt records the receipt of the peer' '
+  ipfsi 0 transfer receipts > receipts &&
+  test_must_be_empty receipts &&
+  ipfsi 0 pin push --receipt $HASH $RECEIVER > actual &&
+  grep "^pushed $HASH to $RECEIVER: .*, pinned, receipt received$" actual &&
+  ipfsi 0 transfer receipts $HASH > receipts &&
+  grep "^$HASH  *$RECEIVER  *.*  *valid$" receipts &&
+  test_line_count = 1 receipts
+'
+
+test_expect_success 'ipfs pin push fails for a peer which does not allow it' '
+  OTHER=$(echo "not allowed" | ipfsi 2 add -q) &&
+  RECEIVER_ADDR=$(ipfsi 1 swarm addrs local --id | head -1) &&
+  test_must_fail ipfsi 2 pin push $OTHER $RECEIVER_ADDR 2> err &&
+  grep "doesn.t accept pushes" err &&
+  test_must_fail ipfsi 1 pin ls $OTHER
+'
+
+test_expect_success 'ipfs pin push fails for a DAG which is not stored locally' '
+  test_must_fail ipfsi 0 pin push $OTHER $RECEIVER
+'
+
+test_expect_success "shut down iptb" '
+  iptb stop
+'
+
+test_done
@@ -0,0 +1,29 @@
+#!/usr/bin/env bash
+
+test_description="Test offloading pins to archivers"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success 'ipfs archive ls lists no receipt' '
+  ipfs archive ls > actual &&
+  test_must_be_empty actual
+'
+
+test_expect_success 'ipfs archive offload fails without an archiver' '
+  HASH=$(echo "archived" | ipfs add -q) &&
+  test_must_fail ipfs archive offload $HASH 2> err &&
+  grep "no archiver" err
+'
+
+test_expect_success 'ipfs archive offload fails with an unknown archiver' '
+  test_must_fail ipfs archive offload --to=tape $HASH 2> err &&
+  grep "no archiver named \"tape\"" err
+'
+
+test_expect_success 'the pin is kept' '
+  ipfs pin ls --type=recursive $HASH
+'
+
+test_done
@@ -98,6 +98,58 @@ EOF
   test_cmp expected stat_out_human
 '
 
+test_expect_success "'ipfs bitswap limit' sets a limit" '
+  ipfs bitswap limit "$PEERID" 1MB &&
+  ipfs bitswap limit >limit_out &&
+  printf "%s\t1.0 MB/s\n" "$PEERID" >expected &&
+  test_cmp expected limit_out
+'
+
+test_expect_success "'ipfs bitswap limit' removes a limit" '
+  ipfs bitswap limit "$PEERID" 0 &&
+  ipfs bitswap limit >limit_out &&
+  test_must_be_empty limit_out
+'
+
+test_expect_success "'ipfs bitswap ledger-reset' succeeds" '
+  ipfs bitswap ledger-reset "$PEERID" &&
+  ipfs bitswap ledger "$PEERID" >ledger_out &&
+  grep "Exchanges:.0" ledger_out
+'
+
+test_expect_success "'ipfs bitswap sessions' lists no session when idle" '
+  ipfs bitswap sessions >sessions_out &&
+  test_must_be_empty sessions_out
+'
+
+test_expect_success "'ipfs bitswap qos' fails without QoS.Bandwidth" '
+  test_must_fail ipfs bitswap qos 2>qos_err &&
+  grep "QoS is not configured" qos_err
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "configure the QoS classes" '
+  ipfs config --json QoS "{
+    \"Bandwidth\": \"10MB\",
+    \"Classes\": [{\"Name\": \"partners\", \"Priority\": 10, \"Share\": 0.5, \"Peers\": [\"$PEERID\"]}]
+  }"
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs bitswap qos' lists the classes" '
+  ipfs bitswap qos >qos_out &&
+  grep "^partners  *10  *50%" qos_out &&
+  grep "^default  *0  *0%" qos_out
+'
+
+test_expect_success "'ipfs bitswap qos' shows the class of peers" '
+  ipfs bitswap qos "$PEERID" QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN >qos_out &&
+  grep "^$PEERID  *partners$" qos_out &&
+  grep "^QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN  *default$" qos_out
+'
+
 test_kill_ipfs_daemon
 
 test_done
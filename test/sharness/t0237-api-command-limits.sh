@@ -0,0 +1,42 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the concurrency limits of the API commands"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "limit 'pin add' to one request at a time" '
+  ipfs config --json API.CommandLimits "{\"pin/add\": {\"Concurrency\": 1}}"
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "start a 'pin add' of missing content" '
+  MISSING=$(random 1000 | ipfs add -q --only-hash) &&
+  ipfs pin add --timeout=3s $MISSING 2>/dev/null &
+  PIN_PID=$! &&
+  go-sleep 500ms
+'
+
+test_expect_success "a second 'pin add' is rejected as busy" '
+  test_must_fail ipfs pin add $MISSING 2>pin_err &&
+  grep "busy: too many concurrent '"'"'pin add'"'"' requests" pin_err
+'
+
+test_expect_success "the other commands are not limited" '
+  echo "hello" | ipfs add -q >/dev/null
+'
+
+test_expect_success "'pin add' runs again once the first one is done" '
+  wait $PIN_PID
+  HASH=$(echo "limits" | ipfs add -q --pin=false) &&
+  ipfs pin add $HASH
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -0,0 +1,106 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the tokens of the HTTP API"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_launch_ipfs_daemon
+
+test_expect_success "the API is open without tokens" '
+  HASH=$(echo "tokens" | ipfs add -q)
+'
+
+test_expect_success "add an admin token through the daemon" '
+  ADMIN=$(ipfs config api token add admin --scopes=admin) &&
+  test -n "$ADMIN"
+'
+
+test_expect_success "the token is stored hashed" '
+  IPFS_API_TOKEN=$ADMIN ipfs config API.Authorizations.admin.Token >token_hash &&
+  grep "^sha256:" token_hash
+'
+
+test_expect_success "the requests without a token are rejected" '
+  curl -s -o /dev/null -w "%{http_code}\n" -X POST "http://$API_ADDR/api/v0/cat?arg=$HASH" >status &&
+  echo 401 >expected &&
+  test_cmp expected status
+'
+
+test_expect_success "the command line sends IPFS_API_TOKEN" '
+  test_must_fail ipfs cat $HASH 2>cat_err &&
+  grep "unauthorized" cat_err &&
+  IPFS_API_TOKEN=$ADMIN ipfs cat $HASH >actual &&
+  echo "tokens" >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "add read-only and pin tokens" '
+  READER=$(IPFS_API_TOKEN=$ADMIN ipfs config api token add reader) &&
+  PINNER=$(IPFS_API_TOKEN=$ADMIN ipfs config api token add pinner --scopes=pin) &&
+  IPFS_API_TOKEN=$ADMIN ipfs config api token ls >tokens &&
+  printf "admin   admin\npinner  pin\nreader  read-only\n" >expected &&
+  test_cmp expected tokens
+'
+
+test_expect_success "a token only allows the commands of its scopes" '
+  IPFS_API_TOKEN=$READER ipfs cat $HASH >/dev/null &&
+  test_must_fail env IPFS_API_TOKEN=$READER ipfs pin add $HASH 2>pin_err &&
+  grep "forbidden" pin_err &&
+  IPFS_API_TOKEN=$PINNER ipfs pin add $HASH &&
+  curl -s -o /dev/null -w "%{http_code}\n" -X POST -H "Authorization: Bearer $PINNER" "http://$API_ADDR/api/v0/cat?arg=$HASH" >status &&
+  echo 403 >expected &&
+  test_cmp expected status
+'
+
+test_expect_success "a command given in the path is authorized like its command" '
+  curl -s -o /dev/null -w "%{http_code}\n" -X POST -H "Authorization: Bearer $READER" "http://$API_ADDR/api/v0/cat/$HASH" >status &&
+  echo 200 >expected &&
+  test_cmp expected status &&
+  curl -s -o /dev/null -w "%{http_code}\n" -X POST -H "Authorization: Bearer $READER" "http://$API_ADDR/api/v0/pin/add/$HASH" >status &&
+  echo 403 >expected &&
+  test_cmp expected status
+'
+
+test_expect_success "the debugging endpoints require a token" '
+  curl -s -o /dev/null -w "%{http_code}\n" "http://$API_ADDR/debug/vars" >status &&
+  curl -s -o /dev/null -w "%{http_code}\n" "http://$API_ADDR/debug/pprof/" >>status &&
+  curl -s -o /dev/null -w "%{http_code}\n" "http://$API_ADDR/logs" >>status &&
+  curl -s -o /dev/null -w "%{http_code}\n" -H "Authorization: Bearer $READER" "http://$API_ADDR/debug/vars" >>status &&
+  curl -s -o /dev/null -w "%{http_code}\n" -H "Authorization: Bearer $ADMIN" "http://$API_ADDR/debug/vars" >>status &&
+  printf "401\n401\n401\n403\n200\n" >expected &&
+  test_cmp expected status
+'
+
+test_expect_success "a removed token is rejected right away" '
+  IPFS_API_TOKEN=$ADMIN ipfs config api token rm reader &&
+  test_must_fail env IPFS_API_TOKEN=$READER ipfs cat $HASH
+'
+
+test_kill_ipfs_daemon
+
+test_launch_ipfs_daemon --unrestricted-api
+
+test_expect_success "the writable gateway of the API requires a token" '
+  DIR=$(IPFS_API_TOKEN=$ADMIN ipfs object new unixfs-dir) &&
+  echo "written" >written &&
+  curl -s -o /dev/null -w "%{http_code}\n" -X PUT --data-binary @written "http://$API_ADDR/ipfs/$DIR/written" >status &&
+  curl -s -o /dev/null -w "%{http_code}\n" -H "Authorization: Bearer $PINNER" "http://$API_ADDR/ipfs/$DIR" >>status &&
+  curl -s -o /dev/null -w "%{http_code}\n" -X PUT -H "Authorization: Bearer $PINNER" --data-binary @written "http://$API_ADDR/ipfs/$DIR/written" >>status &&
+  printf "401\n403\n403\n" >expected &&
+  test_cmp expected status
+'
+
+test_expect_success "an admin token writes through the gateway of the API" '
+  curl -s -o /dev/null -w "%{http_code}\n" -X PUT -H "Authorization: Bearer $ADMIN" --data-binary @written "http://$API_ADDR/ipfs/$DIR/written" >status &&
+  echo 201 >expected &&
+  test_cmp expected status
+'
+
+test_kill_ipfs_daemon
+
+test_done
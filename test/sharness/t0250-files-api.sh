@@ -788,4 +788,33 @@ test_sharding "(cidv1 root)" "--cid-version=1"
 
 test_kill_ipfs_daemon
 
+test_launch_ipfs_daemon --offline
+
+test_expect_success "files cp --progress fetches the whole source" '
+  CP_HASH=$(echo "progress" | ipfs add -q) &&
+  ipfs files cp --progress /ipfs/$CP_HASH /cp-progress > cp_out &&
+  grep -q "^copied 1 blocks" cp_out &&
+  echo progress > cp_exp &&
+  ipfs files read /cp-progress > cp_read &&
+  test_cmp cp_exp cp_read
+'
+
+test_expect_success "files cp --background returns the copy ID" '
+  ipfs files cp --background /ipfs/$CP_HASH /cp-background > bg_out &&
+  grep -q "^started copy [0-9]*$" bg_out
+'
+
+test_expect_success "files status lists the copies" '
+  ipfs files status > status_out &&
+  grep -q "/cp-progress .*done" status_out &&
+  grep -q "/cp-background " status_out
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "files cp --background fails without a daemon" '
+  test_must_fail ipfs files cp --background /ipfs/$CP_HASH /cp-nodaemon 2> bg_err &&
+  grep -q "requires a running daemon" bg_err
+'
+
 test_done
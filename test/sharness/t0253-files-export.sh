@@ -0,0 +1,49 @@
+#!/usr/bin/env bash
+
+test_description="Test the export of the changes of the mfs"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "ipfs files export exports the whole directory" '
+  ipfs files mkdir -p /sync/sub &&
+  echo "a" | ipfs files write --create /sync/a &&
+  echo "b" | ipfs files write --create /sync/sub/b &&
+  echo "c" | ipfs files write --create /sync/c &&
+  ipfs files export --pin /sync > full.tar &&
+  mkdir full && tar -xf full.tar -C full &&
+  test_cmp full/sub/b <(echo "b") &&
+  SNAPSHOT=$(ipfs files stat --hash /sync) &&
+  grep "\"Root\":\"$SNAPSHOT\"" full/.ipfs-export.json &&
+  ipfs pin ls --type=recursive $SNAPSHOT
+'
+
+test_expect_success "ipfs files export --since exports the changes only" '
+  echo "a2" | ipfs files write --truncate /sync/a &&
+  ipfs files rm /sync/c &&
+  ipfs files export --pin --since $SNAPSHOT /sync > changes.tar &&
+  tar -tf changes.tar | sort > entries &&
+  printf ".ipfs-export.json\na\n" > expected &&
+  test_cmp expected entries &&
+  mkdir changes && tar -xf changes.tar -C changes &&
+  grep "\"Deleted\":\[\"c\"\]" changes/.ipfs-export.json
+'
+
+test_expect_success "the pin of the snapshot is replaced" '
+  NEW=$(ipfs files stat --hash /sync) &&
+  ipfs pin ls --type=recursive $NEW &&
+  test_must_fail ipfs pin ls --type=recursive $SNAPSHOT
+'
+
+test_expect_success "ipfs files export writes CAR archives" '
+  ipfs files export --format=car --since $NEW /sync > empty.car &&
+  ipfs files export --format=car /sync > full.car &&
+  test $(wc -c < empty.car) -lt $(wc -c < full.car)
+'
+
+test_expect_success "ipfs files export rejects unknown formats" '
+  test_must_fail ipfs files export --format=zip /sync
+'
+
+test_done
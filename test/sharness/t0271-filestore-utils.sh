@@ -129,6 +129,16 @@ test_filestore_verify() {
     grep no-file verify_actual | grep -q somedir/file1
   '
 
+  test_expect_success "'$IPFS_CMD filestore ls HASH' still lists the moved file" '
+    $IPFS_CMD filestore ls $FILE1_HASH > ls_actual &&
+    grep -q somedir/file1 ls_actual
+  '
+
+  test_expect_success "'$IPFS_CMD filestore verify HASH' shows the moved file as missing" '
+    $IPFS_CMD filestore verify $FILE1_HASH > verify_actual &&
+    grep no-file verify_actual | grep -q somedir/file1
+  '
+
   test_expect_success "move file back" '
     mv somedir/file1.bk somedir/file1
   '